@@ -15,7 +15,7 @@ import (
 	"github.com/fatih/color"
 )
 
-func CopyShard(srcAddr, dstAddr, shardID string) error {
+func CopyShard(srcAddr, dstAddr, shardID string, dryRun bool) error {
 	id, err := strconv.ParseUint(shardID, 10, 64)
 	if err != nil {
 		return err
@@ -25,6 +25,7 @@ func CopyShard(srcAddr, dstAddr, shardID string) error {
 		SourceNodeAddr: srcAddr,
 		DestNodeAddr:   dstAddr,
 		ShardID:        id,
+		DryRun:         dryRun,
 	}
 
 	var resp controller.CopyShardResponse
@@ -33,11 +34,44 @@ func CopyShard(srcAddr, dstAddr, shardID string) error {
 	if err := RequestAndWaitResp(dstAddr, reqTyp, respTyp, req, &resp); err != nil {
 		return err
 	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
 
+	if dryRun {
+		// the size is known by the source only
+		size, err := shardSize(srcAddr, id)
+		if err != nil {
+			return err
+		}
+		plan := resp.Plan
+		if resp.Rate > 0 {
+			plan = append(plan, fmt.Sprintf("transfer %s in about %v at %s/s",
+				formatBytes(size), time.Duration(size/resp.Rate)*time.Second, formatBytes(resp.Rate)))
+		} else {
+			plan = append(plan, fmt.Sprintf("transfer %s without rate limit", formatBytes(size)))
+		}
+		printApproval(&controller.Approval{Plan: plan})
+		return nil
+	}
 	fmt.Println(resp.Msg)
 	return nil
 }
 
+// shardSize returns the size of shard on disk of node addr.
+func shardSize(addr string, id uint64) (int64, error) {
+	var resp controller.ShardResponse
+	respTyp := byte(controller.ResponseShard)
+	reqTyp := byte(controller.RequestShard)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, controller.GetShardRequest{ShardID: id}, &resp); err != nil {
+		return 0, err
+	}
+	if resp.Code != 0 {
+		return 0, errors.New(resp.Msg)
+	}
+	return resp.Size, nil
+}
+
 func TruncateShards(delay string, addr string) error {
 	delaySec, err := strconv.ParseInt(delay, 10, 64)
 	if err != nil {
@@ -180,6 +214,18 @@ func GetShard(addr, shard string) error {
 	color.Set(color.Bold)
 	fmt.Print(color.GreenString("Nodes: "))
 	fmt.Printf("%v\n", resp.Nodes)
+	if len(resp.Owners) > 0 {
+		color.Set(color.Bold)
+		color.Green("Usage Reported by Owners:\n")
+		for _, o := range resp.Owners {
+			if o.Size < 0 {
+				fmt.Print("node ", o.NodeID, "\tnot reported\n")
+				continue
+			}
+			fmt.Print("node ", o.NodeID, "\t", formatBytes(o.Size), "\tlast write ", formatTimeStamp(o.LastWrite),
+				"\treported at ", formatTimeStamp(o.ReportedAt), "\n")
+		}
+	}
 	fmt.Println()
 	return nil
 }
@@ -198,6 +244,126 @@ func CopyShardStatus(addr string) error {
 		fmt.Print(t.ShardID, "\t", t.Database, "\t", t.Rp, "\t", t.CurrentSize, "/", t.TotalSize, "\t", t.Source, "\n")
 	}
 	fmt.Println()
+	if len(resp.Failed) > 0 {
+		color.Set(color.Bold)
+		color.Red("Failed Copy Tasks:\n")
+		for _, t := range resp.Failed {
+			fmt.Print(t.ShardID, "\t", t.Database, "\t", t.Rp, "\t", t.Source, "\t", t.Error, "\n")
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func formatETA(seconds int64) string {
+	if seconds < 0 {
+		return "unknown"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func DrainStatus(addr, drainedAddr string) error {
+	req := &controller.DrainStatusRequest{
+		DataNodeAddr: drainedAddr,
+	}
+
+	var resp controller.DrainStatusResponse
+	respTyp := byte(controller.ResponseDrainStatus)
+	reqTyp := byte(controller.RequestDrainStatus)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	if !resp.Freezed {
+		color.Yellow("Node %d is not freezed, new shards may still be created on it\n", resp.NodeID)
+	}
+	color.Set(color.Bold)
+	color.Green("Shards Remaining on Node %d:\n", resp.NodeID)
+	for _, sh := range resp.Shards {
+		size := "unknown"
+		if sh.Size >= 0 {
+			size = formatBytes(sh.Size)
+		}
+		dst := sh.Destination
+		if dst == "" {
+			dst = "not copied"
+		}
+		fmt.Print(sh.ShardID, "\t", sh.Database, "\t", sh.Rp, "\t", formatBytes(int64(sh.Copied)), "/", size,
+			"\t", dst, "\t", formatBytes(sh.Rate), "/s\t", formatETA(sh.ETA), "\t", sh.Error, "\n")
+	}
+	fmt.Println()
+	fmt.Printf("%d shards, %s remaining at %s/s, ETA %s\n",
+		len(resp.Shards), formatBytes(resp.BytesRemaining), formatBytes(resp.Rate), formatETA(resp.ETA))
+	for _, e := range resp.Errors {
+		color.Red("%s\n", e)
+	}
+	return nil
+}
+
+// DrainReads drains or resumes reads of other nodes served by node at addr by
+// "drain" or "resume", or shows whether they are drained if op is empty.
+func DrainReads(addr, op string) error {
+	req := &controller.DrainReadsRequest{}
+	switch op {
+	case "":
+	case "drain", "resume":
+		drain := op == "drain"
+		req.Drain = &drain
+	default:
+		return fmt.Errorf("Unknown operation %s, should be drain or resume", op)
+	}
+
+	var resp controller.DrainReadsResponse
+	respTyp := byte(controller.ResponseDrainReads)
+	reqTyp := byte(controller.RequestDrainReads)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	if resp.Drained {
+		color.Yellow("Reads of other nodes are drained, %d in flight\n", resp.InFlight)
+	} else {
+		color.Green("Reads of other nodes are served, %d in flight\n", resp.InFlight)
+	}
+	return nil
+}
+
+// CatchUpStatus shows stale shards of node at addr being caught up from
+// other owners.
+func CatchUpStatus(addr string) error {
+	req := &controller.CatchUpStatusRequest{}
+
+	var resp controller.CatchUpStatusResponse
+	respTyp := byte(controller.ResponseCatchUpStatus)
+	reqTyp := byte(controller.RequestCatchUpStatus)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	if len(resp.Shards) == 0 {
+		color.Green("No stale shards on node %d\n", resp.NodeID)
+		return nil
+	}
+	color.Set(color.Bold)
+	color.Yellow("Stale Shards on Node %d:\n", resp.NodeID)
+	for _, sh := range resp.Shards {
+		marked := time.Unix(0, sh.MarkedAt*controller.MILLISECOND).UTC().Format(time.RFC3339)
+		source := sh.Source
+		if source == "" {
+			source = "-"
+		}
+		fmt.Print(sh.ShardID, "\t", sh.Database, "\t", sh.Rp, "\t", marked, "\t", sh.State,
+			"\t", source, "\t", sh.Attempts, "\t", sh.Error, "\n")
+	}
 	return nil
 }
 
@@ -224,7 +390,7 @@ func KillCopyShard(srcAddr, dstAddr, shardID string) error {
 	return nil
 }
 
-func RemoveShard(addr, shardID string) error {
+func RemoveShard(addr, shardID, token string, dryRun bool) error {
 	id, err := strconv.ParseUint(shardID, 10, 64)
 	if err != nil {
 		return err
@@ -233,6 +399,8 @@ func RemoveShard(addr, shardID string) error {
 	req := &controller.RemoveShardRequest{
 		DataNodeAddr: addr,
 		ShardID:      id,
+		Token:        token,
+		DryRun:       dryRun,
 	}
 
 	var resp controller.RemoveShardResponse
@@ -241,14 +409,133 @@ func RemoveShard(addr, shardID string) error {
 	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
 		return err
 	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	if printApproval(&resp.Approval) {
+		return nil
+	}
+	fmt.Println(resp.Msg)
+	return nil
+}
+
+func CheckConsistency(addr string) error {
+	var resp controller.CheckConsistencyResponse
+	respTyp := byte(controller.ResponseCheckConsistency)
+	reqTyp := byte(controller.RequestCheckConsistency)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, struct{}{}, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	if resp.Report.Consistent() {
+		color.Green("Shards are consistent with meta\n")
+		return nil
+	}
+	color.Set(color.Bold)
+	color.Red("Missing Shards:\n")
+	for _, sh := range resp.Report.Missing {
+		fmt.Print(sh.ShardID, "\t", sh.Database, "\t", sh.Rp, "\t", sh.Path, "\n")
+	}
+	fmt.Println()
+	color.Set(color.Bold)
+	color.Yellow("Orphan Shards:\n")
+	for _, sh := range resp.Report.Orphan {
+		fmt.Print(sh.ShardID, "\t", sh.Database, "\t", sh.Rp, "\t", sh.Path, "\n")
+	}
+	fmt.Println()
+	if len(resp.Report.Quarantined) > 0 {
+		color.Set(color.Bold)
+		color.Red("Quarantined Shards:\n")
+		for _, sh := range resp.Report.Quarantined {
+			fmt.Print(sh.ShardID, "\t", sh.Database, "\t", sh.Rp, "\t", sh.Reason, "\t", sh.Path, "\n")
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// VerifyShard compares digests of a shard on all its owners, returning
+// whether its replicas diverge.
+func VerifyShard(addr, shard string) (bool, error) {
+	id, err := strconv.ParseUint(shard, 10, 64)
+	if err != nil || id < 1 {
+		return false, errors.New("Please specify correct shard id")
+	}
+	var resp controller.VerifyShardResponse
+	respTyp := byte(controller.ResponseVerifyShard)
+	reqTyp := byte(controller.RequestVerifyShard)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, &controller.VerifyShardRequest{ShardID: id}, &resp); err != nil {
+		return false, err
+	}
+	if resp.Code != 0 {
+		return false, errors.New(resp.Msg)
+	}
+
+	color.Set(color.Bold)
+	color.Green("Digests of Owners:\n")
+	verified := 0
+	for _, o := range resp.Owners {
+		if o.Error != "" {
+			fmt.Print("node ", o.NodeID, "\t", color.RedString(o.Error), "\n")
+			continue
+		}
+		verified++
+		fmt.Print("node ", o.NodeID, "\t", o.Series, " series\t", o.Points, " points\n")
+	}
+	fmt.Println()
+	if verified < 2 {
+		color.Yellow("Shard %d has less than 2 owners verified\n", id)
+		return false, nil
+	}
+	if !resp.Diverged() {
+		color.Green("Replicas of shard %d are consistent\n", id)
+		return false, nil
+	}
+
+	color.Set(color.Bold)
+	color.Red("Series Diverged: %d\n", resp.DiffCount)
+	for _, d := range resp.Diffs {
+		fmt.Print(d.Kind, "\t", d.Nodes, "\t", d.Key, "\n")
+	}
+	if len(resp.Diffs) < resp.DiffCount {
+		fmt.Println("...")
+	}
+	fmt.Println()
+	return true, nil
+}
+
+func RepairShard(addr, shardID, repair, srcAddr string) error {
+	id, err := strconv.ParseUint(shardID, 10, 64)
+	if err != nil {
+		return err
+	}
+
+	req := &controller.RepairShardRequest{
+		ShardID:        id,
+		Action:         repair,
+		SourceNodeAddr: srcAddr,
+	}
+
+	var resp controller.RepairShardResponse
+	respTyp := byte(controller.ResponseRepairShard)
+	reqTyp := byte(controller.RequestRepairShard)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
 
 	fmt.Println(resp.Msg)
 	return nil
 }
 
-func RemoveDataNode(addr, removed_addr string) error {
+func RemoveDataNode(addr, removed_addr, token string, dryRun bool) error {
 	req := &controller.RemoveDataNodeRequest{
 		DataNodeAddr: removed_addr,
+		Token:        token,
+		DryRun:       dryRun,
 	}
 
 	var resp controller.RemoveDataNodeResponse
@@ -257,13 +544,162 @@ func RemoveDataNode(addr, removed_addr string) error {
 	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
 		return err
 	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
 
+	if printApproval(&resp.Approval) {
+		return nil
+	}
 	color.Set(color.Bold)
 	color.Green("Result: ")
 	fmt.Println(resp.Msg)
 	return nil
 }
 
+func DropDatabase(addr, db, token string, dryRun bool) error {
+	req := &controller.DropDatabaseRequest{
+		Database: db,
+		Token:    token,
+		DryRun:   dryRun,
+	}
+
+	var resp controller.DropDatabaseResponse
+	respTyp := byte(controller.ResponseDropDatabase)
+	reqTyp := byte(controller.RequestDropDatabase)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	if printApproval(&resp.Approval) {
+		return nil
+	}
+	color.Set(color.Bold)
+	color.Green("Result: ")
+	fmt.Println(resp.Msg)
+	return nil
+}
+
+// PurgeHintedHandoff drops hinted data queued on the node of addr for node
+// nodeID, of shard shardID if not 0 or older than before otherwise.
+func PurgeHintedHandoff(addr string, nodeID, shardID uint64, before time.Time, token string, dryRun bool) error {
+	req := &controller.PurgeHintedHandoffRequest{
+		NodeID:  nodeID,
+		ShardID: shardID,
+		Token:   token,
+		DryRun:  dryRun,
+	}
+	if !before.IsZero() {
+		req.Before = before.UnixNano() / 1e6
+	}
+
+	var resp controller.PurgeHintedHandoffResponse
+	respTyp := byte(controller.ResponsePurgeHintedHandoff)
+	reqTyp := byte(controller.RequestPurgeHintedHandoff)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	if printApproval(&resp.Approval) {
+		return nil
+	}
+	color.Set(color.Bold)
+	color.Green("Result: ")
+	if ev := resp.Purged; ev != nil && !ev.Empty() {
+		fmt.Printf("purged %d blocks, %s, %d points of shards %v\n", ev.Blocks, formatBytes(ev.Bytes), ev.Points, ev.ShardIDs)
+	} else {
+		fmt.Println("nothing purged")
+	}
+	return nil
+}
+
+// TransferHintedHandoff moves hinted data queued on the node of addr for node
+// nodeID, or for all nodes if 0, to the queues of the node of controller
+// address to.
+func TransferHintedHandoff(addr string, nodeID uint64, to string) error {
+	req := &controller.TransferHintedHandoffRequest{
+		NodeID: nodeID,
+		To:     to,
+	}
+
+	var resp controller.TransferHintedHandoffResponse
+	respTyp := byte(controller.ResponseTransferHintedHandoff)
+	reqTyp := byte(controller.RequestTransferHintedHandoff)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
+
+	for _, t := range resp.Transfers {
+		fmt.Printf("node %d: moved %d blocks, %s", t.NodeID, t.Blocks, formatBytes(t.Bytes))
+		if t.Error != "" {
+			color.Red(", %s", t.Error)
+		} else {
+			fmt.Println()
+		}
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+	color.Set(color.Bold)
+	color.Green("Result: ")
+	if len(resp.Transfers) == 0 {
+		fmt.Println("nothing queued")
+	} else {
+		fmt.Println(resp.Msg)
+	}
+	return nil
+}
+
+// ReplayHintedHandoff moves hinted data of the queue in directory dir on the
+// node of addr to its queue for node nodeID.
+func ReplayHintedHandoff(addr string, nodeID uint64, dir string) error {
+	req := &controller.ReplayHintedHandoffRequest{
+		NodeID: nodeID,
+		Dir:    dir,
+	}
+
+	var resp controller.ReplayHintedHandoffResponse
+	respTyp := byte(controller.ResponseReplayHintedHandoff)
+	reqTyp := byte(controller.RequestReplayHintedHandoff)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("%s, %d blocks moved", resp.Msg, resp.Blocks)
+	}
+	color.Set(color.Bold)
+	color.Green("Result: ")
+	fmt.Printf("replayed %d blocks\n", resp.Blocks)
+	return nil
+}
+
+// printApproval prints the plan of an operation not executed yet, returning
+// whether there is one.
+func printApproval(a *controller.Approval) bool {
+	if len(a.Plan) == 0 {
+		return false
+	}
+	color.Set(color.Bold)
+	color.Yellow("Plan:\n")
+	for _, step := range a.Plan {
+		fmt.Println("  -", step)
+	}
+	fmt.Println()
+	if a.Token == "" {
+		fmt.Println("Dry run, nothing is changed.")
+		return true
+	}
+	fmt.Println("Nothing is changed yet. To execute the plan run the same command before", formatTimeStamp(a.Expires), "with:")
+	fmt.Println("  --token", a.Token)
+	return true
+}
+
 func freezeDataNode(addr, freezed_addr string, freeze bool) error {
 	req := &controller.FreezeDataNodeRequest{
 		DataNodeAddr: freezed_addr,
@@ -325,6 +761,12 @@ func ShowDataNodes(addr string) error {
 		if n.Freezed {
 			fmt.Print("\t(freezed)")
 		}
+		if b := n.Backlog; b != nil {
+			fmt.Printf("\tbacklog: %d writes, %d points", b.Writes, b.Points)
+			if !b.UpdatedAt.IsZero() {
+				fmt.Printf(" (%s ago)", time.Since(b.UpdatedAt).Truncate(time.Second))
+			}
+		}
 		fmt.Print("\n")
 	}
 	fmt.Println()
@@ -0,0 +1,519 @@
+package action
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/services/controller"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+)
+
+const (
+	// BackupManifestFile is the manifest of a backup directory.
+	BackupManifestFile = "manifest.json"
+	// BackupMetaFile is the meta data of a backup directory.
+	BackupMetaFile = "meta"
+	// backupShardsDir holds files of shards of a backup directory by id.
+	backupShardsDir = "shards"
+)
+
+// BackupManifest records what a backup directory holds. Shards are markers
+// of the last backup, incremental backups transfer shards changed since only.
+type BackupManifest struct {
+	Snapshot string        `json:"snapshot"`
+	Index    uint64        `json:"index"`
+	Time     int64         `json:"time"` // milliseconds
+	Shards   []BackupShard `json:"shards"`
+}
+
+// BackupShard is a shard backed up from NodeID, LastModified and Files are
+// as the owner snapshot them.
+type BackupShard struct {
+	ShardID      uint64                    `json:"shard_id"`
+	Database     string                    `json:"database"`
+	Rp           string                    `json:"rp"`
+	NodeID       uint64                    `json:"node_id"`
+	LastModified int64                     `json:"last_modified"` // milliseconds
+	Files        []controller.SnapshotFile `json:"files"`
+}
+
+// snapshotCluster takes a consistent snapshot of the cluster.
+func snapshotCluster(addr string) (*controller.ClusterSnapshotResponse, error) {
+	var resp controller.ClusterSnapshotResponse
+	respTyp := byte(controller.ResponseClusterSnapshot)
+	reqTyp := byte(controller.RequestClusterSnapshot)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, struct{}{}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, errors.New(resp.Msg)
+	}
+	return &resp, nil
+}
+
+// Snapshot takes a consistent snapshot of the cluster and writes its manifest
+// to path.
+func Snapshot(addr, path string) error {
+	resp, err := snapshotCluster(addr)
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, buf, 0600); err != nil {
+		return err
+	}
+
+	color.Set(color.Bold)
+	color.Green("Snapshot %s at meta index %d:\n", resp.ID, resp.Index)
+	failed := 0
+	for _, n := range resp.Nodes {
+		if n.Error != "" {
+			failed++
+			fmt.Print("node ", n.NodeID, "\t", n.TCPHost, "\t", color.RedString(n.Error), "\n")
+			continue
+		}
+		files, size := 0, int64(0)
+		for _, sh := range n.Shards {
+			if sh.Error != "" {
+				failed++
+				fmt.Print("node ", n.NodeID, "\tshard ", sh.ShardID, "\t", color.RedString(sh.Error), "\n")
+				continue
+			}
+			for _, f := range sh.Files {
+				files++
+				size += f.Size
+			}
+		}
+		fmt.Print("node ", n.NodeID, "\t", n.TCPHost, "\t", len(n.Shards), " shards\t", files, " files\t", size, " bytes\n")
+	}
+	fmt.Println()
+	if failed > 0 {
+		color.Yellow("%d snapshots failed, manifest written to %s\n", failed, path)
+		return nil
+	}
+	color.Green("Manifest written to %s, release snapshot %s once copied\n", path, resp.ID)
+	return nil
+}
+
+// ReleaseSnapshot removes a snapshot from all nodes.
+func ReleaseSnapshot(addr, id string) error {
+	if err := releaseSnapshot(addr, id); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func releaseSnapshot(addr, id string) error {
+	var resp controller.ReleaseSnapshotResponse
+	respTyp := byte(controller.ResponseReleaseSnapshot)
+	reqTyp := byte(controller.RequestReleaseSnapshot)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, &controller.ReleaseSnapshotRequest{ID: id}, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+	return nil
+}
+
+// Backup copies a consistent snapshot of the cluster into dir. Incremental
+// backups transfer shards modified since the backup in dir only, and files of
+// them not backed up yet.
+func Backup(addr, dir string, incremental bool) error {
+	if err := os.MkdirAll(filepath.Join(dir, backupShardsDir), 0700); err != nil {
+		return err
+	}
+	var last *BackupManifest
+	if incremental {
+		var err error
+		if last, err = ReadBackupManifest(dir); os.IsNotExist(err) {
+			color.Yellow("No backup in %s yet, taking a full backup\n", dir)
+		} else if err != nil {
+			return err
+		}
+	}
+	lastShards := make(map[uint64]*BackupShard)
+	if last != nil {
+		for i := range last.Shards {
+			lastShards[last.Shards[i].ShardID] = &last.Shards[i]
+		}
+	}
+
+	snapshot, err := snapshotCluster(addr)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := releaseSnapshot(addr, snapshot.ID); err != nil {
+			color.Yellow("Failed to release snapshot %s: %v\n", snapshot.ID, err)
+		}
+	}()
+
+	// back up each shard from an owner snapshot it, the one of the last
+	// backup if possible as files of different owners differ
+	type source struct {
+		node  *controller.NodeSnapshot
+		shard *controller.ShardSnapshot
+	}
+	sources := make(map[uint64]source)
+	failures := make(map[uint64]string)
+	for i := range snapshot.Nodes {
+		n := &snapshot.Nodes[i]
+		for j := range n.Shards {
+			sh := &n.Shards[j]
+			if sh.Error != "" {
+				failures[sh.ShardID] = fmt.Sprint("node ", n.NodeID, ": ", sh.Error)
+				continue
+			}
+			_, ok := sources[sh.ShardID]
+			preferred := lastShards[sh.ShardID] != nil && lastShards[sh.ShardID].NodeID == n.NodeID
+			if !ok || preferred {
+				sources[sh.ShardID] = source{node: n, shard: sh}
+			}
+		}
+	}
+	for id, msg := range failures {
+		if _, ok := sources[id]; !ok {
+			return fmt.Errorf("shard %d not snapshot by any owner, %s", id, msg)
+		}
+	}
+	for _, n := range snapshot.Nodes {
+		if n.Error != "" {
+			return fmt.Errorf("node %d failed to snapshot: %s", n.NodeID, n.Error)
+		}
+	}
+
+	ids := make([]uint64, 0, len(sources))
+	for id := range sources {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	manifest := &BackupManifest{
+		Snapshot: snapshot.ID,
+		Index:    snapshot.Index,
+		Time:     time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	var transferred, skipped, files, bytes int64
+	for _, id := range ids {
+		src := sources[id]
+		sh := BackupShard{
+			ShardID:      id,
+			Database:     src.shard.Database,
+			Rp:           src.shard.Rp,
+			NodeID:       src.node.NodeID,
+			LastModified: src.shard.LastModified,
+			Files:        src.shard.Files,
+		}
+		lastShard := lastShards[id]
+		if lastShard != nil && lastShard.NodeID == sh.NodeID && lastShard.LastModified == sh.LastModified {
+			manifest.Shards = append(manifest.Shards, *lastShard)
+			skipped++
+			continue
+		}
+		n, size, err := backupShard(src.node.TCPHost, snapshot.ID, filepath.Join(dir, backupShardsDir, strconv.FormatUint(id, 10)), &sh, lastShard)
+		if err != nil {
+			return fmt.Errorf("shard %d: %v", id, err)
+		}
+		manifest.Shards = append(manifest.Shards, sh)
+		transferred++
+		files += n
+		bytes += size
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, BackupMetaFile), snapshot.Meta); err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, BackupManifestFile), buf); err != nil {
+		return err
+	}
+	if err := removeStaleShards(filepath.Join(dir, backupShardsDir), manifest); err != nil {
+		color.Yellow("Failed to remove shards not in backup: %v\n", err)
+	}
+
+	color.Set(color.Bold)
+	color.Green("Backup of snapshot %s at meta index %d:\n", snapshot.ID, snapshot.Index)
+	fmt.Print(transferred, " shards transferred\t", files, " files\t", bytes, " bytes\n")
+	fmt.Print(skipped, " shards not modified since last backup\n")
+	return nil
+}
+
+// ReadBackupManifest reads the manifest of the backup in dir.
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, BackupManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(buf, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// backupShard transfers files of a shard snapshot into dir, except the ones
+// of the last backup of the shard kept in dir, and removes files not in the
+// snapshot. It returns the number and bytes of files transferred.
+func backupShard(addr, id, dir string, sh *BackupShard, last *BackupShard) (int64, int64, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 0, 0, err
+	}
+	kept := make(map[controller.SnapshotFile]bool)
+	if last != nil {
+		for _, f := range last.Files {
+			kept[f] = true
+		}
+	}
+
+	var n, bytes int64
+	names := make(map[string]bool, len(sh.Files))
+	for _, f := range sh.Files {
+		names[f.Name] = true
+		path := filepath.Join(dir, f.Name)
+		if fi, err := os.Stat(path); err == nil && kept[f] && fi.Size() == f.Size {
+			continue
+		}
+		if err := fetchSnapshotFile(addr, id, sh.ShardID, f, path); err != nil {
+			return n, bytes, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		n++
+		bytes += f.Size
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return n, bytes, err
+	}
+	for _, fi := range infos {
+		if !names[fi.Name()] {
+			if err := os.RemoveAll(filepath.Join(dir, fi.Name())); err != nil {
+				return n, bytes, err
+			}
+		}
+	}
+	return n, bytes, nil
+}
+
+// fetchSnapshotFile transfers a file of a shard snapshot from its node to
+// path, checking its size and checksum.
+func fetchSnapshotFile(addr, id string, shardID uint64, f controller.SnapshotFile, path string) error {
+	conn, err := Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := &controller.SnapshotFileRequest{ID: id, ShardID: shardID, Name: f.Name}
+	buf, _ := json.Marshal(req)
+	if err := coordinator.WriteTLV(conn, byte(controller.RequestSnapshotFile), buf); err != nil {
+		return err
+	}
+	var resp controller.SnapshotFileResponse
+	if err := DecodeTLV(conn, byte(controller.ResponseSnapshotFile), &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+	if resp.Size != f.Size {
+		return fmt.Errorf("size %d of snapshot, expected %d", resp.Size, f.Size)
+	}
+
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	h := crc32.NewIEEE()
+	if _, err := io.CopyN(io.MultiWriter(out, h), conn, resp.Size); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if h.Sum32() != f.CRC {
+		return fmt.Errorf("checksum %d, expected %d", h.Sum32(), f.CRC)
+	}
+	return os.Rename(tmp, path)
+}
+
+// removeStaleShards removes shards of dir not in manifest, e.g. expired.
+func removeStaleShards(dir string, manifest *BackupManifest) error {
+	shards := make(map[string]bool, len(manifest.Shards))
+	for _, sh := range manifest.Shards {
+		shards[strconv.FormatUint(sh.ShardID, 10)] = true
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		if shards[fi.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, buf []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Restore restores a database backed up in dir as database newDB, which must
+// not exist, or a single shard of it into database newDB existing if shardID
+// is not 0. Shard groups missing are created by current placement, the rest
+// of the cluster is not touched.
+func Restore(addr, dir, database, newDB string, shardID uint64) error {
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return err
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, BackupMetaFile))
+	if err != nil {
+		return err
+	}
+	var data imeta.Data
+	if err := data.UnmarshalBinary(buf); err != nil {
+		return err
+	}
+	dbi := data.Database(database)
+	if dbi == nil {
+		return fmt.Errorf("database %s not in backup", database)
+	}
+	backedUp := make(map[uint64]*BackupShard, len(manifest.Shards))
+	for i := range manifest.Shards {
+		backedUp[manifest.Shards[i].ShardID] = &manifest.Shards[i]
+	}
+
+	req := &controller.RestorePlanRequest{
+		Database:       newDB,
+		CreateDatabase: shardID == 0,
+	}
+	for _, rpi := range dbi.RetentionPolicies {
+		req.RetentionPolicies = append(req.RetentionPolicies, controller.RestoreRetentionPolicy{
+			Name:               rpi.Name,
+			Duration:           int64(rpi.Duration),
+			ShardGroupDuration: int64(rpi.ShardGroupDuration),
+			ReplicaN:           rpi.ReplicaN,
+			Default:            rpi.Name == dbi.DefaultRetentionPolicy,
+		})
+		for _, sgi := range rpi.ShardGroups {
+			if sgi.Deleted() {
+				continue
+			}
+			for i, sh := range sgi.Shards {
+				if shardID != 0 && sh.ID != shardID {
+					continue
+				}
+				if backedUp[sh.ID] == nil {
+					return fmt.Errorf("shard %d not in backup", sh.ID)
+				}
+				req.Shards = append(req.Shards, controller.RestoreShard{
+					ShardID: sh.ID,
+					Rp:      rpi.Name,
+					Time:    sgi.StartTime.UnixNano(),
+					Index:   i,
+				})
+			}
+		}
+	}
+	if shardID != 0 && len(req.Shards) == 0 {
+		return fmt.Errorf("shard %d of database %s not in backup", shardID, database)
+	}
+
+	var resp controller.RestorePlanResponse
+	respTyp := byte(controller.ResponseRestorePlan)
+	reqTyp := byte(controller.RequestRestorePlan)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, req, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	for _, t := range resp.Targets {
+		sh := backedUp[t.ShardID]
+		for _, o := range t.Owners {
+			if err := restoreShardTo(o.TCPHost, t.Target, filepath.Join(dir, backupShardsDir, strconv.FormatUint(t.ShardID, 10)), sh.Files); err != nil {
+				return fmt.Errorf("shard %d into shard %d on node %d: %v", t.ShardID, t.Target, o.NodeID, err)
+			}
+		}
+		fmt.Print("shard ", t.ShardID, " -> ", t.Target, "\t", len(t.Owners), " owners\t", len(sh.Files), " files\n")
+	}
+	fmt.Println()
+	color.Green("Restored %d shards into database %s\n", len(resp.Targets), newDB)
+	return nil
+}
+
+// restoreShardTo sends files of a shard backed up in dir to a node owning
+// shard target.
+func restoreShardTo(addr string, target uint64, dir string, files []controller.SnapshotFile) error {
+	conn, err := Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := &controller.RestoreShardRequest{ShardID: target, Files: files}
+	buf, _ := json.Marshal(req)
+	if err := coordinator.WriteTLV(conn, byte(controller.RequestRestoreShard), buf); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := sendFile(conn, filepath.Join(dir, f.Name), f.Size); err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+
+	var resp controller.RestoreShardResponse
+	if err := DecodeTLV(conn, byte(controller.ResponseRestoreShard), &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+	return nil
+}
+
+func sendFile(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(w, f, size)
+	return err
+}
@@ -0,0 +1,174 @@
+package action
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/services/controller"
+)
+
+// snapshotNode serves files of a shard snapshot, counting files requested.
+type snapshotNode struct {
+	ln net.Listener
+
+	mu        sync.Mutex
+	files     map[string]string
+	requested []string
+}
+
+func newSnapshotNode(t *testing.T, files map[string]string) *snapshotNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	n := &snapshotNode{ln: ln, files: files}
+	go n.serve()
+	return n
+}
+
+func (n *snapshotNode) serve() {
+	for {
+		conn, err := n.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			// the multiplexing header and the request type
+			var header [2]byte
+			if _, err := io.ReadFull(conn, header[:]); err != nil {
+				return
+			}
+			buf, err := coordinator.ReadLV(conn, time.Second)
+			if err != nil {
+				return
+			}
+			var req controller.SnapshotFileRequest
+			json.Unmarshal(buf, &req)
+
+			n.mu.Lock()
+			n.requested = append(n.requested, req.Name)
+			content, ok := n.files[req.Name]
+			n.mu.Unlock()
+			var resp controller.SnapshotFileResponse
+			if !ok {
+				resp.Code, resp.Msg = 1, "not found"
+			}
+			resp.Size = int64(len(content))
+			buf, _ = json.Marshal(&resp)
+			coordinator.WriteTLV(conn, byte(controller.ResponseSnapshotFile), buf)
+			conn.Write([]byte(content))
+		}()
+	}
+}
+
+// fetched returns files requested since last asked.
+func (n *snapshotNode) fetched() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	names := n.requested
+	n.requested = nil
+	sort.Strings(names)
+	return names
+}
+
+func (n *snapshotNode) snapshot(names ...string) *BackupShard {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sh := &BackupShard{ShardID: 1, NodeID: 1}
+	for _, name := range names {
+		content := n.files[name]
+		sh.Files = append(sh.Files, controller.SnapshotFile{Name: name, Size: int64(len(content)), CRC: crc32.ChecksumIEEE([]byte(content))})
+	}
+	return sh
+}
+
+func dirFiles(t *testing.T, dir string) map[string]string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", dir, err)
+	}
+	files := make(map[string]string, len(infos))
+	for _, fi := range infos {
+		buf, _ := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		files[fi.Name()] = string(buf)
+	}
+	return files
+}
+
+func TestBackupShard_Incremental(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	node := newSnapshotNode(t, map[string]string{"1.tsm": "tsm 1", "2.tsm": "tsm 2", "fields.idx": "fields"})
+	defer node.ln.Close()
+	addr := node.ln.Addr().String()
+	shardDir := filepath.Join(dir, "1")
+
+	// the first backup transfers all files
+	full := node.snapshot("1.tsm", "2.tsm", "fields.idx")
+	n, size, err := backupShard(addr, "a", shardDir, full, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, int64(16), size)
+	assert.Equal(t, []string{"1.tsm", "2.tsm", "fields.idx"}, node.fetched())
+	assert.Equal(t, node.files, dirFiles(t, shardDir))
+
+	// files compacted away are removed, only files new or changed are
+	// transferred
+	node.files["3.tsm"] = "tsm 1 and 2"
+	node.files["fields.idx"] = "fields 2"
+	incremental := node.snapshot("3.tsm", "fields.idx")
+	n, _, err = backupShard(addr, "b", shardDir, incremental, full)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, []string{"3.tsm", "fields.idx"}, node.fetched())
+	assert.Equal(t, map[string]string{"3.tsm": "tsm 1 and 2", "fields.idx": "fields 2"}, dirFiles(t, shardDir))
+
+	// nothing is transferred unless changed, a file lost is transferred again
+	n, _, err = backupShard(addr, "c", shardDir, incremental, incremental)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	os.Remove(filepath.Join(shardDir, "3.tsm"))
+	n, _, err = backupShard(addr, "c", shardDir, incremental, incremental)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, []string{"3.tsm"}, node.fetched())
+
+	// files failing the checksum are not kept
+	node.files["fields.idx"] = "fields 3"
+	corrupted := node.snapshot("3.tsm", "fields.idx")
+	corrupted.Files[1].CRC++
+	_, _, err = backupShard(addr, "d", shardDir, corrupted, incremental)
+	assert.Error(t, err)
+	assert.Equal(t, map[string]string{"3.tsm": "tsm 1 and 2", "fields.idx": "fields 2"}, dirFiles(t, shardDir))
+}
+
+func TestRemoveStaleShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, id := range []string{"1", "2", "3"} {
+		os.MkdirAll(filepath.Join(dir, id), 0700)
+	}
+
+	manifest := &BackupManifest{Shards: []BackupShard{{ShardID: 1}, {ShardID: 3}}}
+	assert.NoError(t, removeStaleShards(dir, manifest))
+	assert.Equal(t, map[string]string{"1": "", "3": ""}, dirFiles(t, dir))
+}
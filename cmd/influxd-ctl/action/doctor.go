@@ -0,0 +1,159 @@
+package action
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	"github.com/angopher/chronus/services/controller"
+	"github.com/fatih/color"
+)
+
+const (
+	// metaMaxLag is how many entries a meta node may be behind the commit
+	metaMaxLag = 1000
+	// metaMaxSnapshotLag is how many entries a meta node may have applied
+	// since its last snapshot, replayed on its restart
+	metaMaxSnapshotLag = 100000
+)
+
+// Doctor checks the cluster through data node addr, and meta servers through
+// metadAddr if given, printing findings from the most severe.
+func Doctor(addr, metadAddr string) error {
+	var resp controller.DoctorResponse
+	respTyp := byte(controller.ResponseDoctor)
+	reqTyp := byte(controller.RequestDoctor)
+	if err := RequestAndWaitResp(addr, reqTyp, respTyp, &controller.DoctorRequest{}, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+
+	findings := resp.Findings
+	if metadAddr != "" {
+		findings = append(findings, metaFindings(metadAddr)...)
+	} else {
+		findings = append(findings, controller.Finding{
+			Severity: controller.SeverityInfo,
+			Check:    controller.CheckMetaQuorum,
+			Message:  "meta servers are not checked, give --metad",
+		})
+	}
+	controller.SortFindings(findings)
+
+	fmt.Printf("Checked %d data nodes and %d shards\n\n", resp.Nodes, resp.Shards)
+	printed := 0
+	for _, f := range findings {
+		if f.Severity == controller.SeverityInfo {
+			continue
+		}
+		printFinding(f)
+		printed++
+	}
+	if printed == 0 {
+		color.Green("No problems found\n")
+	}
+	for _, f := range findings {
+		if f.Severity == controller.SeverityInfo {
+			printFinding(f)
+		}
+	}
+	return nil
+}
+
+func printFinding(f controller.Finding) {
+	switch f.Severity {
+	case controller.SeverityCritical:
+		color.Set(color.Bold)
+		fmt.Print(color.RedString("[%s]", f.Severity))
+		color.Unset()
+	case controller.SeverityWarning:
+		fmt.Print(color.YellowString("[%s]", f.Severity))
+	default:
+		fmt.Print("[", f.Severity, "]")
+	}
+	fmt.Print(" ", f.Check, ": ", f.Message, "\n")
+	for _, r := range f.Remediation {
+		fmt.Print("    ", r, "\n")
+	}
+}
+
+// metaFindings checks quorum, replication and snapshots of meta servers as
+// the leader reports them.
+func metaFindings(metadAddr string) []controller.Finding {
+	failed := func(err error) []controller.Finding {
+		return []controller.Finding{{
+			Severity:    controller.SeverityCritical,
+			Check:       controller.CheckMetaQuorum,
+			Message:     fmt.Sprintf("status of meta servers unavailable from %s: %s", metadAddr, err),
+			Remediation: []string{fmt.Sprintf("metad-ctl status -metad %s", metadAddr)},
+		}}
+	}
+
+	var status raftmeta.StatusClusterResp
+	data, err := util.GetRequest(fmt.Sprint("http://", metadAddr, "/status_cluster"))
+	if err != nil {
+		return failed(err)
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return failed(err)
+	}
+	if status.RetCode != 0 {
+		return failed(errors.New(status.RetMsg))
+	}
+
+	var findings []controller.Finding
+	if status.Leader == 0 {
+		findings = append(findings, controller.Finding{
+			Severity:    controller.SeverityCritical,
+			Check:       controller.CheckMetaQuorum,
+			Message:     "meta servers have no leader, meta data can't be changed",
+			Remediation: []string{fmt.Sprintf("metad-ctl status -metad %s", metadAddr)},
+		})
+	}
+
+	reachable := 0
+	for _, n := range status.Nodes {
+		if n.Role == "Unreachable" {
+			findings = append(findings, controller.Finding{
+				Severity:    controller.SeverityWarning,
+				Check:       controller.CheckMetaQuorum,
+				Message:     fmt.Sprintf("meta server %d (%s) is unreachable", n.ID, n.Addr),
+				Remediation: []string{fmt.Sprintf("check the metad process and the network of %s", n.Addr)},
+			})
+			continue
+		}
+		reachable++
+		if status.Commit > n.Match+metaMaxLag {
+			findings = append(findings, controller.Finding{
+				Severity:    controller.SeverityWarning,
+				Check:       controller.CheckMetaReplication,
+				Message:     fmt.Sprintf("meta server %d (%s) is %d entries behind the commit", n.ID, n.Addr, status.Commit-n.Match),
+				Remediation: []string{fmt.Sprintf("metad-ctl status -metad %s  # progress of the server", metadAddr)},
+			})
+		}
+		if n.Match > n.SnapshotIndex+metaMaxSnapshotLag {
+			findings = append(findings, controller.Finding{
+				Severity: controller.SeverityWarning,
+				Check:    controller.CheckMetaSnapshot,
+				Message: fmt.Sprintf("meta server %d (%s) applied %d entries since its last snapshot at index %d",
+					n.ID, n.Addr, n.Match-n.SnapshotIndex, n.SnapshotIndex),
+				Remediation: []string{"check snapshot errors in the log of the meta leader"},
+			})
+		}
+	}
+	if quorum := len(status.Nodes)/2 + 1; reachable < quorum {
+		findings = append(findings, controller.Finding{
+			Severity: controller.SeverityCritical,
+			Check:    controller.CheckMetaQuorum,
+			Message:  fmt.Sprintf("only %d of %d meta servers are reachable, %d needed for quorum", reachable, len(status.Nodes), quorum),
+			Remediation: []string{
+				"bring back the meta servers unreachable",
+			},
+		})
+	}
+	return findings
+}
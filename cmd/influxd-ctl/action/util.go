@@ -1,6 +1,9 @@
 package action
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 const (
 	TIME_FORMAT = "2006-01-02 15:04:05"
@@ -10,3 +13,16 @@ func formatTimeStamp(millis int64) string {
 	t := time.Unix(millis/1000, (millis%1000)*1e6)
 	return t.Local().Format(TIME_FORMAT)
 }
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprint(n, " B")
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
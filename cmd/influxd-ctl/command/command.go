@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/angopher/chronus/cmd/influxd-ctl/action"
 	"github.com/urfave/cli/v2"
@@ -17,6 +18,23 @@ var (
 	DataNodeAddress string
 )
 
+// dryRunFlag prints the plan of an operation without executing it.
+func dryRunFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print the plan without changing anything",
+	}
+}
+
+// tokenFlag confirms a destructive operation with the token printed along
+// with its plan.
+func tokenFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "token",
+		Usage: "token confirming the plan printed by the previous run",
+	}
+}
+
 func NodeCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "node",
@@ -63,11 +81,67 @@ func NodeCommand() *cli.Command {
 				Name:      "remove",
 				ArgsUsage: "remove <ip:port>",
 				Usage:     "remove specified node from cluster",
+				Description: fmt.Sprint(
+					"Removes a node from cluster.\n",
+					"The first run prints what is going to be removed with a token,\n",
+					"run again with --token to confirm, or --dry-run to print the plan only.",
+				),
+				Flags: []cli.Flag{tokenFlag(), dryRunFlag()},
 				Action: func(ctx *cli.Context) error {
 					if ctx.Args().Len() < 1 {
 						return errors.New("Please specify node addr to be removed from cluster")
 					}
-					if err := action.RemoveDataNode(DataNodeAddress, ctx.Args().Get(0)); err != nil {
+					if err := action.RemoveDataNode(DataNodeAddress, ctx.Args().Get(0), ctx.String("token"), ctx.Bool("dry-run")); err != nil {
+						fmt.Println(err)
+					}
+
+					return nil
+				},
+			}, {
+				Name:      "drain-status",
+				ArgsUsage: "drain-status <ip:port>",
+				Usage:     "show progress of copying shards away from specified node",
+				Description: fmt.Sprint(
+					"Lists shards of the node not replicated enough on other nodes yet,\n",
+					"with progress, rate and ETA of copies running and errors of copies failed.",
+				),
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify node addr being drained")
+					}
+					if err := action.DrainStatus(DataNodeAddress, ctx.Args().Get(0)); err != nil {
+						fmt.Println(err)
+					}
+
+					return nil
+				},
+			}, {
+				Name:      "reads",
+				ArgsUsage: "reads [drain|resume]",
+				Usage:     "drain or resume reads of other nodes served by the node of -s",
+				Description: fmt.Sprint(
+					"Drained, the node rejects queries of other nodes, which read shards from other owners,\n",
+					"reads in flight are finished and writes are served as usual.\n",
+					"Without operation, shows whether reads are drained and how many are in flight.\n",
+					"Reads are served again on restart.",
+				),
+				Action: func(ctx *cli.Context) error {
+					if err := action.DrainReads(DataNodeAddress, ctx.Args().Get(0)); err != nil {
+						fmt.Println(err)
+					}
+
+					return nil
+				},
+			}, {
+				Name:  "catch-up-status",
+				Usage: "show stale shards of the node of -s being caught up",
+				Description: fmt.Sprint(
+					"Lists shards of the node whose hinted data was purged before delivery,\n",
+					"excluded from reads and copied again from healthy owners,\n",
+					"with the state, source and error of the last attempt.",
+				),
+				Action: func(ctx *cli.Context) error {
+					if err := action.CatchUpStatus(DataNodeAddress); err != nil {
 						fmt.Println(err)
 					}
 
@@ -137,6 +211,29 @@ func ShardCommand() *cli.Command {
 					}
 					return nil
 				},
+			}, {
+				Name:      "verify",
+				ArgsUsage: "verify <shard-id>",
+				Usage:     "compare replicas of specified shard on its owners",
+				Description: fmt.Sprint(
+					"Compares digests of a shard taken by all its owners and prints series diverging,\n",
+					"missing on some owners, with different points or with different blocks.\n",
+					"Exits with code 1 if replicas diverge. Shards written recently can not be verified.",
+				),
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify shard id")
+					}
+					diverged, err := action.VerifyShard(DataNodeAddress, ctx.Args().First())
+					if err != nil {
+						fmt.Println(err)
+						return nil
+					}
+					if diverged {
+						return cli.Exit("Replicas diverge", 1)
+					}
+					return nil
+				},
 			}, {
 				Name:  "status",
 				Usage: "show progress of copy-shard tasks",
@@ -152,15 +249,21 @@ func ShardCommand() *cli.Command {
 					return nil
 				},
 			}, {
-				Name:        "copy",
-				Usage:       "copy a shard to current node",
-				ArgsUsage:   "copy <source-tcp-addr> <shard-id>",
-				Description: "Copy a shard from a source data node to a current data node which is specified through -s",
+				Name:      "copy",
+				Usage:     "copy a shard to current node",
+				ArgsUsage: "copy <source-tcp-addr> <shard-id>",
+				Description: fmt.Sprint(
+					"Copy a shard from a source data node to a current data node which is specified through -s.\n",
+					"With --dry-run the copy is checked and its size and estimated transfer time are printed.",
+				),
+				Flags: []cli.Flag{dryRunFlag()},
 				Action: func(ctx *cli.Context) error {
 					if ctx.Args().Len() < 2 {
 						return errors.New("Please specify source node and shard")
 					}
-					action.CopyShard(ctx.Args().Get(0), DataNodeAddress, ctx.Args().Get(1))
+					if err := action.CopyShard(ctx.Args().Get(0), DataNodeAddress, ctx.Args().Get(1), ctx.Bool("dry-run")); err != nil {
+						fmt.Println(err)
+					}
 					return nil
 				},
 			}, {
@@ -170,13 +273,16 @@ func ShardCommand() *cli.Command {
 				Description: fmt.Sprint(
 					"Removes a shard from current data node.\n",
 					"Removing a shard is an irrecoverable, destructive action;\n",
-					"Please be cautious with this command.",
+					"Please be cautious with this command.\n",
+					"The first run prints what is going to be removed with a token,\n",
+					"run again with --token to confirm, or --dry-run to print the plan only.",
 				),
+				Flags: []cli.Flag{tokenFlag(), dryRunFlag()},
 				Action: func(ctx *cli.Context) error {
 					if ctx.Args().Len() < 1 {
 						return errors.New("Please specify shard")
 					}
-					if err := action.RemoveShard(DataNodeAddress, ctx.Args().First()); err != nil {
+					if err := action.RemoveShard(DataNodeAddress, ctx.Args().First(), ctx.String("token"), ctx.Bool("dry-run")); err != nil {
 						fmt.Println(err)
 					}
 					return nil
@@ -214,7 +320,298 @@ func ShardCommand() *cli.Command {
 					}
 					return nil
 				},
+			}, {
+				Name:        "check",
+				Usage:       "check consistency of shards between meta and disk",
+				Description: "List shards owned by current node but missing on disk, shards on disk but not owned in meta, and shards quarantined by safe mode.",
+				Action: func(ctx *cli.Context) error {
+					if err := action.CheckConsistency(DataNodeAddress); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			}, {
+				Name:      "repair",
+				Usage:     "repair an inconsistent shard",
+				ArgsUsage: "repair <shard-id> <copy|delete> [source-tcp-addr]",
+				Description: fmt.Sprint(
+					"Repairs a shard reported by check on current data node.\n",
+					"copy fetches a missing shard from source or another owner,\n",
+					"delete removes an orphan shard which is irrecoverable.",
+				),
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 2 {
+						return errors.New("Please specify shard and action")
+					}
+					if err := action.RepairShard(DataNodeAddress, ctx.Args().Get(0), ctx.Args().Get(1), ctx.Args().Get(2)); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
 			},
 		},
 	}
 }
+
+func BackupCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "backup",
+		Usage: "backup related operations",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "snapshot",
+				ArgsUsage: "snapshot <manifest.json>",
+				Usage:     "take a consistent snapshot of the cluster",
+				Description: fmt.Sprint(
+					"Freezes creation of shard groups, snapshots meta and shards of all nodes at\n",
+					"the same meta index and writes the manifest listing files of shards with checksums.\n",
+					"Snapshots are kept on nodes until released or controller.snapshot_ttl passes.",
+				),
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify manifest file")
+					}
+					if err := action.Snapshot(DataNodeAddress, ctx.Args().First()); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			}, {
+				Name:      "create",
+				ArgsUsage: "create <dir>",
+				Usage:     "back up a consistent snapshot of the cluster into a directory",
+				Description: fmt.Sprint(
+					"Takes a snapshot of the cluster, copies meta and files of every shard from one of\n",
+					"its owners into the directory with a manifest, and releases the snapshot.\n",
+					"With --incremental, shards not modified since the backup in the directory by their\n",
+					"owner of the backup are kept, and only files not backed up are copied of the others.",
+				),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "incremental",
+						Usage: "copy shards modified since the backup in the directory only",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify backup directory")
+					}
+					if err := action.Backup(DataNodeAddress, ctx.Args().First(), ctx.Bool("incremental")); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			}, {
+				Name:      "restore",
+				ArgsUsage: "restore <dir>",
+				Usage:     "restore a database or a single shard from a backup directory",
+				Description: fmt.Sprint(
+					"Restores database --db backed up in the directory as database --newdb, --db by default,\n",
+					"which must not exist. With --shard, restores the shard only into the shard group of\n",
+					"its time in the database existing. Shard groups missing are created and owned by\n",
+					"current placement, data of shards is imported into every owner.",
+				),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "db",
+						Required: true,
+						Usage:    "database backed up",
+					},
+					&cli.StringFlag{
+						Name:  "newdb",
+						Usage: "database to restore into",
+					},
+					&cli.Uint64Flag{
+						Name:  "shard",
+						Usage: "shard backed up to restore only",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify backup directory")
+					}
+					newDB := ctx.String("newdb")
+					if newDB == "" {
+						newDB = ctx.String("db")
+					}
+					if err := action.Restore(DataNodeAddress, ctx.Args().First(), ctx.String("db"), newDB, ctx.Uint64("shard")); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			}, {
+				Name:      "release",
+				ArgsUsage: "release <snapshot-id>",
+				Usage:     "remove a snapshot from all nodes",
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify snapshot id")
+					}
+					if err := action.ReleaseSnapshot(DataNodeAddress, ctx.Args().First()); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func DatabaseCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "database",
+		Usage: "database related operations",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "drop",
+				ArgsUsage: "drop <database>",
+				Usage:     "drop a database with its data on all nodes",
+				Description: fmt.Sprint(
+					"Drops a database and deletes its shards on all nodes.\n",
+					"The first run prints what is going to be removed with a token,\n",
+					"run again with --token to confirm, or --dry-run to print the plan only.",
+				),
+				Flags: []cli.Flag{tokenFlag(), dryRunFlag()},
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify database")
+					}
+					if err := action.DropDatabase(DataNodeAddress, ctx.Args().First(), ctx.String("token"), ctx.Bool("dry-run")); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func HintedHandoffCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "hh",
+		Usage: "hinted handoff related operations",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "purge",
+				ArgsUsage: "purge <node-id>",
+				Usage:     "drop hinted data queued on the node for another node",
+				Description: fmt.Sprint(
+					"Drops hinted data queued on the node of -s for the node given, of shard --shard,\n",
+					"e.g. of a shard or database decommissioned, or queued before --before (RFC3339) without\n",
+					"waiting for max-age. The first run prints the plan with a token, run again with\n",
+					"--token to confirm, or --dry-run to print the plan only.",
+				),
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name:  "shard",
+						Usage: "shard whose hinted data is dropped",
+					},
+					&cli.StringFlag{
+						Name:  "before",
+						Usage: "drop hinted data queued before the time, like 2006-01-02T15:04:05Z",
+					},
+					tokenFlag(),
+					dryRunFlag(),
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify node id")
+					}
+					nodeID, err := strconv.ParseUint(ctx.Args().First(), 10, 64)
+					if err != nil {
+						return fmt.Errorf("invalid node id: %s", ctx.Args().First())
+					}
+					shardID := ctx.Uint64("shard")
+					var before time.Time
+					if s := ctx.String("before"); s != "" {
+						// not relative, the plan confirmed must be the same
+						if before, err = time.Parse(time.RFC3339, s); err != nil {
+							return fmt.Errorf("invalid time: %s", s)
+						}
+					}
+					if (shardID == 0) == before.IsZero() {
+						return errors.New("Please specify either --shard or --before")
+					}
+					if err := action.PurgeHintedHandoff(DataNodeAddress, nodeID, shardID, before, ctx.String("token"), ctx.Bool("dry-run")); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "transfer",
+				ArgsUsage: "transfer <ip:port>",
+				Usage:     "move hinted data queued on the node to the queues of another node",
+				Description: fmt.Sprint(
+					"Moves hinted data queued on the node of -s, for the node --node or for all nodes, to\n",
+					"the queues of the node of controller address ip:port, e.g. before the node of -s is\n",
+					"removed. Blocks are dropped from the node of -s once queued on the other one, run\n",
+					"again to resume a transfer interrupted.",
+				),
+				Flags: []cli.Flag{
+					&cli.Uint64Flag{
+						Name:  "node",
+						Usage: "node whose hinted data is moved, all if not set",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 1 {
+						return errors.New("Please specify address of the node transferred to")
+					}
+					if err := action.TransferHintedHandoff(DataNodeAddress, ctx.Uint64("node"), ctx.Args().First()); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "replay",
+				ArgsUsage: "replay <node-id> <dir>",
+				Usage:     "move hinted data of a queue directory to the queue of the node for another node",
+				Description: fmt.Sprint(
+					"Moves hinted data of the queue in directory dir on the node of -s, e.g. the queue\n",
+					"directory of the node given copied from a coordinator removed, to the queue for the\n",
+					"node. Blocks are dropped from dir once queued, run again to resume a replay interrupted.",
+				),
+				Action: func(ctx *cli.Context) error {
+					if ctx.Args().Len() < 2 {
+						return errors.New("Please specify node id and directory")
+					}
+					nodeID, err := strconv.ParseUint(ctx.Args().First(), 10, 64)
+					if err != nil {
+						return fmt.Errorf("invalid node id: %s", ctx.Args().First())
+					}
+					if err := action.ReplayHintedHandoff(DataNodeAddress, nodeID, ctx.Args().Get(1)); err != nil {
+						fmt.Println(err)
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func DoctorCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "doctor",
+		Usage: "check the health of the cluster",
+		Description: fmt.Sprint(
+			"Checks liveness, clock skew, disk headroom and hinted handoff queues of all data nodes\n",
+			"and replication of shards through the node of -s, and quorum, replication and snapshots\n",
+			"of meta servers through --metad, printing findings from the most severe with commands\n",
+			"which may remedy them.",
+		),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "metad",
+				Usage: "meta server address, ip:port, meta servers are not checked if empty",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if err := action.Doctor(DataNodeAddress, ctx.String("metad")); err != nil {
+				fmt.Println(err)
+			}
+			return nil
+		},
+	}
+}
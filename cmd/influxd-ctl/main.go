@@ -19,11 +19,18 @@ func main() {
 		}
 		color.Red(err.Error())
 		fmt.Println()
+		if exitErr, ok := err.(cli.ExitCoder); ok {
+			os.Exit(exitErr.ExitCode())
+		}
 	}
 
 	app.Commands = []*cli.Command{
 		command.NodeCommand(),
 		command.ShardCommand(),
+		command.DatabaseCommand(),
+		command.BackupCommand(),
+		command.HintedHandoffCommand(),
+		command.DoctorCommand(),
 	}
 	app.Flags = []cli.Flag{
 		&cli.StringFlag{
@@ -0,0 +1,302 @@
+// Package demo is the demo subcommand for the influxd command, running a meta
+// node and several data nodes of a cluster in a single process.
+package demo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/angopher/chronus/cmd/influxd/run"
+	"github.com/angopher/chronus/logging"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb/services/meta"
+	"go.uber.org/zap"
+)
+
+// Options represents the command line options of the demo cluster.
+type Options struct {
+	Nodes    int
+	Replica  int
+	Dir      string
+	Host     string
+	MetaPort int
+	HTTPPort int
+	TCPPort  int
+	LogLevel string
+}
+
+// Command represents the command executed by "influxd demo".
+type Command struct {
+	Version string
+	Branch  string
+	Commit  string
+
+	Closed chan struct{}
+
+	Stdout io.Writer
+	Stderr io.Writer
+	Logger *zap.Logger
+
+	Servers []*run.Server
+
+	metaNode *raftmeta.RaftNode
+	metaCli  *imeta.Client
+	metaSrv  *http.Server
+}
+
+// NewCommand return a new instance of Command.
+func NewCommand() *Command {
+	return &Command{
+		Closed: make(chan struct{}),
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Logger: zap.NewNop(),
+	}
+}
+
+// Run parses the flags from args and starts the cluster.
+func (cmd *Command) Run(args ...string) error {
+	options, err := cmd.ParseFlags(args...)
+	if err != nil {
+		return err
+	}
+
+	cmd.Logger, err = logging.InitialLogging(&logging.Config{
+		Format: "console",
+		Level:  options.LogLevel,
+	})
+	if err != nil {
+		return fmt.Errorf("%s. Initialize logging failed", err)
+	}
+	cmd.Logger.Info("InfluxDB demo cluster starting",
+		zap.String("version", cmd.Version),
+		zap.String("branch", cmd.Branch),
+		zap.String("commit", cmd.Commit),
+		zap.Int("nodes", options.Nodes),
+		zap.String("dir", options.Dir))
+
+	metaAddr := net.JoinHostPort(options.Host, strconv.Itoa(options.MetaPort))
+	if err := cmd.openMeta(options, metaAddr); err != nil {
+		cmd.Close()
+		return fmt.Errorf("open meta: %s", err)
+	}
+	if err := cmd.setDefaultRetentionPolicy(metaAddr, options.Replica); err != nil {
+		cmd.Close()
+		return fmt.Errorf("set default retention policy: %s", err)
+	}
+
+	buildInfo := &run.BuildInfo{
+		Version: cmd.Version,
+		Commit:  cmd.Commit,
+		Branch:  cmd.Branch,
+	}
+	for i := 0; i < options.Nodes; i++ {
+		config := cmd.dataConfig(options, metaAddr, i)
+		name := fmt.Sprintf("data-%d", i+1)
+		s, err := run.NewServer(config, buildInfo, cmd.Logger.With(zap.String("node", name)))
+		if err != nil {
+			cmd.Close()
+			return fmt.Errorf("create server %s: %s", name, err)
+		}
+		if err := s.Open(); err != nil {
+			cmd.Close()
+			return fmt.Errorf("open server %s: %s", name, err)
+		}
+		cmd.Servers = append(cmd.Servers, s)
+		cmd.Logger.Info("Data node started",
+			zap.String("node", name),
+			zap.Uint64("id", s.Node.ID),
+			zap.String("http", config.HTTPD.BindAddress),
+			zap.String("tcp", config.BindAddress))
+	}
+
+	fmt.Fprintf(cmd.Stdout, "Demo cluster of %d data nodes is running, meta on %s\n", options.Nodes, metaAddr)
+	for i := range cmd.Servers {
+		fmt.Fprintf(cmd.Stdout, "    data-%d: http://%s\n", i+1, net.JoinHostPort(options.Host, strconv.Itoa(options.HTTPPort+i)))
+	}
+	return nil
+}
+
+// openMeta starts the meta node, returning once it is the leader.
+func (cmd *Command) openMeta(options Options, addr string) error {
+	config := raftmeta.NewConfig()
+	config.MyAddr = addr
+	config.WalDir = filepath.Join(options.Dir, "meta")
+	// a single voter, no need to wait long for the election
+	config.ElectionTick = 10
+
+	logger := cmd.Logger.With(zap.String("node", "meta"))
+	cmd.metaCli = imeta.NewClient(&meta.Config{
+		RetentionAutoCreate: config.RetentionAutoCreate,
+		LoggingEnabled:      true,
+	})
+	cmd.metaCli.WithLogger(logger)
+	if err := cmd.metaCli.Open(); err != nil {
+		return err
+	}
+
+	cmd.metaNode = raftmeta.NewRaftNode(config, logger)
+	cmd.metaNode.MetaStore = cmd.metaCli
+	t := raftmeta.NewTransport()
+	t.WithLogger(logger)
+	cmd.metaNode.Transport = t
+	cmd.metaNode.InitAndStartNode()
+	go cmd.metaNode.Run()
+
+	linearRead := raftmeta.NewLinearizabler(cmd.metaNode)
+	go linearRead.ReadLoop()
+
+	service := raftmeta.NewMetaService(addr, cmd.metaCli, cmd.metaNode, linearRead)
+	service.InitRouter()
+	service.WithLogger(logger)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	cmd.metaSrv = &http.Server{}
+	go cmd.metaSrv.Serve(ln)
+
+	deadline := time.Now().Add(30 * time.Second)
+	for cmd.metaNode.Node.Status().Lead != config.RaftId {
+		if time.Now().After(deadline) {
+			return errors.New("meta node not elected")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+// setDefaultRetentionPolicy makes databases created replicated on replica
+// nodes.
+func (cmd *Command) setDefaultRetentionPolicy(addr string, replica int) error {
+	body, err := json.Marshal(&raftmeta.SetDefaultRetentionPolicyReq{
+		Template: &imeta.RetentionPolicyTemplate{Name: "autogen", ReplicaN: replica},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post("http://"+addr+raftmeta.SET_DEFAULT_RETENTION_POLICY_PATH, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var common raftmeta.CommonResp
+	if err := json.Unmarshal(data, &common); err != nil {
+		return err
+	}
+	if common.RetCode != 0 {
+		return errors.New(common.RetMsg)
+	}
+	return nil
+}
+
+// dataConfig returns the config of the i-th data node, keeping its files in
+// a directory of its own.
+func (cmd *Command) dataConfig(options Options, metaAddr string, i int) *run.Config {
+	dir := filepath.Join(options.Dir, fmt.Sprintf("data-%d", i+1))
+
+	c := run.NewConfig()
+	c.Meta.Dir = filepath.Join(dir, "meta")
+	c.Data.Dir = filepath.Join(dir, "data")
+	c.Data.WALDir = filepath.Join(dir, "wal")
+	c.HintedHandoff.Dir = filepath.Join(dir, "hh")
+	c.HTTPD.AccessLogPath = filepath.Join(dir, "access.log")
+	c.HTTPD.BindAddress = net.JoinHostPort(options.Host, strconv.Itoa(options.HTTPPort+i))
+	c.BindAddress = net.JoinHostPort(options.Host, strconv.Itoa(options.TCPPort+i))
+	c.Coordinator.MetaServices = []string{metaAddr}
+	c.ReportingDisabled = true
+	c.Logging.SuppressLogo = true
+	return c
+}
+
+// Close shuts down data nodes then the meta node.
+func (cmd *Command) Close() error {
+	defer close(cmd.Closed)
+	for _, s := range cmd.Servers {
+		s.Close()
+	}
+	if cmd.metaSrv != nil {
+		cmd.metaSrv.Close()
+	}
+	if cmd.metaNode != nil {
+		cmd.metaNode.Stop()
+	}
+	if cmd.metaCli != nil {
+		cmd.metaCli.Close()
+	}
+	return nil
+}
+
+// ParseFlags parses the command line flags from args and returns an options set.
+func (cmd *Command) ParseFlags(args ...string) (Options, error) {
+	var options Options
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.IntVar(&options.Nodes, "nodes", 3, "")
+	fs.IntVar(&options.Replica, "replica", 2, "")
+	fs.StringVar(&options.Dir, "dir", "./demo", "")
+	fs.StringVar(&options.Host, "host", "127.0.0.1", "")
+	fs.IntVar(&options.MetaPort, "meta-port", 2347, "")
+	fs.IntVar(&options.HTTPPort, "http-port", 8086, "")
+	fs.IntVar(&options.TCPPort, "tcp-port", 8186, "")
+	fs.StringVar(&options.LogLevel, "log-level", "warn", "")
+	fs.Usage = func() { fmt.Fprint(cmd.Stderr, usage) }
+	if err := fs.Parse(args); err != nil {
+		return Options{}, err
+	}
+
+	if options.Nodes < 1 {
+		return Options{}, errors.New("-nodes must be positive")
+	}
+	if options.Replica < 1 || options.Replica > options.Nodes {
+		return Options{}, fmt.Errorf("-replica must be between 1 and %d", options.Nodes)
+	}
+	if options.TCPPort < options.HTTPPort+options.Nodes && options.HTTPPort < options.TCPPort+options.Nodes {
+		return Options{}, errors.New("ports of -http-port and -tcp-port overlap")
+	}
+	return options, nil
+}
+
+const usage = `Runs a demo cluster of a meta node and several data nodes in one process.
+
+Usage: influxd demo [flags]
+
+    -nodes <n>
+            Number of data nodes, 3 by default.
+    -replica <n>
+            Replicas of retention policies created along with databases,
+            2 by default.
+    -dir <path>
+            Directory of all nodes, each one keeps its files in a directory
+            of its own. ./demo by default, reused when restarted.
+    -host <host>
+            Host all nodes listen on and are registered with in meta,
+            127.0.0.1 by default. Use 0.0.0.0 in containers.
+    -meta-port <port>
+            Port of the meta node, 2347 by default.
+    -http-port <port>
+            Port of the HTTP API of the first data node, next ones use the
+            following ports. 8086 by default.
+    -tcp-port <port>
+            Port of the cluster services of the first data node (influxd-ctl
+            talks to it), next ones use the following ports. 8186 by default.
+    -log-level <level>
+            Level of logs printed to stderr, warn by default.
+`
@@ -34,6 +34,7 @@ Usage: influxd [[command] [arguments]]
 The commands are:
 
     config               display the default configuration
+    demo                 run a demo cluster of several nodes in one process
     help                 display this help message
     run                  run node with existing configuration
     version              displays the InfluxDB version
@@ -12,8 +12,10 @@ import (
 	"time"
 
 	"github.com/angopher/chronus/cmd"
+	"github.com/angopher/chronus/cmd/influxd/demo"
 	"github.com/angopher/chronus/cmd/influxd/help"
 	"github.com/angopher/chronus/cmd/influxd/run"
+	"go.uber.org/zap"
 )
 
 // These variables are populated via the Go linker.
@@ -80,29 +82,21 @@ func (m *Main) Run(args ...string) error {
 			return fmt.Errorf("run: %s", err)
 		}
 
-		signalCh := make(chan os.Signal, 1)
-		signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
-		cmd.Logger.Info("Listening for signals")
-
-		// Block until one of the signals above is received
-		<-signalCh
-		cmd.Logger.Info("Signal received, initializing clean shutdown...")
-		go cmd.Close()
-
-		// Block again until another signal is received, a shutdown timeout elapses,
-		// or the Command is gracefully closed
-		cmd.Logger.Info("Waiting for clean shutdown...")
-		select {
-		case <-signalCh:
-			cmd.Logger.Info("Second signal received, initializing hard shutdown")
-		case <-time.After(time.Second * 30):
-			cmd.Logger.Info("Time limit reached, initializing hard shutdown")
-		case <-cmd.Closed:
-			cmd.Logger.Info("Server shutdown completed")
-		}
+		waitForShutdown(cmd.Logger, cmd.Close, cmd.Closed)
 
 		// goodbye.
 
+	case "demo":
+		cmd := demo.NewCommand()
+		cmd.Version = version
+		cmd.Commit = commit
+		cmd.Branch = branch
+
+		if err := cmd.Run(args...); err != nil {
+			return fmt.Errorf("demo: %s", err)
+		}
+		waitForShutdown(cmd.Logger, cmd.Close, cmd.Closed)
+
 	case "config":
 		if err := run.NewPrintConfigCommand().Run(args...); err != nil {
 			return fmt.Errorf("config: %s", err)
@@ -122,6 +116,31 @@ func (m *Main) Run(args ...string) error {
 	return nil
 }
 
+// waitForShutdown blocks until a signal is received, then closes by closeFn
+// and waits for closed, another signal or a shutdown timeout.
+func waitForShutdown(logger *zap.Logger, closeFn func() error, closed <-chan struct{}) {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	logger.Info("Listening for signals")
+
+	// Block until one of the signals above is received
+	<-signalCh
+	logger.Info("Signal received, initializing clean shutdown...")
+	go closeFn()
+
+	// Block again until another signal is received, a shutdown timeout elapses,
+	// or the Command is gracefully closed
+	logger.Info("Waiting for clean shutdown...")
+	select {
+	case <-signalCh:
+		logger.Info("Second signal received, initializing hard shutdown")
+	case <-time.After(time.Second * 30):
+		logger.Info("Time limit reached, initializing hard shutdown")
+	case <-closed:
+		logger.Info("Server shutdown completed")
+	}
+}
+
 // VersionCommand represents the command executed by "influxd version".
 type VersionCommand struct {
 	Stdout io.Writer
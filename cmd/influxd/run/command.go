@@ -196,7 +196,7 @@ func (cmd *Command) ParseFlags(args ...string) (Options, error) {
 	fs.StringVar(&options.CPUProfile, "cpuprofile", "", "")
 	fs.StringVar(&options.MemProfile, "memprofile", "", "")
 	fs.StringVar(&options.LogDir, "logdir", "", "Log to specified directory")
-	fs.Usage = func() { fmt.Fprintln(cmd.Stderr, usage) }
+	fs.Usage = func() { fmt.Fprint(cmd.Stderr, usage) }
 	if err := fs.Parse(args); err != nil {
 		return Options{}, err
 	}
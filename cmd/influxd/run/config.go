@@ -10,6 +10,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 	"github.com/influxdata/influxdb/logger"
+	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/monitor"
 	"github.com/influxdata/influxdb/monitor/diagnostics"
 	"github.com/influxdata/influxdb/pkg/tlsconfig"
@@ -31,6 +32,8 @@ import (
 	"github.com/angopher/chronus/coordinator"
 	"github.com/angopher/chronus/services/controller"
 	"github.com/angopher/chronus/services/hh"
+	"github.com/angopher/chronus/services/kafka"
+	"github.com/angopher/chronus/services/probe"
 )
 
 const (
@@ -54,10 +57,12 @@ type Config struct {
 	CollectdInputs []collectd.Config `toml:"collectd"`
 	OpenTSDBInputs []opentsdb.Config `toml:"opentsdb"`
 	UDPInputs      []udp.Config      `toml:"udp"`
+	KafkaInputs    []kafka.Config    `toml:"kafka"`
 
 	ContinuousQuery continuous_querier.Config `toml:"continuous_queries"`
 	HintedHandoff   hh.Config                 `toml:"hinted-handoff"`
 	Controller      controller.Config         `toml:"controller"`
+	Probe           probe.Config              `toml:"probe"`
 
 	// Server reporting
 	ReportingDisabled bool `toml:"reporting-disabled"`
@@ -65,6 +70,10 @@ type Config struct {
 	// BindAddress is the address that all TCP services use (Raft, Snapshot, Cluster, etc.)
 	BindAddress string `toml:"bind-address"`
 
+	// Gateway runs the server without local storage. It doesn't register
+	// as a data node and routes writes and queries to the shard owners.
+	Gateway bool `toml:"gateway"`
+
 	// TLS provides configuration options for all https endpoints.
 	TLS tlsconfig.Config `toml:"tls"`
 }
@@ -92,11 +101,13 @@ func NewConfig() *Config {
 	c.HintedHandoff.Enabled = true
 	c.HintedHandoff.Dir = "./hh"
 	c.Controller = controller.NewConfig()
+	c.Probe = probe.NewConfig()
 
 	c.GraphiteInputs = []graphite.Config{graphite.NewConfig()}
 	c.CollectdInputs = []collectd.Config{collectd.NewConfig()}
 	c.OpenTSDBInputs = []opentsdb.Config{opentsdb.NewConfig()}
 	c.UDPInputs = []udp.Config{udp.NewConfig()}
+	c.KafkaInputs = []kafka.Config{kafka.NewConfig()}
 
 	c.ContinuousQuery = continuous_querier.NewConfig()
 	c.ContinuousQuery.RunInterval = itoml.Duration(time.Minute)
@@ -106,6 +117,16 @@ func NewConfig() *Config {
 	return c
 }
 
+// validateConsistencyLevel checks the consistency level of input services,
+// empty one means the default of service.
+func validateConsistencyLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+	_, err := models.ParseConsistencyLevel(level)
+	return err
+}
+
 // NewDemoConfig returns the config that runs when no config is specified.
 func NewDemoConfig() (*Config, error) {
 	c := NewConfig()
@@ -161,6 +182,10 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.Coordinator.Validate(); err != nil {
+		return err
+	}
+
 	if err := c.Monitor.Validate(); err != nil {
 		return err
 	}
@@ -177,6 +202,18 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.Controller.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.HintedHandoff.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Probe.Validate(); err != nil {
+		return err
+	}
+
 	if err := c.Subscriber.Validate(); err != nil {
 		return err
 	}
@@ -185,6 +222,15 @@ func (c *Config) Validate() error {
 		if err := graphite.Validate(); err != nil {
 			return fmt.Errorf("invalid graphite config: %v", err)
 		}
+		if err := validateConsistencyLevel(graphite.ConsistencyLevel); err != nil {
+			return fmt.Errorf("invalid graphite config: %v", err)
+		}
+	}
+
+	for _, opentsdb := range c.OpenTSDBInputs {
+		if err := validateConsistencyLevel(opentsdb.ConsistencyLevel); err != nil {
+			return fmt.Errorf("invalid opentsdb config: %v", err)
+		}
 	}
 
 	for _, collectd := range c.CollectdInputs {
@@ -193,6 +239,12 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for _, kafka := range c.KafkaInputs {
+		if err := kafka.Validate(); err != nil {
+			return fmt.Errorf("invalid kafka config: %v", err)
+		}
+	}
+
 	if err := c.TLS.Validate(); err != nil {
 		return err
 	}
@@ -210,6 +262,7 @@ func (c *Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	return diagnostics.RowFromMap(map[string]interface{}{
 		"reporting-disabled": c.ReportingDisabled,
 		"bind-address":       c.BindAddress,
+		"gateway":            c.Gateway,
 	}), nil
 }
 
@@ -244,6 +297,9 @@ func (c *Config) diagnosticsClients() map[string]diagnostics.Client {
 	if u := udp.Configs(c.UDPInputs); u.Enabled() {
 		m["config-udp"] = u
 	}
+	if k := kafka.Configs(c.KafkaInputs); k.Enabled() {
+		m["config-kafka"] = k
+	}
 
 	return m
 }
@@ -34,6 +34,7 @@ import (
 	"github.com/influxdata/influxdb/tcp"
 	"github.com/influxdata/influxdb/tsdb"
 	client "github.com/influxdata/usage-client/v1"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 
 	// Initialize the engine package
@@ -42,9 +43,13 @@ import (
 	_ "github.com/influxdata/influxdb/tsdb/index"
 
 	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/logging"
 	"github.com/angopher/chronus/services/controller"
 	"github.com/angopher/chronus/services/hh"
+	ihttpd "github.com/angopher/chronus/services/httpd"
+	"github.com/angopher/chronus/services/kafka"
 	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/angopher/chronus/services/probe"
 	"github.com/angopher/chronus/x"
 )
 
@@ -79,11 +84,15 @@ type Server struct {
 
 	Node              *influxdb.Node
 	ClusterMetaClient *coordinator.ClusterMetaClient
+	Features          *imeta.FeatureFlags
 
 	TSDBStore     *tsdb.Store
 	QueryExecutor *query.Executor
 	PointsWriter  *coordinator.PointsWriter
 	ShardWriter   *coordinator.ShardWriter
+	// WriteBatcher coalesces writes of PointsWriter to other nodes, if
+	// write-batch-window is set
+	WriteBatcher  *coordinator.WriteBatcher
 	HintedHandoff *hh.Service
 	Subscriber    *subscriber.Service
 
@@ -93,6 +102,7 @@ type Server struct {
 	SnapshotterService *snapshotter.Service
 	ClusterService     *coordinator.Service
 	ControllerService  *controller.Service
+	HTTPDService       *ihttpd.Service
 
 	Monitor *monitor.Monitor
 
@@ -212,21 +222,37 @@ func NewServer(c *Config, buildInfo *BuildInfo, logger *zap.Logger) (*Server, er
 	}
 	s.ClusterMetaClient.Start()
 
-	// If we've already created a data node for our id, we're done
-	n, err := s.ClusterMetaClient.DataNode(nodeID)
-	if err != nil {
-		s.Logger.Warn(fmt.Sprintf("Node id(%d) from store can't be used, try to create new", nodeID), zap.Error(err))
-		n, err = s.ClusterMetaClient.CreateDataNode(s.httpAPIAddr, s.tcpAddr)
+	if c.Gateway {
+		// Gateway owns no shard, every write and query goes to the owners
+		s.Logger.Info("Running as gateway without local storage")
+		s.Node.ID = 0
+		s.ClusterMetaClient.NodeID = 0
+	} else {
+		// If we've already created a data node for our id, we're done
+		n, err := s.ClusterMetaClient.DataNode(nodeID)
 		if err != nil {
-			s.Logger.Warn(fmt.Sprint("Unable to create data node. err: ", err.Error()))
+			s.Logger.Warn(fmt.Sprintf("Node id(%d) from store can't be used, try to create new", nodeID), zap.Error(err))
+			n, err = s.ClusterMetaClient.CreateDataNode(s.httpAPIAddr, s.tcpAddr)
+			if err != nil {
+				s.Logger.Warn(fmt.Sprint("Unable to create data node. err: ", err.Error()))
+				return nil, err
+			}
+		}
+		s.Node.ID = n.ID
+		s.ClusterMetaClient.NodeID = n.ID
+		if err := s.Node.Save(); err != nil {
 			return nil, err
 		}
+		// Processes of this node started before are stale from now on
+		if incarnation, err := s.ClusterMetaClient.RegisterDataNode(n.ID); err != nil {
+			s.Logger.Warn("Unable to register incarnation of data node", zap.Uint64("node", n.ID), zap.Error(err))
+		} else {
+			s.Logger.Info("Data node registered", zap.Uint64("node", n.ID), zap.Uint64("incarnation", incarnation))
+		}
 	}
-	s.Node.ID = n.ID
-	s.ClusterMetaClient.NodeID = n.ID
-	if err := s.Node.Save(); err != nil {
-		return nil, err
-	}
+
+	s.Features = imeta.NewFeatureFlags(s.Node.ID, s.ClusterMetaClient)
+	s.Features.WithLogger(s.Logger)
 
 	s.TSDBStore = tsdb.NewStore(c.Data.Dir)
 	s.TSDBStore.EngineOptions.Config = c.Data
@@ -239,26 +265,59 @@ func NewServer(c *Config, buildInfo *BuildInfo, logger *zap.Logger) (*Server, er
 	s.Subscriber = subscriber.NewService(c.Subscriber)
 
 	// Initialize shard writer
-	s.ShardWriter = coordinator.NewShardWriter(
-		time.Duration(s.config.Coordinator.WriteTimeout),
-		coordinator.NewClientPool(func(nodeId uint64) (x.ConnPool, error) {
-			return x.NewBoundedPool(
-				1,
-				100,
-				time.Duration(s.config.Coordinator.PoolMaxIdleTimeout),
-				time.Duration(s.config.Coordinator.DailTimeout),
-				coordinator.NewClientConnFactory(
-					nodeId,
+	if c.Coordinator.ShardWriterTransport == coordinator.ShardWriterTransportGRPC {
+		s.ShardWriter = coordinator.NewShardWriterWithTransport(coordinator.NewGRPCTransport(
+			time.Duration(s.config.Coordinator.WriteTimeout),
+			time.Duration(s.config.Coordinator.DailTimeout),
+			s.ClusterMetaClient,
+		))
+	} else {
+		s.ShardWriter = coordinator.NewShardWriter(
+			time.Duration(s.config.Coordinator.WriteTimeout),
+			coordinator.NewClientPool(func(nodeId uint64) (x.ConnPool, error) {
+				return x.NewBoundedPool(
+					1,
+					100,
+					time.Duration(s.config.Coordinator.PoolMaxIdleTimeout),
 					time.Duration(s.config.Coordinator.DailTimeout),
-					s.ClusterMetaClient,
-				).Dial,
-			)
-		}),
+					coordinator.NewClientConnFactory(
+						nodeId,
+						time.Duration(s.config.Coordinator.DailTimeout),
+						s.ClusterMetaClient,
+					).Dial,
+				)
+			}),
+		)
+	}
+	s.ShardWriter.SetConcurrencyLimit(
+		c.Coordinator.MaxConcurrentWrites,
+		c.Coordinator.MaxConcurrentWritesPerNode,
+		time.Duration(c.Coordinator.ConcurrentWritesWait),
+	)
+	s.ShardWriter.SetCircuitBreaker(
+		c.Coordinator.BreakerThreshold,
+		time.Duration(c.Coordinator.BreakerCooldown),
 	)
+	s.ShardWriter.SetMaxOwnerBacklog(c.Coordinator.MaxOwnerBacklog)
+	s.ShardWriter.SetMaxPayloadSize(int64(c.Coordinator.MaxWritePayloadSize))
+	s.ShardWriter.SetMinOwnerDiskFree(int64(c.Coordinator.MinOwnerDiskFree))
+	if err := s.ShardWriter.SetCompression(c.Coordinator.WriteCompression); err != nil {
+		return nil, err
+	}
+	if err := s.ShardWriter.SetEncoding(c.Coordinator.WriteEncoding); err != nil {
+		return nil, err
+	}
+	s.ShardWriter.Features = s.Features
+	s.ShardWriter.SetIncarnation(s.Node.ID, s.ClusterMetaClient.Incarnation())
 	s.ShardWriter.WithLogger(s.Logger)
 
 	// Create the hinted handoff service
 	s.HintedHandoff = hh.NewService(c.HintedHandoff, s.ShardWriter, s.ClusterMetaClient)
+	s.HintedHandoff.Features = s.Features
+	s.HintedHandoff.ShardCutovers = s.ClusterMetaClient
+	s.HintedHandoff.StaleShards = s.ClusterMetaClient
+	s.HintedHandoff.ShardOwners = s.ClusterMetaClient
+	s.HintedHandoff.DroppedMeasurements = s.ClusterMetaClient
 	s.HintedHandoff.Monitor = s.Monitor
 	s.HintedHandoff.WithLogger(s.Logger)
 
@@ -267,8 +326,19 @@ func NewServer(c *Config, buildInfo *BuildInfo, logger *zap.Logger) (*Server, er
 	s.PointsWriter.WriteTimeout = time.Duration(c.Coordinator.WriteTimeout)
 	s.PointsWriter.TSDBStore = s.TSDBStore
 	s.PointsWriter.ShardWriter = s.ShardWriter
+	if c.Coordinator.WriteBatchWindow > 0 {
+		s.WriteBatcher = coordinator.NewWriteBatcher(s.ShardWriter,
+			time.Duration(c.Coordinator.WriteBatchWindow), c.Coordinator.WriteBatchMaxPoints)
+		s.PointsWriter.ShardWriter = s.WriteBatcher
+	}
 	s.PointsWriter.Node = s.Node
 	s.PointsWriter.HintedHandoff = s.HintedHandoff
+	s.PointsWriter.WriteKeys = coordinator.NewWriteKeys(c.Coordinator.WriteIdempotencyWindow)
+	s.PointsWriter.DiskHeadroom = coordinator.NewDiskHeadroom(c.Data.Dir, int64(c.Coordinator.MinOwnerDiskFree))
+	s.PointsWriter.AsyncReplication = c.Coordinator.WriteReplication == coordinator.WriteReplicationAsync
+	if err := s.PointsWriter.SetWriteTimeLimits(c.Coordinator); err != nil {
+		return nil, err
+	}
 
 	// Initialize cluster extecutor
 	clusterExecutor := coordinator.NewClusterExecutor(
@@ -294,7 +364,7 @@ func NewServer(c *Config, buildInfo *BuildInfo, logger *zap.Logger) (*Server, er
 	// Initialize query executor.
 	s.clusterExecutor = clusterExecutor
 	s.QueryExecutor = query.NewExecutor()
-	s.QueryExecutor.StatementExecutor = &influxdb_coordinator.StatementExecutor{
+	statementExecutor := &influxdb_coordinator.StatementExecutor{
 		MetaClient:  s.ClusterMetaClient,
 		TaskManager: clusterExecutor,
 		TSDBStore:   clusterExecutor,
@@ -309,6 +379,12 @@ func NewServer(c *Config, buildInfo *BuildInfo, logger *zap.Logger) (*Server, er
 		MaxSelectSeriesN:  c.Coordinator.MaxSelectSeriesN,
 		MaxSelectBucketsN: c.Coordinator.MaxSelectBucketsN,
 	}
+	clusterExecutor.NodeStatements = statementExecutor
+	s.QueryExecutor.StatementExecutor = &coordinator.StatementExecutor{
+		StatementExecutor: statementExecutor,
+		MetaClient:        s.ClusterMetaClient,
+		NodeStatements:    clusterExecutor,
+	}
 	s.QueryExecutor.TaskManager.QueryTimeout = time.Duration(c.Coordinator.QueryTimeout)
 	s.QueryExecutor.TaskManager.LogQueriesAfter = time.Duration(c.Coordinator.LogQueriesAfter)
 	s.QueryExecutor.TaskManager.MaxConcurrentQueries = c.Coordinator.MaxConcurrentQueries
@@ -321,6 +397,7 @@ func NewServer(c *Config, buildInfo *BuildInfo, logger *zap.Logger) (*Server, er
 	s.Monitor.Branch = s.buildInfo.Branch
 	s.Monitor.BuildTime = s.buildInfo.Time
 	s.Monitor.PointsWriter = (*monitorPointsWriter)(s.PointsWriter)
+	s.HintedHandoff.PointsWriter = (*monitorPointsWriter)(s.PointsWriter)
 	return s, nil
 }
 
@@ -330,6 +407,11 @@ func (s *Server) Statistics(tags map[string]string) []models.Statistic {
 	statistics = append(statistics, s.QueryExecutor.Statistics(tags)...)
 	statistics = append(statistics, s.TSDBStore.Statistics(tags)...)
 	statistics = append(statistics, s.PointsWriter.Statistics(tags)...)
+	if s.WriteBatcher != nil {
+		statistics = append(statistics, s.WriteBatcher.Statistics(tags)...)
+	}
+	statistics = append(statistics, s.clusterExecutor.Statistics(tags)...)
+	statistics = append(statistics, s.ClusterMetaClient.Statistics(tags)...)
 	statistics = append(statistics, s.Subscriber.Statistics(tags)...)
 	for _, srv := range s.Services {
 		if m, ok := srv.(monitor.Reporter); ok {
@@ -342,12 +424,21 @@ func (s *Server) Statistics(tags map[string]string) []models.Statistic {
 func (s *Server) appendClusterService(c coordinator.Config) {
 	srv := coordinator.NewService(c)
 	srv.TaskManager = s.QueryExecutor.TaskManager
+	srv.NodeStatements = s.clusterExecutor.NodeStatements
 	srv.TSDBStore = s.TSDBStore
 	srv.Node = s.Node
 	srv.MetaClient = s.ClusterMetaClient
+	srv.WriteKeys = s.PointsWriter.WriteKeys
+	srv.DiskHeadroom = s.PointsWriter.DiskHeadroom
+	srv.ReadOnlyShards = s.ClusterMetaClient
+	srv.ShardCutovers = s.ClusterMetaClient
+	srv.HintedHandoff = s.HintedHandoff
+	srv.MeasurementTombstones = s.ClusterMetaClient
+	srv.Incarnations = s.ClusterMetaClient
 	srv.WithLogger(s.Logger)
 	s.Services = append(s.Services, srv)
 	s.ClusterService = srv
+	s.ShardWriter.SetLocal(s.Node.ID, srv)
 }
 
 func (s *Server) appendSnapshotterService() {
@@ -382,20 +473,31 @@ func (s *Server) appendHTTPDService(c httpd.Config) {
 	if !c.Enabled {
 		return
 	}
-	srv := httpd.NewService(c)
+	srv := ihttpd.NewService(c)
+	srv.MetaClient = s.ClusterMetaClient
 	srv.Handler.MetaClient = s.ClusterMetaClient
-	authorizer := &imeta.Authorizer{}
+	authorizer := &imeta.Authorizer{MetaClient: s.ClusterMetaClient}
+	s.PointsWriter.WriteAuthorizer = authorizer
 	srv.Handler.QueryAuthorizer = authorizer
 	srv.Handler.WriteAuthorizer = authorizer
 	srv.Handler.QueryExecutor = s.QueryExecutor
 	srv.Handler.Monitor = s.Monitor
 	srv.Handler.PointsWriter = s.PointsWriter
+	srv.ShardRouter = s.PointsWriter
+	srv.LogLevels = logging.DefaultLevels()
 	srv.Handler.Version = s.buildInfo.Version
 	srv.Handler.BuildType = "OSS"
 	ss := storage.NewStore(s.TSDBStore, s.ClusterMetaClient)
-	srv.Handler.Store = ss
+	// prometheus remote read goes through the cluster instead of local shards
+	srv.Handler.Store = coordinator.NewPromReadStore(s.QueryExecutor)
 	srv.Handler.Controller = control.NewController(s.ClusterMetaClient, reads.NewReader(ss), authorizer, c.AuthEnabled, s.Logger)
+	if s.config.Probe.Enabled {
+		srv.Probe = probe.NewHandler(s.config.Probe)
+		srv.Probe.MetaClient = s.ClusterMetaClient
+		srv.Probe.HintedHandoff = s.HintedHandoff
+	}
 
+	s.HTTPDService = srv
 	s.Services = append(s.Services, srv)
 }
 
@@ -417,7 +519,11 @@ func (s *Server) appendOpenTSDBService(c opentsdb.Config) error {
 	if err != nil {
 		return err
 	}
-	srv.PointsWriter = s.PointsWriter
+	pw, err := newConsistencyPointsWriter(s.PointsWriter, c.WithDefaults().ConsistencyLevel)
+	if err != nil {
+		return err
+	}
+	srv.PointsWriter = pw
 	srv.MetaClient = s.ClusterMetaClient
 	s.Services = append(s.Services, srv)
 	return nil
@@ -431,8 +537,12 @@ func (s *Server) appendGraphiteService(c graphite.Config) error {
 	if err != nil {
 		return err
 	}
+	pw, err := newConsistencyPointsWriter(s.PointsWriter, c.WithDefaults().ConsistencyLevel)
+	if err != nil {
+		return err
+	}
 
-	srv.PointsWriter = s.PointsWriter
+	srv.PointsWriter = pw
 	srv.MetaClient = s.ClusterMetaClient
 	srv.Monitor = s.Monitor
 	s.Services = append(s.Services, srv)
@@ -459,6 +569,16 @@ func (s *Server) appendUDPService(c udp.Config) {
 	s.Services = append(s.Services, srv)
 }
 
+func (s *Server) appendKafkaService(c kafka.Config) {
+	if !c.Enabled {
+		return
+	}
+	srv := kafka.NewService(c)
+	srv.PointsWriter = s.PointsWriter
+	srv.MetaClient = s.ClusterMetaClient
+	s.Services = append(s.Services, srv)
+}
+
 func (s *Server) appendContinuousQueryService(c continuous_querier.Config) {
 	if !c.Enabled {
 		return
@@ -476,8 +596,21 @@ func (s *Server) appendControllerService(c controller.Config) {
 	}
 	srv := controller.NewService(c)
 	srv.MetaClient = s.ClusterMetaClient
+	srv.ClusterExecutor = s.clusterExecutor
+	if s.ClusterService != nil {
+		srv.ClusterService = s.ClusterService
+	}
 	srv.Node = s.Node
 	srv.TSDBStore = s.TSDBStore
+	srv.HintedHandoff = s.HintedHandoff
+	srv.WriteBacklogs = s.ShardWriter
+	if e, ok := s.QueryExecutor.StatementExecutor.(*coordinator.StatementExecutor); ok {
+		e.ShardUsage = srv
+	}
+
+	if s.HTTPDService != nil {
+		s.HTTPDService.Controller = srv
+	}
 
 	s.ControllerService = srv
 	s.Services = append(s.Services, srv)
@@ -504,13 +637,18 @@ func (s *Server) Open() error {
 
 	// Append services.
 	s.appendMonitorService()
-	s.appendPrecreatorService(s.config.Precreator)
-	s.appendClusterService(s.config.Coordinator)
-	s.appendSnapshotterService()
-	s.appendContinuousQueryService(s.config.ContinuousQuery)
+	if !s.config.Gateway {
+		// services of local storage, left to data nodes by gateway
+		s.appendPrecreatorService(s.config.Precreator)
+		s.appendClusterService(s.config.Coordinator)
+		s.appendSnapshotterService()
+		s.appendContinuousQueryService(s.config.ContinuousQuery)
+	}
 	s.appendHTTPDService(s.config.HTTPD)
-	s.appendRetentionPolicyService(s.config.Retention)
-	s.appendControllerService(s.config.Controller)
+	if !s.config.Gateway {
+		s.appendRetentionPolicyService(s.config.Retention)
+		s.appendControllerService(s.config.Controller)
+	}
 	for _, i := range s.config.GraphiteInputs {
 		if err := s.appendGraphiteService(i); err != nil {
 			return err
@@ -527,15 +665,30 @@ func (s *Server) Open() error {
 	for _, i := range s.config.UDPInputs {
 		s.appendUDPService(i)
 	}
+	for _, i := range s.config.KafkaInputs {
+		s.appendKafkaService(i)
+	}
 
 	s.Subscriber.MetaClient = s.ClusterMetaClient
 	s.PointsWriter.MetaClient = s.ClusterMetaClient
+	s.PointsWriter.HintedHandoffPolicy = s.ClusterMetaClient
+	s.PointsWriter.ReadOnlyCluster = s.ClusterMetaClient
+	s.PointsWriter.ReadOnlyShards = s.ClusterMetaClient
+	s.PointsWriter.ShardCutovers = s.ClusterMetaClient
+	s.PointsWriter.SealedShards = s.ClusterMetaClient
 	s.ShardWriter.MetaClient = s.ClusterMetaClient
 	s.Monitor.MetaClient = s.ClusterMetaClient
 
-	s.ClusterService.Listener = mux.Listen(coordinator.MuxHeader)
-	s.SnapshotterService.Listener = mux.Listen(snapshotter.MuxHeader)
-	s.ControllerService.Listener = mux.Listen(controller.MuxHeader)
+	if s.ClusterService != nil {
+		s.ClusterService.Listener = mux.Listen(coordinator.MuxHeader)
+		s.ClusterService.GRPCListener = mux.Listen(coordinator.GRPCMuxHeader)
+	}
+	if s.SnapshotterService != nil {
+		s.SnapshotterService.Listener = mux.Listen(snapshotter.MuxHeader)
+	}
+	if s.ControllerService != nil {
+		s.ControllerService.Listener = mux.Listen(controller.MuxHeader)
+	}
 
 	// Configure logging for all services and clients.
 	s.TSDBStore.WithLogger(s.Logger)
@@ -547,12 +700,23 @@ func (s *Server) Open() error {
 	for _, svc := range s.Services {
 		svc.WithLogger(s.Logger)
 	}
-	s.SnapshotterService.WithLogger(s.Logger)
+	if s.SnapshotterService != nil {
+		s.SnapshotterService.WithLogger(s.Logger)
+	}
 	s.Monitor.WithLogger(s.Logger)
 
-	// Open TSDB store.
-	if err := s.TSDBStore.Open(); err != nil {
-		return fmt.Errorf("open tsdb store: %s", err)
+	// Open TSDB store, gateway keeps no shard at all.
+	if !s.config.Gateway {
+		if err := s.TSDBStore.Open(); err != nil {
+			return fmt.Errorf("open tsdb store: %s", err)
+		}
+	}
+	// Shards mismatching meta are quarantined before anything is served, in
+	// safe mode.
+	if s.ControllerService != nil {
+		if err := s.ControllerService.ValidateShards(); err != nil {
+			return fmt.Errorf("validate shards: %s", err)
+		}
 	}
 
 	// Open the subscriber service
@@ -569,6 +733,10 @@ func (s *Server) Open() error {
 	if err := s.PointsWriter.Open(); err != nil {
 		return fmt.Errorf("open points writer: %s", err)
 	}
+	// Write statistics by database are served by /metrics
+	if err := prometheus.Register(s.PointsWriter.PrometheusCollector()); err != nil {
+		s.Logger.Warn("Failed to register write statistics to prometheus", zap.Error(err))
+	}
 
 	//TODO:
 	//s.PointsWriter.AddWriteSubscriber(s.Subscriber.Points())
@@ -607,6 +775,7 @@ func (s *Server) Close() error {
 	s.config.deregisterDiagnostics(s.Monitor)
 
 	if s.PointsWriter != nil {
+		prometheus.Unregister(s.PointsWriter.PrometheusCollector())
 		s.PointsWriter.Close()
 	}
 
@@ -784,6 +953,25 @@ func (pw *monitorPointsWriter) WritePoints(database, retentionPolicy string, poi
 	return (*coordinator.PointsWriter)(pw).WritePointsPrivileged(database, retentionPolicy, models.ConsistencyLevelAny, points)
 }
 
+// consistencyPointsWriter writes points of input services into cluster with
+// the consistency level configured instead of the one passed by them.
+type consistencyPointsWriter struct {
+	pw    *coordinator.PointsWriter
+	level models.ConsistencyLevel
+}
+
+func newConsistencyPointsWriter(pw *coordinator.PointsWriter, level string) (*consistencyPointsWriter, error) {
+	l, err := models.ParseConsistencyLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return &consistencyPointsWriter{pw: pw, level: l}, nil
+}
+
+func (w *consistencyPointsWriter) WritePointsPrivileged(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+	return w.pw.WritePointsPrivileged(database, retentionPolicy, w.level, points)
+}
+
 func raftDBExists(dir string) error {
 	// Check to see if there is a raft db, if so, error out with a message
 	// to downgrade, export, and then import the meta data
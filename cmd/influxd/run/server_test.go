@@ -0,0 +1,83 @@
+package run_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/cmd/influxd/run"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// metaServer answers data nodes like a meta server of empty meta data.
+func metaServer(t *testing.T) *httptest.Server {
+	d := &imeta.Data{}
+	d.Index = 1
+	data, err := d.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp interface{}
+		switch r.URL.Path {
+		case raftmeta.DATA_PATH:
+			resp = &raftmeta.DataResp{CommonResp: raftmeta.CommonResp{RetMsg: "ok"}, Data: data}
+		case raftmeta.PING_PATH:
+			resp = &raftmeta.PingResp{CommonResp: raftmeta.CommonResp{RetMsg: "ok"}, Index: 1}
+		default:
+			resp = &raftmeta.CommonResp{RetMsg: "ok"}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func TestServer_Gateway(t *testing.T) {
+	tmpdir, err := ioutil.TempDir(os.TempDir(), "influxd-gateway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	ms := metaServer(t)
+	defer ms.Close()
+
+	c := run.NewConfig()
+	c.Gateway = true
+	c.BindAddress = "127.0.0.1:0"
+	c.ReportingDisabled = true
+	c.Meta.Dir = filepath.Join(tmpdir, "meta")
+	c.Data.Dir = filepath.Join(tmpdir, "data")
+	c.Data.WALDir = filepath.Join(tmpdir, "wal")
+	c.HintedHandoff.Dir = filepath.Join(tmpdir, "hh")
+	c.HTTPD.BindAddress = "127.0.0.1:0"
+	c.HTTPD.AccessLogPath = ""
+	c.Monitor.StoreEnabled = false
+	c.Coordinator.MetaServices = []string{strings.TrimPrefix(ms.URL, "http://")}
+
+	s, err := run.NewServer(c, &run.BuildInfo{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// services of local storage are left to data nodes
+	if s.ClusterService != nil || s.SnapshotterService != nil || s.ControllerService != nil {
+		t.Fatal("gateway runs services of local storage")
+	}
+	if s.Node.ID != 0 {
+		t.Fatalf("gateway registered as data node %d", s.Node.ID)
+	}
+	if _, err := os.Stat(c.Data.Dir); !os.IsNotExist(err) {
+		t.Fatalf("gateway opened local storage: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func ArchiveCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "archive",
+		Usage: "View shard groups pruned from meta data",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "list",
+				Usage:       "List archived shard groups and owners of their shards",
+				Description: "Shard groups are archived by meta nodes with archive-dir set, ask the node of -metad.",
+				ArgsUsage:   "[database] [retention-policy]",
+				Action:      archiveList,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func archiveList(ctx *cli.Context) (err error) {
+	resp := &raftmeta.ArchivedShardGroupsResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.ARCHIVED_SHARD_GROUPS_PATH,
+		"?db=", url.QueryEscape(ctx.Args().Get(0)), "&rp=", url.QueryEscape(ctx.Args().Get(1))))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Archived Shard Groups:\n")
+	for _, g := range resp.ShardGroups {
+		fmt.Print(util.PadRight(fmt.Sprint(g.ID), 8), util.PadRight(fmt.Sprint(g.Database, "/", g.RetentionPolicy), 30),
+			g.StartTime.Format(time.RFC3339), " - ", g.EndTime.Format(time.RFC3339), "\n")
+		for _, sh := range g.Shards {
+			owners := make([]uint64, 0, len(sh.Owners))
+			for _, o := range sh.Owners {
+				owners = append(owners, o.NodeID)
+			}
+			fmt.Print("        shard ", util.PadRight(fmt.Sprint(sh.ID), 8), "owners ", owners, "\n")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package cmds
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/urfave/cli/v2"
+)
+
+func BenchCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "bench",
+		Usage: "Benchmark meta data commits with generated databases and shard groups",
+		Description: "Everything runs in process against a meta client, no meta node is involved.\n" +
+			"   Commits are shard groups created concurrently, while readers look up shard groups\n" +
+			"   to show how long reads wait for commits holding the lock.",
+		Action: bench,
+		Flags: []cli.Flag{
+			&cli.IntFlag{Name: "databases", Value: 1000, Usage: "Databases generated"},
+			&cli.IntFlag{Name: "shard-groups", Value: 50, Usage: "Shard groups generated per database"},
+			&cli.IntFlag{Name: "data-nodes", Value: 3, Usage: "Data nodes owning shards"},
+			&cli.IntFlag{Name: "commits", Value: 1000, Usage: "Commits measured"},
+			&cli.IntFlag{Name: "concurrency", Value: 8, Usage: "Goroutines committing"},
+			&cli.IntFlag{Name: "readers", Value: 4, Usage: "Goroutines reading while committing"},
+		},
+	}
+}
+
+func bench(ctx *cli.Context) error {
+	databases, groups := ctx.Int("databases"), ctx.Int("shard-groups")
+	commits, concurrency := ctx.Int("commits"), ctx.Int("concurrency")
+	if databases < 1 || groups < 1 || commits < 1 || concurrency < 1 || ctx.Int("data-nodes") < 1 {
+		return fmt.Errorf("databases, shard-groups, data-nodes, commits and concurrency should be positive")
+	}
+	base := time.Now().Truncate(7 * 24 * time.Hour).Add(-time.Duration(groups) * 7 * 24 * time.Hour)
+
+	fmt.Println("Generating", databases, "databases of", groups, "shard groups ...")
+	start := time.Now()
+	data, err := benchData(databases, groups, ctx.Int("data-nodes"), base)
+	if err != nil {
+		return err
+	}
+	cli := imeta.NewClient(&meta.Config{})
+	if err := cli.Open(); err != nil {
+		return err
+	}
+	defer cli.Close()
+	if err := cli.SetData(data); err != nil {
+		return err
+	}
+	fmt.Println("Generated in", time.Since(start))
+	fmt.Println()
+
+	color.Set(color.Bold)
+	color.Yellow("Data:\n")
+	start = time.Now()
+	buf, err := data.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	fmt.Println(util.PadRight("Marshal:", 12), time.Since(start), "for", len(buf), "bytes")
+	const clones = 20
+	start = time.Now()
+	for i := 0; i < clones; i++ {
+		data.Clone()
+	}
+	fmt.Println(util.PadRight("Clone:", 12), time.Since(start)/clones)
+	fmt.Println()
+
+	// every commit creates a shard group after the generated ones
+	var next int64 = -1
+	var latencies, reads []time.Duration
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < ctx.Int("readers"); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var local []time.Duration
+			for n := i; ; n++ {
+				select {
+				case <-stop:
+					mu.Lock()
+					reads = append(reads, local...)
+					mu.Unlock()
+					return
+				default:
+				}
+				ts := base.Add(time.Duration(n%groups) * 7 * 24 * time.Hour)
+				t := time.Now()
+				cli.ShardGroupByTimestamp(fmt.Sprint("db", n%databases), "autogen", ts)
+				local = append(local, time.Since(t))
+			}
+		}(i)
+	}
+
+	var errs int64
+	var writers sync.WaitGroup
+	start = time.Now()
+	for i := 0; i < concurrency; i++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			var local []time.Duration
+			for {
+				n := atomic.AddInt64(&next, 1)
+				if n >= int64(commits) {
+					break
+				}
+				ts := base.Add(time.Duration(int64(groups)+n/int64(databases)) * 7 * 24 * time.Hour)
+				t := time.Now()
+				if _, err := cli.CreateShardGroup(fmt.Sprint("db", n%int64(databases)), "autogen", ts); err != nil {
+					atomic.AddInt64(&errs, 1)
+				}
+				local = append(local, time.Since(t))
+			}
+			mu.Lock()
+			latencies = append(latencies, local...)
+			mu.Unlock()
+		}()
+	}
+	writers.Wait()
+	elapsed := time.Since(start)
+	close(stop)
+	wg.Wait()
+
+	color.Set(color.Bold)
+	color.Yellow("Commits:\n")
+	fmt.Println(util.PadRight("Throughput:", 12), fmt.Sprintf("%.1f/s", float64(commits)/elapsed.Seconds()), "errors", errs)
+	printLatencies(latencies)
+	fmt.Println()
+
+	color.Set(color.Bold)
+	color.Yellow("Reads while committing:\n")
+	fmt.Println(util.PadRight("Throughput:", 12), fmt.Sprintf("%.1f/s", float64(len(reads))/elapsed.Seconds()))
+	printLatencies(reads)
+	return nil
+}
+
+// benchData returns meta data of databases with default retention policy
+// holding groups shard groups each, one week long from base.
+func benchData(databases, groups, nodes int, base time.Time) (*imeta.Data, error) {
+	data := &imeta.Data{}
+	data.Index = 1
+	for i := 0; i < nodes; i++ {
+		if _, err := data.CreateDataNode(fmt.Sprint("127.0.0.1:", 8086+i), fmt.Sprint("127.0.0.1:", 8088+i)); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < databases; i++ {
+		name := fmt.Sprint("db", i)
+		if err := data.CreateDatabase(name); err != nil {
+			return nil, err
+		}
+		rpi := meta.DefaultRetentionPolicyInfo()
+		rpi.ShardGroupDuration = 7 * 24 * time.Hour
+		if err := data.CreateRetentionPolicy(name, rpi, true); err != nil {
+			return nil, err
+		}
+		for j := 0; j < groups; j++ {
+			if err := data.CreateShardGroup(name, rpi.Name, base.Add(time.Duration(j)*rpi.ShardGroupDuration)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+func printLatencies(d []time.Duration) {
+	if len(d) == 0 {
+		return
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	at := func(q float64) time.Duration { return d[int(q*float64(len(d)-1))] }
+	fmt.Println(util.PadRight("Latency:", 12), "p50", at(0.5), "p90", at(0.9), "p99", at(0.99), "max", d[len(d)-1])
+}
@@ -0,0 +1,116 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func ConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "Maintain runtime settings shared by all nodes of the cluster",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "show",
+				Usage:  "Show current cluster config",
+				Action: configShow,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "set",
+				Usage:       "Set a key of cluster config",
+				Description: "Nodes apply the value at runtime, overriding their own config.\n   Run `config keys` for keys known.",
+				ArgsUsage:   "<key> <value>",
+				Action:      configSet,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:      "unset",
+				Usage:     "Unset a key of cluster config, nodes fall back to their own config",
+				ArgsUsage: "<key>",
+				Action:    configUnset,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:   "keys",
+				Usage:  "List keys of cluster config",
+				Action: configKeys,
+			},
+		},
+	}
+}
+
+func configShow(ctx *cli.Context) (err error) {
+	resp := &raftmeta.ClusterConfigResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.CLUSTER_CONFIG_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Cluster Config:\n")
+	for _, k := range imeta.ClusterConfigKeys() {
+		if v, ok := resp.Config[k.Name]; ok {
+			fmt.Print(util.PadRight(k.Name, 30), v, "\n")
+		}
+	}
+	return nil
+}
+
+func configSet(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 2 {
+		return errors.New("Please specify key and value")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.SET_CLUSTER_CONFIG_PATH), &raftmeta.SetClusterConfigReq{
+		Key:   ctx.Args().Get(0),
+		Value: ctx.Args().Get(1),
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func configUnset(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify key")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.DELETE_CLUSTER_CONFIG_PATH), &raftmeta.DeleteClusterConfigReq{
+		Key: ctx.Args().Get(0),
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func configKeys(ctx *cli.Context) error {
+	color.Set(color.Bold)
+	color.Yellow("Cluster Config Keys:\n")
+	for _, k := range imeta.ClusterConfigKeys() {
+		fmt.Print(util.PadRight(k.Name, 30), util.PadRight(strings.ToUpper(k.Kind), 10), k.Usage, "\n")
+	}
+	return nil
+}
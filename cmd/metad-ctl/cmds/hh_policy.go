@@ -0,0 +1,127 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func HintedHandoffPolicyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "hh-policy",
+		Usage: "Maintain whether failed writes of databases are queued by hinted handoff",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "show",
+				Usage:  "Show hinted handoff policies, databases not listed are queued",
+				Action: hintedHandoffPolicyShow,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "enable",
+				Usage:       "Queue failed writes of a database or retention policy",
+				Description: "The policy of a retention policy wins over the one of its database.",
+				ArgsUsage:   "<database> [retention-policy]",
+				Action:      hintedHandoffPolicyEnable,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "disable",
+				Usage:       "Reject failed writes of a database or retention policy at once",
+				Description: "The policy of a retention policy wins over the one of its database.",
+				ArgsUsage:   "<database> [retention-policy]",
+				Action:      hintedHandoffPolicyDisable,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:      "unset",
+				Usage:     "Remove the policy of a database or retention policy",
+				ArgsUsage: "<database> [retention-policy]",
+				Action:    hintedHandoffPolicyUnset,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func hintedHandoffPolicyShow(ctx *cli.Context) (err error) {
+	resp := &raftmeta.HintedHandoffPoliciesResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.HINTED_HANDOFF_POLICIES_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Hinted Handoff Policies:\n")
+	for _, p := range resp.Policies {
+		rp := p.RetentionPolicy
+		if rp == "" {
+			rp = "*"
+		}
+		state := "enabled"
+		if !p.Enabled {
+			state = "disabled"
+		}
+		fmt.Print(util.PadRight(p.Database, 30), util.PadRight(rp, 30), state, "\n")
+	}
+	return nil
+}
+
+func setHintedHandoffPolicy(ctx *cli.Context, enabled bool) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify database")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.SET_HINTED_HANDOFF_POLICY_PATH), &raftmeta.SetHintedHandoffPolicyReq{
+		Policy: imeta.HintedHandoffPolicy{
+			Database:        ctx.Args().Get(0),
+			RetentionPolicy: ctx.Args().Get(1),
+			Enabled:         enabled,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func hintedHandoffPolicyEnable(ctx *cli.Context) error {
+	return setHintedHandoffPolicy(ctx, true)
+}
+
+func hintedHandoffPolicyDisable(ctx *cli.Context) error {
+	return setHintedHandoffPolicy(ctx, false)
+}
+
+func hintedHandoffPolicyUnset(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify database")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.DELETE_HINTED_HANDOFF_POLICY_PATH), &raftmeta.DeleteHintedHandoffPolicyReq{
+		Database:        ctx.Args().Get(0),
+		RetentionPolicy: ctx.Args().Get(1),
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
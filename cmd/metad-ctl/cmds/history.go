@@ -0,0 +1,93 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func HistoryCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Usage: "View past versions of meta data",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "at",
+				Usage:       "Show data nodes and shard owners as they were at a meta data index",
+				Description: "Versions are kept by each meta node for the latest data-history-size indexes, ask the node of -metad.",
+				ArgsUsage:   "<index> [database]",
+				Action:      historyAt,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func historyAt(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Usage: metad-ctl history at <index> [database]")
+	}
+	index, err := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	if err != nil {
+		return err
+	}
+	database := ctx.Args().Get(1)
+
+	resp := &raftmeta.DataResp{}
+	body, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.DATA_AT_PATH, "?index=", index))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(body, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	var data imeta.Data
+	if err = data.UnmarshalBinary(resp.Data); err != nil {
+		return err
+	}
+
+	fmt.Println("Index:", data.Index)
+	fmt.Println()
+	color.Set(color.Bold)
+	color.Yellow("Data Nodes:\n")
+	for _, n := range data.DataNodes {
+		fmt.Print(util.PadRight(fmt.Sprint(n.ID), 8), util.PadRight(n.Host, 23), n.TCPHost, "\n")
+	}
+	fmt.Println()
+
+	color.Set(color.Bold)
+	color.Yellow("Shard Groups:\n")
+	for _, db := range data.Databases {
+		if database != "" && db.Name != database {
+			continue
+		}
+		for _, rp := range db.RetentionPolicies {
+			for _, g := range rp.ShardGroups {
+				if g.Deleted() {
+					continue
+				}
+				fmt.Print(util.PadRight(fmt.Sprint(g.ID), 8), util.PadRight(fmt.Sprint(db.Name, "/", rp.Name), 30),
+					g.StartTime.Format(time.RFC3339), " - ", g.EndTime.Format(time.RFC3339), "\n")
+				for _, sh := range g.Shards {
+					owners := make([]uint64, 0, len(sh.Owners))
+					for _, o := range sh.Owners {
+						owners = append(owners, o.NodeID)
+					}
+					fmt.Print("        shard ", util.PadRight(fmt.Sprint(sh.ID), 8), "owners ", owners, "\n")
+				}
+			}
+		}
+	}
+	return nil
+}
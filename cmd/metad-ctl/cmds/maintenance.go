@@ -0,0 +1,169 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func MaintenanceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "maintenance",
+		Usage: "Schedule maintenance windows of data nodes",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "show",
+				Usage:  "Show maintenance windows not ended",
+				Action: maintenanceShow,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:  "create",
+				Usage: "Schedule a maintenance window",
+				Description: "Nodes in an open window are not reported unhealthy and not caught up. " +
+					"Behavior drain also drains reads of queries on the nodes, exclude-reads plans reads on other owners.",
+				Action: maintenanceCreate,
+				Flags: []cli.Flag{
+					FLAG_ADDR,
+					&cli.StringFlag{
+						Name:     "nodes",
+						Required: true,
+						Usage:    "Comma separated ids of data nodes",
+					},
+					&cli.StringFlag{
+						Name:  "start",
+						Usage: "Start of the window in RFC3339, now if not given",
+					},
+					&cli.DurationFlag{
+						Name:     "duration",
+						Required: true,
+						Usage:    "How long the window lasts, e.g. 2h",
+					},
+					&cli.StringFlag{
+						Name:  "behavior",
+						Value: imeta.MaintenanceFreeze,
+						Usage: "freeze, drain or exclude-reads",
+					},
+					&cli.StringFlag{
+						Name:  "reason",
+						Usage: "Why the nodes are maintained",
+					},
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete a maintenance window, ending it if open",
+				ArgsUsage: "<window-id>",
+				Action:    maintenanceDelete,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func maintenanceShow(ctx *cli.Context) (err error) {
+	resp := &raftmeta.MaintenanceWindowsResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.MAINTENANCE_WINDOWS_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	now := time.Now()
+	color.Set(color.Bold)
+	color.Yellow("Maintenance Windows:\n")
+	for _, w := range resp.Windows {
+		if !now.Before(w.End()) {
+			continue
+		}
+		nodes := make([]string, len(w.Nodes))
+		for i, id := range w.Nodes {
+			nodes[i] = strconv.FormatUint(id, 10)
+		}
+		state := "scheduled"
+		if w.Active(now) {
+			state = "open"
+		}
+		fmt.Print(
+			util.PadRight(fmt.Sprint(w.ID), 6),
+			util.PadRight(strings.Join(nodes, ","), 20),
+			util.PadRight(w.Start.Local().Format(time.RFC3339), 28),
+			util.PadRight(w.Duration.String(), 12),
+			util.PadRight(w.Behavior, 16),
+			util.PadRight(state, 12),
+			w.Reason, "\n")
+	}
+	return nil
+}
+
+func maintenanceCreate(ctx *cli.Context) (err error) {
+	w := imeta.MaintenanceWindow{
+		Duration: ctx.Duration("duration"),
+		Behavior: ctx.String("behavior"),
+		Reason:   ctx.String("reason"),
+	}
+	for _, arg := range strings.Split(ctx.String("nodes"), ",") {
+		id, err := parseNodeId(strings.TrimSpace(arg))
+		if err != nil {
+			return err
+		}
+		w.Nodes = append(w.Nodes, id)
+	}
+	if start := ctx.String("start"); start != "" {
+		if w.Start, err = time.Parse(time.RFC3339, start); err != nil {
+			return err
+		}
+		w.Start = w.Start.UTC()
+	}
+
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.CREATE_MAINTENANCE_WINDOW_PATH), &raftmeta.CreateMaintenanceWindowReq{
+		Window: w,
+	})
+	if err != nil {
+		return err
+	}
+	resp := &raftmeta.CreateMaintenanceWindowResp{}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	color.Green("Success, window %d\n", resp.Window.ID)
+	return nil
+}
+
+func maintenanceDelete(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify window id")
+	}
+	id, err := strconv.ParseUint(ctx.Args().First(), 10, 64)
+	if err != nil {
+		return err
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.DELETE_MAINTENANCE_WINDOW_PATH), &raftmeta.DeleteMaintenanceWindowReq{
+		ID: id,
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
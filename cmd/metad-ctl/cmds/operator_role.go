@@ -0,0 +1,90 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func OperatorRoleCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "operator-role",
+		Usage: "Maintain roles of users on the controller API",
+		Description: fmt.Sprint(
+			"Viewers can read status of the cluster, operators can also move shards and freeze nodes,\n",
+			"   only admins can delete nodes or drop databases. Admin users have all roles.",
+		),
+		Subcommands: []*cli.Command{
+			{
+				Name:      "show",
+				Usage:     "Show operator roles, of user if specified",
+				ArgsUsage: "[user]",
+				Action:    operatorRoleShow,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "set",
+				Usage:       "Assign or revoke operator role of user",
+				Description: "Role is one of viewer, operator, admin and none. none revokes the role.",
+				ArgsUsage:   "<user> <role>",
+				Action:      operatorRoleSet,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func operatorRoleShow(ctx *cli.Context) (err error) {
+	resp := &raftmeta.OperatorRolesResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.OPERATOR_ROLES_PATH, "?user=", url.QueryEscape(ctx.Args().First())))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	users := make([]string, 0, len(resp.Roles))
+	for name := range resp.Roles {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+	for _, name := range users {
+		fmt.Print(util.PadRight(name, 30), resp.Roles[name], "\n")
+	}
+	return nil
+}
+
+func operatorRoleSet(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 2 {
+		return errors.New("Please specify user and role")
+	}
+	role, err := imeta.ParseOperatorRole(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.SET_OPERATOR_ROLE_PATH), &raftmeta.SetOperatorRoleReq{
+		UserName: ctx.Args().Get(0),
+		Role:     role,
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
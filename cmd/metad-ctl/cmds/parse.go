@@ -3,10 +3,10 @@ package cmds
 import (
 	"encoding/json"
 	"errors"
-	"strconv"
 	"strings"
 
 	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/urfave/cli/v2"
 )
 
@@ -28,7 +28,7 @@ func parseNodeAddr(arg string) (string, error) {
 }
 
 func parseNodeId(arg string) (uint64, error) {
-	id, err := strconv.ParseUint(arg, 10, 64)
+	id, err := imeta.ParseNodeID(arg)
 	if err != nil {
 		return 0, err
 	}
@@ -36,7 +36,7 @@ func parseNodeId(arg string) (uint64, error) {
 		err = errors.New("Node id should be positive")
 		return 0, err
 	}
-	return id, nil
+	return uint64(id), nil
 }
 
 func parseNodeIdAndAddr(arg0, arg1 string) (id uint64, addr string, err error) {
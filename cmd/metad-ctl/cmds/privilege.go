@@ -0,0 +1,93 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func MeasurementPrivilegeCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "measurement-grant",
+		Usage: "Maintain privileges scoped to measurements",
+		Description: fmt.Sprint(
+			"A user granted on measurements of a database can only access measurements matching\n",
+			"   the patterns there, patterns are like cpu_* (see path.Match). Admin users are not restricted.",
+		),
+		Subcommands: []*cli.Command{
+			{
+				Name:      "show",
+				Usage:     "Show measurement privileges of user",
+				ArgsUsage: "<user>",
+				Action:    measurementPrivilegeShow,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "set",
+				Usage:       "Grant or revoke privilege on measurements",
+				Description: "Privilege is one of READ, WRITE, ALL and NONE. NONE revokes the grant of pattern.",
+				ArgsUsage:   "<user> <database> <pattern> <privilege>",
+				Action:      measurementPrivilegeSet,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func measurementPrivilegeShow(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify user")
+	}
+	resp := &raftmeta.MeasurementPrivilegesResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.MEASUREMENT_PRIVILEGES_PATH, "?user=", url.QueryEscape(ctx.Args().First())))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	for db, privs := range resp.Privileges {
+		color.Set(color.Bold)
+		color.Green(fmt.Sprint(db, ":\n"))
+		for _, p := range privs {
+			fmt.Print("  ", util.PadRight(p.Pattern, 30), p.Privilege, "\n")
+		}
+	}
+	return nil
+}
+
+func measurementPrivilegeSet(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 4 {
+		return errors.New("Please specify user, database, pattern and privilege")
+	}
+	p, err := imeta.ParsePrivilege(ctx.Args().Get(3))
+	if err != nil {
+		return err
+	}
+
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.SET_MEASUREMENT_PRIVILEGE_PATH), &raftmeta.SetMeasurementPrivilegeReq{
+		UserName:  ctx.Args().Get(0),
+		Database:  ctx.Args().Get(1),
+		Pattern:   ctx.Args().Get(2),
+		Privilege: p,
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
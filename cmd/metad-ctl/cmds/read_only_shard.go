@@ -0,0 +1,94 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func ReadOnlyShardCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "read-only-shard",
+		Usage: "Maintain shards rejecting writes, reads of them go on",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "show",
+				Usage:  "Show shards marked read-only",
+				Action: readOnlyShardShow,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "set",
+				Usage:       "Mark a shard read-only",
+				Description: "Writes to the shard are rejected by all data nodes, e.g. after archival or during forensic investigation.",
+				ArgsUsage:   "<shard-id>",
+				Action:      readOnlyShardSet,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:      "unset",
+				Usage:     "Make a shard writable again",
+				ArgsUsage: "<shard-id>",
+				Action:    readOnlyShardUnset,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func readOnlyShardShow(ctx *cli.Context) (err error) {
+	resp := &raftmeta.ReadOnlyShardsResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.READ_ONLY_SHARDS_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Read-only Shards:\n")
+	for _, id := range resp.ShardIDs {
+		fmt.Println(id)
+	}
+	return nil
+}
+
+func setShardReadOnly(ctx *cli.Context, readOnly bool) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify shard id")
+	}
+	id, err := imeta.ParseShardID(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.SET_SHARD_READ_ONLY_PATH), &raftmeta.SetShardReadOnlyReq{
+		ShardID:  uint64(id),
+		ReadOnly: readOnly,
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func readOnlyShardSet(ctx *cli.Context) error {
+	return setShardReadOnly(ctx, true)
+}
+
+func readOnlyShardUnset(ctx *cli.Context) error {
+	return setShardReadOnly(ctx, false)
+}
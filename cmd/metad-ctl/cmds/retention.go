@@ -0,0 +1,131 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/influxdata/influxql"
+	"github.com/urfave/cli/v2"
+)
+
+func RetentionCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "default-rp",
+		Usage: "Maintain the retention policy auto created for new databases",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "show",
+				Usage:  "Show current default retention policy",
+				Action: defaultRetentionPolicyShow,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "set",
+				Usage:       "Set default retention policy",
+				Description: "Databases created afterwards get the retention policy, existing ones are untouched.\n   Durations are in influxql format like 7d or 1h, 0 for infinite.",
+				ArgsUsage:   "<name> <duration> <shard-group-duration> <replica>",
+				Action:      defaultRetentionPolicySet,
+				Flags: []cli.Flag{
+					FLAG_ADDR,
+					&cli.StringFlag{Name: "align", Usage: "Align shard groups to day or week"},
+				},
+			},
+			{
+				Name:   "reset",
+				Usage:  "Restore the builtin default retention policy",
+				Action: defaultRetentionPolicyReset,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func parseRetentionDuration(arg string) (time.Duration, error) {
+	if arg == "0" {
+		return 0, nil
+	}
+	return influxql.ParseDuration(arg)
+}
+
+func defaultRetentionPolicyShow(ctx *cli.Context) (err error) {
+	resp := &raftmeta.DefaultRetentionPolicyResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.DEFAULT_RETENTION_POLICY_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	if resp.Template == nil {
+		color.Yellow("Builtin default retention policy is used\n")
+		return nil
+	}
+	rpi := resp.Template.RetentionPolicyInfo()
+	color.Set(color.Bold)
+	fmt.Println(color.GreenString("Name:"), rpi.Name)
+	color.Set(color.Bold)
+	fmt.Println(color.GreenString("Duration:"), rpi.Duration)
+	color.Set(color.Bold)
+	fmt.Println(color.GreenString("Shard Group Duration:"), rpi.ShardGroupDuration)
+	color.Set(color.Bold)
+	fmt.Println(color.GreenString("Replica:"), rpi.ReplicaN)
+	if resp.Template.ShardGroupAlignment != imeta.AlignEpoch {
+		color.Set(color.Bold)
+		fmt.Println(color.GreenString("Shard Group Alignment:"), resp.Template.ShardGroupAlignment)
+	}
+	return nil
+}
+
+func setDefaultRetentionPolicy(t *imeta.RetentionPolicyTemplate) error {
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.SET_DEFAULT_RETENTION_POLICY_PATH), &raftmeta.SetDefaultRetentionPolicyReq{
+		Template: t,
+	})
+	if err != nil {
+		return err
+	}
+	return processResponse(data)
+}
+
+func defaultRetentionPolicySet(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 4 {
+		return errors.New("Please specify name, duration, shard group duration and replica")
+	}
+	t := &imeta.RetentionPolicyTemplate{Name: ctx.Args().Get(0), ShardGroupAlignment: ctx.String("align")}
+	if t.Duration, err = parseRetentionDuration(ctx.Args().Get(1)); err != nil {
+		return err
+	}
+	if t.ShardGroupDuration, err = parseRetentionDuration(ctx.Args().Get(2)); err != nil {
+		return err
+	}
+	if t.ReplicaN, err = strconv.Atoi(ctx.Args().Get(3)); err != nil {
+		return err
+	}
+	if err = t.Validate(); err != nil {
+		return err
+	}
+
+	if err = setDefaultRetentionPolicy(t); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func defaultRetentionPolicyReset(ctx *cli.Context) (err error) {
+	if err = setDefaultRetentionPolicy(nil); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
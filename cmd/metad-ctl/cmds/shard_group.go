@@ -0,0 +1,290 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func ShardGroupCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "shard-group",
+		Usage: "Run maintenance of shard groups on demand",
+		Subcommands: []*cli.Command{
+			{
+				Name:        "precreate",
+				Usage:       "Precreate shard groups following the last ones ending within a horizon",
+				Description: "Useful right before bulk backfills, groups are created once for all nodes.",
+				Action:      shardGroupPrecreate,
+				Flags: []cli.Flag{
+					FLAG_ADDR,
+					&cli.DurationFlag{Name: "ahead", Value: 24 * time.Hour, Usage: "Horizon from now the last groups ending within are followed"},
+				},
+			},
+			{
+				Name:        "create-range",
+				Usage:       "Create all shard groups missing to cover a range in one commit",
+				Description: "Useful right before backfills of history, times are RFC3339, the end is exclusive.",
+				ArgsUsage:   "<database> <retention-policy> <start> <end>",
+				Action:      shardGroupCreateRange,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "preview",
+				Usage:       "Preview owners of shards of the group for a time, now if not given",
+				Description: "Shards of a group not created yet are placed on current nodes without creating it, the time is RFC3339.",
+				ArgsUsage:   "<database> <retention-policy> [time]",
+				Action:      shardGroupPreview,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "prune",
+				Usage:       "Prune shard groups deleted before a horizon",
+				Description: "Useful right after mass deletions, pruned groups are archived by meta nodes with archive-dir set.",
+				Action:      shardGroupPrune,
+				Flags: []cli.Flag{
+					FLAG_ADDR,
+					&cli.DurationFlag{Name: "deleted-before", Value: -imeta.SHARDGROUP_INFO_EVICTION, Usage: "Horizon before now groups deleted are pruned"},
+				},
+			},
+			{
+				Name:   "alignments",
+				Usage:  "Show retention policies with shard groups aligned to calendar units",
+				Action: shardGroupAlignments,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:  "align",
+				Usage: "Align shard groups of a retention policy to midnight UTC or Monday",
+				Description: fmt.Sprint(
+					"Groups created afterwards start at each day or week and don't span two, existing ones are untouched.\n",
+					"   Groups longer than the unit last whole units. none restores epoch-relative groups.",
+				),
+				ArgsUsage: "<database> <retention-policy> <day|week|none>",
+				Action:    shardGroupAlign,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:   "sealed",
+				Usage:  "Show shards of sealed groups and checksums of their copies once verified",
+				Action: shardGroupSealed,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func shardGroupPrecreate(ctx *cli.Context) (err error) {
+	now := time.Now()
+	resp := &raftmeta.PrecreateShardGroupsResp{}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.PRECREATE_SHARD_GROUPS_PATH), &raftmeta.PrecreateShardGroupsReq{
+		From: now,
+		To:   now.Add(ctx.Duration("ahead")),
+	})
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	printAffectedShardGroups("Shard Groups Precreated:\n", resp.ShardGroups)
+	return nil
+}
+
+func shardGroupCreateRange(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 4 {
+		return errors.New("Please specify database, retention policy, start and end")
+	}
+	start, err := time.Parse(time.RFC3339, ctx.Args().Get(2))
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(time.RFC3339, ctx.Args().Get(3))
+	if err != nil {
+		return err
+	}
+
+	resp := &raftmeta.CreateShardGroupsForRangeResp{}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.CREATE_SHARD_GROUPS_FOR_RANGE_PATH), &raftmeta.CreateShardGroupsForRangeReq{
+		Database: ctx.Args().Get(0),
+		Policy:   ctx.Args().Get(1),
+		Start:    start,
+		End:      end,
+	})
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	groups := make([]imeta.AffectedShardGroup, 0, len(resp.ShardGroups))
+	for _, sg := range resp.ShardGroups {
+		groups = append(groups, imeta.AffectedShardGroup{
+			Database:        ctx.Args().Get(0),
+			RetentionPolicy: ctx.Args().Get(1),
+			ShardGroupInfo:  sg,
+		})
+	}
+	printAffectedShardGroups("Shard Groups Created:\n", groups)
+	return nil
+}
+
+func shardGroupPreview(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 2 {
+		return errors.New("Please specify database and retention policy")
+	}
+	resp := &raftmeta.PreviewShardOwnersResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.PREVIEW_SHARD_OWNERS_PATH,
+		"?db=", url.QueryEscape(ctx.Args().Get(0)), "&rp=", url.QueryEscape(ctx.Args().Get(1)),
+		"&time=", url.QueryEscape(ctx.Args().Get(2))))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Shard Owners:\n")
+	shards := make(map[uint64]int)
+	for _, sh := range resp.Shards {
+		owners := make([]uint64, 0, len(sh.Owners))
+		for _, o := range sh.Owners {
+			owners = append(owners, o.NodeID)
+			shards[o.NodeID]++
+		}
+		fmt.Print("shard ", util.PadRight(fmt.Sprint(sh.ID), 8), "owners ", owners, "\n")
+	}
+	color.Set(color.Bold)
+	color.Yellow("Shards by Node:\n")
+	ids := make([]uint64, 0, len(shards))
+	for id := range shards {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		fmt.Print("node ", util.PadRight(fmt.Sprint(id), 8), shards[id], "\n")
+	}
+	return nil
+}
+
+func shardGroupPrune(ctx *cli.Context) (err error) {
+	resp := &raftmeta.PruneShardGroupsResp{}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.PRUNE_SHARD_GROUPS_PATH), &raftmeta.PruneShardGroupsReq{
+		Expiration: time.Now().Add(-ctx.Duration("deleted-before")),
+	})
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	printAffectedShardGroups("Shard Groups Pruned:\n", resp.ShardGroups)
+	return nil
+}
+
+func shardGroupAlignments(ctx *cli.Context) (err error) {
+	resp := &raftmeta.ShardGroupAlignmentsResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.SHARD_GROUP_ALIGNMENTS_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Shard Group Alignments:\n")
+	for _, a := range resp.Alignments {
+		fmt.Print(util.PadRight(a.Database, 30), util.PadRight(a.RetentionPolicy, 30), a.Unit, "\n")
+	}
+	return nil
+}
+
+func shardGroupAlign(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 3 {
+		return errors.New("Please specify database, retention policy and unit")
+	}
+	unit := ctx.Args().Get(2)
+	if unit == "none" {
+		unit = imeta.AlignEpoch
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.SET_SHARD_GROUP_ALIGNMENT_PATH), &raftmeta.SetShardGroupAlignmentReq{
+		Database:        ctx.Args().Get(0),
+		RetentionPolicy: ctx.Args().Get(1),
+		Unit:            unit,
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func shardGroupSealed(ctx *cli.Context) (err error) {
+	resp := &raftmeta.SealedShardsResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.SEALED_SHARDS_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Sealed Shards:\n")
+	for _, s := range resp.Shards {
+		verified := "not verified"
+		if s.Verified() {
+			verified = fmt.Sprintf("checksum %08x at %s", s.Checksum, s.VerifiedAt.Format(time.RFC3339))
+			if s.Diverged {
+				verified = color.RedString("diverged, %s", verified)
+			}
+		}
+		fmt.Print(util.PadRight(fmt.Sprint(s.ShardID), 8), util.PadRight(fmt.Sprint("group ", s.ShardGroupID), 16),
+			util.PadRight(s.SealedAt.Format(time.RFC3339), 24), verified, "\n")
+	}
+	return nil
+}
+
+func printAffectedShardGroups(title string, groups []imeta.AffectedShardGroup) {
+	color.Set(color.Bold)
+	color.Yellow(title)
+	for _, g := range groups {
+		fmt.Print(util.PadRight(fmt.Sprint(g.ID), 8), util.PadRight(fmt.Sprint(g.Database, "/", g.RetentionPolicy), 30),
+			g.StartTime.Format(time.RFC3339), " - ", g.EndTime.Format(time.RFC3339), "\n")
+	}
+}
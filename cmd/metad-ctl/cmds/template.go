@@ -0,0 +1,150 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func TemplateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "db-template",
+		Usage: "Maintain database templates",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List database templates",
+				Action: templateList,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:  "create",
+				Usage: "Create a database template from json file",
+				Description: fmt.Sprint(
+					"The file holds a json object with Name, DefaultRetentionPolicy, RetentionPolicies,\n",
+					"   ContinuousQueries, Subscriptions and Grants. `", imeta.TemplateDatabasePlaceholder, "` in queries of\n",
+					"   continuous queries is replaced by the database created.",
+				),
+				ArgsUsage: "<template.json>",
+				Action:    templateCreate,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:      "drop",
+				Usage:     "Drop a database template",
+				ArgsUsage: "<template>",
+				Action:    templateDrop,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:      "apply",
+				Usage:     "Create a database from template",
+				ArgsUsage: "<database> <template>",
+				Action:    templateApply,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func templateList(ctx *cli.Context) (err error) {
+	resp := &raftmeta.DatabaseTemplatesResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.DATABASE_TEMPLATES_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	for _, t := range resp.Templates {
+		color.Set(color.Bold)
+		color.Green(fmt.Sprint(t.Name, ":\n"))
+		for _, rp := range t.RetentionPolicies {
+			fmt.Print("  rp\t", rp.Name, "\t", rp.Duration, "\t", rp.ShardGroupDuration, "\t", rp.ReplicaN, "\t", rp.ShardGroupAlignment, "\n")
+		}
+		for _, cq := range t.ContinuousQueries {
+			fmt.Print("  cq\t", cq.Name, "\t", cq.Query, "\n")
+		}
+		for _, sub := range t.Subscriptions {
+			fmt.Print("  sub\t", sub.Name, "\t", sub.RetentionPolicy, "\t", sub.Mode, "\t", sub.Destinations, "\n")
+		}
+		for _, g := range t.Grants {
+			fmt.Print("  grant\t", g.User, "\t", g.Privilege, "\n")
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func templateCreate(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify template file")
+	}
+	content, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	var req raftmeta.CreateDatabaseTemplateReq
+	if err = json.Unmarshal(content, &req.Template); err != nil {
+		return err
+	}
+	if err = req.Template.Validate(); err != nil {
+		return err
+	}
+
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.CREATE_DATABASE_TEMPLATE_PATH), &req)
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func templateDrop(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify template")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.DROP_DATABASE_TEMPLATE_PATH), &raftmeta.DropDatabaseTemplateReq{
+		Name: ctx.Args().First(),
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func templateApply(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 2 {
+		return errors.New("Please specify database and template")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.CREATE_DATABASE_FROM_TEMPLATE_PATH), &raftmeta.CreateDatabaseFromTemplateReq{
+		Name:     ctx.Args().Get(0),
+		Template: ctx.Args().Get(1),
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
@@ -0,0 +1,204 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func TokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "token",
+		Usage: "Maintain api tokens used as `Authorization: Token <token>` by InfluxDB 2.x clients",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "list",
+				Usage:     "List api tokens of all users or the specified one",
+				ArgsUsage: "[user]",
+				Action:    tokenList,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "create",
+				Usage:       "Create an api token of user",
+				Description: "The token is only printed here, it can't be shown again.",
+				ArgsUsage:   "<user> [description]",
+				Action:      tokenCreate,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:      "drop",
+				Usage:     "Drop an api token",
+				ArgsUsage: "<id>",
+				Action:    tokenDrop,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func BucketCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "bucket",
+		Usage: "Maintain mappings of org/bucket in /api/v2/write to database/retention-policy",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List bucket mappings",
+				Action: bucketList,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:        "set",
+				Usage:       "Map a bucket of org to database and retention policy",
+				Description: "Empty org (\"\") matches buckets of any org, empty retention policy means the default one.",
+				ArgsUsage:   "<org> <bucket> <database> [retention-policy]",
+				Action:      bucketSet,
+				Flags:       []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:      "drop",
+				Usage:     "Drop a bucket mapping",
+				ArgsUsage: "<org> <bucket>",
+				Action:    bucketDrop,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func tokenList(ctx *cli.Context) (err error) {
+	resp := &raftmeta.APITokensResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.API_TOKENS_PATH, "?user=", url.QueryEscape(ctx.Args().First())))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("API Tokens:\n")
+	for _, t := range resp.Tokens {
+		fmt.Print(util.PadRight(fmt.Sprint(t.ID), 8), util.PadRight(t.User, 20), util.PadRight(t.CreatedAt.Format(time.RFC3339), 28), t.Description, "\n")
+	}
+	return nil
+}
+
+func tokenCreate(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify user")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.CREATE_API_TOKEN_PATH), &raftmeta.CreateAPITokenReq{
+		UserName:    ctx.Args().First(),
+		Description: strings.Join(ctx.Args().Tail(), " "),
+	})
+	if err != nil {
+		return err
+	}
+	resp := &raftmeta.CreateAPITokenResp{}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	color.Green(fmt.Sprint("Token ", resp.Info.ID, " created:"))
+	fmt.Println(resp.Token)
+	return nil
+}
+
+func tokenDrop(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify token id")
+	}
+	id, err := strconv.ParseUint(ctx.Args().First(), 10, 64)
+	if err != nil {
+		return err
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.DROP_API_TOKEN_PATH), &raftmeta.DropAPITokenReq{
+		ID: id,
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func bucketList(ctx *cli.Context) (err error) {
+	resp := &raftmeta.BucketMappingsResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.BUCKET_MAPPINGS_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Bucket Mappings:\n")
+	for _, m := range resp.Mappings {
+		fmt.Print(util.PadRight(fmt.Sprint(m.Org, "/", m.Bucket), 40), "=> ", m.Database, "/", m.RetentionPolicy, "\n")
+	}
+	return nil
+}
+
+func bucketSet(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 3 {
+		return errors.New("Please specify org, bucket and database")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.SET_BUCKET_MAPPING_PATH), &raftmeta.SetBucketMappingReq{
+		Mapping: imeta.BucketMapping{
+			Org:             ctx.Args().Get(0),
+			Bucket:          ctx.Args().Get(1),
+			Database:        ctx.Args().Get(2),
+			RetentionPolicy: ctx.Args().Get(3),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func bucketDrop(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 2 {
+		return errors.New("Please specify org and bucket")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.DROP_BUCKET_MAPPING_PATH), &raftmeta.DropBucketMappingReq{
+		Org:    ctx.Args().Get(0),
+		Bucket: ctx.Args().Get(1),
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
@@ -0,0 +1,148 @@
+package cmds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/angopher/chronus/cmd/metad-ctl/util"
+	"github.com/angopher/chronus/raftmeta"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+func UserCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "user",
+		Usage: "Maintain users locked because of failed authentications, export and import users",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "locked",
+				Usage:  "List locked users",
+				Action: userLocked,
+				Flags:  []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:      "unlock",
+				Usage:     "Unlock a user and clear its failed authentications",
+				ArgsUsage: "<user>",
+				Action:    userUnlock,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:  "export",
+				Usage: "Export users with their grants and password hashes as json",
+				Description: fmt.Sprint(
+					"Writes all users along with privileges on databases and measurements to the file,\n",
+					"   or stdout if not specified. Keep the file safe as it holds password hashes.",
+				),
+				ArgsUsage: "[users.json]",
+				Action:    userExport,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+			{
+				Name:  "import",
+				Usage: "Import users with their grants from json file exported",
+				Description: fmt.Sprint(
+					"Creates users of the file in one commit, users existing already are replaced\n",
+					"   along with their grants, other users are left as they are.",
+				),
+				ArgsUsage: "<users.json>",
+				Action:    userImport,
+				Flags:     []cli.Flag{FLAG_ADDR},
+			},
+		},
+	}
+}
+
+func userLocked(ctx *cli.Context) (err error) {
+	resp := &raftmeta.LockedUsersResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.LOCKED_USERS_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	color.Set(color.Bold)
+	color.Yellow("Locked Users:\n")
+	for _, u := range resp.Users {
+		fmt.Print(util.PadRight(u.Name, 30), "until ", u.LockedUntil.Format(time.RFC3339), "\n")
+	}
+	return nil
+}
+
+func userUnlock(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify user")
+	}
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.UNLOCK_USER_PATH), &raftmeta.UnlockUserReq{
+		UserName: ctx.Args().First(),
+	})
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
+
+func userExport(ctx *cli.Context) (err error) {
+	resp := &raftmeta.ExportUsersResp{}
+	data, err := util.GetRequest(fmt.Sprint("http://", MetadAddress, raftmeta.EXPORT_USERS_PATH))
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, resp); err != nil {
+		return err
+	}
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	content, err := json.MarshalIndent(resp.Users, "", "  ")
+	if err != nil {
+		return err
+	}
+	if ctx.Args().Len() < 1 {
+		fmt.Println(string(content))
+		return nil
+	}
+	if err = ioutil.WriteFile(ctx.Args().First(), content, 0600); err != nil {
+		return err
+	}
+	color.Green("Exported %d users", len(resp.Users.Users))
+	return nil
+}
+
+func userImport(ctx *cli.Context) (err error) {
+	if ctx.Args().Len() < 1 {
+		return errors.New("Please specify users file")
+	}
+	content, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	var req raftmeta.ImportUsersReq
+	if err = json.Unmarshal(content, &req.Users); err != nil {
+		return err
+	}
+
+	data, err := util.PostRequestJSON(fmt.Sprint("http://", MetadAddress, raftmeta.IMPORT_USERS_PATH), &req)
+	if err != nil {
+		return err
+	}
+	if err = processResponse(data); err != nil {
+		return err
+	}
+	color.Green("Success")
+	return nil
+}
@@ -27,6 +27,21 @@ func main() {
 		cmds.UpdateCommand(),
 		cmds.RemoveCommand(),
 		cmds.StorageCommand(),
+		cmds.RetentionCommand(),
+		cmds.TemplateCommand(),
+		cmds.MeasurementPrivilegeCommand(),
+		cmds.OperatorRoleCommand(),
+		cmds.UserCommand(),
+		cmds.TokenCommand(),
+		cmds.BucketCommand(),
+		cmds.ArchiveCommand(),
+		cmds.HistoryCommand(),
+		cmds.ShardGroupCommand(),
+		cmds.ConfigCommand(),
+		cmds.HintedHandoffPolicyCommand(),
+		cmds.ReadOnlyShardCommand(),
+		cmds.MaintenanceCommand(),
+		cmds.BenchCommand(),
 	}
 	app.Run(os.Args)
 }
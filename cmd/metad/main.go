@@ -4,10 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/angopher/chronus/logging"
 	"github.com/angopher/chronus/raftmeta"
+	"github.com/angopher/chronus/services/events"
 	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/angopher/chronus/x"
 	"github.com/influxdata/influxdb/services/meta"
@@ -56,6 +58,8 @@ func main() {
 	suger.Debug("config: %+v", config)
 
 	metaCli.WithLogger(log)
+	metaCli.SetArchiveDir(config.ArchiveDir)
+	metaCli.SetDataHistorySize(config.DataHistorySize)
 	err = metaCli.Open()
 	x.Check(err)
 
@@ -102,7 +106,18 @@ func main() {
 	go linearRead.ReadLoop()
 
 	service := raftmeta.NewMetaService(config.MyAddr, metaCli, node, linearRead)
+	service.Lockout = imeta.LockoutPolicy{
+		Attempts:      config.AuthLockoutAttempts,
+		AdminAttempts: config.AuthLockoutAdminAttempts,
+		Window:        time.Duration(config.AuthLockoutWindowSec) * time.Second,
+		Duration:      time.Duration(config.AuthLockoutDurationSec) * time.Second,
+	}
+	service.Hasher, err = imeta.NewPasswordHasher(config.PasswordHash)
+	x.Check(err)
+	service.Events, err = events.NewBus(config.Events, config.MyAddr, log)
+	x.Check(err)
 	service.InitRouter()
 	service.WithLogger(log)
+	go service.PruneSessions(time.Minute)
 	service.Start()
 }
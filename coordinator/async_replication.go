@@ -0,0 +1,93 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/logging"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// replicateAsync returns whether points of shard are written to one owner and
+// queued for the others. Writes of consistency QUORUM and ALL, and of
+// retention policies not queued by hinted handoff, are replicated at once.
+func (w *PointsWriter) replicateAsync(shard *meta.ShardInfo, database, retentionPolicy string, consistency models.ConsistencyLevel) bool {
+	if !w.AsyncReplication || len(shard.Owners) < 2 {
+		return false
+	}
+	if consistency != models.ConsistencyLevelAny && consistency != models.ConsistencyLevelOne {
+		return false
+	}
+	return w.HintedHandoffPolicy == nil || w.HintedHandoffPolicy.HintedHandoffEnabled(database, retentionPolicy)
+}
+
+// writeToShardAsync writes points to one owner of shard, this node first if
+// owning it and the next owners while writes fail, and once written queues
+// them by hinted handoff for the owners left, which lag behind by their
+// queues. Owners failed are queued by writeToOwner if they may succeed later.
+// Owners not queued are reported by a partial write once all were tried, the
+// points being written already.
+func (w *PointsWriter) writeToShardAsync(ctx context.Context, shard *meta.ShardInfo, database, retentionPolicy string, consistency models.ConsistencyLevel, points []models.Point) error {
+	owners := make([]meta.ShardOwner, 0, len(shard.Owners))
+	for _, owner := range shard.Owners {
+		if owner.NodeID == w.Node.ID {
+			owners = append([]meta.ShardOwner{owner}, owners...)
+		} else {
+			owners = append(owners, owner)
+		}
+	}
+
+	written := -1
+	var writeError error
+	for i, owner := range owners {
+		err := w.writeToOwner(ctx, shard.ID, owner, database, retentionPolicy, consistency, points)
+		if err == nil {
+			written = i
+			break
+		}
+		atomic.AddInt64(&w.stats.WriteErr, 1)
+		w.Logger.Error("write failed",
+			zap.Error(err),
+			logging.ShardID(shard.ID),
+			logging.NodeID(owner.NodeID),
+			logging.IdempotencyKey(IdempotencyKey(ctx)))
+		if writeError == nil {
+			writeError = err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if written < 0 {
+		return fmt.Errorf("write failed: %v", writeError)
+	}
+	atomic.AddInt64(&w.stats.WriteOK, 1)
+
+	var hinted bool
+	var missed []uint64
+	for _, owner := range owners[written+1:] {
+		if err := w.HintedHandoff.WriteShard(imeta.ShardID(shard.ID), imeta.NodeID(owner.NodeID), points); err != nil {
+			w.Logger.Error("hinted handoff failed",
+				zap.Error(err),
+				logging.ShardID(shard.ID),
+				logging.NodeID(owner.NodeID))
+			missed = append(missed, owner.NodeID)
+			continue
+		}
+		hinted = true
+		atomic.AddInt64(&w.stats.WritePointReqAsync, int64(len(points)))
+	}
+	if hinted {
+		w.dbStats.addHinted(database, points)
+	}
+	if len(missed) > 0 {
+		atomic.AddInt64(&w.stats.WritePartial, 1)
+		return fmt.Errorf("%w: shard %d not queued for owners %v", ErrPartialWrite, shard.ID, missed)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package coordinator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+)
+
+// ErrCircuitOpen is returned when writes to a node are short-circuited after
+// consecutive failures.
+var ErrCircuitOpen = errs.ErrCircuitOpen
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// circuitBreaker tracks consecutive write failures for each node. After threshold
+// failures the node is skipped for cooldown, then a single probe is let through
+// to decide whether to close or reopen. A threshold less than 1 disables it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	nodes     map[uint64]*breakerState
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		nodes:     make(map[uint64]*breakerState),
+	}
+}
+
+// allow returns whether a write to node should be attempted
+func (b *circuitBreaker) allow(nodeID uint64, now time.Time) bool {
+	if b.threshold < 1 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st, ok := b.nodes[nodeID]
+	if !ok || st.failures < b.threshold {
+		return true
+	}
+	if now.Before(st.openUntil) || st.probing {
+		return false
+	}
+	// half open
+	st.probing = true
+	return true
+}
+
+// done records the result of a write to node
+func (b *circuitBreaker) done(nodeID uint64, failed bool, now time.Time) {
+	if b.threshold < 1 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		delete(b.nodes, nodeID)
+		return
+	}
+
+	st, ok := b.nodes[nodeID]
+	if !ok {
+		st = &breakerState{}
+		b.nodes[nodeID] = st
+	}
+	st.failures++
+	st.probing = false
+	if st.failures >= b.threshold {
+		st.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,44 @@
+package coordinator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := newCircuitBreaker(2, time.Minute)
+	now := time.Now()
+
+	assert.True(t, b.allow(1, now))
+	b.done(1, true, now)
+	assert.True(t, b.allow(1, now))
+	b.done(1, true, now)
+
+	// open
+	assert.False(t, b.allow(1, now))
+	assert.True(t, b.allow(2, now))
+
+	// half open, only one probe
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(1, now))
+	assert.False(t, b.allow(1, now))
+	b.done(1, true, now)
+	assert.False(t, b.allow(1, now))
+
+	// closed after a successful probe
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(1, now))
+	b.done(1, false, now)
+	assert.True(t, b.allow(1, now))
+	assert.True(t, b.allow(1, now))
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		b.done(1, true, time.Now())
+	}
+	assert.True(t, b.allow(1, time.Now()))
+}
@@ -0,0 +1,61 @@
+package coordinator
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// clockSkew returns the skew of the clock of a remote telling time remote in
+// a response to a request sent and received by the local clock, assuming the
+// remote read its clock halfway of the round trip.
+func clockSkew(sent, received, remote time.Time) time.Duration {
+	return remote.Sub(sent.Add(received.Sub(sent) / 2))
+}
+
+// skewTracker keeps the last and the max absolute skew of the clock of meta
+// servers observed by pings, warning of skews over max.
+type skewTracker struct {
+	last     int64 // nanoseconds, positive if meta servers are ahead
+	observed int64 // max absolute, nanoseconds
+
+	max     time.Duration
+	limiter *rate.Limiter
+}
+
+func newSkewTracker(max time.Duration) skewTracker {
+	// warn once a minute at most
+	return skewTracker{max: max, limiter: rate.NewLimiter(rate.Every(time.Minute), 1)}
+}
+
+// observe records a skew, returning whether it's over max.
+func (t *skewTracker) observe(skew time.Duration) bool {
+	atomic.StoreInt64(&t.last, int64(skew))
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	for {
+		observed := atomic.LoadInt64(&t.observed)
+		if int64(abs) <= observed || atomic.CompareAndSwapInt64(&t.observed, observed, int64(abs)) {
+			break
+		}
+	}
+	return t.max > 0 && abs > t.max
+}
+
+func (me *ClusterMetaClient) observeClockSkew(skew time.Duration) {
+	if me.skew.observe(skew) && me.skew.limiter.Allow() {
+		me.Logger.Warn("Clock skewed to meta servers over max-clock-skew, points near shard group boundaries may be misrouted",
+			zap.Duration("skew", skew),
+			zap.Duration("max", me.skew.max))
+	}
+}
+
+// ClockSkew returns the last skew of the clock of meta servers to the local
+// one, positive if they are ahead, and the max absolute skew observed.
+func (me *ClusterMetaClient) ClockSkew() (last, max time.Duration) {
+	return time.Duration(atomic.LoadInt64(&me.skew.last)), time.Duration(atomic.LoadInt64(&me.skew.observed))
+}
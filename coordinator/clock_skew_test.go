@@ -0,0 +1,25 @@
+package coordinator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockSkew(t *testing.T) {
+	sent := time.Unix(100, 0)
+	assert.Equal(t, 2*time.Second, clockSkew(sent, sent.Add(time.Second), sent.Add(2500*time.Millisecond)))
+	assert.Equal(t, -time.Second, clockSkew(sent, sent.Add(2*time.Second), sent))
+
+	tracker := newSkewTracker(time.Second)
+	assert.False(t, tracker.observe(500*time.Millisecond))
+	assert.True(t, tracker.observe(-2*time.Second))
+	assert.False(t, tracker.observe(100*time.Millisecond))
+	assert.Equal(t, int64(100*time.Millisecond), tracker.last)
+	assert.Equal(t, int64(2*time.Second), tracker.observed)
+
+	// disabled
+	tracker = newSkewTracker(0)
+	assert.False(t, tracker.observe(time.Hour))
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/influxdata/influxdb"
@@ -15,6 +17,16 @@ import (
 	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxql"
 	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/logging"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// The keys for statistics generated by the "cluster_executor" module.
+const (
+	statLocalityHit       = "localityHit"
+	statLocalityMiss      = "localityMiss"
+	statLocalityMissStale = "localityMissStale"
 )
 
 type ClusterExecutor struct {
@@ -25,13 +37,53 @@ type ClusterExecutor struct {
 		DataNode(nodeId uint64) (*meta.NodeInfo, error)
 		ShardOwner(id uint64) (string, string, *meta.ShardGroupInfo)
 		Database(name string) *meta.DatabaseInfo
+		ShardStale(id, nodeID uint64) bool
+		InMaintenance(nodeID uint64, now time.Time, behavior string) bool
+		CreateMeasurementTombstone(database, name string) (*imeta.MeasurementTombstone, error)
+		AckMeasurementTombstone(id, nodeID uint64) error
 	}
 
 	// TaskManager holds the StatementExecutor that handles task-related commands.
 	TaskManager query.StatementExecutor
 
+	// NodeStatements executes statements about this node alone, SHOW STATS
+	// and SHOW DIAGNOSTICS gathered across nodes by ExecuteNodeStatement.
+	NodeStatements query.StatementExecutor
+
 	RemoteNodeExecutor RemoteNodeExecutor
 	Logger             *zap.Logger
+
+	// MaxConcurrentShards and MaxConcurrentShardsPerNode limit shards of a
+	// query being opened at once on remote nodes, see DefaultMaxConcurrentShards.
+	MaxConcurrentShards        int
+	MaxConcurrentShardsPerNode int
+
+	stats ClusterExecutorStatistics
+}
+
+// ClusterExecutorStatistics keeps where shards of queries are read, on this
+// node or another owner.
+type ClusterExecutorStatistics struct {
+	// LocalityHit counts shards read by local iterators
+	LocalityHit int64
+	// LocalityMiss counts shards read from other nodes
+	LocalityMiss int64
+	// LocalityMissStale counts shards read from other nodes though owned by
+	// this node, whose copy is stale
+	LocalityMissStale int64
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (me *ClusterExecutor) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "cluster_executor",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statLocalityHit:       atomic.LoadInt64(&me.stats.LocalityHit),
+			statLocalityMiss:      atomic.LoadInt64(&me.stats.LocalityMiss),
+			statLocalityMissStale: atomic.LoadInt64(&me.stats.LocalityMissStale),
+		},
+	}}
 }
 
 func NewClusterExecutor(n *influxdb.Node, s TSDBStore, m MetaClient, pool *ClientPool, Config Config) *ClusterExecutor {
@@ -43,9 +95,12 @@ func NewClusterExecutor(n *influxdb.Node, s TSDBStore, m MetaClient, pool *Clien
 			ClientPool:         pool,
 			DailTimeout:        time.Duration(Config.DailTimeout),
 			ShardReaderTimeout: time.Duration(Config.ShardReaderTimeout),
+			QueryTimeout:       time.Duration(Config.QueryTimeout),
 			ClusterTracing:     Config.ClusterTracing,
 		},
-		Logger: zap.NewNop(),
+		Logger:                     zap.NewNop(),
+		MaxConcurrentShards:        Config.MaxConcurrentShards,
+		MaxConcurrentShardsPerNode: Config.MaxConcurrentShardsPerNode,
 	}
 	executor.RemoteNodeExecutor.WithLogger(executor.Logger)
 	return executor
@@ -160,6 +215,88 @@ LOOP:
 	return nil
 }
 
+// ExecuteNodeStatement executes stmt on every data node, returning the rows
+// of all nodes tagged by the node they come from (node_id), sorted by name
+// then node. Nodes failed are reported by warnings unless none succeeds.
+func (me *ClusterExecutor) ExecuteNodeStatement(stmt influxql.Statement) (models.Rows, []*query.Message, error) {
+	type Result struct {
+		rows models.Rows
+		err  error
+	}
+
+	nodeInfos, err := me.MetaClient.DataNodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes := toNodeIds(nodeInfos)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
+	results := make([]Result, len(nodes))
+	var wg sync.WaitGroup
+	for i, nodeId := range nodes {
+		wg.Add(1)
+		go func(i int, curNodeId uint64) {
+			defer wg.Done()
+
+			var err error
+			var qr *query.Result
+			if curNodeId == me.Node.ID {
+				recvCtx := &query.ExecutionContext{
+					Context: context.Background(),
+					Results: make(chan *query.Result, 1),
+				}
+				err = me.NodeStatements.ExecuteStatement(stmt, recvCtx)
+				if err == nil {
+					qr = <-recvCtx.Results
+				}
+			} else {
+				qr, err = me.RemoteNodeExecutor.NodeStatement(curNodeId, stmt)
+			}
+			if err == nil && qr.Err != nil {
+				err = qr.Err
+			}
+			if err != nil {
+				results[i] = Result{err: err}
+				return
+			}
+
+			node := strconv.FormatUint(curNodeId, 10)
+			for _, row := range qr.Series {
+				tags := make(map[string]string, len(row.Tags)+1)
+				for k, v := range row.Tags {
+					tags[k] = v
+				}
+				tags["node_id"] = node
+				row.Tags = tags
+			}
+			results[i] = Result{rows: qr.Series}
+		}(i, nodeId)
+	}
+	wg.Wait()
+
+	var (
+		rows     models.Rows
+		messages []*query.Message
+	)
+	for i, r := range results {
+		if r.err != nil {
+			err = r.err
+			messages = append(messages, &query.Message{
+				Level: query.WarningLevel,
+				Text:  fmt.Sprintf("node %d: %s", nodes[i], r.err),
+			})
+			continue
+		}
+		rows = append(rows, r.rows...)
+	}
+	if len(messages) == len(nodes) && err != nil {
+		return nil, nil, err
+	}
+	// rows of a name keep the order of nodes
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Name < rows[j].Name })
+	return rows, messages, nil
+}
+
 func (me *ClusterExecutor) SeriesCardinality(database string) (int64, error) {
 	type Result struct {
 		n   int64
@@ -197,7 +334,11 @@ func (me *ClusterExecutor) SeriesCardinality(database string) (int64, error) {
 
 	var sum int64
 	for _, r := range results {
-		if r.err != nil {
+		if r.err == ErrReadsDrained {
+			// estimated without series of nodes drained, like replicas
+			// counted more than once
+			continue
+		} else if r.err != nil {
 			return -1, r.err
 		}
 		sum += r.n
@@ -259,7 +400,10 @@ func (me *ClusterExecutor) MeasurementNames(auth query.Authorizer, database stri
 
 	uniq := make(map[string]struct{})
 	for _, r := range results {
-		if r.err != nil {
+		if r.err == ErrReadsDrained {
+			// names of shards replicated are given by other owners
+			continue
+		} else if r.err != nil {
 			return nil, r.err
 		}
 		for _, name := range r.names {
@@ -292,7 +436,7 @@ func (me *ClusterExecutor) TagValues(auth query.Authorizer, ids []uint64, cond i
 		return nil, err
 	}
 
-	n2s := PlanNodes(me.Node.ID, shards, nil)
+	n2s := me.planNodes(shards)
 
 	fn := func(nodeId uint64, shards []meta.ShardInfo) (result interface{}, err error) {
 		var tagValues []tsdb.TagValues
@@ -394,7 +538,9 @@ func (me *ClusterExecutor) CreateIterator(ctx context.Context, m *influxql.Measu
 		err  error
 	}
 
-	n2s := PlanNodes(me.Node.ID, shards, nil)
+	n2s := me.planNodes(shards)
+	me.countLocality(shards, n2s)
+	limiter := newFanoutLimiter(me.MaxConcurrentShards)
 
 	fn := func(nodeId uint64, shards []meta.ShardInfo) (result interface{}, err error) {
 		var iter query.Iterator
@@ -403,7 +549,7 @@ func (me *ClusterExecutor) CreateIterator(ctx context.Context, m *influxql.Measu
 			//localCtx only use for local node
 			iter, err = me.createLocalIteratorfunc(ctx, m, shardIDs, opt)
 		} else {
-			iter, err = me.RemoteNodeExecutor.CreateIterator(nodeId, ctx, m, opt, shardIDs)
+			iter, err = me.createRemoteIterator(ctx, limiter, nodeId, m, opt, shardIDs)
 		}
 
 		result = &Result{iter: iter, err: err}
@@ -450,6 +596,52 @@ func (me *ClusterExecutor) CreateIterator(ctx context.Context, m *influxql.Measu
 	return query.Iterators(inputs).Merge(opt)
 }
 
+// createRemoteIterator creates iterators of shards on node in chunks, so that
+// no more shards are opened at once than limited for the query.
+func (me *ClusterExecutor) createRemoteIterator(
+	ctx context.Context,
+	limiter *fanoutLimiter,
+	nodeId uint64,
+	m *influxql.Measurement,
+	opt query.IteratorOptions,
+	shardIDs []uint64,
+) (query.Iterator, error) {
+	size := limiter.chunk(len(shardIDs), me.MaxConcurrentShardsPerNode)
+	if size == len(shardIDs) {
+		release, err := limiter.acquire(ctx, size)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return me.RemoteNodeExecutor.CreateIterator(nodeId, ctx, m, opt, shardIDs)
+	}
+
+	inputs := make([]query.Iterator, 0, (len(shardIDs)+size-1)/size)
+	for len(shardIDs) > 0 {
+		n := size
+		if n > len(shardIDs) {
+			n = len(shardIDs)
+		}
+		itr, err := func() (query.Iterator, error) {
+			release, err := limiter.acquire(ctx, n)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+			return me.RemoteNodeExecutor.CreateIterator(nodeId, ctx, m, opt, shardIDs[:n])
+		}()
+		if err != nil {
+			query.Iterators(inputs).Close()
+			return nil, err
+		}
+		if itr != nil {
+			inputs = append(inputs, itr)
+		}
+		shardIDs = shardIDs[n:]
+	}
+	return query.Iterators(inputs).Merge(opt)
+}
+
 func (me *ClusterExecutor) MapType(m *influxql.Measurement, field string, shards []meta.ShardInfo) influxql.DataType {
 	type Result struct {
 		nodeId   uint64
@@ -457,7 +649,7 @@ func (me *ClusterExecutor) MapType(m *influxql.Measurement, field string, shards
 		err      error
 	}
 
-	n2s := PlanNodes(me.Node.ID, shards, nil)
+	n2s := me.planNodes(shards)
 	fn := func(nodeId uint64, shards []meta.ShardInfo) (result interface{}, err error) {
 		shardIDs := toShardIDs(shards)
 		if nodeId == me.Node.ID {
@@ -515,7 +707,7 @@ func (me *ClusterExecutor) MapType(m *influxql.Measurement, field string, shards
 			continue
 		}
 		if r.err != nil {
-			me.Logger.Warn("results have error", zap.Error(r.err), zap.Uint64("node", r.nodeId))
+			me.Logger.Warn("results have error", zap.Error(r.err), logging.NodeID(r.nodeId))
 			continue
 		}
 		if typ.LessThan(r.dataType) {
@@ -532,7 +724,7 @@ func (me *ClusterExecutor) IteratorCost(m *influxql.Measurement, opt query.Itera
 		err  error
 	}
 
-	n2s := PlanNodes(me.Node.ID, shards, nil)
+	n2s := me.planNodes(shards)
 
 	fn := func(nodeId uint64, shards []meta.ShardInfo) (result interface{}, err error) {
 		shardIDs := toShardIDs(shards)
@@ -585,7 +777,7 @@ func (me *ClusterExecutor) FieldDimensions(m *influxql.Measurement, shards []met
 		err        error
 	}
 
-	n2s := PlanNodes(me.Node.ID, shards, nil)
+	n2s := me.planNodes(shards)
 
 	fn := func(nodeId uint64, shards []meta.ShardInfo) (result interface{}, err error) {
 		var fields map[string]influxql.DataType
@@ -634,6 +826,42 @@ func (me *ClusterExecutor) FieldDimensions(m *influxql.Measurement, shards []met
 	return fields, dimensions, nil
 }
 
+// countLocality counts shards of a query planned to be read locally or from
+// other nodes by n2s.
+func (me *ClusterExecutor) countLocality(shards []meta.ShardInfo, n2s Node2ShardIDs) {
+	var local, remote, owned int64
+	for nodeId, ss := range n2s {
+		if nodeId == me.Node.ID {
+			local += int64(len(ss))
+		} else {
+			remote += int64(len(ss))
+		}
+	}
+	for _, shard := range shards {
+		if shard.OwnedBy(me.Node.ID) {
+			owned++
+		}
+	}
+	atomic.AddInt64(&me.stats.LocalityHit, local)
+	atomic.AddInt64(&me.stats.LocalityMiss, remote)
+	// local copies left out of the plan are stale or excluded by maintenance
+	atomic.AddInt64(&me.stats.LocalityMissStale, owned-local)
+}
+
+// planNodes distributes shards to owners like PlanNodes, leaving out owners
+// whose copies are stale until they are caught up, and owners in maintenance
+// windows excluding reads.
+func (me *ClusterExecutor) planNodes(shards []meta.ShardInfo) Node2ShardIDs {
+	if me.MetaClient != nil {
+		now := time.Now()
+		shards = withoutStaleOwners(shards, func(shardID, nodeID uint64) bool {
+			return me.MetaClient.ShardStale(shardID, nodeID) ||
+				me.MetaClient.InMaintenance(nodeID, now, imeta.MaintenanceExcludeReads)
+		})
+	}
+	return PlanNodes(me.Node.ID, shards, nil)
+}
+
 func GetShardInfoByIds(MetaClient interface {
 	ShardOwner(id uint64) (string, string, *meta.ShardGroupInfo)
 }, ids []uint64) ([]meta.ShardInfo, error) {
@@ -664,7 +892,7 @@ func (me *ClusterExecutor) TagKeys(auth query.Authorizer, ids []uint64, cond inf
 		return nil, err
 	}
 
-	n2s := PlanNodes(me.Node.ID, shards, nil)
+	n2s := me.planNodes(shards)
 
 	fn := func(nodeId uint64, shards []meta.ShardInfo) (result interface{}, err error) {
 		var tagKeys []tsdb.TagKeys
@@ -676,7 +904,7 @@ func (me *ClusterExecutor) TagKeys(auth query.Authorizer, ids []uint64, cond inf
 		}
 
 		if err != nil {
-			me.Logger.Error("TagKeys fail", zap.Error(err), zap.Uint64("node", nodeId))
+			me.Logger.Error("TagKeys fail", zap.Error(err), logging.NodeID(nodeId))
 		}
 		if len(tagKeys) > 0 {
 			result = &TagKeysResult{keys: tagKeys, err: err}
@@ -724,6 +952,9 @@ func (me *ClusterExecutor) TagKeys(auth query.Authorizer, ids []uint64, cond inf
 	return tagKeys, nil
 }
 
+// DeleteMeasurement drops measurement name of database on all nodes owning
+// shards of it. The drop is recorded as a tombstone first, nodes not reached
+// apply it once back.
 func (me *ClusterExecutor) DeleteMeasurement(database, name string) error {
 	type Result struct {
 		err error
@@ -733,6 +964,10 @@ func (me *ClusterExecutor) DeleteMeasurement(database, name string) error {
 	if err != nil {
 		return err
 	}
+	tombstone, err := me.MetaClient.CreateMeasurementTombstone(database, name)
+	if err != nil {
+		return err
+	}
 	nodes := getAllRelatedNodes(shards)
 	results := make(map[uint64]*Result)
 
@@ -757,6 +992,16 @@ func (me *ClusterExecutor) DeleteMeasurement(database, name string) error {
 	}
 	wg.Wait()
 
+	// Nodes owning no shards of database have nothing to drop either
+	for _, id := range tombstone.Pending {
+		if r, ok := results[id]; ok && r.err != nil {
+			continue
+		}
+		if err := me.MetaClient.AckMeasurementTombstone(tombstone.ID, id); err != nil {
+			me.Logger.Warn("Failed to ack measurement tombstone", logging.NodeID(id), zap.Error(err))
+		}
+	}
+
 	for _, r := range results {
 		if r.err != nil {
 			return r.err
@@ -2,12 +2,21 @@ package coordinator_test
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/angopher/chronus/coordinator"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/query"
 	"github.com/influxdata/influxdb/services/meta"
 	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxql"
+	"go.uber.org/zap"
 )
 
 func TestClusterExecuterTagKeys(t *testing.T) {
@@ -54,15 +63,125 @@ func TestClusterExecuterCreateIterator(t *testing.T) {
 	//TODO
 }
 
+// Ensures shards of a query are opened on remote nodes in chunks within the
+// fan-out limits.
+func TestClusterExecuterCreateIterator_FanoutLimits(t *testing.T) {
+	var shards []meta.ShardInfo
+	for i := 0; i < 12; i++ {
+		shards = append(shards, meta.ShardInfo{ID: uint64(i + 1), Owners: []meta.ShardOwner{{NodeID: uint64(2 + i%2)}}})
+	}
+
+	var (
+		mu             sync.Mutex
+		opening, max   int
+		opened         int
+		maxChunkOpened int
+	)
+	remote := &fakeRemoteNode{
+		CreateIteratorFn: func(nodeId uint64, ctx context.Context, m *influxql.Measurement, opt query.IteratorOptions, shardIds []uint64) (query.Iterator, error) {
+			mu.Lock()
+			opening += len(shardIds)
+			if opening > max {
+				max = opening
+			}
+			if len(shardIds) > maxChunkOpened {
+				maxChunkOpened = len(shardIds)
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			opening -= len(shardIds)
+			opened += len(shardIds)
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	e := &coordinator.ClusterExecutor{
+		Node:                       &influxdb.Node{ID: 1},
+		RemoteNodeExecutor:         remote,
+		Logger:                     zap.NewNop(),
+		MaxConcurrentShards:        4,
+		MaxConcurrentShardsPerNode: 3,
+	}
+	if _, err := e.CreateIterator(context.Background(), &influxql.Measurement{Name: "cpu"}, query.IteratorOptions{}, shards); err != nil {
+		t.Fatalf("CreateIterator() failed: %v", err)
+	}
+	if opened != len(shards) {
+		t.Fatalf("unexpected shards opened: got %d, exp %d", opened, len(shards))
+	}
+	if max > 4 {
+		t.Fatalf("shards opened at once beyond limit: %d", max)
+	}
+	if maxChunkOpened > 3 {
+		t.Fatalf("shards opened at once on a node beyond limit: %d", maxChunkOpened)
+	}
+}
+
 func TestClusterExecuterTaskManagerStatement(t *testing.T) {
 	//TODO
 }
 
+// Ensures SHOW STATS of all nodes are merged, tagged by node, with nodes
+// failed reported as warnings.
+func TestClusterExecuterNodeStatement(t *testing.T) {
+	stats := func(node string) models.Rows {
+		return models.Rows{
+			{Name: "write", Columns: []string{"pointReq"}, Values: [][]interface{}{{node}}},
+			{Name: "cq", Columns: []string{"queryOk"}, Values: [][]interface{}{{node}}},
+		}
+	}
+	e := &coordinator.ClusterExecutor{
+		Node: &influxdb.Node{ID: 1},
+		MetaClient: &fakeMetaClient{
+			DataNodesFn: func() ([]meta.NodeInfo, error) {
+				return []meta.NodeInfo{{ID: 3}, {ID: 1}, {ID: 2}}, nil
+			},
+		},
+		NodeStatements: &fakeTaskManager{
+			ExecuteFn: func(stmt influxql.Statement, ctx *query.ExecutionContext) error {
+				return ctx.Send(&query.Result{Series: stats("1")})
+			},
+		},
+		RemoteNodeExecutor: &fakeRemoteNode{
+			NodeStatementFn: func(nodeId uint64, stmt influxql.Statement) (*query.Result, error) {
+				if nodeId == 2 {
+					return nil, errors.New("connection refused")
+				}
+				return &query.Result{Series: stats("3")}, nil
+			},
+		},
+		Logger: zap.NewNop(),
+	}
+
+	rows, messages, err := e.ExecuteNodeStatement(&influxql.ShowStatsStatement{})
+	if err != nil {
+		t.Fatalf("ExecuteNodeStatement() failed: %v", err)
+	}
+	var got []string
+	for _, row := range rows {
+		if row.Tags["node_id"] != row.Values[0][0] {
+			t.Fatalf("row of node %v tagged by node %q", row.Values[0][0], row.Tags["node_id"])
+		}
+		got = append(got, row.Name+"@"+row.Tags["node_id"])
+	}
+	if exp := []string{"cq@1", "cq@3", "write@1", "write@3"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected rows: got %v, exp %v", got, exp)
+	}
+	if len(messages) != 1 || messages[0].Level != query.WarningLevel || messages[0].Text != "node 2: connection refused" {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+}
+
 type fakeMetaClient struct {
 	DataNodesFn  func() ([]meta.NodeInfo, error)
 	DataNodeFn   func(nodeId uint64) (*meta.NodeInfo, error)
 	ShardOwnerFn func(id uint64) (string, string, *meta.ShardGroupInfo)
 	DatabaseFn   func(name string) *meta.DatabaseInfo
+	ShardStaleFn func(id, nodeID uint64) bool
+	// InMaintenanceFn is optional, no node is in maintenance if nil
+	InMaintenanceFn func(nodeID uint64, now time.Time, behavior string) bool
 }
 
 func (f *fakeMetaClient) DataNodes() ([]meta.NodeInfo, error) {
@@ -81,6 +200,25 @@ func (f *fakeMetaClient) Database(name string) *meta.DatabaseInfo {
 	return f.DatabaseFn(name)
 }
 
+func (f *fakeMetaClient) ShardStale(id, nodeID uint64) bool {
+	return f.ShardStaleFn(id, nodeID)
+}
+
+func (f *fakeMetaClient) InMaintenance(nodeID uint64, now time.Time, behavior string) bool {
+	if f.InMaintenanceFn == nil {
+		return false
+	}
+	return f.InMaintenanceFn(nodeID, now, behavior)
+}
+
+func (f *fakeMetaClient) CreateMeasurementTombstone(database, name string) (*imeta.MeasurementTombstone, error) {
+	return nil, nil
+}
+
+func (f *fakeMetaClient) AckMeasurementTombstone(id, nodeID uint64) error {
+	return nil
+}
+
 type fakeTSDBStore struct {
 	DeleteShardFn       func(id uint64) error
 	DeleteDatabaseFn    func(name string) error
@@ -145,6 +283,7 @@ type fakeRemoteNode struct {
 	MapTypeFn              func(nodeId uint64, m *influxql.Measurement, field string, shardIds []uint64) (influxql.DataType, error)
 	CreateIteratorFn       func(nodeId uint64, ctx context.Context, m *influxql.Measurement, opt query.IteratorOptions, shardIds []uint64) (query.Iterator, error)
 	TaskManagerStatementFn func(nodeId uint64, stmt influxql.Statement) (*query.Result, error)
+	NodeStatementFn        func(nodeId uint64, stmt influxql.Statement) (*query.Result, error)
 }
 
 func (f *fakeRemoteNode) TagKeys(nodeId uint64, shardIDs []uint64, cond influxql.Expr) ([]tsdb.TagKeys, error) {
@@ -191,6 +330,14 @@ func (f *fakeRemoteNode) CreateIterator(nodeId uint64, ctx context.Context, m *i
 	return f.CreateIteratorFn(nodeId, ctx, m, opt, shardIds)
 }
 
+func (f *fakeRemoteNode) WithLogger(log *zap.Logger) {}
+
+func (f *fakeRemoteNode) Stats() []coordinator.StatEntity { return nil }
+
 func (f *fakeRemoteNode) TaskManagerStatement(nodeId uint64, stmt influxql.Statement) (*query.Result, error) {
 	return f.TaskManagerStatementFn(nodeId, stmt)
 }
+
+func (f *fakeRemoteNode) NodeStatement(nodeId uint64, stmt influxql.Statement) (*query.Result, error) {
+	return f.NodeStatementFn(nodeId, stmt)
+}
@@ -2,6 +2,7 @@ package coordinator
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/influxdata/influxdb/services/meta"
@@ -18,16 +19,29 @@ type ClusterMetaClient struct {
 	metaCli        *MetaClientImpl
 	pingIntervalMs int64
 	Logger         *zap.Logger
+
+	// interval of checking meta servers, 0 if disabled
+	healthCheckInterval time.Duration
+
+	skew skewTracker
+
+	// incarnation of this node registered at start, 0 if not registered
+	incarnation uint64
 }
 
 func NewMetaClient(mc *meta.Config, cc Config, nodeID uint64) *ClusterMetaClient {
+	cache := imeta.NewClient(mc)
+	cache.SetAuthCache(cc.AuthCacheSize, time.Duration(cc.AuthCacheTTL))
 	return &ClusterMetaClient{
 		NodeID: nodeID,
 		metaCli: &MetaClientImpl{
-			Addrs: cc.MetaServices,
+			Addrs:               cc.MetaServices,
+			HealthCheckInterval: time.Duration(cc.MetaHealthCheckInterval),
 		},
-		pingIntervalMs: cc.PingMetaServiceIntervalMs,
-		cache:          imeta.NewClient(mc),
+		pingIntervalMs:      cc.PingMetaServiceIntervalMs,
+		healthCheckInterval: time.Duration(cc.MetaHealthCheckInterval),
+		cache:               cache,
+		skew:                newSkewTracker(time.Duration(cc.MaxClockSkew)),
 	}
 }
 
@@ -52,10 +66,44 @@ func (me *ClusterMetaClient) WaitForDataChanged() chan struct{} {
 	return me.cache.WaitForDataChanged()
 }
 
+// WaitForClusterConfigChanged returns a channel closed when the cluster config
+// synced from metad changes.
+func (me *ClusterMetaClient) WaitForClusterConfigChanged() chan struct{} {
+	return me.cache.WaitForClusterConfigChanged()
+}
+
+// ClusterConfig returns the runtime settings shared by all nodes.
+func (me *ClusterMetaClient) ClusterConfig() imeta.ClusterConfig {
+	return me.cache.ClusterConfig()
+}
+
+// HintedHandoffEnabled returns whether failed writes to retention policy rp of
+// database are queued by hinted handoff.
+func (me *ClusterMetaClient) HintedHandoffEnabled(database, rp string) bool {
+	return me.cache.HintedHandoffEnabled(database, rp)
+}
+
+// ClusterReadOnly returns whether writes of all nodes are rejected.
+func (me *ClusterMetaClient) ClusterReadOnly() bool {
+	return me.cache.ClusterReadOnly()
+}
+
+// ShardReadOnly returns whether writes to shard id are rejected.
+func (me *ClusterMetaClient) ShardReadOnly(id uint64) bool {
+	return me.cache.ShardReadOnly(id)
+}
+
 func (me *ClusterMetaClient) ClusterID() uint64 {
 	return me.cache.ClusterID()
 }
 
+// MetaIndex returns the index of meta data synced locally and the index of
+// meta servers.
+func (me *ClusterMetaClient) MetaIndex() (local, remote uint64, err error) {
+	remote, _, err = me.metaCli.Ping()
+	return me.cache.DataIndex(), remote, err
+}
+
 func (me *ClusterMetaClient) syncData() error {
 	me.Logger.Info("start sync data")
 	data, err := me.metaCli.Data()
@@ -74,17 +122,22 @@ func (me *ClusterMetaClient) syncLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			index, err := me.metaCli.Ping()
+			index, skew, err := me.metaCli.Ping()
 			if err != nil {
 				me.Logger.Warn("Ping fail", zap.Error(err))
 				continue
 			}
+			me.observeClockSkew(skew)
 
 			if index > me.cache.DataIndex() {
 				if err := me.syncData(); err != nil {
 					me.Logger.Warn("syncData fail", zap.Error(err))
 				} else {
 					me.Logger.Info("syncData success")
+					if me.Stale() {
+						me.Logger.Error("Incarnation of this node is stale, restart it to register again",
+							zap.Uint64("node", me.NodeID), zap.Uint64("incarnation", me.Incarnation()))
+					}
 				}
 			} else if index < me.cache.DataIndex() {
 				me.Logger.Warn(fmt.Sprintf("index:%d < local index:%d", index, me.cache.DataIndex()))
@@ -100,6 +153,10 @@ func (me *ClusterMetaClient) syncLoop() {
 }
 
 func (me *ClusterMetaClient) Start() {
+	if me.healthCheckInterval > 0 && len(me.metaCli.Addrs) > 1 {
+		me.checkMetaEndpoints(nil)
+		go me.healthCheckLoop()
+	}
 	// sync first synchronously
 	wait := me.WaitForDataChanged()
 	go me.syncData()
@@ -113,6 +170,44 @@ func (me *ClusterMetaClient) Start() {
 	go me.syncLoop()
 }
 
+// healthCheckLoop checks meta servers periodically, logging the ones turning
+// unhealthy or healthy again and changes of the leader.
+func (me *ClusterMetaClient) healthCheckLoop() {
+	ticker := time.NewTicker(me.healthCheckInterval)
+	defer ticker.Stop()
+	last := me.metaCli.Endpoints()
+	for range ticker.C {
+		last = me.checkMetaEndpoints(last)
+	}
+}
+
+func (me *ClusterMetaClient) checkMetaEndpoints(last []MetaEndpoint) []MetaEndpoint {
+	endpoints := me.metaCli.CheckEndpoints()
+	for i, ep := range endpoints {
+		var prev MetaEndpoint
+		if i < len(last) {
+			prev = last[i]
+		} else {
+			prev = MetaEndpoint{Healthy: true}
+		}
+		if prev.Healthy && !ep.Healthy {
+			me.Logger.Warn("Meta server unhealthy", zap.String("addr", ep.Addr), zap.String("error", ep.Error))
+		} else if !prev.Healthy && ep.Healthy {
+			me.Logger.Info("Meta server healthy again", zap.String("addr", ep.Addr))
+		}
+		if ep.Leader && !prev.Leader {
+			me.Logger.Info("Meta leader discovered", zap.String("addr", ep.Addr))
+		}
+	}
+	return endpoints
+}
+
+// MetaEndpoints returns the health of meta servers as last seen, requests
+// go to the leader if healthy and fail over to other meta servers.
+func (me *ClusterMetaClient) MetaEndpoints() []MetaEndpoint {
+	return me.metaCli.Endpoints()
+}
+
 func (me *ClusterMetaClient) CreateDatabase(name string) (*meta.DatabaseInfo, error) {
 	if db, err := me.metaCli.CreateDatabase(name); err != nil {
 		return db, err
@@ -120,6 +215,19 @@ func (me *ClusterMetaClient) CreateDatabase(name string) (*meta.DatabaseInfo, er
 	return me.cache.CreateDatabase(name)
 }
 
+// CreateDatabaseFromTemplate creates a database along with everything in the template
+func (me *ClusterMetaClient) CreateDatabaseFromTemplate(name, template string) (*meta.DatabaseInfo, error) {
+	db, err := me.metaCli.CreateDatabaseFromTemplate(name, template)
+	if err != nil {
+		return nil, err
+	}
+	// template may not be synced to cache yet, it will be caught up by syncLoop
+	if cached, err := me.cache.CreateDatabaseFromTemplate(name, template); err == nil {
+		return cached, nil
+	}
+	return db, nil
+}
+
 func (me *ClusterMetaClient) DeleteDataNode(id uint64) error {
 	if err := me.metaCli.DeleteDataNode(id); err != nil {
 		return err
@@ -149,20 +257,159 @@ func (me *ClusterMetaClient) Database(name string) *meta.DatabaseInfo {
 	return me.cache.Database(name)
 }
 
-func (me *ClusterMetaClient) AddShardOwner(shardID, nodeID uint64) error {
+func (me *ClusterMetaClient) AddShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error {
 	if err := me.metaCli.AddShardOwner(shardID, nodeID); err != nil {
 		return err
 	}
 	return me.cache.AddShardOwner(shardID, nodeID)
 }
 
-func (me *ClusterMetaClient) RemoveShardOwner(shardID, nodeID uint64) error {
+func (me *ClusterMetaClient) RemoveShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error {
 	if err := me.metaCli.RemoveShardOwner(shardID, nodeID); err != nil {
 		return err
 	}
 	return me.cache.RemoveShardOwner(shardID, nodeID)
 }
 
+// BeginShardCutover starts the cutover of a shard moving to node nodeID,
+// holding writes to it until expiration.
+func (me *ClusterMetaClient) BeginShardCutover(shardID, nodeID uint64, expiration time.Time) error {
+	if err := me.metaCli.BeginShardCutover(shardID, nodeID, expiration); err != nil {
+		return err
+	}
+	return me.cache.BeginShardCutover(shardID, nodeID, expiration)
+}
+
+// EndShardCutover ends the cutover of a shard.
+func (me *ClusterMetaClient) EndShardCutover(shardID uint64) error {
+	if err := me.metaCli.EndShardCutover(shardID); err != nil {
+		return err
+	}
+	return me.cache.EndShardCutover(shardID)
+}
+
+// ShardStale returns whether the copy of shard id on node nodeID is stale.
+func (me *ClusterMetaClient) ShardStale(id, nodeID uint64) bool {
+	return me.cache.ShardStale(id, nodeID)
+}
+
+// StaleShards returns the stale copies of shards on node nodeID.
+func (me *ClusterMetaClient) StaleShards(nodeID uint64) []imeta.StaleShard {
+	return me.cache.StaleShards(nodeID)
+}
+
+// MarkShardsStale marks copies of shards on node nodeID stale, so that they
+// are caught up from other owners.
+func (me *ClusterMetaClient) MarkShardsStale(nodeID uint64, shardIDs []uint64) error {
+	if err := me.metaCli.MarkShardsStale(nodeID, shardIDs); err != nil {
+		return err
+	}
+	return me.cache.MarkShardsStale(nodeID, shardIDs, time.Now().UTC())
+}
+
+// ClearStaleShard marks the copy of a shard on node nodeID caught up.
+func (me *ClusterMetaClient) ClearStaleShard(shardID, nodeID uint64) error {
+	if err := me.metaCli.ClearStaleShard(shardID, nodeID); err != nil {
+		return err
+	}
+	return me.cache.ClearStaleShard(shardID, nodeID)
+}
+
+// ShardSealed returns whether shard id is sealed.
+func (me *ClusterMetaClient) ShardSealed(id uint64) bool {
+	return me.cache.ShardSealed(id)
+}
+
+// SealedShards returns the shards sealed.
+func (me *ClusterMetaClient) SealedShards() []imeta.SealedShard {
+	return me.cache.SealedShards()
+}
+
+// SealShardGroups seals shard groups ended grace ago, returning the number
+// of shards sealed. Meta servers are not requested if none is to be sealed.
+func (me *ClusterMetaClient) SealShardGroups(grace time.Duration) (int, error) {
+	if len(me.cache.UnsealedShardGroups(grace, time.Now().UTC())) == 0 {
+		return 0, nil
+	}
+	sealed, err := me.metaCli.SealShardGroups(grace)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := me.cache.SealShardGroups(grace, time.Now().UTC()); err != nil {
+		return 0, err
+	}
+	return sealed, nil
+}
+
+// SetSealedShardChecksum records the checksum of a sealed shard verified
+// across its owners.
+func (me *ClusterMetaClient) SetSealedShardChecksum(shardID uint64, checksum uint32, diverged bool) error {
+	if err := me.metaCli.SetSealedShardChecksum(shardID, checksum, diverged); err != nil {
+		return err
+	}
+	return me.cache.SetSealedShardChecksum(shardID, checksum, diverged, time.Now().UTC())
+}
+
+// MaintenanceWindows returns the maintenance windows scheduled.
+func (me *ClusterMetaClient) MaintenanceWindows() []imeta.MaintenanceWindow {
+	return me.cache.MaintenanceWindows()
+}
+
+// InMaintenance tells whether node nodeID is in a maintenance window of
+// behavior open at now.
+func (me *ClusterMetaClient) InMaintenance(nodeID uint64, now time.Time, behavior string) bool {
+	return me.cache.InMaintenance(nodeID, now, behavior)
+}
+
+// NodeMaintenanceWindows returns the maintenance windows of node nodeID open
+// at now.
+func (me *ClusterMetaClient) NodeMaintenanceWindows(nodeID uint64, now time.Time) []imeta.MaintenanceWindow {
+	return me.cache.NodeMaintenanceWindows(nodeID, now)
+}
+
+// MeasurementTombstones returns the drops of measurements node nodeID
+// hasn't applied yet.
+func (me *ClusterMetaClient) MeasurementTombstones(nodeID uint64) []imeta.MeasurementTombstone {
+	return me.cache.MeasurementTombstones(nodeID)
+}
+
+// MeasurementDroppedAfter tells whether measurement name of database was
+// dropped after t.
+func (me *ClusterMetaClient) MeasurementDroppedAfter(database, name string, t time.Time) bool {
+	return me.cache.MeasurementDroppedAfter(database, name, t)
+}
+
+// CreateMeasurementTombstone records a drop of measurement name of database
+// to be applied by all data nodes. The tombstone is cached once synced, with
+// the id assigned by meta servers.
+func (me *ClusterMetaClient) CreateMeasurementTombstone(database, name string) (*imeta.MeasurementTombstone, error) {
+	return me.metaCli.CreateMeasurementTombstone(database, name)
+}
+
+// AckMeasurementTombstone marks tombstone id applied by node nodeID.
+func (me *ClusterMetaClient) AckMeasurementTombstone(id, nodeID uint64) error {
+	if err := me.metaCli.AckMeasurementTombstone(id, nodeID); err != nil {
+		return err
+	}
+	return me.cache.AckMeasurementTombstone(id, nodeID, time.Now().UTC())
+}
+
+// FreezeShardGroups holds creation of shard groups for snapshot id until
+// until, returning meta data marshaled once frozen.
+func (me *ClusterMetaClient) FreezeShardGroups(id string, until time.Time) ([]byte, error) {
+	return me.metaCli.FreezeShardGroups(id, until)
+}
+
+// ThawShardGroups releases the freeze of snapshot id.
+func (me *ClusterMetaClient) ThawShardGroups(id string) error {
+	return me.metaCli.ThawShardGroups(id)
+}
+
+// ShardCutover returns the cutover of shard id holding now, nil if none.
+func (me *ClusterMetaClient) ShardCutover(id uint64) *imeta.ShardCutover {
+	return me.cache.ShardCutover(id)
+}
+
 func (me *ClusterMetaClient) CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
 	if sg := me.cache.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
 		return sg, nil
@@ -172,9 +419,33 @@ func (me *ClusterMetaClient) CreateShardGroup(database, policy string, timestamp
 		return nil, err
 	}
 
+	// created meanwhile by another write of this node or synced from meta
+	if sg := me.cache.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
+		atomic.AddInt64(&me.metaCli.stats.CommitConflicts, 1)
+		return sg, nil
+	}
 	return me.cache.CreateShardGroup(database, policy, timestamp)
 }
 
+// CreateShardGroupsForRange creates all shard groups missing to cover the range
+// from start to end of a database and policy, returning the groups created.
+func (me *ClusterMetaClient) CreateShardGroupsForRange(database, policy string, start, end time.Time) ([]meta.ShardGroupInfo, error) {
+	groups, err := me.metaCli.CreateShardGroupsForRange(database, policy, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := me.cache.CreateShardGroupsForRange(database, policy, start, end); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// PreviewShardOwners returns the shards with their owners a shard group of a
+// database and policy for timestamp has, or would have if created now.
+func (me *ClusterMetaClient) PreviewShardOwners(database, policy string, timestamp time.Time) ([]meta.ShardInfo, error) {
+	return me.cache.PreviewShardOwners(database, policy, timestamp)
+}
+
 func (me *ClusterMetaClient) CreateDataNode(httpAddr, tcpAddr string) (*meta.NodeInfo, error) {
 	if node, err := me.metaCli.CreateDataNode(httpAddr, tcpAddr); err != nil {
 		return node, err
@@ -182,6 +453,37 @@ func (me *ClusterMetaClient) CreateDataNode(httpAddr, tcpAddr string) (*meta.Nod
 	return me.cache.CreateDataNode(httpAddr, tcpAddr)
 }
 
+// RegisterDataNode registers a start of data node id, i.e. this node, and
+// returns its new incarnation. Processes of the node started before are stale
+// from now on.
+func (me *ClusterMetaClient) RegisterDataNode(id uint64) (uint64, error) {
+	incarnation, err := me.metaCli.RegisterDataNode(id)
+	if err != nil {
+		return 0, err
+	}
+	atomic.StoreUint64(&me.incarnation, incarnation)
+	return incarnation, nil
+}
+
+// Incarnation returns the incarnation of this node registered at start, 0 if
+// not registered.
+func (me *ClusterMetaClient) Incarnation() uint64 {
+	return atomic.LoadUint64(&me.incarnation)
+}
+
+// StaleIncarnation tells whether incarnation of data node id is replaced by a
+// newer start of the node or the node is deleted.
+func (me *ClusterMetaClient) StaleIncarnation(id, incarnation uint64) bool {
+	return me.cache.StaleIncarnation(id, incarnation)
+}
+
+// Stale tells whether this node is of an incarnation replaced by a newer
+// start of the node or deleted, its requests are rejected by other nodes
+// then. The node has to be restarted, registering again.
+func (me *ClusterMetaClient) Stale() bool {
+	return me.cache.StaleIncarnation(me.NodeID, me.Incarnation())
+}
+
 // DataNode returns the node information according to the id, if it's not existed a meta.ErrNodeNotFound is returned.
 func (me *ClusterMetaClient) DataNode(id uint64) (*meta.NodeInfo, error) {
 	return me.cache.DataNode(id)
@@ -292,6 +594,70 @@ func (me *ClusterMetaClient) SetPrivilege(username, database string, p influxql.
 	return me.cache.SetPrivilege(username, database, p)
 }
 
+func (me *ClusterMetaClient) SetMeasurementPrivilege(username, database, pattern string, p influxql.Privilege) error {
+	if err := me.metaCli.SetMeasurementPrivilege(username, database, pattern, p); err != nil {
+		return err
+	}
+	return me.cache.SetMeasurementPrivilege(username, database, pattern, p)
+}
+
+func (me *ClusterMetaClient) SetOperatorRole(username string, role imeta.OperatorRole) error {
+	if err := me.metaCli.SetOperatorRole(username, role); err != nil {
+		return err
+	}
+	return me.cache.SetOperatorRole(username, role)
+}
+
+func (me *ClusterMetaClient) UserOperatorRole(username string) imeta.OperatorRole {
+	return me.cache.UserOperatorRole(username)
+}
+
+func (me *ClusterMetaClient) UserMeasurementPrivileges(username, database string) []imeta.MeasurementPrivilege {
+	return me.cache.UserMeasurementPrivileges(username, database)
+}
+
+func (me *ClusterMetaClient) AuthorizeQuery(u meta.User, stmt influxql.Statement, database string) error {
+	return me.cache.AuthorizeQuery(u, stmt, database)
+}
+
+func (me *ClusterMetaClient) AuthorizeSources(u meta.User, stmt influxql.Statement, database string) error {
+	return me.cache.AuthorizeSources(u, stmt, database)
+}
+
+func (me *ClusterMetaClient) AuthenticateToken(token string) (meta.User, error) {
+	return me.cache.AuthenticateToken(token)
+}
+
+// CreateSession signs user in for ttl, returning the session token and its
+// expiration.
+func (me *ClusterMetaClient) CreateSession(username string, ttl time.Duration) (string, time.Time, error) {
+	token, expiration, err := me.metaCli.CreateSession(username, ttl)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := me.cache.CreateSession(username, imeta.HashAPIToken(token), time.Now().UTC(), expiration); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiration, nil
+}
+
+// DropSession signs out the session of token.
+func (me *ClusterMetaClient) DropSession(token string) error {
+	hash := imeta.HashAPIToken(token)
+	if err := me.metaCli.DropSession(hash); err != nil {
+		return err
+	}
+	return me.cache.DropSession(hash)
+}
+
+func (me *ClusterMetaClient) AuthenticateSession(token string) (meta.User, error) {
+	return me.cache.AuthenticateSession(token)
+}
+
+func (me *ClusterMetaClient) BucketMapping(org, bucket string) *imeta.BucketMapping {
+	return me.cache.BucketMapping(org, bucket)
+}
+
 func (me *ClusterMetaClient) ShardGroupsByTimeRange(database, policy string, min, max time.Time) ([]meta.ShardGroupInfo, error) {
 	return me.cache.ShardGroupsByTimeRange(database, policy, min, max)
 }
@@ -318,7 +684,12 @@ func (me *ClusterMetaClient) PruneShardGroups() error {
 	return nil
 }
 
+// PrecreateShardGroups precreates shard groups from from to to, or as far as
+// the precreation horizon if set in the cluster config.
 func (me *ClusterMetaClient) PrecreateShardGroups(from, to time.Time) error {
+	if horizon, ok := me.cache.ClusterConfig().Duration(imeta.ConfigPrecreationHorizon); ok {
+		to = from.Add(horizon)
+	}
 	if err := me.metaCli.PrecreateShardGroups(from, to); err != nil {
 		return err
 	}
@@ -1,21 +1,23 @@
 package coordinator
 
 import (
-	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"sync"
 
+	"github.com/angopher/chronus/errs"
 	"github.com/angopher/chronus/x"
 	"github.com/influxdata/influxdb/services/meta"
 )
 
 var (
-	ErrRetry = errors.New("operation needs another chance")
+	ErrRetry        = errs.ErrRetry
+	ErrReadsDrained = errs.ErrReadsDrained
 )
 
-// QueryFn returns ErrRetry indicating operation needs one more try on another node
+// QueryFn returns ErrRetry or ErrReadsDrained indicating operation needs one
+// more try on another node
 type QueryFn func(nodeId uint64, shardIds []meta.ShardInfo) (interface{}, error)
 
 // getOwners returns the availible owners filtered by blacklist
@@ -33,6 +35,35 @@ func getOwners(blacklist map[uint64]bool, owners []meta.ShardOwner) []meta.Shard
 	return arr
 }
 
+// withoutStaleOwners returns shards with owners whose copies are stale left
+// out, keeping them for shards all owners of which are stale.
+func withoutStaleOwners(shards []meta.ShardInfo, stale func(shardID, nodeID uint64) bool) []meta.ShardInfo {
+	var fresh []meta.ShardInfo
+	for i, shard := range shards {
+		owners := make([]meta.ShardOwner, 0, len(shard.Owners))
+		for _, owner := range shard.Owners {
+			if !stale(shard.ID, owner.NodeID) {
+				owners = append(owners, owner)
+			}
+		}
+		if len(owners) == len(shard.Owners) || len(owners) == 0 {
+			if fresh != nil {
+				fresh = append(fresh, shard)
+			}
+			continue
+		}
+		if fresh == nil {
+			fresh = append(make([]meta.ShardInfo, 0, len(shards)), shards[:i]...)
+		}
+		shard.Owners = owners
+		fresh = append(fresh, shard)
+	}
+	if fresh == nil {
+		return shards
+	}
+	return fresh
+}
+
 // PlanNodes distributes shards to correct nodes including those local node doesn't have
 //	Remote planning is randomized.
 //	blacklist is used during retries after queries fail on nodes
@@ -162,7 +193,7 @@ func executePlans(plans []*planSchedule, fn QueryFn) (result []interface{}, need
 			continue
 		}
 		fmt.Fprintln(os.Stderr, "execute remotely error:", err)
-		if err != ErrRetry {
+		if err != ErrRetry && err != ErrReadsDrained {
 			err_last = err
 			continue
 		}
@@ -3,6 +3,7 @@ package coordinator
 import (
 	"testing"
 
+	"github.com/influxdata/influxdb"
 	"github.com/influxdata/influxdb/services/meta"
 	"github.com/stretchr/testify/assert"
 )
@@ -137,3 +138,85 @@ func TestPlanNodes(t *testing.T) {
 	assert.True(t, verifyPlan(t, result, shards))
 	assert.Equal(t, 0, len(result[2]))
 }
+
+func TestPlanNodes_StaleOwners(t *testing.T) {
+	shards := []meta.ShardInfo{
+		{
+			ID: 1,
+			Owners: []meta.ShardOwner{
+				{NodeID: 1},
+				{NodeID: 2},
+			},
+		}, {
+			ID: 2,
+			Owners: []meta.ShardOwner{
+				{NodeID: 1},
+			},
+		},
+	}
+	stale := func(shardID, nodeID uint64) bool { return nodeID == 1 }
+
+	fresh := withoutStaleOwners(shards, stale)
+	// copies of the only owner are read anyway
+	assert.Equal(t, []meta.ShardOwner{{NodeID: 2}}, fresh[0].Owners)
+	assert.Equal(t, []meta.ShardOwner{{NodeID: 1}}, fresh[1].Owners)
+	assert.Len(t, shards[0].Owners, 2)
+
+	result := PlanNodes(1, fresh, nil)
+	assert.True(t, verifyPlan(t, result, shards))
+	assert.Equal(t, []uint64{1}, toShardIDs(result[2]))
+	assert.Equal(t, []uint64{2}, toShardIDs(result[1]))
+
+	assert.Equal(t, shards, withoutStaleOwners(shards, func(uint64, uint64) bool { return false }))
+}
+
+func TestClusterExecutor_Locality(t *testing.T) {
+	shards := []meta.ShardInfo{
+		{ID: 1, Owners: []meta.ShardOwner{{NodeID: 1}, {NodeID: 2}}},
+		{ID: 2, Owners: []meta.ShardOwner{{NodeID: 1}, {NodeID: 3}}},
+		{ID: 3, Owners: []meta.ShardOwner{{NodeID: 2}}},
+	}
+	me := &ClusterExecutor{Node: &influxdb.Node{ID: 1}}
+	stale := func(shardID, nodeID uint64) bool { return shardID == 2 && nodeID == 1 }
+
+	n2s := PlanNodes(1, withoutStaleOwners(shards, stale), nil)
+	me.countLocality(shards, n2s)
+	assert.Equal(t, []uint64{1}, toShardIDs(n2s[1]))
+	values := me.Statistics(nil)[0].Values
+	assert.Equal(t, int64(1), values[statLocalityHit])
+	assert.Equal(t, int64(2), values[statLocalityMiss])
+	assert.Equal(t, int64(1), values[statLocalityMissStale])
+}
+
+func TestExecuteWithRetry_ReadsDrained(t *testing.T) {
+	shards := []meta.ShardInfo{
+		{ID: 1, Owners: []meta.ShardOwner{{NodeID: 1}, {NodeID: 2}}},
+		{ID: 2, Owners: []meta.ShardOwner{{NodeID: 1}, {NodeID: 2}}},
+	}
+
+	s := NewService(Config{})
+	result, err := PlanNodes(1, shards, nil).ExecuteWithRetry(func(nodeId uint64, shards []meta.ShardInfo) (interface{}, error) {
+		if nodeId == 1 {
+			// node 1 drained
+			s.DrainReads(true)
+			if err := s.beginRead(); err != nil {
+				return nil, remoteReadError(err.Error())
+			}
+			defer s.endRead()
+		}
+		return nodeId, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{uint64(2)}, result)
+
+	drained, inFlight := s.ReadsDrained()
+	assert.True(t, drained)
+	assert.Equal(t, int64(0), inFlight)
+	assert.Equal(t, int64(1), s.stats.ReadsRejected)
+
+	s.DrainReads(false)
+	assert.Nil(t, s.beginRead())
+	_, inFlight = s.ReadsDrained()
+	assert.Equal(t, int64(1), inFlight)
+	s.endRead()
+}
@@ -3,11 +3,15 @@
 package coordinator
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/influxdata/influxdb/monitor/diagnostics"
 	"github.com/influxdata/influxdb/query"
 	"github.com/influxdata/influxdb/toml"
+
+	imeta "github.com/angopher/chronus/services/meta"
 )
 
 const (
@@ -35,63 +39,301 @@ const (
 	DefaultMaxSelectSeriesN = 0
 
 	DefaultMetaService = "127.0.0.1:2347"
+
+	// DefaultMaxConcurrentWrites is the maximum number of outbound shard writes
+	// in flight. A value of zero will make it unlimited.
+	DefaultMaxConcurrentWrites = 0
+
+	// DefaultMaxConcurrentWritesPerNode is the maximum number of outbound shard
+	// writes in flight to a single node. A value of zero will make it unlimited.
+	DefaultMaxConcurrentWritesPerNode = 0
+
+	// DefaultConcurrentWritesWait is the maximum time a shard write waits for a
+	// free slot before failing.
+	DefaultConcurrentWritesWait = time.Second
+
+	// DefaultBreakerThreshold is the number of consecutive failed shard writes to
+	// a node before writes to it go to hinted handoff directly. A value of zero
+	// disables the circuit breaker.
+	DefaultBreakerThreshold = 0
+
+	// DefaultBreakerCooldown is the time writes to a node are short-circuited
+	// before a write is attempted again.
+	DefaultBreakerCooldown = 10 * time.Second
+
+	// DefaultMaxOwnerBacklog is the number of points an owner may report in
+	// flight before writes to it go to hinted handoff directly. A value of zero
+	// will make it unlimited.
+	DefaultMaxOwnerBacklog = 0
+
+	// DefaultMinOwnerDiskFree is the disk space an owner must have free to
+	// be written to, writes to other owners below it go to hinted handoff
+	// and writes to this node are rejected. A value of zero disables it.
+	DefaultMinOwnerDiskFree = 0
+
+	// DefaultMaxWritePayloadSize is the size of a marshaled shard write to a
+	// node beyond which its points are split into several writes. A value of
+	// zero will make it unlimited.
+	DefaultMaxWritePayloadSize = 32 * 1024 * 1024
+
+	// DefaultMaxConcurrentShards is the maximum number of shards of a query
+	// being opened at once on remote nodes, more wait for them. A value of zero
+	// will make it unlimited.
+	DefaultMaxConcurrentShards = 0
+
+	// DefaultMaxConcurrentShardsPerNode is the maximum number of shards of a
+	// query being opened at once on a single remote node. A value of zero will
+	// make it unlimited.
+	DefaultMaxConcurrentShardsPerNode = 0
+
+	// DefaultWriteIdempotencyWindow is the number of idempotency keys of writes
+	// remembered per shard. A value of zero disables skipping duplicate writes.
+	DefaultWriteIdempotencyWindow = 1000
+
+	// DefaultMaxClockSkew is the skew of the clock to meta servers warned of,
+	// points near boundaries of shard groups may be routed to wrong groups by
+	// clocks skewed. A value of zero disables the warning.
+	DefaultMaxClockSkew = time.Second
+
+	// DefaultMaxWriteFuture is how far after now points may be written,
+	// later ones are rejected. A value of zero will make it unlimited.
+	DefaultMaxWriteFuture = 0
+
+	// DefaultMaxWritePast is how far before now points may be written,
+	// earlier ones are rejected. A value of zero will make it unlimited,
+	// points beyond the retention policy are dropped anyway.
+	DefaultMaxWritePast = 0
+
+	// DefaultAuthCacheSize is the number of users whose passwords are checked
+	// by a fast salted hash instead of bcrypt. A value of zero disables it.
+	DefaultAuthCacheSize = imeta.DefaultAuthCacheSize
+
+	// DefaultAuthCacheTTL is how long a salted hash of a password is used
+	// before a full comparison caches it with a new salt.
+	DefaultAuthCacheTTL = imeta.DefaultAuthCacheTTL
+
+	// ShardWriterTransportTCP writes shards to other nodes over the cluster
+	// TCP protocol.
+	ShardWriterTransportTCP = "tcp"
+
+	// ShardWriterTransportGRPC writes shards to other nodes over gRPC streams
+	// compressed with gzip. Every node serves both transports.
+	ShardWriterTransportGRPC = "grpc"
+
+	// WriteCompressionNone writes points to other nodes uncompressed.
+	WriteCompressionNone = "none"
+
+	// WriteCompressionSnappy compresses points written to other nodes with
+	// snappy, cheap on CPU.
+	WriteCompressionSnappy = "snappy"
+
+	// WriteCompressionZstd compresses points written to other nodes with zstd,
+	// smaller than snappy at more CPU.
+	WriteCompressionZstd = "zstd"
+
+	// WriteEncodingNone writes points to other nodes one by one.
+	WriteEncodingNone = "none"
+
+	// WriteEncodingSeriesDelta writes each series key of points written to
+	// other nodes once, points of the series carry only fields and time as
+	// delta to the previous point.
+	WriteEncodingSeriesDelta = "series-delta"
+
+	// WriteReplicationSync acknowledges writes once owners required by the
+	// consistency level wrote them.
+	WriteReplicationSync = "sync"
+
+	// WriteReplicationAsync acknowledges writes of consistency ONE and ANY
+	// once one owner, this node if owning the shard, wrote them. Other owners
+	// get them through hinted handoff.
+	WriteReplicationAsync = "async"
 )
 
 // Config represents the configuration for the coordinator service.
 type Config struct {
-	DailTimeout               toml.Duration `toml:"dial-timeout"`
-	PoolMaxIdleTimeout        toml.Duration `toml:"pool-max-idle-time"`
-	PoolMinStreamsPerNode     int           `toml:"pool-min-streams-per-node"`
-	PoolMaxStreamsPerNode     int           `toml:"pool-max-streams-per-node"`
-	ShardReaderTimeout        toml.Duration `toml:"shard-reader-timeout"`
-	ClusterTracing            bool          `toml:"cluster-tracing"`
-	WriteTimeout              toml.Duration `toml:"write-timeout"`
-	MaxConcurrentQueries      int           `toml:"max-concurrent-queries"`
-	QueryTimeout              toml.Duration `toml:"query-timeout"`
-	LogQueriesAfter           toml.Duration `toml:"log-queries-after"`
-	MaxSelectPointN           int           `toml:"max-select-point"`
-	MaxSelectSeriesN          int           `toml:"max-select-series"`
-	MaxSelectBucketsN         int           `toml:"max-select-buckets"`
-	MetaServices              []string      `toml:"meta-services"`
-	PingMetaServiceIntervalMs int64         `toml:"ping-meta-service-interval"`
+	DailTimeout                toml.Duration `toml:"dial-timeout"`
+	PoolMaxIdleTimeout         toml.Duration `toml:"pool-max-idle-time"`
+	PoolMinStreamsPerNode      int           `toml:"pool-min-streams-per-node"`
+	PoolMaxStreamsPerNode      int           `toml:"pool-max-streams-per-node"`
+	ShardReaderTimeout         toml.Duration `toml:"shard-reader-timeout"`
+	ClusterTracing             bool          `toml:"cluster-tracing"`
+	WriteTimeout               toml.Duration `toml:"write-timeout"`
+	MaxConcurrentQueries       int           `toml:"max-concurrent-queries"`
+	QueryTimeout               toml.Duration `toml:"query-timeout"`
+	LogQueriesAfter            toml.Duration `toml:"log-queries-after"`
+	MaxSelectPointN            int           `toml:"max-select-point"`
+	MaxSelectSeriesN           int           `toml:"max-select-series"`
+	MaxSelectBucketsN          int           `toml:"max-select-buckets"`
+	MetaServices               []string      `toml:"meta-services"`
+	PingMetaServiceIntervalMs  int64         `toml:"ping-meta-service-interval"`
+	MetaHealthCheckInterval    toml.Duration `toml:"meta-health-check-interval"`
+	MaxConcurrentWrites        int           `toml:"max-concurrent-writes"`
+	MaxConcurrentWritesPerNode int           `toml:"max-concurrent-writes-per-node"`
+	ConcurrentWritesWait       toml.Duration `toml:"concurrent-writes-wait"`
+	BreakerThreshold           int           `toml:"breaker-threshold"`
+	BreakerCooldown            toml.Duration `toml:"breaker-cooldown"`
+	MaxOwnerBacklog            int64         `toml:"max-owner-backlog"`
+	MinOwnerDiskFree           toml.Size     `toml:"min-owner-disk-free"`
+	MaxWritePayloadSize        toml.Size     `toml:"max-write-payload-size"`
+	WriteIdempotencyWindow     int           `toml:"write-idempotency-window"`
+	ShardWriterTransport       string        `toml:"shard-writer-transport"`
+	MaxConcurrentShards        int           `toml:"max-concurrent-shards"`
+	MaxConcurrentShardsPerNode int           `toml:"max-concurrent-shards-per-node"`
+	WriteCompression           string        `toml:"write-compression"`
+	WriteEncoding              string        `toml:"write-encoding"`
+	WriteReplication           string        `toml:"write-replication"`
+	WriteBatchWindow           toml.Duration `toml:"write-batch-window"`
+	WriteBatchMaxPoints        int           `toml:"write-batch-max-points"`
+	MaxClockSkew               toml.Duration `toml:"max-clock-skew"`
+	AuthCacheSize              int           `toml:"auth-cache-size"`
+	AuthCacheTTL               toml.Duration `toml:"auth-cache-ttl"`
+	WritePrecision             string        `toml:"write-precision"`
+	MaxWriteFuture             toml.Duration `toml:"max-write-future"`
+	MaxWritePast               toml.Duration `toml:"max-write-past"`
+
+	// WriteTimeLimits override write-precision, max-write-future and
+	// max-write-past by database and retention policy
+	WriteTimeLimits []WriteTimeLimit `toml:"write-time-limits"`
 }
 
 // NewConfig returns an instance of Config with defaults.
 func NewConfig() Config {
 	return Config{
-		DailTimeout:               toml.Duration(DefaultDialTimeout),
-		PoolMaxIdleTimeout:        toml.Duration(DefaultPoolMaxIdleTimeout),
-		PoolMinStreamsPerNode:     DefaultPoolMinStreamsPerNode,
-		PoolMaxStreamsPerNode:     DefaultPoolMaxStreamsPerNode,
-		ShardReaderTimeout:        toml.Duration(DefaultShardReaderTimeout),
-		ClusterTracing:            false,
-		WriteTimeout:              toml.Duration(DefaultWriteTimeout),
-		QueryTimeout:              toml.Duration(query.DefaultQueryTimeout),
-		MaxConcurrentQueries:      DefaultMaxConcurrentQueries,
-		MaxSelectPointN:           DefaultMaxSelectPointN,
-		MaxSelectSeriesN:          DefaultMaxSelectSeriesN,
-		MetaServices:              []string{DefaultMetaService},
-		PingMetaServiceIntervalMs: 250,
+		DailTimeout:                toml.Duration(DefaultDialTimeout),
+		PoolMaxIdleTimeout:         toml.Duration(DefaultPoolMaxIdleTimeout),
+		PoolMinStreamsPerNode:      DefaultPoolMinStreamsPerNode,
+		PoolMaxStreamsPerNode:      DefaultPoolMaxStreamsPerNode,
+		ShardReaderTimeout:         toml.Duration(DefaultShardReaderTimeout),
+		ClusterTracing:             false,
+		WriteTimeout:               toml.Duration(DefaultWriteTimeout),
+		QueryTimeout:               toml.Duration(query.DefaultQueryTimeout),
+		MaxConcurrentQueries:       DefaultMaxConcurrentQueries,
+		MaxSelectPointN:            DefaultMaxSelectPointN,
+		MaxSelectSeriesN:           DefaultMaxSelectSeriesN,
+		MetaServices:               []string{DefaultMetaService},
+		PingMetaServiceIntervalMs:  250,
+		MetaHealthCheckInterval:    toml.Duration(DefaultMetaHealthCheckInterval),
+		MaxConcurrentWrites:        DefaultMaxConcurrentWrites,
+		MaxConcurrentWritesPerNode: DefaultMaxConcurrentWritesPerNode,
+		ConcurrentWritesWait:       toml.Duration(DefaultConcurrentWritesWait),
+		BreakerThreshold:           DefaultBreakerThreshold,
+		BreakerCooldown:            toml.Duration(DefaultBreakerCooldown),
+		MaxOwnerBacklog:            DefaultMaxOwnerBacklog,
+		MinOwnerDiskFree:           DefaultMinOwnerDiskFree,
+		MaxWritePayloadSize:        DefaultMaxWritePayloadSize,
+		WriteIdempotencyWindow:     DefaultWriteIdempotencyWindow,
+		ShardWriterTransport:       ShardWriterTransportTCP,
+		MaxConcurrentShards:        DefaultMaxConcurrentShards,
+		MaxConcurrentShardsPerNode: DefaultMaxConcurrentShardsPerNode,
+		WriteCompression:           WriteCompressionNone,
+		WriteEncoding:              WriteEncodingNone,
+		WriteReplication:           WriteReplicationSync,
+		WriteBatchMaxPoints:        DefaultWriteBatchMaxPoints,
+		MaxClockSkew:               toml.Duration(DefaultMaxClockSkew),
+		AuthCacheSize:              DefaultAuthCacheSize,
+		AuthCacheTTL:               toml.Duration(DefaultAuthCacheTTL),
+		MaxWriteFuture:             toml.Duration(DefaultMaxWriteFuture),
+		MaxWritePast:               toml.Duration(DefaultMaxWritePast),
+	}
+}
+
+// Validate returns an error if the config is invalid.
+func (c Config) Validate() error {
+	switch c.ShardWriterTransport {
+	case "", ShardWriterTransportTCP, ShardWriterTransportGRPC:
+	default:
+		return fmt.Errorf("unknown shard-writer-transport %q, expect %q or %q",
+			c.ShardWriterTransport, ShardWriterTransportTCP, ShardWriterTransportGRPC)
+	}
+	if _, err := parseWriteCompression(c.WriteCompression); err != nil {
+		return err
+	}
+	if _, err := parseWriteEncoding(c.WriteEncoding); err != nil {
+		return err
+	}
+	switch c.WriteReplication {
+	case "", WriteReplicationSync, WriteReplicationAsync:
+	default:
+		return fmt.Errorf("unknown write-replication %q, expect %q or %q",
+			c.WriteReplication, WriteReplicationSync, WriteReplicationAsync)
+	}
+	if c.WriteBatchWindow < 0 {
+		return errors.New("write-batch-window must not be negative")
+	}
+	if c.WriteBatchMaxPoints < 0 {
+		return errors.New("write-batch-max-points must not be negative")
+	}
+	if c.MetaHealthCheckInterval < 0 {
+		return errors.New("meta-health-check-interval must not be negative")
+	}
+	if c.MaxOwnerBacklog < 0 {
+		return errors.New("max-owner-backlog must not be negative")
+	}
+	if c.MaxWritePayloadSize >= MaxMessageSize {
+		return fmt.Errorf("max-write-payload-size must be less than %d", MaxMessageSize)
+	}
+	if c.MaxClockSkew < 0 {
+		return errors.New("max-clock-skew must not be negative")
+	}
+	if c.AuthCacheSize < 0 {
+		return errors.New("auth-cache-size must not be negative")
+	}
+	if c.AuthCacheSize > 0 && c.AuthCacheTTL <= 0 {
+		return errors.New("auth-cache-ttl must be positive")
+	}
+	if c.MaxWriteFuture < 0 {
+		return errors.New("max-write-future must not be negative")
+	}
+	if c.MaxWritePast < 0 {
+		return errors.New("max-write-past must not be negative")
+	}
+	if _, err := newWriteTimeLimits(c); err != nil {
+		return err
 	}
+	return nil
 }
 
 // Diagnostics returns a diagnostics representation of a subset of the Config.
 func (c Config) Diagnostics() (*diagnostics.Diagnostics, error) {
 	return diagnostics.RowFromMap(map[string]interface{}{
-		"dail-timeout":               c.DailTimeout,
-		"pool-max-idle-time":         c.PoolMaxIdleTimeout,
-		"pool-min-streams-per-node":  c.PoolMinStreamsPerNode,
-		"pool-max-streams-per-node":  c.PoolMaxStreamsPerNode,
-		"shard-reader-timeout":       c.ShardReaderTimeout,
-		"cluster-tracing":            c.ClusterTracing,
-		"write-timeout":              c.WriteTimeout,
-		"max-concurrent-queries":     c.MaxConcurrentQueries,
-		"query-timeout":              c.QueryTimeout,
-		"log-queries-after":          c.LogQueriesAfter,
-		"max-select-point":           c.MaxSelectPointN,
-		"max-select-series":          c.MaxSelectSeriesN,
-		"max-select-buckets":         c.MaxSelectBucketsN,
-		"meta-services":              c.MetaServices,
-		"ping-meta-service-interval": c.PingMetaServiceIntervalMs,
+		"dail-timeout":                   c.DailTimeout,
+		"pool-max-idle-time":             c.PoolMaxIdleTimeout,
+		"pool-min-streams-per-node":      c.PoolMinStreamsPerNode,
+		"pool-max-streams-per-node":      c.PoolMaxStreamsPerNode,
+		"shard-reader-timeout":           c.ShardReaderTimeout,
+		"cluster-tracing":                c.ClusterTracing,
+		"write-timeout":                  c.WriteTimeout,
+		"max-concurrent-queries":         c.MaxConcurrentQueries,
+		"query-timeout":                  c.QueryTimeout,
+		"log-queries-after":              c.LogQueriesAfter,
+		"max-select-point":               c.MaxSelectPointN,
+		"max-select-series":              c.MaxSelectSeriesN,
+		"max-select-buckets":             c.MaxSelectBucketsN,
+		"meta-services":                  c.MetaServices,
+		"ping-meta-service-interval":     c.PingMetaServiceIntervalMs,
+		"meta-health-check-interval":     c.MetaHealthCheckInterval,
+		"max-concurrent-writes":          c.MaxConcurrentWrites,
+		"max-concurrent-writes-per-node": c.MaxConcurrentWritesPerNode,
+		"concurrent-writes-wait":         c.ConcurrentWritesWait,
+		"breaker-threshold":              c.BreakerThreshold,
+		"breaker-cooldown":               c.BreakerCooldown,
+		"max-owner-backlog":              c.MaxOwnerBacklog,
+		"min-owner-disk-free":            c.MinOwnerDiskFree,
+		"max-write-payload-size":         c.MaxWritePayloadSize,
+		"write-idempotency-window":       c.WriteIdempotencyWindow,
+		"shard-writer-transport":         c.ShardWriterTransport,
+		"max-concurrent-shards":          c.MaxConcurrentShards,
+		"max-concurrent-shards-per-node": c.MaxConcurrentShardsPerNode,
+		"write-compression":              c.WriteCompression,
+		"write-encoding":                 c.WriteEncoding,
+		"write-replication":              c.WriteReplication,
+		"write-batch-window":             c.WriteBatchWindow,
+		"write-batch-max-points":         c.WriteBatchMaxPoints,
+		"max-clock-skew":                 c.MaxClockSkew,
+		"auth-cache-size":                c.AuthCacheSize,
+		"auth-cache-ttl":                 c.AuthCacheTTL,
+		"write-precision":                c.WritePrecision,
+		"max-write-future":               c.MaxWriteFuture,
+		"max-write-past":                 c.MaxWritePast,
 	}), nil
 }
@@ -0,0 +1,74 @@
+package coordinator
+
+import (
+	"context"
+	"time"
+
+	"github.com/angopher/chronus/x"
+)
+
+// interruptOnDone fails blocking reads and writes on conn once ctx is done so
+// that requests abandoned by the caller stop waiting for the remote node. The
+// interrupted conn is marked unusable. stop must be called exactly once before
+// conn is closed.
+func interruptOnDone(ctx context.Context, conn x.PooledConn) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			conn.MarkUnusable()
+			conn.SetDeadline(time.Now())
+		case <-stopCh:
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-done
+	}
+}
+
+// detachOnReturn returns a context canceled along with ctx until release is
+// called. Work still going on after release, like writes to replicas beyond
+// the consistency level, is not abandoned by the caller any more.
+func detachOnReturn(ctx context.Context) (detached context.Context, release func()) {
+	if ctx.Done() == nil {
+		return ctx, func() {}
+	}
+	detached, cancel := context.WithCancel(context.Background())
+	if ctx.Err() != nil {
+		cancel()
+		return detached, func() {}
+	}
+	released := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-released:
+		}
+	}()
+	return detached, func() { close(released) }
+}
+
+// remainingTimeout returns def bounded by the time left before the deadline
+// of ctx. Zero def means no limit other than the deadline.
+func remainingTimeout(ctx context.Context, def time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return def
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		// already expired, leave a tiny budget to fail fast
+		d = time.Millisecond
+	}
+	if def > 0 && def < d {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,98 @@
+package coordinator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/x"
+)
+
+// ErrOwnerDiskLow is returned when the owner of a shard has less disk space
+// free than allowed. Writes to other owners are queued by hinted handoff,
+// writes to this node are rejected.
+var ErrOwnerDiskLow = errs.ErrOwnerDiskLow
+
+// diskHeadroomInterval is how long the free space read from the disk is
+// reused, writes don't read it each.
+const diskHeadroomInterval = 5 * time.Second
+
+// DiskHeadroom reads the free space of the disk of the shards of this node.
+// A nil DiskHeadroom reads nothing and is never low.
+type DiskHeadroom struct {
+	path    string
+	minFree int64
+
+	// diskSpace reads the disk, x.DiskSpace unless tests replace it
+	diskSpace func(path string) (free, total int64, err error)
+
+	mu     sync.Mutex
+	free   int64
+	known  bool
+	readAt time.Time
+}
+
+// NewDiskHeadroom returns a DiskHeadroom of the disk of path, low while less
+// than minFree bytes are free. A minFree less than 1 is never low.
+func NewDiskHeadroom(path string, minFree int64) *DiskHeadroom {
+	return &DiskHeadroom{path: path, minFree: minFree, diskSpace: x.DiskSpace}
+}
+
+// Free returns the bytes free on the disk as read at most
+// diskHeadroomInterval before now, ok is false if it can't be read.
+func (h *DiskHeadroom) Free(now time.Time) (free int64, ok bool) {
+	if h == nil {
+		return 0, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if now.Sub(h.readAt) >= diskHeadroomInterval {
+		free, _, err := h.diskSpace(h.path)
+		h.free, h.known, h.readAt = free, err == nil, now
+	}
+	return h.free, h.known
+}
+
+// Low tells whether the disk has less than minFree bytes free at now. A
+// disk whose space can't be read is not low.
+func (h *DiskHeadroom) Low(now time.Time) bool {
+	if h == nil || h.minFree < 1 {
+		return false
+	}
+	free, ok := h.Free(now)
+	return ok && free < h.minFree
+}
+
+// ownerDisks are the disk space owners reported free in their last responses
+// to writes of this node.
+type ownerDisks struct {
+	mu    sync.RWMutex
+	nodes map[uint64]ownerDisk
+}
+
+type ownerDisk struct {
+	free      int64
+	updatedAt time.Time
+}
+
+func newOwnerDisks() *ownerDisks {
+	return &ownerDisks{nodes: make(map[uint64]ownerDisk)}
+}
+
+func (o *ownerDisks) update(nodeID uint64, free int64, now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.nodes[nodeID] = ownerDisk{free: free, updatedAt: now}
+}
+
+// low tells whether node reported less than min bytes free within ttl. A
+// min less than 1 means no threshold.
+func (o *ownerDisks) low(nodeID uint64, min int64, ttl time.Duration, now time.Time) bool {
+	if min < 1 {
+		return false
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	d, ok := o.nodes[nodeID]
+	return ok && d.free < min && now.Sub(d.updatedAt) < ttl
+}
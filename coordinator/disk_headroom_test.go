@@ -0,0 +1,87 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// diskTransport answers writes with the disk space free, counting the
+// writes sent.
+type diskTransport struct {
+	free    int64
+	written int
+}
+
+func (t *diskTransport) WriteShard(ctx context.Context, nodeID uint64, buf []byte) ([]byte, error) {
+	t.written++
+	var resp WriteShardResponse
+	resp.SetCode(0)
+	resp.SetDiskFree(t.free)
+	return resp.MarshalBinary()
+}
+
+func (t *diskTransport) Close() error        { return nil }
+func (t *diskTransport) Stats() []StatEntity { return nil }
+
+func TestShardWriter_OwnerDiskLow(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	transport := &diskTransport{free: 100}
+	w := NewShardWriterWithTransport(transport)
+	w.MetaClient = &grpcMetaClient{}
+	w.SetMinOwnerDiskFree(1000)
+
+	// the first write learns the disk space, the next is held back
+	assert.Nil(t, w.WriteShard(1, 2, []models.Point{pt}))
+	err := w.WriteShard(1, 2, []models.Point{pt})
+	assert.Equal(t, ErrOwnerDiskLow, err)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 1, transport.written)
+
+	// other owners are written to
+	assert.Nil(t, w.WriteShard(1, 3, []models.Point{pt}))
+	assert.Equal(t, 2, transport.written)
+
+	// reports not recent are not trusted
+	w.disks.update(2, 100, time.Now().Add(-DefaultBacklogTTL))
+	assert.Nil(t, w.WriteShard(1, 2, []models.Point{pt}))
+	assert.Equal(t, 3, transport.written)
+}
+
+func TestDiskHeadroom(t *testing.T) {
+	var nilHeadroom *DiskHeadroom
+	assert.False(t, nilHeadroom.Low(time.Now()))
+
+	free, reads := int64(100), 0
+	h := NewDiskHeadroom("/data", 1000)
+	h.diskSpace = func(path string) (int64, int64, error) {
+		reads++
+		return free, 2000, nil
+	}
+	now := time.Now()
+	assert.True(t, h.Low(now))
+
+	// read once per interval
+	free = 5000
+	assert.True(t, h.Low(now.Add(time.Second)))
+	assert.Equal(t, 1, reads)
+	assert.False(t, h.Low(now.Add(diskHeadroomInterval)))
+	assert.Equal(t, 2, reads)
+
+	// disks not read are not low
+	h.diskSpace = func(path string) (int64, int64, error) { return 0, 0, errors.New("unsupported") }
+	assert.False(t, h.Low(now.Add(2*diskHeadroomInterval)))
+	_, ok := h.Free(now.Add(2 * diskHeadroomInterval))
+	assert.False(t, ok)
+
+	s := NewService(Config{})
+	s.DiskHeadroom = NewDiskHeadroom("/data", 1000)
+	s.DiskHeadroom.diskSpace = func(path string) (int64, int64, error) { return 100, 2000, nil }
+	err := s.WriteShardLocal(1, "db0", "rp0", "", nil)
+	assert.True(t, errors.Is(err, ErrOwnerDiskLow))
+	assert.Equal(t, ErrorCodeOverload, ErrorCodeOf(err))
+}
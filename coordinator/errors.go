@@ -0,0 +1,151 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
+
+	"github.com/angopher/chronus/errs"
+)
+
+// ErrorCode classifies errors across cluster RPC, so that the sender of a
+// request decides to retry or drop it by code instead of error text. Codes are
+// sent over the wire and must not be renumbered.
+type ErrorCode int
+
+const (
+	// ErrorCodeOK means no error.
+	ErrorCodeOK ErrorCode = iota
+	// ErrorCodeUnknown is an error not classified, which is also what nodes
+	// before error codes return for any error. It is retryable.
+	ErrorCodeUnknown
+	// ErrorCodeRetryable is a transient failure.
+	ErrorCodeRetryable
+	// ErrorCodeOverload means the node is too busy to serve the request now.
+	ErrorCodeOverload
+	// ErrorCodeShardNotFound means the shard doesn't exist or is being deleted.
+	ErrorCodeShardNotFound
+	// ErrorCodeAuth means the request is not authorized.
+	ErrorCodeAuth
+	// ErrorCodePermanent is a failure retrying never fixes, like field type
+	// conflicts.
+	ErrorCodePermanent
+	// ErrorCodeShardReadOnly means the shard is marked read-only or sealed in
+	// meta.
+	ErrorCodeShardReadOnly
+	// ErrorCodeStaleIncarnation means the requesting node is of a stale
+	// incarnation, replaced by a newer start of it or deleted.
+	ErrorCodeStaleIncarnation
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	ErrorCodeOK:               "ok",
+	ErrorCodeUnknown:          "unknown",
+	ErrorCodeRetryable:        "retryable",
+	ErrorCodeOverload:         "overload",
+	ErrorCodeShardNotFound:    "shard-not-found",
+	ErrorCodeAuth:             "auth",
+	ErrorCodePermanent:        "permanent",
+	ErrorCodeShardReadOnly:    "shard-read-only",
+	ErrorCodeStaleIncarnation: "stale-incarnation",
+}
+
+func (c ErrorCode) String() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("code(%d)", int(c))
+}
+
+// Retryable tells whether the request may succeed later. Unknown codes from
+// newer nodes are retried.
+func (c ErrorCode) Retryable() bool {
+	switch c {
+	case ErrorCodeShardNotFound, ErrorCodeAuth, ErrorCodePermanent, ErrorCodeShardReadOnly, ErrorCodeStaleIncarnation:
+		return false
+	}
+	return true
+}
+
+// RPCError is an error returned by remote node.
+type RPCError struct {
+	Code    ErrorCode
+	Message string
+	// Dropped is the number of points rejected by a partial write, 0 if
+	// unknown.
+	Dropped int
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("error code %d: %s", int(e.Code), e.Message)
+}
+
+// Retryable tells whether the request may succeed later.
+func (e *RPCError) Retryable() bool {
+	if e.Code == ErrorCodeUnknown && strings.Contains(e.Message, "field type conflict") {
+		// nodes before error codes
+		return false
+	}
+	return e.Code.Retryable()
+}
+
+// ErrorCodeOf returns the code of err sent to the requesting node.
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ErrorCodeOK
+	}
+
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code
+	}
+	var partialErr tsdb.PartialWriteError
+	if errors.As(err, &partialErr) {
+		// points dropped by shard are dropped again by retrying
+		return ErrorCodePermanent
+	}
+
+	switch {
+	case errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrTooManyWrites), errors.Is(err, ErrOwnerBacklogged),
+		errors.Is(err, ErrOwnerDiskLow):
+		return ErrorCodeOverload
+	case errors.Is(err, tsdb.ErrShardNotFound), errors.Is(err, tsdb.ErrShardDeletion):
+		return ErrorCodeShardNotFound
+	case errors.Is(err, ErrShardReadOnly), errors.Is(err, ErrShardSealed):
+		return ErrorCodeShardReadOnly
+	case errors.Is(err, ErrStaleIncarnation):
+		return ErrorCodeStaleIncarnation
+	case errors.Is(err, meta.ErrAuthenticate), errors.Is(err, meta.ErrUserNotFound):
+		return ErrorCodeAuth
+	case errors.Is(err, ErrRetry), errors.Is(err, ErrTimeout),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorCodeRetryable
+	}
+
+	switch errs.KindOf(err) {
+	case errs.KindResourceExhausted:
+		return ErrorCodeOverload
+	case errs.KindUnauthorized, errs.KindForbidden:
+		return ErrorCodeAuth
+	case errs.KindUnavailable, errs.KindTimeout:
+		return ErrorCodeRetryable
+	}
+	return ErrorCodeUnknown
+}
+
+// IsRetryable returns false if retrying err never succeeds, the request
+// should be dropped then.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return true
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Retryable()
+	}
+	return ErrorCodeOf(err).Retryable()
+}
@@ -0,0 +1,41 @@
+package coordinator_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/errs"
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	for _, tt := range []struct {
+		err       error
+		code      coordinator.ErrorCode
+		retryable bool
+	}{
+		{nil, coordinator.ErrorCodeOK, true},
+		{errors.New("connection refused"), coordinator.ErrorCodeUnknown, true},
+		{coordinator.ErrCircuitOpen, coordinator.ErrorCodeOverload, true},
+		{coordinator.ErrTooManyWrites, coordinator.ErrorCodeOverload, true},
+		{fmt.Errorf("write shard 1: %w", tsdb.ErrShardNotFound), coordinator.ErrorCodeShardNotFound, false},
+		{fmt.Errorf("write shard 1: %w", tsdb.PartialWriteError{Reason: "field type conflict", Dropped: 1}), coordinator.ErrorCodePermanent, false},
+		{fmt.Errorf("shard 1: %w", coordinator.ErrShardReadOnly), coordinator.ErrorCodeShardReadOnly, false},
+		{fmt.Errorf("authenticate: %w", errs.ErrUserLocked), coordinator.ErrorCodeAuth, false},
+		{errs.Errorf(errs.KindResourceExhausted, "queue of node 2: %w", errs.ErrQueueFull), coordinator.ErrorCodeOverload, true},
+		{&coordinator.RPCError{Code: coordinator.ErrorCodeOverload, Message: "busy"}, coordinator.ErrorCodeOverload, true},
+		{&coordinator.RPCError{Code: coordinator.ErrorCodeAuth, Message: "denied"}, coordinator.ErrorCodeAuth, false},
+		// nodes before error codes
+		{&coordinator.RPCError{Code: coordinator.ErrorCodeUnknown, Message: "write shard 1: field type conflict"}, coordinator.ErrorCodeUnknown, false},
+		{&coordinator.RPCError{Code: coordinator.ErrorCodeUnknown, Message: "engine closed"}, coordinator.ErrorCodeUnknown, true},
+	} {
+		if code := coordinator.ErrorCodeOf(tt.err); code != tt.code {
+			t.Errorf("ErrorCodeOf(%v) = %v, exp %v", tt.err, code, tt.code)
+		}
+		if r := coordinator.IsRetryable(tt.err); r != tt.retryable {
+			t.Errorf("IsRetryable(%v) = %v, exp %v", tt.err, r, tt.retryable)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package coordinator
+
+import (
+	"context"
+	"sync"
+)
+
+// fanoutLimiter limits shards of a query being opened at once on remote
+// nodes. Shards beyond the limit wait for others to be opened. A limit less
+// than 1 means unlimited.
+type fanoutLimiter struct {
+	limit int
+
+	mu       sync.Mutex
+	used     int
+	released chan struct{} // closed when shards are released
+}
+
+func newFanoutLimiter(limit int) *fanoutLimiter {
+	return &fanoutLimiter{
+		limit:    limit,
+		released: make(chan struct{}),
+	}
+}
+
+// chunk returns the number of shards opened at a time out of n wanted,
+// bounded by the limit and perNode.
+func (l *fanoutLimiter) chunk(n, perNode int) int {
+	if perNode > 0 && perNode < n {
+		n = perNode
+	}
+	if l.limit > 0 && l.limit < n {
+		n = l.limit
+	}
+	return n
+}
+
+// acquire takes n slots, which are no more than the limit, until ctx is
+// done. The returned function should be called to release them.
+func (l *fanoutLimiter) acquire(ctx context.Context, n int) (func(), error) {
+	if l.limit < 1 {
+		return func() {}, nil
+	}
+	for {
+		l.mu.Lock()
+		if l.used+n <= l.limit {
+			l.used += n
+			l.mu.Unlock()
+			return func() { l.release(n) }, nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *fanoutLimiter) release(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used -= n
+	close(l.released)
+	l.released = make(chan struct{})
+}
@@ -0,0 +1,54 @@
+package coordinator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanoutLimiter(t *testing.T) {
+	l := newFanoutLimiter(4)
+	assert.Equal(t, 2, l.chunk(10, 2))
+	assert.Equal(t, 4, l.chunk(10, 0))
+	assert.Equal(t, 3, l.chunk(3, 5))
+
+	release1, err := l.acquire(context.Background(), 3)
+	assert.Nil(t, err)
+
+	// queued until enough slots are released
+	acquired := make(chan func())
+	go func() {
+		release, err := l.acquire(context.Background(), 2)
+		assert.Nil(t, err)
+		acquired <- release
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired beyond the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(ctx, 4)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	release1()
+	select {
+	case release2 := <-acquired:
+		release2()
+	case <-time.After(time.Second):
+		t.Fatal("not acquired after release")
+	}
+}
+
+func TestFanoutLimiterUnlimited(t *testing.T) {
+	l := newFanoutLimiter(0)
+	assert.Equal(t, 10, l.chunk(10, 0))
+	for i := 0; i < 3; i++ {
+		_, err := l.acquire(context.Background(), 1000)
+		assert.Nil(t, err)
+	}
+}
@@ -0,0 +1,381 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	errs "github.com/go-errors/errors"
+	"github.com/influxdata/influxdb/services/meta"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// GRPCMuxHeader is the header byte of gRPC connections in the TCP mux.
+const GRPCMuxHeader = 5
+
+const (
+	// grpcCodecName is the content subtype of frames carrying marshaled
+	// requests and responses as they are.
+	grpcCodecName = "chronus"
+
+	grpcWriteShardsMethod = "/chronus.coordinator.ShardWriter/WriteShards"
+
+	// grpcMaxIdleStreams is the number of idle streams kept per node.
+	grpcMaxIdleStreams = 16
+	// grpcNodeIdle is how long connections to nodes not written are kept.
+	grpcNodeIdle = 10 * time.Minute
+	// grpcMaxReconnectDelay bounds backoff reconnecting to a node.
+	grpcMaxReconnectDelay = 5 * time.Second
+)
+
+func init() {
+	encoding.RegisterCodec(frameCodec{})
+}
+
+// grpcFrame is a marshaled WriteShardRequest or WriteShardResponse, the same
+// bytes the TCP protocol sends.
+type grpcFrame struct {
+	data []byte
+}
+
+type frameCodec struct{}
+
+func (frameCodec) Marshal(v interface{}) ([]byte, error) {
+	f, ok := v.(*grpcFrame)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message %T", v)
+	}
+	return f.data, nil
+}
+
+func (frameCodec) Unmarshal(data []byte, v interface{}) error {
+	f, ok := v.(*grpcFrame)
+	if !ok {
+		return fmt.Errorf("unexpected message %T", v)
+	}
+	f.data = append(f.data[:0], data...)
+	return nil
+}
+
+func (frameCodec) Name() string {
+	return grpcCodecName
+}
+
+// grpcShardWriter is implemented by Service serving shard writes over gRPC.
+type grpcShardWriter interface {
+	writeShards(stream grpc.ServerStream) error
+}
+
+var grpcShardWriterDesc = grpc.ServiceDesc{
+	ServiceName: "chronus.coordinator.ShardWriter",
+	HandlerType: (*grpcShardWriter)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "WriteShards",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(grpcShardWriter).writeShards(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
+
+func (s *Service) newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.MaxRecvMsgSize(MaxMessageSize), grpc.MaxSendMsgSize(MaxMessageSize))
+	srv.RegisterService(&grpcShardWriterDesc, s)
+	return srv
+}
+
+// writeShards answers every write request of stream in order.
+func (s *Service) writeShards(stream grpc.ServerStream) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.Logger.Error("recover from panic", zap.String("stack", errs.Wrap(r, 2).ErrorStack()))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	var req, resp grpcFrame
+	for {
+		if err := stream.RecvMsg(&req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		_, r, _ := s.handleRequest(writeShardRequestMessage, req.data)
+		if resp.data, err = r.MarshalBinary(); err != nil {
+			s.Logger.Error("error marshalling response", zap.Error(err))
+			return err
+		}
+		if err := stream.SendMsg(&resp); err != nil {
+			return err
+		}
+	}
+}
+
+// GRPCTransport writes shards over gRPC, as an alternative to the cluster TCP
+// protocol. Writes to a node are multiplexed on a single HTTP/2 connection
+// through long lived streams, their payload is compressed with gzip.
+type GRPCTransport struct {
+	timeout     time.Duration
+	dialTimeout time.Duration
+	metaClient  interface {
+		DataNode(id uint64) (*meta.NodeInfo, error)
+	}
+
+	mu        sync.Mutex
+	nodes     map[uint64]*grpcNode
+	lastSweep time.Time
+	closed    bool
+}
+
+type grpcNode struct {
+	conn *grpc.ClientConn
+
+	mu      sync.Mutex
+	idle    []*grpcStream
+	active  int
+	lastUse time.Time
+}
+
+// grpcStream is a stream of write requests, each answered before the next one
+// is sent.
+type grpcStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	stream grpc.ClientStream
+}
+
+// NewGRPCTransport returns a transport giving up writes after timeout, with
+// addresses of nodes from metaClient.
+func NewGRPCTransport(timeout, dialTimeout time.Duration, metaClient interface {
+	DataNode(id uint64) (*meta.NodeInfo, error)
+}) *GRPCTransport {
+	return &GRPCTransport{
+		timeout:     timeout,
+		dialTimeout: dialTimeout,
+		metaClient:  metaClient,
+		nodes:       make(map[uint64]*grpcNode),
+	}
+}
+
+func (t *GRPCTransport) WriteShard(ctx context.Context, nodeID uint64, req []byte) ([]byte, error) {
+	node, err := t.node(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	st := node.get()
+
+	var timer <-chan time.Time
+	if timeout := remainingTimeout(ctx, t.timeout); timeout > 0 {
+		tm := time.NewTimer(timeout)
+		defer tm.Stop()
+		timer = tm.C
+	}
+
+	type result struct {
+		resp []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := st.roundTrip(node.conn, req)
+		done <- result{resp, err}
+	}()
+
+	select {
+	case r := <-done:
+		node.put(st, r.err == nil)
+		return r.resp, r.err
+	case <-ctx.Done():
+		node.put(st, false)
+		return nil, ctx.Err()
+	case <-timer:
+		node.put(st, false)
+		return nil, fmt.Errorf("write to node %d: %w", nodeID, ErrTimeout)
+	}
+}
+
+// node returns the connection to node, dialed lazily. Connections to nodes not
+// written for long are closed.
+func (t *GRPCTransport) node(nodeID uint64) (*grpcNode, error) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, fmt.Errorf("client already closed")
+	}
+
+	if now.Sub(t.lastSweep) > grpcNodeIdle {
+		for id, n := range t.nodes {
+			if n.idleSince(now) > grpcNodeIdle {
+				n.close()
+				delete(t.nodes, id)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	if n := t.nodes[nodeID]; n != nil {
+		return n, nil
+	}
+	conn, err := grpc.Dial(fmt.Sprintf("node-%d", nodeID),
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return t.dial(ctx, nodeID)
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.Config{BaseDelay: time.Second, Multiplier: 1.6, Jitter: 0.2, MaxDelay: grpcMaxReconnectDelay},
+			MinConnectTimeout: t.dialTimeout,
+		}),
+		grpc.WithDefaultCallOptions(
+			grpc.CallContentSubtype(grpcCodecName),
+			grpc.UseCompressor(gzip.Name),
+			grpc.MaxCallRecvMsgSize(MaxMessageSize),
+			grpc.MaxCallSendMsgSize(MaxMessageSize),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	n := &grpcNode{conn: conn, lastUse: now}
+	t.nodes[nodeID] = n
+	return n, nil
+}
+
+// dial connects to the address of node every time, which may change while
+// the connection is kept.
+func (t *GRPCTransport) dial(ctx context.Context, nodeID uint64) (net.Conn, error) {
+	ni, err := t.metaClient.DataNode(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if ni == nil {
+		return nil, fmt.Errorf("node %d does not exist", nodeID)
+	}
+
+	d := net.Dialer{Timeout: t.dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", ni.TCPHost)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{GRPCMuxHeader}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (t *GRPCTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return fmt.Errorf("client already closed")
+	}
+	t.closed = true
+	for id, n := range t.nodes {
+		n.close()
+		delete(t.nodes, id)
+	}
+	return nil
+}
+
+func (t *GRPCTransport) Stats() []StatEntity {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make([]StatEntity, 0, len(t.nodes))
+	for id, n := range t.nodes {
+		stat := StatEntity{NodeId: id}
+		n.mu.Lock()
+		stat.Stat.Active = n.active
+		stat.Stat.Idle = len(n.idle)
+		n.mu.Unlock()
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+func (n *grpcNode) get() *grpcStream {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.active++
+	n.lastUse = time.Now()
+	if len(n.idle) > 0 {
+		st := n.idle[len(n.idle)-1]
+		n.idle = n.idle[:len(n.idle)-1]
+		return st
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &grpcStream{ctx: ctx, cancel: cancel}
+}
+
+// put returns st to idle streams if it's still usable, it's closed otherwise.
+func (n *grpcNode) put(st *grpcStream, ok bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.active--
+	if ok && len(n.idle) < grpcMaxIdleStreams {
+		n.idle = append(n.idle, st)
+		return
+	}
+	if ok {
+		st.close()
+		return
+	}
+	// the round trip may be going on
+	st.cancel()
+}
+
+func (n *grpcNode) idleSince(now time.Time) time.Duration {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.active > 0 {
+		return 0
+	}
+	return now.Sub(n.lastUse)
+}
+
+func (n *grpcNode) close() {
+	n.mu.Lock()
+	for _, st := range n.idle {
+		st.close()
+	}
+	n.idle = nil
+	n.mu.Unlock()
+	n.conn.Close()
+}
+
+// roundTrip sends req and waits for its response, opening the stream first if
+// needed. It must not be called concurrently.
+func (s *grpcStream) roundTrip(conn *grpc.ClientConn, req []byte) ([]byte, error) {
+	if s.stream == nil {
+		stream, err := conn.NewStream(s.ctx, &grpcShardWriterDesc.Streams[0], grpcWriteShardsMethod)
+		if err != nil {
+			return nil, err
+		}
+		s.stream = stream
+	}
+	if err := s.stream.SendMsg(&grpcFrame{data: req}); err != nil {
+		return nil, err
+	}
+	var resp grpcFrame
+	if err := s.stream.RecvMsg(&resp); err != nil {
+		return nil, err
+	}
+	return resp.data, nil
+}
+
+// close ends the stream, it must not be in a round trip.
+func (s *grpcStream) close() {
+	if s.stream != nil {
+		s.stream.CloseSend()
+	}
+	s.cancel()
+}
@@ -0,0 +1,141 @@
+package coordinator
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tcp"
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+type writeStore struct {
+	TSDBStore
+	WriteFn func(shardID uint64, points []models.Point) error
+}
+
+func (s *writeStore) WriteToShard(shardID uint64, points []models.Point) error {
+	return s.WriteFn(shardID, points)
+}
+
+type grpcMetaClient struct {
+	addr string
+}
+
+func (c *grpcMetaClient) DataNode(id uint64) (*meta.NodeInfo, error) {
+	return &meta.NodeInfo{ID: id, TCPHost: c.addr}, nil
+}
+
+func (c *grpcMetaClient) ShardOwner(shardID uint64) (string, string, *meta.ShardGroupInfo) {
+	return "db0", "rp0", &meta.ShardGroupInfo{ID: 1}
+}
+
+// newGRPCShardWriter returns a ShardWriter over gRPC to a Service writing to
+// store as node 1.
+func newGRPCShardWriter(t *testing.T, store TSDBStore, timeout time.Duration) (*ShardWriter, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := tcp.NewMux()
+	go mux.Serve(ln)
+
+	srv := NewService(Config{})
+	srv.TSDBStore = store
+	srv.Listener = mux.Listen(MuxHeader)
+	srv.GRPCListener = mux.Listen(GRPCMuxHeader)
+	if err := srv.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	mc := &grpcMetaClient{addr: ln.Addr().String()}
+	w := NewShardWriterWithTransport(NewGRPCTransport(timeout, time.Second, mc))
+	w.MetaClient = mc
+	return w, func() {
+		w.Close()
+		ln.Close()
+		srv.Close()
+	}
+}
+
+func TestGRPCTransport_WriteShard(t *testing.T) {
+	var mu sync.Mutex
+	written := make(map[uint64]int)
+	store := &writeStore{WriteFn: func(shardID uint64, points []models.Point) error {
+		mu.Lock()
+		defer mu.Unlock()
+		written[shardID] += len(points)
+		return nil
+	}}
+	w, closeFn := newGRPCShardWriter(t, store, 5*time.Second)
+	defer closeFn()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := w.WriteShard(imeta.ShardID(i%4), 1, []models.Point{pt, pt}); err != nil {
+					t.Errorf("WriteShard() failed: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for id := uint64(0); id < 4; id++ {
+		if exp := 100; written[id] != exp {
+			t.Fatalf("points of shard %d: got %d, exp %d", id, written[id], exp)
+		}
+	}
+	// streams are reused
+	if stats := w.Stats(); len(stats) != 1 || stats[0].Stat.Active != 0 || stats[0].Stat.Idle == 0 || stats[0].Stat.Idle > 20 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestGRPCTransport_WriteShardError(t *testing.T) {
+	store := &writeStore{WriteFn: func(shardID uint64, points []models.Point) error {
+		return tsdb.PartialWriteError{Reason: "field type conflict", Dropped: 1}
+	}}
+	w, closeFn := newGRPCShardWriter(t, store, 5*time.Second)
+	defer closeFn()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	err := w.WriteShard(1, 1, []models.Point{pt})
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != ErrorCodePermanent || rpcErr.Dropped != 1 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGRPCTransport_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	var calls int32
+	store := &writeStore{WriteFn: func(shardID uint64, points []models.Point) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-block
+		}
+		return nil
+	}}
+	w, closeFn := newGRPCShardWriter(t, store, 200*time.Millisecond)
+	defer closeFn()
+	defer close(block)
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	if err := w.WriteShard(1, 1, []models.Point{pt}); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the stream timed out is dropped, writes go on with others
+	if err := w.WriteShard(1, 1, []models.Point{pt}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+}
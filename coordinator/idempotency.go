@@ -0,0 +1,133 @@
+package coordinator
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// writeKeysIdle is how long keys of a shard not written any more are kept,
+// retries come much sooner.
+const writeKeysIdle = time.Hour
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns a context writing points with key. Owners of a
+// shard skip points written with a key they applied to the shard recently, so
+// that retrying a write which timed out doesn't write its points twice.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// IdempotencyKey returns the key of writes with ctx, empty if none.
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key
+}
+
+// WriteKeys remembers the idempotency keys of the last writes applied to each
+// shard of the node. It's shared by local writes of PointsWriter and writes
+// received by Service. A nil WriteKeys remembers nothing.
+type WriteKeys struct {
+	mu        sync.Mutex
+	window    int
+	shards    map[uint64]*keyWindow
+	lastSweep time.Time
+}
+
+// keyWindow is a ring of the last keys of a shard, along with the keys of
+// writes going on.
+type keyWindow struct {
+	keys    []string
+	next    int
+	seen    map[string]struct{}
+	pending map[string]chan struct{}
+	updated time.Time
+}
+
+// NewWriteKeys returns WriteKeys remembering window keys per shard, nil if
+// window is not positive.
+func NewWriteKeys(window int) *WriteKeys {
+	if window <= 0 {
+		return nil
+	}
+	return &WriteKeys{
+		window: window,
+		shards: make(map[uint64]*keyWindow),
+	}
+}
+
+// Reserve reserves key for a write to shard, returning false if key was
+// applied to the shard recently and the write is to be skipped. A retry
+// reserving the key of a write going on waits for it, so that it's skipped
+// once the write is applied or written otherwise. Reserved keys must be
+// released by Done.
+func (k *WriteKeys) Reserve(shardID uint64, key string) bool {
+	if k == nil || key == "" {
+		return true
+	}
+	k.mu.Lock()
+	for {
+		w := k.shards[shardID]
+		if w == nil {
+			w = &keyWindow{seen: make(map[string]struct{}), pending: make(map[string]chan struct{})}
+			k.shards[shardID] = w
+		}
+		if _, ok := w.seen[key]; ok {
+			k.mu.Unlock()
+			return false
+		}
+		done, ok := w.pending[key]
+		if !ok {
+			w.pending[key] = make(chan struct{})
+			w.updated = time.Now()
+			k.mu.Unlock()
+			return true
+		}
+		k.mu.Unlock()
+		<-done
+		k.mu.Lock()
+	}
+}
+
+// Done releases key reserved for a write to shard, recording it applied if
+// the write is, evicting the oldest key of the shard beyond the window. Keys
+// of shards idle for long are forgotten.
+func (k *WriteKeys) Done(shardID uint64, key string, applied bool) {
+	if k == nil || key == "" {
+		return
+	}
+	now := time.Now()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	w := k.shards[shardID]
+	if w == nil {
+		return
+	}
+	if done, ok := w.pending[key]; ok {
+		delete(w.pending, key)
+		close(done)
+	}
+	w.updated = now
+	if applied {
+		if _, ok := w.seen[key]; !ok {
+			if len(w.keys) < k.window {
+				w.keys = append(w.keys, key)
+			} else {
+				delete(w.seen, w.keys[w.next])
+				w.keys[w.next] = key
+				w.next = (w.next + 1) % k.window
+			}
+			w.seen[key] = struct{}{}
+		}
+	}
+
+	if now.Sub(k.lastSweep) > writeKeysIdle {
+		for id, w := range k.shards {
+			if len(w.pending) == 0 && now.Sub(w.updated) > writeKeysIdle {
+				delete(k.shards, id)
+			}
+		}
+		k.lastSweep = now
+	}
+}
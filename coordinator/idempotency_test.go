@@ -0,0 +1,82 @@
+package coordinator
+
+import (
+	"testing"
+	"time"
+)
+
+// addKey records key applied to shard.
+func addKey(keys *WriteKeys, shardID uint64, key string) {
+	if keys.Reserve(shardID, key) {
+		keys.Done(shardID, key, true)
+	}
+}
+
+// seenKey tells whether a write to shard with key would be skipped.
+func seenKey(keys *WriteKeys, shardID uint64, key string) bool {
+	if keys.Reserve(shardID, key) {
+		keys.Done(shardID, key, false)
+		return false
+	}
+	return true
+}
+
+func TestWriteKeys_Window(t *testing.T) {
+	keys := NewWriteKeys(2)
+	addKey(keys, 1, "a")
+	addKey(keys, 1, "b")
+	addKey(keys, 2, "c")
+	if !seenKey(keys, 1, "a") || !seenKey(keys, 1, "b") || !seenKey(keys, 2, "c") {
+		t.Fatal("keys added not seen")
+	}
+	if seenKey(keys, 2, "a") {
+		t.Fatal("key seen by another shard")
+	}
+
+	// the oldest key of the shard is evicted
+	addKey(keys, 1, "d")
+	if seenKey(keys, 1, "a") || !seenKey(keys, 1, "b") || !seenKey(keys, 1, "d") {
+		t.Fatal("unexpected keys after eviction")
+	}
+
+	// no key and disabled window never are seen
+	addKey(keys, 1, "")
+	if seenKey(keys, 1, "") {
+		t.Fatal("empty key seen")
+	}
+	disabled := NewWriteKeys(0)
+	addKey(disabled, 1, "a")
+	if seenKey(disabled, 1, "a") {
+		t.Fatal("key seen by disabled window")
+	}
+}
+
+func TestWriteKeys_Reserve(t *testing.T) {
+	keys := NewWriteKeys(2)
+	if !keys.Reserve(1, "a") {
+		t.Fatal("key not reserved")
+	}
+
+	// a retry waits for the write going on
+	retried := make(chan bool)
+	go func() { retried <- keys.Reserve(1, "a") }()
+	select {
+	case <-retried:
+		t.Fatal("retry not waiting for the write going on")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// and writes itself if the write failed
+	keys.Done(1, "a", false)
+	if !<-retried {
+		t.Fatal("retry of a failed write skipped")
+	}
+
+	// or is skipped once the write is applied
+	go func() { retried <- keys.Reserve(1, "a") }()
+	time.Sleep(10 * time.Millisecond)
+	keys.Done(1, "a", true)
+	if <-retried {
+		t.Fatal("retry of an applied write not skipped")
+	}
+}
@@ -36,6 +36,12 @@ type WriteShardRequest struct {
 	Points           [][]byte `protobuf:"bytes,2,rep,name=Points" json:"Points,omitempty"`
 	Database         *string  `protobuf:"bytes,3,opt,name=Database" json:"Database,omitempty"`
 	RetentionPolicy  *string  `protobuf:"bytes,4,opt,name=RetentionPolicy" json:"RetentionPolicy,omitempty"`
+	IdempotencyKey   *string  `protobuf:"bytes,5,opt,name=IdempotencyKey" json:"IdempotencyKey,omitempty"`
+	Compression      *int32   `protobuf:"varint,6,opt,name=Compression" json:"Compression,omitempty"`
+	Block            []byte   `protobuf:"bytes,7,opt,name=Block" json:"Block,omitempty"`
+	Encoding         *int32   `protobuf:"varint,8,opt,name=Encoding" json:"Encoding,omitempty"`
+	NodeID           *uint64  `protobuf:"varint,9,opt,name=NodeID" json:"NodeID,omitempty"`
+	Incarnation      *uint64  `protobuf:"varint,10,opt,name=Incarnation" json:"Incarnation,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -71,9 +77,57 @@ func (m *WriteShardRequest) GetRetentionPolicy() string {
 	return ""
 }
 
+func (m *WriteShardRequest) GetIdempotencyKey() string {
+	if m != nil && m.IdempotencyKey != nil {
+		return *m.IdempotencyKey
+	}
+	return ""
+}
+
+func (m *WriteShardRequest) GetCompression() int32 {
+	if m != nil && m.Compression != nil {
+		return *m.Compression
+	}
+	return 0
+}
+
+func (m *WriteShardRequest) GetBlock() []byte {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+func (m *WriteShardRequest) GetEncoding() int32 {
+	if m != nil && m.Encoding != nil {
+		return *m.Encoding
+	}
+	return 0
+}
+
+func (m *WriteShardRequest) GetNodeID() uint64 {
+	if m != nil && m.NodeID != nil {
+		return *m.NodeID
+	}
+	return 0
+}
+
+func (m *WriteShardRequest) GetIncarnation() uint64 {
+	if m != nil && m.Incarnation != nil {
+		return *m.Incarnation
+	}
+	return 0
+}
+
 type WriteShardResponse struct {
 	Code             *int32  `protobuf:"varint,1,req,name=Code" json:"Code,omitempty"`
 	Message          *string `protobuf:"bytes,2,opt,name=Message" json:"Message,omitempty"`
+	Dropped          *int64  `protobuf:"varint,3,opt,name=Dropped" json:"Dropped,omitempty"`
+	Compressions     []int32 `protobuf:"varint,4,rep,name=Compressions" json:"Compressions,omitempty"`
+	Encodings        []int32 `protobuf:"varint,5,rep,name=Encodings" json:"Encodings,omitempty"`
+	BacklogWrites    *int64  `protobuf:"varint,6,opt,name=BacklogWrites" json:"BacklogWrites,omitempty"`
+	BacklogPoints    *int64  `protobuf:"varint,7,opt,name=BacklogPoints" json:"BacklogPoints,omitempty"`
+	DiskFree         *int64  `protobuf:"varint,8,opt,name=DiskFree" json:"DiskFree,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
@@ -95,6 +149,48 @@ func (m *WriteShardResponse) GetMessage() string {
 	return ""
 }
 
+func (m *WriteShardResponse) GetDropped() int64 {
+	if m != nil && m.Dropped != nil {
+		return *m.Dropped
+	}
+	return 0
+}
+
+func (m *WriteShardResponse) GetCompressions() []int32 {
+	if m != nil {
+		return m.Compressions
+	}
+	return nil
+}
+
+func (m *WriteShardResponse) GetEncodings() []int32 {
+	if m != nil {
+		return m.Encodings
+	}
+	return nil
+}
+
+func (m *WriteShardResponse) GetBacklogWrites() int64 {
+	if m != nil && m.BacklogWrites != nil {
+		return *m.BacklogWrites
+	}
+	return 0
+}
+
+func (m *WriteShardResponse) GetBacklogPoints() int64 {
+	if m != nil && m.BacklogPoints != nil {
+		return *m.BacklogPoints
+	}
+	return 0
+}
+
+func (m *WriteShardResponse) GetDiskFree() int64 {
+	if m != nil && m.DiskFree != nil {
+		return *m.DiskFree
+	}
+	return 0
+}
+
 type ExecuteStatementRequest struct {
 	Statement        *string `protobuf:"bytes,1,req,name=Statement" json:"Statement,omitempty"`
 	Database         *string `protobuf:"bytes,2,req,name=Database" json:"Database,omitempty"`
@@ -148,6 +244,7 @@ type CreateIteratorRequest struct {
 	Opt              []byte   `protobuf:"bytes,2,req,name=Opt" json:"Opt,omitempty"`
 	Measurement []byte `protobuf:"bytes,3,req,name=Measurement" json:"Measurement,omitempty"`
 	SpanContext []byte `protobuf:"bytes,4,opt,name=SpanContext" json:"SpanContext,omitempty"`
+	Timeout          *int64   `protobuf:"varint,5,opt,name=Timeout" json:"Timeout,omitempty"`
 	XXX_unrecognized []byte   `json:"-"`
 }
 
@@ -183,6 +280,13 @@ func (m *CreateIteratorRequest) GetSpanContext() []byte {
 	return nil
 }
 
+func (m *CreateIteratorRequest) GetTimeout() int64 {
+	if m != nil && m.Timeout != nil {
+		return *m.Timeout
+	}
+	return 0
+}
+
 type CreateIteratorResponse struct {
 	Err              *string `protobuf:"bytes,1,opt,name=Err" json:"Err,omitempty"`
 	DataType             *int32  `protobuf:"varint,1,req,name=DataType" json:"DataType,omitempty"`
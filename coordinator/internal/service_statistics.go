@@ -11,9 +11,11 @@ const (
 	writeShardReq       = "writeShardReq"
 	writeShardPointsReq = "writeShardPointsReq"
 	writeShardFail      = "writeShardFail"
+	writeShardDuplicate = "writeShardDuplicate"
 
-	createIteratorReq  = "createIteratorReq"
-	createIteratorFail = "createIteratorFail"
+	createIteratorReq      = "createIteratorReq"
+	createIteratorFail     = "createIteratorFail"
+	createIteratorCanceled = "createIteratorCanceled"
 
 	fieldDimensionsReq  = "fieldDimensionsReq"
 	fieldDimensionsFail = "fieldDimensionsFail"
@@ -35,15 +37,19 @@ const (
 
 	mapTypeReq  = "mapTypeReq"
 	mapTypeFail = "mapTypeFail"
+
+	readsRejected = "readsRejected"
 )
 
 type InternalServiceStatistics struct {
 	WriteShardReq       int64
 	WriteShardPointsReq int64
 	WriteShardFail      int64
+	WriteShardDuplicate int64
 
-	CreateIteratorReq  int64
-	CreateIteratorFail int64
+	CreateIteratorReq      int64
+	CreateIteratorFail     int64
+	CreateIteratorCanceled int64
 
 	FieldDimensionsReq  int64
 	FieldDimensionsFail int64
@@ -65,6 +71,9 @@ type InternalServiceStatistics struct {
 
 	MapTypeReq  int64
 	MapTypeFail int64
+
+	// ReadsRejected counts reads of other nodes rejected while drained
+	ReadsRejected int64
 }
 
 func Statistics(stats *InternalServiceStatistics, tags map[string]string) []models.Statistic {
@@ -75,9 +84,11 @@ func Statistics(stats *InternalServiceStatistics, tags map[string]string) []mode
 			writeShardReq:       atomic.LoadInt64(&stats.WriteShardReq),
 			writeShardPointsReq: atomic.LoadInt64(&stats.WriteShardPointsReq),
 			writeShardFail:      atomic.LoadInt64(&stats.WriteShardFail),
+			writeShardDuplicate: atomic.LoadInt64(&stats.WriteShardDuplicate),
 
-			createIteratorReq:  atomic.LoadInt64(&stats.CreateIteratorReq),
-			createIteratorFail: atomic.LoadInt64(&stats.CreateIteratorFail),
+			createIteratorReq:      atomic.LoadInt64(&stats.CreateIteratorReq),
+			createIteratorFail:     atomic.LoadInt64(&stats.CreateIteratorFail),
+			createIteratorCanceled: atomic.LoadInt64(&stats.CreateIteratorCanceled),
 
 			fieldDimensionsReq:  atomic.LoadInt64(&stats.FieldDimensionsReq),
 			fieldDimensionsFail: atomic.LoadInt64(&stats.FieldDimensionsFail),
@@ -99,6 +110,8 @@ func Statistics(stats *InternalServiceStatistics, tags map[string]string) []mode
 
 			mapTypeReq:  atomic.LoadInt64(&stats.MapTypeReq),
 			mapTypeFail: atomic.LoadInt64(&stats.MapTypeFail),
+
+			readsRejected: atomic.LoadInt64(&stats.ReadsRejected),
 		},
 	}}
 }
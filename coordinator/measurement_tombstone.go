@@ -0,0 +1,61 @@
+package coordinator
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/logging"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// measurementTombstoneRetry is the interval tombstones failed to apply are
+// retried, changes of meta data apply new ones at once.
+const measurementTombstoneRetry = time.Minute
+
+// MeasurementTombstones is the part of imeta.MetaClient with the drops of
+// measurements data nodes apply.
+type MeasurementTombstones interface {
+	MeasurementTombstones(nodeID uint64) []imeta.MeasurementTombstone
+	AckMeasurementTombstone(id, nodeID uint64) error
+	WaitForDataChanged() chan struct{}
+}
+
+var _ MeasurementTombstones = imeta.MetaClient(nil)
+
+// applyMeasurementTombstones drops the measurements of tombstones this node
+// hasn't applied, e.g. dropped while it was down, in the order of the drops.
+func (s *Service) applyMeasurementTombstones() error {
+	for _, t := range s.MeasurementTombstones.MeasurementTombstones(s.Node.ID) {
+		if err := s.TSDBStore.DeleteMeasurement(t.Database, t.Name); err != nil {
+			return fmt.Errorf("drop measurement %s of %s: %w", t.Name, t.Database, err)
+		}
+		if err := s.MeasurementTombstones.AckMeasurementTombstone(t.ID, s.Node.ID); err != nil {
+			return err
+		}
+		s.Logger.Info("Applied measurement tombstone", logging.Database(t.Database),
+			zap.String("measurement", t.Name), zap.Time("dropped_at", t.DroppedAt))
+	}
+	return nil
+}
+
+// measurementTombstonesLoop applies tombstones as they are synced from meta.
+func (s *Service) measurementTombstonesLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(measurementTombstoneRetry)
+	defer ticker.Stop()
+	for {
+		changed := s.MeasurementTombstones.WaitForDataChanged()
+		select {
+		case <-s.closing:
+			return
+		case <-changed:
+		case <-ticker.C:
+		}
+		if err := s.applyMeasurementTombstones(); err != nil {
+			s.Logger.Warn("Failed to apply measurement tombstones", zap.Error(err))
+		}
+	}
+}
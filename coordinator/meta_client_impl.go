@@ -6,10 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/influxdata/influxdb/services/meta"
@@ -39,18 +39,28 @@ var (
 
 type MetaClientImpl struct {
 	Addrs []string
+	// HealthCheckInterval is the time a meta server failing is skipped for,
+	// DefaultMetaHealthCheckInterval if not set
+	HealthCheckInterval time.Duration
+
+	endpointsOnce sync.Once
+	metaEndpoints *metaEndpoints
+
+	stats MetaCommitStatistics
 }
 
 //	return &MetaClientImpl{MetaServiceHost: "127.0.0.1:1234"}
 
+// Url returns the url of path on the leader of meta servers if healthy, or on
+// another meta server healthy.
 func (me *MetaClientImpl) Url(path string) string {
-	return fmt.Sprintf("http://%s%s", me.Addrs[rand.Intn(len(me.Addrs))], path)
+	return fmt.Sprintf("http://%s%s", me.endpoints().pick(nil, time.Now()), path)
 }
 
 func (me *MetaClientImpl) AcquireLease(NodeID uint64, name string) (*meta.Lease, error) {
 	req := raftmeta.AcquireLeaseReq{Name: name, NodeId: NodeID}
 	var resp raftmeta.AcquireLeaseResp
-	err := RequestAndParseResponse(me.Url(raftmeta.ACQUIRE_LEASE_PATH), &req, &resp)
+	err := me.request(raftmeta.ACQUIRE_LEASE_PATH, &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +81,7 @@ func (me *MetaClientImpl) ClusterID() uint64 {
 
 func (me *MetaClientImpl) Data() (*imeta.Data, error) {
 	var resp raftmeta.DataResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DATA_PATH), "", &resp)
+	err := me.request(raftmeta.DATA_PATH, "", &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -88,24 +98,31 @@ func (me *MetaClientImpl) Data() (*imeta.Data, error) {
 	return data, nil
 }
 
-func (me *MetaClientImpl) Ping() (uint64, error) {
+// Ping returns the meta index of meta servers, and the skew of their clock
+// to the local one, 0 if they don't tell their time.
+func (me *MetaClientImpl) Ping() (uint64, time.Duration, error) {
 	var resp raftmeta.PingResp
-	err := RequestAndParseResponse(me.Url(raftmeta.PING_PATH), "", &resp)
+	sent := time.Now()
+	err := me.request(raftmeta.PING_PATH, "", &resp)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	if resp.RetCode != 0 {
-		return 0, errors.New(resp.RetMsg)
+		return 0, 0, errors.New(resp.RetMsg)
 	}
 
-	return resp.Index, nil
+	var skew time.Duration
+	if resp.Time != 0 {
+		skew = clockSkew(sent, time.Now(), time.Unix(0, resp.Time))
+	}
+	return resp.Index, skew, nil
 }
 
 func (me *MetaClientImpl) CreateDatabase(name string) (*meta.DatabaseInfo, error) {
 	req := raftmeta.CreateDatabaseReq{Name: name}
 	var resp raftmeta.CreateDatabaseResp
-	err := RequestAndParseResponse(me.Url(raftmeta.CREATE_DATABASE_PATH), &req, &resp)
+	err := me.request(raftmeta.CREATE_DATABASE_PATH, &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +139,7 @@ func (me *MetaClientImpl) CreateDatabase(name string) (*meta.DatabaseInfo, error
 func (me *MetaClientImpl) DeleteDataNode(id uint64) error {
 	req := raftmeta.DeleteDataNodeReq{Id: id}
 	var resp raftmeta.DeleteDataNodeResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DELETE_DATA_NODE_PATH), &req, &resp)
+	err := me.request(raftmeta.DELETE_DATA_NODE_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -137,7 +154,7 @@ func (me *MetaClientImpl) DeleteDataNode(id uint64) error {
 func (me *MetaClientImpl) freezeDataNode(id uint64, freeze bool) error {
 	req := raftmeta.FreezeDataNodeReq{Id: id, Freeze: freeze}
 	var resp raftmeta.FreezeDataNodeResp
-	err := RequestAndParseResponse(me.Url(raftmeta.FREEZE_DATA_NODE_PATH), &req, &resp)
+	err := me.request(raftmeta.FREEZE_DATA_NODE_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -155,14 +172,14 @@ func (me *MetaClientImpl) UnfreezeDataNode(id uint64) error {
 	return me.freezeDataNode(id, false)
 }
 
-func (me *MetaClientImpl) AddShardOwner(shardID, nodeID uint64) error {
+func (me *MetaClientImpl) AddShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error {
 	req := raftmeta.AddShardOwnerReq{
-		ShardID: shardID,
-		NodeID:  nodeID,
+		ShardID: uint64(shardID),
+		NodeID:  uint64(nodeID),
 	}
 
 	var resp raftmeta.AddShardOwnerResp
-	err := RequestAndParseResponse(me.Url(raftmeta.ADD_SHARD_OWNER), &req, &resp)
+	err := me.request(raftmeta.ADD_SHARD_OWNER, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -173,14 +190,198 @@ func (me *MetaClientImpl) AddShardOwner(shardID, nodeID uint64) error {
 	return nil
 }
 
-func (me *MetaClientImpl) RemoveShardOwner(shardID, nodeID uint64) error {
+func (me *MetaClientImpl) RemoveShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error {
 	req := raftmeta.RemoveShardOwnerReq{
+		ShardID: uint64(shardID),
+		NodeID:  uint64(nodeID),
+	}
+
+	var resp raftmeta.RemoveShardOwnerResp
+	err := me.request(raftmeta.REMOVE_SHARD_OWNER, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	return nil
+}
+
+func (me *MetaClientImpl) BeginShardCutover(shardID, nodeID uint64, expiration time.Time) error {
+	req := raftmeta.BeginShardCutoverReq{
+		ShardID:    shardID,
+		NodeID:     nodeID,
+		Expiration: expiration,
+	}
+
+	var resp raftmeta.BeginShardCutoverResp
+	err := me.request(raftmeta.BEGIN_SHARD_CUTOVER_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	return nil
+}
+
+func (me *MetaClientImpl) EndShardCutover(shardID uint64) error {
+	req := raftmeta.EndShardCutoverReq{
+		ShardID: shardID,
+	}
+
+	var resp raftmeta.EndShardCutoverResp
+	err := me.request(raftmeta.END_SHARD_CUTOVER_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	return nil
+}
+
+func (me *MetaClientImpl) MarkShardsStale(nodeID uint64, shardIDs []uint64) error {
+	req := raftmeta.MarkShardsStaleReq{
+		NodeID:   nodeID,
+		ShardIDs: shardIDs,
+		Time:     time.Now().UTC(),
+	}
+
+	var resp raftmeta.MarkShardsStaleResp
+	err := me.request(raftmeta.MARK_SHARDS_STALE_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	return nil
+}
+
+func (me *MetaClientImpl) ClearStaleShard(shardID, nodeID uint64) error {
+	req := raftmeta.ClearStaleShardReq{
 		ShardID: shardID,
 		NodeID:  nodeID,
 	}
 
-	var resp raftmeta.RemoveShardOwnerResp
-	err := RequestAndParseResponse(me.Url(raftmeta.REMOVE_SHARD_OWNER), &req, &resp)
+	var resp raftmeta.ClearStaleShardResp
+	err := me.request(raftmeta.CLEAR_STALE_SHARD_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	return nil
+}
+
+func (me *MetaClientImpl) SealShardGroups(grace time.Duration) (int, error) {
+	req := raftmeta.SealShardGroupsReq{
+		Grace: grace,
+		Time:  time.Now().UTC(),
+	}
+
+	var resp raftmeta.SealShardGroupsResp
+	err := me.request(raftmeta.SEAL_SHARD_GROUPS_PATH, &req, &resp)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.RetCode != 0 {
+		return 0, errors.New(resp.RetMsg)
+	}
+	return resp.Sealed, nil
+}
+
+func (me *MetaClientImpl) SetSealedShardChecksum(shardID uint64, checksum uint32, diverged bool) error {
+	req := raftmeta.SetSealedShardChecksumReq{
+		ShardID:  shardID,
+		Checksum: checksum,
+		Diverged: diverged,
+		Time:     time.Now().UTC(),
+	}
+
+	var resp raftmeta.SetSealedShardChecksumResp
+	err := me.request(raftmeta.SET_SEALED_SHARD_CHECKSUM_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	return nil
+}
+
+func (me *MetaClientImpl) CreateMeasurementTombstone(database, name string) (*imeta.MeasurementTombstone, error) {
+	req := raftmeta.CreateMeasurementTombstoneReq{
+		Database: database,
+		Name:     name,
+		Time:     time.Now().UTC(),
+	}
+
+	var resp raftmeta.CreateMeasurementTombstoneResp
+	err := me.request(raftmeta.CREATE_MEASUREMENT_TOMBSTONE_PATH, &req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.RetCode != 0 {
+		return nil, errors.New(resp.RetMsg)
+	}
+	return &resp.Tombstone, nil
+}
+
+func (me *MetaClientImpl) AckMeasurementTombstone(id, nodeID uint64) error {
+	req := raftmeta.AckMeasurementTombstoneReq{
+		ID:     id,
+		NodeID: nodeID,
+		Time:   time.Now().UTC(),
+	}
+
+	var resp raftmeta.AckMeasurementTombstoneResp
+	err := me.request(raftmeta.ACK_MEASUREMENT_TOMBSTONE_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	return nil
+}
+
+func (me *MetaClientImpl) FreezeShardGroups(id string, until time.Time) ([]byte, error) {
+	req := raftmeta.FreezeShardGroupsReq{
+		ID:    id,
+		Until: until,
+	}
+
+	var resp raftmeta.FreezeShardGroupsResp
+	err := me.request(raftmeta.FREEZE_SHARD_GROUPS_PATH, &req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.RetCode != 0 {
+		return nil, errors.New(resp.RetMsg)
+	}
+	return resp.Data, nil
+}
+
+func (me *MetaClientImpl) ThawShardGroups(id string) error {
+	req := raftmeta.ThawShardGroupsReq{
+		ID: id,
+	}
+
+	var resp raftmeta.ThawShardGroupsResp
+	err := me.request(raftmeta.THAW_SHARD_GROUPS_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -199,7 +400,7 @@ func (me *MetaClientImpl) CreateShardGroup(database, policy string, timestamp ti
 	}
 
 	var resp raftmeta.CreateShardGroupResp
-	err := RequestAndParseResponse(me.Url(raftmeta.CREATE_SHARD_GROUP_PATH), &req, &resp)
+	err := me.request(raftmeta.CREATE_SHARD_GROUP_PATH, &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -213,6 +414,26 @@ func (me *MetaClientImpl) CreateShardGroup(database, policy string, timestamp ti
 	return sg, nil
 }
 
+func (me *MetaClientImpl) CreateShardGroupsForRange(database, policy string, start, end time.Time) ([]meta.ShardGroupInfo, error) {
+	req := raftmeta.CreateShardGroupsForRangeReq{
+		Database: database,
+		Policy:   policy,
+		Start:    start,
+		End:      end,
+	}
+
+	var resp raftmeta.CreateShardGroupsForRangeResp
+	err := me.request(raftmeta.CREATE_SHARD_GROUPS_FOR_RANGE_PATH, &req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.RetCode != 0 {
+		return nil, errors.New(resp.RetMsg)
+	}
+	return resp.ShardGroups, nil
+}
+
 func (me *MetaClientImpl) CreateDataNode(httpAddr, tcpAddr string) (*meta.NodeInfo, error) {
 	req := raftmeta.CreateDataNodeReq{
 		HttpAddr: httpAddr,
@@ -220,7 +441,7 @@ func (me *MetaClientImpl) CreateDataNode(httpAddr, tcpAddr string) (*meta.NodeIn
 	}
 
 	var resp raftmeta.CreateDataNodeResp
-	err := RequestAndParseResponse(me.Url(raftmeta.CREATE_DATA_NODE_PATH), &req, &resp)
+	err := me.request(raftmeta.CREATE_DATA_NODE_PATH, &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -234,6 +455,24 @@ func (me *MetaClientImpl) CreateDataNode(httpAddr, tcpAddr string) (*meta.NodeIn
 	return ni, nil
 }
 
+func (me *MetaClientImpl) RegisterDataNode(id uint64) (uint64, error) {
+	req := raftmeta.RegisterDataNodeReq{
+		Id:   id,
+		Time: time.Now().UTC(),
+	}
+
+	var resp raftmeta.RegisterDataNodeResp
+	err := me.request(raftmeta.REGISTER_DATA_NODE_PATH, &req, &resp)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.RetCode != 0 {
+		return 0, errors.New(resp.RetMsg)
+	}
+	return resp.Incarnation, nil
+}
+
 func (me *MetaClientImpl) CreateDatabaseWithRetentionPolicy(name string, spec *meta.RetentionPolicySpec) (*meta.DatabaseInfo, error) {
 	replica := 1
 	if spec.ReplicaN != nil {
@@ -255,7 +494,7 @@ func (me *MetaClientImpl) CreateDatabaseWithRetentionPolicy(name string, spec *m
 		},
 	}
 	var resp raftmeta.CreateDatabaseWithRetentionPolicyResp
-	err := RequestAndParseResponse(me.Url(raftmeta.CREATE_DATABASE_WITH_RETENTION_POLICY_PATH), &req, &resp)
+	err := me.request(raftmeta.CREATE_DATABASE_WITH_RETENTION_POLICY_PATH, &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -269,10 +508,25 @@ func (me *MetaClientImpl) CreateDatabaseWithRetentionPolicy(name string, spec *m
 	return db, nil
 }
 
+func (me *MetaClientImpl) CreateDatabaseFromTemplate(name, template string) (*meta.DatabaseInfo, error) {
+	req := raftmeta.CreateDatabaseFromTemplateReq{Name: name, Template: template}
+	var resp raftmeta.CreateDatabaseFromTemplateResp
+	err := me.request(raftmeta.CREATE_DATABASE_FROM_TEMPLATE_PATH, &req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.RetCode != 0 {
+		return nil, errors.New(resp.RetMsg)
+	}
+
+	return &resp.DbInfo, nil
+}
+
 func (me *MetaClientImpl) CreateContinuousQuery(database, name, query string) error {
 	req := raftmeta.CreateContinuousQueryReq{Database: database, Name: name, Query: query}
 	var resp raftmeta.CreateContinuousQueryResp
-	err := RequestAndParseResponse(me.Url(raftmeta.CREATE_CONTINUOUS_QUERY_PATH), &req, &resp)
+	err := me.request(raftmeta.CREATE_CONTINUOUS_QUERY_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -306,7 +560,7 @@ func (me *MetaClientImpl) CreateRetentionPolicy(database string, spec *meta.Rete
 		MakeDefault: makeDefault,
 	}
 	var resp raftmeta.CreateRetentionPolicyResp
-	err := RequestAndParseResponse(me.Url(raftmeta.CREATE_RETENTION_POLICY_PATH), &req, &resp)
+	err := me.request(raftmeta.CREATE_RETENTION_POLICY_PATH, &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -329,7 +583,7 @@ func (me *MetaClientImpl) CreateSubscription(database, rp, name, mode string, de
 		Destinations: destinations,
 	}
 	var resp raftmeta.CreateSubscriptionResp
-	err := RequestAndParseResponse(me.Url(raftmeta.CREATE_SUBSCRIPTION_PATH), &req, &resp)
+	err := me.request(raftmeta.CREATE_SUBSCRIPTION_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -344,7 +598,7 @@ func (me *MetaClientImpl) CreateSubscription(database, rp, name, mode string, de
 func (me *MetaClientImpl) CreateUser(name, password string, admin bool) (meta.User, error) {
 	req := raftmeta.CreateUserReq{Name: name, Password: password, Admin: admin}
 	var resp raftmeta.CreateUserResp
-	err := RequestAndParseResponse(me.Url(raftmeta.CREATE_USER_PATH), &req, &resp)
+	err := me.request(raftmeta.CREATE_USER_PATH, &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -361,7 +615,7 @@ func (me *MetaClientImpl) CreateUser(name, password string, admin bool) (meta.Us
 func (me *MetaClientImpl) DropShard(id uint64) error {
 	req := raftmeta.DropShardReq{Id: id}
 	var resp raftmeta.DropShardResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DROP_SHARD_PATH), &req, &resp)
+	err := me.request(raftmeta.DROP_SHARD_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -376,7 +630,7 @@ func (me *MetaClientImpl) DropShard(id uint64) error {
 func (me *MetaClientImpl) DropContinuousQuery(database, name string) error {
 	req := raftmeta.DropContinuousQueryReq{Database: database, Name: name}
 	var resp raftmeta.DropContinuousQueryResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DROP_CONTINUOUS_QUERY_PATH), &req, &resp)
+	err := me.request(raftmeta.DROP_CONTINUOUS_QUERY_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -391,7 +645,7 @@ func (me *MetaClientImpl) DropContinuousQuery(database, name string) error {
 func (me *MetaClientImpl) DropDatabase(name string) error {
 	req := raftmeta.DropDatabaseReq{Name: name}
 	var resp raftmeta.DropDatabaseResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DROP_DATABASE_PATH), &req, &resp)
+	err := me.request(raftmeta.DROP_DATABASE_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -406,7 +660,7 @@ func (me *MetaClientImpl) DropDatabase(name string) error {
 func (me *MetaClientImpl) DropRetentionPolicy(database, name string) error {
 	req := raftmeta.DropRetentionPolicyReq{Database: database, Policy: name}
 	var resp raftmeta.DropRetentionPolicyResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DROP_RETENTION_POLICY_PATH), &req, &resp)
+	err := me.request(raftmeta.DROP_RETENTION_POLICY_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -421,7 +675,7 @@ func (me *MetaClientImpl) DropRetentionPolicy(database, name string) error {
 func (me *MetaClientImpl) DropSubscription(database, rp, name string) error {
 	req := raftmeta.DropSubscriptionReq{Database: database, Rp: rp, Name: name}
 	var resp raftmeta.DropSubscriptionResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DROP_SUBSCRIPTION_PATH), &req, &resp)
+	err := me.request(raftmeta.DROP_SUBSCRIPTION_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -435,7 +689,7 @@ func (me *MetaClientImpl) DropSubscription(database, rp, name string) error {
 func (me *MetaClientImpl) DropUser(name string) error {
 	req := raftmeta.DropUserReq{Name: name}
 	var resp raftmeta.DropUserResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DROP_USER_PATH), &req, &resp)
+	err := me.request(raftmeta.DROP_USER_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -450,7 +704,7 @@ func (me *MetaClientImpl) DropUser(name string) error {
 func (me *MetaClientImpl) SetAdminPrivilege(username string, admin bool) error {
 	req := raftmeta.SetAdminPrivilegeReq{UserName: username, Admin: admin}
 	var resp raftmeta.SetAdminPrivilegeResp
-	err := RequestAndParseResponse(me.Url(raftmeta.SET_ADMIN_PRIVILEGE), &req, &resp)
+	err := me.request(raftmeta.SET_ADMIN_PRIVILEGE, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -465,7 +719,37 @@ func (me *MetaClientImpl) SetAdminPrivilege(username string, admin bool) error {
 func (me *MetaClientImpl) SetPrivilege(username, database string, p influxql.Privilege) error {
 	req := raftmeta.SetPrivilegeReq{UserName: username, Database: database, Privilege: p}
 	var resp raftmeta.SetPrivilegeResp
-	err := RequestAndParseResponse(me.Url(raftmeta.SET_PRIVILEGE_PATH), &req, &resp)
+	err := me.request(raftmeta.SET_PRIVILEGE_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	return nil
+}
+
+func (me *MetaClientImpl) SetOperatorRole(username string, role imeta.OperatorRole) error {
+	req := raftmeta.SetOperatorRoleReq{UserName: username, Role: role}
+	var resp raftmeta.SetOperatorRoleResp
+	err := me.request(raftmeta.SET_OPERATOR_ROLE_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+
+	return nil
+}
+
+func (me *MetaClientImpl) SetMeasurementPrivilege(username, database, pattern string, p influxql.Privilege) error {
+	req := raftmeta.SetMeasurementPrivilegeReq{UserName: username, Database: database, Pattern: pattern, Privilege: p}
+	var resp raftmeta.SetMeasurementPrivilegeResp
+	err := me.request(raftmeta.SET_MEASUREMENT_PRIVILEGE_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -480,7 +764,7 @@ func (me *MetaClientImpl) SetPrivilege(username, database string, p influxql.Pri
 func (me *MetaClientImpl) TruncateShardGroups(t time.Time) error {
 	req := raftmeta.TruncateShardGroupsReq{Time: t}
 	var resp raftmeta.TruncateShardGroupsResp
-	err := RequestAndParseResponse(me.Url(raftmeta.TRUNCATE_SHARD_GROUPS_PATH), &req, &resp)
+	err := me.request(raftmeta.TRUNCATE_SHARD_GROUPS_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -494,7 +778,7 @@ func (me *MetaClientImpl) TruncateShardGroups(t time.Time) error {
 func (me *MetaClientImpl) DeleteShardGroup(database, policy string, id uint64) error {
 	req := raftmeta.DeleteShardGroupReq{Database: database, Policy: policy, Id: id}
 	var resp raftmeta.DeleteShardGroupResp
-	err := RequestAndParseResponse(me.Url(raftmeta.DELETE_SHARD_GROUP_PATH), &req, &resp)
+	err := me.request(raftmeta.DELETE_SHARD_GROUP_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -506,8 +790,8 @@ func (me *MetaClientImpl) DeleteShardGroup(database, policy string, id uint64) e
 }
 
 func (me *MetaClientImpl) PruneShardGroups() error {
-	var resp raftmeta.TruncateShardGroupsResp
-	err := RequestAndParseResponse(me.Url(raftmeta.PRUNE_SHARD_GROUPS_PATH), "", &resp)
+	var resp raftmeta.PruneShardGroupsResp
+	err := me.request(raftmeta.PRUNE_SHARD_GROUPS_PATH, &raftmeta.PruneShardGroupsReq{}, &resp)
 	if err != nil {
 		return err
 	}
@@ -521,7 +805,7 @@ func (me *MetaClientImpl) PruneShardGroups() error {
 func (me *MetaClientImpl) PrecreateShardGroups(from, to time.Time) error {
 	req := raftmeta.PrecreateShardGroupsReq{From: from, To: to}
 	var resp raftmeta.PrecreateShardGroupsResp
-	err := RequestAndParseResponse(me.Url(raftmeta.PRECREATE_SHARD_GROUPS_PATH), &req, &resp)
+	err := me.request(raftmeta.PRECREATE_SHARD_GROUPS_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -564,7 +848,7 @@ func (me *MetaClientImpl) UpdateRetentionPolicy(database, name string, rpu *meta
 		},
 	}
 	var resp raftmeta.UpdateRetentionPolicyResp
-	err := RequestAndParseResponse(me.Url(raftmeta.UPDATE_RETENTION_POLICY_PATH), &req, &resp)
+	err := me.request(raftmeta.UPDATE_RETENTION_POLICY_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -579,7 +863,7 @@ func (me *MetaClientImpl) UpdateRetentionPolicy(database, name string, rpu *meta
 func (me *MetaClientImpl) UpdateUser(name, password string) error {
 	req := raftmeta.UpdateUserReq{Name: name, Password: password}
 	var resp raftmeta.UpdateUserResp
-	err := RequestAndParseResponse(me.Url(raftmeta.UPDATE_USER_PATH), &req, &resp)
+	err := me.request(raftmeta.UPDATE_USER_PATH, &req, &resp)
 	if err != nil {
 		return err
 	}
@@ -594,7 +878,7 @@ func (me *MetaClientImpl) UpdateUser(name, password string) error {
 func (me *MetaClientImpl) Authenticate(username, password string) (meta.User, error) {
 	req := raftmeta.AuthenticateReq{UserName: username, Password: password}
 	var resp raftmeta.AuthenticateResp
-	err := RequestAndParseResponse(me.Url(raftmeta.AUTHENTICATE_PATH), &req, &resp)
+	err := me.request(raftmeta.AUTHENTICATE_PATH, &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -608,6 +892,34 @@ func (me *MetaClientImpl) Authenticate(username, password string) (meta.User, er
 	return user, nil
 }
 
+func (me *MetaClientImpl) CreateSession(username string, ttl time.Duration) (string, time.Time, error) {
+	req := raftmeta.CreateSessionReq{UserName: username, TTL: ttl}
+	var resp raftmeta.CreateSessionResp
+	err := me.request(raftmeta.CREATE_SESSION_PATH, &req, &resp)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if resp.RetCode != 0 {
+		return "", time.Time{}, errors.New(resp.RetMsg)
+	}
+	return resp.Token, resp.Expiration, nil
+}
+
+func (me *MetaClientImpl) DropSession(hash string) error {
+	req := raftmeta.DropSessionReq{Hash: hash}
+	var resp raftmeta.DropSessionResp
+	err := me.request(raftmeta.DROP_SESSION_PATH, &req, &resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.RetCode != 0 {
+		return errors.New(resp.RetMsg)
+	}
+	return nil
+}
+
 func RequestAndParseResponse(url string, data interface{}, resp interface{}) error {
 	reqBody, err := json.Marshal(data)
 	if err != nil {
@@ -0,0 +1,20 @@
+package coordinator
+
+import (
+	"testing"
+)
+
+// Any MetaClient, e.g. a mock, can be given to consumers of meta data.
+func TestMetaClient_Consumers(t *testing.T) {
+	var m MetaClient = &ClusterMetaClient{}
+
+	_ = &PointsWriter{MetaClient: m, ShardCutovers: m}
+	_ = &ShardWriter{MetaClient: m}
+	_ = &ClusterExecutor{MetaClient: m}
+	_ = &ClusterShardMapper{MetaClient: m}
+	_ = &ClusterShardMapping{MetaClient: m}
+	_ = &StatementExecutor{MetaClient: m}
+	_ = &Service{MetaClient: m}
+	_ = &ClientConnFactory{metaClient: m}
+	_ = NewGRPCTransport(0, 0, m)
+}
@@ -0,0 +1,78 @@
+package coordinator
+
+import (
+	"sync/atomic"
+
+	"github.com/influxdata/influxdb/models"
+
+	"github.com/angopher/chronus/raftmeta"
+)
+
+// Statistics of changes of meta data requested by this node.
+const (
+	statMetaCommits         = "commits"
+	statMetaCommitConflicts = "commitConflicts"
+	statMetaCommitRetries   = "commitRetries"
+	statMetaCommitAborts    = "commitAborts"
+)
+
+// MetaCommitStatistics counts changes of meta data requested by this node,
+// high conflicts and retries tell meta data churns, e.g. storms of shard
+// groups created by writes of many nodes at once.
+type MetaCommitStatistics struct {
+	// Commits counts changes committed by meta servers
+	Commits int64
+	// CommitConflicts counts changes made already by other requests once
+	// committed, like shard groups created meanwhile by other writes
+	CommitConflicts int64
+	// CommitRetries counts changes retried on another meta server as they
+	// didn't reach one
+	CommitRetries int64
+	// CommitAborts counts changes failed, rejected by meta servers or whose
+	// requests failed
+	CommitAborts int64
+}
+
+// readPaths are the paths of meta servers not changing meta data.
+var readPaths = map[string]bool{
+	raftmeta.DATA_PATH: true,
+	raftmeta.PING_PATH: true,
+}
+
+// failed tells whether resp is the response of a request rejected by a meta
+// server.
+func failed(resp interface{}) bool {
+	r, ok := resp.(interface{ Failed() bool })
+	return ok && r.Failed()
+}
+
+// observe counts a request to path, done once after retries tries, by its
+// err and resp.
+func (s *MetaCommitStatistics) observe(path string, retries int, resp interface{}, err error) {
+	if readPaths[path] {
+		return
+	}
+	if retries > 0 {
+		atomic.AddInt64(&s.CommitRetries, int64(retries))
+	}
+	if err != nil || failed(resp) {
+		atomic.AddInt64(&s.CommitAborts, 1)
+		return
+	}
+	atomic.AddInt64(&s.Commits, 1)
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (me *ClusterMetaClient) Statistics(tags map[string]string) []models.Statistic {
+	s := &me.metaCli.stats
+	return []models.Statistic{{
+		Name: "meta_client",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statMetaCommits:         atomic.LoadInt64(&s.Commits),
+			statMetaCommitConflicts: atomic.LoadInt64(&s.CommitConflicts),
+			statMetaCommitRetries:   atomic.LoadInt64(&s.CommitRetries),
+			statMetaCommitAborts:    atomic.LoadInt64(&s.CommitAborts),
+		},
+	}}
+}
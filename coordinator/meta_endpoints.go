@@ -0,0 +1,201 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/angopher/chronus/raftmeta"
+)
+
+// DefaultMetaHealthCheckInterval is the default interval of checking meta
+// servers and discovering their leader, also the time a meta server failing
+// is skipped for.
+const DefaultMetaHealthCheckInterval = 10 * time.Second
+
+// MetaEndpoint is the health of a meta server as a client sees it.
+type MetaEndpoint struct {
+	Addr    string `json:"addr"`
+	Healthy bool   `json:"healthy"`
+	Leader  bool   `json:"leader"`
+	// Error of the last request failed
+	Error string `json:"error,omitempty"`
+}
+
+// metaEndpoints are the meta servers a client requests. Servers failing are
+// skipped until checked healthy again or some time passed, the leader is
+// preferred to spare the forwarding of proposals by followers.
+type metaEndpoints struct {
+	mu        sync.Mutex
+	addrs     []string
+	downUntil map[string]time.Time
+	errors    map[string]string
+	leader    string
+	downFor   time.Duration
+}
+
+func newMetaEndpoints(addrs []string, downFor time.Duration) *metaEndpoints {
+	if downFor <= 0 {
+		downFor = DefaultMetaHealthCheckInterval
+	}
+	return &metaEndpoints{
+		addrs:     addrs,
+		downUntil: make(map[string]time.Time),
+		errors:    make(map[string]string),
+		downFor:   downFor,
+	}
+}
+
+// pick returns the leader if healthy, a random healthy server otherwise, or a
+// random one if all are down. Servers tried are skipped unless all are.
+func (e *metaEndpoints) pick(tried map[string]bool, now time.Time) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leader != "" && !tried[e.leader] && !e.down(e.leader, now) {
+		return e.leader
+	}
+	var healthy, untried []string
+	for _, addr := range e.addrs {
+		if tried[addr] {
+			continue
+		}
+		untried = append(untried, addr)
+		if !e.down(addr, now) {
+			healthy = append(healthy, addr)
+		}
+	}
+	if len(healthy) > 0 {
+		return healthy[rand.Intn(len(healthy))]
+	} else if len(untried) > 0 {
+		return untried[rand.Intn(len(untried))]
+	}
+	return ""
+}
+
+func (e *metaEndpoints) down(addr string, now time.Time) bool {
+	until, ok := e.downUntil[addr]
+	return ok && now.Before(until)
+}
+
+func (e *metaEndpoints) markDown(addr string, err error, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.downUntil[addr] = now.Add(e.downFor)
+	e.errors[addr] = err.Error()
+	if e.leader == addr {
+		e.leader = ""
+	}
+}
+
+func (e *metaEndpoints) markUp(addr string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.downUntil, addr)
+	delete(e.errors, addr)
+}
+
+// setLeader prefers addr if it's one of the servers configured, a leader
+// not configured is not requested.
+func (e *metaEndpoints) setLeader(addr string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = ""
+	for _, a := range e.addrs {
+		if a == addr {
+			e.leader = addr
+		}
+	}
+}
+
+func (e *metaEndpoints) status(now time.Time) []MetaEndpoint {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := make([]MetaEndpoint, 0, len(e.addrs))
+	for _, addr := range e.addrs {
+		status = append(status, MetaEndpoint{
+			Addr:    addr,
+			Healthy: !e.down(addr, now),
+			Leader:  addr == e.leader,
+			Error:   e.errors[addr],
+		})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Addr < status[j].Addr })
+	return status
+}
+
+// unsent tells whether err is of a request which never reached the server,
+// so that it's safe to retry on another one.
+func unsent(err error) bool {
+	var op *net.OpError
+	return errors.As(err, &op) && op.Op == "dial"
+}
+
+func (me *MetaClientImpl) endpoints() *metaEndpoints {
+	me.endpointsOnce.Do(func() {
+		me.metaEndpoints = newMetaEndpoints(me.Addrs, me.HealthCheckInterval)
+	})
+	return me.metaEndpoints
+}
+
+// request posts req to path of a meta server and parses its response into
+// resp. Requests which can't reach a server are retried on the others.
+func (me *MetaClientImpl) request(path string, req interface{}, resp interface{}) (err error) {
+	eps := me.endpoints()
+	tried := make(map[string]bool, len(me.Addrs))
+	defer func() { me.stats.observe(path, len(tried)-1, resp, err) }()
+	for {
+		addr := eps.pick(tried, time.Now())
+		if addr == "" {
+			return fmt.Errorf("no meta server available of %v", me.Addrs)
+		}
+		tried[addr] = true
+		err := RequestAndParseResponse(fmt.Sprintf("http://%s%s", addr, path), req, resp)
+		if err == nil {
+			eps.markUp(addr)
+			return nil
+		}
+		if _, ok := err.(net.Error); ok {
+			eps.markDown(addr, err, time.Now())
+		}
+		if !unsent(err) {
+			return err
+		}
+	}
+}
+
+// CheckEndpoints pings all meta servers, marking the ones not answering down,
+// and discovers the leader from a healthy one following its redirect.
+func (me *MetaClientImpl) CheckEndpoints() []MetaEndpoint {
+	eps := me.endpoints()
+	var healthy []string
+	for _, addr := range me.Addrs {
+		var resp raftmeta.PingResp
+		if err := RequestAndParseResponse(fmt.Sprintf("http://%s%s", addr, raftmeta.PING_PATH), "", &resp); err != nil {
+			eps.markDown(addr, err, time.Now())
+			continue
+		}
+		eps.markUp(addr)
+		healthy = append(healthy, addr)
+	}
+
+	var leader string
+	for _, addr := range healthy {
+		var resp raftmeta.LeaderResp
+		err := RequestAndParseResponse(fmt.Sprintf("http://%s%s", addr, raftmeta.LEADER_PATH), "", &resp)
+		if err == nil && resp.RetCode == 0 {
+			leader = resp.Addr
+			break
+		}
+	}
+	eps.setLeader(leader)
+	return eps.status(time.Now())
+}
+
+// Endpoints returns the health of meta servers as last seen.
+func (me *MetaClientImpl) Endpoints() []MetaEndpoint {
+	return me.endpoints().status(time.Now())
+}
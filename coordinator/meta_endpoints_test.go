@@ -0,0 +1,119 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angopher/chronus/raftmeta"
+)
+
+func TestMetaClientImpl_Failover(t *testing.T) {
+	var leaderAddr string
+	var leaderReqs, followerReqs int64
+	reply := func(w http.ResponseWriter, v interface{}) {
+		json.NewEncoder(w).Encode(v)
+	}
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case raftmeta.LEADER_PATH:
+			reply(w, &raftmeta.LeaderResp{CommonResp: raftmeta.CommonResp{RetMsg: "ok"}, ID: 1, Addr: leaderAddr})
+		case raftmeta.PING_PATH:
+			atomic.AddInt64(&leaderReqs, 1)
+			reply(w, &raftmeta.PingResp{CommonResp: raftmeta.CommonResp{RetMsg: "ok"}, Index: 2})
+		}
+	}))
+	defer leader.Close()
+	leaderAddr = strings.TrimPrefix(leader.URL, "http://")
+
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case raftmeta.LEADER_PATH:
+			http.Redirect(w, r, leader.URL+raftmeta.LEADER_PATH, http.StatusTemporaryRedirect)
+		case raftmeta.PING_PATH:
+			atomic.AddInt64(&followerReqs, 1)
+			reply(w, &raftmeta.PingResp{CommonResp: raftmeta.CommonResp{RetMsg: "ok"}, Index: 1})
+		}
+	}))
+	defer follower.Close()
+	followerAddr := strings.TrimPrefix(follower.URL, "http://")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	deadAddr := l.Addr().String()
+	l.Close()
+
+	// requests not reaching a meta server go to another
+	cli := &MetaClientImpl{Addrs: []string{deadAddr, followerAddr}}
+	for i := 0; i < 5; i++ {
+		index, _, err := cli.Ping()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), index)
+	}
+	eps := cli.Endpoints()
+	assert.Equal(t, 2, len(eps))
+	for _, ep := range eps {
+		assert.Equal(t, ep.Addr == followerAddr, ep.Healthy, ep.Addr)
+	}
+
+	// the leader is discovered through the redirect of the follower
+	cli = &MetaClientImpl{Addrs: []string{deadAddr, followerAddr, leaderAddr}}
+	for _, ep := range cli.CheckEndpoints() {
+		assert.Equal(t, ep.Addr != deadAddr, ep.Healthy, ep.Addr)
+		assert.Equal(t, ep.Addr == leaderAddr, ep.Leader, ep.Addr)
+	}
+	leaderPings, followerPings := atomic.LoadInt64(&leaderReqs), atomic.LoadInt64(&followerReqs)
+	for i := 0; i < 5; i++ {
+		index, _, err := cli.Ping()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), index)
+	}
+	assert.Equal(t, leaderPings+5, atomic.LoadInt64(&leaderReqs))
+	assert.Equal(t, followerPings, atomic.LoadInt64(&followerReqs))
+
+	// no meta server available
+	cli = &MetaClientImpl{Addrs: []string{deadAddr}}
+	_, _, err = cli.Ping()
+	assert.NotNil(t, err)
+}
+
+func TestMetaClientImpl_CommitStatistics(t *testing.T) {
+	var reject int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &raftmeta.CreateDatabaseResp{CommonResp: raftmeta.CommonResp{RetMsg: "ok"}}
+		if atomic.LoadInt32(&reject) == 1 {
+			resp.RetCode, resp.RetMsg = -1, "fail"
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	deadAddr := l.Addr().String()
+	l.Close()
+
+	cli := &MetaClientImpl{Addrs: []string{deadAddr, strings.TrimPrefix(server.URL, "http://")}}
+	cli.endpoints().setLeader(deadAddr)
+	for i := 0; i < 3; i++ {
+		_, err := cli.CreateDatabase("db0")
+		assert.Nil(t, err)
+	}
+	atomic.StoreInt32(&reject, 1)
+	_, err = cli.CreateDatabase("db0")
+	assert.NotNil(t, err)
+	// pings don't change meta data
+	cli.Ping()
+
+	assert.Equal(t, int64(3), atomic.LoadInt64(&cli.stats.Commits))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&cli.stats.CommitAborts))
+	// the dead server is retried once, skipped afterwards
+	assert.Equal(t, int64(1), atomic.LoadInt64(&cli.stats.CommitRetries))
+	assert.Equal(t, int64(0), atomic.LoadInt64(&cli.stats.CommitConflicts))
+}
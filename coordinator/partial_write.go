@@ -0,0 +1,102 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/influxdb/tsdb"
+)
+
+// maxPartialWriteReasons limits the reasons listed by a partial write error,
+// the rest are only counted.
+const maxPartialWriteReasons = 5
+
+// shardRejectError is returned by writeToShard when owners rejected points of
+// the shard, like field type conflicts.
+type shardRejectError struct {
+	reasons []string
+	// dropped is the most points rejected by an owner
+	dropped int
+}
+
+func (e *shardRejectError) Error() string {
+	return strings.Join(e.reasons, "; ")
+}
+
+// add records the rejection of points by owner of shard.
+func (e *shardRejectError) add(shardID, nodeID uint64, dropped int, err error) {
+	e.reasons = append(e.reasons, fmt.Sprintf("shard %d node %d: %s", shardID, nodeID, firstLine(rejectReason(err))))
+	if dropped > e.dropped {
+		e.dropped = dropped
+	}
+}
+
+// rejectedPoints returns the number of points rejected by err writing n points
+// to a shard owner. False is returned if err is not a rejection of points.
+func rejectedPoints(err error, n int) (int, bool) {
+	var partialErr tsdb.PartialWriteError
+	if errors.As(err, &partialErr) {
+		return partialErr.Dropped, true
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && !rpcErr.Retryable() &&
+		rpcErr.Code != ErrorCodeShardNotFound && rpcErr.Code != ErrorCodeAuth {
+		if rpcErr.Dropped > 0 {
+			return rpcErr.Dropped, true
+		}
+		// nodes before dropped counts
+		return n, true
+	}
+	return 0, false
+}
+
+func rejectReason(err error) string {
+	var partialErr tsdb.PartialWriteError
+	if errors.As(err, &partialErr) {
+		return partialErr.Reason
+	}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Message
+	}
+	return err.Error()
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// partialWrite collects points dropped by shards of a write into a single
+// tsdb.PartialWriteError, which is reported to clients as such.
+type partialWrite struct {
+	reasons []string
+	dropped int
+}
+
+func (p *partialWrite) add(reason string, dropped int) {
+	p.reasons = append(p.reasons, reason)
+	p.dropped += dropped
+}
+
+// addShard adds the points of shard rejected by owners.
+func (p *partialWrite) addShard(e *shardRejectError) {
+	p.reasons = append(p.reasons, e.reasons...)
+	p.dropped += e.dropped
+}
+
+// err returns nil if no point is dropped.
+func (p *partialWrite) err() error {
+	if len(p.reasons) == 0 {
+		return nil
+	}
+	reasons := p.reasons
+	if len(reasons) > maxPartialWriteReasons {
+		reasons = append(reasons[:maxPartialWriteReasons:maxPartialWriteReasons],
+			fmt.Sprintf("and %d more", len(p.reasons)-maxPartialWriteReasons))
+	}
+	return tsdb.PartialWriteError{Reason: strings.Join(reasons, "; "), Dropped: p.dropped}
+}
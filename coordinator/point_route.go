@@ -0,0 +1,102 @@
+package coordinator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// PointRoute tells where a point written would go and why.
+type PointRoute struct {
+	Key  string `json:"key"`
+	Time int64  `json:"time"`
+	Hash uint64 `json:"hash"`
+
+	ShardGroup uint64   `json:"shard_group,omitempty"`
+	GroupStart int64    `json:"group_start,omitempty"`
+	GroupEnd   int64    `json:"group_end,omitempty"`
+	Shards     int      `json:"shards,omitempty"` // of the shard group
+	ShardID    uint64   `json:"shard_id,omitempty"`
+	Owners     []uint64 `json:"owners,omitempty"`
+
+	Reason string `json:"reason"`
+}
+
+// RoutePoints maps points like MapShards without writing them nor creating
+// shard groups, telling for each point the shard group its time falls in and
+// the shard its series hash picks.
+func (w *PointsWriter) RoutePoints(database, retentionPolicy string, points []models.Point) (string, []PointRoute, error) {
+	if retentionPolicy == "" {
+		db := w.MetaClient.Database(database)
+		if db == nil {
+			return "", nil, influxdb.ErrDatabaseNotFound(database)
+		}
+		retentionPolicy = db.DefaultRetentionPolicy
+	}
+	rp, err := w.MetaClient.RetentionPolicy(database, retentionPolicy)
+	if err != nil {
+		return "", nil, err
+	} else if rp == nil {
+		return "", nil, influxdb.ErrRetentionPolicyNotFound(retentionPolicy)
+	}
+
+	list := make(sgList, 0, len(rp.ShardGroups))
+	for _, sgi := range rp.ShardGroups {
+		if !sgi.Deleted() {
+			list = append(list, sgi)
+		}
+	}
+	sort.Sort(meta.ShardGroupInfos(list))
+	min := time.Unix(0, models.MinNanoTime)
+	if rp.Duration > 0 {
+		min = time.Now().Add(-rp.Duration)
+	}
+
+	routes := make([]PointRoute, len(points))
+	for i, p := range points {
+		r := &routes[i]
+		r.Key = string(p.Key())
+		r.Time = p.UnixNano()
+		r.Hash = p.HashID()
+
+		sg := list.ShardGroupAt(p.Time())
+		if sg == nil {
+			if p.Time().Before(min) {
+				r.Reason = fmt.Sprintf("older than duration %s of retention policy %s, dropped", rp.Duration, rp.Name)
+			} else {
+				r.Reason = "no shard group covers the time, one is created by the write"
+			}
+			continue
+		}
+		r.ShardGroup = sg.ID
+		r.GroupStart = sg.StartTime.UnixNano()
+		r.GroupEnd = sg.EndTime.UnixNano()
+		r.Shards = len(sg.Shards)
+		if len(sg.Shards) == 0 {
+			r.Reason = fmt.Sprintf("shard group %d covers the time but has no shards", sg.ID)
+			continue
+		}
+
+		sh := sg.ShardFor(r.Hash)
+		r.ShardID = sh.ID
+		for _, o := range sh.Owners {
+			r.Owners = append(r.Owners, o.NodeID)
+		}
+		r.Reason = fmt.Sprintf("shard group %d covers the time, series hash %% %d shards picks shard %d",
+			sg.ID, len(sg.Shards), r.Hash%uint64(len(sg.Shards)))
+		if w.ReadOnlyShards != nil && w.ReadOnlyShards.ShardReadOnly(sh.ID) {
+			r.Reason += ", which is read-only and rejects the write"
+		} else if w.SealedShards != nil && w.SealedShards.ShardSealed(sh.ID) {
+			r.Reason += ", which is sealed and rejects the write"
+		} else if w.ShardCutovers != nil {
+			if cutover := w.ShardCutovers.ShardCutover(sh.ID); cutover != nil {
+				r.Reason += fmt.Sprintf(", which is in cutover to node %d and buffers the write by hinted handoff", cutover.NodeID)
+			}
+		}
+	}
+	return retentionPolicy, routes, nil
+}
@@ -1,10 +1,10 @@
 package coordinator
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,8 +13,12 @@ import (
 	influxdb_coordinator "github.com/influxdata/influxdb/coordinator"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/tsdb"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/logging"
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/influxdata/influxdb/services/meta"
 )
 
@@ -28,22 +32,45 @@ const (
 	statWriteDrop           = "writeDrop"
 	statWritePartial        = "writePartial"
 	statWriteTimeout        = "writeTimeout"
+	statWriteCanceled       = "writeCanceled"
+	statWriteDuplicate      = "writeDuplicate"
 	statWriteErr            = "writeError"
 	statWritePointReqHH     = "pointReqHH"
+	statWritePointReqAsync  = "pointReqAsync"
+	statWriteHHDisabled     = "writeHHDisabled"
+	statWriteCutover        = "writeCutover"
+	statWriteStraggler      = "writeStraggler"
+	statWriteDiskLow        = "writeDiskLow"
+	statWriteReadOnly       = "writeReadOnly"
 	statSubWriteOK          = "subWriteOk"
 	statSubWriteDrop        = "subWriteDrop"
 )
 
 var (
 	// ErrTimeout is returned when a write times out.
-	ErrTimeout = errors.New("timeout")
+	ErrTimeout = errs.ErrTimeout
 
 	// ErrPartialWrite is returned when a write partially succeeds but does
 	// not meet the requested consistency level.
-	ErrPartialWrite = errors.New("partial write")
+	ErrPartialWrite = errs.ErrPartialWrite
 
 	// ErrWriteFailed is returned when no writes succeeded.
-	ErrWriteFailed = errors.New("write failed")
+	ErrWriteFailed = errs.ErrWriteFailed
+
+	// ErrShardReadOnly is returned when writing to a shard marked read-only.
+	ErrShardReadOnly = errs.ErrShardReadOnly
+
+	// ErrClusterReadOnly is returned when writing while the cluster is
+	// read-only.
+	ErrClusterReadOnly = errs.ErrClusterReadOnly
+
+	// ErrShardSealed is returned when writing to a shard of a shard group
+	// sealed once its write window passed.
+	ErrShardSealed = errs.ErrShardSealed
+
+	// ErrStaleIncarnation is returned to a node whose incarnation is replaced
+	// by a newer start of it or which is deleted.
+	ErrStaleIncarnation = errs.ErrStaleIncarnation
 )
 
 // PointsWriter handles writes across multiple local and remote data nodes.
@@ -55,8 +82,41 @@ type PointsWriter struct {
 
 	Node *influxdb.Node
 
+	// AsyncReplication acknowledges writes of consistency ONE and ANY once
+	// one owner wrote them, queueing them by hinted handoff for other owners
+	AsyncReplication bool
+
 	HintedHandoff interface {
-		WriteShard(shardID, ownerID uint64, points []models.Point) error
+		WriteShard(shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error
+	}
+
+	// HintedHandoffPolicy tells retention policies whose failed writes are
+	// rejected instead of queued by hinted handoff, optional
+	HintedHandoffPolicy interface {
+		HintedHandoffEnabled(database, rp string) bool
+	}
+
+	// ReadOnlyCluster tells whether writes of the cluster are rejected,
+	// optional
+	ReadOnlyCluster interface {
+		ClusterReadOnly() bool
+	}
+
+	// ReadOnlyShards tells shards rejecting writes, optional
+	ReadOnlyShards interface {
+		ShardReadOnly(id uint64) bool
+	}
+
+	// ShardCutovers tells shards whose writes are held by the cutover of
+	// their moves, optional
+	ShardCutovers interface {
+		ShardCutover(id uint64) *imeta.ShardCutover
+	}
+
+	// SealedShards tells shards of shard groups sealed, rejecting writes,
+	// optional
+	SealedShards interface {
+		ShardSealed(id uint64) bool
 	}
 
 	MetaClient interface {
@@ -71,12 +131,30 @@ type PointsWriter struct {
 	}
 
 	ShardWriter interface {
-		WriteShard(shardID, ownerID uint64, points []models.Point) error
+		WriteShardContext(ctx context.Context, shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error
+	}
+
+	// WriteKeys skips local writes with idempotency keys already applied,
+	// optional
+	WriteKeys *WriteKeys
+
+	// DiskHeadroom rejects local writes while the disk of shards is low on
+	// free space, optional
+	DiskHeadroom *DiskHeadroom
+
+	// WriteAuthorizer checks points written by a user, optional
+	WriteAuthorizer interface {
+		AuthorizeWritePoints(u meta.User, database string, points []models.Point) error
 	}
 
 	subPoints []chan<- *WritePointsRequest
 
-	stats *WriteStatistics
+	// timeLimits truncate and check timestamps of points, none if nil
+	timeLimits *writeTimeLimits
+
+	stats      *WriteStatistics
+	dbStats    *databaseStats
+	shardStats *shardStats
 }
 
 // NewPointsWriter returns a new instance of PointsWriter for a node.
@@ -86,7 +164,21 @@ func NewPointsWriter() *PointsWriter {
 		WriteTimeout: DefaultWriteTimeout,
 		Logger:       zap.NewNop(),
 		stats:        &WriteStatistics{},
+		dbStats:      newDatabaseStats(),
+		shardStats:   newShardStats(),
+	}
+}
+
+// SetWriteTimeLimits truncates timestamps of points written to the
+// write-precision of c, and rejects points beyond max-write-future and
+// max-write-past, by database and retention policy.
+func (w *PointsWriter) SetWriteTimeLimits(c Config) error {
+	limits, err := newWriteTimeLimits(c)
+	if err != nil {
+		return err
 	}
+	w.timeLimits = limits
+	return nil
 }
 
 // ShardMapping contains a mapping of shards to points.
@@ -157,8 +249,16 @@ type WriteStatistics struct {
 	WriteOK             int64
 	WriteDropped        int64
 	WriteTimeout        int64
+	WriteCanceled       int64
+	WriteDuplicate      int64
 	WritePartial        int64
 	WritePointReqHH     int64
+	WritePointReqAsync  int64
+	WriteHHDisabled     int64
+	WriteCutover        int64
+	WriteStraggler      int64
+	WriteDiskLow        int64
+	WriteReadOnly       int64
 	WriteErr            int64
 	SubWriteOK          int64
 	SubWriteDrop        int64
@@ -166,7 +266,7 @@ type WriteStatistics struct {
 
 // Statistics returns statistics for periodic monitoring.
 func (w *PointsWriter) Statistics(tags map[string]string) []models.Statistic {
-	return []models.Statistic{{
+	return append([]models.Statistic{{
 		Name: "write",
 		Tags: tags,
 		Values: map[string]interface{}{
@@ -177,13 +277,26 @@ func (w *PointsWriter) Statistics(tags map[string]string) []models.Statistic {
 			statWriteOK:             atomic.LoadInt64(&w.stats.WriteOK),
 			statWriteDrop:           atomic.LoadInt64(&w.stats.WriteDropped),
 			statWriteTimeout:        atomic.LoadInt64(&w.stats.WriteTimeout),
+			statWriteCanceled:       atomic.LoadInt64(&w.stats.WriteCanceled),
+			statWriteDuplicate:      atomic.LoadInt64(&w.stats.WriteDuplicate),
 			statWritePartial:        atomic.LoadInt64(&w.stats.WritePartial),
 			statWritePointReqHH:     atomic.LoadInt64(&w.stats.WritePointReqHH),
+			statWritePointReqAsync:  atomic.LoadInt64(&w.stats.WritePointReqAsync),
+			statWriteHHDisabled:     atomic.LoadInt64(&w.stats.WriteHHDisabled),
+			statWriteCutover:        atomic.LoadInt64(&w.stats.WriteCutover),
+			statWriteStraggler:      atomic.LoadInt64(&w.stats.WriteStraggler),
+			statWriteDiskLow:        atomic.LoadInt64(&w.stats.WriteDiskLow),
+			statWriteReadOnly:       atomic.LoadInt64(&w.stats.WriteReadOnly),
 			statWriteErr:            atomic.LoadInt64(&w.stats.WriteErr),
 			statSubWriteOK:          atomic.LoadInt64(&w.stats.SubWriteOK),
 			statSubWriteDrop:        atomic.LoadInt64(&w.stats.SubWriteDrop),
 		},
-	}}
+	}}, append(w.dbStats.statistics(tags), w.shardStats.statistics(tags, time.Now())...)...)
+}
+
+// PrometheusCollector returns the collector of write statistics by database.
+func (w *PointsWriter) PrometheusCollector() prometheus.Collector {
+	return w.dbStats
 }
 
 // MapShards maps the points contained in wp to a ShardMapping.  If a point
@@ -286,14 +399,38 @@ func (w *PointsWriter) WritePointsInto(p *influxdb_coordinator.IntoWriteRequest)
 
 // WritePoints writes the data to the underlying storage. consitencyLevel and user are only used for clustered scenarios
 func (w *PointsWriter) WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, user meta.User, points []models.Point) error {
-	return w.WritePointsPrivileged(database, retentionPolicy, consistencyLevel, points)
+	return w.WritePointsContext(context.Background(), database, retentionPolicy, consistencyLevel, user, points)
+}
+
+// WritePointsContext is WritePoints giving up once ctx is done.
+func (w *PointsWriter) WritePointsContext(ctx context.Context, database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, user meta.User, points []models.Point) error {
+	if w.WriteAuthorizer != nil && user != nil {
+		if err := w.WriteAuthorizer.AuthorizeWritePoints(user, database, points); err != nil {
+			atomic.AddInt64(&w.stats.WriteDropped, int64(len(points)))
+			return tsdb.PartialWriteError{Reason: err.Error(), Dropped: len(points)}
+		}
+	}
+	return w.WritePointsPrivilegedContext(ctx, database, retentionPolicy, consistencyLevel, points)
 }
 
 // WritePointsPrivileged writes the data to the underlying storage, consitencyLevel is only used for clustered scenarios
 func (w *PointsWriter) WritePointsPrivileged(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+	return w.WritePointsPrivilegedContext(context.Background(), database, retentionPolicy, consistencyLevel, points)
+}
+
+// WritePointsPrivilegedContext is WritePointsPrivileged giving up once ctx is
+// done. Owners not written yet by then get the points by hinted handoff, and
+// the error of ctx is returned.
+func (w *PointsWriter) WritePointsPrivilegedContext(ctx context.Context, database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) (err error) {
+	start := time.Now()
 	atomic.AddInt64(&w.stats.WriteReq, 1)
 	atomic.AddInt64(&w.stats.PointWriteReq, int64(len(points)))
 
+	if w.ReadOnlyCluster != nil && w.ReadOnlyCluster.ClusterReadOnly() {
+		atomic.AddInt64(&w.stats.WriteReadOnly, 1)
+		return ErrClusterReadOnly
+	}
+
 	if retentionPolicy == "" {
 		db := w.MetaClient.Database(database)
 		if db == nil {
@@ -302,16 +439,31 @@ func (w *PointsWriter) WritePointsPrivileged(database, retentionPolicy string, c
 		retentionPolicy = db.DefaultRetentionPolicy
 	}
 
+	requested := len(points)
+	points, normalized, rejected := w.timeLimits.limit(database, retentionPolicy).apply(points, start)
 	shardMappings, err := w.MapShards(&WritePointsRequest{Database: database, RetentionPolicy: retentionPolicy, Points: points})
 	if err != nil {
 		return err
 	}
+	// Statistics are kept for databases existing only
+	w.dbStats.recordTimes(database, normalized, rejected)
+	defer func() {
+		w.dbStats.record(database, requested, time.Since(start), err)
+	}()
 
 	// Write each shard in it's own goroutine and return as soon as one fails.
+	// Points rejected by shards are reported together once all are written.
+	// Writes going on after return are not abandoned by the caller
+	key := IdempotencyKey(ctx)
+	ctx, release := detachOnReturn(ctx)
+	defer release()
+	if key != "" {
+		ctx = WithIdempotencyKey(ctx, key)
+	}
 	ch := make(chan error, len(shardMappings.Points))
 	for shardID, points := range shardMappings.Points {
 		go func(shard *meta.ShardInfo, database, retentionPolicy string, points []models.Point) {
-			err := w.writeToShard(shard, database, retentionPolicy, consistencyLevel, points)
+			err := w.writeToShard(ctx, shard, database, retentionPolicy, consistencyLevel, points)
 			if err == tsdb.ErrShardDeletion {
 				err = tsdb.PartialWriteError{Reason: fmt.Sprintf("shard %d is pending deletion", shard.ID), Dropped: len(points)}
 			}
@@ -342,9 +494,13 @@ func (w *PointsWriter) WritePointsPrivileged(database, retentionPolicy string, c
 		atomic.AddInt64(&w.stats.SubWriteDrop, dropped)
 	}
 
-	if err == nil && len(shardMappings.Dropped) > 0 {
-		err = tsdb.PartialWriteError{Reason: "points beyond retention policy", Dropped: len(shardMappings.Dropped)}
-
+	var partial partialWrite
+	if len(shardMappings.Dropped) > 0 {
+		partial.add("points beyond retention policy", len(shardMappings.Dropped))
+	}
+	if rejected > 0 {
+		atomic.AddInt64(&w.stats.WriteDropped, int64(rejected))
+		partial.add("points beyond write time limits", rejected)
 	}
 	timeout := time.NewTimer(w.WriteTimeout)
 	defer timeout.Stop()
@@ -352,21 +508,47 @@ func (w *PointsWriter) WritePointsPrivileged(database, retentionPolicy string, c
 		select {
 		case <-w.closing:
 			return ErrWriteFailed
+		case <-ctx.Done():
+			atomic.AddInt64(&w.stats.WriteCanceled, 1)
+			return ctx.Err()
 		case <-timeout.C:
 			atomic.AddInt64(&w.stats.WriteTimeout, 1)
 			// return timeout error to caller
 			return ErrTimeout
 		case err := <-ch:
-			if err != nil {
+			var rejectErr *shardRejectError
+			var partialErr tsdb.PartialWriteError
+			switch {
+			case err == nil:
+			case errors.As(err, &rejectErr):
+				partial.addShard(rejectErr)
+			case errors.As(err, &partialErr):
+				partial.add(partialErr.Reason, partialErr.Dropped)
+			default:
 				return err
 			}
 		}
 	}
-	return err
+	return partial.err()
 }
 
 // writeToShards writes points to a shard.
-func (w *PointsWriter) writeToShard(shard *meta.ShardInfo, database, retentionPolicy string, consistency models.ConsistencyLevel, points []models.Point) error {
+func (w *PointsWriter) writeToShard(ctx context.Context, shard *meta.ShardInfo, database, retentionPolicy string, consistency models.ConsistencyLevel, points []models.Point) error {
+	if w.ReadOnlyShards != nil && w.ReadOnlyShards.ShardReadOnly(shard.ID) {
+		return fmt.Errorf("shard %d: %w", shard.ID, ErrShardReadOnly)
+	}
+	if w.SealedShards != nil && w.SealedShards.ShardSealed(shard.ID) {
+		return fmt.Errorf("shard %d: %w", shard.ID, ErrShardSealed)
+	}
+	if w.ShardCutovers != nil {
+		if cutover := w.ShardCutovers.ShardCutover(shard.ID); cutover != nil {
+			return w.writeToShardCutover(shard, cutover, database, retentionPolicy, consistency, points)
+		}
+	}
+	if w.replicateAsync(shard, database, retentionPolicy, consistency) {
+		return w.writeToShardAsync(ctx, shard, database, retentionPolicy, consistency, points)
+	}
+
 	// The required number of writes to achieve the requested consistency level
 	required := len(shard.Owners)
 	switch consistency {
@@ -376,70 +558,45 @@ func (w *PointsWriter) writeToShard(shard *meta.ShardInfo, database, retentionPo
 		required = required/2 + 1
 	}
 
-	// response channel for each shard writer go routine
+	// Owners are written in parallel and their results counted as they
+	// arrive. Once the required writes can't be reached any more or the write
+	// timed out, owners not answered yet are canceled, queueing their points
+	// by hinted handoff at once, and their results are still collected to
+	// tell points rejected. Owners still writing after the required ones
+	// succeeded are left to complete the replication.
+	fanout := newWriteFanout(ctx, len(shard.Owners))
 	type AsyncWriteResult struct {
 		Owner meta.ShardOwner
 		Err   error
 	}
 	ch := make(chan *AsyncWriteResult, len(shard.Owners))
-
 	for _, owner := range shard.Owners {
-		go func(shardID uint64, owner meta.ShardOwner, points []models.Point) {
-			if w.Node.ID == owner.NodeID {
-				atomic.AddInt64(&w.stats.PointWriteReqLocal, int64(len(points)))
-
-				err := w.TSDBStore.WriteToShard(shardID, points)
-				// If we've written to shard that should exist on the current node, but the store has
-				// not actually created this shard, tell it to create it and retry the write
-				if err == tsdb.ErrShardNotFound {
-					err = w.TSDBStore.CreateShard(database, retentionPolicy, shardID, true)
-					if err != nil {
-						ch <- &AsyncWriteResult{owner, err}
-						return
-					}
-					err = w.TSDBStore.WriteToShard(shardID, points)
-				}
-				ch <- &AsyncWriteResult{owner, err}
-				return
-			}
-
-			atomic.AddInt64(&w.stats.PointWriteReqRemote, int64(len(points)))
-			err := w.ShardWriter.WriteShard(shardID, owner.NodeID, points)
-			if err != nil && canRetry(err) {
-				w.Logger.Warn(fmt.Sprintf(
-					"ShardWriter.WriteShard fail to %d and enqueue to hh",
-					owner.NodeID,
-				), zap.Error(err))
-				// The remote write failed so queue it via hinted handoff
-				atomic.AddInt64(&w.stats.WritePointReqHH, int64(len(points)))
-				hherr := w.HintedHandoff.WriteShard(shardID, owner.NodeID, points)
-				if hherr != nil {
-					ch <- &AsyncWriteResult{owner, hherr}
-					return
-				}
-
-				// If the write consistency level is ANY, then a successful hinted handoff can
-				// be considered a successful write so send nil to the response channel
-				// otherwise, let the original error propagate to the response channel
-				if hherr == nil && consistency == models.ConsistencyLevelAny {
-					ch <- &AsyncWriteResult{owner, nil}
-					return
-				}
+		go func(owner meta.ShardOwner) {
+			err := w.writeToOwner(fanout.ctx, shard.ID, owner, database, retentionPolicy, consistency, points)
+			if owner.NodeID != w.Node.ID && fanout.ctx.Err() != nil && ctx.Err() == nil {
+				// answered after the fan-out was canceled
+				atomic.AddInt64(&w.stats.WriteStraggler, 1)
 			}
 			ch <- &AsyncWriteResult{owner, err}
-
-		}(shard.ID, owner, points)
+			fanout.done()
+		}(owner)
 	}
 
-	var wrote int
+	var wrote, failed int
 	timeout := time.After(w.WriteTimeout)
 	var writeError error
-	for range shard.Owners {
+	var rejectErr *shardRejectError
+	for wrote+failed < len(shard.Owners) {
 		select {
 		case <-w.closing:
+			fanout.cancel()
 			return ErrWriteFailed
+		case <-ctx.Done():
+			fanout.cancel()
+			return ctx.Err()
 		case <-timeout:
 			atomic.AddInt64(&w.stats.WriteTimeout, 1)
+			fanout.cancel()
 			// return timeout error to caller
 			return ErrTimeout
 		case result := <-ch:
@@ -448,12 +605,24 @@ func (w *PointsWriter) writeToShard(shard *meta.ShardInfo, database, retentionPo
 				atomic.AddInt64(&w.stats.WriteErr, 1)
 				w.Logger.Error("write failed",
 					zap.Error(result.Err),
-					zap.Uint64("shard", shard.ID),
-					zap.Uint64("node", result.Owner.NodeID))
+					logging.ShardID(shard.ID),
+					logging.NodeID(result.Owner.NodeID),
+					logging.IdempotencyKey(IdempotencyKey(ctx)))
 				// Keep track of the first error we see to return back to the client
 				if writeError == nil {
 					writeError = result.Err
 				}
+				if dropped, ok := rejectedPoints(result.Err, len(points)); ok {
+					if rejectErr == nil {
+						rejectErr = &shardRejectError{}
+					}
+					rejectErr.add(shard.ID, result.Owner.NodeID, dropped, result.Err)
+				}
+				failed++
+				// The owners left can't make up the required ones
+				if failed == len(shard.Owners)-required+1 {
+					fanout.cancel()
+				}
 				continue
 			}
 
@@ -466,6 +635,13 @@ func (w *PointsWriter) writeToShard(shard *meta.ShardInfo, database, retentionPo
 			}
 		}
 	}
+	fanout.cancel()
+
+	// Owners accepting points are told from the rejecting ones
+	if rejectErr != nil {
+		atomic.AddInt64(&w.stats.WritePartial, 1)
+		return rejectErr
+	}
 
 	if wrote > 0 {
 		atomic.AddInt64(&w.stats.WritePartial, 1)
@@ -479,13 +655,102 @@ func (w *PointsWriter) writeToShard(shard *meta.ShardInfo, database, retentionPo
 	return ErrWriteFailed
 }
 
-func canRetry(err error) bool {
-	if err == nil {
-		return true
+// writeFanout is the context of the writes of a shard to its owners,
+// canceled once the outcome of the write is decided against owners not
+// answered yet, or released once all answered.
+type writeFanout struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	remaining int32
+}
+
+func newWriteFanout(ctx context.Context, owners int) *writeFanout {
+	f := &writeFanout{remaining: int32(owners)}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	return f
+}
+
+// done counts an owner answered.
+func (f *writeFanout) done() {
+	if atomic.AddInt32(&f.remaining, -1) == 0 {
+		f.cancel()
 	}
+}
 
-	if strings.Contains(err.Error(), "field type conflict") {
-		return false
+// writeToOwner writes points of shard shardID to owner, queueing them by
+// hinted handoff if the owner failed but may succeed later, e.g. when ctx is
+// canceled. The queued points count as written for consistency ANY.
+func (w *PointsWriter) writeToOwner(ctx context.Context, shardID uint64, owner meta.ShardOwner, database, retentionPolicy string, consistency models.ConsistencyLevel, points []models.Point) error {
+	if w.Node.ID == owner.NodeID {
+		atomic.AddInt64(&w.stats.PointWriteReqLocal, int64(len(points)))
+
+		if w.DiskHeadroom.Low(time.Now()) {
+			// not queued, hinted handoff would fill the same disk
+			atomic.AddInt64(&w.stats.WriteDiskLow, 1)
+			return ErrOwnerDiskLow
+		}
+		key := IdempotencyKey(ctx)
+		if !w.WriteKeys.Reserve(shardID, key) {
+			// retry of a write applied already
+			atomic.AddInt64(&w.stats.WriteDuplicate, 1)
+			return nil
+		}
+		start := time.Now()
+		err := w.TSDBStore.WriteToShard(shardID, points)
+		// If we've written to shard that should exist on the current node, but the store has
+		// not actually created this shard, tell it to create it and retry the write
+		if err == tsdb.ErrShardNotFound {
+			err = w.TSDBStore.CreateShard(database, retentionPolicy, shardID, true)
+			if err != nil {
+				w.WriteKeys.Done(shardID, key, false)
+				return err
+			}
+			start = time.Now()
+			err = w.TSDBStore.WriteToShard(shardID, points)
+		}
+		w.shardStats.record(database, shardID, owner.NodeID, time.Since(start), err, time.Now())
+		var partialErr tsdb.PartialWriteError
+		w.WriteKeys.Done(shardID, key, err == nil || errors.As(err, &partialErr))
+		return err
+	}
+
+	atomic.AddInt64(&w.stats.PointWriteReqRemote, int64(len(points)))
+	start := time.Now()
+	err := w.ShardWriter.WriteShardContext(ctx, imeta.ShardID(shardID), imeta.NodeID(owner.NodeID), points)
+	// Writes not sent or abandoned tell nothing of the owner
+	if err != ErrCircuitOpen && err != ErrOwnerBacklogged && err != ErrOwnerDiskLow && err != ErrTooManyWrites && ctx.Err() == nil {
+		w.shardStats.record(database, shardID, owner.NodeID, time.Since(start), err, time.Now())
 	}
-	return true
+	if err == ErrOwnerDiskLow {
+		atomic.AddInt64(&w.stats.WriteDiskLow, 1)
+	}
+	if err == nil || !IsRetryable(err) {
+		return err
+	}
+	if w.HintedHandoffPolicy != nil && !w.HintedHandoffPolicy.HintedHandoffEnabled(database, retentionPolicy) {
+		// Not worth queueing, fail the write to the owner
+		atomic.AddInt64(&w.stats.WriteHHDisabled, 1)
+		return err
+	}
+	// Short-circuited and abandoned writes are expected, don't flood the log.
+	// Points abandoned by the caller or the fan-out are still queued for the owner.
+	if err != ErrCircuitOpen && err != ErrOwnerBacklogged && err != ErrOwnerDiskLow && ctx.Err() == nil {
+		w.Logger.Warn(fmt.Sprintf(
+			"ShardWriter.WriteShard fail to %d and enqueue to hh",
+			owner.NodeID,
+		), zap.Error(err))
+	}
+	// The remote write failed so queue it via hinted handoff
+	atomic.AddInt64(&w.stats.WritePointReqHH, int64(len(points)))
+	if hherr := w.HintedHandoff.WriteShard(imeta.ShardID(shardID), imeta.NodeID(owner.NodeID), points); hherr != nil {
+		return hherr
+	}
+	w.dbStats.addHinted(database, points)
+
+	// If the write consistency level is ANY, then a successful hinted handoff can
+	// be considered a successful write, otherwise let the original error propagate
+	if consistency == models.ConsistencyLevelAny {
+		return nil
+	}
+	return err
 }
@@ -1,14 +1,18 @@
 package coordinator_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/angopher/chronus/coordinator"
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/influxdata/influxdb"
 	influxdb_coordinator "github.com/influxdata/influxdb/coordinator"
 	"github.com/influxdata/influxdb/models"
@@ -436,6 +440,702 @@ func TestPointsWriter_WritePoints_Dropped(t *testing.T) {
 	}
 }
 
+// Ensures writes abandoned by the caller are not sent to owners but queued by
+// hinted handoff.
+func TestPointsWriter_WritePointsContext_Canceled(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+
+	var remote int64
+	shardWriter := &fakeShardWriter{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			atomic.AddInt64(&remote, 1)
+			return nil
+		},
+	}
+	queued := make(chan uint64, 3)
+	hh := &fakeHintedHandoff{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			queued <- ownerID
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.ShardWriter = shardWriter
+	c.HintedHandoff = hh
+	// gateway like node owning no shard
+	c.Node = &influxdb.Node{ID: 0}
+
+	c.Open()
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.WritePointsPrivilegedContext(ctx, pr.Database, pr.RetentionPolicy, models.ConsistencyLevelOne, pr.Points)
+	if err != context.Canceled {
+		t.Fatalf("PointsWriter.WritePointsPrivilegedContext(): got %v, exp %v", err, context.Canceled)
+	}
+
+	owners := map[uint64]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case id := <-queued:
+			owners[id] = true
+		case <-time.After(time.Second):
+			t.Fatalf("points queued for %d owners, exp 3", len(owners))
+		}
+	}
+	if len(owners) != 3 {
+		t.Fatalf("unexpected owners queued: %v", owners)
+	}
+	if n := atomic.LoadInt64(&remote); n != 0 {
+		t.Fatalf("unexpected remote writes: %d", n)
+	}
+	stats := c.Statistics(nil)[0].Values
+	if v := stats["writeCanceled"]; v != int64(1) {
+		t.Fatalf("unexpected writeCanceled: %v", v)
+	}
+}
+
+// Ensures points rejected by some owners are reported as a partial write.
+func TestPointsWriter_WritePoints_Rejected(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	// two points of one shard and one of another
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	pr.AddPoint("mem", 1.0, time.Now(), nil)
+	pr.AddPoint("cpu", 2.0, time.Now().Add(time.Hour), nil)
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+
+	sg, _ := ms.CreateShardGroupIfNotExistsFn("", "", time.Now())
+	rejectShard := sg.Shards[0].ID
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			return nil
+		},
+	}
+	shardWriter := &fakeShardWriter{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			if shardID != rejectShard {
+				return nil
+			}
+			switch ownerID {
+			case 2:
+				return &coordinator.RPCError{Code: coordinator.ErrorCodePermanent, Message: "field type conflict: input field \"value\"\nmore", Dropped: 1}
+			case 3:
+				// retried later by hinted handoff
+				return &coordinator.RPCError{Code: coordinator.ErrorCodeOverload, Message: "busy"}
+			}
+			return nil
+		},
+	}
+	hh := &fakeHintedHandoff{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.ShardWriter = shardWriter
+	c.HintedHandoff = hh
+	c.Node = &influxdb.Node{ID: 1}
+
+	c.Open()
+	defer c.Close()
+
+	// quorum fails once both remote owners answered, ALL would cancel the
+	// owner answering last
+	err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelQuorum, pr.Points)
+	perr, ok := err.(tsdb.PartialWriteError)
+	if !ok {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): got %v, exp %v", err, tsdb.PartialWriteError{})
+	}
+	if perr.Dropped != 1 {
+		t.Fatalf("unexpected dropped: %d", perr.Dropped)
+	}
+	if exp := fmt.Sprintf("shard %d node 2: field type conflict: input field \"value\"", rejectShard); perr.Reason != exp {
+		t.Fatalf("unexpected reason: got %q, exp %q", perr.Reason, exp)
+	}
+}
+
+// Ensures failed writes are not queued by hinted handoff when disabled for
+// the retention policy.
+func TestPointsWriter_WritePoints_HintedHandoffDisabled(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			return nil
+		},
+	}
+	shardWriter := &fakeShardWriter{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			return &coordinator.RPCError{Code: coordinator.ErrorCodeOverload, Message: "busy"}
+		},
+	}
+	var hinted int32
+	hh := &fakeHintedHandoff{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			atomic.AddInt32(&hinted, 1)
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.ShardWriter = shardWriter
+	c.HintedHandoff = hh
+	c.HintedHandoffPolicy = hintedHandoffPolicyFunc(func(database, rp string) bool {
+		return !(database == "mydb" && rp == "myrp")
+	})
+	c.Node = &influxdb.Node{ID: 1}
+
+	c.Open()
+	defer c.Close()
+
+	if err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAll, pr.Points); err == nil {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): expected error")
+	}
+	if n := atomic.LoadInt32(&hinted); n != 0 {
+		t.Fatalf("unexpected hinted writes: %d", n)
+	}
+	stats := c.Statistics(nil)[0].Values
+	if v := stats["writeHHDisabled"]; v != int64(2) {
+		t.Fatalf("unexpected writeHHDisabled: %v", v)
+	}
+
+	pr.RetentionPolicy = "otherrp"
+	if err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAll, pr.Points); err == nil {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): expected error")
+	}
+	if n := atomic.LoadInt32(&hinted); n != 2 {
+		t.Fatalf("unexpected hinted writes: %d", n)
+	}
+}
+
+// Ensures owners not answered yet are canceled and queued by hinted handoff
+// once the consistency can't be reached any more.
+func TestPointsWriter_WritePoints_CancelStragglers(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			return nil
+		},
+	}
+	shardWriter := &fakeShardWriter{
+		WriteContextFn: func(ctx context.Context, shardID, ownerID uint64, points []models.Point) error {
+			if ownerID == 2 {
+				return &coordinator.RPCError{Code: coordinator.ErrorCodeAuth, Message: "unauthorized"}
+			}
+			// answers only once canceled
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	hinted := make(chan uint64, 1)
+	hh := &fakeHintedHandoff{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			hinted <- ownerID
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.ShardWriter = shardWriter
+	c.HintedHandoff = hh
+	c.Node = &influxdb.Node{ID: 1}
+	c.WriteTimeout = time.Minute
+
+	c.Open()
+	defer c.Close()
+
+	err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAll, pr.Points)
+	if err == nil || err == coordinator.ErrTimeout {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): unexpected error: %v", err)
+	}
+	select {
+	case id := <-hinted:
+		if id != 3 {
+			t.Fatalf("unexpected hinted owner: %d", id)
+		}
+	default:
+		t.Fatal("straggler not queued by hinted handoff")
+	}
+	stats := c.Statistics(nil)[0].Values
+	if v := stats["writeStraggler"]; v != int64(1) {
+		t.Fatalf("unexpected writeStraggler: %v", v)
+	}
+}
+
+// Ensures writes to shards marked read-only are rejected before being sent to
+// any owner.
+func TestPointsWriter_WritePoints_ShardReadOnly(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+
+	var writes int32
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			atomic.AddInt32(&writes, 1)
+			return nil
+		},
+	}
+	shardWriter := &fakeShardWriter{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			atomic.AddInt32(&writes, 1)
+			return nil
+		},
+	}
+	hh := &fakeHintedHandoff{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			atomic.AddInt32(&writes, 1)
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.ShardWriter = shardWriter
+	c.HintedHandoff = hh
+	c.ReadOnlyShards = shardReadOnlyFunc(func(id uint64) bool { return true })
+	c.Node = &influxdb.Node{ID: 1}
+
+	c.Open()
+	defer c.Close()
+
+	err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAny, pr.Points)
+	if !errors.Is(err, coordinator.ErrShardReadOnly) {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): got %v, exp %v", err, coordinator.ErrShardReadOnly)
+	}
+	if n := atomic.LoadInt32(&writes); n != 0 {
+		t.Fatalf("unexpected writes: %d", n)
+	}
+}
+
+// Ensures writes are rejected while the cluster is read-only, before shards
+// are mapped.
+func TestPointsWriter_WritePoints_ClusterReadOnly(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	ms.CreateShardGroupIfNotExistsFn = func(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+		t.Fatal("unexpected shard group created")
+		return nil, nil
+	}
+
+	readOnly := true
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.ReadOnlyCluster = clusterReadOnlyFunc(func() bool { return readOnly })
+	c.Node = &influxdb.Node{ID: 1}
+
+	c.Open()
+	defer c.Close()
+
+	err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAny, pr.Points)
+	if err != coordinator.ErrClusterReadOnly {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): got %v, exp %v", err, coordinator.ErrClusterReadOnly)
+	}
+	stats := c.Statistics(nil)[0].Values
+	if v := stats["writeReadOnly"]; v != int64(1) {
+		t.Fatalf("unexpected writeReadOnly: %v", v)
+	}
+}
+
+// Ensures writes to shards sealed are rejected before being sent to any owner.
+func TestPointsWriter_WritePoints_ShardSealed(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+
+	var writes int32
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			atomic.AddInt32(&writes, 1)
+			return nil
+		},
+	}
+	shardWriter := &fakeShardWriter{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			atomic.AddInt32(&writes, 1)
+			return nil
+		},
+	}
+	hh := &fakeHintedHandoff{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			atomic.AddInt32(&writes, 1)
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.ShardWriter = shardWriter
+	c.HintedHandoff = hh
+	c.SealedShards = shardSealedFunc(func(id uint64) bool { return true })
+	c.Node = &influxdb.Node{ID: 1}
+
+	c.Open()
+	defer c.Close()
+
+	err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAny, pr.Points)
+	if !errors.Is(err, coordinator.ErrShardSealed) {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): got %v, exp %v", err, coordinator.ErrShardSealed)
+	}
+	if n := atomic.LoadInt32(&writes); n != 0 {
+		t.Fatalf("unexpected writes: %d", n)
+	}
+}
+
+// Ensures writes to shards in cutover are buffered by hinted handoff for the
+// owners and the new owner instead of being written.
+func TestPointsWriter_WritePoints_ShardCutover(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+
+	var writes int32
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			atomic.AddInt32(&writes, 1)
+			return nil
+		},
+	}
+	shardWriter := &fakeShardWriter{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			atomic.AddInt32(&writes, 1)
+			return nil
+		},
+	}
+	var mu sync.Mutex
+	hinted := make(map[uint64]int)
+	hh := &fakeHintedHandoff{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			mu.Lock()
+			defer mu.Unlock()
+			hinted[ownerID]++
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.ShardWriter = shardWriter
+	c.HintedHandoff = hh
+	c.ShardCutovers = shardCutoverFunc(func(id uint64) *imeta.ShardCutover {
+		return &imeta.ShardCutover{ShardID: id, NodeID: 4}
+	})
+	c.Node = &influxdb.Node{ID: 1}
+
+	c.Open()
+	defer c.Close()
+
+	if err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAny, pr.Points); err != nil {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): %v", err)
+	}
+	err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelOne, pr.Points)
+	if !errors.Is(err, coordinator.ErrShardCutover) {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): got %v, exp %v", err, coordinator.ErrShardCutover)
+	}
+	if n := atomic.LoadInt32(&writes); n != 0 {
+		t.Fatalf("unexpected writes: %d", n)
+	}
+	if exp := map[uint64]int{1: 2, 2: 2, 3: 2, 4: 2}; !reflect.DeepEqual(hinted, exp) {
+		t.Fatalf("unexpected hinted writes: %v, exp %v", hinted, exp)
+	}
+}
+
+// Ensures writes of consistency ONE are written to the local owner and
+// queued for others with async replication, and written to all at once with
+// consistency ALL. Writes fail over to the next owners, and all owners left
+// are queued even if one can't be.
+func TestPointsWriter_WritePoints_AsyncReplication(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+
+	var local, remote int32
+	var localErr, remoteErr, hhErr error
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			atomic.AddInt32(&local, 1)
+			return localErr
+		},
+	}
+	shardWriter := &fakeShardWriter{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			atomic.AddInt32(&remote, 1)
+			return remoteErr
+		},
+	}
+	var mu sync.Mutex
+	hinted := make(map[uint64]int)
+	hh := &fakeHintedHandoff{
+		WriteFn: func(shardID, ownerID uint64, points []models.Point) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if hhErr != nil && ownerID == 2 {
+				return hhErr
+			}
+			hinted[ownerID]++
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.ShardWriter = shardWriter
+	c.HintedHandoff = hh
+	c.AsyncReplication = true
+	c.Node = &influxdb.Node{ID: 1}
+
+	c.Open()
+	defer c.Close()
+
+	if err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelOne, pr.Points); err != nil {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): %v", err)
+	}
+	if l, r := atomic.LoadInt32(&local), atomic.LoadInt32(&remote); l != 1 || r != 0 {
+		t.Fatalf("unexpected writes: local %d, remote %d", l, r)
+	}
+	if exp := map[uint64]int{2: 1, 3: 1}; !reflect.DeepEqual(hinted, exp) {
+		t.Fatalf("unexpected hinted writes: %v, exp %v", hinted, exp)
+	}
+
+	if err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAll, pr.Points); err != nil {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): %v", err)
+	}
+	if l, r := atomic.LoadInt32(&local), atomic.LoadInt32(&remote); l != 2 || r != 2 {
+		t.Fatalf("unexpected writes: local %d, remote %d", l, r)
+	}
+
+	// written to the next owner if the first one failed, queued for the last
+	localErr = errors.New("disk full")
+	if err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelOne, pr.Points); err != nil {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): %v", err)
+	}
+	if l, r := atomic.LoadInt32(&local), atomic.LoadInt32(&remote); l != 3 || r != 3 {
+		t.Fatalf("unexpected writes: local %d, remote %d", l, r)
+	}
+	if exp := map[uint64]int{2: 1, 3: 2}; !reflect.DeepEqual(hinted, exp) {
+		t.Fatalf("unexpected hinted writes: %v, exp %v", hinted, exp)
+	}
+
+	// the other owners are queued even if one can't be
+	localErr, hhErr = nil, errors.New("queue full")
+	err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelOne, pr.Points)
+	if !errors.Is(err, coordinator.ErrPartialWrite) {
+		t.Fatalf("unexpected error of owner not queued: %v", err)
+	}
+	if exp := map[uint64]int{2: 1, 3: 3}; !reflect.DeepEqual(hinted, exp) {
+		t.Fatalf("unexpected hinted writes: %v, exp %v", hinted, exp)
+	}
+
+	// failed once no owner is written, the remote ones being queued
+	localErr, remoteErr, hhErr = errors.New("disk full"), errors.New("connection refused"), nil
+	if err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelOne, pr.Points); err == nil {
+		t.Fatal("expected error of no owner written")
+	}
+	if exp := map[uint64]int{2: 2, 3: 4}; !reflect.DeepEqual(hinted, exp) {
+		t.Fatalf("unexpected hinted writes: %v, exp %v", hinted, exp)
+	}
+	// accepted at ANY once queued for the first remote owner
+	if err := c.WritePointsPrivileged(pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAny, pr.Points); err != nil {
+		t.Fatalf("PointsWriter.WritePointsPrivileged(): %v", err)
+	}
+	if exp := map[uint64]int{2: 3, 3: 5}; !reflect.DeepEqual(hinted, exp) {
+		t.Fatalf("unexpected hinted writes: %v, exp %v", hinted, exp)
+	}
+}
+
+// Ensures a retried write with the same idempotency key is not written to
+// the local shard again, and the key is sent to remote owners.
+func TestPointsWriter_WritePoints_Idempotent(t *testing.T) {
+	pr := &coordinator.WritePointsRequest{
+		Database:        "mydb",
+		RetentionPolicy: "myrp",
+	}
+	ms := NewPointsWriterMetaClient()
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return nil
+	}
+	pr.AddPoint("cpu", 1.0, time.Now(), nil)
+
+	var local int64
+	store := &fakeStore{
+		WriteFn: func(shardID uint64, points []models.Point) error {
+			atomic.AddInt64(&local, 1)
+			return nil
+		},
+	}
+	var mu sync.Mutex
+	var keys []string
+	shardWriter := &fakeShardWriter{
+		WriteContextFn: func(ctx context.Context, shardID, ownerID uint64, points []models.Point) error {
+			mu.Lock()
+			keys = append(keys, coordinator.IdempotencyKey(ctx))
+			mu.Unlock()
+			return nil
+		},
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.TSDBStore = store
+	c.ShardWriter = shardWriter
+	c.Node = &influxdb.Node{ID: 1}
+	c.WriteKeys = coordinator.NewWriteKeys(10)
+
+	c.Open()
+	defer c.Close()
+
+	ctx := coordinator.WithIdempotencyKey(context.Background(), "batch-1")
+	for i := 0; i < 2; i++ {
+		if err := c.WritePointsPrivilegedContext(ctx, pr.Database, pr.RetentionPolicy, models.ConsistencyLevelAll, pr.Points); err != nil {
+			t.Fatalf("PointsWriter.WritePointsPrivilegedContext(): %v", err)
+		}
+	}
+	if n := atomic.LoadInt64(&local); n != 1 {
+		t.Fatalf("unexpected local writes: %d", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(keys) != 4 {
+		t.Fatalf("unexpected remote writes: %d", len(keys))
+	}
+	for _, key := range keys {
+		if key != "batch-1" {
+			t.Fatalf("unexpected key sent: %q", key)
+		}
+	}
+	stats := c.Statistics(nil)[0].Values
+	if v := stats["writeDuplicate"]; v != int64(1) {
+		t.Fatalf("unexpected writeDuplicate: %v", v)
+	}
+}
+
+// Ensures points are routed like MapShards maps them, without creating shard
+// groups.
+func TestPointsWriter_RoutePoints(t *testing.T) {
+	ms := PointsWriterMetaClient{}
+	rp := NewRetentionPolicy("myp", time.Hour, 2)
+	AttachShardGroupInfo(rp, []meta.ShardOwner{{NodeID: 3}})
+	ms.DatabaseFn = func(database string) *meta.DatabaseInfo {
+		return &meta.DatabaseInfo{Name: database, DefaultRetentionPolicy: "myrp"}
+	}
+	ms.RetentionPolicyFn = func(db, retentionPolicy string) (*meta.RetentionPolicyInfo, error) {
+		return rp, nil
+	}
+	ms.CreateShardGroupIfNotExistsFn = func(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+		t.Fatal("unexpected shard group created")
+		return nil, nil
+	}
+
+	c := coordinator.NewPointsWriter()
+	c.MetaClient = ms
+	c.ReadOnlyShards = shardReadOnlyFunc(func(id uint64) bool { return id == rp.ShardGroups[1].Shards[0].ID })
+
+	start := rp.ShardGroups[0].StartTime
+	pr := &coordinator.WritePointsRequest{}
+	pr.AddPoint("cpu", 1.0, start, nil)
+	pr.AddPoint("cpu", 1.0, start.Add(time.Hour), nil)
+	pr.AddPoint("cpu", 1.0, start.Add(3*time.Hour), nil)
+	pr.AddPoint("cpu", 1.0, start.Add(-2*time.Hour), nil)
+
+	name, routes, err := c.RoutePoints("mydb", "", pr.Points)
+	if err != nil {
+		t.Fatal(err)
+	} else if name != "myrp" {
+		t.Fatalf("unexpected retention policy: %s", name)
+	} else if len(routes) != 4 {
+		t.Fatalf("unexpected routes: %d", len(routes))
+	}
+
+	if r := routes[0]; r.ShardGroup != rp.ShardGroups[0].ID || r.ShardID != rp.ShardGroups[0].Shards[0].ID ||
+		!reflect.DeepEqual(r.Owners, []uint64{1, 2}) {
+		t.Fatalf("unexpected route: %+v", r)
+	}
+	if r := routes[1]; r.ShardGroup != rp.ShardGroups[1].ID || !reflect.DeepEqual(r.Owners, []uint64{3}) {
+		t.Fatalf("unexpected route: %+v", r)
+	} else if exp := "read-only"; !strings.Contains(r.Reason, exp) {
+		t.Fatalf("unexpected reason: %s", r.Reason)
+	}
+	if r := routes[2]; r.ShardGroup != 0 || !strings.Contains(r.Reason, "created") {
+		t.Fatalf("unexpected route: %+v", r)
+	}
+	if r := routes[3]; r.ShardGroup != 0 || !strings.Contains(r.Reason, "dropped") {
+		t.Fatalf("unexpected route: %+v", r)
+	}
+}
+
 type fakePointsWriter struct {
 	WritePointsIntoFn func(*influxdb_coordinator.IntoWriteRequest) error
 }
@@ -570,11 +1270,56 @@ func (f *fakeStore) CreateShard(database, retentionPolicy string, shardID uint64
 }
 
 type fakeShardWriter struct {
+	WriteFn        func(shardID, ownerID uint64, points []models.Point) error
+	WriteContextFn func(ctx context.Context, shardID, ownerID uint64, points []models.Point) error
+}
+
+func (f *fakeShardWriter) WriteShardContext(ctx context.Context, shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.WriteContextFn != nil {
+		return f.WriteContextFn(ctx, uint64(shardID), uint64(ownerID), points)
+	}
+	return f.WriteFn(uint64(shardID), uint64(ownerID), points)
+}
+
+type fakeHintedHandoff struct {
 	WriteFn func(shardID, ownerID uint64, points []models.Point) error
 }
 
-func (f *fakeShardWriter) WriteShard(shardID, ownerID uint64, points []models.Point) error {
-	return f.WriteFn(shardID, ownerID, points)
+func (f *fakeHintedHandoff) WriteShard(shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error {
+	return f.WriteFn(uint64(shardID), uint64(ownerID), points)
+}
+
+type hintedHandoffPolicyFunc func(database, rp string) bool
+
+func (f hintedHandoffPolicyFunc) HintedHandoffEnabled(database, rp string) bool {
+	return f(database, rp)
+}
+
+type shardCutoverFunc func(id uint64) *imeta.ShardCutover
+
+func (f shardCutoverFunc) ShardCutover(id uint64) *imeta.ShardCutover {
+	return f(id)
+}
+
+type clusterReadOnlyFunc func() bool
+
+func (f clusterReadOnlyFunc) ClusterReadOnly() bool {
+	return f()
+}
+
+type shardReadOnlyFunc func(id uint64) bool
+
+func (f shardReadOnlyFunc) ShardReadOnly(id uint64) bool {
+	return f(id)
+}
+
+type shardSealedFunc func(id uint64) bool
+
+func (f shardSealedFunc) ShardSealed(id uint64) bool {
+	return f(id)
 }
 
 func NewPointsWriterMetaClient() *PointsWriterMetaClient {
@@ -0,0 +1,366 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/gogo/protobuf/types"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/query"
+	"github.com/influxdata/influxdb/services/storage"
+	"github.com/influxdata/influxdb/storage/reads"
+	"github.com/influxdata/influxdb/storage/reads/datatypes"
+	"github.com/influxdata/influxdb/tsdb/cursors"
+	"github.com/influxdata/influxql"
+)
+
+const (
+	// tag keys of measurement and field used by storage predicates
+	promMeasurementTagKey = "_measurement"
+	promFieldTagKey       = "_field"
+	promDefaultField      = "value"
+)
+
+// PromReadStore serves prometheus remote read of http service through the
+// query executor, so that data of shards on other nodes is also read. Only
+// predicates of AND-ed tag comparisons generated for remote read are supported.
+type PromReadStore struct {
+	QueryExecutor interface {
+		ExecuteQuery(query *influxql.Query, opt query.ExecutionOptions, closing chan struct{}) <-chan *query.Result
+	}
+}
+
+func NewPromReadStore(e *query.Executor) *PromReadStore {
+	return &PromReadStore{QueryExecutor: e}
+}
+
+type promAuthorizerKey struct{}
+
+// WithReadAuthorizer returns a context of a remote read authorized by a, the
+// user of the request if authentication is enabled.
+func WithReadAuthorizer(ctx context.Context, a query.Authorizer) context.Context {
+	return context.WithValue(ctx, promAuthorizerKey{}, a)
+}
+
+// ReadAuthorizer returns the authorizer of ctx, query.OpenAuthorizer if none.
+func ReadAuthorizer(ctx context.Context) query.Authorizer {
+	if a, ok := ctx.Value(promAuthorizerKey{}).(query.Authorizer); ok && a != nil {
+		return a
+	}
+	return query.OpenAuthorizer
+}
+
+// promQuery holds a remote read request translated.
+type promQuery struct {
+	field   string
+	sources influxql.Sources
+	cond    influxql.Expr
+	// comparisons on measurement which can't be expressed in FROM clause
+	measurementFilters []func(name string) bool
+}
+
+func (q *promQuery) addTag(key string, op influxql.Token, lit influxql.Expr) {
+	expr := &influxql.BinaryExpr{
+		Op:  op,
+		LHS: &influxql.VarRef{Val: key, Type: influxql.Tag},
+		RHS: lit,
+	}
+	if q.cond == nil {
+		q.cond = expr
+		return
+	}
+	q.cond = &influxql.BinaryExpr{Op: influxql.AND, LHS: q.cond, RHS: expr}
+}
+
+func (q *promQuery) addMeasurement(op datatypes.Node_Comparison, value string, re *regexp.Regexp) {
+	switch op {
+	case datatypes.ComparisonEqual:
+		q.sources = influxql.Sources{&influxql.Measurement{Name: value}}
+	case datatypes.ComparisonRegex:
+		q.sources = influxql.Sources{&influxql.Measurement{Regex: &influxql.RegexLiteral{Val: re}}}
+	case datatypes.ComparisonNotEqual:
+		q.measurementFilters = append(q.measurementFilters, func(name string) bool { return name != value })
+	case datatypes.ComparisonNotRegex:
+		q.measurementFilters = append(q.measurementFilters, func(name string) bool { return !re.MatchString(name) })
+	}
+}
+
+func (q *promQuery) visit(n *datatypes.Node) error {
+	switch n.NodeType {
+	case datatypes.NodeTypeLogicalExpression:
+		if n.GetLogical() != datatypes.LogicalAnd {
+			return errors.New("only AND is supported in predicate")
+		}
+		for _, c := range n.Children {
+			if err := q.visit(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	case datatypes.NodeTypeParenExpression:
+		if len(n.Children) != 1 {
+			return errors.New("invalid paren expression")
+		}
+		return q.visit(n.Children[0])
+	case datatypes.NodeTypeComparisonExpression:
+	default:
+		return fmt.Errorf("unsupported predicate node: %v", n.NodeType)
+	}
+
+	if len(n.Children) != 2 || n.Children[0].NodeType != datatypes.NodeTypeTagRef {
+		return errors.New("comparison should be between tag and literal")
+	}
+	key := n.Children[0].GetTagRefValue()
+	op := n.GetComparison()
+
+	var lit influxql.Expr
+	var value string
+	var re *regexp.Regexp
+	switch v := n.Children[1].Value.(type) {
+	case *datatypes.Node_StringValue:
+		value = v.StringValue
+		lit = &influxql.StringLiteral{Val: value}
+	case *datatypes.Node_RegexValue:
+		var err error
+		// prometheus regex matchers are fully anchored
+		if re, err = regexp.Compile("^(?:" + v.RegexValue + ")$"); err != nil {
+			return err
+		}
+		lit = &influxql.RegexLiteral{Val: re}
+	default:
+		return errors.New("comparison should be between tag and string or regex")
+	}
+
+	var tok influxql.Token
+	switch op {
+	case datatypes.ComparisonEqual:
+		tok = influxql.EQ
+	case datatypes.ComparisonNotEqual:
+		tok = influxql.NEQ
+	case datatypes.ComparisonRegex:
+		tok = influxql.EQREGEX
+	case datatypes.ComparisonNotRegex:
+		tok = influxql.NEQREGEX
+	default:
+		return fmt.Errorf("unsupported comparison: %v", op)
+	}
+	if (tok == influxql.EQREGEX || tok == influxql.NEQREGEX) != (re != nil) {
+		return errors.New("regex comparison should be with regex")
+	}
+
+	switch key {
+	case promMeasurementTagKey:
+		q.addMeasurement(op, value, re)
+	case promFieldTagKey:
+		if op != datatypes.ComparisonEqual {
+			return errors.New("only equal is supported on field")
+		}
+		q.field = value
+	default:
+		q.addTag(key, tok, lit)
+	}
+	return nil
+}
+
+func (q *promQuery) statement(start, end int64) *influxql.SelectStatement {
+	cond := &influxql.BinaryExpr{
+		Op: influxql.AND,
+		LHS: &influxql.BinaryExpr{
+			Op:  influxql.GTE,
+			LHS: &influxql.VarRef{Val: "time"},
+			RHS: &influxql.IntegerLiteral{Val: start},
+		},
+		RHS: &influxql.BinaryExpr{
+			Op:  influxql.LTE,
+			LHS: &influxql.VarRef{Val: "time"},
+			RHS: &influxql.IntegerLiteral{Val: end},
+		},
+	}
+	var where influxql.Expr = cond
+	if q.cond != nil {
+		where = &influxql.BinaryExpr{Op: influxql.AND, LHS: &influxql.ParenExpr{Expr: q.cond}, RHS: cond}
+	}
+	return &influxql.SelectStatement{
+		Fields:     influxql.Fields{{Expr: &influxql.VarRef{Val: q.field, Type: influxql.Float}}},
+		Sources:    q.sources,
+		Condition:  where,
+		Dimensions: influxql.Dimensions{{Expr: &influxql.Wildcard{}}},
+	}
+}
+
+func newPromQuery(req *datatypes.ReadFilterRequest) (*promQuery, error) {
+	q := &promQuery{
+		field:   promDefaultField,
+		sources: influxql.Sources{&influxql.Measurement{Regex: &influxql.RegexLiteral{Val: regexp.MustCompile(".*")}}},
+	}
+	if req.Predicate != nil && req.Predicate.Root != nil {
+		if err := q.visit(req.Predicate.Root); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// ReadFilter reads series matching req into float cursors, as the user of
+// ctx, so that privileges on databases and measurements are enforced by the
+// statement executor like for queries.
+func (s *PromReadStore) ReadFilter(ctx context.Context, req *datatypes.ReadFilterRequest) (reads.ResultSet, error) {
+	if req.ReadSource == nil {
+		return nil, errors.New("missing read source")
+	}
+	var src storage.ReadSource
+	if err := types.UnmarshalAny(req.ReadSource, &src); err != nil {
+		return nil, err
+	}
+	if src.Database == "" {
+		return nil, errors.New("database is required")
+	}
+
+	pq, err := newPromQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range pq.sources.Measurements() {
+		m.Database = src.Database
+		m.RetentionPolicy = src.RetentionPolicy
+	}
+	stmt := pq.statement(req.Range.Start, req.Range.End)
+
+	closing := make(chan struct{})
+	defer close(closing)
+	results := s.QueryExecutor.ExecuteQuery(&influxql.Query{Statements: influxql.Statements{stmt}}, query.ExecutionOptions{
+		Database:        src.Database,
+		RetentionPolicy: src.RetentionPolicy,
+		Authorizer:      ReadAuthorizer(ctx),
+		ReadOnly:        true,
+		AbortCh:         ctx.Done(),
+	}, closing)
+
+	// results are drained even if failed to let the query finish
+	rs := &promResultSet{}
+	for r := range results {
+		if err != nil {
+			continue
+		}
+		if r.Err != nil {
+			err = r.Err
+			continue
+		}
+	NextRow:
+		for _, row := range r.Series {
+			for _, f := range pq.measurementFilters {
+				if !f(row.Name) {
+					continue NextRow
+				}
+			}
+			var series *promSeries
+			if series, err = newPromSeries(row, pq.field); err != nil {
+				break
+			}
+			rs.series = append(rs.series, series)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+type promSeries struct {
+	tags  models.Tags
+	value *cursors.FloatArray
+}
+
+func newPromSeries(row *models.Row, field string) (*promSeries, error) {
+	tags := make(map[string]string, len(row.Tags)+2)
+	for k, v := range row.Tags {
+		// tags missing in series are returned as empty
+		if v != "" {
+			tags[k] = v
+		}
+	}
+	tags[promMeasurementTagKey] = row.Name
+	tags[promFieldTagKey] = field
+
+	a := &cursors.FloatArray{
+		Timestamps: make([]int64, 0, len(row.Values)),
+		Values:     make([]float64, 0, len(row.Values)),
+	}
+	for _, vals := range row.Values {
+		if len(vals) != 2 || vals[1] == nil {
+			continue
+		}
+		ts, ok := vals[0].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("unexpected time %v", vals[0])
+		}
+		v, ok := vals[1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected value %v", vals[1])
+		}
+		a.Timestamps = append(a.Timestamps, ts.UnixNano())
+		a.Values = append(a.Values, v)
+	}
+	return &promSeries{tags: models.NewTags(tags), value: a}, nil
+}
+
+// promResultSet holds series read, ordered by series key.
+type promResultSet struct {
+	series []*promSeries
+	cur    *promSeries
+	sorted bool
+}
+
+func (rs *promResultSet) Next() bool {
+	if !rs.sorted {
+		sort.Slice(rs.series, func(i, j int) bool {
+			return models.CompareTags(rs.series[i].tags, rs.series[j].tags) < 0
+		})
+		rs.sorted = true
+	}
+	if len(rs.series) == 0 {
+		rs.cur = nil
+		return false
+	}
+	rs.cur, rs.series = rs.series[0], rs.series[1:]
+	return true
+}
+
+func (rs *promResultSet) Cursor() cursors.Cursor {
+	if rs.cur == nil {
+		return nil
+	}
+	return &promFloatCursor{a: rs.cur.value}
+}
+
+func (rs *promResultSet) Tags() models.Tags {
+	if rs.cur == nil {
+		return nil
+	}
+	return rs.cur.tags
+}
+
+func (rs *promResultSet) Close() {}
+
+func (rs *promResultSet) Err() error { return nil }
+
+func (rs *promResultSet) Stats() cursors.CursorStats { return cursors.CursorStats{} }
+
+// promFloatCursor returns all values in one array.
+type promFloatCursor struct {
+	a *cursors.FloatArray
+}
+
+func (c *promFloatCursor) Next() *cursors.FloatArray {
+	a := c.a
+	c.a = &cursors.FloatArray{}
+	return a
+}
+
+func (c *promFloatCursor) Close()                     {}
+func (c *promFloatCursor) Err() error                 { return nil }
+func (c *promFloatCursor) Stats() cursors.CursorStats { return cursors.CursorStats{} }
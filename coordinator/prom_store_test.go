@@ -0,0 +1,113 @@
+package coordinator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/prometheus"
+	"github.com/influxdata/influxdb/prometheus/remote"
+	"github.com/influxdata/influxdb/query"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb/cursors"
+	"github.com/influxdata/influxql"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeQueryExecutor struct {
+	stmt *influxql.SelectStatement
+	opt  query.ExecutionOptions
+	rows models.Rows
+}
+
+func (e *fakeQueryExecutor) ExecuteQuery(q *influxql.Query, opt query.ExecutionOptions, closing chan struct{}) <-chan *query.Result {
+	e.stmt = q.Statements[0].(*influxql.SelectStatement)
+	e.opt = opt
+	ch := make(chan *query.Result, 1)
+	ch <- &query.Result{Series: e.rows}
+	close(ch)
+	return ch
+}
+
+func TestPromReadStore_ReadFilter(t *testing.T) {
+	ts := time.Unix(100, 0)
+	e := &fakeQueryExecutor{rows: models.Rows{
+		{
+			Name:    "http_requests_total",
+			Tags:    map[string]string{"job": "b", "instance": ""},
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{ts, 2.0}},
+		},
+		{
+			Name:    "http_requests_total",
+			Tags:    map[string]string{"job": "a", "instance": "x"},
+			Columns: []string{"time", "value"},
+			Values:  [][]interface{}{{ts, 1.0}, {ts.Add(time.Second), nil}},
+		},
+	}}
+	s := &PromReadStore{QueryExecutor: e}
+
+	req, err := prometheus.ReadRequestToInfluxStorageRequest(&remote.ReadRequest{
+		Queries: []*remote.Query{{
+			StartTimestampMs: 1000,
+			EndTimestampMs:   200000,
+			Matchers: []*remote.LabelMatcher{
+				{Type: remote.MatchType_EQUAL, Name: "__name__", Value: "http_requests_total"},
+				{Type: remote.MatchType_REGEX_MATCH, Name: "job", Value: "a|b"},
+				{Type: remote.MatchType_NOT_EQUAL, Name: "instance", Value: "y"},
+			},
+		}},
+	}, "prom", "autogen")
+	assert.Nil(t, err)
+
+	rs, err := s.ReadFilter(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, `SELECT value::float FROM prom.autogen.http_requests_total WHERE (job::tag =~ /^(?:a|b)$/ AND instance::tag != 'y') AND time >= 1000000000 AND time <= 200000000000 GROUP BY *`, e.stmt.String())
+	assert.Equal(t, "prom", e.opt.Database)
+	assert.True(t, e.opt.ReadOnly)
+	assert.Equal(t, query.OpenAuthorizer, e.opt.Authorizer)
+
+	// ordered by series key
+	assert.True(t, rs.Next())
+	assert.Equal(t, "_field=value,_measurement=http_requests_total,instance=x,job=a", string(rs.Tags().HashKey()[1:]))
+	a := rs.Cursor().(cursors.FloatArrayCursor).Next()
+	assert.Equal(t, []float64{1}, a.Values)
+	assert.Equal(t, []int64{ts.UnixNano()}, a.Timestamps)
+
+	assert.True(t, rs.Next())
+	cur := rs.Cursor().(cursors.FloatArrayCursor)
+	assert.Equal(t, []float64{2}, cur.Next().Values)
+	assert.Equal(t, 0, cur.Next().Len())
+	assert.Equal(t, "", rs.Tags().GetString("instance"))
+
+	assert.False(t, rs.Next())
+}
+
+func TestPromReadStore_MeasurementNotEqual(t *testing.T) {
+	e := &fakeQueryExecutor{rows: models.Rows{
+		{Name: "up", Values: [][]interface{}{{time.Unix(1, 0), 1.0}}},
+		{Name: "down", Values: [][]interface{}{{time.Unix(1, 0), 0.0}}},
+	}}
+	s := &PromReadStore{QueryExecutor: e}
+
+	req, err := prometheus.ReadRequestToInfluxStorageRequest(&remote.ReadRequest{
+		Queries: []*remote.Query{{
+			EndTimestampMs: 2000,
+			Matchers: []*remote.LabelMatcher{
+				{Type: remote.MatchType_NOT_EQUAL, Name: "__name__", Value: "down"},
+			},
+		}},
+	}, "prom", "")
+	assert.Nil(t, err)
+
+	// read as the user of the request
+	u := &meta.UserInfo{Name: "reader"}
+	rs, err := s.ReadFilter(WithReadAuthorizer(context.Background(), u), req)
+	assert.Nil(t, err)
+	assert.Equal(t, u, e.opt.Authorizer)
+	assert.Equal(t, `SELECT value::float FROM prom../.*/ WHERE time >= 0 AND time <= 2000000000 GROUP BY *`, e.stmt.String())
+	assert.True(t, rs.Next())
+	assert.Equal(t, "up", rs.Tags().GetString("_measurement"))
+	assert.False(t, rs.Next())
+}
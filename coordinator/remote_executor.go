@@ -31,6 +31,7 @@ type RemoteNodeExecutor interface {
 	MapType(nodeId uint64, m *influxql.Measurement, field string, shardIds []uint64) (influxql.DataType, error)
 	CreateIterator(nodeId uint64, ctx context.Context, m *influxql.Measurement, opt query.IteratorOptions, shardIds []uint64) (query.Iterator, error)
 	TaskManagerStatement(nodeId uint64, stmt influxql.Statement) (*query.Result, error)
+	NodeStatement(nodeId uint64, stmt influxql.Statement) (*query.Result, error)
 	Stats() []StatEntity
 }
 
@@ -38,6 +39,7 @@ type remoteNodeExecutor struct {
 	ClientPool         *ClientPool
 	DailTimeout        time.Duration
 	ShardReaderTimeout time.Duration
+	QueryTimeout       time.Duration
 	ClusterTracing     bool
 	Logger             *zap.Logger
 }
@@ -55,6 +57,15 @@ func writeTestPacket(conn net.Conn) (err error) {
 	return
 }
 
+// remoteReadError returns the error of a read rejected by a remote node,
+// ErrReadsDrained if drained so that the read is planned on another node.
+func remoteReadError(msg string) error {
+	if msg == ErrReadsDrained.Error() {
+		return ErrReadsDrained
+	}
+	return errors.New(msg)
+}
+
 func getConnWithRetry(pool *ClientPool, nodeId uint64, logger *zap.Logger) (x.PooledConn, error) {
 	var (
 		conn x.PooledConn
@@ -81,11 +92,16 @@ func getConnWithRetry(pool *ClientPool, nodeId uint64, logger *zap.Logger) (x.Po
 }
 
 func (executor *remoteNodeExecutor) CreateIterator(nodeId uint64, ctx context.Context, m *influxql.Measurement, opt query.IteratorOptions, shardIds []uint64) (query.Iterator, error) {
+	// Don't start (or retry) on other nodes for an abandoned query
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	conn, err := getConnWithRetry(executor.ClientPool, nodeId, executor.Logger)
 	if err != nil {
 		return nil, err
 	}
 	//no need here defer conn.Close()
+	stop := interruptOnDone(ctx, conn)
 
 	var resp CreateIteratorResponse
 	if err := func() error {
@@ -100,6 +116,7 @@ func (executor *remoteNodeExecutor) CreateIterator(nodeId uint64, ctx context.Co
 			Measurement: *m, //TODO:改为Sources
 			Opt:         opt,
 			SpanContex:  spanCtx,
+			Timeout:     remainingTimeout(ctx, executor.QueryTimeout),
 		}); err != nil {
 			conn.MarkUnusable()
 			return err
@@ -110,18 +127,24 @@ func (executor *remoteNodeExecutor) CreateIterator(nodeId uint64, ctx context.Co
 			conn.MarkUnusable()
 			return err
 		} else if resp.Err != nil {
-			return resp.Err
+			return remoteReadError(resp.Err.Error())
 		}
 
 		return nil
 	}(); err != nil {
+		stop()
 		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 
 	stats := query.IteratorStats{SeriesN: resp.SeriesN}
 	//conn.Close will be invoked when iterator.Close
-	itr := query.NewReaderIterator(ctx, newIteratorReader(conn, resp.Termination), resp.DataType, stats)
+	rd := newIteratorReader(conn, resp.Termination)
+	rd.stop = stop
+	itr := query.NewReaderIterator(ctx, rd, resp.DataType, stats)
 	return itr, nil
 }
 
@@ -152,7 +175,7 @@ func (executor *remoteNodeExecutor) MapType(nodeId uint64, m *influxql.Measureme
 			conn.MarkUnusable()
 			return err
 		} else if resp.Err != "" {
-			return errors.New(resp.Err)
+			return remoteReadError(resp.Err)
 		}
 
 		return nil
@@ -185,7 +208,7 @@ func (executor *remoteNodeExecutor) IteratorCost(nodeId uint64, m *influxql.Meas
 			conn.MarkUnusable()
 			return err
 		} else if resp.Err != "" {
-			return errors.New(resp.Err)
+			return remoteReadError(resp.Err)
 		}
 
 		return nil
@@ -217,7 +240,7 @@ func (executor *remoteNodeExecutor) FieldDimensions(nodeId uint64, m *influxql.M
 			conn.MarkUnusable()
 			return err
 		} else if resp.Err != nil {
-			return resp.Err
+			return remoteReadError(resp.Err.Error())
 		}
 
 		return nil
@@ -262,6 +285,40 @@ func (executor *remoteNodeExecutor) TaskManagerStatement(nodeId uint64, stmt inf
 	return result, nil
 }
 
+func (executor *remoteNodeExecutor) NodeStatement(nodeId uint64, stmt influxql.Statement) (*query.Result, error) {
+	conn, err := getConnWithRetry(executor.ClientPool, nodeId, executor.Logger)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var resp NodeStatementResponse
+	if err := func() error {
+		var req NodeStatementRequest
+		req.SetStatement(stmt.String())
+		req.SetDatabase("")
+		if err := EncodeTLV(conn, executeNodeStatementRequestMessage, &req); err != nil {
+			conn.MarkUnusable()
+			return err
+		}
+
+		if _, err := decodeTLV(conn, &resp); err != nil {
+			conn.MarkUnusable()
+			return err
+		} else if resp.Err != "" {
+			return errors.New(resp.Err)
+		}
+
+		return nil
+	}(); err != nil {
+		return nil, err
+	}
+
+	result := &query.Result{}
+	*result = resp.Result
+	return result, nil
+}
+
 func (executor *remoteNodeExecutor) SeriesCardinality(nodeId uint64, database string) (int64, error) {
 	conn, err := getConnWithRetry(executor.ClientPool, nodeId, executor.Logger)
 	if err != nil {
@@ -283,7 +340,7 @@ func (executor *remoteNodeExecutor) SeriesCardinality(nodeId uint64, database st
 			conn.MarkUnusable()
 			return err
 		} else if resp.Err != "" {
-			return errors.New(resp.Err)
+			return remoteReadError(resp.Err)
 		}
 
 		n = resp.N
@@ -317,7 +374,7 @@ func (executor *remoteNodeExecutor) MeasurementNames(nodeId uint64, database str
 			conn.MarkUnusable()
 			return err
 		} else if resp.Err != "" {
-			return errors.New(resp.Err)
+			return remoteReadError(resp.Err)
 		}
 
 		names = resp.Names
@@ -353,7 +410,7 @@ func (executor *remoteNodeExecutor) TagValues(nodeId uint64, shardIDs []uint64,
 			conn.MarkUnusable()
 			return err
 		} else if resp.Err != "" {
-			return errors.New(resp.Err)
+			return remoteReadError(resp.Err)
 		}
 
 		tagValues = resp.TagValues
@@ -387,7 +444,7 @@ func (executor *remoteNodeExecutor) TagKeys(nodeId uint64, shardIDs []uint64, co
 			conn.MarkUnusable()
 			return err
 		} else if resp.Err != "" {
-			return errors.New(resp.Err)
+			return remoteReadError(resp.Err)
 		}
 
 		tagKeys = resp.TagKeys
@@ -507,6 +564,8 @@ type iteratorReader struct {
 	judger     *x.CyclicBuffer
 	terminated bool
 	bytes      int
+	// stop stops interrupting reader once the query is done, optional
+	stop func()
 }
 
 func newIteratorReader(rd io.ReadCloser, terminator []byte) *iteratorReader {
@@ -565,7 +624,8 @@ func (r *iteratorReader) consumeRest() (discarded int) {
 	for {
 		n, err := r.Read(buf)
 		discarded += n
-		if err == io.EOF {
+		// interrupted reader never reaches the termination
+		if err != nil {
 			break
 		}
 	}
@@ -574,6 +634,9 @@ func (r *iteratorReader) consumeRest() (discarded int) {
 
 func (r *iteratorReader) Close() error {
 	r.consumeRest()
+	if r.stop != nil {
+		r.stop()
+	}
 	return r.reader.Close()
 }
 
@@ -40,6 +40,8 @@ func (w *WritePointsRequest) AddPoint(name string, value interface{}, timestamp
 // WriteShardRequest represents the a request to write a slice of points to a shard
 type WriteShardRequest struct {
 	pb internal.WriteShardRequest
+
+	format writeFormat
 }
 
 // WriteShardResponse represents the response returned from a remote WriteShardRequest call
@@ -61,6 +63,23 @@ func (w *WriteShardRequest) Database() string { return w.pb.GetDatabase() }
 
 func (w *WriteShardRequest) RetentionPolicy() string { return w.pb.GetRetentionPolicy() }
 
+// SetIdempotencyKey sets the key owners skip points already written with
+func (w *WriteShardRequest) SetIdempotencyKey(key string) { w.pb.IdempotencyKey = &key }
+
+// IdempotencyKey returns the key of the write, empty if none
+func (w *WriteShardRequest) IdempotencyKey() string { return w.pb.GetIdempotencyKey() }
+
+// SetSource sets the node sending the write and its incarnation
+func (w *WriteShardRequest) SetSource(nodeID, incarnation uint64) {
+	w.pb.NodeID = &nodeID
+	w.pb.Incarnation = &incarnation
+}
+
+// Source returns the node sending the write and its incarnation, 0 if unknown
+func (w *WriteShardRequest) Source() (nodeID, incarnation uint64) {
+	return w.pb.GetNodeID(), w.pb.GetIncarnation()
+}
+
 // Points returns the time series Points
 func (w *WriteShardRequest) Points() []models.Point { return w.unmarshalPoints() }
 
@@ -89,9 +108,35 @@ func (w *WriteShardRequest) AddPoints(points []models.Point) {
 	}
 }
 
+// setFormat sets how points are compressed and encoded by MarshalBinary
+func (w *WriteShardRequest) setFormat(f writeFormat) { w.format = f }
+
 // MarshalBinary encodes the object to a binary format.
 func (w *WriteShardRequest) MarshalBinary() ([]byte, error) {
-	return proto.Marshal(&w.pb)
+	if w.format == (writeFormat{}) || len(w.pb.Points) == 0 {
+		return proto.Marshal(&w.pb)
+	}
+	pb := w.pb
+	pb.Points = nil
+	encoding := w.format.encoding
+	block, err := encodePoints(encoding, w.pb.Points)
+	if err != nil {
+		// e.g. points without time can't be delta encoded
+		encoding = encodingNone
+		if block, err = encodePoints(encoding, w.pb.Points); err != nil {
+			return nil, err
+		}
+	}
+	if encoding != encodingNone {
+		pb.Encoding = proto.Int32(int32(encoding))
+	}
+	if pb.Block, err = compressBlock(w.format.compression, block); err != nil {
+		return nil, err
+	}
+	if w.format.compression != compressionNone {
+		pb.Compression = proto.Int32(int32(w.format.compression))
+	}
+	return proto.Marshal(&pb)
 }
 
 // UnmarshalBinary populates WritePointRequest from a binary format.
@@ -99,6 +144,19 @@ func (w *WriteShardRequest) UnmarshalBinary(buf []byte) error {
 	if err := proto.Unmarshal(buf, &w.pb); err != nil {
 		return err
 	}
+	if w.pb.Block == nil {
+		return nil
+	}
+	block, err := decompressBlock(pointsCompression(w.pb.GetCompression()), w.pb.Block)
+	if err != nil {
+		return fmt.Errorf("decompress points: %s", err)
+	}
+	points, err := decodePoints(pointsEncoding(w.pb.GetEncoding()), block)
+	if err != nil {
+		return fmt.Errorf("decode points: %s", err)
+	}
+	w.pb.Points = append(w.pb.Points, points...)
+	w.pb.Compression, w.pb.Encoding, w.pb.Block = nil, nil, nil
 	return nil
 }
 
@@ -130,6 +188,47 @@ func (w *WriteShardResponse) Code() int { return int(w.pb.GetCode()) }
 // Message returns the Message
 func (w *WriteShardResponse) Message() string { return w.pb.GetMessage() }
 
+// SetDropped sets the number of points rejected by a partial write
+func (w *WriteShardResponse) SetDropped(n int) { w.pb.Dropped = proto.Int64(int64(n)) }
+
+// Dropped returns the number of points rejected by a partial write
+func (w *WriteShardResponse) Dropped() int { return int(w.pb.GetDropped()) }
+
+// SetCompressions sets compressions of points the node accepts
+func (w *WriteShardResponse) SetCompressions(c []int32) { w.pb.Compressions = c }
+
+// Compressions returns compressions of points the node accepts, none for
+// nodes before compression
+func (w *WriteShardResponse) Compressions() []int32 { return w.pb.GetCompressions() }
+
+// SetEncodings sets encodings of points the node accepts
+func (w *WriteShardResponse) SetEncodings(e []int32) { w.pb.Encodings = e }
+
+// Encodings returns encodings of points the node accepts, none for nodes
+// before encodings
+func (w *WriteShardResponse) Encodings() []int32 { return w.pb.GetEncodings() }
+
+// SetBacklog sets the local shard writes the node has in flight
+func (w *WriteShardResponse) SetBacklog(b WriteBacklog) {
+	w.pb.BacklogWrites = proto.Int64(b.Writes)
+	w.pb.BacklogPoints = proto.Int64(b.Points)
+}
+
+// Backlog returns the local shard writes the node has in flight, none for
+// nodes before backlogs
+func (w *WriteShardResponse) Backlog() WriteBacklog {
+	return WriteBacklog{Writes: w.pb.GetBacklogWrites(), Points: w.pb.GetBacklogPoints()}
+}
+
+// SetDiskFree sets the bytes free on the disk of the shards of the node
+func (w *WriteShardResponse) SetDiskFree(free int64) { w.pb.DiskFree = proto.Int64(free) }
+
+// DiskFree returns the bytes free on the disk of the shards of the node, ok
+// is false for nodes not reporting it
+func (w *WriteShardResponse) DiskFree() (free int64, ok bool) {
+	return w.pb.GetDiskFree(), w.pb.DiskFree != nil
+}
+
 // MarshalBinary encodes the object to a binary format.
 func (w *WriteShardResponse) MarshalBinary() ([]byte, error) {
 	return proto.Marshal(&w.pb)
@@ -242,6 +341,16 @@ func (w *TaskManagerStatementResponse) UnmarshalBinary(buf []byte) error {
 	return w.Result.UnmarshalJSON(proto.Result)
 }
 
+// NodeStatementRequest asks a node to execute a statement about itself alone.
+type NodeStatementRequest struct {
+	ExecuteStatementRequest
+}
+
+// NodeStatementResponse carries the result of a NodeStatementRequest.
+type NodeStatementResponse struct {
+	TaskManagerStatementResponse
+}
+
 type MapTypeRequest struct {
 	Sources  influxql.Sources
 	Field    string
@@ -590,6 +699,8 @@ type CreateIteratorRequest struct {
 	ShardIDs    []uint64
 	Opt         query.IteratorOptions
 	Measurement influxql.Measurement
+	// Timeout bounds the iterator on remote node, 0 means no limit
+	Timeout time.Duration
 }
 
 type Measurement struct {
@@ -634,12 +745,16 @@ func (r *CreateIteratorRequest) MarshalBinary() ([]byte, error) {
 		}
 	}
 
-	return proto.Marshal(&internal.CreateIteratorRequest{
+	pb := &internal.CreateIteratorRequest{
 		ShardIDs:    r.ShardIDs,
 		Measurement: mbuf,
 		Opt:         buf,
 		SpanContext: sbuf,
-	})
+	}
+	if r.Timeout > 0 {
+		pb.Timeout = proto.Int64(int64(r.Timeout))
+	}
+	return proto.Marshal(pb)
 }
 
 // UnmarshalBinary decodes data into r.
@@ -650,6 +765,7 @@ func (r *CreateIteratorRequest) UnmarshalBinary(data []byte) error {
 	}
 
 	r.ShardIDs = pb.GetShardIDs()
+	r.Timeout = time.Duration(pb.GetTimeout())
 	if err := r.Opt.UnmarshalBinary(pb.GetOpt()); err != nil {
 		return err
 	}
@@ -3,21 +3,26 @@ package coordinator
 import (
 	"encoding"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/angopher/chronus/coordinator/internal"
 	"github.com/angopher/chronus/coordinator/request"
+	imeta "github.com/angopher/chronus/services/meta"
 	errs "github.com/go-errors/errors"
 	"github.com/influxdata/influxdb"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/query"
+	"github.com/influxdata/influxdb/tsdb"
 	"github.com/influxdata/influxql"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
 	"github.com/influxdata/influxdb/services/meta"
 )
@@ -51,6 +56,9 @@ type Service struct {
 	closing chan struct{}
 
 	Listener net.Listener
+	// GRPCListener serves shard writes over gRPC if not nil
+	GRPCListener net.Listener
+	grpcServer   *grpc.Server
 
 	MetaClient interface {
 		ShardOwner(shardID uint64) (string, string, *meta.ShardGroupInfo)
@@ -59,8 +67,50 @@ type Service struct {
 	TSDBStore   TSDBStore
 	TaskManager *query.TaskManager
 
+	// NodeStatements executes statements about this node alone, e.g. SHOW
+	// STATS, for nodes gathering them across the cluster, optional
+	NodeStatements query.StatementExecutor
+
+	// WriteKeys skips writes with idempotency keys already applied, optional
+	WriteKeys *WriteKeys
+
+	// ReadOnlyShards rejects writes to shards marked read-only, optional
+	ReadOnlyShards interface {
+		ShardReadOnly(id uint64) bool
+	}
+
+	// ShardCutovers rejects writes to shards in the cutover of their moves,
+	// buffering them by HintedHandoff for the new owner, optional
+	ShardCutovers interface {
+		ShardCutover(id uint64) *imeta.ShardCutover
+	}
+	HintedHandoff interface {
+		WriteShard(shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error
+	}
+
+	// DiskHeadroom rejects writes while the disk of shards is low on free
+	// space, reported to writers, optional
+	DiskHeadroom *DiskHeadroom
+
+	// Incarnations rejects writes of nodes of stale incarnations, optional
+	Incarnations interface {
+		StaleIncarnation(id, incarnation uint64) bool
+	}
+
+	// MeasurementTombstones are drops of measurements this node applies if
+	// it missed them, optional
+	MeasurementTombstones MeasurementTombstones
+
 	Logger *zap.Logger
 	stats  *internal.InternalServiceStatistics
+
+	// backlog counts local shard writes in flight, reported to writers
+	backlog writeBacklog
+
+	// readsDrained rejects reads of queries from other nodes if 1,
+	// readsInFlight counts the ones accepted and not finished yet
+	readsDrained  int32
+	readsInFlight int64
 }
 
 // NewService returns a new instance of Service.
@@ -77,10 +127,30 @@ func NewService(c Config) *Service {
 func (s *Service) Open() error {
 
 	s.Logger.Info("Starting cluster service")
+	if s.MeasurementTombstones != nil {
+		// Drops missed while down apply before writes are served
+		if err := s.applyMeasurementTombstones(); err != nil {
+			s.Logger.Warn("Failed to apply measurement tombstones", zap.Error(err))
+		}
+		s.wg.Add(1)
+		go s.measurementTombstonesLoop()
+	}
+
 	// Begin serving connections.
 	s.wg.Add(1)
 	go s.serve()
 
+	if s.GRPCListener != nil {
+		s.grpcServer = s.newGRPCServer()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.grpcServer.Serve(s.GRPCListener); err != nil {
+				s.Logger.Error("cluster grpc service stopped", zap.Error(err))
+			}
+		}()
+	}
+
 	return nil
 }
 
@@ -132,6 +202,9 @@ func (s *Service) Close() error {
 	if s.Listener != nil {
 		s.Listener.Close()
 	}
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
 
 	// Shut down all handlers.
 	close(s.closing)
@@ -146,7 +219,18 @@ func (s *Service) handleRequest(typ byte, data []byte) (respType byte, resp enco
 	case writeShardRequestMessage:
 		err = s.processWriteShardRequest(data)
 		respType = writeShardResponseMessage
-		resp = &WriteShardResponse{}
+		writeResp := &WriteShardResponse{}
+		writeResp.SetCompressions(supportedCompressions)
+		writeResp.SetEncodings(supportedEncodings)
+		writeResp.SetBacklog(s.WriteBacklog())
+		if free, ok := s.DiskHeadroom.Free(time.Now()); ok {
+			writeResp.SetDiskFree(free)
+		}
+		var partialErr tsdb.PartialWriteError
+		if errors.As(err, &partialErr) {
+			writeResp.SetDropped(partialErr.Dropped)
+		}
+		resp = writeResp
 	case executeStatementRequestMessage:
 		err = s.processExecuteStatementRequest(data)
 		respType = writeShardResponseMessage
@@ -184,6 +268,9 @@ func (s *Service) handleRequest(typ byte, data []byte) (respType byte, resp enco
 	case executeTaskManagerRequestMessage:
 		respType = executeTaskManagerResponseMessage
 		resp, err = s.processTaskManagerRequest(data)
+	case executeNodeStatementRequestMessage:
+		respType = executeNodeStatementResponseMessage
+		resp, err = s.processNodeStatementRequest(data)
 	case testRequestMessage:
 		// do nothing
 	default:
@@ -197,7 +284,7 @@ func (s *Service) handleRequest(typ byte, data []byte) (respType byte, resp enco
 	}
 	if serverResp, ok := resp.(ServerResponse); ok {
 		if err != nil {
-			serverResp.SetCode(1)
+			serverResp.SetCode(int(ErrorCodeOf(err)))
 			serverResp.SetMessage(err.Error())
 		} else {
 			serverResp.SetCode(0)
@@ -281,6 +368,43 @@ func (s *Service) handleConn(conn net.Conn) {
 	}
 }
 
+// DrainReads stops or resumes serving reads of queries from other nodes,
+// which plan them on other owners of shards while drained. Reads in flight
+// are finished, writes are served as usual.
+func (s *Service) DrainReads(drained bool) {
+	var v int32
+	if drained {
+		v = 1
+	}
+	if atomic.SwapInt32(&s.readsDrained, v) != v {
+		s.Logger.Info("Reads of other nodes", zap.Bool("drained", drained))
+	}
+}
+
+// ReadsDrained returns whether reads are drained, and the number of reads
+// still in flight.
+func (s *Service) ReadsDrained() (bool, int64) {
+	return atomic.LoadInt32(&s.readsDrained) == 1, atomic.LoadInt64(&s.readsInFlight)
+}
+
+// beginRead counts a read in flight until endRead, ErrReadsDrained is
+// returned instead if reads are drained.
+func (s *Service) beginRead() error {
+	// counted before checking, so that no read accepted is missed by
+	// ReadsDrained once drained
+	atomic.AddInt64(&s.readsInFlight, 1)
+	if atomic.LoadInt32(&s.readsDrained) == 1 {
+		atomic.AddInt64(&s.readsInFlight, -1)
+		atomic.AddInt64(&s.stats.ReadsRejected, 1)
+		return ErrReadsDrained
+	}
+	return nil
+}
+
+func (s *Service) endRead() {
+	atomic.AddInt64(&s.readsInFlight, -1)
+}
+
 func (s *Service) executeStatement(stmt influxql.Statement, database string) error {
 	switch t := stmt.(type) {
 	case *influxql.DropDatabaseStatement:
@@ -8,7 +8,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/angopher/chronus/logging"
 	"github.com/angopher/chronus/x"
+	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/pkg/tracing"
 	"github.com/influxdata/influxdb/query"
 	"github.com/influxdata/influxdb/tsdb"
@@ -48,6 +50,42 @@ func (s *Service) processTaskManagerRequest(buf []byte) (*TaskManagerStatementRe
 	return &resp, err
 }
 
+func (s *Service) processNodeStatementRequest(buf []byte) (*NodeStatementResponse, error) {
+	var (
+		resp NodeStatementResponse
+		err  error
+	)
+	if err = func() error {
+		if s.NodeStatements == nil {
+			return errors.New("node statements not supported")
+		}
+
+		var req NodeStatementRequest
+		if err := req.UnmarshalBinary(buf); err != nil {
+			return err
+		}
+
+		stmt, err := influxql.ParseStatement(req.Statement())
+		if err != nil {
+			return err
+		}
+
+		recvCtx := &query.ExecutionContext{
+			Context: context.Background(),
+			Results: make(chan *query.Result, 1),
+		}
+		err = s.NodeStatements.ExecuteStatement(stmt, recvCtx)
+		if err != nil {
+			return err
+		}
+		resp.Result = *(<-recvCtx.Results)
+		return nil
+	}(); err != nil {
+		resp.Err = err.Error()
+	}
+	return &resp, err
+}
+
 func (s *Service) processMapTypeRequest(buf []byte) (*MapTypeResponse, error) {
 	var (
 		resp MapTypeResponse
@@ -55,6 +93,11 @@ func (s *Service) processMapTypeRequest(buf []byte) (*MapTypeResponse, error) {
 	)
 	atomic.AddInt64(&s.stats.MapTypeReq, 1)
 	if err = func() error {
+		if err := s.beginRead(); err != nil {
+			return err
+		}
+		defer s.endRead()
+
 		var req MapTypeRequest
 		if err := req.UnmarshalBinary(buf); err != nil {
 			return err
@@ -100,6 +143,11 @@ func (s *Service) processIteratorCostRequest(buf []byte) (*IteratorCostResponse,
 	)
 	atomic.AddInt64(&s.stats.IteratorCostReq, 1)
 	if err = func() error {
+		if err := s.beginRead(); err != nil {
+			return err
+		}
+		defer s.endRead()
+
 		var req IteratorCostRequest
 		if err := req.UnmarshalBinary(buf); err != nil {
 			return err
@@ -197,6 +245,11 @@ func (s *Service) processSeriesCardinalityRequest(buf []byte) (*SeriesCardinalit
 	)
 	atomic.AddInt64(&s.stats.SeriesCardinalityReq, 1)
 	if err = func() error {
+		if err := s.beginRead(); err != nil {
+			return err
+		}
+		defer s.endRead()
+
 		var req SeriesCardinalityRequest
 		if err := req.UnmarshalBinary(buf); err != nil {
 			return err
@@ -218,6 +271,11 @@ func (s *Service) processMeasurementNamesRequest(buf []byte) (*MeasurementNamesR
 		err  error
 	)
 	if err = func() error {
+		if err := s.beginRead(); err != nil {
+			return err
+		}
+		defer s.endRead()
+
 		var req MeasurementNamesRequest
 		if err := req.UnmarshalBinary(buf); err != nil {
 			return err
@@ -240,6 +298,11 @@ func (s *Service) processTagKeysRequest(buf []byte) (*TagKeysResponse, error) {
 	)
 	atomic.AddInt64(&s.stats.TagKeysReq, 1)
 	if err = func() error {
+		if err := s.beginRead(); err != nil {
+			return err
+		}
+		defer s.endRead()
+
 		var req TagKeysRequest
 		if err := req.UnmarshalBinary(buf); err != nil {
 			return err
@@ -262,6 +325,11 @@ func (s *Service) processTagValuesRequest(buf []byte) (*TagValuesResponse, error
 	)
 	atomic.AddInt64(&s.stats.TagValuesReq, 1)
 	if err = func() error {
+		if err := s.beginRead(); err != nil {
+			return err
+		}
+		defer s.endRead()
+
 		var req TagValuesRequest
 		if err := req.UnmarshalBinary(buf); err != nil {
 			return err
@@ -299,12 +367,47 @@ func (s *Service) processWriteShardRequest(buf []byte) error {
 	if err := req.UnmarshalBinary(buf); err != nil {
 		return err
 	}
+	if nodeID, incarnation := req.Source(); s.Incarnations != nil && s.Incarnations.StaleIncarnation(nodeID, incarnation) {
+		// e.g. a half-dead process of a node deleted or started again
+		atomic.AddInt64(&s.stats.WriteShardFail, 1)
+		return fmt.Errorf("shard %d from node %d incarnation %d: %w", req.ShardID(), nodeID, incarnation, ErrStaleIncarnation)
+	}
 
-	points := req.Points()
+	return s.WriteShardLocal(req.ShardID(), req.Database(), req.RetentionPolicy(), req.IdempotencyKey(), req.Points())
+}
+
+// WriteShardLocal writes points to shard shardID of this node like the ones
+// sent by other nodes, i.e. retries of idempotencyKey are applied once and
+// the shard is created in database and retentionPolicy if not yet.
+func (s *Service) WriteShardLocal(shardID uint64, database, retentionPolicy, idempotencyKey string, points []models.Point) error {
 	// stats
 	atomic.AddInt64(&s.stats.WriteShardReq, 1)
 	atomic.AddInt64(&s.stats.WriteShardPointsReq, int64(len(points)))
-	err := s.TSDBStore.WriteToShard(req.ShardID(), points)
+	done := s.backlog.begin(len(points))
+	defer done()
+	if s.ReadOnlyShards != nil && s.ReadOnlyShards.ShardReadOnly(shardID) {
+		atomic.AddInt64(&s.stats.WriteShardFail, 1)
+		return fmt.Errorf("shard %d: %w", shardID, ErrShardReadOnly)
+	}
+	if s.DiskHeadroom.Low(time.Now()) {
+		// retried by writers once the disk is freed
+		atomic.AddInt64(&s.stats.WriteShardFail, 1)
+		return fmt.Errorf("shard %d: %w", shardID, ErrOwnerDiskLow)
+	}
+	if s.ShardCutovers != nil {
+		if err := s.rejectShardCutover(shardID, points); err != nil {
+			atomic.AddInt64(&s.stats.WriteShardFail, 1)
+			return err
+		}
+	}
+	if !s.WriteKeys.Reserve(shardID, idempotencyKey) {
+		// retry of a write applied already
+		atomic.AddInt64(&s.stats.WriteShardDuplicate, 1)
+		return nil
+	}
+	applied := false
+	defer func() { s.WriteKeys.Done(shardID, idempotencyKey, applied) }()
+	err := s.TSDBStore.WriteToShard(shardID, points)
 
 	// We may have received a write for a shard that we don't have locally because the
 	// sending node may have just created the shard (via the metastore) and the write
@@ -312,31 +415,36 @@ func (s *Service) processWriteShardRequest(buf []byte) error {
 	// to check the metastore to determine what database and retention policy this
 	// shard should reside within.
 	if err == tsdb.ErrShardNotFound {
-		db, rp := req.Database(), req.RetentionPolicy()
-		if db == "" || rp == "" {
+		if database == "" || retentionPolicy == "" {
 			s.Logger.Error("drop write request: no database or retention policy received\n",
-				zap.Uint64("shard", req.ShardID()))
+				logging.ShardID(shardID), logging.IdempotencyKey(idempotencyKey))
 			return nil
 		}
-
-		err = s.TSDBStore.CreateShard(req.Database(), req.RetentionPolicy(), req.ShardID(), true) //enable what mean?
-		if err != nil {
+		if !s.ownsShard(shardID) {
+			// e.g. points buffered for the new owner of a shard whose cutover
+			// expired, the shard is not moved here
 			atomic.AddInt64(&s.stats.WriteShardFail, 1)
-			return fmt.Errorf("create shard %d: %s", req.ShardID(), err)
+			return fmt.Errorf("write shard %d: %w", shardID, err)
 		}
 
-		err = s.TSDBStore.WriteToShard(req.ShardID(), points)
+		err = s.TSDBStore.CreateShard(database, retentionPolicy, shardID, true) //enable what mean?
 		if err != nil {
 			atomic.AddInt64(&s.stats.WriteShardFail, 1)
-			return fmt.Errorf("write shard %d: %s", req.ShardID(), err)
+			return fmt.Errorf("create shard %d: %w", shardID, err)
 		}
+
+		err = s.TSDBStore.WriteToShard(shardID, points)
 	}
 
 	if err != nil {
 		atomic.AddInt64(&s.stats.WriteShardFail, 1)
-		return fmt.Errorf("write shard %d: %s", req.ShardID(), err)
+		var partialErr tsdb.PartialWriteError
+		// points accepted must not be written again by retries
+		applied = errors.As(err, &partialErr)
+		return fmt.Errorf("write shard %d: %w", shardID, err)
 	}
 
+	applied = true
 	return nil
 }
 
@@ -344,15 +452,30 @@ func (s *Service) processCreateIteratorRequest(conn io.ReadWriter, buf []byte) (
 	var itr query.Iterator
 	var trace *tracing.Trace
 	var span *tracing.Span
+	ctx := context.Background()
+	cancel := func() {}
+	defer func() { cancel() }()
+	// the read lasts until the iterator is streamed
+	endRead := func() {}
+	defer func() { endRead() }()
 	respType := createIteratorResponseMessage
 	if err := func() error {
+		if err := s.beginRead(); err != nil {
+			return err
+		}
+		endRead = s.endRead
+
 		// Parse request.
 		var req CreateIteratorRequest
 		if err := req.UnmarshalBinary(buf); err != nil {
 			return err
 		}
 
-		ctx := context.Background()
+		// Stop the iterator once the deadline of caller passed
+		if req.Timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+			req.Opt.InterruptCh = ctx.Done()
+		}
 		if req.SpanContex != nil {
 			trace, span = tracing.NewTraceFromSpan(fmt.Sprintf("remote_node_id: %d", s.Node.ID), *req.SpanContex)
 			ctx = tracing.NewContextWithTrace(ctx, trace)
@@ -452,8 +575,12 @@ func (s *Service) processCreateIteratorRequest(conn io.ReadWriter, buf []byte) (
 	// Stream iterator to connection.
 	encoder := query.NewIteratorEncoder(conn)
 	if err := encoder.EncodeIterator(itr); err != nil {
-		s.Logger.Error("encoding CreateIterator iterator fail", zap.Error(err))
-		atomic.AddInt64(&s.stats.CreateIteratorFail, 1)
+		if ctx.Err() != nil {
+			atomic.AddInt64(&s.stats.CreateIteratorCanceled, 1)
+		} else {
+			s.Logger.Error("encoding CreateIterator iterator fail", zap.Error(err))
+			atomic.AddInt64(&s.stats.CreateIteratorFail, 1)
+		}
 		ioError = true
 		return
 	}
@@ -478,6 +605,11 @@ func (s *Service) processFieldDimensionsRequest(buf []byte) (*FieldDimensionsRes
 	var dimensions map[string]struct{}
 	atomic.AddInt64(&s.stats.FieldDimensionsReq, 1)
 	if err = func() error {
+		if err := s.beginRead(); err != nil {
+			return err
+		}
+		defer s.endRead()
+
 		// Parse request.
 		var req FieldDimensionsRequest
 		if err := req.UnmarshalBinary(buf); err != nil {
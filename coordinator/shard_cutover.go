@@ -0,0 +1,81 @@
+package coordinator
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/angopher/chronus/errs"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// ErrShardCutover is returned when writing to a shard in the cutover of its
+// move, the write is buffered by hinted handoff until the cutover ends.
+var ErrShardCutover = errs.ErrShardCutover
+
+// writeToShardCutover buffers points of a shard in cutover by hinted handoff
+// for its owners and the new owner, instead of writing them to the owners. The
+// buffered points are sent once the cutover ends, the new owner having the
+// shard by then.
+func (w *PointsWriter) writeToShardCutover(shard *meta.ShardInfo, cutover *imeta.ShardCutover, database, retentionPolicy string, consistency models.ConsistencyLevel, points []models.Point) error {
+	atomic.AddInt64(&w.stats.WriteCutover, 1)
+	err := fmt.Errorf("shard %d: %w", shard.ID, ErrShardCutover)
+	if w.HintedHandoffPolicy != nil && !w.HintedHandoffPolicy.HintedHandoffEnabled(database, retentionPolicy) {
+		atomic.AddInt64(&w.stats.WriteHHDisabled, 1)
+		return err
+	}
+
+	owners := shard.Owners
+	if !shard.OwnedBy(cutover.NodeID) {
+		owners = append(owners[:len(owners):len(owners)], meta.ShardOwner{NodeID: cutover.NodeID})
+	}
+	for _, owner := range owners {
+		if hherr := w.HintedHandoff.WriteShard(imeta.ShardID(shard.ID), imeta.NodeID(owner.NodeID), points); hherr != nil {
+			return hherr
+		}
+		atomic.AddInt64(&w.stats.WritePointReqHH, int64(len(points)))
+	}
+	w.dbStats.addHinted(database, points)
+
+	// Like writes to owners failed, buffered points count as written for
+	// consistency ANY only
+	if consistency == models.ConsistencyLevelAny {
+		return nil
+	}
+	return err
+}
+
+// rejectShardCutover rejects the write of a shard in cutover sent by a node
+// not aware of the cutover yet. The sender buffers the points for this node,
+// which buffers them for the new owner before rejecting.
+func (s *Service) rejectShardCutover(shardID uint64, points []models.Point) error {
+	cutover := s.ShardCutovers.ShardCutover(shardID)
+	if cutover == nil {
+		return nil
+	}
+	if cutover.NodeID != s.Node.ID && s.HintedHandoff != nil {
+		if err := s.HintedHandoff.WriteShard(imeta.ShardID(shardID), imeta.NodeID(cutover.NodeID), points); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("shard %d: %w", shardID, ErrShardCutover)
+}
+
+// ownsShard returns whether meta tells this node owns shard shardID, true if
+// unknown yet, e.g. the shard group was just created by the sender.
+func (s *Service) ownsShard(shardID uint64) bool {
+	if s.MetaClient == nil || s.Node == nil {
+		return true
+	}
+	_, _, sgi := s.MetaClient.ShardOwner(shardID)
+	if sgi == nil {
+		return true
+	}
+	for _, sh := range sgi.Shards {
+		if sh.ID == shardID {
+			return sh.OwnedBy(s.Node.ID)
+		}
+	}
+	return true
+}
@@ -1,10 +1,13 @@
 package coordinator
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/angopher/chronus/coordinator/request"
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
 	"go.uber.org/zap"
@@ -56,104 +59,404 @@ const (
 	executeTaskManagerRequestMessage
 	executeTaskManagerResponseMessage
 
+	executeNodeStatementRequestMessage
+	executeNodeStatementResponseMessage
+
 	testRequestMessage // one way message
 )
 
+// ShardTransport carries marshaled shard writes to the owners of shards.
+type ShardTransport interface {
+	// WriteShard sends a marshaled WriteShardRequest to node and returns the
+	// marshaled WriteShardResponse. It gives up as soon as ctx is done, the
+	// error of ctx is returned then.
+	WriteShard(ctx context.Context, nodeID uint64, req []byte) ([]byte, error)
+	Close() error
+	Stats() []StatEntity
+}
+
+// localShardWriter writes shards owned by this node, as done for writes sent
+// by other nodes.
+type localShardWriter interface {
+	WriteShardLocal(shardID uint64, database, retentionPolicy, idempotencyKey string, points []models.Point) error
+}
+
 // ShardWriter writes a set of points to a shard.
 type ShardWriter struct {
-	pool    *ClientPool
-	timeout time.Duration
-	logger  *zap.Logger
+	transport ShardTransport
+	logger    *zap.Logger
+	limiter   *writeLimiter
+	breaker   *circuitBreaker
+
+	negotiator *writeNegotiator
+
+	// backlogs reported by owners, writes to owners beyond maxBacklog points
+	// go to hinted handoff
+	backlogs   *ownerBacklogs
+	maxBacklog int64
+
+	// disk space reported free by owners, writes to owners below minDiskFree
+	// bytes go to hinted handoff
+	disks       *ownerDisks
+	minDiskFree int64
+
+	// writes marshaled beyond maxPayload bytes are split, 0 for unlimited
+	maxPayload int64
+
+	// writes to this node spare the transport if set
+	localID uint64
+	local   localShardWriter
+
+	// node and incarnation writes are sent by, checked by owners
+	sourceID    uint64
+	incarnation uint64
 
 	MetaClient interface {
 		DataNode(id uint64) (ni *meta.NodeInfo, err error)
 		ShardOwner(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo)
 	}
+
+	// Features may turn off the circuit breaker at runtime
+	Features *imeta.FeatureFlags
 }
 
-// NewShardWriter returns a new instance of ShardWriter.
+// NewShardWriter returns a new instance of ShardWriter writing over the
+// cluster TCP protocol with connections of pool.
 func NewShardWriter(timeout time.Duration, pool *ClientPool) *ShardWriter {
-	return &ShardWriter{
+	return NewShardWriterWithTransport(&tcpTransport{
 		pool:    pool,
 		timeout: timeout,
 		logger:  zap.NewNop(),
+	})
+}
+
+// NewShardWriterWithTransport returns a new instance of ShardWriter writing
+// with transport.
+func NewShardWriterWithTransport(transport ShardTransport) *ShardWriter {
+	return &ShardWriter{
+		transport: transport,
+		logger:    zap.NewNop(),
+		limiter:   newWriteLimiter(0, 0, 0),
+		breaker:   newCircuitBreaker(0, 0),
+
+		negotiator: newWriteNegotiator(writeFormat{}),
+		backlogs:   newOwnerBacklogs(),
+		disks:      newOwnerDisks(),
 	}
 }
 
+// SetConcurrencyLimit limits the concurrent outbound writes overall and to each
+// node. Writes waiting longer than wait for a slot fail with ErrTooManyWrites.
+func (w *ShardWriter) SetConcurrencyLimit(total, perNode int, wait time.Duration) {
+	w.limiter = newWriteLimiter(total, perNode, wait)
+}
+
+// SetCircuitBreaker short-circuits writes to a node for cooldown after threshold
+// consecutive failures. A threshold less than 1 disables it.
+func (w *ShardWriter) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	w.breaker = newCircuitBreaker(threshold, cooldown)
+}
+
+// SetMaxOwnerBacklog fails writes to an owner with ErrOwnerBacklogged while
+// the owner reports more than points in flight. Less than 1 means unlimited.
+func (w *ShardWriter) SetMaxOwnerBacklog(points int64) {
+	w.maxBacklog = points
+}
+
+// SetMinOwnerDiskFree fails writes to an owner with ErrOwnerDiskLow while the
+// owner reports less than bytes free on its disk. Less than 1 means no limit.
+func (w *ShardWriter) SetMinOwnerDiskFree(bytes int64) {
+	w.minDiskFree = bytes
+}
+
+// SetMaxPayloadSize splits writes to owners whose marshaled requests run over
+// bytes into several requests of fewer points. Less than 1 means unlimited.
+func (w *ShardWriter) SetMaxPayloadSize(bytes int64) {
+	w.maxPayload = bytes
+}
+
+// Backlog returns the shard writes node nodeID has in flight, as reported
+// last by its responses or read directly for this node.
+func (w *ShardWriter) Backlog(nodeID uint64) (WriteBacklog, bool) {
+	if w.local != nil && nodeID == w.localID {
+		if l, ok := w.local.(interface{ WriteBacklog() WriteBacklog }); ok {
+			return l.WriteBacklog(), true
+		}
+	}
+	return w.backlogs.get(nodeID)
+}
+
+// SetCompression compresses points written to owners accepting compression
+// name, one of WriteCompressionNone, WriteCompressionSnappy and
+// WriteCompressionZstd. Owners not accepting it get points uncompressed.
+func (w *ShardWriter) SetCompression(name string) error {
+	c, err := parseWriteCompression(name)
+	if err != nil {
+		return err
+	}
+	f := w.negotiator.preferred
+	f.compression = c
+	w.negotiator = newWriteNegotiator(f)
+	return nil
+}
+
+// SetEncoding encodes points written to owners accepting encoding name, one
+// of WriteEncodingNone and WriteEncodingSeriesDelta. Owners not accepting it
+// get points one by one.
+func (w *ShardWriter) SetEncoding(name string) error {
+	e, err := parseWriteEncoding(name)
+	if err != nil {
+		return err
+	}
+	f := w.negotiator.preferred
+	f.encoding = e
+	w.negotiator = newWriteNegotiator(f)
+	return nil
+}
+
+// SetLocal writes shards to node nodeID, i.e. this node, through local instead
+// of the transport, sparing the marshaling and the loopback connection, e.g.
+// for points buffered by hinted handoff for this node.
+func (w *ShardWriter) SetLocal(nodeID uint64, local localShardWriter) {
+	w.localID = nodeID
+	w.local = local
+}
+
+// SetIncarnation sends writes as of incarnation of node nodeID, i.e. this
+// node, so that owners reject them once the incarnation is stale.
+func (w *ShardWriter) SetIncarnation(nodeID, incarnation uint64) {
+	w.sourceID = nodeID
+	w.incarnation = incarnation
+}
+
 func (w *ShardWriter) WithLogger(logger *zap.Logger) {
 	w.logger = logger.With(zap.String("service", "ShardWriter"))
+	if t, ok := w.transport.(interface{ WithLogger(*zap.Logger) }); ok {
+		t.WithLogger(w.logger)
+	}
 }
 
 // WriteShard writes time series points to a shard
-func (w *ShardWriter) WriteShard(shardID, ownerID uint64, points []models.Point) error {
-	conn, err := getConnWithRetry(w.pool, ownerID, w.logger)
-	if err != nil {
+func (w *ShardWriter) WriteShard(shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error {
+	return w.WriteShardContext(context.Background(), shardID, ownerID, points)
+}
+
+// WriteShardContext writes time series points to a shard, giving up as soon
+// as ctx is done. The error of ctx is returned then.
+func (w *ShardWriter) WriteShardContext(ctx context.Context, shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	defer conn.Close()
-
+	if w.local != nil && uint64(ownerID) == w.localID {
+		return w.writeShardLocal(ctx, shardID, points)
+	}
 	// Determine the location of this shard and whether it still exists
-	db, rp, sgi := w.MetaClient.ShardOwner(shardID)
+	db, rp, sgi := w.MetaClient.ShardOwner(uint64(shardID))
 	if sgi == nil {
 		// If we can't get the shard group for this shard, then we need to drop this request
 		// as it is no longer valid.  This could happen if writes were queued via
 		// hinted handoff and we're processing the queue after a shard group was deleted.
 		return nil
 	}
+	if w.backlogs.backlogged(uint64(ownerID), w.maxBacklog, DefaultBacklogTTL, time.Now()) {
+		return ErrOwnerBacklogged
+	}
+	if w.disks.low(uint64(ownerID), w.minDiskFree, DefaultBacklogTTL, time.Now()) {
+		return ErrOwnerDiskLow
+	}
+	release, err := w.limiter.acquire(uint64(ownerID))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// The breaker is asked last, a probe it lets through always writes to the
+	// owner and tells the result.
+	breaker := w.Features.Enabled(imeta.FeatureShardWriteBreaker, true)
+	if breaker && !w.breaker.allow(uint64(ownerID), time.Now()) {
+		return ErrCircuitOpen
+	}
+	// Only failures talking to the node count towards the breaker
+	failed := false
+	defer func() {
+		if breaker {
+			w.breaker.done(uint64(ownerID), failed, time.Now())
+		}
+	}()
+
+	failed, err = w.writePoints(ctx, uint64(shardID), uint64(ownerID), db, rp, IdempotencyKey(ctx), points)
+	return err
+}
 
+// writePoints writes points to shard shardID of owner ownerID, split into
+// several writes if the marshaled request runs over maxPayload. Failed tells
+// whether the owner was failed talking to.
+func (w *ShardWriter) writePoints(ctx context.Context, shardID, ownerID uint64, db, rp, key string, points []models.Point) (failed bool, err error) {
 	// Build write writeReq.
 	var writeReq WriteShardRequest
 	writeReq.SetShardID(shardID)
 	writeReq.SetDatabase(db)
 	writeReq.SetRetentionPolicy(rp)
+	if key != "" {
+		writeReq.SetIdempotencyKey(key)
+	}
+	if w.incarnation > 0 {
+		writeReq.SetSource(w.sourceID, w.incarnation)
+	}
 	writeReq.AddPoints(points)
 
-	// Marshal into protocol buffers.
-	buf, err := writeReq.MarshalBinary()
+	// Points are compressed and encoded once the owner told it accepts how
+	format := w.negotiator.format(ownerID)
+	var response WriteShardResponse
+	for {
+		writeReq.setFormat(format)
+
+		// Marshal into protocol buffers.
+		buf, err := writeReq.MarshalBinary()
+		if err != nil {
+			return false, err
+		}
+		if w.maxPayload > 0 && int64(len(buf)) > w.maxPayload && len(points) > 1 {
+			return w.writeSplit(ctx, shardID, ownerID, db, rp, key, points)
+		}
+
+		resp, err := w.transport.WriteShard(ctx, ownerID, buf)
+		if err != nil {
+			// the owner may come back with another version
+			w.negotiator.reset(ownerID)
+			if ctx.Err() != nil {
+				// abandoned by caller, not a failure of node
+				return false, ctx.Err()
+			}
+			return true, err
+		}
+
+		// Unmarshal response.
+		response = WriteShardResponse{}
+		if err := response.UnmarshalBinary(resp); err != nil {
+			return false, err
+		}
+		w.backlogs.update(ownerID, response.Backlog(), time.Now())
+		if free, ok := response.DiskFree(); ok {
+			w.disks.update(ownerID, free, time.Now())
+		}
+		if w.negotiator.update(ownerID, format, response.Compressions(), response.Encodings()) {
+			break
+		}
+		// An owner of an older version ignored the compressed or encoded points
+		format = writeFormat{}
+	}
+
+	if response.Code() != 0 {
+		if ErrorCode(response.Code()) == ErrorCodeStaleIncarnation {
+			w.logger.Error("Write rejected as this node is of a stale incarnation, restart it to register again",
+				zap.Uint64("node", w.sourceID), zap.Uint64("incarnation", w.incarnation), zap.Uint64("owner", ownerID))
+		}
+		return false, &RPCError{Code: ErrorCode(response.Code()), Message: response.Message(), Dropped: response.Dropped()}
+	}
+
+	return false, nil
+}
+
+// writeSplit writes the halves of points one after another. Each half has
+// its own idempotency key derived from key, so that owners don't skip the
+// second as a retry of the first. Points rejected by a half don't stop the
+// other, the rejections are added up.
+func (w *ShardWriter) writeSplit(ctx context.Context, shardID, ownerID uint64, db, rp, key string, points []models.Point) (bool, error) {
+	var rejected *RPCError
+	half := len(points) / 2
+	for i, chunk := range [][]models.Point{points[:half], points[half:]} {
+		var chunkKey string
+		if key != "" {
+			chunkKey = key + "/" + strconv.Itoa(i)
+		}
+		failed, err := w.writePoints(ctx, shardID, ownerID, db, rp, chunkKey, chunk)
+		if err == nil {
+			continue
+		}
+		if dropped, ok := rejectedPoints(err, len(chunk)); ok {
+			if rejected == nil {
+				rejected = &RPCError{Code: ErrorCodeOf(err), Message: rejectReason(err)}
+			}
+			rejected.Dropped += dropped
+			continue
+		}
+		return failed, err
+	}
+	if rejected != nil {
+		return false, rejected
+	}
+	return false, nil
+}
+
+// writeShardLocal writes points to a shard of this node with neither limits
+// nor the breaker, which are meant for other nodes.
+func (w *ShardWriter) writeShardLocal(ctx context.Context, shardID imeta.ShardID, points []models.Point) error {
+	db, rp, sgi := w.MetaClient.ShardOwner(uint64(shardID))
+	if sgi == nil {
+		// dropped like writes to other nodes
+		return nil
+	}
+	return w.local.WriteShardLocal(uint64(shardID), db, rp, IdempotencyKey(ctx), points)
+}
+
+// Close closes ShardWriter's transport
+func (w *ShardWriter) Close() error {
+	return w.transport.Close()
+}
+
+func (w *ShardWriter) Stats() []StatEntity {
+	return w.transport.Stats()
+}
+
+// tcpTransport writes shards over the cluster TCP protocol.
+type tcpTransport struct {
+	pool    *ClientPool
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+func (t *tcpTransport) WithLogger(logger *zap.Logger) {
+	t.logger = logger
+}
+
+func (t *tcpTransport) WriteShard(ctx context.Context, nodeID uint64, req []byte) ([]byte, error) {
+	conn, err := getConnWithRetry(t.pool, nodeID, t.logger)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer conn.Close()
+	stop := interruptOnDone(ctx, conn)
+	defer stop()
 
 	// Write request.
-	conn.SetWriteDeadline(time.Now().Add(w.timeout))
-	if err := WriteTLV(conn, writeShardRequestMessage, buf); err != nil {
+	conn.SetWriteDeadline(time.Now().Add(remainingTimeout(ctx, t.timeout)))
+	if err := WriteTLV(conn, writeShardRequestMessage, req); err != nil {
 		conn.MarkUnusable()
-		return err
+		return nil, err
 	}
 
 	// Read the response.
 	requestReader := &request.ClusterMessageReader{}
-	conn.SetReadDeadline(time.Now().Add(w.timeout))
+	conn.SetReadDeadline(time.Now().Add(remainingTimeout(ctx, t.timeout)))
 	resp, err := requestReader.Read(conn)
 	if err != nil {
 		conn.MarkUnusable()
-		return err
+		return nil, err
 	}
 	conn.SetDeadline(time.Time{})
-
-	// Unmarshal response.
-	var response WriteShardResponse
-	if err := response.UnmarshalBinary(resp.Data); err != nil {
-		return err
-	}
-
-	if response.Code() != 0 {
-		return fmt.Errorf("error code %d: %s", response.Code(), response.Message())
-	}
-
-	return nil
+	return resp.Data, nil
 }
 
-// Close closes ShardWriter's pool
-func (w *ShardWriter) Close() error {
-	if w.pool == nil {
+func (t *tcpTransport) Close() error {
+	if t.pool == nil {
 		return fmt.Errorf("client already closed")
 	}
-	w.pool.close()
-	w.pool = nil
+	t.pool.close()
+	t.pool = nil
 	return nil
 }
 
-func (w *ShardWriter) Stats() []StatEntity {
-	return w.pool.Stat()
+func (t *tcpTransport) Stats() []StatEntity {
+	return t.pool.Stat()
 }
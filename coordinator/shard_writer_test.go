@@ -0,0 +1,226 @@
+package coordinator
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+type localWrites map[uint64]int
+
+func (w localWrites) WriteShardLocal(shardID uint64, database, retentionPolicy, idempotencyKey string, points []models.Point) error {
+	if database != "db0" || retentionPolicy != "rp0" || idempotencyKey != "k0" {
+		return ErrWriteFailed
+	}
+	w[shardID] += len(points)
+	return nil
+}
+
+func TestShardWriter_Local(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	transport := &compressionTransport{}
+	local := localWrites{}
+	w := NewShardWriterWithTransport(transport)
+	w.MetaClient = &grpcMetaClient{}
+	w.SetLocal(1, local)
+
+	ctx := WithIdempotencyKey(context.Background(), "k0")
+	if err := w.WriteShardContext(ctx, 3, 1, []models.Point{pt, pt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteShardContext(ctx, 3, 2, []models.Point{pt}); err != nil {
+		t.Fatal(err)
+	}
+	if local[3] != 2 {
+		t.Fatalf("written %d points locally, exp 2", local[3])
+	}
+	if transport.written != 1 {
+		t.Fatalf("sent %d points, exp 1", transport.written)
+	}
+}
+
+// splitTransport records the points and idempotency keys of writes, rejecting
+// a point of writes with points of measurement bad.
+type splitTransport struct {
+	sizes []int
+	keys  []string
+}
+
+func (t *splitTransport) WriteShard(ctx context.Context, nodeID uint64, buf []byte) ([]byte, error) {
+	var req WriteShardRequest
+	if err := req.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	t.sizes = append(t.sizes, len(req.Points()))
+	t.keys = append(t.keys, req.IdempotencyKey())
+
+	var resp WriteShardResponse
+	resp.SetCode(0)
+	for _, p := range req.Points() {
+		if string(p.Name()) == "bad" {
+			resp.SetCode(int(ErrorCodePermanent))
+			resp.SetMessage("field type conflict")
+			resp.SetDropped(1)
+			break
+		}
+	}
+	return resp.MarshalBinary()
+}
+
+func (t *splitTransport) Close() error        { return nil }
+func (t *splitTransport) Stats() []StatEntity { return nil }
+
+func TestShardWriter_MaxPayloadSize(t *testing.T) {
+	var points []models.Point
+	for i := 0; i < 8; i++ {
+		points = append(points, models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": float64(i)}, time.Unix(int64(i), 0)))
+	}
+	var req WriteShardRequest
+	req.SetShardID(1)
+	req.SetDatabase("db0")
+	req.SetRetentionPolicy("rp0")
+	req.SetIdempotencyKey("k0/0/0")
+	req.AddPoints(points[:2])
+	buf, err := req.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &splitTransport{}
+	w := NewShardWriterWithTransport(transport)
+	w.MetaClient = &grpcMetaClient{}
+	w.SetMaxPayloadSize(int64(len(buf)) + 32)
+
+	ctx := WithIdempotencyKey(context.Background(), "k0")
+	if err := w.WriteShardContext(ctx, 1, 2, points); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []int{2, 2, 2, 2}; !reflect.DeepEqual(transport.sizes, exp) {
+		t.Fatalf("unexpected points of writes: got %v, exp %v", transport.sizes, exp)
+	}
+	if exp := []string{"k0/0/0", "k0/0/1", "k0/1/0", "k0/1/1"}; !reflect.DeepEqual(transport.keys, exp) {
+		t.Fatalf("unexpected keys of writes: got %v, exp %v", transport.keys, exp)
+	}
+
+	// rejections of writes split are added up, the others still written
+	points[1] = models.MustNewPoint("bad", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	points[6] = points[1]
+	transport.sizes = nil
+	err = w.WriteShard(1, 2, points)
+	if dropped, ok := rejectedPoints(err, len(points)); !ok || dropped != 2 {
+		t.Fatalf("unexpected rejection: %v", err)
+	}
+	if len(transport.sizes) != 4 {
+		t.Fatalf("unexpected writes: %v", transport.sizes)
+	}
+}
+
+// serviceTransport hands writes to a Service in process.
+type serviceTransport struct {
+	srv *Service
+}
+
+func (t *serviceTransport) WriteShard(ctx context.Context, nodeID uint64, buf []byte) ([]byte, error) {
+	_, resp, _ := t.srv.handleRequest(writeShardRequestMessage, buf)
+	return resp.MarshalBinary()
+}
+
+func (t *serviceTransport) Close() error        { return nil }
+func (t *serviceTransport) Stats() []StatEntity { return nil }
+
+// incarnations are the current incarnations of nodes.
+type incarnations map[uint64]uint64
+
+func (m incarnations) StaleIncarnation(id, incarnation uint64) bool {
+	return incarnation > 0 && incarnation < m[id]
+}
+
+func TestShardWriter_StaleIncarnation(t *testing.T) {
+	written := 0
+	srv := NewService(Config{})
+	srv.TSDBStore = &writeStore{WriteFn: func(shardID uint64, points []models.Point) error {
+		written += len(points)
+		return nil
+	}}
+	srv.Incarnations = incarnations{1: 3}
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	w := NewShardWriterWithTransport(&serviceTransport{srv: srv})
+	w.MetaClient = &grpcMetaClient{}
+	// nodes before incarnations send none
+	if err := w.WriteShard(1, 2, []models.Point{pt}); err != nil {
+		t.Fatal(err)
+	}
+	w.SetIncarnation(1, 3)
+	if err := w.WriteShard(1, 2, []models.Point{pt}); err != nil {
+		t.Fatal(err)
+	}
+
+	w.SetIncarnation(1, 2)
+	err := w.WriteShard(1, 2, []models.Point{pt})
+	if ErrorCodeOf(err) != ErrorCodeStaleIncarnation || IsRetryable(err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if written != 2 {
+		t.Fatalf("written %d points, exp 2", written)
+	}
+}
+
+// flakyTransport fails writes while down, counting the writes sent.
+type flakyTransport struct {
+	down  bool
+	calls int
+}
+
+func (t *flakyTransport) WriteShard(ctx context.Context, nodeID uint64, buf []byte) ([]byte, error) {
+	t.calls++
+	if t.down {
+		return nil, ErrWriteFailed
+	}
+	var resp WriteShardResponse
+	resp.SetCode(0)
+	return resp.MarshalBinary()
+}
+
+func (t *flakyTransport) Close() error        { return nil }
+func (t *flakyTransport) Stats() []StatEntity { return nil }
+
+func TestShardWriter_BreakerProbe(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	transport := &flakyTransport{down: true}
+	w := NewShardWriterWithTransport(transport)
+	w.MetaClient = &grpcMetaClient{}
+	w.SetCircuitBreaker(1, 10*time.Millisecond)
+	w.SetConcurrencyLimit(0, 1, 5*time.Millisecond)
+
+	// open
+	if err := w.WriteShard(1, 2, []models.Point{pt}); err != ErrWriteFailed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.WriteShard(1, 2, []models.Point{pt}); err != ErrCircuitOpen {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the write that would probe times out waiting for a slot
+	time.Sleep(20 * time.Millisecond)
+	release, err := w.limiter.acquire(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteShard(1, 2, []models.Point{pt}); err != ErrTooManyWrites {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	release()
+
+	// the next one still probes the owner
+	transport.down = false
+	if err := w.WriteShard(1, 2, []models.Point{pt}); err != nil {
+		t.Fatal(err)
+	}
+	if transport.calls != 2 {
+		t.Fatalf("sent %d writes, exp 2", transport.calls)
+	}
+}
@@ -0,0 +1,182 @@
+package coordinator
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/coordinator"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/query"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// Sources of privileges shown by SHOW GRANTS.
+const (
+	grantSourceDatabase    = "database"
+	grantSourceAdmin       = "admin"
+	grantSourceMeasurement = "measurement"
+)
+
+// StatementExecutor renders statements about privileges from cluster meta,
+// which grants more than influxdb knows of, and shards with usage reported by
+// their owners, gathering SHOW STATS and SHOW DIAGNOSTICS across nodes,
+// passing other statements authorized to the influxdb StatementExecutor.
+type StatementExecutor struct {
+	*coordinator.StatementExecutor
+
+	MetaClient interface {
+		Databases() []meta.DatabaseInfo
+		User(name string) (meta.User, error)
+		UserPrivileges(username string) (map[string]influxql.Privilege, error)
+		UserMeasurementPrivileges(username, database string) []imeta.MeasurementPrivilege
+		AuthorizeSources(u meta.User, stmt influxql.Statement, database string) error
+	}
+
+	// ShardUsage tells the space and the last write of shards last reported
+	// by their owners, SHOW SHARDS renders them if set.
+	ShardUsage interface {
+		ShardUsage(shardID, nodeID uint64) (size int64, lastWrite time.Time, ok bool)
+	}
+
+	// NodeStatements gathers SHOW STATS and SHOW DIAGNOSTICS of every data
+	// node, tagged by node, if set.
+	NodeStatements interface {
+		ExecuteNodeStatement(stmt influxql.Statement) (models.Rows, []*query.Message, error)
+	}
+}
+
+// ExecuteStatement executes stmt. Statements of users are authorized on the
+// database of each source first, so that sources of other databases than
+// the one of the query are denied as well, by imeta.QueryDenials of all.
+func (e *StatementExecutor) ExecuteStatement(stmt influxql.Statement, ctx *query.ExecutionContext) error {
+	if u, ok := ctx.Authorizer.(meta.User); ok {
+		if err := e.MetaClient.AuthorizeSources(u, stmt, ctx.Database); err != nil {
+			return err
+		}
+	}
+	if stmt, ok := stmt.(*influxql.ShowGrantsForUserStatement); ok {
+		rows, err := e.executeShowGrantsForUserStatement(stmt)
+		if err != nil {
+			return err
+		}
+		return ctx.Send(&query.Result{Series: rows})
+	}
+	if stmt, ok := stmt.(*influxql.ShowShardsStatement); ok && e.ShardUsage != nil {
+		return ctx.Send(&query.Result{Series: e.executeShowShardsStatement(stmt)})
+	}
+	if e.NodeStatements != nil {
+		switch stmt.(type) {
+		case *influxql.ShowStatsStatement, *influxql.ShowDiagnosticsStatement:
+			rows, messages, err := e.NodeStatements.ExecuteNodeStatement(stmt)
+			if err != nil {
+				return err
+			}
+			return ctx.Send(&query.Result{Series: rows, Messages: messages})
+		}
+	}
+	return e.StatementExecutor.ExecuteStatement(stmt, ctx)
+}
+
+// executeShowGrantsForUserStatement renders the effective privileges of a
+// user on each database along with where they come from: granted on the
+// database, implied by admin, or scoped to measurements matching a pattern,
+// which restrict the user to those measurements of the database.
+func (e *StatementExecutor) executeShowGrantsForUserStatement(q *influxql.ShowGrantsForUserStatement) (models.Rows, error) {
+	u, err := e.MetaClient.User(q.Name)
+	if err != nil {
+		return nil, err
+	}
+	privs, err := e.MetaClient.UserPrivileges(q.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// privileges may be left on databases dropped, exists tells which not
+	exists := make(map[string]bool, len(privs))
+	for db := range privs {
+		exists[db] = false
+	}
+	for _, db := range e.MetaClient.Databases() {
+		exists[db.Name] = true
+	}
+	databases := make([]string, 0, len(exists))
+	for db := range exists {
+		databases = append(databases, db)
+	}
+	sort.Strings(databases)
+
+	row := &models.Row{Columns: []string{"database", "privilege", "measurement", "source"}}
+	for _, db := range databases {
+		if u.AuthorizeUnrestricted() && exists[db] {
+			row.Values = append(row.Values, []interface{}{db, influxql.AllPrivileges.String(), "", grantSourceAdmin})
+		}
+		if p, ok := privs[db]; ok {
+			row.Values = append(row.Values, []interface{}{db, p.String(), "", grantSourceDatabase})
+		}
+		for _, mp := range e.MetaClient.UserMeasurementPrivileges(q.Name, db) {
+			row.Values = append(row.Values, []interface{}{db, mp.Privilege.String(), mp.Pattern, grantSourceMeasurement})
+		}
+	}
+	return []*models.Row{row}, nil
+}
+
+// executeShowShardsStatement renders shards like influxdb, along with the
+// largest size among owners and the size and the last write on each owner in
+// the order of owners, empty if not reported.
+func (e *StatementExecutor) executeShowShardsStatement(stmt *influxql.ShowShardsStatement) models.Rows {
+	rows := []*models.Row{}
+	for _, di := range e.MetaClient.Databases() {
+		row := &models.Row{Columns: []string{"id", "database", "retention_policy", "shard_group", "start_time", "end_time",
+			"expiry_time", "owners", "size", "owner_sizes", "owner_last_writes"}, Name: di.Name}
+		for _, rpi := range di.RetentionPolicies {
+			for _, sgi := range rpi.ShardGroups {
+				// Shards associated with deleted shard groups are effectively deleted.
+				if sgi.Deleted() {
+					continue
+				}
+
+				for _, si := range sgi.Shards {
+					var (
+						size       interface{}
+						owners     = make([]string, len(si.Owners))
+						sizes      = make([]string, len(si.Owners))
+						lastWrites = make([]string, len(si.Owners))
+					)
+					for i, owner := range si.Owners {
+						owners[i] = strconv.FormatUint(owner.NodeID, 10)
+						n, lastWrite, ok := e.ShardUsage.ShardUsage(si.ID, owner.NodeID)
+						if !ok {
+							continue
+						}
+						if largest, _ := size.(int64); size == nil || n > largest {
+							size = n
+						}
+						sizes[i] = strconv.FormatInt(n, 10)
+						lastWrites[i] = lastWrite.UTC().Format(time.RFC3339)
+					}
+
+					row.Values = append(row.Values, []interface{}{
+						si.ID,
+						di.Name,
+						rpi.Name,
+						sgi.ID,
+						sgi.StartTime.UTC().Format(time.RFC3339),
+						sgi.EndTime.UTC().Format(time.RFC3339),
+						sgi.EndTime.Add(rpi.Duration).UTC().Format(time.RFC3339),
+						strings.Join(owners, ","),
+						size,
+						strings.Join(sizes, ","),
+						strings.Join(lastWrites, ","),
+					})
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,164 @@
+package coordinator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/query"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+	"github.com/stretchr/testify/assert"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+type grantsMetaClient struct {
+	databases []meta.DatabaseInfo
+	users     map[string]*meta.UserInfo
+	privs map[string]map[string][]imeta.MeasurementPrivilege
+	// denied are the sources denied by AuthorizeSources
+	denied imeta.QueryDenials
+}
+
+func (c *grantsMetaClient) Databases() []meta.DatabaseInfo {
+	if c.databases != nil {
+		return c.databases
+	}
+	return []meta.DatabaseInfo{{Name: "db1"}, {Name: "db0"}}
+}
+
+func (c *grantsMetaClient) User(name string) (meta.User, error) {
+	if u, ok := c.users[name]; ok {
+		return u, nil
+	}
+	return nil, meta.ErrUserNotFound
+}
+
+func (c *grantsMetaClient) UserPrivileges(username string) (map[string]influxql.Privilege, error) {
+	if u, ok := c.users[username]; ok {
+		return u.Privileges, nil
+	}
+	return nil, meta.ErrUserNotFound
+}
+
+func (c *grantsMetaClient) UserMeasurementPrivileges(username, database string) []imeta.MeasurementPrivilege {
+	return c.privs[username][database]
+}
+
+func (c *grantsMetaClient) AuthorizeSources(u meta.User, stmt influxql.Statement, database string) error {
+	if len(c.denied) > 0 {
+		return c.denied
+	}
+	return nil
+}
+
+func TestStatementExecutor_AuthorizeSources(t *testing.T) {
+	denied := imeta.QueryDenials{
+		{User: "u0", Database: "db1", Measurement: "db1..cpu", Privilege: influxql.ReadPrivilege, Message: "READ on db1 for db1..cpu"},
+		{User: "u0", Database: "db2", Measurement: "db2..mem", Privilege: influxql.ReadPrivilege, Message: "READ on db2 for db2..mem"},
+	}
+	e := &StatementExecutor{MetaClient: &grantsMetaClient{denied: denied}}
+	stmt, err := influxql.ParseStatement(`SELECT * FROM db1..cpu, db2..mem`)
+	assert.Nil(t, err)
+
+	ctx := &query.ExecutionContext{Context: context.Background(), Results: make(chan *query.Result, 1)}
+	ctx.Authorizer = &meta.UserInfo{Name: "u0"}
+	err = e.ExecuteStatement(stmt, ctx)
+	assert.Equal(t, denied, err)
+	assert.Equal(t, "u0 not authorized to execute READ on db1 for db1..cpu; u0 not authorized to execute READ on db2 for db2..mem", err.Error())
+	assert.Len(t, ctx.Results, 0)
+}
+
+func TestStatementExecutor_ShowGrants(t *testing.T) {
+	e := &StatementExecutor{MetaClient: &grantsMetaClient{
+		users: map[string]*meta.UserInfo{
+			"u0": {Name: "u0", Privileges: map[string]influxql.Privilege{
+				"db1":     influxql.ReadPrivilege,
+				"db0":     influxql.AllPrivileges,
+				"dropped": influxql.WritePrivilege,
+			}},
+			"admin": {Name: "admin", Admin: true, Privileges: map[string]influxql.Privilege{
+				"db1": influxql.ReadPrivilege,
+			}},
+		},
+		privs: map[string]map[string][]imeta.MeasurementPrivilege{
+			"u0": {"db0": {{Pattern: "cpu_*", Privilege: influxql.WritePrivilege}}},
+		},
+	}}
+	show := func(name string) ([][]interface{}, error) {
+		ctx := &query.ExecutionContext{Context: context.Background(), Results: make(chan *query.Result, 1)}
+		if err := e.ExecuteStatement(&influxql.ShowGrantsForUserStatement{Name: name}, ctx); err != nil {
+			return nil, err
+		}
+		r := <-ctx.Results
+		assert.Equal(t, []string{"database", "privilege", "measurement", "source"}, r.Series[0].Columns)
+		return r.Series[0].Values, nil
+	}
+
+	values, err := show("u0")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]interface{}{
+		{"db0", "ALL PRIVILEGES", "", "database"},
+		{"db0", "WRITE", "cpu_*", "measurement"},
+		{"db1", "READ", "", "database"},
+		{"dropped", "WRITE", "", "database"},
+	}, values)
+
+	values, err = show("admin")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]interface{}{
+		{"db0", "ALL PRIVILEGES", "", "admin"},
+		{"db1", "ALL PRIVILEGES", "", "admin"},
+		{"db1", "READ", "", "database"},
+	}, values)
+
+	_, err = show("nobody")
+	assert.Equal(t, meta.ErrUserNotFound, err)
+}
+
+type shardUsage map[uint64]map[uint64]int64
+
+func (u shardUsage) ShardUsage(shardID, nodeID uint64) (int64, time.Time, bool) {
+	size, ok := u[shardID][nodeID]
+	return size, time.Unix(int64(nodeID), 0), ok
+}
+
+func TestStatementExecutor_ShowShards(t *testing.T) {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	e := &StatementExecutor{
+		MetaClient: &grantsMetaClient{databases: []meta.DatabaseInfo{{
+			Name: "db0",
+			RetentionPolicies: []meta.RetentionPolicyInfo{{
+				Name:     "rp0",
+				Duration: 24 * time.Hour,
+				ShardGroups: []meta.ShardGroupInfo{{
+					ID:        1,
+					StartTime: start,
+					EndTime:   start.Add(time.Hour),
+					Shards: []meta.ShardInfo{
+						{ID: 1, Owners: []meta.ShardOwner{{NodeID: 1}, {NodeID: 2}}},
+						{ID: 2, Owners: []meta.ShardOwner{{NodeID: 3}}},
+					},
+				}, {
+					ID:        2,
+					DeletedAt: start,
+					Shards:    []meta.ShardInfo{{ID: 3, Owners: []meta.ShardOwner{{NodeID: 1}}}},
+				}},
+			}},
+		}}},
+		ShardUsage: shardUsage{1: {1: 100, 2: 300}},
+	}
+
+	ctx := &query.ExecutionContext{Context: context.Background(), Results: make(chan *query.Result, 1)}
+	assert.Nil(t, e.ExecuteStatement(&influxql.ShowShardsStatement{}, ctx))
+	r := <-ctx.Results
+	assert.Equal(t, []string{"id", "database", "retention_policy", "shard_group", "start_time", "end_time",
+		"expiry_time", "owners", "size", "owner_sizes", "owner_last_writes"}, r.Series[0].Columns)
+	assert.Equal(t, [][]interface{}{
+		{uint64(1), "db0", "rp0", uint64(1), "2020-05-01T00:00:00Z", "2020-05-01T01:00:00Z", "2020-05-02T01:00:00Z",
+			"1,2", int64(300), "100,300", "1970-01-01T00:00:01Z,1970-01-01T00:00:02Z"},
+		{uint64(2), "db0", "rp0", uint64(1), "2020-05-01T00:00:00Z", "2020-05-01T01:00:00Z", "2020-05-02T01:00:00Z",
+			"3", nil, "", ""},
+	}, r.Series[0].Values)
+}
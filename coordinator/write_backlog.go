@@ -0,0 +1,87 @@
+package coordinator
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+)
+
+// ErrOwnerBacklogged is returned when the owner of a shard reported more
+// points in flight than allowed, the points are queued by hinted handoff.
+var ErrOwnerBacklogged = errs.ErrOwnerBacklogged
+
+// DefaultBacklogTTL is how long the backlog an owner reported last is
+// trusted, an owner not written to since is written to again.
+const DefaultBacklogTTL = 10 * time.Second
+
+// WriteBacklog is the local shard writes a data node has in flight, i.e.
+// accepted and not applied by the engine yet. A node falling behind has its
+// backlog growing long before writes to it time out.
+type WriteBacklog struct {
+	Writes int64 `json:"writes"`
+	Points int64 `json:"points"`
+	// UpdatedAt is the time the backlog was reported, zero for the local one
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// writeBacklog counts the local shard writes of a node in flight.
+type writeBacklog struct {
+	writes int64
+	points int64
+}
+
+// begin counts a write of n points in, the returned function counts it out.
+func (b *writeBacklog) begin(n int) func() {
+	atomic.AddInt64(&b.writes, 1)
+	atomic.AddInt64(&b.points, int64(n))
+	return func() {
+		atomic.AddInt64(&b.writes, -1)
+		atomic.AddInt64(&b.points, -int64(n))
+	}
+}
+
+func (b *writeBacklog) load() WriteBacklog {
+	return WriteBacklog{Writes: atomic.LoadInt64(&b.writes), Points: atomic.LoadInt64(&b.points)}
+}
+
+// WriteBacklog returns the local shard writes of this node in flight.
+func (s *Service) WriteBacklog() WriteBacklog {
+	return s.backlog.load()
+}
+
+// ownerBacklogs are the backlogs owners reported in their last responses to
+// writes of this node.
+type ownerBacklogs struct {
+	mu    sync.RWMutex
+	nodes map[uint64]WriteBacklog
+}
+
+func newOwnerBacklogs() *ownerBacklogs {
+	return &ownerBacklogs{nodes: make(map[uint64]WriteBacklog)}
+}
+
+func (o *ownerBacklogs) update(nodeID uint64, b WriteBacklog, now time.Time) {
+	b.UpdatedAt = now
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.nodes[nodeID] = b
+}
+
+func (o *ownerBacklogs) get(nodeID uint64) (WriteBacklog, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	b, ok := o.nodes[nodeID]
+	return b, ok
+}
+
+// backlogged tells whether node reported more than max points in flight
+// within ttl. A max less than 1 means unlimited.
+func (o *ownerBacklogs) backlogged(nodeID uint64, max int64, ttl time.Duration, now time.Time) bool {
+	if max < 1 {
+		return false
+	}
+	b, ok := o.get(nodeID)
+	return ok && b.Points > max && now.Sub(b.UpdatedAt) < ttl
+}
@@ -0,0 +1,81 @@
+package coordinator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// backlogTransport answers writes with backlog, counting the writes sent.
+type backlogTransport struct {
+	backlog WriteBacklog
+	written int
+}
+
+func (t *backlogTransport) WriteShard(ctx context.Context, nodeID uint64, buf []byte) ([]byte, error) {
+	t.written++
+	var resp WriteShardResponse
+	resp.SetCode(0)
+	resp.SetBacklog(t.backlog)
+	return resp.MarshalBinary()
+}
+
+func (t *backlogTransport) Close() error        { return nil }
+func (t *backlogTransport) Stats() []StatEntity { return nil }
+
+func TestShardWriter_OwnerBacklog(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	transport := &backlogTransport{backlog: WriteBacklog{Writes: 2, Points: 100}}
+	w := NewShardWriterWithTransport(transport)
+	w.MetaClient = &grpcMetaClient{}
+	w.SetMaxOwnerBacklog(50)
+
+	_, ok := w.Backlog(2)
+	assert.False(t, ok)
+
+	// the first write learns the backlog, the next is held back
+	assert.Nil(t, w.WriteShard(1, 2, []models.Point{pt}))
+	b, ok := w.Backlog(2)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), b.Writes)
+	assert.Equal(t, int64(100), b.Points)
+	assert.False(t, b.UpdatedAt.IsZero())
+
+	err := w.WriteShard(1, 2, []models.Point{pt})
+	assert.Equal(t, ErrOwnerBacklogged, err)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 1, transport.written)
+
+	// other owners are written to
+	assert.Nil(t, w.WriteShard(1, 3, []models.Point{pt}))
+	assert.Equal(t, 2, transport.written)
+
+	// backlogs not recent are not trusted
+	w.backlogs.update(2, WriteBacklog{Points: 100}, time.Now().Add(-DefaultBacklogTTL))
+	assert.Nil(t, w.WriteShard(1, 2, []models.Point{pt}))
+	assert.Equal(t, 3, transport.written)
+}
+
+func TestService_WriteBacklog(t *testing.T) {
+	s := NewService(Config{})
+	done := s.backlog.begin(3)
+	done2 := s.backlog.begin(5)
+	assert.Equal(t, WriteBacklog{Writes: 2, Points: 8}, s.WriteBacklog())
+	done()
+	assert.Equal(t, WriteBacklog{Writes: 1, Points: 5}, s.WriteBacklog())
+	done2()
+	assert.Equal(t, WriteBacklog{}, s.WriteBacklog())
+
+	var resp WriteShardResponse
+	assert.Equal(t, WriteBacklog{}, resp.Backlog())
+	resp.SetCode(0)
+	resp.SetBacklog(WriteBacklog{Writes: 1, Points: 5})
+	buf, err := resp.MarshalBinary()
+	assert.Nil(t, err)
+	resp = WriteShardResponse{}
+	assert.Nil(t, resp.UnmarshalBinary(buf))
+	assert.Equal(t, WriteBacklog{Writes: 1, Points: 5}, resp.Backlog())
+}
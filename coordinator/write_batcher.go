@@ -0,0 +1,197 @@
+package coordinator
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+const (
+	statBatchWriteReq = "writeReq"
+	statBatchReq      = "batchReq"
+	statBatchSplit    = "batchSplit"
+)
+
+// DefaultWriteBatchMaxPoints is the number of points of a batch of writes to
+// an owner beyond which it's written at once, before its window ends.
+const DefaultWriteBatchMaxPoints = 5000
+
+// WriteBatcher coalesces writes of points to the same shard and owner
+// arriving within a window into one write of its ShardWriter, so clients
+// sending many small batches, like applications writing a point per
+// request, cost owners one request per window instead of one per write.
+//
+// Each write waits for the batch it joined and gets its result. A batch
+// rejected for good, like points beyond the retention policy, is written
+// again write by write so that each one learns the points it had rejected.
+// Writes with idempotency keys are not batched as a batch has one key.
+type WriteBatcher struct {
+	ShardWriter interface {
+		WriteShardContext(ctx context.Context, shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error
+	}
+
+	window    time.Duration
+	maxPoints int
+
+	mu      sync.Mutex
+	pending map[writeBatchKey]*writeBatch
+
+	stats struct {
+		WriteReq   int64
+		BatchReq   int64
+		BatchSplit int64
+	}
+}
+
+type writeBatchKey struct {
+	shardID imeta.ShardID
+	ownerID imeta.NodeID
+}
+
+// writeBatch is the points of writes to an owner coalesced, written once its
+// window ends or it's full. Its context is canceled once all writes waiting
+// for it gave up.
+type writeBatch struct {
+	key    writeBatchKey
+	points []models.Point
+	// sizes are the numbers of points of each write, in order
+	sizes []int
+	// errs are the results of each write, set once done is closed
+	errs    []error
+	done    chan struct{}
+	waiting int
+	timer   *time.Timer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewWriteBatcher returns a WriteBatcher writing batches of window by w, full
+// at maxPoints, the default if not positive.
+func NewWriteBatcher(w interface {
+	WriteShardContext(ctx context.Context, shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error
+}, window time.Duration, maxPoints int) *WriteBatcher {
+	if maxPoints <= 0 {
+		maxPoints = DefaultWriteBatchMaxPoints
+	}
+	return &WriteBatcher{
+		ShardWriter: w,
+		window:      window,
+		maxPoints:   maxPoints,
+		pending:     make(map[writeBatchKey]*writeBatch),
+	}
+}
+
+// WriteShardContext writes points to shard shardID of owner ownerID along
+// with other writes to it within the window, giving up as soon as ctx is
+// done. The error of ctx is returned then, the batch is still written if
+// other writes wait for it.
+func (b *WriteBatcher) WriteShardContext(ctx context.Context, shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error {
+	if b.window <= 0 || len(points) >= b.maxPoints || IdempotencyKey(ctx) != "" {
+		return b.ShardWriter.WriteShardContext(ctx, shardID, ownerID, points)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	atomic.AddInt64(&b.stats.WriteReq, 1)
+
+	key := writeBatchKey{shardID: shardID, ownerID: ownerID}
+	b.mu.Lock()
+	batch := b.pending[key]
+	if batch == nil {
+		batch = &writeBatch{key: key, done: make(chan struct{})}
+		batch.ctx, batch.cancel = context.WithCancel(context.Background())
+		batch.timer = time.AfterFunc(b.window, func() { b.flush(batch) })
+		b.pending[key] = batch
+	}
+	i := len(batch.sizes)
+	batch.points = append(batch.points, points...)
+	batch.sizes = append(batch.sizes, len(points))
+	batch.waiting++
+	full := len(batch.points) >= b.maxPoints
+	if full {
+		delete(b.pending, key)
+		batch.timer.Stop()
+	}
+	b.mu.Unlock()
+	if full {
+		go b.write(batch)
+	}
+
+	select {
+	case <-batch.done:
+		return batch.errs[i]
+	case <-ctx.Done():
+		b.leave(batch)
+		return ctx.Err()
+	}
+}
+
+// flush writes batch once its window ended, unless written already as full
+// or abandoned.
+func (b *WriteBatcher) flush(batch *writeBatch) {
+	b.mu.Lock()
+	if b.pending[batch.key] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, batch.key)
+	b.mu.Unlock()
+	b.write(batch)
+}
+
+// leave counts a write of batch given up, abandoning the batch once none
+// waits for it.
+func (b *WriteBatcher) leave(batch *writeBatch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch.waiting--
+	if batch.waiting > 0 {
+		return
+	}
+	if b.pending[batch.key] == batch {
+		delete(b.pending, batch.key)
+		batch.timer.Stop()
+	}
+	batch.cancel()
+}
+
+func (b *WriteBatcher) write(batch *writeBatch) {
+	defer batch.cancel()
+	atomic.AddInt64(&b.stats.BatchReq, 1)
+
+	batch.errs = make([]error, len(batch.sizes))
+	err := b.ShardWriter.WriteShardContext(batch.ctx, batch.key.shardID, batch.key.ownerID, batch.points)
+	if err != nil && len(batch.sizes) > 1 && !IsRetryable(err) && batch.ctx.Err() == nil {
+		// points rejected are told to the writes they are of
+		atomic.AddInt64(&b.stats.BatchSplit, 1)
+		offset := 0
+		for i, n := range batch.sizes {
+			batch.errs[i] = b.ShardWriter.WriteShardContext(batch.ctx, batch.key.shardID, batch.key.ownerID, batch.points[offset:offset+n])
+			offset += n
+		}
+	} else {
+		for i := range batch.errs {
+			batch.errs[i] = err
+		}
+	}
+	close(batch.done)
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (b *WriteBatcher) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "write_batch",
+		Tags: tags,
+		Values: map[string]interface{}{
+			statBatchWriteReq: atomic.LoadInt64(&b.stats.WriteReq),
+			statBatchReq:      atomic.LoadInt64(&b.stats.BatchReq),
+			statBatchSplit:    atomic.LoadInt64(&b.stats.BatchSplit),
+		},
+	}}
+}
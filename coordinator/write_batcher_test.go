@@ -0,0 +1,130 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/stretchr/testify/assert"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+type batchShardWriter struct {
+	mu     sync.Mutex
+	writes [][]models.Point
+	fn     func(points []models.Point) error
+}
+
+func (w *batchShardWriter) WriteShardContext(ctx context.Context, shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error {
+	w.mu.Lock()
+	w.writes = append(w.writes, points)
+	w.mu.Unlock()
+	if w.fn != nil {
+		return w.fn(points)
+	}
+	return nil
+}
+
+func batchPoints(n int) []models.Point {
+	points := make([]models.Point, n)
+	for i := range points {
+		points[i] = models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": float64(i)}, time.Unix(int64(i), 0))
+	}
+	return points
+}
+
+func writeConcurrently(b *WriteBatcher, ctx context.Context, shards []imeta.ShardID, n int) []error {
+	errs := make([]error, len(shards))
+	var wg sync.WaitGroup
+	for i, shardID := range shards {
+		wg.Add(1)
+		go func(i int, shardID imeta.ShardID) {
+			defer wg.Done()
+			errs[i] = b.WriteShardContext(ctx, shardID, 2, batchPoints(n))
+		}(i, shardID)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestWriteBatcher(t *testing.T) {
+	w := &batchShardWriter{}
+	b := NewWriteBatcher(w, 50*time.Millisecond, 10)
+	ctx := context.Background()
+
+	// writes to the same shard are coalesced
+	errs := writeConcurrently(b, ctx, []imeta.ShardID{1, 1, 1, 2}, 2)
+	assert.Equal(t, []error{nil, nil, nil, nil}, errs)
+	assert.Len(t, w.writes, 2)
+	sizes := []int{len(w.writes[0]), len(w.writes[1])}
+	assert.ElementsMatch(t, []int{6, 2}, sizes)
+
+	// full batches are written before the window ends
+	w.writes = nil
+	start := time.Now()
+	writeConcurrently(b, ctx, []imeta.ShardID{1, 1}, 5)
+	assert.Len(t, w.writes, 1)
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+	// so are large writes and writes with idempotency keys, alone
+	assert.Nil(t, b.WriteShardContext(ctx, 1, 2, batchPoints(10)))
+	assert.Nil(t, b.WriteShardContext(WithIdempotencyKey(ctx, "k"), 1, 2, batchPoints(1)))
+	assert.Len(t, w.writes, 3)
+
+	stats := b.Statistics(nil)[0].Values
+	assert.Equal(t, int64(6), stats[statBatchWriteReq])
+	assert.Equal(t, int64(3), stats[statBatchReq])
+}
+
+func TestWriteBatcher_Errors(t *testing.T) {
+	w := &batchShardWriter{}
+	b := NewWriteBatcher(w, 20*time.Millisecond, 100)
+	ctx := context.Background()
+
+	// failures to write are of all writes
+	w.fn = func(points []models.Point) error { return errors.New("connection refused") }
+	for _, err := range writeConcurrently(b, ctx, []imeta.ShardID{1, 1}, 2) {
+		assert.EqualError(t, err, "connection refused")
+	}
+	assert.Len(t, w.writes, 1)
+
+	// rejections are told write by write
+	w.writes = nil
+	w.fn = func(points []models.Point) error {
+		if len(points) != 2 {
+			return tsdb.PartialWriteError{Reason: "field type conflict", Dropped: 3}
+		}
+		return nil
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- b.WriteShardContext(ctx, 1, 2, batchPoints(3)) }()
+	go func() { errs <- b.WriteShardContext(ctx, 1, 2, batchPoints(2)) }()
+	var failed int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			failed++
+			var partialErr tsdb.PartialWriteError
+			assert.True(t, errors.As(err, &partialErr))
+			assert.Equal(t, 3, partialErr.Dropped)
+		}
+	}
+	assert.Equal(t, 1, failed)
+	// the batch, then each write
+	assert.Len(t, w.writes, 3)
+	assert.Equal(t, int64(1), b.Statistics(nil)[0].Values[statBatchSplit])
+
+	// writes given up return at once, batches none waits for are dropped
+	w.writes = nil
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, b.WriteShardContext(cctx, 1, 2, batchPoints(1)))
+	cctx, cancel = context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, b.WriteShardContext(cctx, 1, 2, batchPoints(1)))
+	time.Sleep(40 * time.Millisecond)
+	assert.Len(t, w.writes, 0)
+}
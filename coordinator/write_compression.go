@@ -0,0 +1,158 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// pointsCompression is how points of a shard write are compressed. Values are
+// sent over the wire and must not be renumbered.
+type pointsCompression int32
+
+const (
+	compressionNone pointsCompression = iota
+	compressionSnappy
+	compressionZstd
+)
+
+// supportedCompressions are told to writers in every response of shard
+// writes, nodes before compression tell none.
+var supportedCompressions = []int32{int32(compressionSnappy), int32(compressionZstd)}
+
+// parseWriteCompression returns the compression named by write-compression.
+func parseWriteCompression(name string) (pointsCompression, error) {
+	switch name {
+	case "", WriteCompressionNone:
+		return compressionNone, nil
+	case WriteCompressionSnappy:
+		return compressionSnappy, nil
+	case WriteCompressionZstd:
+		return compressionZstd, nil
+	}
+	return compressionNone, fmt.Errorf("unknown write-compression %q, expect %q, %q or %q",
+		name, WriteCompressionNone, WriteCompressionSnappy, WriteCompressionZstd)
+}
+
+var errBlockTooLarge = errors.New("decompressed block of points too large")
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxMessageSize))
+}
+
+// compressBlock returns a block of points compressed with c.
+func compressBlock(c pointsCompression, block []byte) ([]byte, error) {
+	switch c {
+	case compressionNone:
+		return block, nil
+	case compressionSnappy:
+		return snappy.Encode(nil, block), nil
+	case compressionZstd:
+		zstdOnce.Do(initZstd)
+		return zstdEncoder.EncodeAll(block, nil), nil
+	}
+	return nil, fmt.Errorf("unknown compression %d", c)
+}
+
+// decompressBlock returns a block of points compressed with c.
+func decompressBlock(c pointsCompression, compressed []byte) ([]byte, error) {
+	switch c {
+	case compressionNone:
+		return compressed, nil
+	case compressionSnappy:
+		if n, err := snappy.DecodedLen(compressed); err != nil {
+			return nil, err
+		} else if n > MaxMessageSize {
+			return nil, errBlockTooLarge
+		}
+		return snappy.Decode(nil, compressed)
+	case compressionZstd:
+		zstdOnce.Do(initZstd)
+		return zstdDecoder.DecodeAll(compressed, nil)
+	}
+	return nil, fmt.Errorf("unknown compression %d", c)
+}
+
+// writeFormat is how points of shard writes to a node are sent.
+type writeFormat struct {
+	compression pointsCompression
+	encoding    pointsEncoding
+}
+
+// writeNegotiator picks the format of writes to each node among compressions
+// and encodings the node told it supports in responses. Writes to a node not
+// answered yet, or failed to, are sent as plain points, so nodes restarted
+// with an older version get points they understand.
+type writeNegotiator struct {
+	preferred writeFormat
+
+	mu    sync.Mutex
+	nodes map[uint64]writeFormat
+}
+
+func newWriteNegotiator(preferred writeFormat) *writeNegotiator {
+	return &writeNegotiator{
+		preferred: preferred,
+		nodes:     make(map[uint64]writeFormat),
+	}
+}
+
+// format returns the format of writes to node.
+func (n *writeNegotiator) format(nodeID uint64) writeFormat {
+	if n.preferred == (writeFormat{}) {
+		return writeFormat{}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.nodes[nodeID]
+}
+
+// update records compressions and encodings node told it supports, returns
+// false if it doesn't support used, which it ignored then.
+func (n *writeNegotiator) update(nodeID uint64, used writeFormat, compressions, encodings []int32) bool {
+	if n.preferred == (writeFormat{}) {
+		return true
+	}
+	var f writeFormat
+	if containsInt32(compressions, int32(n.preferred.compression)) {
+		f.compression = n.preferred.compression
+	}
+	if containsInt32(encodings, int32(n.preferred.encoding)) {
+		f.encoding = n.preferred.encoding
+	}
+	n.mu.Lock()
+	n.nodes[nodeID] = f
+	n.mu.Unlock()
+
+	return (used.compression == compressionNone || containsInt32(compressions, int32(used.compression))) &&
+		(used.encoding == encodingNone || containsInt32(encodings, int32(used.encoding)))
+}
+
+// reset sends writes to node as plain points until it answers again.
+func (n *writeNegotiator) reset(nodeID uint64) {
+	if n.preferred == (writeFormat{}) {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.nodes, nodeID)
+}
+
+func containsInt32(a []int32, v int32) bool {
+	for _, x := range a {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
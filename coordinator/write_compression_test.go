@@ -0,0 +1,131 @@
+package coordinator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/angopher/chronus/coordinator/internal"
+	"github.com/gogo/protobuf/proto"
+	"github.com/influxdata/influxdb/models"
+)
+
+func TestWriteShardRequest_Compression(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.NewTags(map[string]string{"host": "server01"}), models.Fields{"value": 1.0}, time.Unix(1, 0))
+	for _, c := range []pointsCompression{compressionNone, compressionSnappy, compressionZstd} {
+		var req WriteShardRequest
+		req.SetShardID(1)
+		req.AddPoints([]models.Point{pt, pt, pt})
+		req.setFormat(writeFormat{compression: c})
+		buf, err := req.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got WriteShardRequest
+		if err := got.UnmarshalBinary(buf); err != nil {
+			t.Fatalf("compression %d: %v", c, err)
+		}
+		points := got.Points()
+		if len(points) != 3 || points[2].String() != pt.String() {
+			t.Fatalf("compression %d: unexpected points: %v", c, points)
+		}
+	}
+
+	// a corrupt block fails instead of writing garbage
+	var req WriteShardRequest
+	req.SetShardID(1)
+	req.pb.Compression = proto.Int32(int32(compressionSnappy))
+	req.pb.Block = []byte("not snappy")
+	buf, _ := req.MarshalBinary()
+	if err := (&WriteShardRequest{}).UnmarshalBinary(buf); err == nil {
+		t.Fatal("expected error of corrupt block")
+	}
+}
+
+// compressionTransport answers writes as a node of the current version, or
+// of a version before compression if old. It records how requests are
+// compressed and encoded.
+type compressionTransport struct {
+	old         bool
+	compression []int32
+	encoding    []int32
+	written     int
+}
+
+func (t *compressionTransport) WriteShard(ctx context.Context, nodeID uint64, buf []byte) ([]byte, error) {
+	var resp WriteShardResponse
+	resp.SetCode(0)
+	if t.old {
+		var pb internal.WriteShardRequest
+		if err := proto.Unmarshal(buf, &pb); err != nil {
+			return nil, err
+		}
+		t.compression = append(t.compression, pb.GetCompression())
+		t.encoding = append(t.encoding, pb.GetEncoding())
+		t.written += len(pb.GetPoints())
+	} else {
+		var req WriteShardRequest
+		if err := proto.Unmarshal(buf, &req.pb); err != nil {
+			return nil, err
+		}
+		t.compression = append(t.compression, req.pb.GetCompression())
+		t.encoding = append(t.encoding, req.pb.GetEncoding())
+		if err := req.UnmarshalBinary(buf); err != nil {
+			return nil, err
+		}
+		t.written += len(req.Points())
+		resp.SetCompressions(supportedCompressions)
+		resp.SetEncodings(supportedEncodings)
+	}
+	return resp.MarshalBinary()
+}
+
+func (t *compressionTransport) Close() error        { return nil }
+func (t *compressionTransport) Stats() []StatEntity { return nil }
+
+func TestShardWriter_CompressionNegotiation(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	for _, tt := range []struct {
+		old         bool
+		negotiated  bool
+		compression []int32
+	}{
+		// compressed once the owner told it accepts zstd
+		{false, false, []int32{0, 2, 2}},
+		// never compressed to an owner not telling compressions
+		{true, false, []int32{0, 0, 0}},
+		// resent uncompressed to an owner ignoring compressed points
+		{true, true, []int32{2, 0, 0, 0}},
+	} {
+		transport := &compressionTransport{old: tt.old}
+		w := NewShardWriterWithTransport(transport)
+		w.MetaClient = &grpcMetaClient{}
+		if err := w.SetCompression(WriteCompressionZstd); err != nil {
+			t.Fatal(err)
+		}
+		if tt.negotiated {
+			w.negotiator.update(1, writeFormat{}, supportedCompressions, supportedEncodings)
+		}
+		for i := 0; i < 3; i++ {
+			if err := w.WriteShard(1, 1, []models.Point{pt, pt}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if transport.written != 6 {
+			t.Fatalf("old %v: written %d points, exp 6", tt.old, transport.written)
+		}
+		if len(transport.compression) != len(tt.compression) {
+			t.Fatalf("old %v: requests compressed with %v, exp %v", tt.old, transport.compression, tt.compression)
+		}
+		for i := range tt.compression {
+			if transport.compression[i] != tt.compression[i] {
+				t.Fatalf("old %v: requests compressed with %v, exp %v", tt.old, transport.compression, tt.compression)
+			}
+		}
+	}
+
+	if err := NewShardWriterWithTransport(&compressionTransport{}).SetCompression("lz4"); err == nil {
+		t.Fatal("expected error of unknown compression")
+	}
+}
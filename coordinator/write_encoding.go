@@ -0,0 +1,220 @@
+package coordinator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// pointsEncoding is how marshaled points of a shard write are laid out in a
+// block. Values are sent over the wire and must not be renumbered.
+type pointsEncoding int32
+
+const (
+	// encodingNone lays out each point prefixed with its length.
+	encodingNone pointsEncoding = iota
+	// encodingSeriesDelta lays out each series key once, points refer to it
+	// with their fields and time as delta to the previous point of the series.
+	encodingSeriesDelta
+)
+
+// supportedEncodings are told to writers in every response of shard writes.
+var supportedEncodings = []int32{int32(encodingSeriesDelta)}
+
+// parseWriteEncoding returns the encoding named by write-encoding.
+func parseWriteEncoding(name string) (pointsEncoding, error) {
+	switch name {
+	case "", WriteEncodingNone:
+		return encodingNone, nil
+	case WriteEncodingSeriesDelta:
+		return encodingSeriesDelta, nil
+	}
+	return encodingNone, fmt.Errorf("unknown write-encoding %q, expect %q or %q",
+		name, WriteEncodingNone, WriteEncodingSeriesDelta)
+}
+
+var errCorruptBlock = errors.New("corrupt block of points")
+
+// encodePoints returns a block of marshaled points laid out by e.
+func encodePoints(e pointsEncoding, points [][]byte) ([]byte, error) {
+	switch e {
+	case encodingNone:
+		var n int
+		for _, p := range points {
+			n += binary.MaxVarintLen64 + len(p)
+		}
+		block := make([]byte, 0, n)
+		for _, p := range points {
+			block = appendUvarint(block, uint64(len(p)))
+			block = append(block, p...)
+		}
+		return block, nil
+	case encodingSeriesDelta:
+		return encodeSeriesDelta(points)
+	}
+	return nil, fmt.Errorf("unknown encoding %d", e)
+}
+
+// decodePoints returns marshaled points of a block laid out by e.
+func decodePoints(e pointsEncoding, block []byte) ([][]byte, error) {
+	switch e {
+	case encodingNone:
+		var points [][]byte
+		for len(block) > 0 {
+			p, n := readBytes(block)
+			if n <= 0 {
+				return nil, errCorruptBlock
+			}
+			points = append(points, p)
+			block = block[n:]
+		}
+		return points, nil
+	case encodingSeriesDelta:
+		return decodeSeriesDelta(block)
+	}
+	return nil, fmt.Errorf("unknown encoding %d", e)
+}
+
+// encodeSeriesDelta lays out each point as the index of its series key plus
+// one, followed by the key if first seen (index zero), then the time as delta
+// to the previous point of the series and the fields.
+func encodeSeriesDelta(points [][]byte) ([]byte, error) {
+	var (
+		block = make([]byte, 0, len(points)*32)
+		keys  = make(map[string]int)
+		times []int64
+	)
+	for _, p := range points {
+		key, fields, ts, err := splitPoint(p)
+		if err != nil {
+			return nil, err
+		}
+
+		i, ok := keys[string(key)]
+		if ok {
+			block = appendUvarint(block, uint64(i+1))
+		} else {
+			i = len(times)
+			keys[string(key)] = i
+			times = append(times, 0)
+			block = appendUvarint(block, 0)
+			block = appendUvarint(block, uint64(len(key)))
+			block = append(block, key...)
+		}
+		block = appendVarint(block, ts-times[i])
+		times[i] = ts
+		block = appendUvarint(block, uint64(len(fields)))
+		block = append(block, fields...)
+	}
+	return block, nil
+}
+
+func decodeSeriesDelta(block []byte) ([][]byte, error) {
+	var (
+		points [][]byte
+		keys   [][]byte
+		times  []int64
+	)
+	for len(block) > 0 {
+		ref, n := binary.Uvarint(block)
+		if n <= 0 || ref > uint64(len(keys)) {
+			return nil, errCorruptBlock
+		}
+		block = block[n:]
+		i := int(ref) - 1
+		if ref == 0 {
+			key, n := readBytes(block)
+			if n <= 0 {
+				return nil, errCorruptBlock
+			}
+			block = block[n:]
+			i = len(keys)
+			keys = append(keys, key)
+			times = append(times, 0)
+		}
+
+		delta, n := binary.Varint(block)
+		if n <= 0 {
+			return nil, errCorruptBlock
+		}
+		block = block[n:]
+		times[i] += delta
+		fields, n := readBytes(block)
+		if n <= 0 {
+			return nil, errCorruptBlock
+		}
+		block = block[n:]
+
+		p, err := joinPoint(keys[i], fields, times[i])
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// splitPoint returns the key, fields and time of a marshaled point.
+func splitPoint(p []byte) (key, fields []byte, ts int64, err error) {
+	if len(p) < 4 {
+		return nil, nil, 0, errCorruptBlock
+	}
+	n := int(binary.BigEndian.Uint32(p))
+	if p = p[4:]; len(p) < n+4 {
+		return nil, nil, 0, errCorruptBlock
+	}
+	key, p = p[:n], p[n:]
+	n = int(binary.BigEndian.Uint32(p))
+	if p = p[4:]; len(p) < n {
+		return nil, nil, 0, errCorruptBlock
+	}
+	fields, p = p[:n], p[n:]
+
+	var t time.Time
+	if err := t.UnmarshalBinary(p); err != nil {
+		return nil, nil, 0, err
+	}
+	if t.IsZero() {
+		// not representable in nanoseconds
+		return nil, nil, 0, errors.New("point without time")
+	}
+	return key, fields, t.UnixNano(), nil
+}
+
+// joinPoint returns a point marshaled as models.Point.MarshalBinary does.
+func joinPoint(key, fields []byte, ts int64) ([]byte, error) {
+	tb, err := time.Unix(0, ts).UTC().MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	p := make([]byte, 0, 8+len(key)+len(fields)+len(tb))
+	p = append(p, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(p, uint32(len(key)))
+	p = append(p, key...)
+	p = append(p, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(p[len(p)-4:], uint32(len(fields)))
+	p = append(p, fields...)
+	return append(p, tb...), nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+// readBytes returns bytes prefixed with their length at the head of b and the
+// number of bytes read, not positive if b is short.
+func readBytes(b []byte) ([]byte, int) {
+	sz, n := binary.Uvarint(b)
+	if n <= 0 || sz > uint64(len(b)-n) {
+		return nil, 0
+	}
+	end := n + int(sz)
+	return b[n:end:end], end
+}
@@ -0,0 +1,99 @@
+package coordinator
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+func TestWriteShardRequest_SeriesDelta(t *testing.T) {
+	var points []models.Point
+	for i := 0; i < 100; i++ {
+		tags := models.NewTags(map[string]string{"host": fmt.Sprintf("server%02d", i%5), "region": "us-west", "dc": "dc-1"})
+		points = append(points, models.MustNewPoint("cpu", tags, models.Fields{"value": float64(i)}, time.Unix(int64(i/5), int64(i))))
+	}
+
+	var plain WriteShardRequest
+	plain.SetShardID(1)
+	plain.AddPoints(points)
+	plainBuf, err := plain.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []pointsCompression{compressionNone, compressionSnappy} {
+		req := plain
+		req.setFormat(writeFormat{compression: c, encoding: encodingSeriesDelta})
+		buf, err := req.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c == compressionNone && len(buf) > len(plainBuf)/2 {
+			t.Fatalf("encoded to %d bytes, plain %d", len(buf), len(plainBuf))
+		}
+
+		var got WriteShardRequest
+		if err := got.UnmarshalBinary(buf); err != nil {
+			t.Fatalf("compression %d: %v", c, err)
+		}
+		gotPoints := got.Points()
+		if len(gotPoints) != len(points) {
+			t.Fatalf("compression %d: got %d points, exp %d", c, len(gotPoints), len(points))
+		}
+		for i, p := range gotPoints {
+			if p.String() != points[i].String() || p.UnixNano() != points[i].UnixNano() {
+				t.Fatalf("compression %d: point %d is %v, exp %v", c, i, p, points[i])
+			}
+		}
+	}
+}
+
+func TestDecodeSeriesDelta_Corrupt(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	b, _ := pt.MarshalBinary()
+	block, err := encodeSeriesDelta([][]byte{b, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, corrupt := range [][]byte{
+		block[:len(block)-1],
+		append([]byte{5}, block...), // refers to a key never sent
+	} {
+		if _, err := decodeSeriesDelta(corrupt); err == nil {
+			t.Fatalf("expected error decoding %v", corrupt)
+		}
+	}
+}
+
+func TestShardWriter_EncodingNegotiation(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	for _, tt := range []struct {
+		old      bool
+		encoding []int32
+	}{
+		{false, []int32{0, 1, 1}},
+		{true, []int32{0, 0, 0}},
+	} {
+		transport := &compressionTransport{old: tt.old}
+		w := NewShardWriterWithTransport(transport)
+		w.MetaClient = &grpcMetaClient{}
+		if err := w.SetEncoding(WriteEncodingSeriesDelta); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := w.WriteShard(1, 1, []models.Point{pt, pt}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if transport.written != 6 {
+			t.Fatalf("old %v: written %d points, exp 6", tt.old, transport.written)
+		}
+		if !reflect.DeepEqual(transport.encoding, tt.encoding) || !reflect.DeepEqual(transport.compression, []int32{0, 0, 0}) {
+			t.Fatalf("old %v: requests encoded with %v compressed with %v, exp %v",
+				tt.old, transport.encoding, transport.compression, tt.encoding)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package coordinator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+)
+
+// ErrTooManyWrites is returned when the concurrent outbound shard writes exceed
+// the limits and no slot frees in time.
+var ErrTooManyWrites = errs.ErrTooManyWrites
+
+// writeLimiter limits concurrent outbound shard writes overall and for each
+// destination node. A limit less than 1 means unlimited.
+type writeLimiter struct {
+	mu      sync.Mutex
+	total   chan struct{}
+	perNode int
+	nodes   map[uint64]chan struct{}
+	wait    time.Duration
+}
+
+func newWriteLimiter(total, perNode int, wait time.Duration) *writeLimiter {
+	l := &writeLimiter{
+		perNode: perNode,
+		nodes:   make(map[uint64]chan struct{}),
+		wait:    wait,
+	}
+	if total > 0 {
+		l.total = make(chan struct{}, total)
+	}
+	return l
+}
+
+func (l *writeLimiter) nodeSem(nodeID uint64) chan struct{} {
+	if l.perNode < 1 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sem, ok := l.nodes[nodeID]
+	if !ok {
+		sem = make(chan struct{}, l.perNode)
+		l.nodes[nodeID] = sem
+	}
+	return sem
+}
+
+// acquire takes a slot for writing to node, the returned function should be
+// called to release the slot.
+func (l *writeLimiter) acquire(nodeID uint64) (func(), error) {
+	node := l.nodeSem(nodeID)
+	if node == nil && l.total == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	// Per node slot first so that a slow node won't hold overall slots
+	if node != nil {
+		select {
+		case node <- struct{}{}:
+		case <-timer.C:
+			return nil, ErrTooManyWrites
+		}
+	}
+	if l.total != nil {
+		select {
+		case l.total <- struct{}{}:
+		case <-timer.C:
+			if node != nil {
+				<-node
+			}
+			return nil, ErrTooManyWrites
+		}
+	}
+
+	return func() {
+		if l.total != nil {
+			<-l.total
+		}
+		if node != nil {
+			<-node
+		}
+	}, nil
+}
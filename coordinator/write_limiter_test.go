@@ -0,0 +1,51 @@
+package coordinator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteLimiterPerNode(t *testing.T) {
+	l := newWriteLimiter(0, 1, 10*time.Millisecond)
+
+	release, err := l.acquire(1)
+	assert.Nil(t, err)
+
+	// node 1 is busy while node 2 is not affected
+	_, err = l.acquire(1)
+	assert.Equal(t, ErrTooManyWrites, err)
+	release2, err := l.acquire(2)
+	assert.Nil(t, err)
+	release2()
+
+	release()
+	release, err = l.acquire(1)
+	assert.Nil(t, err)
+	release()
+}
+
+func TestWriteLimiterTotal(t *testing.T) {
+	l := newWriteLimiter(2, 0, 10*time.Millisecond)
+
+	r1, err := l.acquire(1)
+	assert.Nil(t, err)
+	r2, err := l.acquire(2)
+	assert.Nil(t, err)
+	_, err = l.acquire(3)
+	assert.Equal(t, ErrTooManyWrites, err)
+
+	r1()
+	r3, err := l.acquire(3)
+	assert.Nil(t, err)
+	r2()
+	r3()
+
+	// unlimited
+	l = newWriteLimiter(0, 0, 0)
+	for i := 0; i < 10; i++ {
+		_, err := l.acquire(1)
+		assert.Nil(t, err)
+	}
+}
@@ -0,0 +1,374 @@
+package coordinator
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The keys for statistics of writes by database.
+const (
+	statDatabaseWriteReq    = "req"
+	statDatabasePointReq    = "pointReq"
+	statDatabaseWriteErr    = "writeError"
+	statDatabaseHHBytes     = "hhBytes"
+	statDatabaseNormalized  = "pointsNormalized"
+	statDatabaseRejected    = "pointsRejected"
+	statDatabaseLatencyP50  = "latencyP50Ns"
+	statDatabaseLatencyP90  = "latencyP90Ns"
+	statDatabaseLatencyP99  = "latencyP99Ns"
+	statDatabaseLatencyMean = "latencyMeanNs"
+)
+
+// numLatencyBuckets is the number of bounded buckets of latency histograms.
+const numLatencyBuckets = 17
+
+// latencyBuckets are upper bounds of write latency histograms, doubling from
+// 1ms to about a minute; slower writes fall in the last, unbounded bucket.
+var latencyBuckets = func() []time.Duration {
+	b := make([]time.Duration, numLatencyBuckets)
+	for i := range b {
+		b[i] = time.Millisecond << uint(i)
+	}
+	return b
+}()
+
+// latencyHistogram counts latencies in latencyBuckets since start.
+type latencyHistogram struct {
+	counts [numLatencyBuckets + 1]int64
+	sum    int64 // nanoseconds
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return d <= latencyBuckets[i] })
+	atomic.AddInt64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// snapshot returns counts of buckets, the total count and sum.
+func (h *latencyHistogram) snapshot() (counts []int64, n, sum int64) {
+	counts = make([]int64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = atomic.LoadInt64(&h.counts[i])
+		n += counts[i]
+	}
+	return counts, n, atomic.LoadInt64(&h.sum)
+}
+
+// percentile returns the upper bound of the bucket the q-th quantile falls
+// in, the last bound if in the unbounded bucket.
+func percentile(counts []int64, n int64, q float64) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	rank := int64(q*float64(n) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var c int64
+	for i, v := range counts {
+		c += v
+		if c >= rank && i < len(latencyBuckets) {
+			return latencyBuckets[i]
+		}
+	}
+	return latencyBuckets[len(latencyBuckets)-1]
+}
+
+// DatabaseWriteStatistics keeps statistics of writes to a database.
+type DatabaseWriteStatistics struct {
+	WriteReq      int64
+	PointWriteReq int64
+	WriteErr      int64
+	// HHBytes is size of points diverted to hinted handoff
+	HHBytes int64
+	// PointsNormalized counts points whose timestamps were truncated to the
+	// write precision, PointsRejected points beyond write time limits
+	PointsNormalized int64
+	PointsRejected   int64
+
+	latency latencyHistogram
+}
+
+// databaseStats keeps write statistics by database, which are also collected
+// by prometheus.
+type databaseStats struct {
+	mu  sync.RWMutex
+	dbs map[string]*DatabaseWriteStatistics
+}
+
+var (
+	promWriteReqDesc = prometheus.NewDesc("chronus_write_requests_total",
+		"Write requests by database.", []string{"database"}, nil)
+	promPointWriteReqDesc = prometheus.NewDesc("chronus_write_points_total",
+		"Points requested to be written by database.", []string{"database"}, nil)
+	promWriteErrDesc = prometheus.NewDesc("chronus_write_errors_total",
+		"Write requests failed by database.", []string{"database"}, nil)
+	promHHBytesDesc = prometheus.NewDesc("chronus_write_hinted_handoff_bytes_total",
+		"Bytes of points diverted to hinted handoff by database.", []string{"database"}, nil)
+	promNormalizedDesc = prometheus.NewDesc("chronus_write_points_normalized_total",
+		"Points whose timestamps were truncated to the write precision by database.", []string{"database"}, nil)
+	promRejectedDesc = prometheus.NewDesc("chronus_write_points_rejected_total",
+		"Points rejected beyond write time limits by database.", []string{"database"}, nil)
+	promLatencyDesc = prometheus.NewDesc("chronus_write_duration_seconds",
+		"Latency of write requests by database.", []string{"database"}, nil)
+)
+
+func newDatabaseStats() *databaseStats {
+	return &databaseStats{dbs: make(map[string]*DatabaseWriteStatistics)}
+}
+
+// get returns statistics of database, creating them if not present.
+func (s *databaseStats) get(database string) *DatabaseWriteStatistics {
+	s.mu.RLock()
+	st := s.dbs[database]
+	s.mu.RUnlock()
+	if st != nil {
+		return st
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st = s.dbs[database]; st == nil {
+		st = &DatabaseWriteStatistics{}
+		s.dbs[database] = st
+	}
+	return st
+}
+
+// record counts a write request of points to database.
+func (s *databaseStats) record(database string, points int, d time.Duration, err error) {
+	st := s.get(database)
+	atomic.AddInt64(&st.WriteReq, 1)
+	atomic.AddInt64(&st.PointWriteReq, int64(points))
+	if err != nil {
+		atomic.AddInt64(&st.WriteErr, 1)
+	}
+	st.latency.observe(d)
+}
+
+// recordTimes counts points of database whose timestamps were normalized
+// or rejected.
+func (s *databaseStats) recordTimes(database string, normalized, rejected int) {
+	if normalized == 0 && rejected == 0 {
+		return
+	}
+	st := s.get(database)
+	atomic.AddInt64(&st.PointsNormalized, int64(normalized))
+	atomic.AddInt64(&st.PointsRejected, int64(rejected))
+}
+
+// addHinted counts points of database diverted to hinted handoff.
+func (s *databaseStats) addHinted(database string, points []models.Point) {
+	var size int
+	for _, p := range points {
+		size += p.StringSize()
+	}
+	atomic.AddInt64(&s.get(database).HHBytes, int64(size))
+}
+
+func (s *databaseStats) each(fn func(database string, st *DatabaseWriteStatistics)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for db, st := range s.dbs {
+		fn(db, st)
+	}
+}
+
+// statistics returns a statistic for each database, latency percentiles are
+// since start.
+func (s *databaseStats) statistics(tags map[string]string) []models.Statistic {
+	var statistics []models.Statistic
+	s.each(func(database string, st *DatabaseWriteStatistics) {
+		counts, n, sum := st.latency.snapshot()
+		var mean int64
+		if n > 0 {
+			mean = sum / n
+		}
+		statistics = append(statistics, models.Statistic{
+			Name: "write_database",
+			Tags: models.NewTags(map[string]string{"database": database}).Merge(tags).Map(),
+			Values: map[string]interface{}{
+				statDatabaseWriteReq:    atomic.LoadInt64(&st.WriteReq),
+				statDatabasePointReq:    atomic.LoadInt64(&st.PointWriteReq),
+				statDatabaseWriteErr:    atomic.LoadInt64(&st.WriteErr),
+				statDatabaseHHBytes:     atomic.LoadInt64(&st.HHBytes),
+				statDatabaseNormalized:  atomic.LoadInt64(&st.PointsNormalized),
+				statDatabaseRejected:    atomic.LoadInt64(&st.PointsRejected),
+				statDatabaseLatencyP50:  int64(percentile(counts, n, 0.5)),
+				statDatabaseLatencyP90:  int64(percentile(counts, n, 0.9)),
+				statDatabaseLatencyP99:  int64(percentile(counts, n, 0.99)),
+				statDatabaseLatencyMean: mean,
+			},
+		})
+	})
+	return statistics
+}
+
+// Describe implements prometheus.Collector.
+func (s *databaseStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- promWriteReqDesc
+	ch <- promPointWriteReqDesc
+	ch <- promWriteErrDesc
+	ch <- promHHBytesDesc
+	ch <- promNormalizedDesc
+	ch <- promRejectedDesc
+	ch <- promLatencyDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *databaseStats) Collect(ch chan<- prometheus.Metric) {
+	s.each(func(database string, st *DatabaseWriteStatistics) {
+		ch <- prometheus.MustNewConstMetric(promWriteReqDesc, prometheus.CounterValue, float64(atomic.LoadInt64(&st.WriteReq)), database)
+		ch <- prometheus.MustNewConstMetric(promPointWriteReqDesc, prometheus.CounterValue, float64(atomic.LoadInt64(&st.PointWriteReq)), database)
+		ch <- prometheus.MustNewConstMetric(promWriteErrDesc, prometheus.CounterValue, float64(atomic.LoadInt64(&st.WriteErr)), database)
+		ch <- prometheus.MustNewConstMetric(promHHBytesDesc, prometheus.CounterValue, float64(atomic.LoadInt64(&st.HHBytes)), database)
+		ch <- prometheus.MustNewConstMetric(promNormalizedDesc, prometheus.CounterValue, float64(atomic.LoadInt64(&st.PointsNormalized)), database)
+		ch <- prometheus.MustNewConstMetric(promRejectedDesc, prometheus.CounterValue, float64(atomic.LoadInt64(&st.PointsRejected)), database)
+
+		counts, n, sum := st.latency.snapshot()
+		buckets := make(map[float64]uint64, len(latencyBuckets))
+		var c int64
+		for i, bound := range latencyBuckets {
+			c += counts[i]
+			buckets[bound.Seconds()] = uint64(c)
+		}
+		ch <- prometheus.MustNewConstHistogram(promLatencyDesc, uint64(n), time.Duration(sum).Seconds(), buckets, database)
+	})
+}
+
+// The keys for statistics of writes by shard and owner.
+const (
+	statShardWriteReq     = "req"
+	statShardWriteErr     = "writeError"
+	statShardLatencyP50   = "latencyP50Ns"
+	statShardLatencyP90   = "latencyP90Ns"
+	statShardLatencyP99   = "latencyP99Ns"
+	statShardLatencyMax   = "latencyMaxNs"
+	statShardLatencyMean  = "latencyMeanNs"
+	statShardLastWriteAge = "lastWriteAgeNs"
+)
+
+// shardStatsIdle is how long statistics of a shard and owner not written to
+// are kept, so that those of shards dropped or moved are forgotten.
+const shardStatsIdle = time.Hour
+
+// shardOwner is an owner of a shard written to.
+type shardOwner struct {
+	shardID uint64
+	nodeID  uint64
+}
+
+// ShardWriteStatistics keeps statistics of writes of a shard to an owner,
+// the local store for the node itself.
+type ShardWriteStatistics struct {
+	Database string
+	WriteReq int64
+	WriteErr int64
+	// MaxLatency is the slowest write in nanoseconds
+	MaxLatency int64
+	// LastWrite is the time of the last write in unix nanoseconds
+	LastWrite int64
+
+	latency latencyHistogram
+}
+
+// shardStats keeps write statistics by shard and owner, to tell shards
+// consistently slow from others.
+type shardStats struct {
+	mu     sync.RWMutex
+	owners map[shardOwner]*ShardWriteStatistics
+}
+
+func newShardStats() *shardStats {
+	return &shardStats{owners: make(map[shardOwner]*ShardWriteStatistics)}
+}
+
+// get returns statistics of shard on node, creating them if not present.
+func (s *shardStats) get(database string, shardID, nodeID uint64) *ShardWriteStatistics {
+	key := shardOwner{shardID: shardID, nodeID: nodeID}
+	s.mu.RLock()
+	st := s.owners[key]
+	s.mu.RUnlock()
+	if st != nil {
+		return st
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st = s.owners[key]; st == nil {
+		st = &ShardWriteStatistics{Database: database}
+		s.owners[key] = st
+	}
+	return st
+}
+
+// record counts a write of shard to node taking d at now.
+func (s *shardStats) record(database string, shardID, nodeID uint64, d time.Duration, err error, now time.Time) {
+	st := s.get(database, shardID, nodeID)
+	atomic.AddInt64(&st.WriteReq, 1)
+	if err != nil {
+		atomic.AddInt64(&st.WriteErr, 1)
+	}
+	st.latency.observe(d)
+	for {
+		max := atomic.LoadInt64(&st.MaxLatency)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&st.MaxLatency, max, int64(d)) {
+			break
+		}
+	}
+	atomic.StoreInt64(&st.LastWrite, now.UnixNano())
+}
+
+// prune forgets shards and owners not written to since shardStatsIdle
+// before now.
+func (s *shardStats) prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, st := range s.owners {
+		if now.Sub(time.Unix(0, atomic.LoadInt64(&st.LastWrite))) > shardStatsIdle {
+			delete(s.owners, key)
+		}
+	}
+}
+
+// statistics returns a statistic for each shard and owner written to
+// recently, latency percentiles are since the first write.
+func (s *shardStats) statistics(tags map[string]string, now time.Time) []models.Statistic {
+	s.prune(now)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	statistics := make([]models.Statistic, 0, len(s.owners))
+	for key, st := range s.owners {
+		counts, n, sum := st.latency.snapshot()
+		var mean int64
+		if n > 0 {
+			mean = sum / n
+		}
+		statistics = append(statistics, models.Statistic{
+			Name: "write_shard",
+			Tags: models.NewTags(map[string]string{
+				"database": st.Database,
+				"shard":    strconv.FormatUint(key.shardID, 10),
+				"node":     strconv.FormatUint(key.nodeID, 10),
+			}).Merge(tags).Map(),
+			Values: map[string]interface{}{
+				statShardWriteReq:     atomic.LoadInt64(&st.WriteReq),
+				statShardWriteErr:     atomic.LoadInt64(&st.WriteErr),
+				statShardLatencyP50:   int64(percentile(counts, n, 0.5)),
+				statShardLatencyP90:   int64(percentile(counts, n, 0.9)),
+				statShardLatencyP99:   int64(percentile(counts, n, 0.99)),
+				statShardLatencyMax:   atomic.LoadInt64(&st.MaxLatency),
+				statShardLatencyMean:  mean,
+				statShardLastWriteAge: int64(now.Sub(time.Unix(0, atomic.LoadInt64(&st.LastWrite)))),
+			},
+		})
+	}
+	return statistics
+}
@@ -0,0 +1,86 @@
+package coordinator
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabaseStats(t *testing.T) {
+	s := newDatabaseStats()
+	for i := 0; i < 98; i++ {
+		s.record("db0", 10, 3*time.Millisecond, nil)
+	}
+	s.record("db0", 10, 30*time.Millisecond, errors.New("timeout"))
+	s.record("db0", 10, 2*time.Minute, errors.New("timeout"))
+	s.record("db1", 1, time.Millisecond, nil)
+	pt := models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Unix(0, 0))
+	s.addHinted("db1", []models.Point{pt, pt})
+	s.recordTimes("db1", 3, 2)
+
+	stats := make(map[string]map[string]interface{})
+	for _, st := range s.statistics(map[string]string{"hostname": "h"}) {
+		assert.Equal(t, "write_database", st.Name)
+		assert.Equal(t, "h", st.Tags["hostname"])
+		stats[st.Tags["database"]] = st.Values
+	}
+	assert.Len(t, stats, 2)
+	assert.Equal(t, int64(100), stats["db0"][statDatabaseWriteReq])
+	assert.Equal(t, int64(1000), stats["db0"][statDatabasePointReq])
+	assert.Equal(t, int64(2), stats["db0"][statDatabaseWriteErr])
+	assert.Equal(t, int64(4*time.Millisecond), stats["db0"][statDatabaseLatencyP50])
+	assert.Equal(t, int64(4*time.Millisecond), stats["db0"][statDatabaseLatencyP90])
+	assert.Equal(t, int64(32*time.Millisecond), stats["db0"][statDatabaseLatencyP99])
+	assert.Equal(t, int64(2*pt.StringSize()), stats["db1"][statDatabaseHHBytes])
+	assert.Equal(t, int64(time.Millisecond), stats["db1"][statDatabaseLatencyP50])
+	assert.Equal(t, int64(3), stats["db1"][statDatabaseNormalized])
+	assert.Equal(t, int64(2), stats["db1"][statDatabaseRejected])
+
+	reg := prometheus.NewRegistry()
+	assert.Nil(t, reg.Register(s))
+	families, err := reg.Gather()
+	assert.Nil(t, err)
+	assert.Len(t, families, 7)
+	for _, f := range families {
+		if f.GetName() == "chronus_write_duration_seconds" {
+			for _, m := range f.GetMetric() {
+				if m.GetLabel()[0].GetValue() == "db0" {
+					assert.Equal(t, uint64(100), m.GetHistogram().GetSampleCount())
+				}
+			}
+		}
+	}
+}
+
+func TestShardStats(t *testing.T) {
+	s := newShardStats()
+	now := time.Now()
+	for i := 0; i < 99; i++ {
+		s.record("db0", 1, 2, 3*time.Millisecond, nil, now)
+	}
+	s.record("db0", 1, 2, 2*time.Second, errors.New("timeout"), now)
+	s.record("db0", 1, 3, time.Millisecond, nil, now)
+	s.record("db1", 5, 2, time.Millisecond, nil, now.Add(-2*shardStatsIdle))
+
+	stats := make(map[string]map[string]interface{})
+	for _, st := range s.statistics(map[string]string{"hostname": "h"}, now.Add(time.Second)) {
+		assert.Equal(t, "write_shard", st.Name)
+		assert.Equal(t, "h", st.Tags["hostname"])
+		assert.Equal(t, "db0", st.Tags["database"])
+		stats[st.Tags["shard"]+"/"+st.Tags["node"]] = st.Values
+	}
+	// shard 5 not written to recently is forgotten
+	assert.Len(t, stats, 2)
+	assert.Equal(t, int64(100), stats["1/2"][statShardWriteReq])
+	assert.Equal(t, int64(1), stats["1/2"][statShardWriteErr])
+	assert.Equal(t, int64(4*time.Millisecond), stats["1/2"][statShardLatencyP50])
+	assert.Equal(t, int64(4*time.Millisecond), stats["1/2"][statShardLatencyP99])
+	assert.Equal(t, int64(2*time.Second), stats["1/2"][statShardLatencyMax])
+	assert.Equal(t, int64(time.Second), stats["1/2"][statShardLastWriteAge])
+	assert.Equal(t, int64(time.Millisecond), stats["1/3"][statShardLatencyP50])
+	assert.Equal(t, int64(0), stats["1/3"][statShardWriteErr])
+}
@@ -0,0 +1,148 @@
+package coordinator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/toml"
+)
+
+// WriteTimeLimit overrides write-precision, max-write-future and
+// max-write-past of a database, or of a retention policy of it if set. Limits
+// not set are the ones of the coordinator.
+type WriteTimeLimit struct {
+	Database        string        `toml:"database"`
+	RetentionPolicy string        `toml:"retention-policy"`
+	Precision       string        `toml:"precision"`
+	MaxFuture       toml.Duration `toml:"max-future"`
+	MaxPast         toml.Duration `toml:"max-past"`
+}
+
+// parsePrecision returns the duration timestamps of a precision are
+// truncated to, 0 if empty or nanoseconds.
+func parsePrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return 0, nil
+	case "u", "us", "µ":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return 0, fmt.Errorf("unknown write precision %q, expect one of ns, us, ms, s, m or h", precision)
+}
+
+// timeLimit is how timestamps of points of a retention policy are normalized
+// and checked, a limit of 0 is none.
+type timeLimit struct {
+	precision time.Duration
+	maxFuture time.Duration
+	maxPast   time.Duration
+}
+
+// within tells whether t is between now-maxPast and now+maxFuture.
+func (l timeLimit) within(t, now time.Time) bool {
+	if l.maxFuture > 0 && t.After(now.Add(l.maxFuture)) {
+		return false
+	}
+	return l.maxPast <= 0 || !t.Before(now.Add(-l.maxPast))
+}
+
+// apply truncates timestamps of points to the precision, in place, and
+// returns the points within the range along with the numbers of points
+// truncated and rejected. points is not modified otherwise.
+func (l timeLimit) apply(points []models.Point, now time.Time) (kept []models.Point, normalized, rejected int) {
+	if l == (timeLimit{}) {
+		return points, 0, 0
+	}
+	kept = points
+	for i, p := range points {
+		t := p.Time()
+		if l.precision > 0 {
+			if tt := t.Truncate(l.precision); !tt.Equal(t) {
+				p.SetTime(tt)
+				t = tt
+				normalized++
+			}
+		}
+		if !l.within(t, now) {
+			if rejected == 0 {
+				kept = append([]models.Point(nil), points[:i]...)
+			}
+			rejected++
+		} else if rejected > 0 {
+			kept = append(kept, p)
+		}
+	}
+	return kept, normalized, rejected
+}
+
+// writeTimeLimits are the time limits of points written by retention policy.
+type writeTimeLimits struct {
+	def timeLimit
+	// dbs are limits of databases, rps of "database.rp"
+	dbs map[string]timeLimit
+	rps map[string]timeLimit
+}
+
+// newWriteTimeLimits returns the limits of c, validated by Config.Validate.
+func newWriteTimeLimits(c Config) (*writeTimeLimits, error) {
+	precision, err := parsePrecision(c.WritePrecision)
+	if err != nil {
+		return nil, err
+	}
+	l := &writeTimeLimits{
+		def: timeLimit{precision: precision, maxFuture: time.Duration(c.MaxWriteFuture), maxPast: time.Duration(c.MaxWritePast)},
+		dbs: make(map[string]timeLimit),
+		rps: make(map[string]timeLimit),
+	}
+	for _, o := range c.WriteTimeLimits {
+		if o.Database == "" {
+			return nil, errors.New("database of write-time-limits must be set")
+		}
+		if o.MaxFuture < 0 || o.MaxPast < 0 {
+			return nil, errors.New("max-future and max-past of write-time-limits must not be negative")
+		}
+		limit := l.def
+		if o.Precision != "" {
+			if limit.precision, err = parsePrecision(o.Precision); err != nil {
+				return nil, err
+			}
+		}
+		if o.MaxFuture > 0 {
+			limit.maxFuture = time.Duration(o.MaxFuture)
+		}
+		if o.MaxPast > 0 {
+			limit.maxPast = time.Duration(o.MaxPast)
+		}
+		if o.RetentionPolicy == "" {
+			l.dbs[o.Database] = limit
+		} else {
+			l.rps[o.Database+"."+o.RetentionPolicy] = limit
+		}
+	}
+	return l, nil
+}
+
+// limit returns the limit of points written to rp of database. A nil
+// writeTimeLimits limits nothing.
+func (l *writeTimeLimits) limit(database, rp string) timeLimit {
+	if l == nil {
+		return timeLimit{}
+	}
+	if limit, ok := l.rps[database+"."+rp]; ok {
+		return limit
+	}
+	if limit, ok := l.dbs[database]; ok {
+		return limit
+	}
+	return l.def
+}
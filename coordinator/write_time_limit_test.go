@@ -0,0 +1,73 @@
+package coordinator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/toml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeLimit_Apply(t *testing.T) {
+	now := time.Unix(1000, 0)
+	newPoints := func() []models.Point {
+		return []models.Point{
+			models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, now.Add(1500*time.Millisecond)),
+			models.MustNewPoint("cpu", nil, models.Fields{"value": 2.0}, now.Add(time.Hour)),
+			models.MustNewPoint("cpu", nil, models.Fields{"value": 3.0}, now),
+			models.MustNewPoint("cpu", nil, models.Fields{"value": 4.0}, now.Add(-2*time.Hour)),
+		}
+	}
+
+	points := newPoints()
+	kept, normalized, rejected := timeLimit{}.apply(points, now)
+	assert.Equal(t, points, kept)
+	assert.Zero(t, normalized)
+	assert.Zero(t, rejected)
+
+	l := timeLimit{precision: time.Second, maxFuture: time.Minute, maxPast: time.Hour}
+	kept, normalized, rejected = l.apply(points, now)
+	assert.Equal(t, 1, normalized)
+	assert.Equal(t, 2, rejected)
+	assert.Len(t, kept, 2)
+	assert.Equal(t, now.Add(time.Second), kept[0].Time())
+	assert.Equal(t, now, kept[1].Time())
+	// points of the caller are kept
+	assert.Len(t, points, 4)
+	assert.Equal(t, now.Add(time.Hour), points[1].Time())
+
+	points = newPoints()
+	kept, normalized, rejected = timeLimit{maxFuture: time.Minute}.apply(points, now)
+	assert.Zero(t, normalized)
+	assert.Equal(t, 1, rejected)
+	assert.Len(t, kept, 3)
+	assert.Equal(t, now.Add(1500*time.Millisecond), kept[0].Time())
+}
+
+func TestNewWriteTimeLimits(t *testing.T) {
+	c := NewConfig()
+	c.WritePrecision = "ms"
+	c.MaxWriteFuture = toml.Duration(time.Minute)
+	c.WriteTimeLimits = []WriteTimeLimit{
+		{Database: "db0", Precision: "s"},
+		{Database: "db0", RetentionPolicy: "rp0", MaxPast: toml.Duration(time.Hour)},
+	}
+	assert.Nil(t, c.Validate())
+	l, err := newWriteTimeLimits(c)
+	assert.Nil(t, err)
+	assert.Equal(t, timeLimit{precision: time.Millisecond, maxFuture: time.Minute}, l.limit("db1", "rp0"))
+	assert.Equal(t, timeLimit{precision: time.Second, maxFuture: time.Minute}, l.limit("db0", "rp1"))
+	assert.Equal(t, timeLimit{precision: time.Millisecond, maxFuture: time.Minute, maxPast: time.Hour}, l.limit("db0", "rp0"))
+
+	var none *writeTimeLimits
+	assert.Equal(t, timeLimit{}, none.limit("db0", "rp0"))
+
+	c.WritePrecision = "d"
+	assert.NotNil(t, c.Validate())
+	c.WritePrecision = ""
+	c.WriteTimeLimits = []WriteTimeLimit{{RetentionPolicy: "rp0"}}
+	assert.NotNil(t, c.Validate())
+	c.WriteTimeLimits = []WriteTimeLimit{{Database: "db0", MaxFuture: toml.Duration(-time.Second)}}
+	assert.NotNil(t, c.Validate())
+}
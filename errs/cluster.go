@@ -0,0 +1,63 @@
+package errs
+
+// Errors of the cluster of data nodes.
+var (
+	// ErrTimeout is returned when a write times out.
+	ErrTimeout = New(KindTimeout, "timeout")
+
+	// ErrPartialWrite is returned when a write partially succeeds but does
+	// not meet the requested consistency level.
+	ErrPartialWrite = New(KindUnavailable, "partial write")
+
+	// ErrWriteFailed is returned when no writes succeeded.
+	ErrWriteFailed = New(KindUnavailable, "write failed")
+
+	// ErrCircuitOpen is returned when writes to a node are short-circuited after
+	// consecutive failures.
+	ErrCircuitOpen = New(KindUnavailable, "circuit open for node")
+
+	// ErrTooManyWrites is returned when the concurrent outbound shard writes exceed
+	// the limits and no slot frees in time.
+	ErrTooManyWrites = New(KindResourceExhausted, "too many concurrent shard writes")
+
+	// ErrOwnerBacklogged is returned when the owner of a shard reported more
+	// points in flight than allowed.
+	ErrOwnerBacklogged = New(KindResourceExhausted, "owner write backlog exceeded")
+
+	// ErrOwnerDiskLow is returned when the owner of a shard has less disk
+	// space free than allowed.
+	ErrOwnerDiskLow = New(KindResourceExhausted, "owner disk free space below threshold")
+
+	// ErrRetry is returned when an operation should be tried again.
+	ErrRetry = New(KindUnavailable, "operation needs another chance")
+
+	// ErrShardNotFound is returned when using a shard that doesn't exist on the node.
+	ErrShardNotFound = New(KindNotFound, "shard not found")
+
+	// ErrShardIDRequired is returned when a request of a shard has no shard id.
+	ErrShardIDRequired = New(KindInvalidArgument, "shard id required")
+
+	// ErrShardReadOnly is returned when writing to a shard marked read-only.
+	ErrShardReadOnly = New(KindConflict, "shard is read-only")
+
+	// ErrShardSealed is returned when writing to a shard whose shard group
+	// was sealed once its write window passed.
+	ErrShardSealed = New(KindConflict, "shard is sealed")
+
+	// ErrStaleIncarnation is returned to a node whose incarnation is replaced
+	// by a newer start of the node or which is deleted, it has to restart to
+	// register again.
+	ErrStaleIncarnation = New(KindConflict, "node incarnation is stale")
+
+	// ErrShardCutover is returned when writing to a shard in the cutover of
+	// its move, the write is buffered by hinted handoff until the cutover ends.
+	ErrShardCutover = New(KindUnavailable, "shard cutover in progress")
+
+	// ErrClusterReadOnly is returned when writing while the cluster is set
+	// read-only by its cluster config, queries still run.
+	ErrClusterReadOnly = New(KindUnavailable, "cluster is read-only, writes are rejected")
+
+	// ErrReadsDrained is returned by a node taken out of the read path when
+	// asked for reads of queries, they are planned on other owners instead.
+	ErrReadsDrained = New(KindUnavailable, "reads are drained from node")
+)
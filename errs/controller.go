@@ -0,0 +1,15 @@
+package errs
+
+// Errors of the controller of data nodes.
+var (
+	// ErrApprovalNotFound is returned confirming with a token never issued,
+	// already used or expired.
+	ErrApprovalNotFound = New(KindNotFound, "token not found or expired, request a new plan")
+
+	// ErrPlanChanged is returned confirming with a token when things to be
+	// removed changed since the plan was issued.
+	ErrPlanChanged = New(KindConflict, "plan changed since the token was issued, request a new plan")
+
+	// ErrNoOtherOwner is returned when copying a shard no other node owns.
+	ErrNoOtherOwner = New(KindNotFound, "no other owner to copy from")
+)
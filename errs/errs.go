@@ -0,0 +1,166 @@
+// Package errs defines the errors of chronus. Every error has a Kind telling
+// how callers should react, e.g. by retrying or by the status of a HTTP
+// response, and may wrap the error causing it, so both errors.Is and
+// errors.As of the standard library see through it.
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kind classifies errors.
+type Kind int
+
+const (
+	// KindUnknown is an error not classified.
+	KindUnknown Kind = iota
+	// KindInvalidArgument means the request is malformed or incomplete.
+	KindInvalidArgument
+	// KindNotFound means something requested doesn't exist.
+	KindNotFound
+	// KindAlreadyExists means something created exists already.
+	KindAlreadyExists
+	// KindConflict means the request conflicts with the current state, e.g.
+	// freezing a node freezed already.
+	KindConflict
+	// KindUnauthorized means the request is not authenticated.
+	KindUnauthorized
+	// KindForbidden means the request is authenticated but not allowed.
+	KindForbidden
+	// KindUnavailable is a transient failure, the request may succeed later.
+	KindUnavailable
+	// KindResourceExhausted means a limit is reached, like a full queue.
+	KindResourceExhausted
+	// KindTimeout means the request didn't complete in time.
+	KindTimeout
+	// KindInternal is a failure of chronus itself.
+	KindInternal
+)
+
+var kindNames = map[Kind]string{
+	KindUnknown:           "unknown",
+	KindInvalidArgument:   "invalid-argument",
+	KindNotFound:          "not-found",
+	KindAlreadyExists:     "already-exists",
+	KindConflict:          "conflict",
+	KindUnauthorized:      "unauthorized",
+	KindForbidden:         "forbidden",
+	KindUnavailable:       "unavailable",
+	KindResourceExhausted: "resource-exhausted",
+	KindTimeout:           "timeout",
+	KindInternal:          "internal",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// ParseKind returns the kind named name by String, KindUnknown if none is.
+func ParseKind(name string) Kind {
+	for k, n := range kindNames {
+		if n == name {
+			return k
+		}
+	}
+	return KindUnknown
+}
+
+// HTTPStatus returns the status of HTTP responses failed by errors of kind.
+func (k Kind) HTTPStatus() int {
+	switch k {
+	case KindInvalidArgument:
+		return http.StatusBadRequest
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindAlreadyExists, KindConflict:
+		return http.StatusConflict
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	case KindResourceExhausted:
+		return http.StatusTooManyRequests
+	case KindTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an error of a kind, wrapping Err if not nil.
+type Error struct {
+	Kind Kind
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Msg
+	case e.Msg == "":
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error wrapped.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error of kind with msg.
+func New(kind Kind, msg string) error {
+	return &Error{Kind: kind, Msg: msg}
+}
+
+// Errorf returns an error of kind formatted as fmt.Errorf, so an error of %w
+// is wrapped.
+func Errorf(kind Kind, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap returns err annotated with msg as an error of kind, nil if err is nil.
+func Wrap(err error, kind Kind, msg string) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Msg: msg, Err: err}
+}
+
+// KindOf returns the kind of the outermost error of err and the errors it
+// wraps classified.
+func KindOf(err error) Kind {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if e, ok := err.(*Error); ok && e.Kind != KindUnknown {
+			return e.Kind
+		}
+		switch err {
+		case context.DeadlineExceeded:
+			return KindTimeout
+		case context.Canceled:
+			return KindUnavailable
+		}
+	}
+	return KindUnknown
+}
+
+// Is returns whether err is an error of kind.
+func Is(err error, kind Kind) bool {
+	return KindOf(err) == kind
+}
+
+// HTTPStatus returns the status of HTTP responses failed by err, 200 if nil.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return KindOf(err).HTTPStatus()
+}
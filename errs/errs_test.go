@@ -0,0 +1,64 @@
+package errs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/angopher/chronus/errs"
+)
+
+func TestKindOf(t *testing.T) {
+	wrapped := fmt.Errorf("write shard 1: %w", errs.ErrQueueFull)
+	for _, tt := range []struct {
+		err    error
+		kind   errs.Kind
+		status int
+	}{
+		{nil, errs.KindUnknown, http.StatusOK},
+		{errors.New("connection refused"), errs.KindUnknown, http.StatusInternalServerError},
+		{errs.ErrNodeNotFound, errs.KindNotFound, http.StatusNotFound},
+		{wrapped, errs.KindResourceExhausted, http.StatusTooManyRequests},
+		{errs.Errorf(errs.KindInvalidArgument, "bad shard: %w", errs.ErrShardNotFound), errs.KindInvalidArgument, http.StatusBadRequest},
+		{errs.Wrap(errors.New("eof"), errs.KindUnavailable, "read"), errs.KindUnavailable, http.StatusServiceUnavailable},
+		{fmt.Errorf("request: %w", context.DeadlineExceeded), errs.KindTimeout, http.StatusGatewayTimeout},
+	} {
+		if kind := errs.KindOf(tt.err); kind != tt.kind {
+			t.Errorf("KindOf(%v) = %v, exp %v", tt.err, kind, tt.kind)
+		}
+		if status := errs.HTTPStatus(tt.err); status != tt.status {
+			t.Errorf("HTTPStatus(%v) = %d, exp %d", tt.err, status, tt.status)
+		}
+		if kind := errs.ParseKind(tt.kind.String()); kind != tt.kind {
+			t.Errorf("ParseKind(%q) = %v, exp %v", tt.kind.String(), kind, tt.kind)
+		}
+	}
+	if kind := errs.ParseKind("loud"); kind != errs.KindUnknown {
+		t.Errorf("ParseKind(loud) = %v", kind)
+	}
+}
+
+func TestError_Wrap(t *testing.T) {
+	cause := errors.New("disk full")
+	err := fmt.Errorf("append: %w", errs.Wrap(cause, errs.KindResourceExhausted, "queue"))
+	if !errors.Is(err, cause) {
+		t.Fatalf("cause not found in %v", err)
+	}
+	var e *errs.Error
+	if !errors.As(err, &e) || e.Kind != errs.KindResourceExhausted {
+		t.Fatalf("error of kind not found in %v", err)
+	}
+	if got, exp := err.Error(), "append: queue: disk full"; got != exp {
+		t.Fatalf("unexpected message: %q, exp %q", got, exp)
+	}
+	if errs.Wrap(nil, errs.KindInternal, "nothing") != nil {
+		t.Fatal("expected nil wrapping nil")
+	}
+
+	err = errs.Errorf(errs.KindNotFound, "shard %d: %w", 1, errs.ErrShardNotFound)
+	if !errors.Is(err, errs.ErrShardNotFound) || errors.Is(err, errs.ErrNodeNotFound) {
+		t.Fatalf("unexpected errors wrapped by %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package errs
+
+// Errors of hinted handoff.
+var (
+	// ErrHintedHandoffDisabled is returned when attempting to use a
+	// disabled hinted handoff service.
+	ErrHintedHandoffDisabled = New(KindUnavailable, "hinted handoff disabled")
+
+	// ErrQueueNotOpen is returned when using a hinted handoff queue not open.
+	ErrQueueNotOpen = New(KindUnavailable, "queue not open")
+
+	// ErrQueueOpen is returned when setting up a hinted handoff queue open already.
+	ErrQueueOpen = New(KindConflict, "queue is open")
+
+	// ErrQueueFull is returned when appending to a hinted handoff queue at its max size.
+	ErrQueueFull = New(KindResourceExhausted, "queue is full")
+
+	// ErrSegmentFull is returned when appending to a segment of a queue at its max size.
+	ErrSegmentFull = New(KindResourceExhausted, "segment is full")
+
+	// ErrQueueEncrypted is returned when reading a block of a hinted handoff
+	// queue encrypted by a key not configured.
+	ErrQueueEncrypted = New(KindUnavailable, "queue block is encrypted by another key")
+
+	// ErrNodeUnhealthy is returned writing to a node whose queue is stuck failing
+	// to advance, if writes are blocked for it.
+	ErrNodeUnhealthy = New(KindUnavailable, "hinted handoff queue of node is unhealthy")
+
+	// ErrNodeProcessorOpen is returned when removing the queue of a node processor
+	// still open.
+	ErrNodeProcessorOpen = New(KindConflict, "node processor is open")
+
+	// ErrNodeProcessorClosed is returned when using a node processor closed.
+	ErrNodeProcessorClosed = New(KindUnavailable, "node processor is closed")
+
+	// ErrQueueInUse is returned when replaying the directory of a hinted
+	// handoff queue in use by the service.
+	ErrQueueInUse = New(KindConflict, "queue directory is in use")
+
+	// ErrNoQueueData is returned when replaying a directory without a queue.
+	ErrNoQueueData = New(KindNotFound, "no queue data in directory")
+)
@@ -0,0 +1,122 @@
+package errs
+
+var (
+	// ErrNodeExists is returned when creating an already existing node.
+	ErrNodeExists = New(KindAlreadyExists, "node already exists")
+
+	// ErrNodeNotFound is returned when mutating a node that doesn't exist.
+	ErrNodeNotFound = New(KindNotFound, "node not found")
+
+	// ErrNodeAlreadyFreezed represents node has been already freezed
+	ErrNodeAlreadyFreezed = New(KindConflict, "node has been freezed before")
+
+	// ErrNodeNotFreezed represents node is not freezed (is normal)
+	ErrNodeNotFreezed = New(KindConflict, "node hasn't been freezed")
+
+	// ErrNodesRequired is returned when at least one node is required for an operation.
+	// This occurs when creating a shard group.
+	ErrNodesRequired = New(KindUnavailable, "at least one node required")
+
+	// ErrNodeIDRequired is returned when using a zero node id.
+	ErrNodeIDRequired = New(KindInvalidArgument, "node id must be greater than 0")
+
+	// ErrNodeUnableToDropFinalNode is returned if the node being dropped is the last
+	// node in the cluster
+	ErrNodeUnableToDropFinalNode = New(KindConflict, "unable to drop the final node in a cluster")
+)
+
+var (
+	// ErrDatabaseTemplateNameRequired is returned when creating a database template without name.
+	ErrDatabaseTemplateNameRequired = New(KindInvalidArgument, "database template name required")
+
+	// ErrDatabaseTemplateExists is returned when creating an already existing database template.
+	ErrDatabaseTemplateExists = New(KindAlreadyExists, "database template already exists")
+
+	// ErrDatabaseTemplateNotFound is returned when using a database template that doesn't exist.
+	ErrDatabaseTemplateNotFound = New(KindNotFound, "database template not found")
+
+	// ErrMeasurementPatternInvalid is returned when granting with a malformed measurement pattern.
+	ErrMeasurementPatternInvalid = New(KindInvalidArgument, "invalid measurement pattern")
+
+	// ErrUserLocked is returned when authenticating a user locked because of failed attempts.
+	ErrUserLocked = New(KindForbidden, "user is locked because of too many failed authentications")
+
+	// ErrAPITokenRequired is returned when creating an api token without token.
+	ErrAPITokenRequired = New(KindInvalidArgument, "api token required")
+
+	// ErrAPITokenExists is returned when creating an already existing api token.
+	ErrAPITokenExists = New(KindAlreadyExists, "api token already exists")
+
+	// ErrAPITokenNotFound is returned when dropping an api token that doesn't exist.
+	ErrAPITokenNotFound = New(KindNotFound, "api token not found")
+
+	// ErrInvalidAPIToken is returned when authenticating with an unknown api token.
+	ErrInvalidAPIToken = New(KindUnauthorized, "invalid api token")
+
+	// ErrMaxDatabasesReached is returned when creating a database beyond max-databases of cluster config.
+	ErrMaxDatabasesReached = New(KindResourceExhausted, "max databases reached")
+
+	// ErrMaxRetentionPoliciesReached is returned when creating a retention policy beyond max-retention-policies of cluster config.
+	ErrMaxRetentionPoliciesReached = New(KindResourceExhausted, "max retention policies of database reached")
+
+	// ErrMaxUsersReached is returned when creating a user beyond max-users of cluster config.
+	ErrMaxUsersReached = New(KindResourceExhausted, "max users reached")
+
+	// ErrShardGroupsFrozen is returned when creating shard groups while a snapshot holds their creation.
+	ErrShardGroupsFrozen = New(KindUnavailable, "creation of shard groups frozen by snapshot")
+
+	// ErrInvalidUserImport is returned when importing a malformed document of users.
+	ErrInvalidUserImport = New(KindInvalidArgument, "invalid user import")
+
+	// ErrSessionRequired is returned when creating a session without token.
+	ErrSessionRequired = New(KindInvalidArgument, "session token required")
+
+	// ErrSessionNotFound is returned when dropping a session that doesn't exist.
+	ErrSessionNotFound = New(KindNotFound, "session not found")
+
+	// ErrInvalidSession is returned when authenticating with an unknown or expired session.
+	ErrInvalidSession = New(KindUnauthorized, "invalid or expired session")
+
+	// ErrBucketRequired is returned when mapping a bucket without name.
+	ErrBucketRequired = New(KindInvalidArgument, "bucket name required")
+
+	// ErrBucketMappingNotFound is returned when dropping a bucket mapping that doesn't exist.
+	ErrBucketMappingNotFound = New(KindNotFound, "bucket mapping not found")
+
+	// ErrArchiveDisabled is returned when reading archived shard groups of a node not archiving.
+	ErrArchiveDisabled = New(KindConflict, "shard group archive is disabled")
+
+	// ErrClusterConfigUnknown is returned when setting a key of cluster config not registered.
+	ErrClusterConfigUnknown = New(KindInvalidArgument, "unknown cluster config key")
+
+	// ErrClusterConfigNotFound is returned when deleting a key of cluster config not set.
+	ErrClusterConfigNotFound = New(KindNotFound, "cluster config key not set")
+
+	// ErrHintedHandoffPolicyNotFound is returned when deleting a hinted handoff policy not set.
+	ErrHintedHandoffPolicyNotFound = New(KindNotFound, "hinted handoff policy not found")
+
+	// ErrShardGroupRangeTooLarge is returned when creating shard groups for a range
+	// needing more than the maximum of groups created at once.
+	ErrShardGroupRangeTooLarge = New(KindInvalidArgument, "too many shard groups for range")
+
+	// ErrInvalidShardGroupAlignment is returned when aligning shard groups to
+	// an unknown unit.
+	ErrInvalidShardGroupAlignment = New(KindInvalidArgument, "shard group alignment should be day or week")
+
+	// ErrDataIndexNotRetained is returned when reading meta data at an index
+	// older than the versions kept, or newer than the latest.
+	ErrDataIndexNotRetained = New(KindNotFound, "meta data index not retained")
+
+	// ErrInvalidMaintenanceWindow is returned when scheduling a maintenance
+	// window without nodes, with no duration or of an unknown behavior.
+	ErrInvalidMaintenanceWindow = New(KindInvalidArgument, "maintenance window needs nodes, a duration and a behavior of freeze, drain or exclude-reads")
+
+	// ErrMaintenanceWindowNotFound is returned when deleting a maintenance window that doesn't exist.
+	ErrMaintenanceWindowNotFound = New(KindNotFound, "maintenance window not found")
+
+	// ErrShardNotSealed is returned when recording the checksum of a shard not sealed.
+	ErrShardNotSealed = New(KindNotFound, "shard is not sealed")
+
+	// ErrOperatorRoleInvalid is returned when assigning an unknown operator role.
+	ErrOperatorRoleInvalid = New(KindInvalidArgument, "operator role should be viewer, operator, admin or none")
+)
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"go.uber.org/zap"
+)
+
+// Keys of fields logged by all services, so logs of a node, shard or
+// database can be found the same way everywhere.
+const (
+	NodeIDKey          = "node_id"
+	ShardIDKey         = "shard_id"
+	DatabaseKey        = "db"
+	RetentionPolicyKey = "rp"
+	TraceIDKey         = "trace_id"
+	IdempotencyKeyKey  = "idempotency_key"
+)
+
+func NodeID(id uint64) zap.Field {
+	return zap.Uint64(NodeIDKey, id)
+}
+
+func ShardID(id uint64) zap.Field {
+	return zap.Uint64(ShardIDKey, id)
+}
+
+func Database(name string) zap.Field {
+	return zap.String(DatabaseKey, name)
+}
+
+func RetentionPolicy(name string) zap.Field {
+	return zap.String(RetentionPolicyKey, name)
+}
+
+// TraceID correlates logs of a request across nodes, skipped if empty.
+func TraceID(id string) zap.Field {
+	if id == "" {
+		return zap.Skip()
+	}
+	return zap.String(TraceIDKey, id)
+}
+
+// IdempotencyKey is the key of a write skipped if retried, skipped if empty.
+func IdempotencyKey(key string) zap.Field {
+	if key == "" {
+		return zap.Skip()
+	}
+	return zap.String(IdempotencyKeyKey, key)
+}
@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// serviceKey is the key of the field naming the service of a logger.
+const serviceKey = "service"
+
+// Levels holds the log level of the process and levels of services
+// overriding it, which can be changed at runtime. Services are named by the
+// "service" field of their loggers.
+type Levels struct {
+	level zap.AtomicLevel
+
+	mu       sync.Mutex
+	services map[string]*serviceLevel
+}
+
+type serviceLevel struct {
+	set   int32 // 1 if it overrides the level of the process
+	level zap.AtomicLevel
+}
+
+func NewLevels(level zapcore.Level) *Levels {
+	return &Levels{
+		level:    zap.NewAtomicLevelAt(level),
+		services: make(map[string]*serviceLevel),
+	}
+}
+
+var defaultLevels = NewLevels(zap.InfoLevel)
+
+// DefaultLevels returns the levels of loggers created by InitialLogging.
+func DefaultLevels() *Levels {
+	return defaultLevels
+}
+
+// Level returns the level of the process.
+func (l *Levels) Level() zapcore.Level {
+	return l.level.Level()
+}
+
+// SetLevel sets the level of the process, services not overridden follow it.
+func (l *Levels) SetLevel(level zapcore.Level) {
+	l.level.SetLevel(level)
+}
+
+// SetServiceLevel overrides the level of the process for service.
+func (l *Levels) SetServiceLevel(service string, level zapcore.Level) {
+	sl := l.service(service)
+	sl.level.SetLevel(level)
+	atomic.StoreInt32(&sl.set, 1)
+}
+
+// ResetServiceLevel makes service follow the level of the process again.
+func (l *Levels) ResetServiceLevel(service string) {
+	atomic.StoreInt32(&l.service(service).set, 0)
+}
+
+// ServiceLevels returns the levels of services overridden.
+func (l *Levels) ServiceLevels() map[string]zapcore.Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	levels := make(map[string]zapcore.Level)
+	for name, sl := range l.services {
+		if atomic.LoadInt32(&sl.set) == 1 {
+			levels[name] = sl.level.Level()
+		}
+	}
+	return levels
+}
+
+// Services returns the names of services logged so far.
+func (l *Levels) Services() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, 0, len(l.services))
+	for name := range l.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *Levels) service(name string) *serviceLevel {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sl, ok := l.services[name]
+	if !ok {
+		sl = &serviceLevel{level: zap.NewAtomicLevel()}
+		l.services[name] = sl
+	}
+	return sl
+}
+
+func (l *Levels) enabled(sl *serviceLevel, level zapcore.Level) bool {
+	if sl != nil && atomic.LoadInt32(&sl.set) == 1 {
+		return sl.level.Enabled(level)
+	}
+	return l.level.Enabled(level)
+}
+
+// NewCore returns core filtering entries by the level of the service of
+// each logger, core itself should enable all levels.
+func (l *Levels) NewCore(core zapcore.Core) zapcore.Core {
+	return &levelCore{Core: core, levels: l}
+}
+
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+	level  *serviceLevel // of the last service named, nil if none
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.levels.enabled(c.level, level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	level := c.level
+	for _, f := range fields {
+		if f.Key == serviceKey && f.Type == zapcore.StringType {
+			level = c.levels.service(f.String)
+		}
+	}
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels, level: level}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// ParseLevel parses levels of the config.
+func ParseLevel(s string) (zapcore.Level, error) {
+	var level zapcore.Level
+	s = strings.ToLower(s)
+	if s == "warning" {
+		s = "warn"
+	}
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+type levelsResponse struct {
+	Level    string            `json:"level"`
+	Services map[string]string `json:"services"` // overridden
+	Known    []string          `json:"known"`
+}
+
+// ServeHTTP shows levels on GET. POST with `level` sets the level of
+// `service` if given or of the process, `service` without `level` resets it.
+func (l *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		service, s := r.FormValue("service"), r.FormValue("level")
+		if service != "" && s == "" {
+			l.ResetServiceLevel(service)
+			break
+		}
+		level, err := ParseLevel(s)
+		if err != nil || s == "" {
+			http.Error(w, fmt.Sprintf("invalid level: %q", s), http.StatusBadRequest)
+			return
+		}
+		if service != "" {
+			l.SetServiceLevel(service, level)
+		} else {
+			l.SetLevel(level)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := levelsResponse{
+		Level:    l.Level().String(),
+		Services: make(map[string]string),
+		Known:    l.Services(),
+	}
+	for name, level := range l.ServiceLevels() {
+		resp.Services[name] = level.String()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&resp)
+}
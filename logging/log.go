@@ -84,9 +84,12 @@ func InitialLogging(c *Config) (*zap.Logger, error) {
 	case "panic":
 		lvl = zap.PanicLevel
 	}
-	return zap.New(zapcore.NewCore(
+	// levels of services may be lower than the level of the process
+	defaultLevels.SetLevel(lvl)
+	core := zapcore.NewCore(
 		encoder,
 		zapcore.Lock(zapcore.AddSync(createWriter(c))),
-		lvl,
-	), zap.Fields(zap.String("log_id", nextID()))), nil
+		zap.LevelEnablerFunc(func(zapcore.Level) bool { return true }),
+	)
+	return zap.New(defaultLevels.NewCore(core), zap.Fields(zap.String("log_id", nextID()))), nil
 }
@@ -66,6 +66,16 @@ func (s *RaftNode) applyCommitted(proposal *internal.Proposal, index uint64) err
 			}
 		}
 		return err
+	case internal.CreateShardGroupsForRange:
+		var req CreateShardGroupsForRangeReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		groups, err := s.MetaStore.CreateShardGroupsForRange(req.Database, req.Policy, req.Start, req.End)
+		if err == nil && pctx.retData != nil {
+			*pctx.retData.(*[]meta.ShardGroupInfo) = groups
+		}
+		return err
 	case internal.CreateDataNode:
 		var req CreateDataNodeReq
 		err := json.Unmarshal(proposal.Data, &req)
@@ -194,6 +204,20 @@ func (s *RaftNode) applyCommitted(proposal *internal.Proposal, index uint64) err
 		s.SugaredLogger.Debugf("req %+v", req)
 		return s.MetaStore.SetPrivilege(req.UserName, req.Database, req.Privilege)
 
+	case internal.SetMeasurementPrivilege:
+		var req SetMeasurementPrivilegeReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetMeasurementPrivilege(req.UserName, req.Database, req.Pattern, req.Privilege)
+
+	case internal.SetOperatorRole:
+		var req SetOperatorRoleReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetOperatorRole(req.UserName, req.Role)
+
 	case internal.SetAdminPrivilege:
 		var req SetAdminPrivilegeReq
 		err := json.Unmarshal(proposal.Data, &req)
@@ -213,19 +237,242 @@ func (s *RaftNode) applyCommitted(proposal *internal.Proposal, index uint64) err
 		}
 		return err
 
+	case internal.LockUser:
+		var req LockUserReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.LockUser(req.UserName, req.Until, req.Time)
+
+	case internal.UnlockUser:
+		var req UnlockUserReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.UnlockUser(req.UserName)
+
+	case internal.CreateAPIToken:
+		var req CreateAPITokenReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		t, err := s.MetaStore.CreateAPIToken(req.UserName, req.Hash, req.Description, req.CreatedAt)
+		if err == nil && pctx != nil && pctx.retData != nil {
+			*pctx.retData.(*imeta.APIToken) = *t
+		}
+		return err
+
+	case internal.DropAPIToken:
+		var req DropAPITokenReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.DropAPIToken(req.ID)
+
+	case internal.CreateSession:
+		var req CreateSessionReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.CreateSession(req.UserName, req.Hash, req.CreatedAt, req.Expiration)
+
+	case internal.DropSession:
+		var req DropSessionReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.DropSession(req.Hash)
+
+	case internal.PruneSessions:
+		var req PruneSessionsReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.PruneSessions(req.Time)
+
+	case internal.SetBucketMapping:
+		var req SetBucketMappingReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetBucketMapping(&req.Mapping)
+
+	case internal.DropBucketMapping:
+		var req DropBucketMappingReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.DropBucketMapping(req.Org, req.Bucket)
+
+	case internal.SetClusterConfig:
+		var req SetClusterConfigReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetClusterConfig(req.Key, req.Value)
+
+	case internal.DeleteClusterConfig:
+		var req DeleteClusterConfigReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.DeleteClusterConfig(req.Key)
+
+	case internal.SetHintedHandoffPolicy:
+		var req SetHintedHandoffPolicyReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetHintedHandoffPolicy(&req.Policy)
+
+	case internal.DeleteHintedHandoffPolicy:
+		var req DeleteHintedHandoffPolicyReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.DeleteHintedHandoffPolicy(req.Database, req.RetentionPolicy)
+
+	case internal.SetShardGroupAlignment:
+		var req SetShardGroupAlignmentReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetShardGroupAlignment(req.Database, req.RetentionPolicy, req.Unit)
+
+	case internal.ImportUsers:
+		var req ImportUsersReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("import %d users", len(req.Users.Users))
+		return s.MetaStore.ImportUsers(&req.Users)
+
+	case internal.FreezeShardGroups:
+		var req FreezeShardGroupsReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.FreezeShardGroups(req.ID, req.Until)
+
+	case internal.ThawShardGroups:
+		var req ThawShardGroupsReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.ThawShardGroups(req.ID)
+
+	case internal.SetShardReadOnly:
+		var req SetShardReadOnlyReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetShardReadOnly(req.ShardID, req.ReadOnly)
+
+	case internal.BeginShardCutover:
+		var req BeginShardCutoverReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.BeginShardCutover(req.ShardID, req.NodeID, req.Expiration)
+
+	case internal.EndShardCutover:
+		var req EndShardCutoverReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.EndShardCutover(req.ShardID)
+
+	case internal.MarkShardsStale:
+		var req MarkShardsStaleReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.MarkShardsStale(req.NodeID, req.ShardIDs, req.Time)
+
+	case internal.ClearStaleShard:
+		var req ClearStaleShardReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.ClearStaleShard(req.ShardID, req.NodeID)
+
+	case internal.CreateMeasurementTombstone:
+		var req CreateMeasurementTombstoneReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		t, err := s.MetaStore.CreateMeasurementTombstone(req.Database, req.Name, req.Time)
+		if err == nil && pctx != nil && pctx.retData != nil {
+			*pctx.retData.(*imeta.MeasurementTombstone) = *t
+		}
+		return err
+
+	case internal.AckMeasurementTombstone:
+		var req AckMeasurementTombstoneReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.AckMeasurementTombstone(req.ID, req.NodeID, req.Time)
+
+	case internal.CreateMaintenanceWindow:
+		var req CreateMaintenanceWindowReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		w, err := s.MetaStore.CreateMaintenanceWindow(req.Window, req.Time)
+		if err == nil && pctx != nil && pctx.retData != nil {
+			*pctx.retData.(*imeta.MaintenanceWindow) = *w
+		}
+		return err
+
+	case internal.DeleteMaintenanceWindow:
+		var req DeleteMaintenanceWindowReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.DeleteMaintenanceWindow(req.ID)
+
+	case internal.SealShardGroups:
+		var req SealShardGroupsReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		sealed, err := s.MetaStore.SealShardGroups(req.Grace, req.Time)
+		if err == nil && pctx != nil && pctx.retData != nil {
+			*pctx.retData.(*int) = sealed
+		}
+		return err
+
+	case internal.SetSealedShardChecksum:
+		var req SetSealedShardChecksumReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetSealedShardChecksum(req.ShardID, req.Checksum, req.Diverged, req.Time)
+
+	case internal.RegisterDataNode:
+		var req RegisterDataNodeReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		incarnation, err := s.MetaStore.RegisterDataNode(req.Id, req.Time)
+		if err == nil && pctx != nil && pctx.retData != nil {
+			*pctx.retData.(*uint64) = incarnation
+		}
+		return err
+
 	case internal.AddShardOwner:
 		var req AddShardOwnerReq
 		err := json.Unmarshal(proposal.Data, &req)
 		x.Check(err)
 		s.SugaredLogger.Debugf("add shard owner req %+v", req)
-		return s.MetaStore.AddShardOwner(req.ShardID, req.NodeID)
+		return s.MetaStore.AddShardOwner(imeta.ShardID(req.ShardID), imeta.NodeID(req.NodeID))
 
 	case internal.RemoveShardOwner:
 		var req RemoveShardOwnerReq
 		err := json.Unmarshal(proposal.Data, &req)
 		x.Check(err)
 		s.SugaredLogger.Debugf("remove shard owner req %+v", req)
-		return s.MetaStore.RemoveShardOwner(req.ShardID, req.NodeID)
+		return s.MetaStore.RemoveShardOwner(imeta.ShardID(req.ShardID), imeta.NodeID(req.NodeID))
 
 	case internal.DropShard:
 		var req DropShardReq
@@ -252,7 +499,11 @@ func (s *RaftNode) applyCommitted(proposal *internal.Proposal, index uint64) err
 			// fallback
 			req.Expiration = time.Now().Add(imeta.SHARDGROUP_INFO_EVICTION)
 		}
-		return s.MetaStore.PruneShardGroups(req.Expiration)
+		groups, err := s.MetaStore.PruneShardGroupsAffected(req.Expiration)
+		if err == nil && pctx.retData != nil {
+			*pctx.retData.(*[]imeta.AffectedShardGroup) = groups
+		}
+		return err
 
 	case internal.DeleteShardGroup:
 		var req DeleteShardGroupReq
@@ -269,7 +520,11 @@ func (s *RaftNode) applyCommitted(proposal *internal.Proposal, index uint64) err
 		err := json.Unmarshal(proposal.Data, &req)
 		x.Check(err)
 		s.SugaredLogger.Debugf("req %+v", req)
-		return s.MetaStore.PrecreateShardGroups(req.From, req.To)
+		groups, err := s.MetaStore.PrecreateShardGroupsAffected(req.From, req.To)
+		if err == nil && pctx.retData != nil {
+			*pctx.retData.(*[]imeta.AffectedShardGroup) = groups
+		}
+		return err
 
 	case internal.CreateContinuousQuery:
 		var req CreateContinuousQueryReq
@@ -319,7 +574,8 @@ func (s *RaftNode) applyCommitted(proposal *internal.Proposal, index uint64) err
 		md, err := s.MetaStore.MarshalBinary()
 		x.Check(err)
 		var sndata internal.SnapshotData
-		sndata.Data = md
+		sndata.Data, err = s.snapCipher.Seal(md)
+		x.Check(err)
 		sndata.PeersAddr = s.Transport.ClonePeers()
 
 		data, err := json.Marshal(&sndata)
@@ -397,6 +653,42 @@ func (s *RaftNode) applyCommitted(proposal *internal.Proposal, index uint64) err
 		} else {
 			return s.MetaStore.UnfreezeDataNode(req.Id)
 		}
+	case internal.ReassignShardGroups:
+		var req ReassignShardGroupsReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.ReassignShardGroups(req.Id, req.Time)
+	case internal.SetDefaultRetentionPolicy:
+		var req SetDefaultRetentionPolicyReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.SetDefaultRetentionPolicy(req.Template)
+	case internal.CreateDatabaseTemplate:
+		var req CreateDatabaseTemplateReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.CreateDatabaseTemplate(&req.Template)
+	case internal.DropDatabaseTemplate:
+		var req DropDatabaseTemplateReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Debugf("req %+v", req)
+		return s.MetaStore.DropDatabaseTemplate(req.Name)
+	case internal.CreateDatabaseFromTemplate:
+		var req CreateDatabaseFromTemplateReq
+		err := json.Unmarshal(proposal.Data, &req)
+		x.Check(err)
+		s.SugaredLogger.Infof("apply create database from template %+v", req)
+		db, err := s.MetaStore.CreateDatabaseFromTemplate(req.Name, req.Template)
+		pctx.err = err
+		if err == nil && pctx.retData != nil {
+			x.AssertTrue(db != nil)
+			*pctx.retData.(*meta.DatabaseInfo) = *db
+		}
+		return err
 	default:
 		return fmt.Errorf("Unknown msg type:%d", proposal.Type)
 	}
@@ -5,6 +5,8 @@ import (
 	"net"
 
 	"github.com/BurntSushi/toml"
+	"github.com/angopher/chronus/services/events"
+	imeta "github.com/angopher/chronus/services/meta"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
 )
@@ -16,6 +18,11 @@ const (
 	DefaultHeartbeatTick       = 1
 	DefaultMaxSizePerMsg       = 4096
 	DefaultMaxInflightMsgs     = 256
+
+	// DefaultAuthLockoutWindowSec is the window counting failed authentications
+	DefaultAuthLockoutWindowSec = 300
+	// DefaultAuthLockoutDurationSec is how long a user is locked
+	DefaultAuthLockoutDurationSec = 900
 )
 
 type IPRange struct {
@@ -39,6 +46,34 @@ type Config struct {
 	ChecksumIntervalSec int    `toml:"checksum-interval"`
 	RetentionAutoCreate bool   `toml:"retention-auto-create"`
 
+	// ArchiveDir keeps shard groups pruned from meta data, which are dropped
+	// if empty
+	ArchiveDir string `toml:"archive-dir"`
+
+	// DataHistorySize is the latest versions of meta data kept for reads at
+	// past indexes, 0 keeps none
+	DataHistorySize int `toml:"data-history-size"`
+
+	// AuthLockoutAttempts failed authentications within AuthLockoutWindowSec
+	// lock the user for AuthLockoutDurationSec, 0 disables lockout. Admin
+	// users are locked after AuthLockoutAdminAttempts, 0 exempts them
+	AuthLockoutAttempts      int `toml:"auth-lockout-attempts"`
+	AuthLockoutAdminAttempts int `toml:"auth-lockout-admin-attempts"`
+	AuthLockoutWindowSec     int `toml:"auth-lockout-window"`
+	AuthLockoutDurationSec   int `toml:"auth-lockout-duration"`
+
+	// PasswordHash is the algorithm hashing passwords: bcrypt, scrypt or argon2id
+	PasswordHash string `toml:"password-hash"`
+
+	// Key encrypting meta data in snapshots, loaded from the first one set of
+	// file, env or output of command. Base64 encoded key of 16/24/32 bytes.
+	SnapshotKeyFile    string `toml:"snapshot-key-file"`
+	SnapshotKeyEnv     string `toml:"snapshot-key-env"`
+	SnapshotKeyCommand string `toml:"snapshot-key-command"`
+
+	// Events emits topology changes to webhooks, nats or kafka
+	Events events.Config `toml:"events"`
+
 	LogFormat string `toml:"log-format"`
 	LogLevel  string `toml:"log-level"`
 	LogDir    string `toml:"log-dir"`
@@ -52,23 +87,28 @@ type Peer struct {
 // NewConfig returns an instance of Config with defaults.
 func NewConfig() Config {
 	return Config{
-		NumPendingProposals: DefaultNumPendingProposals,
-		Tracing:             false,
-		MyAddr:              DefaultAddr,
-		RaftId:              1,
-		Peers:               []Peer{},
-		TickTimeMs:          60,
-		ElectionTick:        DefaultElectionTick,
-		HeartbeatTick:       DefaultHeartbeatTick,
-		MaxSizePerMsg:       DefaultMaxSizePerMsg,
-		MaxInflightMsgs:     DefaultMaxInflightMsgs,
-		WalDir:              "./wal",
-		SnapshotIntervalSec: 300,
-		ChecksumIntervalSec: 120,
-		RetentionAutoCreate: true,
-		LogFormat:           "console",
-		LogLevel:            "info",
-		LogDir:              "./logs",
+		NumPendingProposals:    DefaultNumPendingProposals,
+		Tracing:                false,
+		MyAddr:                 DefaultAddr,
+		RaftId:                 1,
+		Peers:                  []Peer{},
+		TickTimeMs:             60,
+		ElectionTick:           DefaultElectionTick,
+		HeartbeatTick:          DefaultHeartbeatTick,
+		MaxSizePerMsg:          DefaultMaxSizePerMsg,
+		MaxInflightMsgs:        DefaultMaxInflightMsgs,
+		WalDir:                 "./wal",
+		SnapshotIntervalSec:    300,
+		ChecksumIntervalSec:    120,
+		RetentionAutoCreate:    true,
+		DataHistorySize:        imeta.DefaultDataHistorySize,
+		AuthLockoutWindowSec:   DefaultAuthLockoutWindowSec,
+		AuthLockoutDurationSec: DefaultAuthLockoutDurationSec,
+		PasswordHash:           imeta.PasswordHashBcrypt,
+		Events:                 events.NewConfig(),
+		LogFormat:              "console",
+		LogLevel:               "info",
+		LogDir:                 "./logs",
 	}
 }
 
@@ -37,6 +37,43 @@ const (
 	AddShardOwner                     = 30
 	RemoveShardOwner                  = 31
 	FreezeDataNode                    = 32
+	SetDefaultRetentionPolicy         = 33
+	CreateDatabaseTemplate            = 34
+	DropDatabaseTemplate              = 35
+	CreateDatabaseFromTemplate        = 36
+	SetMeasurementPrivilege           = 37
+	LockUser                          = 38
+	UnlockUser                        = 39
+	CreateAPIToken                    = 40
+	DropAPIToken                      = 41
+	SetBucketMapping                  = 42
+	DropBucketMapping                 = 43
+	ReassignShardGroups               = 44
+	SetClusterConfig                  = 45
+	DeleteClusterConfig               = 46
+	SetHintedHandoffPolicy            = 47
+	DeleteHintedHandoffPolicy         = 48
+	CreateShardGroupsForRange         = 49
+	SetShardReadOnly                  = 50
+	BeginShardCutover                 = 51
+	EndShardCutover                   = 52
+	CreateSession                     = 53
+	DropSession                       = 54
+	SetShardGroupAlignment            = 55
+	ImportUsers                       = 56
+	FreezeShardGroups                 = 57
+	ThawShardGroups                   = 58
+	MarkShardsStale                   = 59
+	ClearStaleShard                   = 60
+	CreateMeasurementTombstone        = 61
+	AckMeasurementTombstone           = 62
+	CreateMaintenanceWindow           = 63
+	DeleteMaintenanceWindow           = 64
+	SealShardGroups                   = 65
+	SetSealedShardChecksum            = 66
+	RegisterDataNode                  = 67
+	SetOperatorRole                   = 68
+	PruneSessions                     = 69
 )
 
 var MessageTypeName = map[int]string{
@@ -72,6 +109,43 @@ var MessageTypeName = map[int]string{
 	30: "AddShardOwner",
 	31: "RemoveShardOwner",
 	32: "FreezeDataNode",
+	33: "SetDefaultRetentionPolicy",
+	34: "CreateDatabaseTemplate",
+	35: "DropDatabaseTemplate",
+	36: "CreateDatabaseFromTemplate",
+	37: "SetMeasurementPrivilege",
+	38: "LockUser",
+	39: "UnlockUser",
+	40: "CreateAPIToken",
+	41: "DropAPIToken",
+	42: "SetBucketMapping",
+	43: "DropBucketMapping",
+	44: "ReassignShardGroups",
+	45: "SetClusterConfig",
+	46: "DeleteClusterConfig",
+	47: "SetHintedHandoffPolicy",
+	48: "DeleteHintedHandoffPolicy",
+	49: "CreateShardGroupsForRange",
+	50: "SetShardReadOnly",
+	51: "BeginShardCutover",
+	52: "EndShardCutover",
+	53: "CreateSession",
+	54: "DropSession",
+	55: "SetShardGroupAlignment",
+	56: "ImportUsers",
+	57: "FreezeShardGroups",
+	58: "ThawShardGroups",
+	59: "MarkShardsStale",
+	60: "ClearStaleShard",
+	61: "CreateMeasurementTombstone",
+	62: "AckMeasurementTombstone",
+	63: "CreateMaintenanceWindow",
+	64: "DeleteMaintenanceWindow",
+	65: "SealShardGroups",
+	66: "SetSealedShardChecksum",
+	67: "RegisterDataNode",
+	68: "SetOperatorRole",
+	69: "PruneSessions",
 }
 
 type Proposal struct {
@@ -6,17 +6,19 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	_ "net/http/pprof"
 
+	"github.com/angopher/chronus/logging"
 	"github.com/angopher/chronus/raftmeta/internal"
+	"github.com/angopher/chronus/services/events"
 	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/influxdata/influxdb/services/meta"
 	"github.com/influxdata/influxql"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type CommonResp struct {
@@ -24,6 +26,11 @@ type CommonResp struct {
 	RetMsg  string `json:"ret_msg"`
 }
 
+// Failed tells whether the request was rejected.
+func (r *CommonResp) Failed() bool {
+	return r.RetCode != 0
+}
+
 type NodeStatus struct {
 	ID       uint64 `json:"id"`
 	Addr     string `json:"addr"`
@@ -32,6 +39,9 @@ type NodeStatus struct {
 	Next     uint64 `json:"next"`
 	Role     string `json:"role"`
 	Progress string `json:"progress"`
+	// SnapshotIndex is the index of the last snapshot of the node, entries
+	// after it are replayed on restart
+	SnapshotIndex uint64 `json:"snapshot_index"`
 }
 
 type StatusNodeResp struct {
@@ -48,6 +58,13 @@ type StatusClusterResp struct {
 	Nodes   []NodeStatus `json:"nodes"`
 }
 
+// LeaderResp tells the raft leader of meta servers.
+type LeaderResp struct {
+	CommonResp
+	ID   uint64 `json:"id"`
+	Addr string `json:"addr"`
+}
+
 type MetaService struct {
 	Logger        *zap.Logger
 	Addr          string
@@ -56,14 +73,25 @@ type MetaService struct {
 	Linearizabler interface {
 		ReadNotify(ctx context.Context) error
 	}
+	// Lockout of users failed to authenticate, disabled by default
+	Lockout imeta.LockoutPolicy
+	// authFailures are the failed authentications to this node
+	authFailures imeta.AuthFailures
+	// Hasher hashes passwords of users created or updated, hashes by other
+	// algorithms are upgraded on successful authentication
+	Hasher imeta.PasswordHasher
+	// Events receives topology changes handled by this node, nil to disable
+	Events *events.Bus
 }
 
 func NewMetaService(addr string, cli *imeta.Client, node *RaftNode, l *Linearizabler) *MetaService {
+	hasher, _ := imeta.NewPasswordHasher(imeta.PasswordHashBcrypt)
 	return &MetaService{
 		cli:           cli,
 		Addr:          addr,
 		Node:          node,
 		Linearizabler: l,
+		Hasher:        hasher,
 	}
 }
 
@@ -88,6 +116,9 @@ func (s *MetaService) InitRouter() {
 	http.HandleFunc("/status_node", func(w http.ResponseWriter, r *http.Request) {
 		s.Node.HandleStatusNode(w, r)
 	})
+	http.HandleFunc(LEADER_PATH, func(w http.ResponseWriter, r *http.Request) {
+		s.Node.HandleLeader(w, r)
+	})
 
 	initHttpHandler(s)
 }
@@ -194,6 +225,7 @@ func (s *MetaService) DropDatabase(w http.ResponseWriter, r *http.Request) {
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
 	s.Logger.Info("DropDatabase ok", zap.String("name", req.Name))
+	s.Events.Publish(events.Event{Type: events.EventDatabaseDropped, Database: req.Name})
 	return
 }
 
@@ -230,8 +262,8 @@ func (s *MetaService) DropRetentionPolicy(w http.ResponseWriter, r *http.Request
 	if err != nil {
 		resp.RetMsg = err.Error()
 		s.Logger.Error("DropRetentionPolicy fail",
-			zap.String("database", req.Database),
-			zap.String("rp", req.Policy),
+			logging.Database(req.Database),
+			logging.RetentionPolicy(req.Policy),
 			zap.Error(err))
 		return
 	}
@@ -239,8 +271,8 @@ func (s *MetaService) DropRetentionPolicy(w http.ResponseWriter, r *http.Request
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
 	s.Logger.Info("DropRetentionPolicy ok",
-		zap.String("database", req.Database),
-		zap.String("rp", req.Policy))
+		logging.Database(req.Database),
+		logging.RetentionPolicy(req.Policy))
 	return
 }
 
@@ -274,14 +306,18 @@ func (s *MetaService) CreateShardGroup(w http.ResponseWriter, r *http.Request) {
 		s.Logger.Error("CreateShardGroup fail", zap.Error(err))
 		return
 	}
+	if s.cli.ShardGroupsFrozen(time.Now()) {
+		resp.RetMsg = imeta.ErrShardGroupsFrozen.Error()
+		return
+	}
 
 	sg := &meta.ShardGroupInfo{}
 	err = s.ProposeAndWait(internal.CreateShardGroup, data, sg)
 	if err != nil {
 		resp.RetMsg = err.Error()
 		s.Logger.Error("CreateShardGroup fail",
-			zap.String("database", req.Database),
-			zap.String("rp", req.Policy),
+			logging.Database(req.Database),
+			logging.RetentionPolicy(req.Policy),
 			zap.Error(err))
 		return
 	}
@@ -290,11 +326,72 @@ func (s *MetaService) CreateShardGroup(w http.ResponseWriter, r *http.Request) {
 	resp.RetMsg = "ok"
 	resp.ShardGroupInfo = *sg
 	s.Logger.Info("CreateShardGroup ok",
-		zap.String("database", req.Database),
-		zap.String("rp", req.Policy))
+		logging.Database(req.Database),
+		logging.RetentionPolicy(req.Policy))
 	return
 }
 
+type CreateShardGroupsForRangeReq struct {
+	Database string
+	Policy   string
+	Start    time.Time
+	End      time.Time
+}
+
+type CreateShardGroupsForRangeResp struct {
+	CommonResp
+	// ShardGroups created
+	ShardGroups []meta.ShardGroupInfo
+}
+
+func (s *MetaService) CreateShardGroupsForRange(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateShardGroupsForRangeResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateShardGroupsForRange fail", zap.Error(err))
+		return
+	}
+
+	var req CreateShardGroupsForRangeReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateShardGroupsForRange fail", zap.Error(err))
+		return
+	}
+	if s.cli.ShardGroupsFrozen(time.Now()) {
+		resp.RetMsg = imeta.ErrShardGroupsFrozen.Error()
+		return
+	}
+
+	var groups []meta.ShardGroupInfo
+	err = s.ProposeAndWait(internal.CreateShardGroupsForRange, data, &groups)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateShardGroupsForRange fail",
+			logging.Database(req.Database),
+			logging.RetentionPolicy(req.Policy),
+			zap.Time("start", req.Start),
+			zap.Time("end", req.End),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	resp.ShardGroups = groups
+	s.Logger.Info("CreateShardGroupsForRange ok",
+		logging.Database(req.Database),
+		logging.RetentionPolicy(req.Policy),
+		zap.Time("start", req.Start),
+		zap.Time("end", req.End),
+		zap.Int("created", len(groups)))
+}
+
 type CreateDataNodeReq struct {
 	HttpAddr string
 	TcpAddr  string
@@ -343,6 +440,11 @@ func (s *MetaService) CreateDataNode(w http.ResponseWriter, r *http.Request) {
 		zap.Uint64("ID", ni.ID),
 		zap.String("Host", ni.Host),
 		zap.String("TCPHost", ni.TCPHost))
+	s.Events.Publish(events.Event{
+		Type:   events.EventNodeAdded,
+		NodeID: ni.ID,
+		Attrs:  map[string]interface{}{"host": ni.Host, "tcp_host": ni.TCPHost},
+	})
 }
 
 type DeleteDataNodeReq struct {
@@ -382,6 +484,7 @@ func (s *MetaService) DeleteDataNode(w http.ResponseWriter, r *http.Request) {
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
 	s.Logger.Info(fmt.Sprintf("DeleteDataNode ok, id=%d", req.Id))
+	s.Events.Publish(events.Event{Type: events.EventNodeRemoved, NodeID: req.Id})
 }
 
 type RetentionPolicySpec struct {
@@ -426,7 +529,7 @@ func (s *MetaService) CreateRetentionPolicy(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		resp.RetMsg = err.Error()
 		s.Logger.Error("CreateRetentionPolicy fail",
-			zap.String("database", req.Database),
+			logging.Database(req.Database),
 			zap.Bool("MakeDefault", req.MakeDefault),
 			zap.String("Rps.Name", req.Rps.Name),
 			zap.Int("Rps.ReplicaN", req.Rps.ReplicaN),
@@ -440,7 +543,7 @@ func (s *MetaService) CreateRetentionPolicy(w http.ResponseWriter, r *http.Reque
 	resp.RetMsg = "ok"
 	resp.RetentionPolicyInfo = *rpi
 	s.Logger.Info("CreateRetentionPolicy ok",
-		zap.String("database", req.Database),
+		logging.Database(req.Database),
 		zap.Bool("MakeDefault", req.MakeDefault),
 		zap.String("Rps.Name", req.Rps.Name),
 		zap.Int("Rps.ReplicaN", req.Rps.ReplicaN),
@@ -482,7 +585,7 @@ func (s *MetaService) UpdateRetentionPolicy(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		resp.RetMsg = err.Error()
 		s.Logger.Error("UpdateRetentionPolicy fail",
-			zap.String("Database", req.Database),
+			logging.Database(req.Database),
 			zap.String("Name", req.Name),
 			zap.Bool("MakeDefault", req.MakeDefault),
 			zap.String("Rps.Name", req.Rps.Name),
@@ -496,7 +599,7 @@ func (s *MetaService) UpdateRetentionPolicy(w http.ResponseWriter, r *http.Reque
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
 	s.Logger.Info("UpdateRetentionPolicy ok",
-		zap.String("Database", req.Database),
+		logging.Database(req.Database),
 		zap.String("Name", req.Name),
 		zap.Bool("MakeDefault", req.MakeDefault),
 		zap.String("Rps.Name", req.Rps.Name),
@@ -589,13 +692,13 @@ func (s *MetaService) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// regenerate data due to pre-hashed password
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hash, err := s.Hasher.Hash(req.Password)
 	if err != nil {
 		resp.RetMsg = err.Error()
 		s.Logger.Error("Hash user password fail", zap.Error(err))
 		return
 	}
-	req.Password = string(hash)
+	req.Password = hash
 	data, _ = json.Marshal(&req)
 
 	user := &meta.UserInfo{}
@@ -684,13 +787,13 @@ func (s *MetaService) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// regenerate data due to pre-hashed password
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hash, err := s.Hasher.Hash(req.Password)
 	if err != nil {
 		resp.RetMsg = err.Error()
 		s.Logger.Error("Hash user password fail", zap.Error(err))
 		return
 	}
-	req.Password = string(hash)
+	req.Password = hash
 	data, _ = json.Marshal(&req)
 
 	err = s.ProposeAndWait(internal.UpdateUser, data, nil)
@@ -741,7 +844,7 @@ func (s *MetaService) SetPrivilege(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		s.Logger.Error("SetPrivilege fail",
 			zap.String("UserName", req.UserName),
-			zap.String("Database", req.Database),
+			logging.Database(req.Database),
 			zap.Error(err))
 		resp.RetMsg = err.Error()
 		return
@@ -751,7 +854,7 @@ func (s *MetaService) SetPrivilege(w http.ResponseWriter, r *http.Request) {
 	resp.RetMsg = "ok"
 	s.Logger.Info("SetPrivilege ok",
 		zap.String("UserName", req.UserName),
-		zap.String("Database", req.Database))
+		logging.Database(req.Database))
 }
 
 type SetAdminPrivilegeReq struct {
@@ -827,74 +930,117 @@ func (s *MetaService) Authenticate(w http.ResponseWriter, r *http.Request) {
 		s.Logger.Error("Authenticate fail", zap.Error(err))
 		return
 	}
+	now := time.Now()
+	if s.Lockout.Enabled() && s.cli.UserLocked(req.UserName, now) {
+		s.Logger.Warn("Authenticate locked user", zap.String("UserName", req.UserName))
+		resp.RetMsg = imeta.ErrUserLocked.Error()
+		return
+	}
 	u, err := s.Node.MetaStore.Authenticate(req.UserName, req.Password)
 	if err != nil {
 		s.Logger.Error("Authenticate fail",
 			zap.String("UserName", req.UserName),
 			zap.Error(err))
 		resp.RetMsg = err.Error()
+		if err == meta.ErrAuthenticate && s.Lockout.Enabled() {
+			s.recordAuthFailure(req.UserName, now)
+		}
 		return
 	}
+	if s.Lockout.Enabled() {
+		s.authFailures.Reset(req.UserName)
+	}
+	if imeta.NeedsRehash(u.(*meta.UserInfo).Hash, s.Hasher) {
+		s.rehashPassword(req.UserName, req.Password)
+	}
 
 	resp.UserInfo = *(u.(*meta.UserInfo))
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
 }
 
-type AddShardOwnerReq struct {
-	ShardID uint64
-	NodeID  uint64
+type LockUserReq struct {
+	UserName string
+	Until    time.Time
+	Time     time.Time
 }
 
-type AddShardOwnerResp struct {
-	CommonResp
+// recordAuthFailure counts the failure in memory of this node, proposing the
+// lock only once the failures reach the policy.
+func (s *MetaService) recordAuthFailure(name string, now time.Time) {
+	admin := false
+	if u, err := s.cli.User(name); err == nil {
+		admin = u.AuthorizeUnrestricted()
+	}
+	if !s.authFailures.Fail(name, admin, now, s.Lockout) {
+		return
+	}
+	data, _ := json.Marshal(&LockUserReq{UserName: name, Until: now.Add(s.Lockout.Duration), Time: now})
+	if err := s.ProposeAndWait(internal.LockUser, data, nil); err != nil {
+		s.Logger.Error("LockUser fail", zap.String("UserName", name), zap.Error(err))
+		return
+	}
+	s.Logger.Warn("User locked because of failed authentications",
+		zap.String("UserName", name),
+		zap.Duration("Duration", s.Lockout.Duration))
 }
 
-func (s *MetaService) AddShardOwner(w http.ResponseWriter, r *http.Request) {
-	resp := new(AddShardOwnerResp)
-	resp.RetCode = -1
-	resp.RetMsg = "fail"
-	defer WriteResp(w, &resp)
+func (s *MetaService) proposeUnlockUser(name string) error {
+	data, _ := json.Marshal(&UnlockUserReq{UserName: name})
+	if err := s.ProposeAndWait(internal.UnlockUser, data, nil); err != nil {
+		s.Logger.Error("UnlockUser fail", zap.String("UserName", name), zap.Error(err))
+		return err
+	}
+	return nil
+}
 
-	data, err := ioutil.ReadAll(r.Body)
+// rehashPassword upgrades the hash of password by the configured hasher
+func (s *MetaService) rehashPassword(name, password string) {
+	hash, err := s.Hasher.Hash(password)
 	if err != nil {
-		resp.RetMsg = err.Error()
-		s.Logger.Error("AddShardOwner fail", zap.Error(err))
+		s.Logger.Error("Hash user password fail", zap.Error(err))
 		return
 	}
-
-	var req AddShardOwnerReq
-	if err := json.Unmarshal(data, &req); err != nil {
-		resp.RetMsg = err.Error()
-		s.Logger.Error("AddShardOwner fail", zap.Error(err))
+	data, _ := json.Marshal(&UpdateUserReq{Name: name, Password: hash})
+	if err := s.ProposeAndWait(internal.UpdateUser, data, nil); err != nil {
+		s.Logger.Error("Upgrade password hash fail", zap.String("UserName", name), zap.Error(err))
 		return
 	}
+	s.Logger.Info("Upgrade password hash ok", zap.String("UserName", name), zap.String("Algorithm", s.Hasher.Name()))
+}
 
-	err = s.ProposeAndWait(internal.AddShardOwner, data, nil)
-	if err != nil {
+type LockedUsersResp struct {
+	CommonResp
+	Users []imeta.LockedUser
+}
+
+func (s *MetaService) LockedUsers(w http.ResponseWriter, r *http.Request) {
+	resp := new(LockedUsersResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("AddShardOwner fail",
-			zap.Uint64("shardID", req.ShardID),
-			zap.Uint64("nodeID", req.NodeID),
-			zap.Error(err))
 		return
 	}
 
+	resp.Users = s.cli.LockedUsers(time.Now())
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
 }
 
-type RemoveShardOwnerReq struct {
-	ShardID uint64
-	NodeID  uint64
+type UnlockUserReq struct {
+	UserName string
 }
-
-type RemoveShardOwnerResp struct {
+type UnlockUserResp struct {
 	CommonResp
 }
 
-func (s *MetaService) RemoveShardOwner(w http.ResponseWriter, r *http.Request) {
-	resp := new(RemoveShardOwnerResp)
+func (s *MetaService) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	resp := new(UnlockUserResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -902,40 +1048,70 @@ func (s *MetaService) RemoveShardOwner(w http.ResponseWriter, r *http.Request) {
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("RemoveShardOwner fail", zap.Error(err))
+		s.Logger.Error("UnlockUser fail", zap.Error(err))
 		return
 	}
 
-	var req RemoveShardOwnerReq
+	var req UnlockUserReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("RemoveShardOwner fail", zap.Error(err))
+		s.Logger.Error("UnlockUser fail", zap.Error(err))
 		return
 	}
 
-	err = s.ProposeAndWait(internal.RemoveShardOwner, data, nil)
-	if err != nil {
+	if err := s.proposeUnlockUser(req.UserName); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("RemoveShardOwner fail",
-			zap.Uint64("shardID", req.ShardID),
-			zap.Uint64("nodeID", req.NodeID),
-			zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
+	s.Logger.Info("UnlockUser ok", zap.String("UserName", req.UserName))
 }
 
-type DropShardReq struct {
-	Id uint64
+type APITokensResp struct {
+	CommonResp
+	Tokens []imeta.APIToken
 }
-type DropShardResp struct {
+
+func (s *MetaService) APITokens(w http.ResponseWriter, r *http.Request) {
+	resp := new(APITokensResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Tokens = s.cli.APITokens(r.URL.Query().Get("user"))
+	// hashes are of no use to clients
+	for i := range resp.Tokens {
+		resp.Tokens[i].Hash = ""
+	}
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type CreateAPITokenReq struct {
+	UserName    string
+	Description string
+	// Hash and CreatedAt are filled by the meta node serving the request
+	Hash      string
+	CreatedAt time.Time
+}
+type CreateAPITokenResp struct {
 	CommonResp
+	// Token is only returned here, a lost token has to be recreated
+	Token string
+	Info  imeta.APIToken
 }
 
-func (s *MetaService) DropShard(w http.ResponseWriter, r *http.Request) {
-	resp := new(DropShardResp)
+func (s *MetaService) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateAPITokenResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -943,40 +1119,56 @@ func (s *MetaService) DropShard(w http.ResponseWriter, r *http.Request) {
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropShard fail", zap.Error(err))
+		s.Logger.Error("CreateAPIToken fail", zap.Error(err))
 		return
 	}
 
-	var req DropShardReq
+	var req CreateAPITokenReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropShard fail", zap.Error(err))
+		s.Logger.Error("CreateAPIToken fail", zap.Error(err))
+		return
+	}
+	// regenerate data as the token is generated here
+	token, err := imeta.GenerateAPIToken()
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("Generate api token fail", zap.Error(err))
 		return
 	}
+	req.Hash = imeta.HashAPIToken(token)
+	req.CreatedAt = time.Now().UTC()
+	data, _ = json.Marshal(&req)
 
-	err = s.ProposeAndWait(internal.DropShard, data, nil)
+	info := &imeta.APIToken{}
+	err = s.ProposeAndWait(internal.CreateAPIToken, data, info)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropShard fail",
-			zap.Uint64("Id", req.Id),
+		s.Logger.Error("CreateAPIToken fail",
+			zap.String("UserName", req.UserName),
 			zap.Error(err))
 		return
 	}
 
+	info.Hash = ""
+	resp.Token = token
+	resp.Info = *info
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("DropShard ok", zap.Uint64("Id", req.Id))
+	s.Logger.Info("CreateAPIToken ok",
+		zap.String("UserName", req.UserName),
+		zap.Uint64("ID", info.ID))
 }
 
-type TruncateShardGroupsReq struct {
-	Time time.Time
+type DropAPITokenReq struct {
+	ID uint64
 }
-type TruncateShardGroupsResp struct {
+type DropAPITokenResp struct {
 	CommonResp
 }
 
-func (s *MetaService) TruncateShardGroups(w http.ResponseWriter, r *http.Request) {
-	resp := new(TruncateShardGroupsResp)
+func (s *MetaService) DropAPIToken(w http.ResponseWriter, r *http.Request) {
+	resp := new(DropAPITokenResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -984,74 +1176,128 @@ func (s *MetaService) TruncateShardGroups(w http.ResponseWriter, r *http.Request
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("TruncateShardGroups fail", zap.Error(err))
+		s.Logger.Error("DropAPIToken fail", zap.Error(err))
 		return
 	}
 
-	var req TruncateShardGroupsReq
+	var req DropAPITokenReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("TruncateShardGroups fail", zap.Error(err))
+		s.Logger.Error("DropAPIToken fail", zap.Error(err))
 		return
 	}
 
-	err = s.ProposeAndWait(internal.TruncateShardGroups, data, nil)
+	err = s.ProposeAndWait(internal.DropAPIToken, data, nil)
 	if err != nil {
-		s.Logger.Error("TruncateShardGroups fail",
-			zap.Time("Time", req.Time),
-			zap.Error(err))
 		resp.RetMsg = err.Error()
+		s.Logger.Error("DropAPIToken fail", zap.Uint64("ID", req.ID), zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("TruncateShardGroups ok", zap.Time("Time", req.Time))
+	s.Logger.Info("DropAPIToken ok", zap.Uint64("ID", req.ID))
 }
 
-type PruneShardGroupsReq struct {
+type CreateSessionReq struct {
+	UserName string
+	TTL      time.Duration
+	// Hash, CreatedAt and Expiration are filled by the meta node serving the request
+	Hash       string
+	CreatedAt  time.Time
 	Expiration time.Time
 }
-
-type PruneShardGroupsResp struct {
+type CreateSessionResp struct {
 	CommonResp
+	Token      string
+	Expiration time.Time
 }
 
-func (s *MetaService) PruneShardGroups(w http.ResponseWriter, r *http.Request) {
-	resp := new(PruneShardGroupsResp)
+func (s *MetaService) CreateSession(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateSessionResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
 
-	req := &PruneShardGroupsReq{
-		Expiration: time.Now().Add(imeta.SHARDGROUP_INFO_EVICTION),
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateSession fail", zap.Error(err))
+		return
+	}
+
+	var req CreateSessionReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateSession fail", zap.Error(err))
+		return
 	}
-	data, _ := json.Marshal(req)
-	err := s.ProposeAndWait(internal.PruneShardGroups, data, nil)
+	// regenerate data as the token is generated here
+	token, err := imeta.GenerateAPIToken()
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("PruneShardGroups fail", zap.Error(err))
+		s.Logger.Error("Generate session token fail", zap.Error(err))
+		return
+	}
+	req.Hash = imeta.HashAPIToken(token)
+	req.CreatedAt = time.Now().UTC()
+	req.Expiration = req.CreatedAt.Add(req.TTL)
+	data, _ = json.Marshal(&req)
+
+	err = s.ProposeAndWait(internal.CreateSession, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateSession fail",
+			zap.String("UserName", req.UserName),
+			zap.Error(err))
 		return
 	}
 
+	resp.Token = token
+	resp.Expiration = req.Expiration
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("PruneShardGroups ok")
+	s.Logger.Debug("CreateSession ok",
+		zap.String("UserName", req.UserName),
+		zap.Time("Expiration", req.Expiration))
 }
 
-//DeleteShardGroup
-type DeleteShardGroupReq struct {
-	Database string
-	Policy   string
-	Id       uint64
-	Now      time.Time
+type PruneSessionsReq struct {
+	Time time.Time
 }
-type DeleteShardGroupResp struct {
+
+// PruneSessions proposes removing sessions expired every interval while this
+// node leads, so that sessions of users not signing in again don't pile up.
+func (s *MetaService) PruneSessions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			if s.Node.Node.Status().Lead != s.Node.ID || !s.cli.SessionsExpired(now) {
+				continue
+			}
+			data, _ := json.Marshal(&PruneSessionsReq{Time: now})
+			if err := s.ProposeAndWait(internal.PruneSessions, data, nil); err != nil {
+				s.Logger.Error("PruneSessions fail", zap.Error(err))
+			}
+		case <-s.Node.Done:
+			return
+		}
+	}
+}
+
+type DropSessionReq struct {
+	Hash string
+}
+type DropSessionResp struct {
 	CommonResp
 }
 
-func (s *MetaService) DeleteShardGroup(w http.ResponseWriter, r *http.Request) {
-	resp := new(DeleteShardGroupResp)
+func (s *MetaService) DropSession(w http.ResponseWriter, r *http.Request) {
+	resp := new(DropSessionResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -1059,48 +1305,60 @@ func (s *MetaService) DeleteShardGroup(w http.ResponseWriter, r *http.Request) {
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DeleteShardGroup fail", zap.Error(err))
+		s.Logger.Error("DropSession fail", zap.Error(err))
 		return
 	}
 
-	var req DeleteShardGroupReq
+	var req DropSessionReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DeleteShardGroup fail", zap.Error(err))
+		s.Logger.Error("DropSession fail", zap.Error(err))
 		return
 	}
-	req.Now = time.Now()
 
-	err = s.ProposeAndWait(internal.DeleteShardGroup, data, nil)
+	err = s.ProposeAndWait(internal.DropSession, data, nil)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DeleteShardGroup fail",
-			zap.String("Database", req.Database),
-			zap.String("Policy", req.Policy),
-			zap.Uint64("Id", req.Id),
-			zap.Error(err))
+		s.Logger.Error("DropSession fail", zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("DeleteShardGroup ok",
-		zap.String("Database", req.Database),
-		zap.String("Policy", req.Policy),
-		zap.Uint64("Id", req.Id))
 }
 
-//PrecreateShardGroups
-type PrecreateShardGroupsReq struct {
-	From time.Time
-	To   time.Time
+type BucketMappingsResp struct {
+	CommonResp
+	Mappings []imeta.BucketMapping
 }
-type PrecreateShardGroupsResp struct {
+
+func (s *MetaService) BucketMappings(w http.ResponseWriter, r *http.Request) {
+	resp := new(BucketMappingsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Mappings = s.cli.BucketMappings()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type SetBucketMappingReq struct {
+	Mapping imeta.BucketMapping
+}
+type SetBucketMappingResp struct {
 	CommonResp
 }
 
-func (s *MetaService) PrecreateShardGroups(w http.ResponseWriter, r *http.Request) {
-	resp := new(PrecreateShardGroupsResp)
+func (s *MetaService) SetBucketMapping(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetBucketMappingResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -1108,46 +1366,46 @@ func (s *MetaService) PrecreateShardGroups(w http.ResponseWriter, r *http.Reques
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("PrecreateShardGroups fail", zap.Error(err))
+		s.Logger.Error("SetBucketMapping fail", zap.Error(err))
 		return
 	}
 
-	var req PrecreateShardGroupsReq
+	var req SetBucketMappingReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("PrecreateShardGroups fail", zap.Error(err))
+		s.Logger.Error("SetBucketMapping fail", zap.Error(err))
 		return
 	}
 
-	err = s.ProposeAndWait(internal.PrecreateShardGroups, data, nil)
+	err = s.ProposeAndWait(internal.SetBucketMapping, data, nil)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("PrecreateShardGroups fail",
-			zap.Time("From", req.From),
-			zap.Time("To", req.To),
+		s.Logger.Error("SetBucketMapping fail",
+			zap.String("Org", req.Mapping.Org),
+			zap.String("Bucket", req.Mapping.Bucket),
 			zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("PrecreateShardGroups ok",
-		zap.Time("From", req.From),
-		zap.Time("To", req.To))
+	s.Logger.Info("SetBucketMapping ok",
+		zap.String("Org", req.Mapping.Org),
+		zap.String("Bucket", req.Mapping.Bucket),
+		logging.Database(req.Mapping.Database),
+		logging.RetentionPolicy(req.Mapping.RetentionPolicy))
 }
 
-//CreateContinuousQuery
-type CreateContinuousQueryReq struct {
-	Database string
-	Name     string
-	Query    string
+type DropBucketMappingReq struct {
+	Org    string
+	Bucket string
 }
-type CreateContinuousQueryResp struct {
+type DropBucketMappingResp struct {
 	CommonResp
 }
 
-func (s *MetaService) CreateContinuousQuery(w http.ResponseWriter, r *http.Request) {
-	resp := new(CreateContinuousQueryResp)
+func (s *MetaService) DropBucketMapping(w http.ResponseWriter, r *http.Request) {
+	resp := new(DropBucketMappingResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -1155,47 +1413,67 @@ func (s *MetaService) CreateContinuousQuery(w http.ResponseWriter, r *http.Reque
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("CreateContinuousQuery fail", zap.Error(err))
+		s.Logger.Error("DropBucketMapping fail", zap.Error(err))
 		return
 	}
 
-	var req CreateContinuousQueryReq
+	var req DropBucketMappingReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("CreateContinuousQuery fail", zap.Error(err))
+		s.Logger.Error("DropBucketMapping fail", zap.Error(err))
 		return
 	}
 
-	err = s.ProposeAndWait(internal.CreateContinuousQuery, data, nil)
+	err = s.ProposeAndWait(internal.DropBucketMapping, data, nil)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("CreateContinuousQuery fail",
-			zap.String("Database", req.Database),
-			zap.String("Name", req.Name),
-			zap.String("Query", req.Query),
+		s.Logger.Error("DropBucketMapping fail",
+			zap.String("Org", req.Org),
+			zap.String("Bucket", req.Bucket),
 			zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("CreateContinuousQuery ok",
-		zap.String("Database", req.Database),
-		zap.String("Name", req.Name),
-		zap.String("Query", req.Query))
+	s.Logger.Info("DropBucketMapping ok",
+		zap.String("Org", req.Org),
+		zap.String("Bucket", req.Bucket))
 }
 
-//DropContinuousQuery
-type DropContinuousQueryReq struct {
-	Database string
-	Name     string
+type ClusterConfigResp struct {
+	CommonResp
+	Config imeta.ClusterConfig
 }
-type DropContinuousQueryResp struct {
+
+func (s *MetaService) ClusterConfig(w http.ResponseWriter, r *http.Request) {
+	resp := new(ClusterConfigResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Config = s.cli.ClusterConfig()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type SetClusterConfigReq struct {
+	Key   string
+	Value string
+}
+type SetClusterConfigResp struct {
 	CommonResp
 }
 
-func (s *MetaService) DropContinuousQuery(w http.ResponseWriter, r *http.Request) {
-	resp := new(DropContinuousQueryResp)
+func (s *MetaService) SetClusterConfig(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetClusterConfigResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -1203,48 +1481,43 @@ func (s *MetaService) DropContinuousQuery(w http.ResponseWriter, r *http.Request
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropContinuousQuery fail", zap.Error(err))
+		s.Logger.Error("SetClusterConfig fail", zap.Error(err))
 		return
 	}
 
-	var req DropContinuousQueryReq
+	var req SetClusterConfigReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropContinuousQuery fail", zap.Error(err))
+		s.Logger.Error("SetClusterConfig fail", zap.Error(err))
+		return
+	}
+	// reject invalid value before proposing
+	if err := imeta.ValidateClusterConfig(req.Key, req.Value); err != nil {
+		resp.RetMsg = err.Error()
 		return
 	}
 
-	err = s.ProposeAndWait(internal.DropContinuousQuery, data, nil)
+	err = s.ProposeAndWait(internal.SetClusterConfig, data, nil)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropContinuousQuery fail",
-			zap.String("Database", req.Database),
-			zap.String("Name", req.Name),
-			zap.Error(err))
+		s.Logger.Error("SetClusterConfig fail", zap.String("Key", req.Key), zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("DropContinuousQuery ok",
-		zap.String("Database", req.Database),
-		zap.String("Name", req.Name))
+	s.Logger.Info("SetClusterConfig ok", zap.String("Key", req.Key), zap.String("Value", req.Value))
 }
 
-//CreateSubscription
-type CreateSubscriptionReq struct {
-	Database     string
-	Rp           string
-	Name         string
-	Mode         string
-	Destinations []string
+type DeleteClusterConfigReq struct {
+	Key string
 }
-type CreateSubscriptionResp struct {
+type DeleteClusterConfigResp struct {
 	CommonResp
 }
 
-func (s *MetaService) CreateSubscription(w http.ResponseWriter, r *http.Request) {
-	resp := new(CreateSubscriptionResp)
+func (s *MetaService) DeleteClusterConfig(w http.ResponseWriter, r *http.Request) {
+	resp := new(DeleteClusterConfigResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -1252,52 +1525,107 @@ func (s *MetaService) CreateSubscription(w http.ResponseWriter, r *http.Request)
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("CreateSubscriptionReq fail", zap.Error(err))
+		s.Logger.Error("DeleteClusterConfig fail", zap.Error(err))
 		return
 	}
 
-	var req CreateSubscriptionReq
+	var req DeleteClusterConfigReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("CreateSubscriptionReq fail", zap.Error(err))
+		s.Logger.Error("DeleteClusterConfig fail", zap.Error(err))
 		return
 	}
 
-	err = s.ProposeAndWait(internal.CreateSubscription, data, nil)
+	err = s.ProposeAndWait(internal.DeleteClusterConfig, data, nil)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("CreateSubscriptionReq fail",
-			zap.String("Database", req.Database),
-			zap.String("Rp", req.Rp),
-			zap.String("Name", req.Name),
-			zap.String("Mode", req.Mode),
-			zap.Strings("Destinations", req.Destinations),
+		s.Logger.Error("DeleteClusterConfig fail", zap.String("Key", req.Key), zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("DeleteClusterConfig ok", zap.String("Key", req.Key))
+}
+
+type HintedHandoffPoliciesResp struct {
+	CommonResp
+	Policies []imeta.HintedHandoffPolicy
+}
+
+func (s *MetaService) HintedHandoffPolicies(w http.ResponseWriter, r *http.Request) {
+	resp := new(HintedHandoffPoliciesResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Policies = s.cli.HintedHandoffPolicies()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type SetHintedHandoffPolicyReq struct {
+	Policy imeta.HintedHandoffPolicy
+}
+type SetHintedHandoffPolicyResp struct {
+	CommonResp
+}
+
+func (s *MetaService) SetHintedHandoffPolicy(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetHintedHandoffPolicyResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetHintedHandoffPolicy fail", zap.Error(err))
+		return
+	}
+
+	var req SetHintedHandoffPolicyReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetHintedHandoffPolicy fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.SetHintedHandoffPolicy, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetHintedHandoffPolicy fail",
+			logging.Database(req.Policy.Database),
+			logging.RetentionPolicy(req.Policy.RetentionPolicy),
 			zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("CreateSubscriptionReq ok",
-		zap.String("Database", req.Database),
-		zap.String("Rp", req.Rp),
-		zap.String("Name", req.Name),
-		zap.String("Mode", req.Mode),
-		zap.Strings("Destinations", req.Destinations))
+	s.Logger.Info("SetHintedHandoffPolicy ok",
+		logging.Database(req.Policy.Database),
+		logging.RetentionPolicy(req.Policy.RetentionPolicy),
+		zap.Bool("Enabled", req.Policy.Enabled))
 }
 
-//DropSubscription
-type DropSubscriptionReq struct {
-	Database string
-	Rp       string
-	Name     string
+type DeleteHintedHandoffPolicyReq struct {
+	Database        string
+	RetentionPolicy string
 }
-type DropSubscriptionResp struct {
+type DeleteHintedHandoffPolicyResp struct {
 	CommonResp
 }
 
-func (s *MetaService) DropSubscription(w http.ResponseWriter, r *http.Request) {
-	resp := new(DropSubscriptionResp)
+func (s *MetaService) DeleteHintedHandoffPolicy(w http.ResponseWriter, r *http.Request) {
+	resp := new(DeleteHintedHandoffPolicyResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -1305,49 +1633,69 @@ func (s *MetaService) DropSubscription(w http.ResponseWriter, r *http.Request) {
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropSubscription fail", zap.Error(err))
+		s.Logger.Error("DeleteHintedHandoffPolicy fail", zap.Error(err))
 		return
 	}
 
-	var req DropSubscriptionReq
+	var req DeleteHintedHandoffPolicyReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropSubscription fail", zap.Error(err))
+		s.Logger.Error("DeleteHintedHandoffPolicy fail", zap.Error(err))
 		return
 	}
 
-	err = s.ProposeAndWait(internal.DropSubscription, data, nil)
+	err = s.ProposeAndWait(internal.DeleteHintedHandoffPolicy, data, nil)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("DropSubscription fail",
-			zap.String("Database", req.Database),
-			zap.String("Rp", req.Rp),
-			zap.String("Name", req.Name),
+		s.Logger.Error("DeleteHintedHandoffPolicy fail",
+			logging.Database(req.Database),
+			logging.RetentionPolicy(req.RetentionPolicy),
 			zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info("DropSubscription ok",
-		zap.String("Database", req.Database),
-		zap.String("Rp", req.Rp),
-		zap.String("Name", req.Name))
+	s.Logger.Info("DeleteHintedHandoffPolicy ok",
+		logging.Database(req.Database),
+		logging.RetentionPolicy(req.RetentionPolicy))
 }
 
-type AcquireLeaseReq struct {
-	Name        string
-	NodeId      uint64
-	RequestTime int64 // timestamp in millis
+type ShardGroupAlignmentsResp struct {
+	CommonResp
+	Alignments []imeta.ShardGroupAlignment
 }
 
-type AcquireLeaseResp struct {
+func (s *MetaService) ShardGroupAlignments(w http.ResponseWriter, r *http.Request) {
+	resp := new(ShardGroupAlignmentsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Alignments = s.cli.ShardGroupAlignments()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type SetShardGroupAlignmentReq struct {
+	Database        string
+	RetentionPolicy string
+	// Unit is empty to remove the alignment
+	Unit string
+}
+type SetShardGroupAlignmentResp struct {
 	CommonResp
-	Lease meta.Lease
 }
 
-func (s *MetaService) AcquireLease(w http.ResponseWriter, r *http.Request) {
-	resp := new(AcquireLeaseResp)
+func (s *MetaService) SetShardGroupAlignment(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetShardGroupAlignmentResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -1355,91 +1703,160 @@ func (s *MetaService) AcquireLease(w http.ResponseWriter, r *http.Request) {
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("AcquireLease fail", zap.Error(err))
+		s.Logger.Error("SetShardGroupAlignment fail", zap.Error(err))
 		return
 	}
 
-	var req AcquireLeaseReq
+	var req SetShardGroupAlignmentReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("AcquireLease fail", zap.Error(err))
+		s.Logger.Error("SetShardGroupAlignment fail", zap.Error(err))
 		return
 	}
 
-	// do pre-check before proposing
-	if !s.Node.ShouldTryAcquireLease(req.Name, req.NodeId) {
-		resp.RetMsg = ErrAcquiredByOther.Error()
+	err = s.ProposeAndWait(internal.SetShardGroupAlignment, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetShardGroupAlignment fail",
+			logging.Database(req.Database),
+			logging.RetentionPolicy(req.RetentionPolicy),
+			zap.Error(err))
 		return
 	}
 
-	req.RequestTime = time.Now().UnixNano() / 1e6
-	data, _ = json.Marshal(&req)
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("SetShardGroupAlignment ok",
+		logging.Database(req.Database),
+		logging.RetentionPolicy(req.RetentionPolicy),
+		zap.String("Unit", req.Unit))
+}
 
-	lease := &meta.Lease{}
-	err = s.ProposeAndWait(internal.AcquireLease, data, lease)
+type ExportUsersResp struct {
+	CommonResp
+	Users *imeta.UserExport
+}
+
+func (s *MetaService) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	resp := new(ExportUsersResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Users = s.cli.ExportUsers()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type ImportUsersReq struct {
+	Users imeta.UserExport
+}
+type ImportUsersResp struct {
+	CommonResp
+}
+
+func (s *MetaService) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	resp := new(ImportUsersResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		if !strings.Contains(err.Error(), "another node has the lease") {
-			s.Logger.Error(
-				fmt.Sprintf(
-					"AcquireLease fail, name=%s, node=%d",
-					req.Name, req.NodeId,
-				),
-				zap.Error(err),
-			)
-		}
+		s.Logger.Error("ImportUsers fail", zap.Error(err))
+		return
+	}
+
+	var req ImportUsersReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("ImportUsers fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.ImportUsers, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("ImportUsers fail", zap.Error(err))
 		return
 	}
 
-	resp.Lease = *lease
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Debug("AcquireLease ok",
-		zap.String("Name", req.Name),
-		zap.Uint64("NodeId", req.NodeId),
-	)
+	s.Logger.Info("ImportUsers ok", zap.Int("Users", len(req.Users.Users)))
 }
 
-type DataResp struct {
+// FreezeShardGroupsReq holds creation of shard groups for snapshot ID until
+// Until.
+type FreezeShardGroupsReq struct {
+	ID    string
+	Until time.Time
+}
+type FreezeShardGroupsResp struct {
 	CommonResp
+	// Data is meta data marshaled once frozen
 	Data []byte
 }
 
-func (s *MetaService) Data(w http.ResponseWriter, r *http.Request) {
-	resp := new(DataResp)
+func (s *MetaService) FreezeShardGroups(w http.ResponseWriter, r *http.Request) {
+	resp := new(FreezeShardGroupsResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	err := s.Linearizabler.ReadNotify(ctx)
+	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
+		s.Logger.Error("FreezeShardGroups fail", zap.Error(err))
 		return
 	}
 
-	data := s.cli.Data()
-	resp.Data, err = data.MarshalBinary()
+	var req FreezeShardGroupsReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("FreezeShardGroups fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.FreezeShardGroups, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("FreezeShardGroups fail", zap.String("ID", req.ID), zap.Error(err))
+		return
+	}
+
+	// shard groups are no longer created from the index applied
+	resp.Data, err = s.cli.MarshalBinary()
 	if err != nil {
 		resp.RetMsg = err.Error()
+		s.Logger.Error("FreezeShardGroups fail", zap.String("ID", req.ID), zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
+	s.Logger.Info("FreezeShardGroups ok",
+		zap.String("ID", req.ID),
+		zap.Time("Until", req.Until))
 }
 
-type FreezeDataNodeReq struct {
-	Id     uint64
-	Freeze bool
+type ThawShardGroupsReq struct {
+	ID string
 }
-type FreezeDataNodeResp struct {
+type ThawShardGroupsResp struct {
 	CommonResp
 }
 
-func (s *MetaService) FreezeDataNode(w http.ResponseWriter, r *http.Request) {
-	resp := new(FreezeDataNodeResp)
+func (s *MetaService) ThawShardGroups(w http.ResponseWriter, r *http.Request) {
+	resp := new(ThawShardGroupsResp)
 	resp.RetCode = -1
 	resp.RetMsg = "fail"
 	defer WriteResp(w, &resp)
@@ -1447,37 +1864,1831 @@ func (s *MetaService) FreezeDataNode(w http.ResponseWriter, r *http.Request) {
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("FreezeDataNode fail", zap.Error(err))
+		s.Logger.Error("ThawShardGroups fail", zap.Error(err))
 		return
 	}
 
-	var req FreezeDataNodeReq
+	var req ThawShardGroupsReq
 	if err := json.Unmarshal(data, &req); err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error("FreezeDataNode fail", zap.Error(err))
+		s.Logger.Error("ThawShardGroups fail", zap.Error(err))
 		return
 	}
 
-	err = s.ProposeAndWait(internal.FreezeDataNode, data, nil)
+	err = s.ProposeAndWait(internal.ThawShardGroups, data, nil)
 	if err != nil {
 		resp.RetMsg = err.Error()
-		s.Logger.Error(fmt.Sprintf("FreezeDataNode fail, id=%d, freeze=%t", req.Id, req.Freeze), zap.Error(err))
+		s.Logger.Error("ThawShardGroups fail", zap.String("ID", req.ID), zap.Error(err))
 		return
 	}
 
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
-	s.Logger.Info(fmt.Sprintf("FreezeDataNode ok, id=%d, freeze=%t", req.Id, req.Freeze))
+	s.Logger.Info("ThawShardGroups ok", zap.String("ID", req.ID))
+}
+
+type ReadOnlyShardsResp struct {
+	CommonResp
+	ShardIDs []uint64
+}
+
+func (s *MetaService) ReadOnlyShards(w http.ResponseWriter, r *http.Request) {
+	resp := new(ReadOnlyShardsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.ShardIDs = s.cli.ReadOnlyShards()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type SetShardReadOnlyReq struct {
+	ShardID  uint64
+	ReadOnly bool
+}
+type SetShardReadOnlyResp struct {
+	CommonResp
+}
+
+func (s *MetaService) SetShardReadOnly(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetShardReadOnlyResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetShardReadOnly fail", zap.Error(err))
+		return
+	}
+
+	var req SetShardReadOnlyReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetShardReadOnly fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.SetShardReadOnly, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetShardReadOnly fail",
+			logging.ShardID(req.ShardID),
+			zap.Bool("ReadOnly", req.ReadOnly),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("SetShardReadOnly ok",
+		logging.ShardID(req.ShardID),
+		zap.Bool("ReadOnly", req.ReadOnly))
+}
+
+// BeginShardCutoverReq starts the cutover of a shard to node NodeID, holding
+// writes to the shard until Expiration.
+type BeginShardCutoverReq struct {
+	ShardID    uint64
+	NodeID     uint64
+	Expiration time.Time
+}
+type BeginShardCutoverResp struct {
+	CommonResp
+}
+
+func (s *MetaService) BeginShardCutover(w http.ResponseWriter, r *http.Request) {
+	resp := new(BeginShardCutoverResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("BeginShardCutover fail", zap.Error(err))
+		return
+	}
+
+	var req BeginShardCutoverReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("BeginShardCutover fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.BeginShardCutover, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("BeginShardCutover fail",
+			logging.ShardID(req.ShardID),
+			logging.NodeID(req.NodeID),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("BeginShardCutover ok",
+		logging.ShardID(req.ShardID),
+		logging.NodeID(req.NodeID),
+		zap.Time("Expiration", req.Expiration))
+}
+
+type EndShardCutoverReq struct {
+	ShardID uint64
+}
+type EndShardCutoverResp struct {
+	CommonResp
+}
+
+func (s *MetaService) EndShardCutover(w http.ResponseWriter, r *http.Request) {
+	resp := new(EndShardCutoverResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("EndShardCutover fail", zap.Error(err))
+		return
+	}
+
+	var req EndShardCutoverReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("EndShardCutover fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.EndShardCutover, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("EndShardCutover fail", logging.ShardID(req.ShardID), zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("EndShardCutover ok", logging.ShardID(req.ShardID))
+}
+
+// MarkShardsStaleReq marks copies of shards on node NodeID stale, Time is of
+// the proposer so that all meta servers apply the same.
+type MarkShardsStaleReq struct {
+	NodeID   uint64
+	ShardIDs []uint64
+	Time     time.Time
+}
+type MarkShardsStaleResp struct {
+	CommonResp
+}
+
+func (s *MetaService) MarkShardsStale(w http.ResponseWriter, r *http.Request) {
+	resp := new(MarkShardsStaleResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("MarkShardsStale fail", zap.Error(err))
+		return
+	}
+
+	var req MarkShardsStaleReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("MarkShardsStale fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.MarkShardsStale, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("MarkShardsStale fail",
+			logging.NodeID(req.NodeID),
+			zap.Uint64s("ShardIDs", req.ShardIDs),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("MarkShardsStale ok",
+		logging.NodeID(req.NodeID),
+		zap.Uint64s("ShardIDs", req.ShardIDs))
+}
+
+type ClearStaleShardReq struct {
+	ShardID uint64
+	NodeID  uint64
+}
+type ClearStaleShardResp struct {
+	CommonResp
+}
+
+func (s *MetaService) ClearStaleShard(w http.ResponseWriter, r *http.Request) {
+	resp := new(ClearStaleShardResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("ClearStaleShard fail", zap.Error(err))
+		return
+	}
+
+	var req ClearStaleShardReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("ClearStaleShard fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.ClearStaleShard, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("ClearStaleShard fail",
+			logging.ShardID(req.ShardID),
+			logging.NodeID(req.NodeID),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("ClearStaleShard ok",
+		logging.ShardID(req.ShardID),
+		logging.NodeID(req.NodeID))
+}
+
+// CreateMeasurementTombstoneReq records a drop of measurement Name, Time is
+// of the proposer so that all meta servers apply the same.
+type CreateMeasurementTombstoneReq struct {
+	Database string
+	Name     string
+	Time     time.Time
+}
+type CreateMeasurementTombstoneResp struct {
+	CommonResp
+	Tombstone imeta.MeasurementTombstone
+}
+
+func (s *MetaService) CreateMeasurementTombstone(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateMeasurementTombstoneResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateMeasurementTombstone fail", zap.Error(err))
+		return
+	}
+
+	var req CreateMeasurementTombstoneReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateMeasurementTombstone fail", zap.Error(err))
+		return
+	}
+
+	t := &imeta.MeasurementTombstone{}
+	err = s.ProposeAndWait(internal.CreateMeasurementTombstone, data, t)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateMeasurementTombstone fail",
+			logging.Database(req.Database),
+			zap.String("Name", req.Name),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	resp.Tombstone = *t
+	s.Logger.Info("CreateMeasurementTombstone ok",
+		logging.Database(req.Database),
+		zap.String("Name", req.Name))
+}
+
+type MaintenanceWindowsResp struct {
+	CommonResp
+	Windows []imeta.MaintenanceWindow
+}
+
+func (s *MetaService) MaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	resp := new(MaintenanceWindowsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Windows = s.cli.MaintenanceWindows()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+// CreateMaintenanceWindowReq schedules Window, Time is of the proposer so
+// that all meta servers prune the same windows ended.
+type CreateMaintenanceWindowReq struct {
+	Window imeta.MaintenanceWindow
+	Time   time.Time
+}
+type CreateMaintenanceWindowResp struct {
+	CommonResp
+	Window imeta.MaintenanceWindow
+}
+
+func (s *MetaService) CreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateMaintenanceWindowResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateMaintenanceWindow fail", zap.Error(err))
+		return
+	}
+
+	var req CreateMaintenanceWindowReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateMaintenanceWindow fail", zap.Error(err))
+		return
+	}
+	req.Time = time.Now().UTC()
+	if req.Window.Start.IsZero() {
+		req.Window.Start = req.Time
+	}
+	data, _ = json.Marshal(&req)
+
+	window := &imeta.MaintenanceWindow{}
+	err = s.ProposeAndWait(internal.CreateMaintenanceWindow, data, window)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateMaintenanceWindow fail",
+			zap.Uint64s("Nodes", req.Window.Nodes),
+			zap.String("Behavior", req.Window.Behavior),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	resp.Window = *window
+	s.Logger.Info("CreateMaintenanceWindow ok",
+		zap.Uint64("ID", window.ID),
+		zap.Uint64s("Nodes", window.Nodes),
+		zap.Time("Start", window.Start),
+		zap.Duration("Duration", window.Duration),
+		zap.String("Behavior", window.Behavior))
+}
+
+type DeleteMaintenanceWindowReq struct {
+	ID uint64
+}
+type DeleteMaintenanceWindowResp struct {
+	CommonResp
+}
+
+func (s *MetaService) DeleteMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	resp := new(DeleteMaintenanceWindowResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DeleteMaintenanceWindow fail", zap.Error(err))
+		return
+	}
+
+	var req DeleteMaintenanceWindowReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DeleteMaintenanceWindow fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.DeleteMaintenanceWindow, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DeleteMaintenanceWindow fail", zap.Uint64("ID", req.ID), zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("DeleteMaintenanceWindow ok", zap.Uint64("ID", req.ID))
+}
+
+type SealedShardsResp struct {
+	CommonResp
+	Shards []imeta.SealedShard
+}
+
+func (s *MetaService) SealedShards(w http.ResponseWriter, r *http.Request) {
+	resp := new(SealedShardsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Shards = s.cli.SealedShards()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+// SealShardGroupsReq seals shard groups ended Grace before Time, Time is of
+// the proposer so that all meta servers seal the same.
+type SealShardGroupsReq struct {
+	Grace time.Duration
+	Time  time.Time
+}
+type SealShardGroupsResp struct {
+	CommonResp
+	Sealed int
+}
+
+func (s *MetaService) SealShardGroups(w http.ResponseWriter, r *http.Request) {
+	resp := new(SealShardGroupsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SealShardGroups fail", zap.Error(err))
+		return
+	}
+
+	var req SealShardGroupsReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SealShardGroups fail", zap.Error(err))
+		return
+	}
+
+	var sealed int
+	err = s.ProposeAndWait(internal.SealShardGroups, data, &sealed)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SealShardGroups fail", zap.Duration("Grace", req.Grace), zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	resp.Sealed = sealed
+	if sealed > 0 {
+		s.Logger.Info("SealShardGroups ok", zap.Duration("Grace", req.Grace), zap.Int("Sealed", sealed))
+	}
+}
+
+// SetSealedShardChecksumReq records the checksum of a sealed shard verified
+// across its owners at Time.
+type SetSealedShardChecksumReq struct {
+	ShardID  uint64
+	Checksum uint32
+	Diverged bool
+	Time     time.Time
+}
+type SetSealedShardChecksumResp struct {
+	CommonResp
+}
+
+func (s *MetaService) SetSealedShardChecksum(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetSealedShardChecksumResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetSealedShardChecksum fail", zap.Error(err))
+		return
+	}
+
+	var req SetSealedShardChecksumReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetSealedShardChecksum fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.SetSealedShardChecksum, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetSealedShardChecksum fail", logging.ShardID(req.ShardID), zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("SetSealedShardChecksum ok",
+		logging.ShardID(req.ShardID),
+		zap.Uint32("Checksum", req.Checksum),
+		zap.Bool("Diverged", req.Diverged))
+}
+
+// RegisterDataNodeReq registers a start of data node Id at Time, Time is of
+// the proposer so that all meta servers record the same.
+type RegisterDataNodeReq struct {
+	Id   uint64
+	Time time.Time
+}
+type RegisterDataNodeResp struct {
+	CommonResp
+	Incarnation uint64
+}
+
+func (s *MetaService) RegisterDataNode(w http.ResponseWriter, r *http.Request) {
+	resp := new(RegisterDataNodeResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("RegisterDataNode fail", zap.Error(err))
+		return
+	}
+
+	var req RegisterDataNodeReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("RegisterDataNode fail", zap.Error(err))
+		return
+	}
+
+	var incarnation uint64
+	err = s.ProposeAndWait(internal.RegisterDataNode, data, &incarnation)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("RegisterDataNode fail", zap.Uint64("ID", req.Id), zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	resp.Incarnation = incarnation
+	s.Logger.Info("RegisterDataNode ok", zap.Uint64("ID", req.Id), zap.Uint64("Incarnation", incarnation))
+}
+
+// AckMeasurementTombstoneReq marks tombstone ID applied by node NodeID, Time
+// is of the proposer so that all meta servers prune the same.
+type AckMeasurementTombstoneReq struct {
+	ID     uint64
+	NodeID uint64
+	Time   time.Time
+}
+type AckMeasurementTombstoneResp struct {
+	CommonResp
+}
+
+func (s *MetaService) AckMeasurementTombstone(w http.ResponseWriter, r *http.Request) {
+	resp := new(AckMeasurementTombstoneResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("AckMeasurementTombstone fail", zap.Error(err))
+		return
+	}
+
+	var req AckMeasurementTombstoneReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("AckMeasurementTombstone fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.AckMeasurementTombstone, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("AckMeasurementTombstone fail",
+			zap.Uint64("ID", req.ID),
+			logging.NodeID(req.NodeID),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("AckMeasurementTombstone ok",
+		zap.Uint64("ID", req.ID),
+		logging.NodeID(req.NodeID))
+}
+
+type AddShardOwnerReq struct {
+	ShardID uint64
+	NodeID  uint64
+}
+
+type AddShardOwnerResp struct {
+	CommonResp
+}
+
+func (s *MetaService) AddShardOwner(w http.ResponseWriter, r *http.Request) {
+	resp := new(AddShardOwnerResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("AddShardOwner fail", zap.Error(err))
+		return
+	}
+
+	var req AddShardOwnerReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("AddShardOwner fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.AddShardOwner, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("AddShardOwner fail",
+			logging.ShardID(req.ShardID),
+			logging.NodeID(req.NodeID),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Events.Publish(events.Event{Type: events.EventShardOwnerAdded, ShardID: req.ShardID, NodeID: req.NodeID})
+}
+
+type RemoveShardOwnerReq struct {
+	ShardID uint64
+	NodeID  uint64
+}
+
+type RemoveShardOwnerResp struct {
+	CommonResp
+}
+
+func (s *MetaService) RemoveShardOwner(w http.ResponseWriter, r *http.Request) {
+	resp := new(RemoveShardOwnerResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("RemoveShardOwner fail", zap.Error(err))
+		return
+	}
+
+	var req RemoveShardOwnerReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("RemoveShardOwner fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.RemoveShardOwner, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("RemoveShardOwner fail",
+			logging.ShardID(req.ShardID),
+			logging.NodeID(req.NodeID),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Events.Publish(events.Event{Type: events.EventShardOwnerRemoved, ShardID: req.ShardID, NodeID: req.NodeID})
+}
+
+type DropShardReq struct {
+	Id uint64
+}
+type DropShardResp struct {
+	CommonResp
+}
+
+func (s *MetaService) DropShard(w http.ResponseWriter, r *http.Request) {
+	resp := new(DropShardResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropShard fail", zap.Error(err))
+		return
+	}
+
+	var req DropShardReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropShard fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.DropShard, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropShard fail",
+			zap.Uint64("Id", req.Id),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("DropShard ok", zap.Uint64("Id", req.Id))
+	s.Events.Publish(events.Event{Type: events.EventShardDropped, ShardID: req.Id})
+}
+
+type TruncateShardGroupsReq struct {
+	Time time.Time
+}
+type TruncateShardGroupsResp struct {
+	CommonResp
+}
+
+func (s *MetaService) TruncateShardGroups(w http.ResponseWriter, r *http.Request) {
+	resp := new(TruncateShardGroupsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("TruncateShardGroups fail", zap.Error(err))
+		return
+	}
+
+	var req TruncateShardGroupsReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("TruncateShardGroups fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.TruncateShardGroups, data, nil)
+	if err != nil {
+		s.Logger.Error("TruncateShardGroups fail",
+			zap.Time("Time", req.Time),
+			zap.Error(err))
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("TruncateShardGroups ok", zap.Time("Time", req.Time))
+}
+
+// PruneShardGroupsReq prunes shard groups deleted before Expiration, the
+// default eviction horizon if zero.
+type PruneShardGroupsReq struct {
+	Expiration time.Time
+}
+
+type PruneShardGroupsResp struct {
+	CommonResp
+	// ShardGroups pruned
+	ShardGroups []imeta.AffectedShardGroup
+}
+
+func (s *MetaService) PruneShardGroups(w http.ResponseWriter, r *http.Request) {
+	resp := new(PruneShardGroupsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("PruneShardGroups fail", zap.Error(err))
+		return
+	}
+
+	// data nodes of older versions post an empty string for the default
+	req := &PruneShardGroupsReq{}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if err := json.Unmarshal(data, req); err != nil {
+			resp.RetMsg = err.Error()
+			s.Logger.Error("PruneShardGroups fail", zap.Error(err))
+			return
+		}
+	}
+	if req.Expiration.IsZero() {
+		req.Expiration = time.Now().Add(imeta.SHARDGROUP_INFO_EVICTION)
+	}
+	data, _ = json.Marshal(req)
+	var groups []imeta.AffectedShardGroup
+	err = s.ProposeAndWait(internal.PruneShardGroups, data, &groups)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("PruneShardGroups fail", zap.Time("Expiration", req.Expiration), zap.Error(err))
+		return
+	}
+
+	resp.ShardGroups = groups
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("PruneShardGroups ok", zap.Time("Expiration", req.Expiration), zap.Int("Pruned", len(groups)))
+}
+
+type ArchivedShardGroupsResp struct {
+	CommonResp
+	ShardGroups []imeta.ArchivedShardGroup
+}
+
+func (s *MetaService) ArchivedShardGroups(w http.ResponseWriter, r *http.Request) {
+	resp := new(ArchivedShardGroupsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	groups, err := s.cli.ArchivedShardGroups(r.URL.Query().Get("db"), r.URL.Query().Get("rp"))
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("ArchivedShardGroups fail", zap.Error(err))
+		return
+	}
+	resp.ShardGroups = groups
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type PreviewShardOwnersResp struct {
+	CommonResp
+	Shards []meta.ShardInfo
+}
+
+// PreviewShardOwners returns owners of shards of the group for time in
+// RFC3339, now if not given, as if created without creating it.
+func (s *MetaService) PreviewShardOwners(w http.ResponseWriter, r *http.Request) {
+	resp := new(PreviewShardOwnersResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	timestamp := time.Now()
+	if v := r.URL.Query().Get("time"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			resp.RetMsg = err.Error()
+			return
+		}
+		timestamp = t
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	shards, err := s.cli.PreviewShardOwners(r.URL.Query().Get("db"), r.URL.Query().Get("rp"), timestamp)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("PreviewShardOwners fail", zap.Error(err))
+		return
+	}
+	resp.Shards = shards
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+//DeleteShardGroup
+type DeleteShardGroupReq struct {
+	Database string
+	Policy   string
+	Id       uint64
+	Now      time.Time
+}
+type DeleteShardGroupResp struct {
+	CommonResp
+}
+
+func (s *MetaService) DeleteShardGroup(w http.ResponseWriter, r *http.Request) {
+	resp := new(DeleteShardGroupResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DeleteShardGroup fail", zap.Error(err))
+		return
+	}
+
+	var req DeleteShardGroupReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DeleteShardGroup fail", zap.Error(err))
+		return
+	}
+	req.Now = time.Now()
+
+	err = s.ProposeAndWait(internal.DeleteShardGroup, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DeleteShardGroup fail",
+			logging.Database(req.Database),
+			zap.String("Policy", req.Policy),
+			zap.Uint64("Id", req.Id),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("DeleteShardGroup ok",
+		logging.Database(req.Database),
+		zap.String("Policy", req.Policy),
+		zap.Uint64("Id", req.Id))
+}
+
+//PrecreateShardGroups
+type PrecreateShardGroupsReq struct {
+	From time.Time
+	To   time.Time
+}
+type PrecreateShardGroupsResp struct {
+	CommonResp
+	// ShardGroups created
+	ShardGroups []imeta.AffectedShardGroup
+}
+
+func (s *MetaService) PrecreateShardGroups(w http.ResponseWriter, r *http.Request) {
+	resp := new(PrecreateShardGroupsResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("PrecreateShardGroups fail", zap.Error(err))
+		return
+	}
+
+	var req PrecreateShardGroupsReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("PrecreateShardGroups fail", zap.Error(err))
+		return
+	}
+	if s.cli.ShardGroupsFrozen(time.Now()) {
+		resp.RetMsg = imeta.ErrShardGroupsFrozen.Error()
+		return
+	}
+
+	var groups []imeta.AffectedShardGroup
+	err = s.ProposeAndWait(internal.PrecreateShardGroups, data, &groups)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("PrecreateShardGroups fail",
+			zap.Time("From", req.From),
+			zap.Time("To", req.To),
+			zap.Error(err))
+		return
+	}
+
+	resp.ShardGroups = groups
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("PrecreateShardGroups ok",
+		zap.Time("From", req.From),
+		zap.Time("To", req.To),
+		zap.Int("Created", len(groups)))
+}
+
+//CreateContinuousQuery
+type CreateContinuousQueryReq struct {
+	Database string
+	Name     string
+	Query    string
+}
+type CreateContinuousQueryResp struct {
+	CommonResp
+}
+
+func (s *MetaService) CreateContinuousQuery(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateContinuousQueryResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateContinuousQuery fail", zap.Error(err))
+		return
+	}
+
+	var req CreateContinuousQueryReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateContinuousQuery fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.CreateContinuousQuery, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateContinuousQuery fail",
+			logging.Database(req.Database),
+			zap.String("Name", req.Name),
+			zap.String("Query", req.Query),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("CreateContinuousQuery ok",
+		logging.Database(req.Database),
+		zap.String("Name", req.Name),
+		zap.String("Query", req.Query))
+}
+
+//DropContinuousQuery
+type DropContinuousQueryReq struct {
+	Database string
+	Name     string
+}
+type DropContinuousQueryResp struct {
+	CommonResp
+}
+
+func (s *MetaService) DropContinuousQuery(w http.ResponseWriter, r *http.Request) {
+	resp := new(DropContinuousQueryResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropContinuousQuery fail", zap.Error(err))
+		return
+	}
+
+	var req DropContinuousQueryReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropContinuousQuery fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.DropContinuousQuery, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropContinuousQuery fail",
+			logging.Database(req.Database),
+			zap.String("Name", req.Name),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("DropContinuousQuery ok",
+		logging.Database(req.Database),
+		zap.String("Name", req.Name))
+}
+
+//CreateSubscription
+type CreateSubscriptionReq struct {
+	Database     string
+	Rp           string
+	Name         string
+	Mode         string
+	Destinations []string
+}
+type CreateSubscriptionResp struct {
+	CommonResp
+}
+
+func (s *MetaService) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateSubscriptionResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateSubscriptionReq fail", zap.Error(err))
+		return
+	}
+
+	var req CreateSubscriptionReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateSubscriptionReq fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.CreateSubscription, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateSubscriptionReq fail",
+			logging.Database(req.Database),
+			logging.RetentionPolicy(req.Rp),
+			zap.String("Name", req.Name),
+			zap.String("Mode", req.Mode),
+			zap.Strings("Destinations", req.Destinations),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("CreateSubscriptionReq ok",
+		logging.Database(req.Database),
+		logging.RetentionPolicy(req.Rp),
+		zap.String("Name", req.Name),
+		zap.String("Mode", req.Mode),
+		zap.Strings("Destinations", req.Destinations))
+}
+
+//DropSubscription
+type DropSubscriptionReq struct {
+	Database string
+	Rp       string
+	Name     string
+}
+type DropSubscriptionResp struct {
+	CommonResp
+}
+
+func (s *MetaService) DropSubscription(w http.ResponseWriter, r *http.Request) {
+	resp := new(DropSubscriptionResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropSubscription fail", zap.Error(err))
+		return
+	}
+
+	var req DropSubscriptionReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropSubscription fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.DropSubscription, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropSubscription fail",
+			logging.Database(req.Database),
+			logging.RetentionPolicy(req.Rp),
+			zap.String("Name", req.Name),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("DropSubscription ok",
+		logging.Database(req.Database),
+		logging.RetentionPolicy(req.Rp),
+		zap.String("Name", req.Name))
+}
+
+type AcquireLeaseReq struct {
+	Name        string
+	NodeId      uint64
+	RequestTime int64 // timestamp in millis
+}
+
+type AcquireLeaseResp struct {
+	CommonResp
+	Lease meta.Lease
+}
+
+func (s *MetaService) AcquireLease(w http.ResponseWriter, r *http.Request) {
+	resp := new(AcquireLeaseResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("AcquireLease fail", zap.Error(err))
+		return
+	}
+
+	var req AcquireLeaseReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("AcquireLease fail", zap.Error(err))
+		return
+	}
+
+	// do pre-check before proposing
+	if !s.Node.ShouldTryAcquireLease(req.Name, req.NodeId) {
+		resp.RetMsg = ErrAcquiredByOther.Error()
+		return
+	}
+
+	req.RequestTime = time.Now().UnixNano() / 1e6
+	data, _ = json.Marshal(&req)
+
+	lease := &meta.Lease{}
+	err = s.ProposeAndWait(internal.AcquireLease, data, lease)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		if !strings.Contains(err.Error(), "another node has the lease") {
+			s.Logger.Error(
+				fmt.Sprintf(
+					"AcquireLease fail, name=%s, node=%d",
+					req.Name, req.NodeId,
+				),
+				zap.Error(err),
+			)
+		}
+		return
+	}
+
+	resp.Lease = *lease
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Debug("AcquireLease ok",
+		zap.String("Name", req.Name),
+		logging.NodeID(req.NodeId),
+	)
+}
+
+type DataResp struct {
+	CommonResp
+	Data []byte
+}
+
+func (s *MetaService) Data(w http.ResponseWriter, r *http.Request) {
+	resp := new(DataResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := s.Linearizabler.ReadNotify(ctx)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	data := s.cli.Data()
+	resp.Data, err = data.MarshalBinary()
+	if err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+// DataAt returns meta data of this meta node as it was at index, kept for
+// the latest data-history-size versions.
+func (s *MetaService) DataAt(w http.ResponseWriter, r *http.Request) {
+	resp := new(DataResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	index, err := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+	data, err := s.cli.DataAt(index)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+	resp.Data, err = data.MarshalBinary()
+	if err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type FreezeDataNodeReq struct {
+	Id     uint64
+	Freeze bool
+}
+type FreezeDataNodeResp struct {
+	CommonResp
+}
+
+func (s *MetaService) FreezeDataNode(w http.ResponseWriter, r *http.Request) {
+	resp := new(FreezeDataNodeResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("FreezeDataNode fail", zap.Error(err))
+		return
+	}
+
+	var req FreezeDataNodeReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("FreezeDataNode fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.FreezeDataNode, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error(fmt.Sprintf("FreezeDataNode fail, id=%d, freeze=%t", req.Id, req.Freeze), zap.Error(err))
+		return
+	}
+
+	if req.Freeze {
+		// new writes avoid the node at once, data written before moves with
+		// its shards
+		reassign, _ := json.Marshal(&ReassignShardGroupsReq{Id: req.Id, Time: time.Now().UTC()})
+		if err := s.ProposeAndWait(internal.ReassignShardGroups, reassign, nil); err != nil {
+			resp.RetMsg = fmt.Sprintf("node freezed but reassigning its shard groups failed: %s", err)
+			s.Logger.Error(fmt.Sprintf("ReassignShardGroups fail, id=%d", req.Id), zap.Error(err))
+			return
+		}
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info(fmt.Sprintf("FreezeDataNode ok, id=%d, freeze=%t", req.Id, req.Freeze))
+	typ := events.EventNodeFrozen
+	if !req.Freeze {
+		typ = events.EventNodeUnfrozen
+	}
+	s.Events.Publish(events.Event{Type: typ, NodeID: req.Id})
+}
+
+// ReassignShardGroupsReq is proposed along with freezing a node, with the time
+// its shard groups are truncated at.
+type ReassignShardGroupsReq struct {
+	Id   uint64
+	Time time.Time
+}
+
+type DefaultRetentionPolicyResp struct {
+	CommonResp
+	Template *imeta.RetentionPolicyTemplate
+}
+
+func (s *MetaService) DefaultRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	resp := new(DefaultRetentionPolicyResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Template = s.cli.DefaultRetentionPolicy()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+// SetDefaultRetentionPolicyReq sets the template, nil Template restores the builtin default
+type SetDefaultRetentionPolicyReq struct {
+	Template *imeta.RetentionPolicyTemplate
+}
+type SetDefaultRetentionPolicyResp struct {
+	CommonResp
+}
+
+func (s *MetaService) SetDefaultRetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetDefaultRetentionPolicyResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetDefaultRetentionPolicy fail", zap.Error(err))
+		return
+	}
+
+	var req SetDefaultRetentionPolicyReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetDefaultRetentionPolicy fail", zap.Error(err))
+		return
+	}
+	// reject invalid template before proposing
+	if req.Template != nil {
+		if err := req.Template.Validate(); err != nil {
+			resp.RetMsg = err.Error()
+			return
+		}
+	}
+
+	err = s.ProposeAndWait(internal.SetDefaultRetentionPolicy, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetDefaultRetentionPolicy fail", zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info(fmt.Sprintf("SetDefaultRetentionPolicy ok, template=%+v", req.Template))
+}
+
+type DatabaseTemplatesResp struct {
+	CommonResp
+	Templates []imeta.DatabaseTemplate
+}
+
+func (s *MetaService) DatabaseTemplates(w http.ResponseWriter, r *http.Request) {
+	resp := new(DatabaseTemplatesResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	resp.Templates = s.cli.DatabaseTemplates()
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type CreateDatabaseTemplateReq struct {
+	Template imeta.DatabaseTemplate
+}
+type CreateDatabaseTemplateResp struct {
+	CommonResp
+}
+
+func (s *MetaService) CreateDatabaseTemplate(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateDatabaseTemplateResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateDatabaseTemplate fail", zap.Error(err))
+		return
+	}
+
+	var req CreateDatabaseTemplateReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateDatabaseTemplate fail", zap.Error(err))
+		return
+	}
+	if err := req.Template.Validate(); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	err = s.ProposeAndWait(internal.CreateDatabaseTemplate, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateDatabaseTemplate fail", zap.String("name", req.Template.Name), zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("CreateDatabaseTemplate ok", zap.String("name", req.Template.Name))
+}
+
+type DropDatabaseTemplateReq struct {
+	Name string
+}
+type DropDatabaseTemplateResp struct {
+	CommonResp
+}
+
+func (s *MetaService) DropDatabaseTemplate(w http.ResponseWriter, r *http.Request) {
+	resp := new(DropDatabaseTemplateResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropDatabaseTemplate fail", zap.Error(err))
+		return
+	}
+
+	var req DropDatabaseTemplateReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropDatabaseTemplate fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.DropDatabaseTemplate, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("DropDatabaseTemplate fail", zap.String("name", req.Name), zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("DropDatabaseTemplate ok", zap.String("name", req.Name))
+}
+
+type CreateDatabaseFromTemplateReq struct {
+	Name     string
+	Template string
+}
+type CreateDatabaseFromTemplateResp struct {
+	CommonResp
+	DbInfo meta.DatabaseInfo
+}
+
+func (s *MetaService) CreateDatabaseFromTemplate(w http.ResponseWriter, r *http.Request) {
+	resp := new(CreateDatabaseFromTemplateResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateDatabaseFromTemplate fail", zap.Error(err))
+		return
+	}
+
+	var req CreateDatabaseFromTemplateReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateDatabaseFromTemplate fail", zap.Error(err))
+		return
+	}
+
+	db := &meta.DatabaseInfo{}
+	err = s.ProposeAndWait(internal.CreateDatabaseFromTemplate, data, db)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("CreateDatabaseFromTemplate fail",
+			zap.String("name", req.Name),
+			zap.String("template", req.Template),
+			zap.Error(err))
+		return
+	}
+
+	resp.DbInfo = *db
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("CreateDatabaseFromTemplate ok", zap.String("name", req.Name), zap.String("template", req.Template))
+}
+
+type MeasurementPrivilegesResp struct {
+	CommonResp
+	// Privileges of user keyed by database
+	Privileges map[string][]imeta.MeasurementPrivilege
+}
+
+func (s *MetaService) MeasurementPrivileges(w http.ResponseWriter, r *http.Request) {
+	resp := new(MeasurementPrivilegesResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	user := r.URL.Query().Get("user")
+	data := s.cli.Data()
+	resp.Privileges = make(map[string][]imeta.MeasurementPrivilege)
+	for db := range data.MeasurementPrivileges[user] {
+		resp.Privileges[db] = data.UserMeasurementPrivileges(user, db)
+	}
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type SetMeasurementPrivilegeReq struct {
+	UserName  string
+	Database  string
+	Pattern   string
+	Privilege influxql.Privilege
+}
+type SetMeasurementPrivilegeResp struct {
+	CommonResp
+}
+
+func (s *MetaService) SetMeasurementPrivilege(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetMeasurementPrivilegeResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetMeasurementPrivilege fail", zap.Error(err))
+		return
+	}
+
+	var req SetMeasurementPrivilegeReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetMeasurementPrivilege fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.SetMeasurementPrivilege, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetMeasurementPrivilege fail",
+			zap.String("UserName", req.UserName),
+			logging.Database(req.Database),
+			zap.String("Pattern", req.Pattern),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("SetMeasurementPrivilege ok",
+		zap.String("UserName", req.UserName),
+		logging.Database(req.Database),
+		zap.String("Pattern", req.Pattern),
+		zap.Stringer("Privilege", req.Privilege))
+}
+
+type OperatorRolesResp struct {
+	CommonResp
+	// Roles keyed by user, of user only if requested
+	Roles map[string]imeta.OperatorRole
+}
+
+func (s *MetaService) OperatorRoles(w http.ResponseWriter, r *http.Request) {
+	resp := new(OperatorRolesResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Linearizabler.ReadNotify(ctx); err != nil {
+		resp.RetMsg = err.Error()
+		return
+	}
+
+	user := r.URL.Query().Get("user")
+	data := s.cli.Data()
+	resp.Roles = make(map[string]imeta.OperatorRole)
+	for name, role := range data.OperatorRoles {
+		if user == "" || user == name {
+			resp.Roles[name] = role
+		}
+	}
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
+type SetOperatorRoleReq struct {
+	UserName string
+	Role     imeta.OperatorRole
+}
+type SetOperatorRoleResp struct {
+	CommonResp
+}
+
+func (s *MetaService) SetOperatorRole(w http.ResponseWriter, r *http.Request) {
+	resp := new(SetOperatorRoleResp)
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	defer WriteResp(w, &resp)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetOperatorRole fail", zap.Error(err))
+		return
+	}
+
+	var req SetOperatorRoleReq
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetOperatorRole fail", zap.Error(err))
+		return
+	}
+
+	err = s.ProposeAndWait(internal.SetOperatorRole, data, nil)
+	if err != nil {
+		resp.RetMsg = err.Error()
+		s.Logger.Error("SetOperatorRole fail",
+			zap.String("UserName", req.UserName),
+			zap.String("Role", string(req.Role)),
+			zap.Error(err))
+		return
+	}
+
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+	s.Logger.Info("SetOperatorRole ok",
+		zap.String("UserName", req.UserName),
+		zap.String("Role", string(req.Role)))
 }
 
 type PingResp struct {
 	CommonResp
 	Index uint64
+	// Time of the meta server in nanoseconds, data nodes tell their clock
+	// skew by it
+	Time int64
 }
 
 func (s *MetaService) Ping(w http.ResponseWriter, r *http.Request) {
 	resp := new(PingResp)
 	resp.Index = s.cli.DataIndex()
+	resp.Time = time.Now().UnixNano()
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
 	WriteResp(w, &resp)
@@ -1496,6 +3707,7 @@ func WriteResp(w http.ResponseWriter, v interface{}) error {
 
 func initHttpHandler(s *MetaService) {
 	http.HandleFunc(DATA_PATH, s.Data)
+	http.HandleFunc(DATA_AT_PATH, s.DataAt)
 	http.HandleFunc(CREATE_DATABASE_PATH, s.CreateDatabase)
 	http.HandleFunc(DROP_DATABASE_PATH, s.DropDatabase)
 	http.HandleFunc(CREATE_SHARD_GROUP_PATH, s.CreateShardGroup)
@@ -1504,6 +3716,56 @@ func initHttpHandler(s *MetaService) {
 	http.HandleFunc(DROP_RETENTION_POLICY_PATH, s.DropRetentionPolicy)
 	http.HandleFunc(DELETE_DATA_NODE_PATH, s.DeleteDataNode)
 	http.HandleFunc(FREEZE_DATA_NODE_PATH, s.FreezeDataNode)
+	http.HandleFunc(DEFAULT_RETENTION_POLICY_PATH, s.DefaultRetentionPolicy)
+	http.HandleFunc(SET_DEFAULT_RETENTION_POLICY_PATH, s.SetDefaultRetentionPolicy)
+	http.HandleFunc(DATABASE_TEMPLATES_PATH, s.DatabaseTemplates)
+	http.HandleFunc(CREATE_DATABASE_TEMPLATE_PATH, s.CreateDatabaseTemplate)
+	http.HandleFunc(DROP_DATABASE_TEMPLATE_PATH, s.DropDatabaseTemplate)
+	http.HandleFunc(CREATE_DATABASE_FROM_TEMPLATE_PATH, s.CreateDatabaseFromTemplate)
+	http.HandleFunc(MEASUREMENT_PRIVILEGES_PATH, s.MeasurementPrivileges)
+	http.HandleFunc(SET_MEASUREMENT_PRIVILEGE_PATH, s.SetMeasurementPrivilege)
+	http.HandleFunc(LOCKED_USERS_PATH, s.LockedUsers)
+	http.HandleFunc(UNLOCK_USER_PATH, s.UnlockUser)
+	http.HandleFunc(API_TOKENS_PATH, s.APITokens)
+	http.HandleFunc(CREATE_API_TOKEN_PATH, s.CreateAPIToken)
+	http.HandleFunc(DROP_API_TOKEN_PATH, s.DropAPIToken)
+	http.HandleFunc(CREATE_SESSION_PATH, s.CreateSession)
+	http.HandleFunc(DROP_SESSION_PATH, s.DropSession)
+	http.HandleFunc(BUCKET_MAPPINGS_PATH, s.BucketMappings)
+	http.HandleFunc(SET_BUCKET_MAPPING_PATH, s.SetBucketMapping)
+	http.HandleFunc(DROP_BUCKET_MAPPING_PATH, s.DropBucketMapping)
+	http.HandleFunc(ARCHIVED_SHARD_GROUPS_PATH, s.ArchivedShardGroups)
+	http.HandleFunc(CLUSTER_CONFIG_PATH, s.ClusterConfig)
+	http.HandleFunc(SET_CLUSTER_CONFIG_PATH, s.SetClusterConfig)
+	http.HandleFunc(DELETE_CLUSTER_CONFIG_PATH, s.DeleteClusterConfig)
+	http.HandleFunc(HINTED_HANDOFF_POLICIES_PATH, s.HintedHandoffPolicies)
+	http.HandleFunc(SET_HINTED_HANDOFF_POLICY_PATH, s.SetHintedHandoffPolicy)
+	http.HandleFunc(DELETE_HINTED_HANDOFF_POLICY_PATH, s.DeleteHintedHandoffPolicy)
+	http.HandleFunc(SHARD_GROUP_ALIGNMENTS_PATH, s.ShardGroupAlignments)
+	http.HandleFunc(SET_SHARD_GROUP_ALIGNMENT_PATH, s.SetShardGroupAlignment)
+	http.HandleFunc(EXPORT_USERS_PATH, s.ExportUsers)
+	http.HandleFunc(IMPORT_USERS_PATH, s.ImportUsers)
+	http.HandleFunc(FREEZE_SHARD_GROUPS_PATH, s.FreezeShardGroups)
+	http.HandleFunc(THAW_SHARD_GROUPS_PATH, s.ThawShardGroups)
+	http.HandleFunc(READ_ONLY_SHARDS_PATH, s.ReadOnlyShards)
+	http.HandleFunc(SET_SHARD_READ_ONLY_PATH, s.SetShardReadOnly)
+	http.HandleFunc(BEGIN_SHARD_CUTOVER_PATH, s.BeginShardCutover)
+	http.HandleFunc(END_SHARD_CUTOVER_PATH, s.EndShardCutover)
+	http.HandleFunc(MARK_SHARDS_STALE_PATH, s.MarkShardsStale)
+	http.HandleFunc(CLEAR_STALE_SHARD_PATH, s.ClearStaleShard)
+	http.HandleFunc(CREATE_MEASUREMENT_TOMBSTONE_PATH, s.CreateMeasurementTombstone)
+	http.HandleFunc(ACK_MEASUREMENT_TOMBSTONE_PATH, s.AckMeasurementTombstone)
+	http.HandleFunc(MAINTENANCE_WINDOWS_PATH, s.MaintenanceWindows)
+	http.HandleFunc(CREATE_MAINTENANCE_WINDOW_PATH, s.CreateMaintenanceWindow)
+	http.HandleFunc(DELETE_MAINTENANCE_WINDOW_PATH, s.DeleteMaintenanceWindow)
+	http.HandleFunc(SEALED_SHARDS_PATH, s.SealedShards)
+	http.HandleFunc(SEAL_SHARD_GROUPS_PATH, s.SealShardGroups)
+	http.HandleFunc(SET_SEALED_SHARD_CHECKSUM_PATH, s.SetSealedShardChecksum)
+	http.HandleFunc(REGISTER_DATA_NODE_PATH, s.RegisterDataNode)
+	http.HandleFunc(OPERATOR_ROLES_PATH, s.OperatorRoles)
+	http.HandleFunc(SET_OPERATOR_ROLE_PATH, s.SetOperatorRole)
+	http.HandleFunc(CREATE_SHARD_GROUPS_FOR_RANGE_PATH, s.CreateShardGroupsForRange)
+	http.HandleFunc(PREVIEW_SHARD_OWNERS_PATH, s.PreviewShardOwners)
 	http.HandleFunc(CREATE_RETENTION_POLICY_PATH, s.CreateRetentionPolicy)
 	http.HandleFunc(UPDATE_RETENTION_POLICY_PATH, s.UpdateRetentionPolicy)
 	http.HandleFunc(CREATE_USER_PATH, s.CreateUser)
@@ -1526,4 +3788,5 @@ func initHttpHandler(s *MetaService) {
 	http.HandleFunc(DROP_SUBSCRIPTION_PATH, s.DropSubscription)
 	http.HandleFunc(ACQUIRE_LEASE_PATH, s.AcquireLease)
 	http.HandleFunc(PING_PATH, s.Ping)
+	http.Handle(LOG_LEVEL_PATH, logging.DefaultLevels())
 }
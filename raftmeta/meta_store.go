@@ -12,11 +12,13 @@ type MetaStore interface {
 	MarshalBinary() ([]byte, error)
 	ReplaceData(data *imeta.Data) error
 	Data() imeta.Data
+	DataAt(index uint64) (*imeta.Data, error)
 	CreateContinuousQuery(database, name, query string) error
 	CreateDatabase(name string) (*meta.DatabaseInfo, error)
 	CreateDatabaseWithRetentionPolicy(name string, spec *meta.RetentionPolicySpec) (*meta.DatabaseInfo, error)
 	CreateRetentionPolicy(database string, spec *meta.RetentionPolicySpec, makeDefault bool) (*meta.RetentionPolicyInfo, error)
 	CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error)
+	CreateShardGroupsForRange(database, policy string, start, end time.Time) ([]meta.ShardGroupInfo, error)
 	CreateSubscription(database, rp, name, mode string, destinations []string) error
 	CreateUser(name, hashedPassword string, admin bool) (meta.User, error)
 	CreateDataNode(httpAddr, tcpAddr string) (*meta.NodeInfo, error)
@@ -24,13 +26,58 @@ type MetaStore interface {
 	IsDataNodeFreezed(id uint64) bool
 	FreezeDataNode(id uint64) error
 	UnfreezeDataNode(id uint64) error
+	ReassignShardGroups(id uint64, t time.Time) error
+	DefaultRetentionPolicy() *imeta.RetentionPolicyTemplate
+	SetDefaultRetentionPolicy(t *imeta.RetentionPolicyTemplate) error
+	DatabaseTemplates() []imeta.DatabaseTemplate
+	CreateDatabaseTemplate(t *imeta.DatabaseTemplate) error
+	DropDatabaseTemplate(name string) error
+	CreateDatabaseFromTemplate(name, template string) (*meta.DatabaseInfo, error)
 	Authenticate(username, password string) (meta.User, error)
-	PruneShardGroups(expiration time.Time) error
+	LockUser(name string, until, now time.Time) error
+	UnlockUser(name string) error
+	CreateAPIToken(username, hash, description string, createdAt time.Time) (*imeta.APIToken, error)
+	DropAPIToken(id uint64) error
+	CreateSession(username, hash string, now, expiration time.Time) error
+	DropSession(hash string) error
+	SessionsExpired(now time.Time) bool
+	PruneSessions(now time.Time) error
+	SetBucketMapping(m *imeta.BucketMapping) error
+	DropBucketMapping(org, bucket string) error
+	ClusterConfig() imeta.ClusterConfig
+	SetClusterConfig(key, value string) error
+	DeleteClusterConfig(key string) error
+	HintedHandoffPolicies() []imeta.HintedHandoffPolicy
+	SetHintedHandoffPolicy(p *imeta.HintedHandoffPolicy) error
+	DeleteHintedHandoffPolicy(database, rp string) error
+	ShardGroupAlignments() []imeta.ShardGroupAlignment
+	SetShardGroupAlignment(database, rp, unit string) error
+	ExportUsers() *imeta.UserExport
+	ImportUsers(doc *imeta.UserExport) error
+	ShardGroupsFrozen(now time.Time) bool
+	FreezeShardGroups(id string, until time.Time) error
+	ThawShardGroups(id string) error
+	ReadOnlyShards() []uint64
+	SetShardReadOnly(id uint64, readOnly bool) error
+	BeginShardCutover(id, nodeID uint64, expiration time.Time) error
+	EndShardCutover(id uint64) error
+	MarkShardsStale(nodeID uint64, ids []uint64, now time.Time) error
+	ClearStaleShard(id, nodeID uint64) error
+	CreateMeasurementTombstone(database, name string, now time.Time) (*imeta.MeasurementTombstone, error)
+	AckMeasurementTombstone(id, nodeID uint64, now time.Time) error
+	MaintenanceWindows() []imeta.MaintenanceWindow
+	CreateMaintenanceWindow(w imeta.MaintenanceWindow, now time.Time) (*imeta.MaintenanceWindow, error)
+	DeleteMaintenanceWindow(id uint64) error
+	SealedShards() []imeta.SealedShard
+	SealShardGroups(grace time.Duration, now time.Time) (int, error)
+	SetSealedShardChecksum(id uint64, checksum uint32, diverged bool, now time.Time) error
+	RegisterDataNode(id uint64, now time.Time) (uint64, error)
+	PruneShardGroupsAffected(expiration time.Time) ([]imeta.AffectedShardGroup, error)
 	DeleteShardGroup(database, policy string, id uint64, t time.Time) error
-	PrecreateShardGroups(from, to time.Time) error
+	PrecreateShardGroupsAffected(from, to time.Time) ([]imeta.AffectedShardGroup, error)
 
-	AddShardOwner(shardID, nodeID uint64) error
-	RemoveShardOwner(shardID, nodeID uint64) error
+	AddShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error
+	RemoveShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error
 	DropShard(id uint64) error
 	DropContinuousQuery(database, name string) error
 	DropDatabase(name string) error
@@ -39,6 +86,8 @@ type MetaStore interface {
 	DropUser(name string) error
 	SetAdminPrivilege(username string, admin bool) error
 	SetPrivilege(username, database string, p influxql.Privilege) error
+	SetMeasurementPrivilege(username, database, pattern string, p influxql.Privilege) error
+	SetOperatorRole(username string, role imeta.OperatorRole) error
 	TruncateShardGroups(t time.Time) error
 	UpdateRetentionPolicy(database, name string, rpu *meta.RetentionPolicyUpdate, makeDefault bool) error
 	UpdateUser(name, hashedPassword string) error
@@ -143,6 +143,8 @@ type RaftNode struct {
 	//用于存储raft日志和snapshot
 	Storage  *raftwal.DiskStorage
 	walStore *badger.DB
+	//加密snapshot中的meta数据, nil表示不加密
+	snapCipher *SnapshotCipher
 
 	//节点之间的通信模块
 	Transport interface {
@@ -217,6 +219,9 @@ func NewRaftNode(config Config, logger *zap.Logger) *RaftNode {
 		ID:   c.ID,
 	}
 
+	snapCipher, err := LoadSnapshotCipher(config)
+	x.Checkf(err, "Error while loading snapshot key")
+
 	//storage := raft.NewMemoryStorage()
 	storage := raftwal.Init(walStore, c.ID, 0)
 	c.Storage = storage
@@ -231,6 +236,7 @@ func NewRaftNode(config Config, logger *zap.Logger) *RaftNode {
 		RaftCtx:       rc,
 		Storage:       storage,
 		walStore:      walStore,
+		snapCipher:    snapCipher,
 		Done:          make(chan struct{}),
 		props:         newProposals(),
 		rand:          rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())}),
@@ -369,8 +375,11 @@ func (s *RaftNode) restoreFromSnapshot() bool {
 
 	s.Transport.SetPeers(sndata.PeersAddr)
 
+	md, err := s.snapCipher.Open(sndata.Data)
+	x.Checkf(err, "meta data decrypt fail")
+
 	metaData := &imeta.Data{}
-	err = metaData.UnmarshalBinary(sndata.Data)
+	err = metaData.UnmarshalBinary(md)
 	x.Checkf(err, "meta data UnmarshalBinary fail")
 
 	err = s.MetaStore.ReplaceData(metaData)
@@ -27,8 +27,61 @@ const (
 	CREATE_SUBSCRIPTION_PATH                   = "/create_subscription"
 	DROP_SUBSCRIPTION_PATH                     = "/drop_subscription"
 	DATA_PATH                                  = "/data"
+	DATA_AT_PATH                               = "/data_at"
 	PING_PATH                                  = "/ping"
 	ACQUIRE_LEASE_PATH                         = "/acquire_lease"
 	ADD_SHARD_OWNER                            = "/add_shard_owner"
 	REMOVE_SHARD_OWNER                         = "/remove_shard_owner"
+	DEFAULT_RETENTION_POLICY_PATH              = "/default_retention_policy"
+	SET_DEFAULT_RETENTION_POLICY_PATH          = "/set_default_retention_policy"
+	DATABASE_TEMPLATES_PATH                    = "/database_templates"
+	CREATE_DATABASE_TEMPLATE_PATH              = "/create_database_template"
+	DROP_DATABASE_TEMPLATE_PATH                = "/drop_database_template"
+	CREATE_DATABASE_FROM_TEMPLATE_PATH         = "/create_database_from_template"
+	MEASUREMENT_PRIVILEGES_PATH                = "/measurement_privileges"
+	SET_MEASUREMENT_PRIVILEGE_PATH             = "/set_measurement_privilege"
+	LOCKED_USERS_PATH                          = "/locked_users"
+	EXPORT_USERS_PATH                          = "/export_users"
+	IMPORT_USERS_PATH                          = "/import_users"
+	UNLOCK_USER_PATH                           = "/unlock_user"
+	API_TOKENS_PATH                            = "/api_tokens"
+	CREATE_API_TOKEN_PATH                      = "/create_api_token"
+	DROP_API_TOKEN_PATH                        = "/drop_api_token"
+	CREATE_SESSION_PATH                        = "/create_session"
+	DROP_SESSION_PATH                          = "/drop_session"
+	BUCKET_MAPPINGS_PATH                       = "/bucket_mappings"
+	SET_BUCKET_MAPPING_PATH                    = "/set_bucket_mapping"
+	DROP_BUCKET_MAPPING_PATH                   = "/drop_bucket_mapping"
+	ARCHIVED_SHARD_GROUPS_PATH                 = "/archived_shard_groups"
+	CLUSTER_CONFIG_PATH                        = "/cluster_config"
+	SET_CLUSTER_CONFIG_PATH                    = "/set_cluster_config"
+	DELETE_CLUSTER_CONFIG_PATH                 = "/delete_cluster_config"
+	HINTED_HANDOFF_POLICIES_PATH               = "/hinted_handoff_policies"
+	SET_HINTED_HANDOFF_POLICY_PATH             = "/set_hinted_handoff_policy"
+	DELETE_HINTED_HANDOFF_POLICY_PATH          = "/delete_hinted_handoff_policy"
+	SHARD_GROUP_ALIGNMENTS_PATH                = "/shard_group_alignments"
+	SET_SHARD_GROUP_ALIGNMENT_PATH             = "/set_shard_group_alignment"
+	CREATE_SHARD_GROUPS_FOR_RANGE_PATH         = "/create_shard_groups_for_range"
+	PREVIEW_SHARD_OWNERS_PATH                  = "/preview_shard_owners"
+	READ_ONLY_SHARDS_PATH                      = "/read_only_shards"
+	SET_SHARD_READ_ONLY_PATH                   = "/set_shard_read_only"
+	BEGIN_SHARD_CUTOVER_PATH                   = "/begin_shard_cutover"
+	END_SHARD_CUTOVER_PATH                     = "/end_shard_cutover"
+	FREEZE_SHARD_GROUPS_PATH                   = "/freeze_shard_groups"
+	THAW_SHARD_GROUPS_PATH                     = "/thaw_shard_groups"
+	LOG_LEVEL_PATH                             = "/log_level"
+	MARK_SHARDS_STALE_PATH                     = "/mark_shards_stale"
+	CLEAR_STALE_SHARD_PATH                     = "/clear_stale_shard"
+	LEADER_PATH                                = "/leader"
+	CREATE_MEASUREMENT_TOMBSTONE_PATH          = "/create_measurement_tombstone"
+	ACK_MEASUREMENT_TOMBSTONE_PATH             = "/ack_measurement_tombstone"
+	MAINTENANCE_WINDOWS_PATH                   = "/maintenance_windows"
+	CREATE_MAINTENANCE_WINDOW_PATH             = "/create_maintenance_window"
+	DELETE_MAINTENANCE_WINDOW_PATH             = "/delete_maintenance_window"
+	SEALED_SHARDS_PATH                         = "/sealed_shards"
+	SEAL_SHARD_GROUPS_PATH                     = "/seal_shard_groups"
+	SET_SEALED_SHARD_CHECKSUM_PATH             = "/set_sealed_shard_checksum"
+	REGISTER_DATA_NODE_PATH                    = "/register_data_node"
+	OPERATOR_ROLES_PATH                        = "/operator_roles"
+	SET_OPERATOR_ROLE_PATH                     = "/set_operator_role"
 )
@@ -0,0 +1,103 @@
+package raftmeta
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// snapshotMagic prefixes encrypted meta data in snapshots, plain meta data
+// is json and never starts with it.
+var snapshotMagic = []byte("CHRSNAP\x01")
+
+var ErrSnapshotKeyRequired = errors.New("meta snapshot is encrypted but no snapshot key configured")
+
+// SnapshotCipher encrypts meta data persisted in snapshots by AES-GCM. A nil
+// SnapshotCipher leaves data in plain text.
+type SnapshotCipher struct {
+	aead cipher.AEAD
+}
+
+// NewSnapshotCipher returns a cipher of AES-128/192/256 depending on the key length.
+func NewSnapshotCipher(key []byte) (*SnapshotCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotCipher{aead: aead}, nil
+}
+
+// LoadSnapshotCipher returns the cipher of the key configured in file, env or
+// by command (e.g. KMS decrypting). nil is returned if none is configured.
+func LoadSnapshotCipher(c Config) (*SnapshotCipher, error) {
+	var material []byte
+	var err error
+	switch {
+	case c.SnapshotKeyFile != "":
+		material, err = ioutil.ReadFile(c.SnapshotKeyFile)
+	case c.SnapshotKeyEnv != "":
+		v, ok := os.LookupEnv(c.SnapshotKeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("snapshot key env %s not set", c.SnapshotKeyEnv)
+		}
+		material = []byte(v)
+	case c.SnapshotKeyCommand != "":
+		material, err = exec.Command("sh", "-c", c.SnapshotKeyCommand).Output()
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load snapshot key: %s", err)
+	}
+
+	// key is base64 encoded
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(material)))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot key should be base64 encoded: %s", err)
+	}
+	return NewSnapshotCipher(key)
+}
+
+// Seal encrypts data as magic | nonce | ciphertext.
+func (c *SnapshotCipher) Seal(data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(snapshotMagic)+len(nonce)+len(data)+c.aead.Overhead())
+	out = append(out, snapshotMagic...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, data, snapshotMagic), nil
+}
+
+// Open decrypts data sealed, plain data is returned as it is.
+func (c *SnapshotCipher) Open(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, snapshotMagic) {
+		return data, nil
+	}
+	if c == nil {
+		return nil, ErrSnapshotKeyRequired
+	}
+	data = data[len(snapshotMagic):]
+	if len(data) < c.aead.NonceSize() {
+		return nil, errors.New("meta snapshot truncated")
+	}
+	nonce := data[:c.aead.NonceSize()]
+	return c.aead.Open(nil, nonce, data[c.aead.NonceSize():], snapshotMagic)
+}
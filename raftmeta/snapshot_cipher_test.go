@@ -0,0 +1,59 @@
+package raftmeta_test
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+
+	"github.com/angopher/chronus/raftmeta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotCipher(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	os.Setenv("CHRONUS_TEST_SNAPSHOT_KEY", key)
+	defer os.Unsetenv("CHRONUS_TEST_SNAPSHOT_KEY")
+
+	config := raftmeta.NewConfig()
+	c, err := raftmeta.LoadSnapshotCipher(config)
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+
+	config.SnapshotKeyEnv = "CHRONUS_TEST_SNAPSHOT_KEY"
+	c, err = raftmeta.LoadSnapshotCipher(config)
+	assert.Nil(t, err)
+	assert.NotNil(t, c)
+
+	plain := []byte(`{"Databases":[]}`)
+	sealed, err := c.Seal(plain)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(sealed), "Databases")
+
+	opened, err := c.Open(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, opened)
+
+	// plain data is loaded transparently
+	opened, err = c.Open(plain)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, opened)
+
+	// encrypted data can't be loaded without key
+	var none *raftmeta.SnapshotCipher
+	_, err = none.Open(sealed)
+	assert.Equal(t, raftmeta.ErrSnapshotKeyRequired, err)
+
+	// tampered
+	sealed[len(sealed)-1] ^= 1
+	_, err = c.Open(sealed)
+	assert.NotNil(t, err)
+
+	config.SnapshotKeyEnv = ""
+	config.SnapshotKeyCommand = "echo " + key
+	c2, err := raftmeta.LoadSnapshotCipher(config)
+	assert.Nil(t, err)
+	sealed, _ = c2.Seal(plain)
+	opened, err = c.Open(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, opened)
+}
@@ -218,6 +218,33 @@ func (s *RaftNode) HandleUpdateCluster(w http.ResponseWriter, r *http.Request) {
 	resp.RetMsg = "ok"
 }
 
+// HandleLeader tells the address of the leader. Followers knowing the leader
+// redirect to it, so that clients following redirects discover it from any
+// meta server.
+func (s *RaftNode) HandleLeader(w http.ResponseWriter, r *http.Request) {
+	leader := s.Node.Status().Lead
+	addr, ok := s.Transport.ClonePeers()[leader]
+	if leader != s.ID && ok {
+		http.Redirect(w, r, fmt.Sprint("http://", addr, LEADER_PATH), http.StatusTemporaryRedirect)
+		return
+	}
+
+	resp := &LeaderResp{}
+	resp.RetCode = -1
+	resp.RetMsg = "fail"
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	defer WriteResp(w, &resp)
+
+	if leader == raft.None || !ok {
+		resp.RetMsg = "no leader"
+		return
+	}
+	resp.ID = leader
+	resp.Addr = addr
+	resp.RetCode = 0
+	resp.RetMsg = "ok"
+}
+
 func (s *RaftNode) HandleStatusNode(w http.ResponseWriter, r *http.Request) {
 	resp := &StatusNodeResp{}
 	resp.RetCode = -1
@@ -235,6 +262,9 @@ func (s *RaftNode) HandleStatusNode(w http.ResponseWriter, r *http.Request) {
 	if addr, ok := peers[status.ID]; ok {
 		resp.Status.Addr = addr
 	}
+	if sp, err := s.Storage.Snapshot(); err == nil {
+		resp.Status.SnapshotIndex = sp.Metadata.Index
+	}
 	resp.RetCode = 0
 	resp.RetMsg = "ok"
 }
@@ -284,6 +314,7 @@ func (s *RaftNode) HandleStatusCluster(w http.ResponseWriter, r *http.Request) {
 		}
 		nodes[idx].Role = nodeStatus.Role
 		nodes[idx].Vote = nodeStatus.Vote
+		nodes[idx].SnapshotIndex = nodeStatus.SnapshotIndex
 
 		if pr, ok := prs[id]; ok {
 			nodes[idx].Match = pr.Match
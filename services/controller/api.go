@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/angopher/chronus/coordinator"
+	imeta "github.com/angopher/chronus/services/meta"
+	"go.uber.org/zap"
+)
+
+// APIPrefix is the path prefix of the REST API of the controller, versioned
+// so that clients of an older version keep working once it changes.
+const APIPrefix = "/api/v1"
+
+// apiResponseTimeout bounds reading a response of the controller once it
+// started to write it.
+const apiResponseTimeout = time.Minute
+
+// Operation is a request of the controller served by the REST API. Its
+// request body, if any, and response are the ones of the TCP protocol of
+// influxd-ctl in JSON. Requests streaming bytes, like files of snapshots, are
+// not operations.
+type Operation struct {
+	// Name is the identifier of the operation in the OpenAPI definition and
+	// the Go client, like CopyShard
+	Name    string
+	Summary string
+	// Method is GET for operations without request body, POST otherwise
+	Method string
+	// Path is relative to APIPrefix
+	Path string
+	// Role is the operator role required if authentication is enabled
+	Role imeta.OperatorRole
+
+	Request  RequestType
+	Response ResponseType
+	// RequestBody and ResponseBody are the types of bodies, RequestBody nil
+	// if none
+	RequestBody  reflect.Type
+	ResponseBody reflect.Type
+}
+
+func get(role imeta.OperatorRole, name, summary, path string, reqTyp RequestType, respTyp ResponseType, resp interface{}) Operation {
+	return Operation{
+		Name:         name,
+		Summary:      summary,
+		Method:       http.MethodGet,
+		Path:         path,
+		Role:         role,
+		Request:      reqTyp,
+		Response:     respTyp,
+		ResponseBody: reflect.TypeOf(resp),
+	}
+}
+
+func post(role imeta.OperatorRole, name, summary, path string, reqTyp RequestType, respTyp ResponseType, req, resp interface{}) Operation {
+	return Operation{
+		Name:         name,
+		Summary:      summary,
+		Method:       http.MethodPost,
+		Path:         path,
+		Role:         role,
+		Request:      reqTyp,
+		Response:     respTyp,
+		RequestBody:  reflect.TypeOf(req),
+		ResponseBody: reflect.TypeOf(resp),
+	}
+}
+
+// Operations are the operations of the REST API, in the order of the OpenAPI
+// definition. Destructive ones are confirmed with the token of the plan they
+// return, like influxd-ctl does. Viewers can read status, operators can move
+// shards and freeze nodes, only admins can delete nodes, shards or data.
+var Operations = []Operation{
+	get(imeta.OperatorRoleViewer, "ShowDataNodes", "List data nodes of the cluster", "/nodes",
+		RequestShowDataNodes, ResponseShowDataNodes, ShowDataNodesResponse{}),
+	post(imeta.OperatorRoleOperator, "FreezeDataNode", "Freeze or unfreeze creation of shards on a data node", "/nodes/freeze",
+		RequestFreezeDataNode, ResponseFreezeDataNode, FreezeDataNodeRequest{}, FreezeDataNodeResponse{}),
+	post(imeta.OperatorRoleAdmin, "RemoveDataNode", "Remove a data node from the cluster", "/nodes/remove",
+		RequestRemoveDataNode, ResponseRemoveDataNode, RemoveDataNodeRequest{}, RemoveDataNodeResponse{}),
+	post(imeta.OperatorRoleViewer, "DrainStatus", "Tell shards of a data node not replicated enough elsewhere yet", "/nodes/drain-status",
+		RequestDrainStatus, ResponseDrainStatus, DrainStatusRequest{}, DrainStatusResponse{}),
+	post(imeta.OperatorRoleOperator, "DrainReads", "Stop, resume or tell serving reads of other nodes", "/nodes/drain-reads",
+		RequestDrainReads, ResponseDrainReads, DrainReadsRequest{}, DrainReadsResponse{}),
+	post(imeta.OperatorRoleViewer, "Shards", "List shard groups of a retention policy", "/shards",
+		RequestShards, ResponseShards, GetShardsRequest{}, ShardsResponse{}),
+	post(imeta.OperatorRoleViewer, "Shard", "Describe a shard", "/shards/shard",
+		RequestShard, ResponseShard, GetShardRequest{}, ShardResponse{}),
+	post(imeta.OperatorRoleViewer, "NodeShards", "List shards of a data node", "/shards/node",
+		RequestNodeShards, ResponseNodeShards, GetNodeShardsRequest{}, NodeShardsResponse{}),
+	post(imeta.OperatorRoleOperator, "TruncateShards", "Truncate shard groups so new writes go to new ones", "/shards/truncate",
+		RequestTruncateShard, ResponseTruncateShard, TruncateShardRequest{}, TruncateShardResponse{}),
+	post(imeta.OperatorRoleOperator, "CopyShard", "Copy a shard from another node to the node", "/shards/copy",
+		RequestCopyShard, ResponseCopyShard, CopyShardRequest{}, CopyShardResponse{}),
+	get(imeta.OperatorRoleViewer, "CopyShardStatus", "List copies of shards to the node running or failed", "/shards/copy",
+		RequestCopyShardStatus, ResponseCopyShardStatus, CopyShardStatusResponse{}),
+	post(imeta.OperatorRoleOperator, "KillCopyShard", "Stop a copy of a shard to the node", "/shards/copy/kill",
+		RequestKillCopyShard, ResponseKillCopyShard, KillCopyShardRequest{}, KillCopyShardResponse{}),
+	post(imeta.OperatorRoleAdmin, "RemoveShard", "Remove a shard from a data node", "/shards/remove",
+		RequestRemoveShard, ResponseRemoveShard, RemoveShardRequest{}, RemoveShardResponse{}),
+	post(imeta.OperatorRoleOperator, "RepairShard", "Repair a shard of the node from another owner", "/shards/repair",
+		RequestRepairShard, ResponseRepairShard, RepairShardRequest{}, RepairShardResponse{}),
+	post(imeta.OperatorRoleViewer, "VerifyShard", "Compare a shard across its owners", "/shards/verify",
+		RequestVerifyShard, ResponseVerifyShard, VerifyShardRequest{}, VerifyShardResponse{}),
+	post(imeta.OperatorRoleViewer, "ShardReport", "Tell space and last writes of shards of all nodes", "/shards/report",
+		RequestShardReport, ResponseShardReport, ShardReportRequest{}, ShardReportResponse{}),
+	post(imeta.OperatorRoleViewer, "CatchUpStatus", "List shards of the node marked stale and catching up", "/shards/catch-up",
+		RequestCatchUpStatus, ResponseCatchUpStatus, CatchUpStatusRequest{}, CatchUpStatusResponse{}),
+	get(imeta.OperatorRoleViewer, "CheckConsistency", "Compare shards of the node with meta data", "/consistency",
+		RequestCheckConsistency, ResponseCheckConsistency, CheckConsistencyResponse{}),
+	post(imeta.OperatorRoleAdmin, "DropDatabase", "Drop a database", "/databases/drop",
+		RequestDropDatabase, ResponseDropDatabase, DropDatabaseRequest{}, DropDatabaseResponse{}),
+	get(imeta.OperatorRoleOperator, "ClusterSnapshot", "Snapshot meta data and shards of all nodes for a backup", "/snapshots",
+		RequestClusterSnapshot, ResponseClusterSnapshot, ClusterSnapshotResponse{}),
+	post(imeta.OperatorRoleOperator, "SnapshotShards", "Snapshot shards of the node", "/snapshots/shards",
+		RequestSnapshotShards, ResponseSnapshotShards, SnapshotShardsRequest{}, SnapshotShardsResponse{}),
+	post(imeta.OperatorRoleOperator, "ReleaseSnapshot", "Release a snapshot of all nodes", "/snapshots/release",
+		RequestReleaseSnapshot, ResponseReleaseSnapshot, ReleaseSnapshotRequest{}, ReleaseSnapshotResponse{}),
+	post(imeta.OperatorRoleOperator, "RemoveSnapshot", "Remove a snapshot of the node", "/snapshots/remove",
+		RequestRemoveSnapshot, ResponseRemoveSnapshot, RemoveSnapshotRequest{}, RemoveSnapshotResponse{}),
+	post(imeta.OperatorRoleViewer, "RestorePlan", "Plan restoring shards of a backup", "/restore/plan",
+		RequestRestorePlan, ResponseRestorePlan, RestorePlanRequest{}, RestorePlanResponse{}),
+	post(imeta.OperatorRoleAdmin, "PurgeHintedHandoff", "Drop hinted data queued on the node for another node", "/hh/purge",
+		RequestPurgeHintedHandoff, ResponsePurgeHintedHandoff, PurgeHintedHandoffRequest{}, PurgeHintedHandoffResponse{}),
+	post(imeta.OperatorRoleOperator, "TransferHintedHandoff", "Move hinted data queued on the node to another node", "/hh/transfer",
+		RequestTransferHintedHandoff, ResponseTransferHintedHandoff, TransferHintedHandoffRequest{}, TransferHintedHandoffResponse{}),
+	post(imeta.OperatorRoleOperator, "ReplayHintedHandoff", "Move hinted data of a queue directory to the queue of the node", "/hh/replay",
+		RequestReplayHintedHandoff, ResponseReplayHintedHandoff, ReplayHintedHandoffRequest{}, ReplayHintedHandoffResponse{}),
+	post(imeta.OperatorRoleViewer, "Doctor", "Check the health of the cluster", "/doctor",
+		RequestDoctor, ResponseDoctor, DoctorRequest{}, DoctorResponse{}),
+}
+
+// Do serves request req of reqTyp in process, like a request of influxd-ctl,
+// decoding the response of respTyp into resp.
+func (s *Service) Do(reqTyp RequestType, respTyp ResponseType, req, resp interface{}) error {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		// unblocks writing a request never read
+		defer server.Close()
+		if err := s.handleConn(server); err != nil {
+			s.Logger.Info("request in process failed", zap.Error(err))
+		}
+	}()
+
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	go coordinator.WriteTLV(client, byte(reqTyp), buf)
+
+	typ, err := coordinator.ReadType(client)
+	if err != nil {
+		return err
+	}
+	if typ != byte(respTyp) {
+		return fmt.Errorf("invalid type, exp: %d, got: %d", respTyp, typ)
+	}
+	buf, err = coordinator.ReadLV(client, apiResponseTimeout)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, resp)
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+)
+
+const (
+	ActionRemoveShard    = "remove-shard"
+	ActionRemoveDataNode = "remove-data-node"
+	ActionDropDatabase   = "drop-database"
+
+	ActionPurgeHintedHandoff = "purge-hinted-handoff"
+)
+
+var (
+	// ErrApprovalNotFound is returned confirming with a token never issued,
+	// already used or expired.
+	ErrApprovalNotFound = errs.ErrApprovalNotFound
+	// ErrPlanChanged is returned confirming with a token when things to be
+	// removed changed since the plan was issued.
+	ErrPlanChanged = errs.ErrPlanChanged
+)
+
+// Approval is the plan of a destructive operation, returned instead of
+// executing it. The operation is executed by requesting it again with Token.
+type Approval struct {
+	Plan    []string `json:"plan,omitempty"`
+	Token   string   `json:"token,omitempty"`
+	Expires int64    `json:"expires,omitempty"` // milliseconds
+}
+
+type pendingApproval struct {
+	action  string
+	target  string
+	plan    string
+	expires time.Time
+}
+
+// approvals are plans of destructive operations waiting for confirmation.
+// Tokens are kept in memory of the node the plan is requested from, so they
+// are lost on restart and should be confirmed on the same node.
+type approvals struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[string]pendingApproval
+}
+
+func newApprovals(timeout time.Duration) *approvals {
+	return &approvals{
+		timeout: timeout,
+		pending: make(map[string]pendingApproval),
+	}
+}
+
+// propose issues a token confirming action on target with plan.
+func (a *approvals) propose(action, target string, plan []string, now time.Time) (*Approval, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(b[:])
+	expires := now.Add(a.timeout)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for t, p := range a.pending {
+		if !now.Before(p.expires) {
+			delete(a.pending, t)
+		}
+	}
+	a.pending[token] = pendingApproval{
+		action:  action,
+		target:  target,
+		plan:    strings.Join(plan, "\n"),
+		expires: expires,
+	}
+	return &Approval{
+		Plan:    plan,
+		Token:   token,
+		Expires: expires.UnixNano() / MILLISECOND,
+	}, nil
+}
+
+// confirm consumes token if it's issued for action on target with the same
+// plan.
+func (a *approvals) confirm(token, action, target string, plan []string, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p, ok := a.pending[token]
+	if !ok || !now.Before(p.expires) {
+		delete(a.pending, token)
+		return ErrApprovalNotFound
+	}
+	if p.action != action || p.target != target {
+		return errs.Errorf(errs.KindConflict, "token is issued for %s %s", p.action, p.target)
+	}
+	delete(a.pending, token)
+	if p.plan != strings.Join(plan, "\n") {
+		return ErrPlanChanged
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+)
+
+func TestApprovals(t *testing.T) {
+	a := newApprovals(time.Minute)
+	now := time.Now()
+	plan := []string{"delete shard 1"}
+
+	approval, err := a.propose(ActionRemoveShard, "1", plan, now)
+	if err != nil || approval.Token == "" || !reflect.DeepEqual(approval.Plan, plan) {
+		t.Fatalf("unexpected approval: %+v, %v", approval, err)
+	}
+	// a token confirms the action and target it's issued for only
+	if err := a.confirm(approval.Token, ActionRemoveShard, "2", plan, now); errs.KindOf(err) != errs.KindConflict {
+		t.Fatalf("unexpected error confirming another target: %v", err)
+	}
+	if err := a.confirm(approval.Token, ActionDropDatabase, "1", plan, now); errs.KindOf(err) != errs.KindConflict {
+		t.Fatalf("unexpected error confirming another action: %v", err)
+	}
+	// once
+	if err := a.confirm(approval.Token, ActionRemoveShard, "1", plan, now); err != nil {
+		t.Fatalf("confirm() failed: %v", err)
+	}
+	if err := a.confirm(approval.Token, ActionRemoveShard, "1", plan, now); err != ErrApprovalNotFound {
+		t.Fatalf("unexpected error confirming again: %v", err)
+	}
+
+	// a token of a plan changed since is consumed
+	approval, _ = a.propose(ActionRemoveShard, "1", plan, now)
+	if err := a.confirm(approval.Token, ActionRemoveShard, "1", []string{"delete shard 1", "data lost"}, now); err != ErrPlanChanged {
+		t.Fatalf("unexpected error confirming plan changed: %v", err)
+	}
+	if err := a.confirm(approval.Token, ActionRemoveShard, "1", plan, now); err != ErrApprovalNotFound {
+		t.Fatalf("unexpected error confirming again: %v", err)
+	}
+
+	// and so is a token expired
+	approval, _ = a.propose(ActionRemoveShard, "1", plan, now)
+	if err := a.confirm(approval.Token, ActionRemoveShard, "1", plan, now.Add(time.Minute)); err != ErrApprovalNotFound {
+		t.Fatalf("unexpected error confirming token expired: %v", err)
+	}
+	if err := a.confirm("", ActionRemoveShard, "1", plan, now); err != ErrApprovalNotFound {
+		t.Fatalf("unexpected error confirming no token: %v", err)
+	}
+}
+
+func TestRemoveShard_Token(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	store.addShard(t, "db0", "rp0", 1, true)
+	mc := consistencyMeta()
+	s := newTestService(mc, store)
+
+	// removed only once confirmed
+	var resp RemoveShardResponse
+	req := &RemoveShardRequest{DataNodeAddr: "node1:8088", ShardID: 1}
+	requestService(t, s, RequestRemoveShard, ResponseRemoveShard, req, &resp)
+	exp := []string{"delete shard 1 of db0.rp0 from node 1 (node1:8088)", "no other node owns the shard, its data will be lost"}
+	if resp.Code != 0 || resp.Token == "" || !reflect.DeepEqual(resp.Plan, exp) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(store.deleted) != 0 || len(mc.removed) != 0 {
+		t.Fatal("shard removed without confirmation")
+	}
+
+	req.Token = resp.Token
+	resp = RemoveShardResponse{}
+	requestService(t, s, RequestRemoveShard, ResponseRemoveShard, req, &resp)
+	if resp.Code != 0 || resp.Token != "" {
+		t.Fatalf("unexpected response confirmed: %+v", resp)
+	}
+	if exp := []uint64{1}; !reflect.DeepEqual(store.deleted, exp) || !reflect.DeepEqual(mc.removed, exp) {
+		t.Fatalf("shard not removed: deleted %v, owner removed of %v", store.deleted, mc.removed)
+	}
+
+	// a token is used once
+	store.addShard(t, "db0", "rp0", 1, true)
+	resp = RemoveShardResponse{}
+	requestService(t, s, RequestRemoveShard, ResponseRemoveShard, req, &resp)
+	if resp.Code == 0 || resp.Msg != ErrApprovalNotFound.Error() || len(store.deleted) != 1 {
+		t.Fatalf("unexpected response confirming again: %+v", resp)
+	}
+}
+
+type fakeClusterExecutor struct {
+	deleted []string
+}
+
+func (e *fakeClusterExecutor) DeleteDatabase(database string) error {
+	e.deleted = append(e.deleted, database)
+	return nil
+}
+
+func TestDropDatabase_PlanChanged(t *testing.T) {
+	mc := consistencyMeta()
+	s := newTestService(mc, nil)
+	executor := &fakeClusterExecutor{}
+	s.ClusterExecutor = executor
+
+	var resp DropDatabaseResponse
+	req := &DropDatabaseRequest{Database: "db0"}
+	requestService(t, s, RequestDropDatabase, ResponseDropDatabase, req, &resp)
+	if resp.Code != 0 || resp.Token == "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// shards created since are not dropped by the token
+	if _, err := mc.CreateShardGroup("db0", "rp0", time.Now().Add(24*time.Hour)); err != nil {
+		t.Fatalf("CreateShardGroup() failed: %v", err)
+	}
+	req.Token = resp.Token
+	resp = DropDatabaseResponse{}
+	requestService(t, s, RequestDropDatabase, ResponseDropDatabase, req, &resp)
+	if resp.Msg != ErrPlanChanged.Error() || resp.Kind != errs.KindConflict.String() {
+		t.Fatalf("unexpected response of plan changed: %+v", resp)
+	}
+	if len(executor.deleted) != 0 || mc.Database("db0") == nil {
+		t.Fatal("database dropped by token of plan changed")
+	}
+
+	// confirmed with a new token
+	req.Token = ""
+	requestService(t, s, RequestDropDatabase, ResponseDropDatabase, req, &resp)
+	req.Token = resp.Token
+	resp = DropDatabaseResponse{}
+	requestService(t, s, RequestDropDatabase, ResponseDropDatabase, req, &resp)
+	if resp.Code != 0 || mc.Database("db0") != nil || !reflect.DeepEqual(executor.deleted, []string{"db0"}) {
+		t.Fatalf("database not dropped: %+v", resp)
+	}
+}
+
+func TestRemoveDataNode_Token(t *testing.T) {
+	mc := consistencyMeta()
+	s := newTestService(mc, nil)
+
+	var resp RemoveDataNodeResponse
+	req := &RemoveDataNodeRequest{DataNodeAddr: "node2:8088"}
+	requestService(t, s, RequestRemoveDataNode, ResponseRemoveDataNode, req, &resp)
+	exp := []string{
+		"remove node 2 (node2:8088) from cluster",
+		"1 shards lose their copy on the node",
+		"no other node owns shards [3], their data will be lost",
+	}
+	if resp.Code != 0 || resp.Token == "" || !reflect.DeepEqual(resp.Plan, exp) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// the token of node 2 doesn't remove node 1
+	token := resp.Token
+	resp = RemoveDataNodeResponse{}
+	requestService(t, s, RequestRemoveDataNode, ResponseRemoveDataNode, &RemoveDataNodeRequest{DataNodeAddr: "node1:8088", Token: token}, &resp)
+	if resp.Kind != errs.KindConflict.String() || len(mc.nodes) != 2 {
+		t.Fatalf("unexpected response removing another node: %+v", resp)
+	}
+	req.Token = token
+	resp = RemoveDataNodeResponse{}
+	requestService(t, s, RequestRemoveDataNode, ResponseRemoveDataNode, req, &resp)
+	if resp.Code != 0 || len(mc.nodes) != 1 || mc.nodes[0].ID != 1 {
+		t.Fatalf("node not removed: %+v, nodes %v", resp, mc.nodes)
+	}
+}
+
+func TestDestructive_DryRun(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	store.addShard(t, "db0", "rp0", 1, true)
+	mc := consistencyMeta()
+	mc.setOwner(1, 2, true)
+	s := newTestService(mc, store)
+	executor := &fakeClusterExecutor{}
+	s.ClusterExecutor = executor
+
+	var shardResp RemoveShardResponse
+	requestService(t, s, RequestRemoveShard, ResponseRemoveShard, &RemoveShardRequest{DataNodeAddr: "node1:8088", ShardID: 1, DryRun: true}, &shardResp)
+	exp := []string{"delete shard 1 of db0.rp0 from node 1 (node1:8088)", "shard is left on nodes [2]"}
+	if shardResp.Msg != "dry run" || shardResp.Token != "" || !reflect.DeepEqual(shardResp.Plan, exp) {
+		t.Fatalf("unexpected response: %+v", shardResp)
+	}
+
+	var nodeResp RemoveDataNodeResponse
+	requestService(t, s, RequestRemoveDataNode, ResponseRemoveDataNode, &RemoveDataNodeRequest{DataNodeAddr: "node2:8088", DryRun: true}, &nodeResp)
+	if nodeResp.Msg != "dry run" || nodeResp.Token != "" || len(nodeResp.Plan) != 3 {
+		t.Fatalf("unexpected response: %+v", nodeResp)
+	}
+
+	var dbResp DropDatabaseResponse
+	requestService(t, s, RequestDropDatabase, ResponseDropDatabase, &DropDatabaseRequest{Database: "db0", DryRun: true}, &dbResp)
+	exp = []string{"drop database db0 with retention policies [rp0]", "delete 4 shards of 2 shard groups on nodes [1 2]"}
+	if dbResp.Msg != "dry run" || dbResp.Token != "" || !reflect.DeepEqual(dbResp.Plan, exp) {
+		t.Fatalf("unexpected response: %+v", dbResp)
+	}
+
+	// nothing is removed nor waits for confirmation
+	if len(store.deleted) != 0 || len(mc.removed) != 0 || len(mc.nodes) != 2 || len(executor.deleted) != 0 || mc.Database("db0") == nil {
+		t.Fatal("removed by dry run")
+	}
+	if len(s.approvals.pending) != 0 {
+		t.Fatalf("dry run waiting for confirmation: %v", s.approvals.pending)
+	}
+}
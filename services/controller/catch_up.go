@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/logging"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+const (
+	CatchUpPending   = "pending"
+	CatchUpRepairing = "repairing"
+	CatchUpFailed    = "failed"
+)
+
+// CatchUpShard is a shard of this node marked stale, missing writes whose
+// hinted data was purged while the node was down. Reads are served by other
+// owners until it's copied from one of them again.
+type CatchUpShard struct {
+	ShardID  uint64 `json:"shard_id"`
+	Database string `json:"database"`
+	Rp       string `json:"retention_policy"`
+	MarkedAt int64  `json:"marked_at"` // milliseconds
+	State    string `json:"state"`
+	// Source is the owner the shard is copied from in the last attempt
+	Source    string `json:"source,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Attempts  int    `json:"attempts"`
+	UpdatedAt int64  `json:"updated_at,omitempty"` // milliseconds of the last attempt
+}
+
+type CatchUpStatusRequest struct {
+}
+
+type CatchUpStatusResponse struct {
+	CommonResp
+	NodeID uint64         `json:"node_id"`
+	Shards []CatchUpShard `json:"shards"`
+}
+
+// catchUps are the attempts of catching up stale shards of this node, shards
+// not attempted yet are pending.
+type catchUps struct {
+	mu     sync.Mutex
+	shards map[uint64]*CatchUpShard
+}
+
+func (c *catchUps) set(shardID uint64, fn func(sh *CatchUpShard)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.shards == nil {
+		c.shards = make(map[uint64]*CatchUpShard)
+	}
+	sh, ok := c.shards[shardID]
+	if !ok {
+		sh = &CatchUpShard{ShardID: shardID}
+		c.shards[shardID] = sh
+	}
+	fn(sh)
+}
+
+func (c *catchUps) get(shardID uint64) (CatchUpShard, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sh, ok := c.shards[shardID]; ok {
+		return *sh, true
+	}
+	return CatchUpShard{}, false
+}
+
+// retain forgets attempts of shards not stale anymore.
+func (c *catchUps) retain(stale []imeta.StaleShard) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := make(map[uint64]bool, len(stale))
+	for _, m := range stale {
+		ids[m.ShardID] = true
+	}
+	for id := range c.shards {
+		if !ids[id] {
+			delete(c.shards, id)
+		}
+	}
+}
+
+// catchUpLoop catches up stale shards of this node periodically, one at a
+// time so that healthy owners aren't overloaded by copies.
+func (s *Service) catchUpLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.catchUpInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			if s.MetaClient.InMaintenance(s.Node.ID, time.Now(), imeta.MaintenanceFreeze) {
+				continue
+			}
+			stale := s.MetaClient.StaleShards(s.Node.ID)
+			s.catchUps.retain(stale)
+			for _, m := range stale {
+				select {
+				case <-s.closing:
+					return
+				default:
+				}
+				if err := s.catchUpShard(m.ShardID); err != nil {
+					s.Logger.Warn("Failed to catch up stale shard", logging.ShardID(m.ShardID), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// catchUpShard replaces the stale copy of shard on this node by a copy of a
+// healthy owner. The node stops owning the shard while it's copied, so that
+// writes are not applied to the copy being replaced, and owns it again with
+// the tail of writes copied once done. The mark is cleared last, a catch-up
+// interrupted is resumed by the next one.
+func (s *Service) catchUpShard(shardID uint64) (err error) {
+	var source string
+	s.catchUps.set(shardID, func(sh *CatchUpShard) {
+		sh.State = CatchUpRepairing
+		sh.Attempts++
+		sh.UpdatedAt = time.Now().UnixNano() / MILLISECOND
+	})
+	defer func() {
+		s.catchUps.set(shardID, func(sh *CatchUpShard) {
+			sh.Source = source
+			if err != nil {
+				sh.State = CatchUpFailed
+				sh.Error = err.Error()
+			} else {
+				sh.State = CatchUpPending
+				sh.Error = ""
+			}
+		})
+	}()
+
+	db, rp, sgi := s.MetaClient.ShardOwner(shardID)
+	if sgi == nil {
+		// dropped, its mark is pruned along
+		return nil
+	}
+	source, err = s.healthyOwner(shardID)
+	if err != nil {
+		return err
+	}
+
+	s.Logger.Info("Catch up stale shard", logging.ShardID(shardID), zap.String("source", source))
+	for _, sh := range sgi.Shards {
+		if sh.ID == shardID && sh.OwnedBy(s.Node.ID) {
+			if err := s.MetaClient.RemoveShardOwner(imeta.ShardID(shardID), imeta.NodeID(s.Node.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	if s.TSDBStore.Shard(shardID) != nil {
+		if err := s.TSDBStore.DeleteShard(shardID); err != nil {
+			return err
+		}
+	}
+	// The directory is left if the shard is not loaded by store
+	if err := os.RemoveAll(filepath.Join(s.TSDBStore.Path(), db, rp, strconv.FormatUint(shardID, 10))); err != nil {
+		return err
+	}
+	if err := s.copyShard(source, shardID); err != nil {
+		return err
+	}
+	if err := s.MetaClient.ClearStaleShard(shardID, s.Node.ID); err != nil {
+		return err
+	}
+	s.quarantine.release(shardID)
+	s.Logger.Info("Stale shard caught up", logging.ShardID(shardID), zap.String("source", source))
+	return nil
+}
+
+// healthyOwner returns tcp address of an owner of shard other than this node
+// whose copy is not stale, and which is not in maintenance.
+func (s *Service) healthyOwner(shardID uint64) (string, error) {
+	_, _, sgi := s.MetaClient.ShardOwner(shardID)
+	if sgi == nil {
+		return "", fmt.Errorf("%w: %d", errs.ErrShardNotFound, shardID)
+	}
+	nodes, err := s.MetaClient.DataNodes()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	for _, sh := range sgi.Shards {
+		if sh.ID != shardID {
+			continue
+		}
+		for _, owner := range sh.Owners {
+			if owner.NodeID == s.Node.ID || s.MetaClient.ShardStale(shardID, owner.NodeID) ||
+				s.MetaClient.InMaintenance(owner.NodeID, now, imeta.MaintenanceFreeze) {
+				continue
+			}
+			for _, n := range nodes {
+				if n.ID == owner.NodeID {
+					return n.TCPHost, nil
+				}
+			}
+		}
+	}
+	return "", errs.ErrNoOtherOwner
+}
+
+// catchUpStatus returns stale shards of this node and how their catch-up goes.
+func (s *Service) catchUpStatus() []CatchUpShard {
+	stale := s.MetaClient.StaleShards(s.Node.ID)
+	shards := make([]CatchUpShard, 0, len(stale))
+	for _, m := range stale {
+		sh, ok := s.catchUps.get(m.ShardID)
+		if !ok {
+			sh = CatchUpShard{ShardID: m.ShardID, State: CatchUpPending}
+		}
+		sh.Database, sh.Rp, _ = s.MetaClient.ShardOwner(m.ShardID)
+		sh.MarkedAt = m.MarkedAt.UnixNano() / MILLISECOND
+		shards = append(shards, sh)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].ShardID < shards[j].ShardID })
+	return shards
+}
+
+func (s *Service) handleCatchUpStatus(conn net.Conn) ([]CatchUpShard, error) {
+	var req CatchUpStatusRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	return s.catchUpStatus(), nil
+}
+
+func (s *Service) catchUpStatusResponse(w io.Writer, shards []CatchUpShard, e error) {
+	var resp CatchUpStatusResponse
+	setError(&resp.CommonResp, e)
+	resp.NodeID = s.Node.ID
+	resp.Shards = shards
+	s.writeResponse(w, ResponseCatchUpStatus, &resp)
+}
@@ -0,0 +1,123 @@
+// Package client is the Go client of the REST API of the controller of data
+// nodes, see controller.Operations. Methods of operations are generated, run
+// go generate after changing operations.
+package client
+
+//go:generate go run ./gen -openapi ../../../docs/controller_openapi.json
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/services/controller"
+)
+
+// maxErrorBody limits the body of failed responses read.
+const maxErrorBody = 64 * 1024
+
+// Client requests the controller of the data node of URL through its HTTP
+// API, authenticated by Token if set or by Username and Password otherwise.
+type Client struct {
+	URL      string
+	Token    string
+	Username string
+	Password string
+
+	HTTPClient *http.Client
+}
+
+// New returns a client of the node of url, like http://host:8086.
+func New(url string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(url, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+type failedResponse interface {
+	Err() error
+}
+
+// do requests path by method with body req, if not nil, decoding the
+// response into resp. Errors of responses failed are of their kind.
+func (c *Client) do(ctx context.Context, method, path string, req, resp interface{}) error {
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequest(method, c.URL+controller.APIPrefix+path, body)
+	if err != nil {
+		return err
+	}
+	r = r.WithContext(ctx)
+	if req != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		r.Header.Set("Authorization", "Token "+c.Token)
+	} else if c.Username != "" {
+		r.SetBasicAuth(c.Username, c.Password)
+	}
+
+	res, err := c.HTTPClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, resp); err == nil {
+		if f, ok := resp.(failedResponse); ok {
+			if err := f.Err(); err != nil {
+				return err
+			}
+		}
+	}
+	if res.StatusCode != http.StatusOK {
+		// rejected before reaching the controller
+		var e struct {
+			Error string `json:"error"`
+		}
+		if len(b) > maxErrorBody {
+			b = b[:maxErrorBody]
+		}
+		if json.Unmarshal(b, &e) != nil || e.Error == "" {
+			e.Error = string(b)
+		}
+		return errs.New(kindOfStatus(res.StatusCode), fmt.Sprintf("%s: %s", res.Status, e.Error))
+	}
+	return nil
+}
+
+// kindOfStatus is the kind of errors of HTTP status code.
+func kindOfStatus(code int) errs.Kind {
+	switch code {
+	case http.StatusBadRequest:
+		return errs.KindInvalidArgument
+	case http.StatusUnauthorized:
+		return errs.KindUnauthorized
+	case http.StatusForbidden:
+		return errs.KindForbidden
+	case http.StatusNotFound:
+		return errs.KindNotFound
+	case http.StatusServiceUnavailable:
+		return errs.KindUnavailable
+	case http.StatusTooManyRequests:
+		return errs.KindResourceExhausted
+	}
+	return errs.KindUnknown
+}
@@ -0,0 +1,65 @@
+// Command gen generates the methods of operations of the controller client
+// and the OpenAPI definition of the controller API.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/angopher/chronus/services/controller"
+)
+
+var clientTemplate = template.Must(template.New("client").Funcs(template.FuncMap{
+	"lower": func(s string) string { return strings.ToLower(s[:1]) + s[1:] },
+}).Parse(`// Code generated by gen; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+
+	"github.com/angopher/chronus/services/controller"
+)
+{{range .}}
+// {{.Name}} requests {{.Method}} {{.Path}}: {{lower .Summary}}.
+func (c *Client) {{.Name}}(ctx context.Context{{if .RequestBody}}, req *controller.{{.RequestBody.Name}}{{end}}) (*controller.{{.ResponseBody.Name}}, error) {
+	var resp controller.{{.ResponseBody.Name}}
+	if err := c.do(ctx, "{{.Method}}", "{{.Path}}", {{if .RequestBody}}req{{else}}nil{{end}}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+{{end}}`))
+
+func main() {
+	out := flag.String("o", "client_gen.go", "file of methods generated")
+	openapi := flag.String("openapi", "", "file of the OpenAPI definition, not generated if empty")
+	flag.Parse()
+
+	var buf bytes.Buffer
+	if err := clientTemplate.Execute(&buf, controller.Operations); err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	if *openapi != "" {
+		b, err := controller.OpenAPI("v1")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(*openapi, append(b, '\n'), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
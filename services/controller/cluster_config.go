@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"go.uber.org/zap"
+
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/angopher/chronus/x"
+)
+
+// clusterConfigLoop applies the cluster config whenever it changes.
+func (s *Service) clusterConfigLoop() {
+	defer s.wg.Done()
+
+	for {
+		changed := s.MetaClient.WaitForClusterConfigChanged()
+		s.applyClusterConfig(s.MetaClient.ClusterConfig())
+		select {
+		case <-s.closing:
+			return
+		case <-changed:
+		}
+	}
+}
+
+// applyClusterConfig sets the bandwidth of shard copies, falling back to the
+// config of the node for keys not set.
+func (s *Service) applyClusterConfig(config imeta.ClusterConfig) {
+	rate := s.copyShardRate
+	if r, ok := config.Int(imeta.ConfigCopyShardRate); ok {
+		rate = r
+	}
+	if rate == s.migrateManager.Bandwidth().Rate {
+		return
+	}
+	schedule, err := x.NewBandwidthSchedule(rate, s.copyShardWindows)
+	if err != nil {
+		s.Logger.Warn("Invalid copy shard rate", zap.Int64("rate", rate), zap.Error(err))
+		return
+	}
+	s.migrateManager.SetBandwidth(schedule)
+	s.Logger.Info("Copy shard rate changed", zap.Int64("rate", rate))
+}
@@ -1,13 +1,110 @@
 package controller
 
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/angopher/chronus/services/migrate"
+	"github.com/angopher/chronus/x"
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	// DefaultConsistencyCheckInterval is the default interval of comparing local
+	// shards with meta. A value of 0 disables the periodic check.
+	DefaultConsistencyCheckInterval = 30 * time.Minute
+
+	// DefaultApprovalTimeout is the default time a plan of destructive
+	// operations can be confirmed in.
+	DefaultApprovalTimeout = 5 * time.Minute
+
+	// DefaultShardCutoverTimeout is the default maximum time writes to a shard
+	// copied are held while the tail of its writes is copied.
+	DefaultShardCutoverTimeout = 10 * time.Second
+
+	// DefaultShardReportInterval is the default interval of collecting usage
+	// of shards from all nodes.
+	DefaultShardReportInterval = time.Minute
+
+	// DefaultSnapshotTTL is the default time snapshots of shards are kept
+	// for if not released.
+	DefaultSnapshotTTL = 24 * time.Hour
+
+	// DefaultCatchUpInterval is the default interval of catching up stale
+	// shards of the node.
+	DefaultCatchUpInterval = time.Minute
+)
+
 type Config struct {
-	Enabled           bool `toml:"enabled"`
-	MaxShardCopyTasks int  `toml:"max_shard_copy_tasks"`
+	Enabled                  bool          `toml:"enabled"`
+	MaxShardCopyTasks        int           `toml:"max_shard_copy_tasks"`
+	ConsistencyCheckInterval toml.Duration `toml:"consistency_check_interval"`
+	ApprovalTimeout          toml.Duration `toml:"approval_timeout"`
+
+	// ShardReportInterval is the interval of collecting space and last writes
+	// of shards from all nodes, shown by SHOW SHARDS. 0 disables it.
+	ShardReportInterval toml.Duration `toml:"shard_report_interval"`
+
+	// ShardCutoverTimeout bounds the write barrier of a shard copied while
+	// the writes since the copy started are copied. 0 disables the barrier,
+	// writes to the source during the copy are not copied then.
+	ShardCutoverTimeout toml.Duration `toml:"shard_cutover_timeout"`
+
+	// CopyShardRate limits bytes per second of every shard copy, including
+	// repairs, out of CopyShardWindows. 0 is unlimited.
+	CopyShardRate    int64               `toml:"copy_shard_rate"`
+	CopyShardWindows []x.BandwidthWindow `toml:"copy_shard_windows"`
+
+	// SnapshotTTL is the time snapshots of shards taken for backups are kept
+	// for if not released. 0 keeps them until released.
+	SnapshotTTL toml.Duration `toml:"snapshot_ttl"`
+
+	// CatchUpInterval is the interval of copying shards of the node marked
+	// stale, after hinted data of them was purged unsent, from healthy
+	// owners. 0 disables it.
+	CatchUpInterval toml.Duration `toml:"catch_up_interval"`
+
+	// SealGrace is how long after the end of a shard group it's sealed,
+	// rejecting writes of clients, fully compacted and verified across its
+	// owners. 0 disables sealing.
+	SealGrace toml.Duration `toml:"seal_grace"`
+
+	// SafeMode cross-checks local shards with meta when the node starts,
+	// before serving, and refuses to serve the ones mismatching until
+	// repaired.
+	SafeMode bool `toml:"safe_mode"`
 }
 
 func NewConfig() Config {
 	return Config{
-		Enabled:           true,
-		MaxShardCopyTasks: 10,
+		Enabled:                  true,
+		MaxShardCopyTasks:        10,
+		ConsistencyCheckInterval: toml.Duration(DefaultConsistencyCheckInterval),
+		ApprovalTimeout:          toml.Duration(DefaultApprovalTimeout),
+		ShardCutoverTimeout:      toml.Duration(DefaultShardCutoverTimeout),
+		ShardReportInterval:      toml.Duration(DefaultShardReportInterval),
+		CopyShardRate:            migrate.CopyRate,
+		SnapshotTTL:              toml.Duration(DefaultSnapshotTTL),
+		CatchUpInterval:          toml.Duration(DefaultCatchUpInterval),
+	}
+}
+
+// Validate returns an error if the config is invalid.
+func (c Config) Validate() error {
+	if c.ShardCutoverTimeout < 0 {
+		return errors.New("shard_cutover_timeout must not be negative")
+	} else if c.ShardCutoverTimeout > 0 && time.Duration(c.ShardCutoverTimeout) <= shardCutoverSettle {
+		return fmt.Errorf("shard_cutover_timeout must be 0 or longer than %s", shardCutoverSettle)
+	}
+	if c.SnapshotTTL < 0 {
+		return errors.New("snapshot_ttl must not be negative")
+	}
+	if c.SealGrace < 0 {
+		return errors.New("seal_grace must not be negative")
+	}
+	if _, err := x.NewBandwidthSchedule(c.CopyShardRate, c.CopyShardWindows); err != nil {
+		return fmt.Errorf("invalid copy shard bandwidth: %v", err)
 	}
+	return nil
 }
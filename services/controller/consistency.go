@@ -0,0 +1,287 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/logging"
+)
+
+const (
+	RepairCopy   = "copy"
+	RepairDelete = "delete"
+)
+
+// ConsistencyShard is a shard whose local presence doesn't match the ownership in meta.
+type ConsistencyShard struct {
+	ShardID  uint64 `json:"shard_id"`
+	Database string `json:"database"`
+	Rp       string `json:"retention_policy"`
+	Path     string `json:"path"`
+}
+
+// ConsistencyReport is the result of comparing local shards with meta.
+type ConsistencyReport struct {
+	CheckedAt int64 `json:"checked_at"`
+	// Missing shards are owned by this node in meta but absent locally
+	Missing []ConsistencyShard `json:"missing"`
+	// Orphan shards are present locally but not owned by this node in meta
+	Orphan []ConsistencyShard `json:"orphan"`
+	// Quarantined shards were refused by safe mode at startup, not served
+	// until repaired
+	Quarantined []QuarantinedShard `json:"quarantined,omitempty"`
+}
+
+// Consistent returns whether nothing mismatches
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.Missing) == 0 && len(r.Orphan) == 0 && len(r.Quarantined) == 0
+}
+
+// shardOps are the shards of this node being copied or deleted, so that an
+// orphan is not deleted while it's copied here before its owner is added.
+type shardOps struct {
+	mu  sync.Mutex
+	ops map[uint64]string
+}
+
+// begin marks op on shard, returning the op going on instead if there is one.
+func (o *shardOps) begin(shardID uint64, op string) (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if cur, ok := o.ops[shardID]; ok {
+		return cur, false
+	}
+	if o.ops == nil {
+		o.ops = make(map[uint64]string)
+	}
+	o.ops[shardID] = op
+	return "", true
+}
+
+func (o *shardOps) end(shardID uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.ops, shardID)
+}
+
+func (o *shardOps) copying(shardID uint64) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.ops[shardID] == shardOpCopy
+}
+
+// Ops of shardOps, told in errors as "shard %d is being <op>".
+const (
+	shardOpCopy   = "copied"
+	shardOpDelete = "deleted"
+)
+
+// localShards returns the shard directories on disk keyed by shard id
+func (s *Service) localShards() (map[uint64]ConsistencyShard, error) {
+	root := s.TSDBStore.Path()
+	shards := make(map[uint64]ConsistencyShard)
+
+	dbs, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, db := range dbs {
+		if !db.IsDir() || strings.HasPrefix(db.Name(), ".") {
+			continue
+		}
+		rps, err := ioutil.ReadDir(filepath.Join(root, db.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, rp := range rps {
+			// index directory like _series is not a retention policy
+			if !rp.IsDir() || strings.HasPrefix(rp.Name(), "_") || strings.HasPrefix(rp.Name(), ".") {
+				continue
+			}
+			dirs, err := ioutil.ReadDir(filepath.Join(root, db.Name(), rp.Name()))
+			if err != nil {
+				return nil, err
+			}
+			for _, dir := range dirs {
+				id, err := strconv.ParseUint(dir.Name(), 10, 64)
+				if !dir.IsDir() || err != nil {
+					continue
+				}
+				shards[id] = ConsistencyShard{
+					ShardID:  id,
+					Database: db.Name(),
+					Rp:       rp.Name(),
+					Path:     filepath.Join(root, db.Name(), rp.Name(), dir.Name()),
+				}
+			}
+		}
+	}
+	return shards, nil
+}
+
+// checkConsistency compares local shard directories with the shards owned by
+// this node in meta. Shard groups deleted or not started yet are ignored, so
+// are shards being copied to this node, not owned until copied.
+func (s *Service) checkConsistency() (*ConsistencyReport, error) {
+	local, err := s.localShards()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &ConsistencyReport{CheckedAt: now.UnixNano() / MILLISECOND}
+	report.Quarantined = s.quarantine.list(local)
+	for _, db := range s.MetaClient.Databases() {
+		for _, rp := range db.RetentionPolicies {
+			for _, sg := range rp.ShardGroups {
+				for _, sh := range sg.Shards {
+					if !sh.OwnedBy(s.Node.ID) {
+						continue
+					}
+					if _, ok := local[sh.ID]; ok {
+						delete(local, sh.ID)
+						continue
+					}
+					if sg.Deleted() || sg.StartTime.After(now) {
+						continue
+					}
+					report.Missing = append(report.Missing, ConsistencyShard{
+						ShardID:  sh.ID,
+						Database: db.Name,
+						Rp:       rp.Name,
+						Path:     filepath.Join(s.TSDBStore.Path(), db.Name, rp.Name, strconv.FormatUint(sh.ID, 10)),
+					})
+				}
+			}
+		}
+	}
+
+	// The rest are not owned by this node
+	for _, sh := range local {
+		if s.shardOps.copying(sh.ShardID) {
+			continue
+		}
+		report.Orphan = append(report.Orphan, sh)
+	}
+	sort.Slice(report.Missing, func(i, j int) bool { return report.Missing[i].ShardID < report.Missing[j].ShardID })
+	sort.Slice(report.Orphan, func(i, j int) bool { return report.Orphan[i].ShardID < report.Orphan[j].ShardID })
+	return report, nil
+}
+
+// consistencyLoop checks the consistency periodically and reports the
+// discrepancies in log. Nothing is repaired automatically.
+func (s *Service) consistencyLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.consistencyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			report, err := s.checkConsistency()
+			if err != nil {
+				s.Logger.Warn("Failed to check shard consistency", zap.Error(err))
+				continue
+			}
+			for _, sh := range report.Missing {
+				s.Logger.Warn("Shard owned in meta is missing locally",
+					logging.ShardID(sh.ShardID), logging.Database(sh.Database), logging.RetentionPolicy(sh.Rp))
+			}
+			for _, sh := range report.Orphan {
+				s.Logger.Warn("Local shard is not owned in meta",
+					logging.ShardID(sh.ShardID), logging.Database(sh.Database), logging.RetentionPolicy(sh.Rp))
+			}
+		}
+	}
+}
+
+// repairShard fixes a shard reported inconsistent. A missing shard is copied
+// from sourceAddr or another owner, an orphan shard is deleted unless it's
+// being copied here.
+func (s *Service) repairShard(shardID uint64, action, sourceAddr string) error {
+	if action == RepairDelete {
+		if op, ok := s.shardOps.begin(shardID, shardOpDelete); !ok {
+			return errs.Errorf(errs.KindConflict, "shard %d is being %s on this node", shardID, op)
+		}
+		defer s.shardOps.end(shardID)
+	}
+	report, err := s.checkConsistency()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case RepairCopy:
+		for _, sh := range report.Missing {
+			if sh.ShardID != shardID {
+				continue
+			}
+			if sourceAddr == "" {
+				if sourceAddr, err = s.anotherOwner(shardID); err != nil {
+					return err
+				}
+			}
+			s.Logger.Info("Repair missing shard by copying", logging.ShardID(shardID), zap.String("source", sourceAddr))
+			return s.copyShard(sourceAddr, shardID)
+		}
+		return errs.Errorf(errs.KindConflict, "shard %d is not missing on this node", shardID)
+	case RepairDelete:
+		for _, sh := range report.Orphan {
+			if sh.ShardID != shardID {
+				continue
+			}
+			s.Logger.Info("Repair orphan shard by deleting", logging.ShardID(shardID), zap.String("path", sh.Path))
+			if err := s.TSDBStore.DeleteShard(shardID); err != nil {
+				return err
+			}
+			// The directory is left if the shard is not loaded by store
+			if err := os.RemoveAll(sh.Path); err != nil {
+				return err
+			}
+			s.quarantine.release(shardID)
+			return nil
+		}
+		return errs.Errorf(errs.KindConflict, "shard %d is not an orphan on this node", shardID)
+	}
+	return errs.Errorf(errs.KindInvalidArgument, "unknown repair action: %s", action)
+}
+
+// anotherOwner returns tcp address of an owner of shard other than this node
+func (s *Service) anotherOwner(shardID uint64) (string, error) {
+	_, _, sgi := s.MetaClient.ShardOwner(shardID)
+	if sgi == nil {
+		return "", fmt.Errorf("%w: %d", errs.ErrShardNotFound, shardID)
+	}
+	nodes, err := s.MetaClient.DataNodes()
+	if err != nil {
+		return "", err
+	}
+	for _, sh := range sgi.Shards {
+		if sh.ID != shardID {
+			continue
+		}
+		for _, owner := range sh.Owners {
+			if owner.NodeID == s.Node.ID {
+				continue
+			}
+			for _, n := range nodes {
+				if n.ID == owner.NodeID {
+					return n.TCPHost, nil
+				}
+			}
+		}
+	}
+	return "", errs.ErrNoOtherOwner
+}
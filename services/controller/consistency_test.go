@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/services/migrate"
+)
+
+// consistencyMeta owns shards 1 and 2 by node 1 and shard 3 by node 2, along
+// with shard 4 of a group not started yet and shard 5 of a group deleted.
+func consistencyMeta() *fakeMetaClient {
+	future := shardGroup(2, map[uint64][]uint64{4: {1}})
+	future.StartTime = time.Now().Add(time.Hour)
+	future.EndTime = time.Now().Add(2 * time.Hour)
+	deleted := shardGroup(3, map[uint64][]uint64{5: {1}})
+	deleted.DeletedAt = time.Now()
+	return &fakeMetaClient{
+		databases: []meta.DatabaseInfo{{
+			Name: "db0",
+			RetentionPolicies: []meta.RetentionPolicyInfo{{
+				Name:        "rp0",
+				ShardGroups: []meta.ShardGroupInfo{shardGroup(1, map[uint64][]uint64{1: {1}, 2: {1}, 3: {2}}), future, deleted},
+			}},
+		}},
+		nodes: []meta.NodeInfo{{ID: 1, TCPHost: "node1:8088"}, {ID: 2, TCPHost: "node2:8088"}},
+	}
+}
+
+func shardIDs(shards []ConsistencyShard) []uint64 {
+	var ids []uint64
+	for _, sh := range shards {
+		ids = append(ids, sh.ShardID)
+	}
+	return ids
+}
+
+func TestCheckConsistency(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	store.addShard(t, "db0", "rp0", 1, true)
+	store.addShard(t, "db0", "rp0", 3, true)
+	// not in meta at all
+	store.addShard(t, "db1", "rp0", 9, false)
+	// index directories are not shards
+	os.MkdirAll(store.path+"/db0/_series/0", 0755)
+	s := newTestService(consistencyMeta(), store)
+
+	report, err := s.checkConsistency()
+	if err != nil {
+		t.Fatalf("checkConsistency() failed: %v", err)
+	}
+	if exp := []uint64{2}; !reflect.DeepEqual(shardIDs(report.Missing), exp) {
+		t.Fatalf("missing shards mismatch: got %v, exp %v", shardIDs(report.Missing), exp)
+	}
+	if exp := []uint64{3, 9}; !reflect.DeepEqual(shardIDs(report.Orphan), exp) {
+		t.Fatalf("orphan shards mismatch: got %v, exp %v", shardIDs(report.Orphan), exp)
+	}
+	if report.Consistent() {
+		t.Fatal("report of mismatches taken as consistent")
+	}
+	if exp := store.path + "/db0/rp0/2"; report.Missing[0].Path != exp {
+		t.Fatalf("missing shard path mismatch: got %v, exp %v", report.Missing[0].Path, exp)
+	}
+
+	// consistent once the mismatches are gone
+	store.addShard(t, "db0", "rp0", 2, true)
+	os.RemoveAll(store.path + "/db0/rp0/3")
+	os.RemoveAll(store.path + "/db1")
+	if report, err = s.checkConsistency(); err != nil || !report.Consistent() {
+		t.Fatalf("unexpected report: %+v, %v", report, err)
+	}
+}
+
+func TestRepairShard_Delete(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	store.addShard(t, "db0", "rp0", 1, true)
+	path := store.addShard(t, "db0", "rp0", 3, true)
+	s := newTestService(consistencyMeta(), store)
+
+	// shards owned are not deleted
+	if err := s.repairShard(1, RepairDelete, ""); errs.KindOf(err) != errs.KindConflict {
+		t.Fatalf("unexpected error deleting shard owned: %v", err)
+	}
+	if err := s.repairShard(3, RepairDelete, ""); err != nil {
+		t.Fatalf("repairShard() failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("orphan shard left: %v", err)
+	}
+	if exp := []uint64{3}; !reflect.DeepEqual(store.deleted, exp) {
+		t.Fatalf("deleted shards mismatch: got %v, exp %v", store.deleted, exp)
+	}
+	if err := s.repairShard(3, "move", ""); errs.KindOf(err) != errs.KindInvalidArgument {
+		t.Fatalf("unexpected error of unknown action: %v", err)
+	}
+}
+
+// waitTask returns the copy task of shard once queued.
+func waitTask(t *testing.T, s *Service, shardID uint64) *migrate.Task {
+	for i := 0; i < 100; i++ {
+		for _, task := range s.migrateManager.Tasks() {
+			if task.ShardId == shardID {
+				return task
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("shard %d not copied", shardID)
+	return nil
+}
+
+func TestRepairShard_Copy(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	mc := consistencyMeta()
+	s := newTestService(mc, store)
+
+	// shards not missing are not copied
+	store.addShard(t, "db0", "rp0", 1, true)
+	if err := s.repairShard(1, RepairCopy, ""); errs.KindOf(err) != errs.KindConflict {
+		t.Fatalf("unexpected error copying shard present: %v", err)
+	}
+	if err := s.repairShard(2, RepairCopy, ""); err != errs.ErrNoOtherOwner {
+		t.Fatalf("unexpected error copying shard of no other owner: %v", err)
+	}
+
+	// copied from another owner, the migrate manager is not started
+	mc.setOwner(2, 2, true)
+	done := make(chan error)
+	go func() { done <- s.repairShard(2, RepairCopy, "") }()
+	task := waitTask(t, s, 2)
+	if task.SrcHost != "node2:8088" {
+		t.Fatalf("copied from %s", task.SrcHost)
+	}
+	stop := errors.New("stopped")
+	task.C <- stop
+	if err := <-done; err != stop {
+		t.Fatalf("unexpected error of copy: %v", err)
+	}
+}
+
+func TestRepairShard_DeleteCopying(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	s := newTestService(consistencyMeta(), store)
+
+	// shard 3 of node 2 is copied here, i.e. unpacked before its owner is added
+	done := make(chan error)
+	go func() { done <- s.copyShard("node2:8088", 3) }()
+	task := waitTask(t, s, 3)
+	store.addShard(t, "db0", "rp0", 3, false)
+
+	report, err := s.checkConsistency()
+	if err != nil {
+		t.Fatalf("checkConsistency() failed: %v", err)
+	}
+	if len(report.Orphan) != 0 {
+		t.Fatalf("shard copied reported orphan: %v", shardIDs(report.Orphan))
+	}
+	if err := s.repairShard(3, RepairDelete, ""); errs.KindOf(err) != errs.KindConflict {
+		t.Fatalf("unexpected error deleting shard copied: %v", err)
+	}
+	if len(store.deleted) != 0 {
+		t.Fatalf("shard copied deleted: %v", store.deleted)
+	}
+
+	// deleted once the copy failed
+	task.C <- errors.New("stopped")
+	<-done
+	if err := s.repairShard(3, RepairDelete, ""); err != nil {
+		t.Fatalf("repairShard() failed: %v", err)
+	}
+}
@@ -0,0 +1,434 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+
+	"github.com/angopher/chronus/x"
+)
+
+// Thresholds of findings of the cluster doctor.
+const (
+	doctorMaxClockSkew      = time.Second
+	doctorDiskWarnRatio     = 0.2
+	doctorDiskCriticalRatio = 0.1
+	doctorMaxHintedAge      = time.Hour
+	// doctorMaxShardFindings bounds findings of shards under-replicated, the
+	// rest are counted by one finding
+	doctorMaxShardFindings = 20
+)
+
+// Severities of findings, in the order reported.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// Checks of the cluster doctor.
+const (
+	CheckNodeLiveness    = "node-liveness"
+	CheckClockSkew       = "clock-skew"
+	CheckDiskHeadroom    = "disk-headroom"
+	CheckHintedHandoff   = "hinted-handoff"
+	CheckShardReplicas   = "shard-replication"
+	CheckMetaQuorum      = "meta-quorum"
+	CheckMetaReplication = "meta-replication"
+	CheckMetaSnapshot    = "meta-snapshot"
+	CheckMaintenance     = "maintenance"
+)
+
+// Finding is a problem found by the cluster doctor, with commands which may
+// remedy it.
+type Finding struct {
+	Severity    string   `json:"severity"`
+	Check       string   `json:"check"`
+	Message     string   `json:"message"`
+	Remediation []string `json:"remediation,omitempty"`
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 0
+	case SeverityWarning:
+		return 1
+	}
+	return 2
+}
+
+// SortFindings orders findings by severity, then by check.
+func SortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		ri, rj := severityRank(findings[i].Severity), severityRank(findings[j].Severity)
+		if ri != rj {
+			return ri < rj
+		}
+		return findings[i].Check < findings[j].Check
+	})
+}
+
+type NodeHealthRequest struct{}
+
+// HintedHandoffLag is the hinted data queued on a node for node NodeID.
+type HintedHandoffLag struct {
+	NodeID    uint64 `json:"node_id"`
+	Pending   int64  `json:"pending"`
+	OldestAge int64  `json:"oldest_age"` // milliseconds
+	Healthy   bool   `json:"healthy"`
+}
+
+type NodeHealthResponse struct {
+	CommonResp
+	Time      int64 `json:"time"` // milliseconds
+	DiskFree  int64 `json:"disk_free"`
+	DiskTotal int64 `json:"disk_total"`
+	// DiskError is why disk space is unknown
+	DiskError     string             `json:"disk_error,omitempty"`
+	HintedHandoff []HintedHandoffLag `json:"hinted_handoff"`
+}
+
+type DoctorRequest struct{}
+
+type DoctorResponse struct {
+	CommonResp
+	Nodes    int       `json:"nodes"`
+	Shards   int       `json:"shards"`
+	Findings []Finding `json:"findings"`
+}
+
+func (s *Service) handleNodeHealth(conn net.Conn) (*NodeHealthResponse, error) {
+	var req NodeHealthRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	return s.localHealth(), nil
+}
+
+func (s *Service) nodeHealthResponse(w io.Writer, health *NodeHealthResponse, e error) {
+	var resp NodeHealthResponse
+	if health != nil {
+		resp = *health
+	}
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseNodeHealth, &resp)
+}
+
+// localHealth returns the clock, the disk space of shards and the hinted
+// data queued of this node.
+func (s *Service) localHealth() *NodeHealthResponse {
+	now := time.Now()
+	health := &NodeHealthResponse{Time: now.UnixNano() / MILLISECOND}
+	free, total, err := x.DiskSpace(s.TSDBStore.Path())
+	if err != nil {
+		health.DiskError = err.Error()
+	} else {
+		health.DiskFree, health.DiskTotal = free, total
+	}
+	if s.HintedHandoff != nil {
+		for _, l := range s.HintedHandoff.Lags(now) {
+			health.HintedHandoff = append(health.HintedHandoff, HintedHandoffLag{
+				NodeID:    l.NodeID,
+				Pending:   l.Pending,
+				OldestAge: int64(l.OldestAge / time.Millisecond),
+				Healthy:   l.Healthy,
+			})
+		}
+	}
+	return health
+}
+
+func (s *Service) handleDoctor(conn net.Conn) (*DoctorResponse, error) {
+	var req DoctorRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	return s.doctor()
+}
+
+func (s *Service) doctorResponse(w io.Writer, report *DoctorResponse, e error) {
+	var resp DoctorResponse
+	if report != nil {
+		resp = *report
+	}
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseDoctor, &resp)
+}
+
+// nodeHealth is the health of a data node as this node sees it.
+type nodeHealth struct {
+	info   meta.NodeInfo
+	health NodeHealthResponse
+	// skew is how far the clock of the node is ahead of this node
+	skew time.Duration
+	err  error
+}
+
+// doctor checks liveness, clocks, disk space and hinted handoff of all data
+// nodes and replication of shards.
+func (s *Service) doctor() (*DoctorResponse, error) {
+	nodes, err := s.MetaClient.DataNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	healths := make([]nodeHealth, len(nodes))
+	for i := range nodes {
+		healths[i].info = nodes[i]
+		wg.Add(1)
+		go func(h *nodeHealth) {
+			defer wg.Done()
+			start := time.Now()
+			if s.Node != nil && h.info.ID == s.Node.ID {
+				h.health = *s.localHealth()
+			} else {
+				h.err = requestNode(h.info.TCPHost, RequestNodeHealth, ResponseNodeHealth, &NodeHealthRequest{}, &h.health)
+				if h.err == nil && h.health.Code != 0 {
+					h.err = errors.New(h.health.Msg)
+				}
+			}
+			if h.err == nil {
+				// the node read its clock about half way through
+				rtt := time.Since(start)
+				h.skew = time.Unix(0, h.health.Time*MILLISECOND).Sub(start.Add(rtt / 2))
+			}
+		}(&healths[i])
+	}
+	wg.Wait()
+
+	self := s.selfAddr(nodes)
+	report := &DoctorResponse{Nodes: len(nodes), Findings: make([]Finding, 0)}
+	alive := make(map[uint64]bool, len(nodes))
+	// nodes in maintenance windows are expected down or behind
+	now := time.Now()
+	maintained := make(map[uint64]bool)
+	for _, n := range nodes {
+		for _, w := range s.MetaClient.NodeMaintenanceWindows(n.ID, now) {
+			maintained[n.ID] = true
+			report.Findings = append(report.Findings, Finding{
+				Severity: SeverityInfo,
+				Check:    CheckMaintenance,
+				Message: fmt.Sprintf("node %d (%s) is in maintenance window %d (%s) until %s", n.ID, n.TCPHost,
+					w.ID, w.Behavior, w.End().Format(time.RFC3339)),
+			})
+		}
+	}
+	for _, h := range healths {
+		if h.err != nil && maintained[h.info.ID] {
+			continue
+		}
+		if h.err != nil {
+			report.Findings = append(report.Findings, Finding{
+				Severity: SeverityCritical,
+				Check:    CheckNodeLiveness,
+				Message:  fmt.Sprintf("node %d (%s) is unreachable: %s", h.info.ID, h.info.TCPHost, h.err),
+				Remediation: []string{
+					fmt.Sprintf("check the influxd process and the network of %s", h.info.TCPHost),
+					fmt.Sprintf("influxd-ctl -s %s node remove %s  # if the node is lost for good", self, h.info.TCPHost),
+				},
+			})
+			continue
+		}
+		alive[h.info.ID] = true
+		report.Findings = append(report.Findings, nodeFindings(h, nodes, maintained, self)...)
+	}
+
+	shards, findings := s.replicationFindings(nodes, alive)
+	report.Shards = shards
+	report.Findings = append(report.Findings, findings...)
+	SortFindings(report.Findings)
+	return report, nil
+}
+
+// selfAddr returns the address of this node in nodes, which commands
+// suggested are sent to.
+func (s *Service) selfAddr(nodes []meta.NodeInfo) string {
+	if s.Node != nil {
+		for _, n := range nodes {
+			if n.ID == s.Node.ID {
+				return n.TCPHost
+			}
+		}
+	}
+	return "<addr>"
+}
+
+// nodeFindings checks the clock, disk space and hinted handoff of a node
+// answering. Data queued for nodes maintained is not reported.
+func nodeFindings(h nodeHealth, nodes []meta.NodeInfo, maintained map[uint64]bool, self string) []Finding {
+	var findings []Finding
+	skew := h.skew
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > doctorMaxClockSkew {
+		findings = append(findings, Finding{
+			Severity:    SeverityWarning,
+			Check:       CheckClockSkew,
+			Message:     fmt.Sprintf("clock of node %d (%s) is %v off", h.info.ID, h.info.TCPHost, h.skew.Round(time.Millisecond)),
+			Remediation: []string{fmt.Sprintf("sync the clock of %s by NTP", h.info.TCPHost)},
+		})
+	}
+
+	if h.health.DiskError != "" {
+		findings = append(findings, Finding{
+			Severity: SeverityInfo,
+			Check:    CheckDiskHeadroom,
+			Message:  fmt.Sprintf("disk space of node %d (%s) is unknown: %s", h.info.ID, h.info.TCPHost, h.health.DiskError),
+		})
+	} else if h.health.DiskTotal > 0 {
+		ratio := float64(h.health.DiskFree) / float64(h.health.DiskTotal)
+		severity := ""
+		if ratio < doctorDiskCriticalRatio {
+			severity = SeverityCritical
+		} else if ratio < doctorDiskWarnRatio {
+			severity = SeverityWarning
+		}
+		if severity != "" {
+			findings = append(findings, Finding{
+				Severity: severity,
+				Check:    CheckDiskHeadroom,
+				Message: fmt.Sprintf("node %d (%s) has %s free of %s (%.1f%%)", h.info.ID, h.info.TCPHost,
+					formatBytes(h.health.DiskFree), formatBytes(h.health.DiskTotal), ratio*100),
+				Remediation: []string{
+					fmt.Sprintf("influxd-ctl -s %s node freeze %s  # stop creating shards on it", self, h.info.TCPHost),
+					fmt.Sprintf("influxd-ctl -s %s shard node %d  # find shards to move away", self, h.info.ID),
+				},
+			})
+		}
+	}
+
+	hosts := make(map[uint64]string, len(nodes))
+	for _, n := range nodes {
+		hosts[n.ID] = n.TCPHost
+	}
+	for _, l := range h.health.HintedHandoff {
+		if maintained[l.NodeID] {
+			continue
+		}
+		age := time.Duration(l.OldestAge) * time.Millisecond
+		target := fmt.Sprint("node ", l.NodeID)
+		if host, ok := hosts[l.NodeID]; ok {
+			target = fmt.Sprintf("node %d (%s)", l.NodeID, host)
+		}
+		if !l.Healthy {
+			findings = append(findings, Finding{
+				Severity: SeverityCritical,
+				Check:    CheckHintedHandoff,
+				Message:  fmt.Sprintf("hinted handoff queue on node %d for %s fails to advance", h.info.ID, target),
+				Remediation: []string{
+					fmt.Sprintf("check the disk of %s", h.info.TCPHost),
+					fmt.Sprintf("influxd-ctl -s %s hh purge %d --before <time>  # drop data stuck", h.info.TCPHost, l.NodeID),
+				},
+			})
+		} else if l.Pending > 0 && age > doctorMaxHintedAge {
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Check:    CheckHintedHandoff,
+				Message: fmt.Sprintf("node %d queues %s for %s, oldest write queued %v ago", h.info.ID,
+					formatBytes(l.Pending), target, age.Round(time.Second)),
+				Remediation: []string{fmt.Sprintf("check the node %d is up and accepts writes", l.NodeID)},
+			})
+		}
+	}
+	return findings
+}
+
+// replicationFindings reports shards owned by less nodes than their
+// retention policies replicate, or by no live node. It returns the number
+// of shards checked as well.
+func (s *Service) replicationFindings(nodes []meta.NodeInfo, alive map[uint64]bool) (int, []Finding) {
+	hosts := make(map[uint64]string, len(nodes))
+	for _, n := range nodes {
+		hosts[n.ID] = n.TCPHost
+	}
+	self := s.selfAddr(nodes)
+
+	var (
+		findings []Finding
+		shards   int
+		more     int
+	)
+	now := time.Now()
+	for _, di := range s.MetaClient.Databases() {
+		for _, rpi := range di.RetentionPolicies {
+			for _, sgi := range rpi.ShardGroups {
+				if sgi.Deleted() || (rpi.Duration > 0 && sgi.EndTime.Before(now.Add(-rpi.Duration))) {
+					continue
+				}
+				for _, sh := range sgi.Shards {
+					shards++
+					var live []uint64
+					for _, o := range sh.Owners {
+						if alive[o.NodeID] {
+							live = append(live, o.NodeID)
+						}
+					}
+					if len(live) >= rpi.ReplicaN && len(sh.Owners) >= rpi.ReplicaN {
+						continue
+					}
+					if len(findings) >= doctorMaxShardFindings {
+						more++
+						continue
+					}
+					f := Finding{
+						Severity: SeverityWarning,
+						Check:    CheckShardReplicas,
+						Message: fmt.Sprintf("shard %d of %s.%s has %d live of %d owners, %d replicas expected",
+							sh.ID, di.Name, rpi.Name, len(live), len(sh.Owners), rpi.ReplicaN),
+					}
+					if len(live) == 0 {
+						f.Severity = SeverityCritical
+						f.Remediation = []string{fmt.Sprintf("bring back an owner of shard %d, or restore it from backup", sh.ID)}
+					} else if dst := s.copyDestination(&sh, nodes, alive); dst != "" {
+						f.Remediation = []string{fmt.Sprintf("influxd-ctl -s %s shard copy %s %d", dst, hosts[live[0]], sh.ID)}
+					} else {
+						f.Remediation = []string{fmt.Sprintf("add a data node, then copy shard %d to it", sh.ID)}
+					}
+					findings = append(findings, f)
+				}
+			}
+		}
+	}
+	if more > 0 {
+		findings = append(findings, Finding{
+			Severity:    SeverityWarning,
+			Check:       CheckShardReplicas,
+			Message:     fmt.Sprintf("%d more shards are under-replicated", more),
+			Remediation: []string{fmt.Sprintf("influxd-ctl -s %s node drain-status <addr>  # shards of a node lost", self)},
+		})
+	}
+	return shards, findings
+}
+
+// copyDestination returns a live node not owning sh nor frozen, which a copy
+// of sh could be sent to, empty if none.
+func (s *Service) copyDestination(sh *meta.ShardInfo, nodes []meta.NodeInfo, alive map[uint64]bool) string {
+	for _, n := range nodes {
+		if alive[n.ID] && !sh.OwnedBy(n.ID) && !s.MetaClient.IsDataNodeFreezed(n.ID) {
+			return n.TCPHost
+		}
+	}
+	return ""
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprint(n, " B")
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
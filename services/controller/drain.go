@@ -0,0 +1,285 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+
+	"github.com/angopher/chronus/coordinator"
+)
+
+// nodeRequestTimeout bounds requests to controllers of other nodes, within
+// the time influxd-ctl waits for a response.
+const nodeRequestTimeout = 2 * time.Second
+
+type ShardSizesRequest struct {
+	ShardIDs []uint64 `json:"shard_ids"`
+}
+
+type ShardSizesResponse struct {
+	CommonResp
+	// Sizes on disk of shards present locally
+	Sizes map[uint64]int64 `json:"sizes"`
+}
+
+type DrainStatusRequest struct {
+	DataNodeAddr string `json:"data_node_addr"`
+}
+
+// DrainShard is a shard of the node drained, not owned by as many other nodes
+// as its retention policy replicates yet.
+type DrainShard struct {
+	ShardID  uint64 `json:"shard_id"`
+	Database string `json:"database"`
+	Rp       string `json:"retention_policy"`
+	Size     int64  `json:"size"` // -1 if unknown
+	Copied   uint64 `json:"copied"`
+	// Destination is the node copying the shard, empty if not copied
+	Destination string `json:"destination,omitempty"`
+	Rate        int64  `json:"rate"`
+	ETA         int64  `json:"eta"` // seconds, -1 if unknown
+	Error       string `json:"error,omitempty"`
+}
+
+type DrainStatusResponse struct {
+	CommonResp
+	NodeID         uint64       `json:"node_id"`
+	Freezed        bool         `json:"freezed"`
+	Shards         []DrainShard `json:"shards"`
+	BytesRemaining int64        `json:"bytes_remaining"`
+	Rate           int64        `json:"rate"`
+	ETA            int64        `json:"eta"` // seconds, -1 if unknown
+	// Errors of nodes not answering, status may be incomplete then
+	Errors []string `json:"errors,omitempty"`
+}
+
+func (s *Service) handleShardSizes(conn net.Conn) (map[uint64]int64, error) {
+	var req ShardSizesRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[uint64]int64, len(req.ShardIDs))
+	for _, id := range req.ShardIDs {
+		sh := s.TSDBStore.Shard(id)
+		if sh == nil {
+			continue
+		}
+		size, err := sh.DiskSize()
+		if err != nil {
+			return nil, err
+		}
+		sizes[id] = size
+	}
+	return sizes, nil
+}
+
+func (s *Service) shardSizesResponse(w io.Writer, sizes map[uint64]int64, e error) {
+	var resp ShardSizesResponse
+	setError(&resp.CommonResp, e)
+	resp.Sizes = sizes
+	s.writeResponse(w, ResponseShardSizes, &resp)
+}
+
+func (s *Service) handleDrainStatus(conn net.Conn) (*DrainStatusResponse, error) {
+	var req DrainStatusRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+
+	ni, err := s.MetaClient.DataNodeByTCPHost(req.DataNodeAddr)
+	if err != nil {
+		return nil, err
+	} else if ni == nil {
+		return nil, fmt.Errorf("not find data node by addr:%s", req.DataNodeAddr)
+	}
+	nodes, err := s.MetaClient.DataNodes()
+	if err != nil {
+		return nil, err
+	}
+	return s.drainStatus(ni, nodes), nil
+}
+
+// drainStatus reports shards of ni to be copied before it could be removed,
+// with progress of copies on other nodes.
+func (s *Service) drainStatus(ni *meta.NodeInfo, nodes []meta.NodeInfo) *DrainStatusResponse {
+	status := &DrainStatusResponse{
+		NodeID:  ni.ID,
+		Freezed: s.MetaClient.IsDataNodeFreezed(ni.ID),
+		Shards:  make([]DrainShard, 0),
+		ETA:     -1,
+	}
+
+	remaining := make(map[uint64]*DrainShard)
+	for _, di := range s.MetaClient.Databases() {
+		for _, rpi := range di.RetentionPolicies {
+			for _, sgi := range rpi.ShardGroups {
+				if sgi.Deleted() {
+					continue
+				}
+				for _, sh := range sgi.Shards {
+					if !sh.OwnedBy(ni.ID) || len(sh.Owners)-1 >= rpi.ReplicaN {
+						continue
+					}
+					remaining[sh.ID] = &DrainShard{
+						ShardID:  sh.ID,
+						Database: di.Name,
+						Rp:       rpi.Name,
+						Size:     -1,
+						ETA:      -1,
+					}
+				}
+			}
+		}
+	}
+	if len(remaining) == 0 {
+		status.ETA = 0
+		return status
+	}
+
+	ids := make([]uint64, 0, len(remaining))
+	for id := range remaining {
+		ids = append(ids, id)
+	}
+
+	// sizes are known by the drained node, copies are run by the
+	// destination nodes
+	var (
+		wg       sync.WaitGroup
+		sizes    ShardSizesResponse
+		sizesErr error
+		copies   = make([]CopyShardStatusResponse, len(nodes))
+		errs     = make([]error, len(nodes))
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sizesErr = requestNode(ni.TCPHost, RequestShardSizes, ResponseShardSizes, &ShardSizesRequest{ShardIDs: ids}, &sizes)
+		if sizesErr == nil && sizes.Code != 0 {
+			sizesErr = errors.New(sizes.Msg)
+		}
+	}()
+	for i := range nodes {
+		if nodes[i].ID == ni.ID {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = requestNode(nodes[i].TCPHost, RequestCopyShardStatus, ResponseCopyShardStatus, struct{}{}, &copies[i])
+		}(i)
+	}
+	wg.Wait()
+
+	if sizesErr != nil {
+		status.Errors = append(status.Errors, fmt.Sprintf("node %d (%s): %s", ni.ID, ni.TCPHost, sizesErr))
+	}
+	for id, size := range sizes.Sizes {
+		if sh := remaining[id]; sh != nil {
+			sh.Size = size
+		}
+	}
+	for i, n := range nodes {
+		if n.ID == ni.ID {
+			continue
+		}
+		if errs[i] != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("node %d (%s): %s", n.ID, n.TCPHost, errs[i]))
+			continue
+		}
+		for _, t := range copies[i].Failed {
+			if sh := remaining[t.ShardID]; sh != nil && t.Source == ni.TCPHost && sh.Destination == "" {
+				sh.Destination = n.TCPHost
+				sh.Error = t.Error
+			}
+		}
+		for _, t := range copies[i].Tasks {
+			if sh := remaining[t.ShardID]; sh != nil && t.Source == ni.TCPHost {
+				sh.Destination = n.TCPHost
+				sh.Copied = t.CurrentSize
+				sh.Rate = t.Rate
+				sh.Error = ""
+			}
+		}
+	}
+
+	var unknown bool
+	for _, sh := range remaining {
+		if sh.Size < 0 {
+			unknown = true
+		} else {
+			left := sh.Size - int64(sh.Copied)
+			if left < 0 {
+				left = 0
+			}
+			status.BytesRemaining += left
+			if sh.Rate > 0 {
+				sh.ETA = left / sh.Rate
+			}
+		}
+		status.Rate += sh.Rate
+		status.Shards = append(status.Shards, *sh)
+	}
+	sort.Slice(status.Shards, func(i, j int) bool { return status.Shards[i].ShardID < status.Shards[j].ShardID })
+	if !unknown && status.Rate > 0 {
+		status.ETA = status.BytesRemaining / status.Rate
+	}
+	return status
+}
+
+func (s *Service) drainStatusResponse(w io.Writer, status *DrainStatusResponse, e error) {
+	var resp DrainStatusResponse
+	if status != nil {
+		resp = *status
+	}
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseDrainStatus, &resp)
+}
+
+// requestNode sends req to the controller of node at addr and decodes its
+// response into resp.
+func requestNode(addr string, reqTyp RequestType, respTyp ResponseType, req, resp interface{}) error {
+	return requestNodeWithin(addr, nodeRequestTimeout, reqTyp, respTyp, req, resp)
+}
+
+// requestNodeWithin is requestNode waiting up to timeout for the response.
+func requestNodeWithin(addr string, timeout time.Duration, reqTyp RequestType, respTyp ResponseType, req, resp interface{}) error {
+	conn, err := net.DialTimeout("tcp", addr, nodeRequestTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// Write the cluster multiplexing header byte
+	if _, err := conn.Write([]byte{MuxHeader}); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := coordinator.WriteTLV(conn, byte(reqTyp), buf); err != nil {
+		return err
+	}
+
+	typ, err := coordinator.ReadType(conn)
+	if err != nil {
+		return err
+	}
+	if typ != byte(respTyp) {
+		return fmt.Errorf("invalid type, exp: %d, got: %d", respTyp, typ)
+	}
+	buf, err = coordinator.ReadLV(conn, timeout)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, resp)
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+func TestDrainStatus(t *testing.T) {
+	store1, store2, store3 := newFakeStore(t), newFakeStore(t), newFakeStore(t)
+	defer store1.Close()
+	defer store2.Close()
+	defer store3.Close()
+	sh := store2.openShard(t, "db0", "rp0", 1, "cpu value=1 1")
+	size, err := sh.DiskSize()
+	if err != nil {
+		t.Fatalf("DiskSize() failed: %v", err)
+	}
+
+	// node 2 is drained, shard 2 is replicated by node 3 already and shard 3
+	// is not owned by node 2
+	mc := &fakeMetaClient{
+		databases: []meta.DatabaseInfo{{
+			Name: "db0",
+			RetentionPolicies: []meta.RetentionPolicyInfo{{
+				Name:        "rp0",
+				ReplicaN:    1,
+				ShardGroups: []meta.ShardGroupInfo{shardGroup(1, map[uint64][]uint64{1: {2}, 2: {2, 3}, 3: {1}})},
+			}},
+		}},
+		freezed: map[uint64]bool{2: true},
+	}
+	services := []*Service{newTestService(mc, store1), newTestService(mc, store2), newTestService(mc, store3)}
+	for i, s := range services {
+		s.Node = &influxdb.Node{ID: uint64(i + 1)}
+		addr, stop := serveTestService(t, s)
+		defer stop()
+		mc.nodes = append(mc.nodes, meta.NodeInfo{ID: s.Node.ID, TCPHost: addr})
+	}
+	drained := mc.nodes[1].TCPHost
+
+	// shard 1 is copied to node 3
+	done := make(chan error)
+	go func() { done <- services[2].copyShard(drained, 1) }()
+	task := waitTask(t, services[2], 1)
+
+	var resp DrainStatusResponse
+	requestService(t, services[0], RequestDrainStatus, ResponseDrainStatus, &DrainStatusRequest{DataNodeAddr: drained}, &resp)
+	if resp.Code != 0 || resp.NodeID != 2 || !resp.Freezed || len(resp.Errors) != 0 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	exp := DrainShard{ShardID: 1, Database: "db0", Rp: "rp0", Size: size, Destination: mc.nodes[2].TCPHost, ETA: -1}
+	if len(resp.Shards) != 1 || resp.Shards[0] != exp {
+		t.Fatalf("shards drained mismatch: got %+v, exp %+v", resp.Shards, exp)
+	}
+	if resp.BytesRemaining != size || resp.ETA != -1 {
+		t.Fatalf("unexpected bytes remaining %d, eta %d", resp.BytesRemaining, resp.ETA)
+	}
+
+	// nodes not answering are reported, sizes unknown then
+	stop := errors.New("stopped")
+	task.C <- stop
+	<-done
+	mc.nodes[1].TCPHost = unreachableAddr(t)
+	resp = DrainStatusResponse{}
+	requestService(t, services[0], RequestDrainStatus, ResponseDrainStatus, &DrainStatusRequest{DataNodeAddr: mc.nodes[1].TCPHost}, &resp)
+	if len(resp.Errors) != 1 || !strings.HasPrefix(resp.Errors[0], "node 2 ") {
+		t.Fatalf("node not answering not reported: %v", resp.Errors)
+	}
+	if len(resp.Shards) != 1 || resp.Shards[0].Size != -1 || resp.Shards[0].Destination != "" {
+		t.Fatalf("unexpected shards drained: %+v", resp.Shards)
+	}
+
+	// drained once node 3 owns shard 1
+	mc.setOwner(1, 3, true)
+	resp = DrainStatusResponse{}
+	requestService(t, services[0], RequestDrainStatus, ResponseDrainStatus, &DrainStatusRequest{DataNodeAddr: mc.nodes[1].TCPHost}, &resp)
+	if resp.Code != 0 || len(resp.Shards) != 0 || resp.ETA != 0 || resp.BytesRemaining != 0 {
+		t.Fatalf("unexpected response of node drained: %+v", resp)
+	}
+}
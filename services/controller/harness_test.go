@@ -0,0 +1,514 @@
+package controller
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tcp"
+	"github.com/influxdata/influxdb/tsdb"
+	"github.com/influxdata/influxdb/tsdb/index/tsi1"
+
+	"github.com/angopher/chronus/coordinator"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// fakeMetaClient serves shard ownership of databases, panicking on methods
+// not faked.
+type fakeMetaClient struct {
+	MetaClient
+
+	mu        sync.Mutex
+	databases []meta.DatabaseInfo
+	nodes     []meta.NodeInfo
+	sealed    []imeta.SealedShard
+	stale     map[uint64][]uint64
+	removed   []uint64
+	added     []uint64
+	freezed   map[uint64]bool
+	maxID     uint64
+}
+
+func (c *fakeMetaClient) Databases() []meta.DatabaseInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.databases
+}
+
+func (c *fakeMetaClient) Database(name string) *meta.DatabaseInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.databases {
+		if c.databases[i].Name == name {
+			return &c.databases[i]
+		}
+	}
+	return nil
+}
+
+func (c *fakeMetaClient) CreateDatabase(name string) (*meta.DatabaseInfo, error) {
+	return c.CreateDatabaseWithRetentionPolicy(name, &meta.RetentionPolicySpec{Name: "autogen"})
+}
+
+func (c *fakeMetaClient) CreateDatabaseWithRetentionPolicy(name string, spec *meta.RetentionPolicySpec) (*meta.DatabaseInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.databases = append(c.databases, meta.DatabaseInfo{
+		Name:                   name,
+		DefaultRetentionPolicy: spec.Name,
+		RetentionPolicies:      []meta.RetentionPolicyInfo{*spec.NewRetentionPolicyInfo()},
+	})
+	return &c.databases[len(c.databases)-1], nil
+}
+
+func (c *fakeMetaClient) CreateRetentionPolicy(database string, spec *meta.RetentionPolicySpec, makeDefault bool) (*meta.RetentionPolicyInfo, error) {
+	db := c.Database(database)
+	if db == nil {
+		return nil, influxdb.ErrDatabaseNotFound(database)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	db.RetentionPolicies = append(db.RetentionPolicies, *spec.NewRetentionPolicyInfo())
+	if makeDefault {
+		db.DefaultRetentionPolicy = spec.Name
+	}
+	return &db.RetentionPolicies[len(db.RetentionPolicies)-1], nil
+}
+
+func (c *fakeMetaClient) RetentionPolicy(database, name string) (*meta.RetentionPolicyInfo, error) {
+	db := c.Database(database)
+	if db == nil {
+		return nil, influxdb.ErrDatabaseNotFound(database)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return db.RetentionPolicy(name), nil
+}
+
+// CreateShardGroup creates a shard group of an hour if none holds timestamp,
+// of a shard owned by each node.
+func (c *fakeMetaClient) CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+	rpi, err := c.RetentionPolicy(database, policy)
+	if err != nil {
+		return nil, err
+	} else if rpi == nil {
+		return nil, influxdb.ErrRetentionPolicyNotFound(policy)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sgi := rpi.ShardGroupByTimestamp(timestamp); sgi != nil {
+		return sgi, nil
+	}
+	c.maxID++
+	sgi := meta.ShardGroupInfo{ID: c.maxID, StartTime: timestamp.Truncate(time.Hour)}
+	sgi.EndTime = sgi.StartTime.Add(time.Hour)
+	for _, n := range c.nodes {
+		c.maxID++
+		sgi.Shards = append(sgi.Shards, meta.ShardInfo{ID: c.maxID, Owners: []meta.ShardOwner{{NodeID: n.ID}}})
+	}
+	rpi.ShardGroups = append(rpi.ShardGroups, sgi)
+	return &rpi.ShardGroups[len(rpi.ShardGroups)-1], nil
+}
+
+func (c *fakeMetaClient) ShardOwner(shardID uint64) (string, string, *meta.ShardGroupInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, db := range c.databases {
+		for _, rp := range db.RetentionPolicies {
+			for i := range rp.ShardGroups {
+				for _, sh := range rp.ShardGroups[i].Shards {
+					if sh.ID == shardID {
+						return db.Name, rp.Name, &rp.ShardGroups[i]
+					}
+				}
+			}
+		}
+	}
+	return "", "", nil
+}
+
+func (c *fakeMetaClient) DataNodes() ([]meta.NodeInfo, error) {
+	return c.nodes, nil
+}
+
+func (c *fakeMetaClient) DataNodeByTCPHost(addr string) (*meta.NodeInfo, error) {
+	for i := range c.nodes {
+		if c.nodes[i].TCPHost == addr {
+			return &c.nodes[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *fakeMetaClient) SealedShards() []imeta.SealedShard {
+	return c.sealed
+}
+
+func (c *fakeMetaClient) IsDataNodeFreezed(id uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.freezed[id]
+}
+
+func (c *fakeMetaClient) DeleteDataNode(id uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.nodes[:0]
+	for _, n := range c.nodes {
+		if n.ID != id {
+			kept = append(kept, n)
+		}
+	}
+	c.nodes = kept
+	return nil
+}
+
+func (c *fakeMetaClient) DropDatabase(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.databases[:0]
+	for _, db := range c.databases {
+		if db.Name != name {
+			kept = append(kept, db)
+		}
+	}
+	c.databases = kept
+	return nil
+}
+
+func (c *fakeMetaClient) InMaintenance(nodeID uint64, now time.Time, behavior string) bool {
+	return false
+}
+
+func (c *fakeMetaClient) MarkShardsStale(nodeID uint64, shardIDs []uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stale == nil {
+		c.stale = make(map[uint64][]uint64)
+	}
+	c.stale[nodeID] = append(c.stale[nodeID], shardIDs...)
+	return nil
+}
+
+func (c *fakeMetaClient) ShardStale(id, nodeID uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sh := range c.stale[nodeID] {
+		if sh == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *fakeMetaClient) ClearStaleShard(shardID, nodeID uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kept := c.stale[nodeID][:0]
+	for _, sh := range c.stale[nodeID] {
+		if sh != shardID {
+			kept = append(kept, sh)
+		}
+	}
+	c.stale[nodeID] = kept
+	return nil
+}
+
+func (c *fakeMetaClient) RemoveShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removed = append(c.removed, uint64(shardID))
+	c.setOwner(uint64(shardID), uint64(nodeID), false)
+	return nil
+}
+
+func (c *fakeMetaClient) AddShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.added = append(c.added, uint64(shardID))
+	c.setOwner(uint64(shardID), uint64(nodeID), true)
+	return nil
+}
+
+func (c *fakeMetaClient) setOwner(shardID, nodeID uint64, owned bool) {
+	for _, db := range c.databases {
+		for _, rp := range db.RetentionPolicies {
+			for _, sg := range rp.ShardGroups {
+				for i := range sg.Shards {
+					sh := &sg.Shards[i]
+					if sh.ID != shardID {
+						continue
+					}
+					owners := sh.Owners[:0]
+					for _, o := range sh.Owners {
+						if o.NodeID != nodeID {
+							owners = append(owners, o)
+						}
+					}
+					if owned {
+						owners = append(owners, meta.ShardOwner{NodeID: nodeID})
+					}
+					sh.Owners = owners
+				}
+			}
+		}
+	}
+}
+
+// shardGroup returns a shard group of the last hour of shards owned by
+// owners, keyed by shard id.
+func shardGroup(id uint64, owners map[uint64][]uint64) meta.ShardGroupInfo {
+	sg := meta.ShardGroupInfo{
+		ID:        id,
+		StartTime: time.Now().Add(-time.Hour),
+		EndTime:   time.Now().Add(time.Hour),
+	}
+	for shardID, nodes := range owners {
+		sh := meta.ShardInfo{ID: shardID}
+		for _, n := range nodes {
+			sh.Owners = append(sh.Owners, meta.ShardOwner{NodeID: n})
+		}
+		sg.Shards = append(sg.Shards, sh)
+	}
+	return sg
+}
+
+// fakeStore is a store of shard directories under a temporary path, shards
+// loaded are given by loaded. Shards opened are served as they are, others
+// loaded are served not opened. Shards imported are kept by id as their files
+// by name.
+type fakeStore struct {
+	mu       sync.Mutex
+	path     string
+	walPath  string
+	paths    map[uint64]string
+	loaded   map[uint64]bool
+	disabled map[uint64]bool
+	deleted  []uint64
+	imported map[uint64]map[string]string
+	shards   map[uint64]*tsdb.Shard
+	sfiles   map[string]*tsdb.SeriesFile
+}
+
+func newFakeStore(t *testing.T) *fakeStore {
+	dir, err := ioutil.TempDir("", "controller_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	walPath, err := ioutil.TempDir("", "controller_test_wal")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	return &fakeStore{
+		path:     dir,
+		walPath:  walPath,
+		paths:    make(map[uint64]string),
+		loaded:   make(map[uint64]bool),
+		disabled: make(map[uint64]bool),
+		imported: make(map[uint64]map[string]string),
+		shards:   make(map[uint64]*tsdb.Shard),
+		sfiles:   make(map[string]*tsdb.SeriesFile),
+	}
+}
+
+func (s *fakeStore) Close() {
+	for _, sh := range s.shards {
+		sh.Close()
+	}
+	for _, sfile := range s.sfiles {
+		sfile.Close()
+	}
+	os.RemoveAll(s.path)
+	os.RemoveAll(s.walPath)
+}
+
+// addShard creates the directory of a local shard, loaded if load.
+func (s *fakeStore) addShard(t *testing.T, db, rp string, id uint64, load bool) string {
+	path := filepath.Join(s.path, db, rp, strconv.FormatUint(id, 10))
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatalf("failed to create shard dir: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths[id] = path
+	s.loaded[id] = load
+	return path
+}
+
+// openShard opens a tsm1 shard written with points of lines, all in files so
+// that the shard is idle.
+func (s *fakeStore) openShard(t *testing.T, db, rp string, id uint64, lines string) *tsdb.Shard {
+	path := s.addShard(t, db, rp, id, true)
+	sfile, ok := s.sfiles[db]
+	if !ok {
+		sfile = tsdb.NewSeriesFile(filepath.Join(s.path, db, tsdb.SeriesFileDirectory))
+		if err := sfile.Open(); err != nil {
+			t.Fatalf("failed to open series file: %v", err)
+		}
+		s.sfiles[db] = sfile
+	}
+	opt := tsdb.NewEngineOptions()
+	opt.IndexVersion = tsi1.IndexName
+	opt.CompactionDisabled = true
+	opt.Config.WALDir = s.walPath
+	sh := tsdb.NewShard(id, path, filepath.Join(s.walPath, db, rp, strconv.FormatUint(id, 10)), sfile, opt)
+	if err := sh.Open(); err != nil {
+		t.Fatalf("failed to open shard: %v", err)
+	}
+	points, err := models.ParsePointsString(lines)
+	if err != nil {
+		t.Fatalf("failed to parse points: %v", err)
+	}
+	if err := sh.WritePoints(points); err != nil {
+		t.Fatalf("failed to write points: %v", err)
+	}
+	dir, err := sh.CreateSnapshot()
+	if err != nil {
+		t.Fatalf("failed to write cache of shard: %v", err)
+	}
+	os.RemoveAll(dir)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shards[id] = sh
+	return sh
+}
+
+func (s *fakeStore) Path() string { return s.path }
+
+func (s *fakeStore) ShardRelativePath(id uint64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded[id] {
+		return "", fmt.Errorf("shard %d doesn't exist on this server", id)
+	}
+	return filepath.Rel(s.path, s.paths[id])
+}
+
+func (s *fakeStore) CreateShard(database, retentionPolicy string, shardID uint64, enabled bool) error {
+	path := filepath.Join(s.path, database, retentionPolicy, strconv.FormatUint(shardID, 10))
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths[shardID] = path
+	s.loaded[shardID] = true
+	return nil
+}
+
+func (s *fakeStore) DeleteShard(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, id)
+	delete(s.loaded, id)
+	if sh, ok := s.shards[id]; ok {
+		delete(s.shards, id)
+		return sh.Close()
+	}
+	return nil
+}
+
+func (s *fakeStore) Shard(id uint64) *tsdb.Shard {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded[id] {
+		return nil
+	}
+	if sh, ok := s.shards[id]; ok {
+		return sh
+	}
+	// not opened, the controller paths tested read its path only
+	return tsdb.NewShard(id, s.paths[id], "", nil, tsdb.NewEngineOptions())
+}
+
+func (s *fakeStore) ImportShard(id uint64, r io.Reader) error {
+	files := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		buf, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		files[h.Name] = string(buf)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.imported[id] = files
+	return nil
+}
+
+func (s *fakeStore) SetShardEnabled(id uint64, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disabled[id] = !enabled
+	return nil
+}
+
+// requestService sends req to s as another node or influxd-ctl does, and
+// decodes the response into resp.
+func requestService(t *testing.T, s *Service, reqTyp RequestType, respTyp ResponseType, req, resp interface{}) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		s.handleConn(server)
+	}()
+
+	buf, _ := json.Marshal(req)
+	if err := coordinator.WriteTLV(client, byte(reqTyp), buf); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	if typ, err := coordinator.ReadType(client); err != nil || typ != byte(respTyp) {
+		t.Fatalf("unexpected response %d: %v", typ, err)
+	}
+	buf, err := coordinator.ReadLV(client, time.Second)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	if err := json.Unmarshal(buf, resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+}
+
+// serveTestService serves s on a local address as influxd does, returning
+// the address and a func to stop serving.
+func serveTestService(t *testing.T, s *Service) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	mux := tcp.NewMux()
+	s.Listener = mux.Listen(MuxHeader)
+	go mux.Serve(ln)
+	s.wg.Add(1)
+	go s.serve()
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+// newTestService returns a controller of node 1 not opened.
+func newTestService(mc *fakeMetaClient, store *fakeStore) *Service {
+	s := NewService(NewConfig())
+	s.Node = &influxdb.Node{ID: 1}
+	s.MetaClient = mc
+	s.TSDBStore = store
+	return s
+}
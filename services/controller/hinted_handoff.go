@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/services/hh"
+	"go.uber.org/zap"
+)
+
+// PurgeHintedHandoffRequest drops hinted data queued on the node requested
+// for node NodeID: of shard ShardID if set, or in queue segments last
+// modified before Before otherwise.
+type PurgeHintedHandoffRequest struct {
+	NodeID  uint64 `json:"node_id"`
+	ShardID uint64 `json:"shard_id"`
+	Before  int64  `json:"before"` // milliseconds
+	Token   string `json:"token"`
+	DryRun  bool   `json:"dry_run"`
+}
+
+type PurgeHintedHandoffResponse struct {
+	CommonResp
+	Approval
+	Purged *hh.PurgeEvent `json:"purged,omitempty"`
+}
+
+func (s *Service) handlePurgeHintedHandoff(conn net.Conn) (*Approval, *hh.PurgeEvent, error) {
+	var req PurgeHintedHandoffRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, nil, err
+	}
+	return s.purgeHintedHandoff(&req)
+}
+
+func (s *Service) purgeHintedHandoffResponse(w io.Writer, approval *Approval, ev *hh.PurgeEvent, e error) {
+	var resp PurgeHintedHandoffResponse
+	setError(&resp.CommonResp, e)
+	setApproval(&resp.CommonResp, &resp.Approval, approval)
+	resp.Purged = ev
+	s.writeResponse(w, ResponsePurgeHintedHandoff, &resp)
+}
+
+func (s *Service) purgeHintedHandoff(req *PurgeHintedHandoffRequest) (*Approval, *hh.PurgeEvent, error) {
+	if s.HintedHandoff == nil {
+		return nil, nil, errors.New("hinted handoff is not supported on this node")
+	}
+	if req.ShardID == 0 && req.Before <= 0 {
+		return nil, nil, errors.New("either shard or time purged before is required")
+	}
+
+	var step string
+	if req.ShardID != 0 {
+		step = fmt.Sprintf("drop hinted data of shard %d queued for node %d", req.ShardID, req.NodeID)
+	} else {
+		step = fmt.Sprintf("drop hinted data queued for node %d before %s", req.NodeID,
+			time.Unix(0, req.Before*MILLISECOND).UTC().Format(time.RFC3339))
+	}
+	target := fmt.Sprint("node ", req.NodeID)
+	if approval, err := s.approve(req.Token, req.DryRun, ActionPurgeHintedHandoff, target, []string{step}); approval != nil || err != nil {
+		return approval, nil, err
+	}
+
+	if req.ShardID != 0 {
+		ev, err := s.HintedHandoff.PurgeShard(req.NodeID, req.ShardID)
+		return nil, ev, err
+	}
+	ev, err := s.HintedHandoff.PurgeNodeBefore(req.NodeID, time.Unix(0, req.Before*MILLISECOND))
+	return nil, ev, err
+}
+
+// hintedHandoffTransferTimeout bounds each block of a transfer of hinted data
+// to be sent and acknowledged.
+const hintedHandoffTransferTimeout = 30 * time.Second
+
+// TransferHintedHandoffRequest moves hinted data queued on the node requested
+// for node NodeID, or for all nodes if 0, to the queues of the node of
+// controller address To, e.g. before the node requested is removed. Blocks
+// are dropped here once queued there, so a transfer interrupted is resumed by
+// requesting it again.
+type TransferHintedHandoffRequest struct {
+	NodeID uint64 `json:"node_id"`
+	To     string `json:"to"`
+}
+
+// HintedHandoffTransfer is the hinted data of a node moved.
+type HintedHandoffTransfer struct {
+	NodeID uint64 `json:"node_id"`
+	Blocks int    `json:"blocks"`
+	Bytes  int64  `json:"bytes"`
+	Error  string `json:"error,omitempty"`
+}
+
+type TransferHintedHandoffResponse struct {
+	CommonResp
+	Transfers []HintedHandoffTransfer `json:"transfers"`
+}
+
+// ReceiveHintedHandoffRequest starts a stream of blocks of hinted data for
+// node NodeID between controllers. Each block follows as a length-value and
+// is acknowledged by a ReceiveHintedHandoffResponse once queued, an empty one
+// ends the stream.
+type ReceiveHintedHandoffRequest struct {
+	NodeID uint64 `json:"node_id"`
+}
+
+type ReceiveHintedHandoffResponse struct {
+	CommonResp
+}
+
+// ReplayHintedHandoffRequest moves hinted data of the queue in directory Dir
+// of the node requested, e.g. the queue directory of a node copied from a
+// coordinator removed, to the queue for node NodeID.
+type ReplayHintedHandoffRequest struct {
+	NodeID uint64 `json:"node_id"`
+	Dir    string `json:"dir"`
+}
+
+type ReplayHintedHandoffResponse struct {
+	CommonResp
+	Blocks int `json:"blocks"`
+}
+
+func (s *Service) handleTransferHintedHandoff(conn net.Conn) ([]HintedHandoffTransfer, error) {
+	var req TransferHintedHandoffRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	return s.transferHintedHandoff(&req)
+}
+
+func (s *Service) transferHintedHandoffResponse(w io.Writer, transfers []HintedHandoffTransfer, e error) {
+	var resp TransferHintedHandoffResponse
+	setError(&resp.CommonResp, e)
+	resp.Transfers = transfers
+	s.writeResponse(w, ResponseTransferHintedHandoff, &resp)
+}
+
+func (s *Service) transferHintedHandoff(req *TransferHintedHandoffRequest) ([]HintedHandoffTransfer, error) {
+	if s.HintedHandoff == nil {
+		return nil, errors.New("hinted handoff is not supported on this node")
+	}
+	if req.To == "" {
+		return nil, errors.New("address of the node transferred to is required")
+	}
+
+	nodes := []uint64{req.NodeID}
+	if req.NodeID == 0 {
+		nodes = s.HintedHandoff.Nodes()
+	}
+	var transfers []HintedHandoffTransfer
+	var failed error
+	for _, nodeID := range nodes {
+		t, err := s.transferNodeHintedHandoff(req.To, nodeID)
+		if err != nil {
+			s.Logger.Warn("transfer of hinted handoff failed", zap.Uint64("node", nodeID), zap.String("to", req.To), zap.Error(err))
+			t.Error = err.Error()
+			failed = err
+		}
+		transfers = append(transfers, t)
+	}
+	if failed != nil {
+		return transfers, fmt.Errorf("transfer of hinted data failed, request again to resume: %s", failed)
+	}
+	return transfers, nil
+}
+
+// transferNodeHintedHandoff streams the blocks queued for nodeID to the
+// controller of addr.
+func (s *Service) transferNodeHintedHandoff(addr string, nodeID uint64) (HintedHandoffTransfer, error) {
+	t := HintedHandoffTransfer{NodeID: nodeID}
+	conn, err := net.DialTimeout("tcp", addr, nodeRequestTimeout)
+	if err != nil {
+		return t, err
+	}
+	defer conn.Close()
+
+	// Write the cluster multiplexing header byte
+	if _, err := conn.Write([]byte{MuxHeader}); err != nil {
+		return t, err
+	}
+	buf, err := json.Marshal(&ReceiveHintedHandoffRequest{NodeID: nodeID})
+	if err != nil {
+		return t, err
+	}
+	if err := coordinator.WriteTLV(conn, byte(RequestReceiveHintedHandoff), buf); err != nil {
+		return t, err
+	}
+
+	t.Blocks, t.Bytes, err = s.HintedHandoff.TransferNode(nodeID, func(b []byte) error {
+		return sendHintedHandoffBlock(conn, b)
+	})
+	if err != nil {
+		return t, err
+	}
+	return t, sendHintedHandoffBlock(conn, nil)
+}
+
+// sendHintedHandoffBlock sends block b of a stream, waiting for it to be
+// acknowledged.
+func sendHintedHandoffBlock(conn net.Conn, b []byte) error {
+	conn.SetDeadline(time.Now().Add(hintedHandoffTransferTimeout))
+	if err := coordinator.WriteLV(conn, b); err != nil {
+		return err
+	}
+	typ, err := coordinator.ReadType(conn)
+	if err != nil {
+		return err
+	}
+	if typ != byte(ResponseReceiveHintedHandoff) {
+		return fmt.Errorf("invalid type, exp: %d, got: %d", ResponseReceiveHintedHandoff, typ)
+	}
+	buf, err := coordinator.ReadLV(conn, hintedHandoffTransferTimeout)
+	if err != nil {
+		return err
+	}
+	var resp ReceiveHintedHandoffResponse
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return errors.New(resp.Msg)
+	}
+	return nil
+}
+
+// handleReceiveHintedHandoff queues the blocks streamed from another
+// controller, acknowledging each one.
+func (s *Service) handleReceiveHintedHandoff(conn net.Conn) error {
+	var req ReceiveHintedHandoffRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return err
+	}
+	if s.HintedHandoff == nil {
+		return errors.New("hinted handoff is not supported on this node")
+	}
+	for {
+		b, err := coordinator.ReadLV(conn, hintedHandoffTransferTimeout)
+		if err != nil {
+			return err
+		}
+		if len(b) > 0 {
+			if err := s.HintedHandoff.Import(req.NodeID, b); err != nil {
+				return err
+			}
+		}
+		s.receiveHintedHandoffResponse(conn, nil)
+		if len(b) == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *Service) receiveHintedHandoffResponse(w io.Writer, e error) {
+	var resp ReceiveHintedHandoffResponse
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseReceiveHintedHandoff, &resp)
+}
+
+func (s *Service) handleReplayHintedHandoff(conn net.Conn) (int, error) {
+	var req ReplayHintedHandoffRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return 0, err
+	}
+	if s.HintedHandoff == nil {
+		return 0, errors.New("hinted handoff is not supported on this node")
+	}
+	if req.NodeID == 0 || req.Dir == "" {
+		return 0, errors.New("node and directory replayed are required")
+	}
+	return s.HintedHandoff.Replay(req.NodeID, req.Dir)
+}
+
+func (s *Service) replayHintedHandoffResponse(w io.Writer, blocks int, e error) {
+	var resp ReplayHintedHandoffResponse
+	setError(&resp.CommonResp, e)
+	resp.Blocks = blocks
+	s.writeResponse(w, ResponseReplayHintedHandoff, &resp)
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"time"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// maintenanceCheckInterval is how often windows opening or ending are
+// checked, they are scheduled by time rather than meta changes.
+const maintenanceCheckInterval = 10 * time.Second
+
+// maintenanceLoop drains reads of other nodes while this node is in a
+// maintenance window of behavior drain, resuming them once the window ends.
+func (s *Service) maintenanceLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(maintenanceCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.applyMaintenance(time.Now())
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyMaintenance drains or resumes reads as windows open at now tell.
+// Reads drained by hand are left drained.
+func (s *Service) applyMaintenance(now time.Time) {
+	drain := s.MetaClient.InMaintenance(s.Node.ID, now, imeta.MaintenanceDrain)
+	if drain == s.maintenanceDrained {
+		return
+	}
+	if drain {
+		if drained, _ := s.ClusterService.ReadsDrained(); drained {
+			return
+		}
+		s.ClusterService.DrainReads(true)
+		s.maintenanceDrained = true
+		s.Logger.Info("Reads drained by maintenance window")
+		return
+	}
+	s.ClusterService.DrainReads(false)
+	s.maintenanceDrained = false
+	s.Logger.Info("Reads resumed, maintenance window ended")
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type object = map[string]interface{}
+
+// OpenAPI returns the OpenAPI 3 definition of the REST API of Operations,
+// whose schemas are derived from the JSON encoding of their bodies.
+func OpenAPI(version string) ([]byte, error) {
+	g := &schemaGen{schemas: make(object)}
+	paths := make(object)
+	for _, op := range Operations {
+		o := object{
+			"operationId": op.Name,
+			"summary":     op.Summary,
+			"tags":        []string{strings.Split(strings.TrimPrefix(op.Path, "/"), "/")[0]},
+			// role required of users not admin if authentication is enabled
+			"x-operator-role": string(op.Role),
+			"responses": object{
+				"200": object{
+					"description": "the response, code is 0; or a plan to confirm with its token if destructive",
+					"content":     object{"application/json": object{"schema": g.schema(op.ResponseBody)}},
+				},
+				"default": object{
+					"description": "the request failed, its status is of kind; 403 if the operator role of the user is not enough",
+					"content":     object{"application/json": object{"schema": g.schema(reflect.TypeOf(CommonResp{}))}},
+				},
+			},
+		}
+		if op.RequestBody != nil {
+			o["requestBody"] = object{
+				"required": true,
+				"content":  object{"application/json": object{"schema": g.schema(op.RequestBody)}},
+			}
+		}
+		p := APIPrefix + op.Path
+		item, ok := paths[p].(object)
+		if !ok {
+			item = make(object)
+			paths[p] = item
+		}
+		item[strings.ToLower(op.Method)] = o
+	}
+
+	doc := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "chronus controller",
+			"description": "Operations of the controller of a data node, like influxd-ctl requests.",
+			"version":     version,
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": g.schemas,
+			"securitySchemes": object{
+				"basicAuth": object{"type": "http", "scheme": "basic"},
+				"token":     object{"type": "apiKey", "in": "header", "name": "Authorization", "description": "Token <api or session token>"},
+			},
+		},
+		// of admin users, or users of the operator role of operations, if
+		// authentication is enabled
+		"security": []object{{"basicAuth": []string{}}, {"token": []string{}}},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// schemaGen derives schemas of types as encoding/json encodes them, named
+// structs as components.
+type schemaGen struct {
+	schemas object
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (g *schemaGen) schema(t reflect.Type) object {
+	if t == timeType {
+		return object{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		// encoded its own way
+		return object{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer", "format": intFormat(t)}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return object{"type": "string", "format": "byte"}
+		}
+		return object{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// placeholder for types referring to themselves
+			g.schemas[name] = object{}
+			g.schemas[name] = g.structSchema(t)
+		}
+		return object{"$ref": "#/components/schemas/" + name}
+	}
+	return object{}
+}
+
+func intFormat(t reflect.Type) string {
+	if t.Bits() == 64 {
+		return "int64"
+	}
+	return "int32"
+}
+
+// schemaName is the name of named struct t, qualified by its package unless
+// it's of the controller.
+func schemaName(t reflect.Type) string {
+	if t.PkgPath() == reflect.TypeOf(Operation{}).PkgPath() {
+		return t.Name()
+	}
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) object {
+	props := make(object)
+	g.addFields(t, props)
+	return object{"type": "object", "properties": props}
+}
+
+// addFields adds the properties of fields of struct t, of embedded structs
+// inline.
+func (g *schemaGen) addFields(t reflect.Type, props object) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, props)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+	}
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+type DrainReadsRequest struct {
+	// Drain stops or resumes serving reads of other nodes, nil to get the
+	// status only
+	Drain *bool `json:"drain,omitempty"`
+}
+
+type DrainReadsResponse struct {
+	CommonResp
+	Drained bool `json:"drained"`
+	// InFlight is the number of reads of other nodes still being served
+	InFlight int64 `json:"in_flight"`
+}
+
+func (s *Service) handleDrainReads(conn net.Conn) (*DrainReadsResponse, error) {
+	var req DrainReadsRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	if s.ClusterService == nil {
+		return nil, errors.New("node does not serve reads of other nodes")
+	}
+
+	if req.Drain != nil {
+		s.ClusterService.DrainReads(*req.Drain)
+	}
+	drained, inFlight := s.ClusterService.ReadsDrained()
+	return &DrainReadsResponse{Drained: drained, InFlight: inFlight}, nil
+}
+
+func (s *Service) drainReadsResponse(w io.Writer, status *DrainReadsResponse, e error) {
+	var resp DrainReadsResponse
+	if status != nil {
+		resp = *status
+	}
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseDrainReads, &resp)
+}
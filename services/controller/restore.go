@@ -0,0 +1,305 @@
+package controller
+
+import (
+	"archive/tar"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/influxdata/influxdb"
+	pkgtar "github.com/influxdata/influxdb/pkg/tar"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/logging"
+)
+
+// RestoreRetentionPolicy is a retention policy of a database backed up.
+type RestoreRetentionPolicy struct {
+	Name               string `json:"name"`
+	Duration           int64  `json:"duration"`             // nanoseconds
+	ShardGroupDuration int64  `json:"shard_group_duration"` // nanoseconds
+	ReplicaN           int    `json:"replica_n"`
+	Default            bool   `json:"default"`
+}
+
+// RestoreShard is a shard backed up, Index of the shards of its shard group
+// starting at Time.
+type RestoreShard struct {
+	ShardID uint64 `json:"shard_id"`
+	Rp      string `json:"rp"`
+	Time    int64  `json:"time"` // nanoseconds
+	Index   int    `json:"index"`
+}
+
+// RestorePlanRequest plans restoring shards backed up into Database. The
+// database is created with RetentionPolicies if CreateDatabase, otherwise
+// the shards are restored into the database existing.
+type RestorePlanRequest struct {
+	Database          string                   `json:"database"`
+	CreateDatabase    bool                     `json:"create_database"`
+	RetentionPolicies []RestoreRetentionPolicy `json:"retention_policies"`
+	Shards            []RestoreShard           `json:"shards"`
+}
+
+type RestoreOwner struct {
+	NodeID  uint64 `json:"node_id"`
+	TCPHost string `json:"tcp_host"`
+}
+
+// RestoreTarget is the shard a shard backed up is restored into on Owners.
+type RestoreTarget struct {
+	ShardID uint64         `json:"shard_id"`
+	Target  uint64         `json:"target"`
+	Owners  []RestoreOwner `json:"owners"`
+}
+
+type RestorePlanResponse struct {
+	CommonResp
+	Targets []RestoreTarget `json:"targets"`
+}
+
+// RestoreShardRequest is followed by the bytes of Files in order, which are
+// imported into shard ShardID.
+type RestoreShardRequest struct {
+	ShardID uint64         `json:"shard_id"`
+	Files   []SnapshotFile `json:"files"`
+}
+
+type RestoreShardResponse struct {
+	CommonResp
+}
+
+func (s *Service) handleRestorePlan(conn net.Conn) ([]RestoreTarget, error) {
+	var req RestorePlanRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	return s.restorePlan(&req)
+}
+
+func (s *Service) restorePlanResponse(w io.Writer, targets []RestoreTarget, e error) {
+	var resp RestorePlanResponse
+	setError(&resp.CommonResp, e)
+	resp.Targets = targets
+	s.writeResponse(w, ResponseRestorePlan, &resp)
+}
+
+// restorePlan creates the database or checks it exists, then the shard group
+// of each shard backed up by current placement if missing. Shards restored
+// into a shard group of less shards share a shard.
+func (s *Service) restorePlan(req *RestorePlanRequest) ([]RestoreTarget, error) {
+	if req.CreateDatabase {
+		if err := s.createRestoreDatabase(req.Database, req.RetentionPolicies); err != nil {
+			return nil, err
+		}
+	} else if s.MetaClient.Database(req.Database) == nil {
+		return nil, influxdb.ErrDatabaseNotFound(req.Database)
+	}
+
+	nodes, err := s.MetaClient.DataNodes()
+	if err != nil {
+		return nil, err
+	}
+	addrs := make(map[uint64]string, len(nodes))
+	for _, n := range nodes {
+		addrs[n.ID] = n.TCPHost
+	}
+
+	targets := make([]RestoreTarget, 0, len(req.Shards))
+	for _, sh := range req.Shards {
+		if rpi, err := s.MetaClient.RetentionPolicy(req.Database, sh.Rp); err != nil {
+			return nil, err
+		} else if rpi == nil {
+			return nil, influxdb.ErrRetentionPolicyNotFound(sh.Rp)
+		}
+		sgi, err := s.MetaClient.CreateShardGroup(req.Database, sh.Rp, time.Unix(0, sh.Time))
+		if err != nil {
+			return nil, err
+		}
+		if len(sgi.Shards) == 0 {
+			return nil, fmt.Errorf("shard group %d has no shards", sgi.ID)
+		}
+		target := sgi.Shards[sh.Index%len(sgi.Shards)]
+		t := RestoreTarget{ShardID: sh.ShardID, Target: target.ID}
+		for _, o := range target.Owners {
+			t.Owners = append(t.Owners, RestoreOwner{NodeID: o.NodeID, TCPHost: addrs[o.NodeID]})
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// createRestoreDatabase creates a database not existing with retention
+// policies backed up.
+func (s *Service) createRestoreDatabase(name string, rps []RestoreRetentionPolicy) error {
+	if s.MetaClient.Database(name) != nil {
+		return meta.ErrDatabaseExists
+	}
+	spec := func(rp RestoreRetentionPolicy) *meta.RetentionPolicySpec {
+		duration := time.Duration(rp.Duration)
+		replicaN := rp.ReplicaN
+		return &meta.RetentionPolicySpec{
+			Name:               rp.Name,
+			Duration:           &duration,
+			ShardGroupDuration: time.Duration(rp.ShardGroupDuration),
+			ReplicaN:           &replicaN,
+		}
+	}
+
+	created := false
+	for _, rp := range rps {
+		if rp.Default {
+			if _, err := s.MetaClient.CreateDatabaseWithRetentionPolicy(name, spec(rp)); err != nil {
+				return err
+			}
+			created = true
+		}
+	}
+	if !created {
+		if _, err := s.MetaClient.CreateDatabase(name); err != nil {
+			return err
+		}
+	}
+	for _, rp := range rps {
+		if rp.Default {
+			continue
+		}
+		if _, err := s.MetaClient.CreateRetentionPolicy(name, spec(rp), false); err != nil {
+			return err
+		}
+	}
+	s.Logger.Info("Created database to restore", logging.Database(name))
+	return nil
+}
+
+func (s *Service) handleRestoreShard(conn net.Conn) error {
+	var req RestoreShardRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return err
+	}
+	return s.restoreShard(conn, &req)
+}
+
+func (s *Service) restoreShardResponse(w io.Writer, e error) {
+	var resp RestoreShardResponse
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseRestoreShard, &resp)
+}
+
+// restoreShard receives files of a shard backed up and imports them into a
+// local shard as new files, creating the shard if this node owns it but has
+// not created it yet. All files are received even if some fail, so the
+// sender reads the error.
+func (s *Service) restoreShard(r io.Reader, req *RestoreShardRequest) error {
+	var size int64
+	for _, f := range req.Files {
+		size += f.Size
+	}
+	sh, err := s.restoreTargetShard(req.ShardID)
+	if err != nil {
+		io.CopyN(ioutil.Discard, r, size)
+		return err
+	}
+	dir, err := ioutil.TempDir(sh.Path(), "restore_")
+	if err != nil {
+		io.CopyN(ioutil.Discard, r, size)
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var received error
+	for _, f := range req.Files {
+		if err := receiveRestoreFile(r, dir, f); err != nil && received == nil {
+			received = fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+	if received != nil {
+		return received
+	}
+
+	rel, err := s.TSDBStore.ShardRelativePath(req.ShardID)
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeRestoreTar(pw, rel, dir, req.Files))
+	}()
+	err = s.TSDBStore.ImportShard(req.ShardID, pr)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+	s.Logger.Info("Restored shard", logging.ShardID(req.ShardID), zap.Int("files", len(req.Files)))
+	return nil
+}
+
+func (s *Service) restoreTargetShard(id uint64) (*tsdb.Shard, error) {
+	if sh := s.TSDBStore.Shard(id); sh != nil {
+		return sh, nil
+	}
+	db, rp, sgi := s.MetaClient.ShardOwner(id)
+	if sgi == nil {
+		return nil, fmt.Errorf("%w: %d", errs.ErrShardNotFound, id)
+	}
+	for _, sh := range sgi.Shards {
+		if sh.ID == id && s.Node != nil && !sh.OwnedBy(s.Node.ID) {
+			return nil, fmt.Errorf("shard %d not owned by node %d", id, s.Node.ID)
+		}
+	}
+	if err := s.TSDBStore.CreateShard(db, rp, id, true); err != nil {
+		return nil, err
+	}
+	if sh := s.TSDBStore.Shard(id); sh != nil {
+		return sh, nil
+	}
+	return nil, fmt.Errorf("%w: %d", errs.ErrShardNotFound, id)
+}
+
+// receiveRestoreFile reads a file from r into dir, reading all its bytes even
+// if it fails to write them.
+func receiveRestoreFile(r io.Reader, dir string, f SnapshotFile) error {
+	if f.Name == "" || filepath.Base(f.Name) != f.Name || f.Name == ".." {
+		io.CopyN(ioutil.Discard, r, f.Size)
+		return fmt.Errorf("invalid file name: %q", f.Name)
+	}
+	out, err := os.OpenFile(filepath.Join(dir, f.Name), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		io.CopyN(ioutil.Discard, r, f.Size)
+		return err
+	}
+	defer out.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.CopyN(io.MultiWriter(out, h), r, f.Size); err != nil {
+		return err
+	}
+	if h.Sum32() != f.CRC {
+		return fmt.Errorf("checksum %d, expected %d", h.Sum32(), f.CRC)
+	}
+	return nil
+}
+
+// writeRestoreTar archives files of dir as files of the shard at rel.
+func writeRestoreTar(w io.Writer, rel, dir string, files []SnapshotFile) error {
+	tw := tar.NewWriter(w)
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name)
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := pkgtar.StreamFile(fi, rel, path, tw); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
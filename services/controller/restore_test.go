@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"bytes"
+	"hash/crc32"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+func TestRestorePlan(t *testing.T) {
+	mc := &fakeMetaClient{nodes: []meta.NodeInfo{{ID: 1, TCPHost: "node1:8088"}, {ID: 2, TCPHost: "node2:8088"}}}
+	s := newTestService(mc, nil)
+
+	at := time.Now().Add(-3 * time.Hour).UnixNano()
+	req := &RestorePlanRequest{
+		Database:       "db1",
+		CreateDatabase: true,
+		RetentionPolicies: []RestoreRetentionPolicy{
+			{Name: "rp1", Duration: int64(24 * time.Hour), ShardGroupDuration: int64(time.Hour), ReplicaN: 1},
+			{Name: "rp0", ShardGroupDuration: int64(time.Hour), ReplicaN: 2, Default: true},
+		},
+		Shards: []RestoreShard{
+			{ShardID: 10, Rp: "rp0", Time: at, Index: 0},
+			{ShardID: 11, Rp: "rp0", Time: at, Index: 1},
+			// of a shard group of more shards than now
+			{ShardID: 12, Rp: "rp0", Time: at, Index: 2},
+			{ShardID: 13, Rp: "rp1", Time: at, Index: 0},
+		},
+	}
+	targets, err := s.restorePlan(req)
+	if err != nil {
+		t.Fatalf("restorePlan() failed: %v", err)
+	}
+	db := mc.Database("db1")
+	if db == nil || db.DefaultRetentionPolicy != "rp0" || len(db.RetentionPolicies) != 2 {
+		t.Fatalf("unexpected database created: %+v", db)
+	}
+	if rp := db.RetentionPolicy("rp1"); rp == nil || rp.Duration != 24*time.Hour || rp.ReplicaN != 1 {
+		t.Fatalf("unexpected retention policy created: %+v", rp)
+	}
+
+	sgi, _ := mc.CreateShardGroup("db1", "rp0", time.Unix(0, at))
+	first, second := sgi.Shards[0].ID, sgi.Shards[1].ID
+	exp := []RestoreTarget{
+		{ShardID: 10, Target: first, Owners: []RestoreOwner{{NodeID: 1, TCPHost: "node1:8088"}}},
+		{ShardID: 11, Target: second, Owners: []RestoreOwner{{NodeID: 2, TCPHost: "node2:8088"}}},
+		{ShardID: 12, Target: first, Owners: []RestoreOwner{{NodeID: 1, TCPHost: "node1:8088"}}},
+	}
+	if !reflect.DeepEqual(targets[:3], exp) {
+		t.Fatalf("targets mismatch: got %+v, exp %+v", targets[:3], exp)
+	}
+	if len(targets) != 4 || targets[3].Target == first || targets[3].Target == second {
+		t.Fatalf("shard of another retention policy restored into %+v", targets)
+	}
+
+	// restored again into the database existing without creating it
+	if _, err := s.restorePlan(req); err != meta.ErrDatabaseExists {
+		t.Fatalf("unexpected error creating database existing: %v", err)
+	}
+	req.CreateDatabase = false
+	if again, err := s.restorePlan(req); err != nil || !reflect.DeepEqual(again, targets) {
+		t.Fatalf("unexpected targets restoring again: %+v, %v", again, err)
+	}
+	req.Database = "db2"
+	if _, err := s.restorePlan(req); err == nil {
+		t.Fatal("restored into database not existing")
+	}
+	req.Database = "db1"
+	req.Shards = []RestoreShard{{ShardID: 14, Rp: "rp2", Time: at}}
+	if _, err := s.restorePlan(req); err == nil {
+		t.Fatal("restored into retention policy not existing")
+	}
+}
+
+// restoreBody returns the request restoring files to shard followed by their
+// bytes.
+func restoreBody(shardID uint64, files map[string]string) (*RestoreShardRequest, *bytes.Reader) {
+	req := &RestoreShardRequest{ShardID: shardID}
+	var buf bytes.Buffer
+	for _, name := range []string{"000000001-000000001.tsm", "000000002-000000001.tsm", "fields.idx"} {
+		content, ok := files[name]
+		if !ok {
+			continue
+		}
+		req.Files = append(req.Files, SnapshotFile{Name: name, Size: int64(len(content)), CRC: crc32.ChecksumIEEE([]byte(content))})
+		buf.WriteString(content)
+	}
+	return req, bytes.NewReader(buf.Bytes())
+}
+
+func TestRestoreShard(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	store.addShard(t, "db0", "rp0", 1, true)
+	s := newTestService(consistencyMeta(), store)
+
+	files := map[string]string{"000000001-000000001.tsm": "tsm 1", "000000002-000000001.tsm": "tsm 2", "fields.idx": "fields"}
+	req, r := restoreBody(1, files)
+	if err := s.restoreShard(r, req); err != nil {
+		t.Fatalf("restoreShard() failed: %v", err)
+	}
+	exp := map[string]string{
+		"db0/rp0/1/000000001-000000001.tsm": "tsm 1",
+		"db0/rp0/1/000000002-000000001.tsm": "tsm 2",
+		"db0/rp0/1/fields.idx":              "fields",
+	}
+	if !reflect.DeepEqual(store.imported[1], exp) {
+		t.Fatalf("files imported mismatch: got %v, exp %v", store.imported[1], exp)
+	}
+
+	// shard 2 is owned but not created yet
+	req, r = restoreBody(2, map[string]string{"000000001-000000001.tsm": "tsm"})
+	if err := s.restoreShard(r, req); err != nil {
+		t.Fatalf("restoreShard() of shard not created failed: %v", err)
+	}
+	if exp := map[string]string{"db0/rp0/2/000000001-000000001.tsm": "tsm"}; !reflect.DeepEqual(store.imported[2], exp) {
+		t.Fatalf("files imported mismatch: got %v, exp %v", store.imported[2], exp)
+	}
+}
+
+func TestRestoreShard_Rejected(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	store.addShard(t, "db0", "rp0", 1, true)
+	s := newTestService(consistencyMeta(), store)
+
+	// shard 3 is owned by node 2 and the file of shard 1 is corrupted
+	req, r := restoreBody(3, map[string]string{"fields.idx": "fields"})
+	corrupted, cr := restoreBody(1, map[string]string{"000000001-000000001.tsm": "tsm 1", "fields.idx": "fields"})
+	corrupted.Files[0].CRC++
+	escaped, er := restoreBody(1, map[string]string{"fields.idx": "fields"})
+	escaped.Files[0].Name = "../fields.idx"
+	for _, tt := range []struct {
+		req *RestoreShardRequest
+		r   *bytes.Reader
+	}{{req, r}, {corrupted, cr}, {escaped, er}} {
+		if err := s.restoreShard(tt.r, tt.req); err == nil {
+			t.Fatalf("restore of %+v not rejected", tt.req)
+		}
+		// the sender reads the error after all bytes are sent
+		if tt.r.Len() != 0 {
+			t.Fatalf("%d bytes of %+v not read", tt.r.Len(), tt.req)
+		}
+	}
+	if len(store.imported) != 0 {
+		t.Fatalf("shards imported: %v", store.imported)
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/logging"
+)
+
+// Reasons local shards are quarantined by safe mode.
+const (
+	// QuarantineOrphan is a shard not owned by this node in meta.
+	QuarantineOrphan = "orphan"
+	// QuarantineMisplaced is a shard under a database or retention policy
+	// other than its own in meta.
+	QuarantineMisplaced = "misplaced"
+	// QuarantineUnloaded is a shard owned whose files failed to load.
+	QuarantineUnloaded = "unloaded"
+	// QuarantineChecksum is a sealed shard whose digest differs from the
+	// checksum verified across its owners.
+	QuarantineChecksum = "checksum"
+)
+
+// QuarantinedShard is a local shard refused by safe mode at startup. It's
+// neither read nor written until repaired.
+type QuarantinedShard struct {
+	ConsistencyShard
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+// quarantine are the shards of this node refused by safe mode, until repaired.
+type quarantine struct {
+	mu     sync.Mutex
+	shards map[uint64]QuarantinedShard
+}
+
+func (q *quarantine) add(sh QuarantinedShard) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shards == nil {
+		q.shards = make(map[uint64]QuarantinedShard)
+	}
+	q.shards[sh.ShardID] = sh
+}
+
+func (q *quarantine) release(shardID uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.shards, shardID)
+}
+
+// list returns the shards quarantined sorted by id, forgetting the ones not
+// on disk anymore.
+func (q *quarantine) list(local map[uint64]ConsistencyShard) []QuarantinedShard {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var shards []QuarantinedShard
+	for id, sh := range q.shards {
+		if _, ok := local[id]; !ok {
+			delete(q.shards, id)
+			continue
+		}
+		shards = append(shards, sh)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i].ShardID < shards[j].ShardID })
+	return shards
+}
+
+// ValidateShards cross-checks local shards with meta if safe mode is
+// enabled, before the node serves any read or write. Shards not owned, under
+// another database or retention policy than in meta, failed to load, or sealed
+// with a digest other than the one verified are disabled in store. Copies
+// owned are also marked stale in meta, so that queries read other owners and
+// the catch-up loop replaces them by copies of healthy owners. Orphans are
+// left to `influxd-ctl shard repair`.
+func (s *Service) ValidateShards() error {
+	if !s.safeMode {
+		return nil
+	}
+	start := time.Now()
+	local, err := s.localShards()
+	if err != nil {
+		return err
+	}
+
+	sealed := make(map[uint64]uint32)
+	for _, sh := range s.MetaClient.SealedShards() {
+		if sh.Verified() && !sh.Diverged {
+			sealed[sh.ShardID] = sh.Checksum
+		}
+	}
+
+	var stale []uint64
+	for id, sh := range local {
+		q := QuarantinedShard{ConsistencyShard: sh}
+		db, rp, sgi := s.MetaClient.ShardOwner(id)
+		switch {
+		case sgi == nil || !shardOwnedBy(sgi.Shards, id, s.Node.ID):
+			q.Reason = QuarantineOrphan
+		case db != sh.Database || rp != sh.Rp:
+			q.Reason = QuarantineMisplaced
+		case s.TSDBStore.Shard(id) == nil:
+			q.Reason = QuarantineUnloaded
+		default:
+			checksum, ok := sealed[id]
+			if !ok {
+				continue
+			}
+			digests, err := s.shardDigest(id)
+			if err != nil {
+				// not told apart from a shard written after its seal
+				s.Logger.Warn("Failed to digest sealed shard in safe mode", logging.ShardID(id), zap.Error(err))
+				continue
+			}
+			if digestChecksum(digests) == checksum {
+				continue
+			}
+			q.Reason = QuarantineChecksum
+		}
+
+		if s.TSDBStore.Shard(id) != nil {
+			if err := s.TSDBStore.SetShardEnabled(id, false); err != nil {
+				q.Error = err.Error()
+			}
+		}
+		if q.Reason != QuarantineOrphan {
+			stale = append(stale, id)
+		}
+		s.quarantine.add(q)
+		s.Logger.Warn("Shard quarantined by safe mode", logging.ShardID(id),
+			logging.Database(sh.Database), logging.RetentionPolicy(sh.Rp), zap.String("reason", q.Reason))
+	}
+
+	if len(stale) > 0 {
+		sort.Slice(stale, func(i, j int) bool { return stale[i] < stale[j] })
+		if err := s.MetaClient.MarkShardsStale(s.Node.ID, stale); err != nil {
+			s.Logger.Warn("Failed to mark shards quarantined stale", zap.Uint64s("shards", stale), zap.Error(err))
+		}
+	}
+	s.Logger.Info("Local shards validated by safe mode", zap.Int("shards", len(local)),
+		zap.Int("quarantined", len(s.quarantine.list(local))), zap.Duration("elapsed", time.Since(start)))
+	return nil
+}
+
+func shardOwnedBy(shards []meta.ShardInfo, shardID, nodeID uint64) bool {
+	for _, sh := range shards {
+		if sh.ID == shardID {
+			return sh.OwnedBy(nodeID)
+		}
+	}
+	return false
+}
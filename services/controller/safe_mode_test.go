@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+func quarantined(shards []QuarantinedShard) map[uint64]string {
+	reasons := make(map[uint64]string, len(shards))
+	for _, sh := range shards {
+		reasons[sh.ShardID] = sh.Reason
+	}
+	return reasons
+}
+
+// safeModeService returns a controller in safe mode of node 1 with local
+// shards:
+//   - 1 consistent
+//   - 2 under retention policy rp1
+//   - 3 owned by node 2 only
+//   - 4 failed to load
+//   - 6 and 7 sealed and verified, the checksum of 7 differing
+func safeModeService(t *testing.T, store *fakeStore) (*Service, *fakeMetaClient) {
+	mc := consistencyMeta()
+	sealed := shardGroup(4, map[uint64][]uint64{6: {1, 2}, 7: {1, 2}})
+	mc.databases[0].RetentionPolicies[0].ShardGroups = append(mc.databases[0].RetentionPolicies[0].ShardGroups, sealed)
+
+	store.openShard(t, "db0", "rp0", 1, "cpu value=1 1")
+	store.openShard(t, "db0", "rp1", 2, "cpu value=2 1")
+	store.openShard(t, "db0", "rp0", 3, "cpu value=3 1")
+	store.addShard(t, "db0", "rp0", 4, false)
+	store.openShard(t, "db0", "rp0", 6, "cpu value=6 1\nmem value=6 1")
+	store.openShard(t, "db0", "rp0", 7, "cpu value=7 1")
+
+	s := newTestService(mc, store)
+	s.safeMode = true
+	s.shardCutoverTimeout = 0
+	for _, id := range []uint64{6, 7} {
+		digests, err := s.shardDigest(id)
+		if err != nil {
+			t.Fatalf("shardDigest() failed: %v", err)
+		}
+		checksum := digestChecksum(digests)
+		if id == 7 {
+			checksum++
+		}
+		mc.sealed = append(mc.sealed, imeta.SealedShard{ShardID: id, ShardGroupID: 4, VerifiedAt: time.Now(), Checksum: checksum})
+	}
+	return s, mc
+}
+
+func TestValidateShards(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	s, mc := safeModeService(t, store)
+
+	if err := s.ValidateShards(); err != nil {
+		t.Fatalf("ValidateShards() failed: %v", err)
+	}
+	report, err := s.checkConsistency()
+	if err != nil {
+		t.Fatalf("checkConsistency() failed: %v", err)
+	}
+	exp := map[uint64]string{2: QuarantineMisplaced, 3: QuarantineOrphan, 4: QuarantineUnloaded, 7: QuarantineChecksum}
+	if got := quarantined(report.Quarantined); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("shards quarantined mismatch: got %v, exp %v", got, exp)
+	}
+	if report.Consistent() {
+		t.Fatal("report of shards quarantined taken as consistent")
+	}
+
+	// shards loaded are disabled, the ones owned are marked stale
+	if exp := map[uint64]bool{2: true, 3: true, 7: true}; !reflect.DeepEqual(store.disabled, exp) {
+		t.Fatalf("shards disabled mismatch: got %v, exp %v", store.disabled, exp)
+	}
+	if exp := map[uint64][]uint64{1: {2, 4, 7}}; !reflect.DeepEqual(mc.stale, exp) {
+		t.Fatalf("shards marked stale mismatch: got %v, exp %v", mc.stale, exp)
+	}
+}
+
+func TestValidateShards_Disabled(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	s, mc := safeModeService(t, store)
+	s.safeMode = false
+
+	if err := s.ValidateShards(); err != nil {
+		t.Fatalf("ValidateShards() failed: %v", err)
+	}
+	if len(s.quarantine.list(map[uint64]ConsistencyShard{2: {}, 3: {}, 4: {}, 7: {}})) != 0 || len(store.disabled) != 0 || len(mc.stale) != 0 {
+		t.Fatal("shards quarantined out of safe mode")
+	}
+}
+
+func TestQuarantine_Release(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	s, mc := safeModeService(t, store)
+	if err := s.ValidateShards(); err != nil {
+		t.Fatalf("ValidateShards() failed: %v", err)
+	}
+
+	// the orphan is released once deleted
+	if err := s.repairShard(3, RepairDelete, ""); err != nil {
+		t.Fatalf("repairShard() failed: %v", err)
+	}
+
+	// the copy owned is released once caught up from node 2
+	done := make(chan error)
+	go func() { done <- s.catchUpShard(7) }()
+	waitTask(t, s, 7).C <- nil
+	if err := <-done; err != nil {
+		t.Fatalf("catchUpShard() failed: %v", err)
+	}
+	if mc.ShardStale(7, 1) {
+		t.Fatal("shard caught up still stale")
+	}
+	_, _, sgi := mc.ShardOwner(7)
+	if !shardOwnedBy(sgi.Shards, 7, 1) {
+		t.Fatal("shard caught up not owned again")
+	}
+
+	report, err := s.checkConsistency()
+	if err != nil {
+		t.Fatalf("checkConsistency() failed: %v", err)
+	}
+	exp := map[uint64]string{2: QuarantineMisplaced, 4: QuarantineUnloaded}
+	if got := quarantined(report.Quarantined); !reflect.DeepEqual(got, exp) {
+		t.Fatalf("shards quarantined mismatch: got %v, exp %v", got, exp)
+	}
+}
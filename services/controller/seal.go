@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/logging"
+)
+
+// sealCheckInterval is how often shard groups are sealed and sealed shards
+// compacted and verified.
+const sealCheckInterval = time.Minute
+
+// sealLoop seals shard groups ended sealGrace ago periodically.
+func (s *Service) sealLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(sealCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			s.sealShards()
+		}
+	}
+}
+
+// sealShards seals shard groups ended sealGrace ago, schedules full
+// compactions of local copies of shards sealed once, and verifies copies of
+// sealed shards this node is the first owner of across their owners. Shards
+// not verified, e.g. as some copy is not idle yet, are tried again next time.
+func (s *Service) sealShards() {
+	if sealed, err := s.MetaClient.SealShardGroups(s.sealGrace); err != nil {
+		s.Logger.Warn("Failed to seal shard groups", zap.Error(err))
+	} else if sealed > 0 {
+		s.Logger.Info("Shard groups sealed", zap.Int("shards", sealed))
+	}
+
+	for _, sealed := range s.MetaClient.SealedShards() {
+		select {
+		case <-s.closing:
+			return
+		default:
+		}
+
+		if !s.sealCompacted[sealed.ShardID] {
+			if sh := s.TSDBStore.Shard(sealed.ShardID); sh != nil {
+				if err := sh.ScheduleFullCompaction(); err != nil {
+					s.Logger.Warn("Failed to compact sealed shard", logging.ShardID(sealed.ShardID), zap.Error(err))
+				} else {
+					s.sealCompacted[sealed.ShardID] = true
+				}
+			}
+		}
+
+		if sealed.Verified() || !s.firstOwner(sealed.ShardID) {
+			continue
+		}
+		report, err := s.verifyShard(sealed.ShardID)
+		if err != nil {
+			s.Logger.Warn("Failed to verify sealed shard", logging.ShardID(sealed.ShardID), zap.Error(err))
+			continue
+		}
+		answered := len(report.Owners) > 0
+		for _, o := range report.Owners {
+			if o.Error != "" {
+				answered = false
+			}
+		}
+		if !answered {
+			continue
+		}
+		checksum := report.Owners[0].Checksum
+		if err := s.MetaClient.SetSealedShardChecksum(sealed.ShardID, checksum, report.Diverged()); err != nil {
+			s.Logger.Warn("Failed to record checksum of sealed shard", logging.ShardID(sealed.ShardID), zap.Error(err))
+			continue
+		}
+		if report.Diverged() {
+			s.Logger.Warn("Copies of sealed shard diverge",
+				logging.ShardID(sealed.ShardID), zap.Int("series", report.DiffCount))
+		}
+	}
+
+	// shards not sealed anymore are dropped
+	if len(s.sealCompacted) > 0 {
+		ids := make(map[uint64]bool)
+		for _, sealed := range s.MetaClient.SealedShards() {
+			ids[sealed.ShardID] = true
+		}
+		for id := range s.sealCompacted {
+			if !ids[id] {
+				delete(s.sealCompacted, id)
+			}
+		}
+	}
+}
+
+// firstOwner tells whether this node is the first owner of shard, which
+// verifies its copies.
+func (s *Service) firstOwner(shardID uint64) bool {
+	_, _, sgi := s.MetaClient.ShardOwner(shardID)
+	if sgi == nil {
+		return false
+	}
+	for _, sh := range sgi.Shards {
+		if sh.ID == shardID {
+			return len(sh.Owners) > 0 && sh.Owners[0].NodeID == s.Node.ID
+		}
+	}
+	return false
+}
@@ -18,7 +18,11 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/services/hh"
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/angopher/chronus/services/migrate"
+	"github.com/angopher/chronus/x"
 )
 
 const (
@@ -27,25 +31,80 @@ const (
 	MILLISECOND = 1e6
 )
 
+// MetaClient is the part of imeta.MetaClient used by the controller.
+type MetaClient interface {
+	TruncateShardGroups(t time.Time) error
+	DeleteDataNode(id uint64) error
+	IsDataNodeFreezed(id uint64) bool
+	FreezeDataNode(id uint64) error
+	DropDatabase(name string) error
+	Database(name string) *meta.DatabaseInfo
+	UnfreezeDataNode(id uint64) error
+	DataNodeByTCPHost(addr string) (*meta.NodeInfo, error)
+	RemoveShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error
+	DataNodes() ([]meta.NodeInfo, error)
+	RetentionPolicy(database, name string) (*meta.RetentionPolicyInfo, error)
+	Databases() []meta.DatabaseInfo
+
+	ShardOwner(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo)
+	AddShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error
+	ClusterConfig() imeta.ClusterConfig
+	WaitForClusterConfigChanged() chan struct{}
+	BeginShardCutover(shardID, nodeID uint64, expiration time.Time) error
+	EndShardCutover(shardID uint64) error
+	CreateDatabase(name string) (*meta.DatabaseInfo, error)
+	CreateDatabaseWithRetentionPolicy(name string, spec *meta.RetentionPolicySpec) (*meta.DatabaseInfo, error)
+	CreateRetentionPolicy(database string, spec *meta.RetentionPolicySpec, makeDefault bool) (*meta.RetentionPolicyInfo, error)
+	CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error)
+	FreezeShardGroups(id string, until time.Time) ([]byte, error)
+	ThawShardGroups(id string) error
+	ShardStale(id, nodeID uint64) bool
+	StaleShards(nodeID uint64) []imeta.StaleShard
+	ClearStaleShard(shardID, nodeID uint64) error
+	InMaintenance(nodeID uint64, now time.Time, behavior string) bool
+	NodeMaintenanceWindows(nodeID uint64, now time.Time) []imeta.MaintenanceWindow
+	SealedShards() []imeta.SealedShard
+	SealShardGroups(grace time.Duration) (int, error)
+	SetSealedShardChecksum(shardID uint64, checksum uint32, diverged bool) error
+	MarkShardsStale(nodeID uint64, shardIDs []uint64) error
+}
+
+var _ MetaClient = imeta.MetaClient(nil)
+
 type Service struct {
-	wg sync.WaitGroup
+	wg      sync.WaitGroup
+	closing chan struct{}
 
 	Node *influxdb.Node
 
-	MetaClient interface {
-		TruncateShardGroups(t time.Time) error
-		DeleteDataNode(id uint64) error
-		IsDataNodeFreezed(id uint64) bool
-		FreezeDataNode(id uint64) error
-		UnfreezeDataNode(id uint64) error
-		DataNodeByTCPHost(addr string) (*meta.NodeInfo, error)
-		RemoveShardOwner(shardID, nodeID uint64) error
-		DataNodes() ([]meta.NodeInfo, error)
-		RetentionPolicy(database, name string) (*meta.RetentionPolicyInfo, error)
-		Databases() []meta.DatabaseInfo
+	MetaClient MetaClient
+
+	// ClusterExecutor deletes databases on all nodes owning their shards.
+	ClusterExecutor interface {
+		DeleteDatabase(database string) error
+	}
+
+	// ClusterService serves reads of other nodes, which may be drained.
+	ClusterService interface {
+		DrainReads(drained bool)
+		ReadsDrained() (drained bool, inFlight int64)
+	}
+
+	// HintedHandoff drops and moves hinted data queued on this node, optional
+	HintedHandoff interface {
+		PurgeNodeBefore(nodeID uint64, t time.Time) (*hh.PurgeEvent, error)
+		PurgeShard(nodeID, shardID uint64) (*hh.PurgeEvent, error)
+		Lags(now time.Time) []hh.NodeLag
+		Nodes() []uint64
+		TransferNode(nodeID uint64, fn func(b []byte) error) (int, int64, error)
+		Import(nodeID uint64, b []byte) error
+		Replay(nodeID uint64, dir string) (int, error)
+	}
 
-		ShardOwner(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo)
-		AddShardOwner(shardID, nodeID uint64) error
+	// WriteBacklogs are the shard writes data nodes have in flight as this
+	// node saw them last, optional
+	WriteBacklogs interface {
+		Backlog(nodeID uint64) (coordinator.WriteBacklog, bool)
 	}
 
 	TSDBStore interface {
@@ -54,19 +113,74 @@ type Service struct {
 		CreateShard(database, retentionPolicy string, shardID uint64, enabled bool) error
 		DeleteShard(id uint64) error
 		Shard(id uint64) *tsdb.Shard
+		ImportShard(id uint64, r io.Reader) error
+		SetShardEnabled(id uint64, enabled bool) error
 	}
 
 	Listener net.Listener
 	Logger   *zap.Logger
 
 	migrateManager *migrate.Manager
+	approvals      *approvals
+
+	// copy shard bandwidth of the config, the rate may be overridden by the
+	// cluster config
+	copyShardRate    int64
+	copyShardWindows []x.BandwidthWindow
+
+	consistencyCheckInterval time.Duration
+	shardCutoverTimeout      time.Duration
+
+	shardReportInterval time.Duration
+	shardReports        shardReports
+
+	snapshotTTL       time.Duration
+	snapshotChecksums snapshotChecksums
+
+	catchUpInterval time.Duration
+	catchUps        catchUps
+
+	// whether reads were drained by a maintenance window, resumed once it
+	// ends
+	maintenanceDrained bool
+
+	sealGrace time.Duration
+	// sealed shards of this node scheduled for full compaction
+	sealCompacted map[uint64]bool
+
+	safeMode   bool
+	quarantine quarantine
+
+	shardOps shardOps
 }
 
 // NewService returns a new instance of Service.
 func NewService(c Config) *Service {
+	approvalTimeout := time.Duration(c.ApprovalTimeout)
+	if approvalTimeout <= 0 {
+		approvalTimeout = DefaultApprovalTimeout
+	}
+	migrateManager := migrate.NewManager(c.MaxShardCopyTasks)
+	// the config is validated
+	if schedule, err := x.NewBandwidthSchedule(c.CopyShardRate, c.CopyShardWindows); err == nil {
+		migrateManager.SetBandwidth(schedule)
+	}
 	return &Service{
 		Logger:         zap.NewNop(),
-		migrateManager: migrate.NewManager(c.MaxShardCopyTasks),
+		migrateManager: migrateManager,
+		approvals:      newApprovals(approvalTimeout),
+
+		copyShardRate:    c.CopyShardRate,
+		copyShardWindows: c.CopyShardWindows,
+
+		consistencyCheckInterval: time.Duration(c.ConsistencyCheckInterval),
+		shardCutoverTimeout:      time.Duration(c.ShardCutoverTimeout),
+		shardReportInterval:      time.Duration(c.ShardReportInterval),
+		snapshotTTL:              time.Duration(c.SnapshotTTL),
+		catchUpInterval:          time.Duration(c.CatchUpInterval),
+		sealGrace:                time.Duration(c.SealGrace),
+		sealCompacted:            make(map[uint64]bool),
+		safeMode:                 c.SafeMode,
 	}
 }
 
@@ -74,9 +188,44 @@ func NewService(c Config) *Service {
 func (s *Service) Open() error {
 	s.Logger.Info("Starting controller service")
 
+	s.closing = make(chan struct{})
+
 	s.wg.Add(1)
 	s.migrateManager.Start()
 	go s.serve()
+
+	if s.consistencyCheckInterval > 0 {
+		s.wg.Add(1)
+		go s.consistencyLoop()
+	}
+
+	if s.shardReportInterval > 0 {
+		s.wg.Add(1)
+		go s.shardReportLoop()
+	}
+
+	if s.snapshotTTL > 0 {
+		s.wg.Add(1)
+		go s.snapshotSweepLoop()
+	}
+
+	if s.catchUpInterval > 0 {
+		s.wg.Add(1)
+		go s.catchUpLoop()
+	}
+
+	if s.sealGrace > 0 {
+		s.wg.Add(1)
+		go s.sealLoop()
+	}
+
+	s.wg.Add(1)
+	go s.clusterConfigLoop()
+
+	if s.ClusterService != nil {
+		s.wg.Add(1)
+		go s.maintenanceLoop()
+	}
 	return nil
 }
 
@@ -88,6 +237,9 @@ func (s *Service) Close() error {
 		}
 	}
 	s.migrateManager.Close()
+	if s.closing != nil {
+		close(s.closing)
+	}
 	s.wg.Wait()
 	return nil
 }
@@ -139,20 +291,20 @@ func (s *Service) handleConn(conn net.Conn) error {
 		err = s.handleTruncateShard(conn)
 		s.truncateShardResponse(conn, err)
 	case RequestCopyShard:
-		err = s.handleCopyShard(conn)
-		s.copyShardResponse(conn, err)
+		plan, err := s.handleCopyShard(conn)
+		s.copyShardResponse(conn, plan, err)
 	case RequestCopyShardStatus:
-		tasks := s.handleCopyShardStatus(conn)
-		s.copyShardStatusResponse(conn, tasks)
+		tasks, failed := s.handleCopyShardStatus(conn)
+		s.copyShardStatusResponse(conn, tasks, failed)
 	case RequestKillCopyShard:
 		err = s.handleKillCopyShard(conn)
 		s.killCopyShardResponse(conn, err)
 	case RequestRemoveShard:
-		err = s.handleRemoveShard(conn)
-		s.removeShardResponse(conn, err)
+		approval, err := s.handleRemoveShard(conn)
+		s.removeShardResponse(conn, approval, err)
 	case RequestRemoveDataNode:
-		err = s.handleRemoveDataNode(conn)
-		s.removeDataNodeResponse(conn, err)
+		approval, err := s.handleRemoveDataNode(conn)
+		s.removeDataNodeResponse(conn, approval, err)
 	case RequestShowDataNodes:
 		nodes, err := s.handleShowDataNodes()
 		s.showDataNodesResponse(conn, nodes, err)
@@ -168,6 +320,76 @@ func (s *Service) handleConn(conn net.Conn) error {
 	case RequestFreezeDataNode:
 		err = s.handleFreezeDataNode(conn)
 		s.freezeDataNodeResponse(conn, err)
+	case RequestCheckConsistency:
+		report, err := s.checkConsistency()
+		s.checkConsistencyResponse(conn, report, err)
+	case RequestRepairShard:
+		err = s.handleRepairShard(conn)
+		s.repairShardResponse(conn, err)
+	case RequestDropDatabase:
+		approval, err := s.handleDropDatabase(conn)
+		s.dropDatabaseResponse(conn, approval, err)
+	case RequestShardSizes:
+		sizes, err := s.handleShardSizes(conn)
+		s.shardSizesResponse(conn, sizes, err)
+	case RequestDrainStatus:
+		status, err := s.handleDrainStatus(conn)
+		s.drainStatusResponse(conn, status, err)
+	case RequestDrainReads:
+		status, err := s.handleDrainReads(conn)
+		s.drainReadsResponse(conn, status, err)
+	case RequestShardReport:
+		shards, err := s.handleShardReport(conn)
+		s.shardReportResponse(conn, shards, err)
+	case RequestShardDigest:
+		series, err := s.handleShardDigest(conn)
+		s.shardDigestResponse(conn, series, err)
+	case RequestVerifyShard:
+		report, err := s.handleVerifyShard(conn)
+		s.verifyShardResponse(conn, report, err)
+	case RequestClusterSnapshot:
+		snapshot, err := s.handleClusterSnapshot()
+		s.clusterSnapshotResponse(conn, snapshot, err)
+	case RequestSnapshotShards:
+		shards, err := s.handleSnapshotShards(conn)
+		s.snapshotShardsResponse(conn, shards, err)
+	case RequestReleaseSnapshot:
+		err = s.handleReleaseSnapshot(conn)
+		s.releaseSnapshotResponse(conn, err)
+	case RequestRemoveSnapshot:
+		removed, err := s.handleRemoveSnapshot(conn)
+		s.removeSnapshotResponse(conn, removed, err)
+	case RequestSnapshotFile:
+		f, size, err := s.handleSnapshotFile(conn)
+		s.snapshotFileResponse(conn, f, size, err)
+	case RequestRestorePlan:
+		targets, err := s.handleRestorePlan(conn)
+		s.restorePlanResponse(conn, targets, err)
+	case RequestRestoreShard:
+		err = s.handleRestoreShard(conn)
+		s.restoreShardResponse(conn, err)
+	case RequestPurgeHintedHandoff:
+		approval, ev, err := s.handlePurgeHintedHandoff(conn)
+		s.purgeHintedHandoffResponse(conn, approval, ev, err)
+	case RequestCatchUpStatus:
+		shards, err := s.handleCatchUpStatus(conn)
+		s.catchUpStatusResponse(conn, shards, err)
+	case RequestNodeHealth:
+		health, err := s.handleNodeHealth(conn)
+		s.nodeHealthResponse(conn, health, err)
+	case RequestDoctor:
+		report, err := s.handleDoctor(conn)
+		s.doctorResponse(conn, report, err)
+	case RequestTransferHintedHandoff:
+		transfers, err := s.handleTransferHintedHandoff(conn)
+		s.transferHintedHandoffResponse(conn, transfers, err)
+	case RequestReceiveHintedHandoff:
+		if err = s.handleReceiveHintedHandoff(conn); err != nil {
+			s.receiveHintedHandoffResponse(conn, err)
+		}
+	case RequestReplayHintedHandoff:
+		blocks, err := s.handleReplayHintedHandoff(conn)
+		s.replayHintedHandoffResponse(conn, blocks, err)
 	}
 
 	return nil
@@ -210,24 +432,28 @@ func (s *Service) truncateShardResponse(w io.Writer, e error) {
 	}
 }
 
-func (s *Service) handleCopyShard(conn net.Conn) error {
+func (s *Service) handleCopyShard(conn net.Conn) ([]string, error) {
 	var req CopyShardRequest
 	if err := s.readRequest(conn, &req); err != nil {
-		return err
+		return nil, err
 	}
 
-	return s.copyShard(req.SourceNodeAddr, req.ShardID)
+	if req.DryRun {
+		return s.copyShardPlan(req.SourceNodeAddr, req.ShardID)
+	}
+	return nil, s.copyShard(req.SourceNodeAddr, req.ShardID)
 }
 
-func (s *Service) copyShardResponse(w io.Writer, e error) {
+func (s *Service) copyShardResponse(w io.Writer, plan []string, e error) {
 	// Build response.
-	var resp CommonResp
-	if e != nil {
-		resp.Code = 1
-		resp.Msg = e.Error()
-	} else {
-		resp.Code = 0
-		resp.Msg = "ok"
+	var resp CopyShardResponse
+	resp.Plan = plan
+	if plan != nil {
+		resp.Rate = s.migrateManager.Bandwidth().RateAt(time.Now())
+	}
+	setError(&resp.CommonResp, e)
+	if e == nil && plan != nil {
+		resp.Msg = "dry run"
 	}
 
 	// Marshal response to binary.
@@ -250,6 +476,12 @@ func toCopyTask(t *migrate.Task) CopyShardTask {
 	task.Rp = t.Retention
 	task.ShardID = t.ShardId
 	task.Source = t.SrcHost
+	if elapsed := time.Now().Unix() - t.StartTime; t.Started && elapsed > 0 {
+		task.Rate = int64(t.Copied) / elapsed
+	}
+	if t.Error != nil {
+		task.Error = t.Error.Error()
+	}
 	return task
 }
 
@@ -280,21 +512,27 @@ func (s *Service) readRequest(conn net.Conn, obj interface{}) error {
 	return nil
 }
 
-func (s *Service) handleCopyShardStatus(conn net.Conn) []CopyShardTask {
+func (s *Service) handleCopyShardStatus(conn net.Conn) ([]CopyShardTask, []CopyShardTask) {
 	tasks := s.migrateManager.Tasks()
 	result := make([]CopyShardTask, len(tasks))
 	for i, t := range tasks {
 		result[i] = toCopyTask(t)
 	}
-	return result
+	failures := s.migrateManager.Failures()
+	failed := make([]CopyShardTask, len(failures))
+	for i, t := range failures {
+		failed[i] = toCopyTask(t)
+	}
+	return result, failed
 }
 
-func (s *Service) copyShardStatusResponse(w io.Writer, tasks []CopyShardTask) {
+func (s *Service) copyShardStatusResponse(w io.Writer, tasks, failed []CopyShardTask) {
 	// Build response.
 	var resp CopyShardStatusResponse
 	resp.Code = 0
 	resp.Msg = "ok"
 	resp.Tasks = tasks
+	resp.Failed = failed
 	s.writeResponse(w, ResponseCopyShardStatus, &resp)
 }
 
@@ -315,71 +553,253 @@ func (s *Service) killCopyShardResponse(w io.Writer, e error) {
 	s.writeResponse(w, ResponseKillCopyShard, &resp)
 }
 
-func (s *Service) handleRemoveShard(conn net.Conn) error {
+// approve returns the plan of action on target to be confirmed if token is
+// empty, or confirms it with token otherwise. A dry run returns the plan
+// without a token. The action is executed only if neither an approval nor an
+// error is returned.
+func (s *Service) approve(token string, dryRun bool, action, target string, plan []string) (*Approval, error) {
+	if dryRun {
+		return &Approval{Plan: plan}, nil
+	}
+	if token == "" {
+		return s.approvals.propose(action, target, plan, time.Now())
+	}
+	if err := s.approvals.confirm(token, action, target, plan, time.Now()); err != nil {
+		return nil, err
+	}
+	s.Logger.Info("Destructive operation confirmed", zap.String("action", action), zap.String("target", target))
+	return nil, nil
+}
+
+// setApproval sets approval waiting for confirmation in a response.
+func setApproval(resp *CommonResp, dst *Approval, approval *Approval) {
+	if approval == nil {
+		return
+	}
+	*dst = *approval
+	if approval.Token == "" {
+		resp.Msg = "dry run"
+	} else {
+		resp.Msg = "confirmation required"
+	}
+}
+
+func (s *Service) handleRemoveShard(conn net.Conn) (*Approval, error) {
 	s.Logger.Info("handleRemoveShard")
 	var req RemoveShardRequest
 	if err := s.readRequest(conn, &req); err != nil {
-		return err
+		return nil, err
 	}
 
 	ni, err := s.MetaClient.DataNodeByTCPHost(req.DataNodeAddr)
 	if err != nil {
 		s.Logger.Error("DataNodeByTCPHost fail.", zap.Error(err))
-		return err
+		return nil, err
 	} else if ni == nil {
-		err = fmt.Errorf("not find data node by addr:%s", req.DataNodeAddr)
+		err = fmt.Errorf("%w by addr: %s", errs.ErrNodeNotFound, req.DataNodeAddr)
 		s.Logger.Error("DataNodeByTCPHost fail.", zap.Error(err))
-		return err
+		return nil, err
+	}
+
+	if s.Node.ID != ni.ID {
+		return nil, errs.Errorf(errs.KindInvalidArgument, "invalid DataNodeAddr:%s", req.DataNodeAddr)
+	}
+	shard := s.TSDBStore.Shard(req.ShardID)
+	if shard == nil {
+		return nil, errs.ErrShardNotFound
 	}
 
-	if s.Node.ID == ni.ID {
-		shard := s.TSDBStore.Shard(req.ShardID)
-		if shard == nil {
-			return errors.New("Shard not found")
+	plan := s.removeShardPlan(req.ShardID, ni)
+	if approval, err := s.approve(req.Token, req.DryRun, ActionRemoveShard, fmt.Sprint(req.ShardID), plan); approval != nil || err != nil {
+		return approval, err
+	}
+
+	if op, ok := s.shardOps.begin(req.ShardID, shardOpDelete); !ok {
+		return nil, errs.Errorf(errs.KindConflict, "shard %d is being %s on this node", req.ShardID, op)
+	}
+	defer s.shardOps.end(req.ShardID)
+	if err := s.TSDBStore.DeleteShard(req.ShardID); err != nil {
+		s.Logger.Error("DeleteShard fail.", zap.Error(err))
+		return nil, err
+	}
+	if err := s.MetaClient.RemoveShardOwner(imeta.ShardID(req.ShardID), imeta.NodeID(ni.ID)); err != nil {
+		s.Logger.Error("RemoveShardOwner fail.", zap.Error(err))
+		return nil, err
+	}
+	// not to be copied back by catch-up
+	if s.MetaClient.ShardStale(req.ShardID, ni.ID) {
+		if err := s.MetaClient.ClearStaleShard(req.ShardID, ni.ID); err != nil {
+			s.Logger.Error("ClearStaleShard fail.", zap.Error(err))
+			return nil, err
 		}
-		if err := s.TSDBStore.DeleteShard(req.ShardID); err != nil {
-			s.Logger.Error("DeleteShard fail.", zap.Error(err))
-			return err
+	}
+	return nil, nil
+}
+
+// removeShardPlan describes deleting shard from node ni and the copies left.
+func (s *Service) removeShardPlan(shardID uint64, ni *meta.NodeInfo) []string {
+	db, rp, sgi := s.MetaClient.ShardOwner(shardID)
+	if sgi == nil {
+		return []string{
+			fmt.Sprintf("delete shard %d from node %d (%s)", shardID, ni.ID, ni.TCPHost),
+			"shard is not found in meta",
 		}
-		if err := s.MetaClient.RemoveShardOwner(req.ShardID, ni.ID); err != nil {
-			s.Logger.Error("RemoveShardOwner fail.", zap.Error(err))
-			return err
+	}
+
+	plan := []string{fmt.Sprintf("delete shard %d of %s.%s from node %d (%s)", shardID, db, rp, ni.ID, ni.TCPHost)}
+	var others []uint64
+	for _, sh := range sgi.Shards {
+		if sh.ID != shardID {
+			continue
 		}
-		return nil
+		for _, o := range sh.Owners {
+			if o.NodeID != ni.ID {
+				others = append(others, o.NodeID)
+			}
+		}
+	}
+	if len(others) == 0 {
+		plan = append(plan, "no other node owns the shard, its data will be lost")
+	} else {
+		plan = append(plan, fmt.Sprintf("shard is left on nodes %v", others))
 	}
-	return fmt.Errorf("invalid DataNodeAddr:%s", req.DataNodeAddr)
+	return plan
 }
 
-func (s *Service) removeShardResponse(w io.Writer, e error) {
+func (s *Service) removeShardResponse(w io.Writer, approval *Approval, e error) {
 	// Build response.
 	var resp RemoveShardResponse
 	setError(&resp.CommonResp, e)
+	setApproval(&resp.CommonResp, &resp.Approval, approval)
 	s.writeResponse(w, ResponseRemoveShard, &resp)
 }
 
-func (s *Service) handleRemoveDataNode(conn net.Conn) error {
+func (s *Service) handleRemoveDataNode(conn net.Conn) (*Approval, error) {
 	var req RemoveDataNodeRequest
 	if err := s.readRequest(conn, &req); err != nil {
-		return err
+		return nil, err
 	}
 
 	ni, err := s.MetaClient.DataNodeByTCPHost(req.DataNodeAddr)
 	if err != nil {
-		return err
+		return nil, err
 	} else if ni == nil {
-		return fmt.Errorf("not find data node by addr:%s", req.DataNodeAddr)
+		return nil, fmt.Errorf("%w by addr: %s", errs.ErrNodeNotFound, req.DataNodeAddr)
+	}
+
+	plan := s.removeDataNodePlan(ni)
+	if approval, err := s.approve(req.Token, req.DryRun, ActionRemoveDataNode, fmt.Sprint(ni.ID), plan); approval != nil || err != nil {
+		return approval, err
 	}
+	return nil, s.MetaClient.DeleteDataNode(ni.ID)
+}
 
-	return s.MetaClient.DeleteDataNode(ni.ID)
+// removeDataNodePlan describes removing node ni with the shards it owns.
+func (s *Service) removeDataNodePlan(ni *meta.NodeInfo) []string {
+	var owned int
+	var lost []uint64
+	for _, di := range s.MetaClient.Databases() {
+		for _, rpi := range di.RetentionPolicies {
+			for _, sgi := range rpi.ShardGroups {
+				if sgi.Deleted() {
+					continue
+				}
+				for _, sh := range sgi.Shards {
+					if !sh.OwnedBy(ni.ID) {
+						continue
+					}
+					owned++
+					if len(sh.Owners) == 1 {
+						lost = append(lost, sh.ID)
+					}
+				}
+			}
+		}
+	}
+
+	plan := []string{
+		fmt.Sprintf("remove node %d (%s) from cluster", ni.ID, ni.TCPHost),
+		fmt.Sprintf("%d shards lose their copy on the node", owned),
+	}
+	if len(lost) > 0 {
+		sort.Slice(lost, func(i, j int) bool { return lost[i] < lost[j] })
+		plan = append(plan, fmt.Sprintf("no other node owns shards %v, their data will be lost", lost))
+	}
+	return plan
 }
 
-func (s *Service) removeDataNodeResponse(w io.Writer, e error) {
+func (s *Service) removeDataNodeResponse(w io.Writer, approval *Approval, e error) {
 	// Build response.
 	var resp RemoveDataNodeResponse
 	setError(&resp.CommonResp, e)
+	setApproval(&resp.CommonResp, &resp.Approval, approval)
 	s.writeResponse(w, ResponseRemoveDataNode, &resp)
 }
 
+func (s *Service) handleDropDatabase(conn net.Conn) (*Approval, error) {
+	var req DropDatabaseRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	if s.ClusterExecutor == nil {
+		return nil, errors.New("dropping database is not supported on this node")
+	}
+
+	di := s.MetaClient.Database(req.Database)
+	if di == nil {
+		return nil, errs.Errorf(errs.KindNotFound, "database not found: %s", req.Database)
+	}
+
+	plan := dropDatabasePlan(di)
+	if approval, err := s.approve(req.Token, req.DryRun, ActionDropDatabase, di.Name, plan); approval != nil || err != nil {
+		return approval, err
+	}
+
+	if err := s.ClusterExecutor.DeleteDatabase(di.Name); err != nil {
+		return nil, err
+	}
+	return nil, s.MetaClient.DropDatabase(di.Name)
+}
+
+// dropDatabasePlan describes dropping di with its shards.
+func dropDatabasePlan(di *meta.DatabaseInfo) []string {
+	var rps []string
+	var groups, shards int
+	nodes := make(map[uint64]struct{})
+	for _, rpi := range di.RetentionPolicies {
+		rps = append(rps, rpi.Name)
+		for _, sgi := range rpi.ShardGroups {
+			if sgi.Deleted() {
+				continue
+			}
+			groups++
+			for _, sh := range sgi.Shards {
+				shards++
+				for _, o := range sh.Owners {
+					nodes[o.NodeID] = struct{}{}
+				}
+			}
+		}
+	}
+	ids := make([]uint64, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return []string{
+		fmt.Sprintf("drop database %s with retention policies %v", di.Name, rps),
+		fmt.Sprintf("delete %d shards of %d shard groups on nodes %v", shards, groups, ids),
+	}
+}
+
+func (s *Service) dropDatabaseResponse(w io.Writer, approval *Approval, e error) {
+	var resp DropDatabaseResponse
+	setError(&resp.CommonResp, e)
+	setApproval(&resp.CommonResp, &resp.Approval, approval)
+	s.writeResponse(w, ResponseDropDatabase, &resp)
+}
+
 func (s *Service) handleFreezeDataNode(conn net.Conn) error {
 	var req FreezeDataNodeRequest
 	if err := s.readRequest(conn, &req); err != nil {
@@ -390,7 +810,7 @@ func (s *Service) handleFreezeDataNode(conn net.Conn) error {
 	if err != nil {
 		return err
 	} else if ni == nil {
-		return fmt.Errorf("not find data node by addr:%s", req.DataNodeAddr)
+		return fmt.Errorf("%w by addr: %s", errs.ErrNodeNotFound, req.DataNodeAddr)
 	}
 
 	if req.Freeze {
@@ -407,13 +827,39 @@ func (s *Service) freezeDataNodeResponse(w io.Writer, e error) {
 	s.writeResponse(w, ResponseFreezeDataNode, &resp)
 }
 
+func (s *Service) checkConsistencyResponse(w io.Writer, report *ConsistencyReport, e error) {
+	var resp CheckConsistencyResponse
+	setError(&resp.CommonResp, e)
+	if report != nil {
+		resp.Report = *report
+	}
+	s.writeResponse(w, ResponseCheckConsistency, &resp)
+}
+
+func (s *Service) handleRepairShard(conn net.Conn) error {
+	var req RepairShardRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return err
+	}
+	if req.ShardID < 1 {
+		return errs.ErrShardIDRequired
+	}
+	return s.repairShard(req.ShardID, req.Action, req.SourceNodeAddr)
+}
+
+func (s *Service) repairShardResponse(w io.Writer, e error) {
+	var resp RepairShardResponse
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseRepairShard, &resp)
+}
+
 func (s *Service) handleNodeShards(conn net.Conn) ([]uint64, error) {
 	var req GetNodeShardsRequest
 	if err := s.readRequest(conn, &req); err != nil {
 		return nil, err
 	}
 	if req.NodeID < 1 {
-		return nil, errors.New("Node ID should not be empty")
+		return nil, errs.ErrNodeIDRequired
 	}
 
 	shards := make([]uint64, 0)
@@ -439,7 +885,7 @@ func (s *Service) handleShards(conn net.Conn) (*meta.RetentionPolicyInfo, error)
 		return nil, err
 	}
 	if req.Database == "" || req.RetentionPolicy == "" {
-		return nil, errors.New("Both database and retention policy should be specified")
+		return nil, errs.New(errs.KindInvalidArgument, "Both database and retention policy should be specified")
 	}
 	return s.MetaClient.RetentionPolicy(req.Database, req.RetentionPolicy)
 }
@@ -504,13 +950,13 @@ func (s *Service) handleShard(conn net.Conn) (string, string, *meta.ShardInfo, *
 		goto NOT_FOUND
 	}
 	if req.ShardID < 1 {
-		err = errors.New("ShardID should be specified")
+		err = errs.ErrShardIDRequired
 		goto NOT_FOUND
 	}
 	db, rp, groupInfo = s.MetaClient.ShardOwner(req.ShardID)
 	fmt.Println("shardId:", req.ShardID, "=>", db, rp, groupInfo)
 	if db == "" || rp == "" || groupInfo == nil {
-		err = errors.New("Specified shard could not be found")
+		err = errs.ErrShardNotFound
 		goto NOT_FOUND
 	}
 	for _, shard := range groupInfo.Shards {
@@ -534,6 +980,20 @@ func (s *Service) shardResponse(w io.Writer, db, rp string, shard *meta.ShardInf
 		resp.Begin = groupInfo.StartTime.UnixNano() / MILLISECOND
 		resp.End = groupInfo.EndTime.UnixNano() / MILLISECOND
 		resp.Truncated = groupInfo.TruncatedAt.UnixNano() / MILLISECOND
+		if sh := s.TSDBStore.Shard(shard.ID); sh != nil {
+			resp.Size, _ = sh.DiskSize()
+		}
+		for _, o := range shard.Owners {
+			usage := ShardOwnerUsage{NodeID: o.NodeID, Size: -1}
+			if size, lastWrite, ok := s.ShardUsage(shard.ID, o.NodeID); ok {
+				usage.Size = size
+				usage.LastWrite = lastWrite.UnixNano() / MILLISECOND
+			}
+			if at, ok := s.shardReportedAt(o.NodeID); ok {
+				usage.ReportedAt = at.UnixNano() / MILLISECOND
+			}
+			resp.Owners = append(resp.Owners, usage)
+		}
 	}
 	s.writeResponse(w, ResponseShard, &resp)
 }
@@ -546,7 +1006,13 @@ func (s *Service) handleShowDataNodes() ([]DataNode, error) {
 
 	var dataNodes []DataNode
 	for _, n := range nodes {
-		dataNodes = append(dataNodes, DataNode{ID: n.ID, TcpAddr: n.TCPHost, HttpAddr: n.Host, Freezed: s.MetaClient.IsDataNodeFreezed(n.ID)})
+		node := DataNode{ID: n.ID, TcpAddr: n.TCPHost, HttpAddr: n.Host, Freezed: s.MetaClient.IsDataNodeFreezed(n.ID)}
+		if s.WriteBacklogs != nil {
+			if b, ok := s.WriteBacklogs.Backlog(n.ID); ok {
+				node.Backlog = &b
+			}
+		}
+		dataNodes = append(dataNodes, node)
 	}
 	return dataNodes, nil
 }
@@ -563,6 +1029,7 @@ func setError(resp *CommonResp, err error) {
 	if err != nil {
 		resp.Code = 1
 		resp.Msg = err.Error()
+		resp.Kind = errs.KindOf(err).String()
 	} else {
 		resp.Code = 0
 		resp.Msg = "ok"
@@ -572,6 +1039,17 @@ func setError(resp *CommonResp, err error) {
 type CommonResp struct {
 	Code int    `json:"code"`
 	Msg  string `json:"msg"`
+	// Kind of the error, see package errs
+	Kind string `json:"kind,omitempty"`
+}
+
+// Err returns the error of a response failed, of its kind, nil if it
+// succeeded.
+func (r *CommonResp) Err() error {
+	if r.Code == 0 {
+		return nil
+	}
+	return errs.New(errs.ParseKind(r.Kind), r.Msg)
 }
 
 type TruncateShardRequest struct {
@@ -585,10 +1063,13 @@ type CopyShardRequest struct {
 	SourceNodeAddr string `json:"source_node_address"`
 	DestNodeAddr   string `json:"dest_node_address"` // is this necessary?
 	ShardID        uint64 `json:"shard_id"`
+	DryRun         bool   `json:"dry_run"`
 }
 
 type CopyShardResponse struct {
 	CommonResp
+	Plan []string `json:"plan,omitempty"`
+	Rate int64    `json:"rate,omitempty"` // bytes per second the copy would start at, 0 unlimited
 }
 
 type CopyShardTask struct {
@@ -599,11 +1080,15 @@ type CopyShardTask struct {
 	CurrentSize uint64 `json:"current_size"`
 	Source      string `json:"source"`
 	Destination string `json:"destination"`
+	Rate        int64  `json:"rate"` // bytes per second since started
+	Error       string `json:"error,omitempty"`
 }
 
 type CopyShardStatusResponse struct {
 	CommonResp
 	Tasks []CopyShardTask `json:"tasks"`
+	// Failed tasks, the last one of each shard not copied again since
+	Failed []CopyShardTask `json:"failed,omitempty"`
 }
 
 type KillCopyShardRequest struct {
@@ -631,18 +1116,35 @@ type GetShardRequest struct {
 type RemoveShardRequest struct {
 	DataNodeAddr string `json:"data_node_addr"`
 	ShardID      uint64 `json:"shard_id"`
+	Token        string `json:"token"`
+	DryRun       bool   `json:"dry_run"`
 }
 
 type RemoveShardResponse struct {
 	CommonResp
+	Approval
 }
 
 type RemoveDataNodeRequest struct {
 	DataNodeAddr string `json:"data_node_addr"`
+	Token        string `json:"token"`
+	DryRun       bool   `json:"dry_run"`
 }
 
 type RemoveDataNodeResponse struct {
 	CommonResp
+	Approval
+}
+
+type DropDatabaseRequest struct {
+	Database string `json:"database"`
+	Token    string `json:"token"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+type DropDatabaseResponse struct {
+	CommonResp
+	Approval
 }
 
 type FreezeDataNodeRequest struct {
@@ -653,11 +1155,28 @@ type FreezeDataNodeResponse struct {
 	CommonResp
 }
 
+type CheckConsistencyResponse struct {
+	CommonResp
+	Report ConsistencyReport `json:"report"`
+}
+
+type RepairShardRequest struct {
+	ShardID        uint64 `json:"shard_id"`
+	Action         string `json:"action"`
+	SourceNodeAddr string `json:"source_node_address"`
+}
+
+type RepairShardResponse struct {
+	CommonResp
+}
+
 type DataNode struct {
 	ID       uint64 `json:"id"`
 	TcpAddr  string `json:"tcp_addr"`
 	HttpAddr string `json:"http_addr"`
 	Freezed  bool   `json:"freezed"`
+	// Backlog is nil if the node wasn't written to by the one asked
+	Backlog *coordinator.WriteBacklog `json:"backlog,omitempty"`
 }
 
 type ShardGroup struct {
@@ -698,6 +1217,16 @@ type ShardResponse struct {
 	Begin     int64    `json:"begin"`
 	End       int64    `json:"end"`
 	Truncated int64    `json:"truncated"`
+	Size      int64    `json:"size"` // on disk of the node requested, 0 if not there
+	// Owners with usage of the shard last reported by them
+	Owners []ShardOwnerUsage `json:"owners,omitempty"`
+}
+
+type ShardOwnerUsage struct {
+	NodeID     uint64 `json:"node_id"`
+	Size       int64  `json:"size"`        // -1 if not reported
+	LastWrite  int64  `json:"last_write"`  // milliseconds
+	ReportedAt int64  `json:"reported_at"` // milliseconds, 0 if never
 }
 
 type ShowDataNodesResponse struct {
@@ -722,6 +1251,29 @@ const (
 	RequestShard
 	RequestFreezeDataNode
 	RequestNodeShards
+	RequestCheckConsistency
+	RequestRepairShard
+	RequestDropDatabase
+	RequestShardSizes
+	RequestDrainStatus
+	RequestDrainReads
+	RequestShardReport
+	RequestShardDigest
+	RequestVerifyShard
+	RequestClusterSnapshot
+	RequestSnapshotShards
+	RequestReleaseSnapshot
+	RequestRemoveSnapshot
+	RequestSnapshotFile
+	RequestRestorePlan
+	RequestRestoreShard
+	RequestPurgeHintedHandoff
+	RequestCatchUpStatus
+	RequestNodeHealth
+	RequestDoctor
+	RequestTransferHintedHandoff
+	RequestReceiveHintedHandoff
+	RequestReplayHintedHandoff
 )
 
 type ResponseType byte
@@ -739,4 +1291,27 @@ const (
 	ResponseShard
 	ResponseFreezeDataNode
 	ResponseNodeShards
+	ResponseCheckConsistency
+	ResponseRepairShard
+	ResponseDropDatabase
+	ResponseShardSizes
+	ResponseDrainStatus
+	ResponseDrainReads
+	ResponseShardReport
+	ResponseShardDigest
+	ResponseVerifyShard
+	ResponseClusterSnapshot
+	ResponseSnapshotShards
+	ResponseReleaseSnapshot
+	ResponseRemoveSnapshot
+	ResponseSnapshotFile
+	ResponseRestorePlan
+	ResponseRestoreShard
+	ResponsePurgeHintedHandoff
+	ResponseCatchUpStatus
+	ResponseNodeHealth
+	ResponseDoctor
+	ResponseTransferHintedHandoff
+	ResponseReceiveHintedHandoff
+	ResponseReplayHintedHandoff
 )
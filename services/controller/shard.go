@@ -5,13 +5,63 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/logging"
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/angopher/chronus/services/migrate"
 	"github.com/angopher/chronus/x"
 	"go.uber.org/zap"
 )
 
+// copyShardPlan describes copying shard from sourceAddr, checking it could be
+// started without starting it.
+func (s *Service) copyShardPlan(sourceAddr string, shardId uint64) ([]string, error) {
+	db, rp, sgi := s.MetaClient.ShardOwner(shardId)
+	if sgi == nil {
+		return nil, fmt.Errorf("%w: %d", errs.ErrShardNotFound, shardId)
+	}
+	path := filepath.Join(s.TSDBStore.Path(), db, rp, strconv.FormatUint(shardId, 10))
+	if x.Exists(path) != x.NotExisted {
+		return nil, errs.Errorf(errs.KindAlreadyExists, "local shard:[%s] exists", path)
+	}
+	for _, t := range s.migrateManager.Tasks() {
+		if t.ShardId == shardId {
+			return nil, migrate.ErrTaskDuplicated
+		}
+	}
+	src, err := s.MetaClient.DataNodeByTCPHost(sourceAddr)
+	if err != nil {
+		return nil, err
+	} else if src == nil {
+		return nil, fmt.Errorf("%w by addr: %s", errs.ErrNodeNotFound, sourceAddr)
+	}
+	var owned bool
+	for _, sh := range sgi.Shards {
+		if sh.ID == shardId {
+			owned = sh.OwnedBy(src.ID)
+		}
+	}
+	if !owned {
+		return nil, fmt.Errorf("shard %d is not owned by node %d (%s)", shardId, src.ID, sourceAddr)
+	}
+
+	plan := []string{
+		fmt.Sprintf("copy shard %d of %s.%s from node %d (%s) to node %d", shardId, db, rp, src.ID, sourceAddr, s.Node.ID),
+	}
+	if s.shardCutoverTimeout > 0 {
+		plan = append(plan, fmt.Sprintf("hold writes to shard %d up to %s, copying the writes since the copy started", shardId, s.shardCutoverTimeout))
+	}
+	return append(plan, fmt.Sprintf("add node %d as an owner of shard %d", s.Node.ID, shardId)), nil
+}
+
 func (s *Service) copyShard(sourceAddr string, shardId uint64) error {
+	if op, ok := s.shardOps.begin(shardId, shardOpCopy); !ok {
+		return errs.Errorf(errs.KindConflict, "shard %d is being %s on this node", shardId, op)
+	}
+	defer s.shardOps.end(shardId)
+
 	task := migrate.Task{}
 	task.SrcHost = sourceAddr
 	task.ShardId = shardId
@@ -33,6 +83,7 @@ func (s *Service) copyShard(sourceAddr string, shardId uint64) error {
 	os.MkdirAll(copyDir, 0755)
 	task.TmpStorePath = copyDir
 
+	started := time.Now()
 	err := s.migrateManager.Add(&task)
 	if err != nil {
 		return err
@@ -44,6 +95,16 @@ func (s *Service) copyShard(sourceAddr string, shardId uint64) error {
 		return err
 	}
 
+	var expiration time.Time
+	if s.shardCutoverTimeout > 0 {
+		defer s.endShardCutover(shardId)
+		expiration, err = s.copyShardTail(&task, started)
+		if err != nil {
+			os.RemoveAll(task.DstStorePath)
+			return err
+		}
+	}
+
 	sh := s.TSDBStore.Shard(shardId)
 	if sh != nil {
 		return fmt.Errorf("Shard %d is existed which is unexpected after backuping", shardId)
@@ -55,11 +116,62 @@ func (s *Service) copyShard(sourceAddr string, shardId uint64) error {
 		return err
 	}
 
-	err = s.MetaClient.AddShardOwner(task.ShardId, s.Node.ID)
+	if !expiration.IsZero() && !time.Now().Before(expiration) {
+		// writes resumed on owners, they'd be missing here
+		s.TSDBStore.DeleteShard(task.ShardId)
+		return errs.Errorf(errs.KindTimeout, "cutover of shard %d timed out", task.ShardId)
+	}
+
+	err = s.MetaClient.AddShardOwner(imeta.ShardID(task.ShardId), imeta.NodeID(s.Node.ID))
 	if err != nil {
 		s.Logger.Warn("Failed to add as owner", zap.Error(err))
 		return err
 	}
-	s.Logger.Info("Successfully add as owner", zap.Uint64("shard", task.ShardId))
+	s.Logger.Info("Successfully add as owner", logging.ShardID(task.ShardId))
 	return err
 }
+
+const (
+	// shardCutoverSettle is the time owners take to learn the cutover of a
+	// shard and finish the writes to it accepted before.
+	shardCutoverSettle = time.Second
+
+	// shardCutoverClockSkew is the skew of clocks of nodes tolerated in copying
+	// files of shards changed since.
+	shardCutoverClockSkew = time.Minute
+)
+
+// copyShardTail copies the files of the shard changed since its copy of task
+// started, under a cutover holding the writes to the shard until this node
+// owns it. Writes held are buffered by hinted handoff for the owners and this
+// node. It returns the time the cutover expires.
+func (s *Service) copyShardTail(task *migrate.Task, started time.Time) (time.Time, error) {
+	expiration := time.Now().UTC().Add(s.shardCutoverTimeout)
+	if err := s.MetaClient.BeginShardCutover(task.ShardId, s.Node.ID, expiration); err != nil {
+		return time.Time{}, err
+	}
+	time.Sleep(shardCutoverSettle)
+
+	tail := migrate.Task{
+		SrcHost:      task.SrcHost,
+		ShardId:      task.ShardId,
+		Database:     task.Database,
+		Retention:    task.Retention,
+		DstStorePath: task.DstStorePath,
+		TmpStorePath: task.TmpStorePath,
+		Since:        started.Add(-shardCutoverClockSkew),
+	}
+	if err := s.migrateManager.Execute(&tail); err != nil {
+		return time.Time{}, err
+	}
+	s.Logger.Info("Copied writes during shard copy", logging.ShardID(task.ShardId), zap.Uint64("bytes", tail.Copied))
+	return expiration, nil
+}
+
+// endShardCutover releases the writes held by the cutover of a shard, which
+// are held until the cutover expires otherwise.
+func (s *Service) endShardCutover(shardId uint64) {
+	if err := s.MetaClient.EndShardCutover(shardId); err != nil {
+		s.Logger.Warn("Failed to end shard cutover", logging.ShardID(shardId), zap.Error(err))
+	}
+}
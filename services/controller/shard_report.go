@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/logging"
+)
+
+type ShardReportRequest struct{}
+
+// ShardUsage is the space and the last write of a shard on a node.
+type ShardUsage struct {
+	ShardID   uint64 `json:"shard_id"`
+	Size      int64  `json:"size"`
+	LastWrite int64  `json:"last_write"` // milliseconds
+}
+
+type ShardReportResponse struct {
+	CommonResp
+	// Shards open on the node
+	Shards []ShardUsage `json:"shards"`
+}
+
+// nodeShardReport is the last report of shards of a node.
+type nodeShardReport struct {
+	at     time.Time
+	shards map[uint64]ShardUsage
+}
+
+// shardReports are the last reports of all nodes, a node failing to report
+// keeps its previous one.
+type shardReports struct {
+	mu    sync.RWMutex
+	nodes map[uint64]*nodeShardReport
+}
+
+func (s *Service) handleShardReport(conn net.Conn) ([]ShardUsage, error) {
+	var req ShardReportRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	return s.localShardUsage()
+}
+
+func (s *Service) shardReportResponse(w io.Writer, shards []ShardUsage, e error) {
+	var resp ShardReportResponse
+	setError(&resp.CommonResp, e)
+	resp.Shards = shards
+	s.writeResponse(w, ResponseShardReport, &resp)
+}
+
+// localShardUsage returns usage of shards open on this node.
+func (s *Service) localShardUsage() ([]ShardUsage, error) {
+	local, err := s.localShards()
+	if err != nil {
+		return nil, err
+	}
+	shards := make([]ShardUsage, 0, len(local))
+	for id := range local {
+		sh := s.TSDBStore.Shard(id)
+		if sh == nil {
+			continue
+		}
+		size, err := sh.DiskSize()
+		if err != nil {
+			continue
+		}
+		shards = append(shards, ShardUsage{
+			ShardID:   id,
+			Size:      size,
+			LastWrite: sh.LastModified().UnixNano() / MILLISECOND,
+		})
+	}
+	return shards, nil
+}
+
+// shardReportLoop collects usage of shards from all nodes periodically.
+func (s *Service) shardReportLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.shardReportInterval)
+	defer ticker.Stop()
+	for {
+		s.collectShardReports()
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectShardReports requests usage of shards from all nodes at once.
+func (s *Service) collectShardReports() {
+	nodes, err := s.MetaClient.DataNodes()
+	if err != nil {
+		s.Logger.Warn("Failed to list nodes reporting shards", zap.Error(err))
+		return
+	}
+
+	var (
+		wg      sync.WaitGroup
+		reports = make([]ShardReportResponse, len(nodes))
+		errs    = make([]error, len(nodes))
+	)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if s.Node != nil && nodes[i].ID == s.Node.ID {
+				reports[i].Shards, errs[i] = s.localShardUsage()
+				return
+			}
+			errs[i] = requestNode(nodes[i].TCPHost, RequestShardReport, ResponseShardReport, &ShardReportRequest{}, &reports[i])
+			if errs[i] == nil && reports[i].Code != 0 {
+				errs[i] = errors.New(reports[i].Msg)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	s.shardReports.mu.Lock()
+	defer s.shardReports.mu.Unlock()
+	previous := s.shardReports.nodes
+	s.shardReports.nodes = make(map[uint64]*nodeShardReport, len(nodes))
+	for i, n := range nodes {
+		if errs[i] != nil {
+			s.Logger.Info("Failed to collect shard report of node",
+				logging.NodeID(n.ID), zap.String("addr", n.TCPHost), zap.Error(errs[i]))
+			if r := previous[n.ID]; r != nil {
+				s.shardReports.nodes[n.ID] = r
+			}
+			continue
+		}
+		r := &nodeShardReport{at: now, shards: make(map[uint64]ShardUsage, len(reports[i].Shards))}
+		for _, sh := range reports[i].Shards {
+			r.shards[sh.ShardID] = sh
+		}
+		s.shardReports.nodes[n.ID] = r
+	}
+}
+
+// ShardUsage returns the size and the last write of shard shardID on node
+// nodeID as last reported by the node, ok is false if not reported.
+func (s *Service) ShardUsage(shardID, nodeID uint64) (size int64, lastWrite time.Time, ok bool) {
+	s.shardReports.mu.RLock()
+	defer s.shardReports.mu.RUnlock()
+
+	r := s.shardReports.nodes[nodeID]
+	if r == nil {
+		return 0, time.Time{}, false
+	}
+	sh, ok := r.shards[shardID]
+	if !ok {
+		return 0, time.Time{}, false
+	}
+	return sh.Size, time.Unix(0, sh.LastWrite*MILLISECOND), true
+}
+
+// shardReportedAt returns when node nodeID reported its shards last.
+func (s *Service) shardReportedAt(nodeID uint64) (time.Time, bool) {
+	s.shardReports.mu.RLock()
+	defer s.shardReports.mu.RUnlock()
+
+	if r := s.shardReports.nodes[nodeID]; r != nil {
+		return r.at, true
+	}
+	return time.Time{}, false
+}
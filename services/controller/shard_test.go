@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/services/migrate"
+)
+
+func TestCopyShard_DryRun(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	store.addShard(t, "db0", "rp0", 1, true)
+	mc := consistencyMeta()
+	mc.setOwner(2, 2, true)
+	s := newTestService(mc, store)
+	s.shardCutoverTimeout = time.Minute
+
+	var resp CopyShardResponse
+	req := &CopyShardRequest{SourceNodeAddr: "node2:8088", ShardID: 2, DryRun: true}
+	requestService(t, s, RequestCopyShard, ResponseCopyShard, req, &resp)
+	exp := []string{
+		"copy shard 2 of db0.rp0 from node 2 (node2:8088) to node 1",
+		"hold writes to shard 2 up to 1m0s, copying the writes since the copy started",
+		"add node 1 as an owner of shard 2",
+	}
+	if resp.Code != 0 || resp.Msg != "dry run" || !reflect.DeepEqual(resp.Plan, exp) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(s.migrateManager.Tasks()) != 0 || len(mc.added) != 0 {
+		t.Fatal("shard copied by dry run")
+	}
+
+	for _, tt := range []struct {
+		req  *CopyShardRequest
+		kind errs.Kind
+	}{
+		{&CopyShardRequest{SourceNodeAddr: "node2:8088", ShardID: 9, DryRun: true}, errs.KindNotFound},
+		{&CopyShardRequest{SourceNodeAddr: "node2:8088", ShardID: 1, DryRun: true}, errs.KindAlreadyExists},
+		{&CopyShardRequest{SourceNodeAddr: "node3:8088", ShardID: 2, DryRun: true}, errs.KindNotFound},
+		// not owned by the source
+		{&CopyShardRequest{SourceNodeAddr: "node2:8088", ShardID: 4, DryRun: true}, errs.KindUnknown},
+	} {
+		resp = CopyShardResponse{}
+		requestService(t, s, RequestCopyShard, ResponseCopyShard, tt.req, &resp)
+		if resp.Code == 0 || resp.Kind != tt.kind.String() || resp.Plan != nil {
+			t.Fatalf("unexpected response of %+v: %+v", tt.req, resp)
+		}
+	}
+
+	// nor planned while copied
+	done := make(chan error)
+	go func() { done <- s.copyShard("node2:8088", 2) }()
+	task := waitTask(t, s, 2)
+	resp = CopyShardResponse{}
+	requestService(t, s, RequestCopyShard, ResponseCopyShard, req, &resp)
+	if resp.Code == 0 || resp.Msg != migrate.ErrTaskDuplicated.Error() {
+		t.Fatalf("unexpected response of shard copied: %+v", resp)
+	}
+	task.C <- errors.New("stopped")
+	<-done
+}
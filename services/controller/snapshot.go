@@ -0,0 +1,498 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/errs"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+const (
+	// snapshotFreezeTimeout bounds the freeze of shard group creation by a
+	// snapshot, in case the node taking it fails to thaw.
+	snapshotFreezeTimeout = time.Minute
+
+	// snapshotShardsTimeout bounds snapshots of shards by a node, which
+	// reads files not checksummed before.
+	snapshotShardsTimeout = 10 * time.Minute
+
+	// snapshotSweepInterval is the interval of removing snapshots expired.
+	snapshotSweepInterval = time.Minute
+
+	// snapshotDirPrefix prefixes directories of snapshots in shards.
+	snapshotDirPrefix = "snapshot_"
+)
+
+var snapshotIDPattern = regexp.MustCompile(`^[0-9a-z]+$`)
+
+type SnapshotShardsRequest struct {
+	ID       string   `json:"id"`
+	ShardIDs []uint64 `json:"shard_ids"`
+}
+
+// SnapshotFile is a file of a shard snapshot, hard linked to the file of the
+// shard so it is kept until the snapshot is released.
+type SnapshotFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	CRC  uint32 `json:"crc"`
+}
+
+// ShardSnapshot lists files of a shard snapshot, in Dir of the shard
+// directory on the node.
+type ShardSnapshot struct {
+	ShardID      uint64         `json:"shard_id"`
+	Database     string         `json:"database"`
+	Rp           string         `json:"rp"`
+	Dir          string         `json:"dir"`
+	LastModified int64          `json:"last_modified"` // milliseconds
+	Files        []SnapshotFile `json:"files"`
+	Error        string         `json:"error,omitempty"`
+}
+
+type SnapshotShardsResponse struct {
+	CommonResp
+	Shards []ShardSnapshot `json:"shards"`
+}
+
+// NodeSnapshot lists snapshots of shards a node owns.
+type NodeSnapshot struct {
+	NodeID  uint64          `json:"node_id"`
+	TCPHost string          `json:"tcp_host"`
+	Shards  []ShardSnapshot `json:"shards"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// ClusterSnapshotResponse is the manifest of a cluster snapshot: meta data
+// at Index and the files of shards of each node at the same index.
+type ClusterSnapshotResponse struct {
+	CommonResp
+	ID    string         `json:"id"`
+	Index uint64         `json:"index"`
+	Meta  []byte         `json:"meta"`
+	Nodes []NodeSnapshot `json:"nodes"`
+}
+
+type SnapshotFileRequest struct {
+	ID      string `json:"id"`
+	ShardID uint64 `json:"shard_id"`
+	Name    string `json:"name"`
+}
+
+// SnapshotFileResponse is followed by Size bytes of the file if succeeded.
+type SnapshotFileResponse struct {
+	CommonResp
+	Size int64 `json:"size"`
+}
+
+type ReleaseSnapshotRequest struct {
+	ID string `json:"id"`
+}
+
+type ReleaseSnapshotResponse struct {
+	CommonResp
+}
+
+type RemoveSnapshotRequest struct {
+	ID string `json:"id"`
+}
+
+type RemoveSnapshotResponse struct {
+	CommonResp
+	Removed int `json:"removed"`
+}
+
+// snapshotChecksum is the CRC of a file known by its size and time modified.
+type snapshotChecksum struct {
+	size    int64
+	modTime time.Time
+	crc     uint32
+}
+
+// snapshotChecksums caches checksums of files of shards in their latest
+// snapshot, TSM files are not modified once written so snapshots taken for
+// incremental backups read new files only.
+type snapshotChecksums struct {
+	mu     sync.Mutex
+	shards map[uint64]map[string]snapshotChecksum
+}
+
+func (s *Service) handleClusterSnapshot() (*ClusterSnapshotResponse, error) {
+	return s.clusterSnapshot()
+}
+
+func (s *Service) clusterSnapshotResponse(w io.Writer, snapshot *ClusterSnapshotResponse, e error) {
+	var resp ClusterSnapshotResponse
+	if snapshot != nil {
+		resp = *snapshot
+	}
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseClusterSnapshot, &resp)
+}
+
+// clusterSnapshot freezes creation of shard groups, snapshots shards of all
+// nodes the meta data frozen tells, and thaws. Snapshots are kept on nodes
+// until released or expired.
+func (s *Service) clusterSnapshot() (*ClusterSnapshotResponse, error) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+	buf, err := s.MetaClient.FreezeShardGroups(id, time.Now().Add(snapshotFreezeTimeout))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := s.MetaClient.ThawShardGroups(id); err != nil {
+			s.Logger.Warn("Failed to thaw shard groups, thawed once expired", zap.String("snapshot", id), zap.Error(err))
+		}
+	}()
+
+	var data imeta.Data
+	if err := data.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	owned := make(map[uint64][]uint64)
+	for _, db := range data.Databases {
+		for _, rp := range db.RetentionPolicies {
+			for _, sgi := range rp.ShardGroups {
+				if sgi.Deleted() {
+					continue
+				}
+				for _, sh := range sgi.Shards {
+					for _, o := range sh.Owners {
+						owned[o.NodeID] = append(owned[o.NodeID], sh.ID)
+					}
+				}
+			}
+		}
+	}
+
+	snapshot := &ClusterSnapshotResponse{
+		ID:    id,
+		Index: data.Index,
+		Meta:  buf,
+		Nodes: make([]NodeSnapshot, len(data.DataNodes)),
+	}
+	var wg sync.WaitGroup
+	for i, n := range data.DataNodes {
+		node := &snapshot.Nodes[i]
+		node.NodeID = n.ID
+		node.TCPHost = n.TCPHost
+		wg.Add(1)
+		go func(shardIDs []uint64) {
+			defer wg.Done()
+			if s.Node != nil && node.NodeID == s.Node.ID {
+				node.Shards = s.snapshotShards(id, shardIDs)
+				return
+			}
+			var resp SnapshotShardsResponse
+			err := requestNodeWithin(node.TCPHost, snapshotShardsTimeout, RequestSnapshotShards, ResponseSnapshotShards, &SnapshotShardsRequest{ID: id, ShardIDs: shardIDs}, &resp)
+			if err == nil && resp.Code != 0 {
+				err = errors.New(resp.Msg)
+			}
+			if err != nil {
+				node.Error = err.Error()
+			}
+			node.Shards = resp.Shards
+		}(owned[n.ID])
+	}
+	wg.Wait()
+
+	s.Logger.Info("Cluster snapshot taken", zap.String("snapshot", id), zap.Uint64("index", data.Index))
+	return snapshot, nil
+}
+
+func (s *Service) handleSnapshotShards(conn net.Conn) ([]ShardSnapshot, error) {
+	var req SnapshotShardsRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	if !snapshotIDPattern.MatchString(req.ID) {
+		return nil, fmt.Errorf("invalid snapshot id: %q", req.ID)
+	}
+	return s.snapshotShards(req.ID, req.ShardIDs), nil
+}
+
+func (s *Service) snapshotShardsResponse(w io.Writer, shards []ShardSnapshot, e error) {
+	var resp SnapshotShardsResponse
+	setError(&resp.CommonResp, e)
+	resp.Shards = shards
+	s.writeResponse(w, ResponseSnapshotShards, &resp)
+}
+
+// snapshotShards snapshots local shards as snapshot id. Files of all shards
+// are linked before checksummed, so the snapshots are taken close in time.
+func (s *Service) snapshotShards(id string, shardIDs []uint64) []ShardSnapshot {
+	snapshots := make([]ShardSnapshot, len(shardIDs))
+	for i, shardID := range shardIDs {
+		snapshots[i].ShardID = shardID
+		if err := s.linkShardSnapshot(id, &snapshots[i]); err != nil {
+			snapshots[i].Error = err.Error()
+		}
+	}
+	for i := range snapshots {
+		if snapshots[i].Error != "" {
+			continue
+		}
+		if err := s.listShardSnapshot(&snapshots[i]); err != nil {
+			snapshots[i].Error = err.Error()
+		}
+	}
+	return snapshots
+}
+
+// linkShardSnapshot hard links files of a shard into the snapshot directory
+// of the shard, after writing its cache to files.
+func (s *Service) linkShardSnapshot(id string, snapshot *ShardSnapshot) error {
+	sh := s.TSDBStore.Shard(snapshot.ShardID)
+	if sh == nil {
+		return fmt.Errorf("%w: %d", errs.ErrShardNotFound, snapshot.ShardID)
+	}
+	snapshot.Database = sh.Database()
+	snapshot.Rp = sh.RetentionPolicy()
+
+	tmp, err := sh.CreateSnapshot()
+	if err != nil {
+		return err
+	}
+	// the cache is written to files by now
+	snapshot.LastModified = sh.LastModified().UnixNano() / MILLISECOND
+	dir := filepath.Join(sh.Path(), snapshotDirPrefix+id)
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	snapshot.Dir = dir
+	return nil
+}
+
+// listShardSnapshot lists files of a shard snapshot with their checksums.
+func (s *Service) listShardSnapshot(snapshot *ShardSnapshot) error {
+	infos, err := ioutil.ReadDir(snapshot.Dir)
+	if err != nil {
+		return err
+	}
+
+	checksums := make(map[string]snapshotChecksum, len(infos))
+	s.snapshotChecksums.mu.Lock()
+	cached := s.snapshotChecksums.shards[snapshot.ShardID]
+	s.snapshotChecksums.mu.Unlock()
+	for _, fi := range infos {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		c, ok := cached[fi.Name()]
+		if !ok || c.size != fi.Size() || !c.modTime.Equal(fi.ModTime()) {
+			crc, err := fileCRC(filepath.Join(snapshot.Dir, fi.Name()))
+			if err != nil {
+				return err
+			}
+			c = snapshotChecksum{size: fi.Size(), modTime: fi.ModTime(), crc: crc}
+		}
+		checksums[fi.Name()] = c
+		snapshot.Files = append(snapshot.Files, SnapshotFile{Name: fi.Name(), Size: c.size, CRC: c.crc})
+	}
+
+	s.snapshotChecksums.mu.Lock()
+	if s.snapshotChecksums.shards == nil {
+		s.snapshotChecksums.shards = make(map[uint64]map[string]snapshotChecksum)
+	}
+	s.snapshotChecksums.shards[snapshot.ShardID] = checksums
+	s.snapshotChecksums.mu.Unlock()
+	return nil
+}
+
+func fileCRC(path string) (uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+func (s *Service) handleSnapshotFile(conn net.Conn) (*os.File, int64, error) {
+	var req SnapshotFileRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, 0, err
+	}
+	if !snapshotIDPattern.MatchString(req.ID) {
+		return nil, 0, fmt.Errorf("invalid snapshot id: %q", req.ID)
+	}
+	if req.Name == "" || filepath.Base(req.Name) != req.Name || req.Name == ".." {
+		return nil, 0, fmt.Errorf("invalid snapshot file: %q", req.Name)
+	}
+	sh := s.TSDBStore.Shard(req.ShardID)
+	if sh == nil {
+		return nil, 0, fmt.Errorf("%w: %d", errs.ErrShardNotFound, req.ShardID)
+	}
+
+	f, err := os.Open(filepath.Join(sh.Path(), snapshotDirPrefix+req.ID, req.Name))
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// snapshotFileResponse writes the response followed by the file, which is
+// closed then.
+func (s *Service) snapshotFileResponse(w io.Writer, f *os.File, size int64, e error) {
+	var resp SnapshotFileResponse
+	setError(&resp.CommonResp, e)
+	resp.Size = size
+	s.writeResponse(w, ResponseSnapshotFile, &resp)
+	if f == nil {
+		return
+	}
+	defer f.Close()
+	if _, err := io.CopyN(w, f, size); err != nil {
+		s.Logger.Warn("Failed to send snapshot file", zap.String("file", f.Name()), zap.Error(err))
+	}
+}
+
+func (s *Service) handleReleaseSnapshot(conn net.Conn) error {
+	var req ReleaseSnapshotRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return err
+	}
+	if !snapshotIDPattern.MatchString(req.ID) {
+		return fmt.Errorf("invalid snapshot id: %q", req.ID)
+	}
+	return s.releaseSnapshot(req.ID)
+}
+
+func (s *Service) releaseSnapshotResponse(w io.Writer, e error) {
+	var resp ReleaseSnapshotResponse
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseReleaseSnapshot, &resp)
+}
+
+// releaseSnapshot removes snapshot id from all nodes.
+func (s *Service) releaseSnapshot(id string) error {
+	nodes, err := s.MetaClient.DataNodes()
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		failures = make([]error, len(nodes))
+	)
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if s.Node != nil && nodes[i].ID == s.Node.ID {
+				_, failures[i] = s.removeSnapshot(id)
+				return
+			}
+			var resp RemoveSnapshotResponse
+			failures[i] = requestNode(nodes[i].TCPHost, RequestRemoveSnapshot, ResponseRemoveSnapshot, &RemoveSnapshotRequest{ID: id}, &resp)
+			if failures[i] == nil && resp.Code != 0 {
+				failures[i] = errors.New(resp.Msg)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range failures {
+		if err != nil {
+			return fmt.Errorf("node %d: %v", nodes[i].ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) handleRemoveSnapshot(conn net.Conn) (int, error) {
+	var req RemoveSnapshotRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return 0, err
+	}
+	if !snapshotIDPattern.MatchString(req.ID) {
+		return 0, fmt.Errorf("invalid snapshot id: %q", req.ID)
+	}
+	return s.removeSnapshot(req.ID)
+}
+
+func (s *Service) removeSnapshotResponse(w io.Writer, removed int, e error) {
+	var resp RemoveSnapshotResponse
+	setError(&resp.CommonResp, e)
+	resp.Removed = removed
+	s.writeResponse(w, ResponseRemoveSnapshot, &resp)
+}
+
+// removeSnapshot removes local snapshots of shards as id.
+func (s *Service) removeSnapshot(id string) (int, error) {
+	dirs, err := s.snapshotDirs(id)
+	if err != nil {
+		return 0, err
+	}
+	for i, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return i, err
+		}
+	}
+	return len(dirs), nil
+}
+
+// snapshotDirs returns directories of local snapshots of shards matching
+// pattern id.
+func (s *Service) snapshotDirs(id string) ([]string, error) {
+	return filepath.Glob(filepath.Join(s.TSDBStore.Path(), "*", "*", "*", snapshotDirPrefix+id))
+}
+
+// snapshotSweepLoop removes local snapshots not released in time.
+func (s *Service) snapshotSweepLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(snapshotSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			s.sweepSnapshots(time.Now())
+		}
+	}
+}
+
+func (s *Service) sweepSnapshots(now time.Time) {
+	dirs, err := s.snapshotDirs("*")
+	if err != nil {
+		s.Logger.Warn("Failed to list snapshots", zap.Error(err))
+		return
+	}
+	for _, dir := range dirs {
+		fi, err := os.Stat(dir)
+		if err != nil || now.Sub(fi.ModTime()) < s.snapshotTTL {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			s.Logger.Warn("Failed to remove snapshot expired", zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		s.Logger.Info("Removed snapshot expired", zap.String("dir", dir))
+	}
+}
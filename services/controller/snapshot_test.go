@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/angopher/chronus/coordinator"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func snapshotFiles(snapshot *ShardSnapshot) map[string]SnapshotFile {
+	files := make(map[string]SnapshotFile, len(snapshot.Files))
+	for _, f := range snapshot.Files {
+		files[f.Name] = f
+	}
+	return files
+}
+
+func TestListShardSnapshot_Checksums(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	dir := filepath.Join(store.addShard(t, "db0", "rp0", 1, true), snapshotDirPrefix+"a")
+	os.MkdirAll(dir, 0755)
+	writeFile(t, filepath.Join(dir, "000000001-000000001.tsm"), "tsm 1")
+	writeFile(t, filepath.Join(dir, "fields.idx"), "fields")
+	s := newTestService(consistencyMeta(), store)
+
+	snapshot := &ShardSnapshot{ShardID: 1, Dir: dir}
+	if err := s.listShardSnapshot(snapshot); err != nil {
+		t.Fatalf("listShardSnapshot() failed: %v", err)
+	}
+	files := snapshotFiles(snapshot)
+	if f := files["000000001-000000001.tsm"]; len(files) != 2 || f.Size != 5 || f.CRC != crc32.ChecksumIEEE([]byte("tsm 1")) {
+		t.Fatalf("unexpected files listed: %+v", snapshot.Files)
+	}
+
+	// files not modified since are not read again, the cached checksum of
+	// the tsm file is made up to tell
+	s.snapshotChecksums.shards[1]["000000001-000000001.tsm"] = snapshotChecksum{
+		size:    5,
+		modTime: s.snapshotChecksums.shards[1]["000000001-000000001.tsm"].modTime,
+		crc:     1,
+	}
+	writeFile(t, filepath.Join(dir, "fields.idx"), "fields 2")
+	os.Chtimes(filepath.Join(dir, "fields.idx"), time.Now(), time.Now().Add(time.Second))
+	writeFile(t, filepath.Join(dir, "000000002-000000001.tsm"), "tsm 2")
+	snapshot = &ShardSnapshot{ShardID: 1, Dir: dir}
+	if err := s.listShardSnapshot(snapshot); err != nil {
+		t.Fatalf("listShardSnapshot() failed: %v", err)
+	}
+	files = snapshotFiles(snapshot)
+	if files["000000001-000000001.tsm"].CRC != 1 {
+		t.Fatal("file not modified read again")
+	}
+	if f := files["fields.idx"]; f.Size != 8 || f.CRC != crc32.ChecksumIEEE([]byte("fields 2")) {
+		t.Fatalf("file modified not read again: %+v", f)
+	}
+	if f := files["000000002-000000001.tsm"]; f.CRC != crc32.ChecksumIEEE([]byte("tsm 2")) {
+		t.Fatalf("file new not read: %+v", f)
+	}
+
+	// files gone are forgotten
+	os.Remove(filepath.Join(dir, "000000001-000000001.tsm"))
+	if err := s.listShardSnapshot(&ShardSnapshot{ShardID: 1, Dir: dir}); err != nil {
+		t.Fatalf("listShardSnapshot() failed: %v", err)
+	}
+	if _, ok := s.snapshotChecksums.shards[1]["000000001-000000001.tsm"]; ok {
+		t.Fatal("checksum of file gone kept")
+	}
+}
+
+// requestSnapshotFile requests a file of snapshot id of shard 1 from s,
+// returning its bytes.
+func requestSnapshotFile(t *testing.T, s *Service, id, name string) (string, error) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		s.handleConn(server)
+	}()
+
+	buf, _ := json.Marshal(&SnapshotFileRequest{ID: id, ShardID: 1, Name: name})
+	if err := coordinator.WriteTLV(client, byte(RequestSnapshotFile), buf); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	if typ, err := coordinator.ReadType(client); err != nil || typ != byte(ResponseSnapshotFile) {
+		t.Fatalf("unexpected response %d: %v", typ, err)
+	}
+	buf, err := coordinator.ReadLV(client, time.Second)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	var resp SnapshotFileResponse
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Code != 0 {
+		return "", io.ErrUnexpectedEOF
+	}
+	content := make([]byte, resp.Size)
+	if _, err := io.ReadFull(client, content); err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	return string(content), nil
+}
+
+func TestSnapshotFile(t *testing.T) {
+	store := newFakeStore(t)
+	defer store.Close()
+	dir := filepath.Join(store.addShard(t, "db0", "rp0", 1, true), snapshotDirPrefix+"a")
+	os.MkdirAll(dir, 0755)
+	writeFile(t, filepath.Join(dir, "000000001-000000001.tsm"), "tsm 1")
+	s := newTestService(consistencyMeta(), store)
+
+	if content, err := requestSnapshotFile(t, s, "a", "000000001-000000001.tsm"); err != nil || content != "tsm 1" {
+		t.Fatalf("unexpected file: %q, %v", content, err)
+	}
+	for _, tt := range []struct{ id, name string }{
+		{"b", "000000001-000000001.tsm"},
+		{"a", "../snapshot_a/000000001-000000001.tsm"},
+		{"../a", "000000001-000000001.tsm"},
+	} {
+		if _, err := requestSnapshotFile(t, s, tt.id, tt.name); err == nil {
+			t.Fatalf("file %s of snapshot %s served", tt.name, tt.id)
+		}
+	}
+}
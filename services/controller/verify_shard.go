@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/tsdb/engine/tsm1"
+
+	"github.com/angopher/chronus/errs"
+)
+
+const (
+	// shardDigestTimeout bounds digests of shards by their owners, which may
+	// read all blocks of the shard if no digest is cached on disk.
+	shardDigestTimeout = 10 * time.Minute
+
+	// maxSeriesDiffs is the max of series diverging listed by verification.
+	maxSeriesDiffs = 100
+)
+
+// Kinds of series diverging between owners of a shard.
+const (
+	// SeriesMissing is a series missing on some owners.
+	SeriesMissing = "missing"
+	// SeriesPoints is a series with different number of points or time range.
+	SeriesPoints = "points"
+	// SeriesBlocks is a series with the same points and time range but
+	// blocks of different checksums, i.e. different values or layout.
+	SeriesBlocks = "blocks"
+)
+
+type VerifyShardRequest struct {
+	ShardID uint64 `json:"shard_id"`
+}
+
+type ShardDigestRequest struct {
+	ShardID uint64 `json:"shard_id"`
+}
+
+// SeriesDigest summarizes blocks of a series in a shard.
+type SeriesDigest struct {
+	Key    string `json:"key"`
+	Points int64  `json:"points"`
+	Min    int64  `json:"min"`
+	Max    int64  `json:"max"`
+	Blocks int    `json:"blocks"`
+	CRC    uint32 `json:"crc"` // of checksums of blocks
+}
+
+type ShardDigestResponse struct {
+	CommonResp
+	Series []SeriesDigest `json:"series"`
+}
+
+// OwnerDigest is the digest of a shard on one of its owners.
+type OwnerDigest struct {
+	NodeID uint64 `json:"node_id"`
+	Series int    `json:"series"`
+	Points int64  `json:"points"`
+	// Checksum of digests of all series
+	Checksum uint32 `json:"checksum"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SeriesDiff is a series diverging between owners, Nodes are the owners
+// differing from the first one, or missing the series.
+type SeriesDiff struct {
+	Key   string   `json:"key"`
+	Kind  string   `json:"kind"`
+	Nodes []uint64 `json:"nodes"`
+}
+
+type VerifyShardResponse struct {
+	CommonResp
+	ShardID uint64        `json:"shard_id"`
+	Owners  []OwnerDigest `json:"owners"`
+	// Diffs are the first series diverging of DiffCount
+	Diffs     []SeriesDiff `json:"diffs"`
+	DiffCount int          `json:"diff_count"`
+}
+
+// Diverged returns whether replicas of the shard diverge.
+func (r *VerifyShardResponse) Diverged() bool {
+	return r.DiffCount > 0
+}
+
+func (s *Service) handleShardDigest(conn net.Conn) ([]SeriesDigest, error) {
+	var req ShardDigestRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	return s.shardDigest(req.ShardID)
+}
+
+func (s *Service) shardDigestResponse(w io.Writer, series []SeriesDigest, e error) {
+	var resp ShardDigestResponse
+	setError(&resp.CommonResp, e)
+	resp.Series = series
+	s.writeResponse(w, ResponseShardDigest, &resp)
+}
+
+// shardDigest returns digests of series of a local shard sorted by key. The
+// shard must be idle, i.e. not written recently and fully compacted.
+func (s *Service) shardDigest(shardID uint64) ([]SeriesDigest, error) {
+	sh := s.TSDBStore.Shard(shardID)
+	if sh == nil {
+		return nil, fmt.Errorf("%w: %d", errs.ErrShardNotFound, shardID)
+	}
+	rc, _, err := sh.Digest()
+	if err != nil {
+		return nil, err
+	}
+	r, err := tsm1.NewDigestReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	defer r.Close()
+
+	var (
+		series []SeriesDigest
+		buf    [4]byte
+	)
+	for {
+		key, ts, err := r.ReadTimeSpan()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		d := SeriesDigest{Key: key, Blocks: len(ts.Ranges)}
+		h := crc32.NewIEEE()
+		for i, tr := range ts.Ranges {
+			if i == 0 || tr.Min < d.Min {
+				d.Min = tr.Min
+			}
+			if i == 0 || tr.Max > d.Max {
+				d.Max = tr.Max
+			}
+			d.Points += int64(tr.N)
+			binary.BigEndian.PutUint32(buf[:], tr.CRC)
+			h.Write(buf[:])
+		}
+		d.CRC = h.Sum32()
+		series = append(series, d)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Key < series[j].Key })
+	return series, nil
+}
+
+func (s *Service) handleVerifyShard(conn net.Conn) (*VerifyShardResponse, error) {
+	var req VerifyShardRequest
+	if err := s.readRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	if req.ShardID < 1 {
+		return nil, errs.ErrShardIDRequired
+	}
+	return s.verifyShard(req.ShardID)
+}
+
+func (s *Service) verifyShardResponse(w io.Writer, report *VerifyShardResponse, e error) {
+	var resp VerifyShardResponse
+	if report != nil {
+		resp = *report
+	}
+	setError(&resp.CommonResp, e)
+	s.writeResponse(w, ResponseVerifyShard, &resp)
+}
+
+// verifyShard requests digests of a shard from all its owners at once and
+// compares them.
+func (s *Service) verifyShard(shardID uint64) (*VerifyShardResponse, error) {
+	_, _, sgi := s.MetaClient.ShardOwner(shardID)
+	if sgi == nil {
+		return nil, fmt.Errorf("%w: %d", errs.ErrShardNotFound, shardID)
+	}
+	var owners []uint64
+	for _, sh := range sgi.Shards {
+		if sh.ID == shardID {
+			for _, o := range sh.Owners {
+				owners = append(owners, o.NodeID)
+			}
+		}
+	}
+	nodes, err := s.MetaClient.DataNodes()
+	if err != nil {
+		return nil, err
+	}
+	addrs := make(map[uint64]string, len(nodes))
+	for _, n := range nodes {
+		addrs[n.ID] = n.TCPHost
+	}
+
+	var (
+		wg       sync.WaitGroup
+		digests  = make([][]SeriesDigest, len(owners))
+		failures = make([]error, len(owners))
+	)
+	for i, id := range owners {
+		wg.Add(1)
+		go func(i int, id uint64) {
+			defer wg.Done()
+			if s.Node != nil && id == s.Node.ID {
+				digests[i], failures[i] = s.shardDigest(shardID)
+				return
+			}
+			addr, ok := addrs[id]
+			if !ok {
+				failures[i] = fmt.Errorf("node %d not found", id)
+				return
+			}
+			var resp ShardDigestResponse
+			failures[i] = requestNodeWithin(addr, shardDigestTimeout, RequestShardDigest, ResponseShardDigest, &ShardDigestRequest{ShardID: shardID}, &resp)
+			if failures[i] == nil && resp.Code != 0 {
+				failures[i] = errors.New(resp.Msg)
+			}
+			digests[i] = resp.Series
+		}(i, id)
+	}
+	wg.Wait()
+
+	report := &VerifyShardResponse{ShardID: shardID}
+	var (
+		compared []uint64
+		series   []map[string]SeriesDigest
+	)
+	for i, id := range owners {
+		owner := OwnerDigest{NodeID: id}
+		if failures[i] != nil {
+			owner.Error = failures[i].Error()
+			report.Owners = append(report.Owners, owner)
+			continue
+		}
+		m := make(map[string]SeriesDigest, len(digests[i]))
+		for _, d := range digests[i] {
+			m[d.Key] = d
+			owner.Points += d.Points
+		}
+		owner.Series = len(m)
+		owner.Checksum = digestChecksum(digests[i])
+		report.Owners = append(report.Owners, owner)
+		compared = append(compared, id)
+		series = append(series, m)
+	}
+	report.Diffs, report.DiffCount = compareShardDigests(compared, series)
+	return report, nil
+}
+
+// digestChecksum sums up digests of series sorted by key, the same for
+// copies whose series have the same points and blocks.
+func digestChecksum(series []SeriesDigest) uint32 {
+	h := crc32.NewIEEE()
+	var buf [28]byte
+	for _, d := range series {
+		h.Write([]byte(d.Key))
+		binary.BigEndian.PutUint64(buf[:8], uint64(d.Points))
+		binary.BigEndian.PutUint64(buf[8:16], uint64(d.Min))
+		binary.BigEndian.PutUint64(buf[16:24], uint64(d.Max))
+		binary.BigEndian.PutUint32(buf[24:], d.CRC)
+		h.Write(buf[:])
+	}
+	return h.Sum32()
+}
+
+// compareShardDigests returns the first series diverging between owners
+// along with the number of all of them. Digests of each owner are keyed by
+// series, owners are compared to the first one.
+func compareShardDigests(owners []uint64, digests []map[string]SeriesDigest) ([]SeriesDiff, int) {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range digests {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var (
+		diffs []SeriesDiff
+		count int
+	)
+	for _, key := range keys {
+		var missing, points, blocks []uint64
+		first, hasFirst := digests[0][key]
+		for i := range digests {
+			d, ok := digests[i][key]
+			switch {
+			case !ok:
+				missing = append(missing, owners[i])
+			case !hasFirst || i == 0:
+			case d.Points != first.Points || d.Min != first.Min || d.Max != first.Max:
+				points = append(points, owners[i])
+			case d.Blocks != first.Blocks || d.CRC != first.CRC:
+				blocks = append(blocks, owners[i])
+			}
+		}
+
+		diff := SeriesDiff{Key: key}
+		switch {
+		case len(missing) > 0:
+			diff.Kind, diff.Nodes = SeriesMissing, missing
+		case len(points) > 0:
+			diff.Kind, diff.Nodes = SeriesPoints, points
+		case len(blocks) > 0:
+			diff.Kind, diff.Nodes = SeriesBlocks, blocks
+		default:
+			continue
+		}
+		count++
+		if len(diffs) < maxSeriesDiffs {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, count
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// unreachableAddr returns an address nothing listens on.
+func unreachableAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ln.Close()
+	return ln.Addr().String()
+}
+
+func TestVerifyShard(t *testing.T) {
+	store1, store2 := newFakeStore(t), newFakeStore(t)
+	defer store1.Close()
+	defer store2.Close()
+	points := "cpu,host=a value=1 1\ncpu,host=b value=1 1\nmem value=1 1\n"
+	store1.openShard(t, "db0", "rp0", 1, points)
+	store2.openShard(t, "db0", "rp0", 1, points)
+	// host=a misses a point, host=b has another value, mem is missing
+	store1.openShard(t, "db0", "rp0", 2, points+"cpu,host=a value=2 2\ndisk value=1 1")
+	store2.openShard(t, "db0", "rp0", 2, "cpu,host=a value=1 1\ncpu,host=b value=2 1\ndisk value=1 1")
+
+	mc := &fakeMetaClient{databases: []meta.DatabaseInfo{{
+		Name: "db0",
+		RetentionPolicies: []meta.RetentionPolicyInfo{{
+			Name:        "rp0",
+			ShardGroups: []meta.ShardGroupInfo{shardGroup(1, map[uint64][]uint64{1: {1, 2}, 2: {1, 2, 3}})},
+		}},
+	}}}
+	s1 := newTestService(mc, store1)
+	s2 := newTestService(mc, store2)
+	s2.Node = &influxdb.Node{ID: 2}
+	addr, stop := serveTestService(t, s2)
+	defer stop()
+	mc.nodes = []meta.NodeInfo{{ID: 1, TCPHost: "node1:8088"}, {ID: 2, TCPHost: addr}, {ID: 3, TCPHost: unreachableAddr(t)}}
+
+	report, err := s1.verifyShard(1)
+	if err != nil {
+		t.Fatalf("verifyShard() failed: %v", err)
+	}
+	if report.Diverged() || len(report.Owners) != 2 {
+		t.Fatalf("unexpected report of replicas: %+v", report)
+	}
+	if o1, o2 := report.Owners[0], report.Owners[1]; o1.Series != 3 || o1.Points != 3 || o1.Checksum != o2.Checksum || o1.Error != "" || o2.Error != "" {
+		t.Fatalf("owners of replicas mismatch: %+v", report.Owners)
+	}
+
+	report, err = s1.verifyShard(2)
+	if err != nil {
+		t.Fatalf("verifyShard() failed: %v", err)
+	}
+	exp := []SeriesDiff{
+		{Key: "cpu,host=a#!~#value", Kind: SeriesPoints, Nodes: []uint64{2}},
+		{Key: "cpu,host=b#!~#value", Kind: SeriesBlocks, Nodes: []uint64{2}},
+		{Key: "mem#!~#value", Kind: SeriesMissing, Nodes: []uint64{2}},
+	}
+	if !report.Diverged() || report.DiffCount != 3 || !reflect.DeepEqual(report.Diffs, exp) {
+		t.Fatalf("diffs mismatch: got %+v, exp %+v", report.Diffs, exp)
+	}
+	// owners not answering are reported but not compared
+	if len(report.Owners) != 3 || report.Owners[2].NodeID != 3 || report.Owners[2].Error == "" {
+		t.Fatalf("owner not answering not reported: %+v", report.Owners)
+	}
+	if report.Owners[0].Checksum == report.Owners[1].Checksum {
+		t.Fatalf("checksums of diverging replicas equal: %+v", report.Owners)
+	}
+
+	if _, err := s1.verifyShard(9); err == nil {
+		t.Fatal("shard not in meta verified")
+	}
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	// DefaultQueueSize is the default number of events waiting for delivery,
+	// events are dropped when it's full.
+	DefaultQueueSize = 1024
+
+	// DefaultTimeout is the default timeout of delivering an event to a sink.
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultNatsSubject is the default subject events are published to.
+	DefaultNatsSubject = "chronus.events"
+
+	// DefaultKafkaTopic is the default topic events are produced to.
+	DefaultKafkaTopic = "chronus-events"
+)
+
+// Config is the configuration of sinks which cluster events are emitted to.
+// Nothing is emitted without any sink configured.
+type Config struct {
+	// WebhookURLs receive each event posted as json
+	WebhookURLs []string `toml:"webhook-urls"`
+
+	// NatsURL is the address of nats server like nats://127.0.0.1:4222
+	NatsURL     string `toml:"nats-url"`
+	NatsSubject string `toml:"nats-subject"`
+
+	KafkaBrokers []string `toml:"kafka-brokers"`
+	KafkaTopic   string   `toml:"kafka-topic"`
+
+	QueueSize int           `toml:"queue-size"`
+	Timeout   toml.Duration `toml:"timeout"`
+}
+
+// NewConfig returns a new Config.
+func NewConfig() Config {
+	return Config{
+		NatsSubject: DefaultNatsSubject,
+		KafkaTopic:  DefaultKafkaTopic,
+		QueueSize:   DefaultQueueSize,
+		Timeout:     toml.Duration(DefaultTimeout),
+	}
+}
+
+// Enabled returns whether any sink is configured.
+func (c *Config) Enabled() bool {
+	return len(c.WebhookURLs) > 0 || c.NatsURL != "" || len(c.KafkaBrokers) > 0
+}
+
+func (c *Config) Validate() error {
+	for _, s := range c.WebhookURLs {
+		if u, err := url.Parse(s); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("Events.WebhookURLs is invalid")
+		}
+	}
+	if c.NatsURL != "" {
+		if u, err := url.Parse(c.NatsURL); err != nil || u.Host == "" {
+			return errors.New("Events.NatsURL is invalid")
+		}
+		if c.NatsSubject == "" {
+			return errors.New("Events.NatsSubject must be specified")
+		}
+	}
+	if len(c.KafkaBrokers) > 0 && c.KafkaTopic == "" {
+		return errors.New("Events.KafkaTopic must be specified")
+	}
+	if c.Enabled() && c.QueueSize <= 0 {
+		return errors.New("Events.QueueSize must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Package events emits cluster topology changes to external sinks so that
+// automation can react to them.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	EventNodeAdded         = "node_added"
+	EventNodeRemoved       = "node_removed"
+	EventNodeFrozen        = "node_frozen"
+	EventNodeUnfrozen      = "node_unfrozen"
+	EventShardOwnerAdded   = "shard_owner_added"
+	EventShardOwnerRemoved = "shard_owner_removed"
+	EventShardDropped      = "shard_dropped"
+	EventDatabaseDropped   = "database_dropped"
+)
+
+// Event is a structured cluster change.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Source is the address of the node emitting the event
+	Source string `json:"source"`
+
+	NodeID   uint64 `json:"node_id,omitempty"`
+	ShardID  uint64 `json:"shard_id,omitempty"`
+	Database string `json:"database,omitempty"`
+	// Attrs holds details of specific event type
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// Sink delivers events to an external system.
+type Sink interface {
+	Name() string
+	Send(e *Event) error
+	Close() error
+}
+
+// Bus delivers events to sinks asynchronously. A nil Bus drops events so
+// that emitting needs no checking.
+type Bus struct {
+	source string
+	sinks  []Sink
+	queue  chan *Event
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+
+	dropped int64
+	failed  int64
+
+	Logger *zap.Logger
+}
+
+// NewBus returns a bus delivering to sinks configured, nil if none is.
+func NewBus(c Config, source string, logger *zap.Logger) (*Bus, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(c.Timeout)
+	b := &Bus{
+		source: source,
+		queue:  make(chan *Event, c.QueueSize),
+		Logger: logger.With(zap.String("service", "events")),
+	}
+	for _, u := range c.WebhookURLs {
+		b.sinks = append(b.sinks, newWebhookSink(u, timeout))
+	}
+	if c.NatsURL != "" {
+		s, err := newNatsSink(c.NatsURL, c.NatsSubject, timeout)
+		if err != nil {
+			return nil, err
+		}
+		b.sinks = append(b.sinks, s)
+	}
+	if len(c.KafkaBrokers) > 0 {
+		b.sinks = append(b.sinks, newKafkaSink(c.KafkaBrokers, c.KafkaTopic, timeout))
+	}
+	return newBus(b), nil
+}
+
+// newBus starts delivering events of b
+func newBus(b *Bus) *Bus {
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+func (b *Bus) run() {
+	defer b.wg.Done()
+	for e := range b.queue {
+		for _, s := range b.sinks {
+			if err := s.Send(e); err != nil {
+				atomic.AddInt64(&b.failed, 1)
+				b.Logger.Warn("failed to emit event",
+					zap.String("sink", s.Name()),
+					zap.String("type", e.Type),
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// Publish queues e for delivery without blocking, e is dropped if the queue
+// is full.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Source == "" {
+		e.Source = b.source
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return
+	}
+	select {
+	case b.queue <- &e:
+	default:
+		atomic.AddInt64(&b.dropped, 1)
+		b.Logger.Warn("event queue is full, dropped", zap.String("type", e.Type))
+	}
+}
+
+// Dropped returns the count of events dropped because of full queue.
+func (b *Bus) Dropped() int64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&b.dropped)
+}
+
+// Failed returns the count of failed deliveries.
+func (b *Bus) Failed() int64 {
+	if b == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&b.failed)
+}
+
+// Close delivers events queued and closes sinks.
+func (b *Bus) Close() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	for _, s := range b.sinks {
+		s.Close()
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestBus_Disabled(t *testing.T) {
+	b, err := NewBus(NewConfig(), "127.0.0.1:2347", zap.NewNop())
+	assert.Nil(t, err)
+	assert.Nil(t, b)
+
+	// nil bus drops silently
+	b.Publish(Event{Type: EventNodeAdded})
+	assert.Nil(t, b.Close())
+}
+
+func TestBus_Webhook(t *testing.T) {
+	received := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		var e Event
+		assert.Nil(t, json.Unmarshal(data, &e))
+		received <- e
+	}))
+	defer srv.Close()
+
+	c := NewConfig()
+	c.WebhookURLs = []string{srv.URL}
+	b, err := NewBus(c, "127.0.0.1:2347", zap.NewNop())
+	assert.Nil(t, err)
+
+	b.Publish(Event{Type: EventNodeFrozen, NodeID: 3})
+	assert.Nil(t, b.Close())
+
+	e := <-received
+	assert.Equal(t, EventNodeFrozen, e.Type)
+	assert.Equal(t, uint64(3), e.NodeID)
+	assert.Equal(t, "127.0.0.1:2347", e.Source)
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, int64(0), b.Failed())
+
+	// published after closing is ignored
+	b.Publish(Event{Type: EventNodeUnfrozen})
+}
+
+func TestBus_Nats(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	published := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {}\r\n"))
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "PUB "):
+				fields := strings.Fields(line)
+				assert.Equal(t, "cluster.events", fields[1])
+				n, _ := strconv.Atoi(fields[2])
+				payload := make([]byte, n+2)
+				io.ReadFull(r, payload)
+				published <- string(payload[:n])
+			case strings.HasPrefix(line, "PING"):
+				conn.Write([]byte("PONG\r\n"))
+			}
+		}
+	}()
+
+	c := NewConfig()
+	c.NatsURL = "nats://" + l.Addr().String()
+	c.NatsSubject = "cluster.events"
+	b, err := NewBus(c, "127.0.0.1:2347", zap.NewNop())
+	assert.Nil(t, err)
+
+	b.Publish(Event{Type: EventShardOwnerAdded, ShardID: 10, NodeID: 2})
+	assert.Nil(t, b.Close())
+	assert.Equal(t, int64(0), b.Failed())
+
+	var e Event
+	assert.Nil(t, json.Unmarshal([]byte(<-published), &e))
+	assert.Equal(t, EventShardOwnerAdded, e.Type)
+	assert.Equal(t, uint64(10), e.ShardID)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	c := NewConfig()
+	assert.Nil(t, c.Validate())
+	c.WebhookURLs = []string{"localhost"}
+	assert.NotNil(t, c.Validate())
+
+	c = NewConfig()
+	c.KafkaBrokers = []string{"127.0.0.1:9092"}
+	c.KafkaTopic = ""
+	assert.NotNil(t, c.Validate())
+}
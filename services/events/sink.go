@@ -0,0 +1,178 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhookSink(url string, timeout time.Duration) *webhookSink {
+	return &webhookSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *webhookSink) Name() string { return "webhook " + s.url }
+
+func (s *webhookSink) Send(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error { return nil }
+
+// natsSink publishes through the nats text protocol. Topology changes are
+// rare so a connection is made for each event instead of being kept alive.
+type natsSink struct {
+	addr    string
+	user    *url.Userinfo
+	subject string
+	timeout time.Duration
+}
+
+func newNatsSink(natsURL, subject string, timeout time.Duration) (*natsSink, error) {
+	u, err := url.Parse(natsURL)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &natsSink{
+		addr:    addr,
+		user:    u.User,
+		subject: subject,
+		timeout: timeout,
+	}, nil
+}
+
+func (s *natsSink) Name() string { return "nats " + s.addr }
+
+func (s *natsSink) connectOptions() []byte {
+	opts := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "chronus",
+	}
+	if s.user != nil {
+		opts["user"] = s.user.Username()
+		if pass, ok := s.user.Password(); ok {
+			opts["pass"] = pass
+		}
+	}
+	data, _ := json.Marshal(opts)
+	return data
+}
+
+func (s *natsSink) Send(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", s.addr, s.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	r := bufio.NewReader(conn)
+	// server greets with INFO
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return fmt.Errorf("unexpected nats greeting: %s", strings.TrimSpace(line))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CONNECT %s\r\n", s.connectOptions())
+	fmt.Fprintf(&buf, "PUB %s %d\r\n", s.subject, len(data))
+	buf.Write(data)
+	// PONG confirms the server has processed the publishing
+	buf.WriteString("\r\nPING\r\n")
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(line, "PONG"):
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("nats: %s", strings.TrimSpace(line[4:]))
+		}
+	}
+}
+
+func (s *natsSink) Close() error { return nil }
+
+type kafkaSink struct {
+	writer  *kafka.Writer
+	topic   string
+	timeout time.Duration
+}
+
+func newKafkaSink(brokers []string, topic string, timeout time.Duration) *kafkaSink {
+	return &kafkaSink{
+		writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers: brokers,
+			Topic:   topic,
+		}),
+		topic:   topic,
+		timeout: timeout,
+	}
+}
+
+func (s *kafkaSink) Name() string { return "kafka " + s.topic }
+
+func (s *kafkaSink) Send(e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(e.Type),
+		Value: data,
+	})
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,89 @@
+package hh
+
+import (
+	"sync"
+	"time"
+)
+
+// appendBatcher coalesces writes appended to a queue concurrently, so that
+// they are written with a single sync and writes of the same shard share a
+// block. A batch is appended once it reaches maxSize or delay after its first
+// write, and every write waits for its batch to be appended.
+type appendBatcher struct {
+	queue   blockQueue
+	maxSize int
+	delay   time.Duration
+
+	mu  sync.Mutex
+	cur *appendBatch
+}
+
+type appendBatch struct {
+	blocks [][]byte
+	shards map[uint64]int // position of shard's block in blocks
+	size   int
+	timer  *time.Timer
+
+	done chan struct{}
+	err  error
+}
+
+func newAppendBatcher(q blockQueue, maxSize int, delay time.Duration) *appendBatcher {
+	return &appendBatcher{
+		queue:   q,
+		maxSize: maxSize,
+		delay:   delay,
+	}
+}
+
+// append adds block b of marshalWrite for shardID to the batch, then waits for
+// it to be appended.
+func (a *appendBatcher) append(shardID uint64, b []byte) error {
+	a.mu.Lock()
+	batch := a.cur
+	if batch == nil {
+		batch = &appendBatch{
+			shards: make(map[uint64]int),
+			done:   make(chan struct{}),
+		}
+		batch.timer = time.AfterFunc(a.delay, func() { a.flush(batch) })
+		a.cur = batch
+	}
+	if i, ok := batch.shards[shardID]; ok {
+		// points of the same shard follow in a block, taken as queued with
+		// the last ones not to skip them for measurements dropped in between
+		off := blockPointsOffset(b)
+		if off == blockPointsOffset(batch.blocks[i]) {
+			copy(batch.blocks[i][8:off], b[8:off])
+		}
+		batch.blocks[i] = append(batch.blocks[i], b[off:]...)
+		batch.size += len(b) - off
+	} else {
+		batch.shards[shardID] = len(batch.blocks)
+		batch.blocks = append(batch.blocks, b)
+		batch.size += len(b)
+	}
+	full := batch.size >= a.maxSize
+	a.mu.Unlock()
+
+	if full {
+		batch.timer.Stop()
+		a.flush(batch)
+	}
+	<-batch.done
+	return batch.err
+}
+
+// flush appends batch unless it's done already.
+func (a *appendBatcher) flush(batch *appendBatch) {
+	a.mu.Lock()
+	if a.cur != batch {
+		a.mu.Unlock()
+		return
+	}
+	a.cur = nil
+	a.mu.Unlock()
+
+	batch.err = a.queue.AppendBatch(batch.blocks)
+	close(batch.done)
+}
@@ -2,8 +2,11 @@ package hh
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 	"time"
 
+	"github.com/angopher/chronus/x"
 	"github.com/influxdata/influxdb/toml"
 )
 
@@ -33,8 +36,51 @@ const (
 	// DefaultPurgeInterval is the amount of time the system waits before attempting
 	// to purge hinted handoff data due to age or inactive nodes.
 	DefaultPurgeInterval = time.Hour
+
+	// DefaultOrphanGracePeriod is the default amount of time a node must be
+	// absent from meta before its queue is reaped. A value of 0 disables it.
+	DefaultOrphanGracePeriod = 24 * time.Hour
+
+	// DefaultWriteThroughWindow is the default amount of time after the first
+	// failure of a write to node, in which failed writes are held in memory and
+	// retried directly instead of going to the queue. A value of 0 disables it.
+	DefaultWriteThroughWindow = 0
+
+	// DefaultWriteThroughBufferSize is the default maximum size in bytes of failed
+	// writes held in memory for each node in write-through window.
+	DefaultWriteThroughBufferSize = 16 * 1024 * 1024
+
+	// DefaultAdvanceFailureThreshold is the default number of failures in a row
+	// advancing a node queue, after which the node is reported unhealthy. A
+	// value of 0 disables it.
+	DefaultAdvanceFailureThreshold = 3
+
+	// DefaultAppendBatchDelay is the default time writes to a node wait to be
+	// appended to its queue together. A value of 0 appends every write alone.
+	DefaultAppendBatchDelay = 0
+
+	// DefaultAppendBatchSize is the default size in bytes of writes appended
+	// together, at which they are appended without waiting more.
+	DefaultAppendBatchSize = 1024 * 1024
+
+	// DefaultLagReportInterval is the default interval of writing the lag of each
+	// node queue as points into database. A value of 0 disables it.
+	DefaultLagReportInterval = 0
+
+	// DefaultLagReportDatabase is the default database the lag of queues is written to.
+	DefaultLagReportDatabase = "_internal"
+
+	// DefaultLagReportRetentionPolicy is the default retention policy the lag of
+	// queues is written to.
+	DefaultLagReportRetentionPolicy = "monitor"
 )
 
+// DatabaseMaxAge overrides MaxAge for hinted data of a database.
+type DatabaseMaxAge struct {
+	Database string        `toml:"database"`
+	MaxAge   toml.Duration `toml:"max-age"`
+}
+
 // Config is a hinted handoff configuration.
 type Config struct {
 	Enabled          bool          `toml:"enabled"`
@@ -46,6 +92,53 @@ type Config struct {
 	RetryInterval    toml.Duration `toml:"retry-interval"`
 	RetryMaxInterval toml.Duration `toml:"retry-max-interval"`
 	PurgeInterval    toml.Duration `toml:"purge-interval"`
+
+	// DatabaseMaxAges override MaxAge for the databases listed, e.g. keeping
+	// hinted data of critical databases longer than of scratch metrics.
+	DatabaseMaxAges []DatabaseMaxAge `toml:"database-max-ages"`
+
+	// RetryRateWindows are rate limits in daily time windows, RetryRateLimit
+	// applies out of them.
+	RetryRateWindows []x.BandwidthWindow `toml:"retry-rate-windows"`
+
+	// PurgeNotifyURL is a webhook which undelivered data being purged is
+	// posted to as json. Empty disables the notification.
+	PurgeNotifyURL string `toml:"purge-notify-url"`
+
+	// OrphanGracePeriod reaps queues of nodes absent from meta so long, moving
+	// them into OrphanArchiveDir if set or purging them otherwise.
+	OrphanGracePeriod toml.Duration `toml:"orphan-grace-period"`
+	OrphanArchiveDir  string        `toml:"orphan-archive-dir"`
+
+	// WriteThroughWindow and WriteThroughBufferSize control holding failed
+	// writes in memory in a short outage. See DefaultWriteThroughWindow.
+	WriteThroughWindow     toml.Duration `toml:"write-through-window"`
+	WriteThroughBufferSize int64         `toml:"write-through-buffer-size"`
+
+	// AdvanceFailureThreshold marks a node unhealthy after its queue failed to
+	// advance so many times in a row, e.g. on disk errors, and
+	// BlockWritesWhenUnhealthy refuses new writes for it then.
+	AdvanceFailureThreshold  int  `toml:"advance-failure-threshold"`
+	BlockWritesWhenUnhealthy bool `toml:"block-writes-when-unhealthy"`
+
+	// AppendBatchDelay and AppendBatchSize coalesce small writes appended to
+	// queues. See DefaultAppendBatchDelay.
+	AppendBatchDelay toml.Duration `toml:"append-batch-delay"`
+	AppendBatchSize  int           `toml:"append-batch-size"`
+
+	// EncryptionKeyFile or EncryptionKeyCommand gives the key encrypting
+	// queues on disk by AES-GCM, in hex or base64. Empty stores them plain.
+	EncryptionKeyFile    string `toml:"encryption-key-file"`
+	EncryptionKeyCommand string `toml:"encryption-key-command"`
+
+	// QueueBackend stores queues on disk, QueueBackendSegment by default or
+	// QueueBackendBadger. Queues left by the other backend are migrated on
+	// open.
+	QueueBackend string `toml:"queue-backend"`
+
+	LagReportInterval        toml.Duration `toml:"lag-report-interval"`
+	LagReportDatabase        string        `toml:"lag-report-database"`
+	LagReportRetentionPolicy string        `toml:"lag-report-retention-policy"`
 }
 
 // NewConfig returns a new Config.
@@ -58,6 +151,22 @@ func NewConfig() Config {
 		RetryInterval:    toml.Duration(DefaultRetryInterval),
 		RetryMaxInterval: toml.Duration(DefaultRetryMaxInterval),
 		PurgeInterval:    toml.Duration(DefaultPurgeInterval),
+
+		OrphanGracePeriod: toml.Duration(DefaultOrphanGracePeriod),
+
+		WriteThroughWindow:     toml.Duration(DefaultWriteThroughWindow),
+		WriteThroughBufferSize: DefaultWriteThroughBufferSize,
+
+		AdvanceFailureThreshold: DefaultAdvanceFailureThreshold,
+
+		AppendBatchDelay: toml.Duration(DefaultAppendBatchDelay),
+		AppendBatchSize:  DefaultAppendBatchSize,
+
+		QueueBackend: QueueBackendSegment,
+
+		LagReportInterval:        toml.Duration(DefaultLagReportInterval),
+		LagReportDatabase:        DefaultLagReportDatabase,
+		LagReportRetentionPolicy: DefaultLagReportRetentionPolicy,
 	}
 }
 
@@ -65,5 +174,58 @@ func (c *Config) Validate() error {
 	if c.Enabled && c.Dir == "" {
 		return errors.New("HintedHandoff.Dir must be specified")
 	}
+	if c.Enabled && c.LagReportInterval > 0 && c.LagReportDatabase == "" {
+		return errors.New("HintedHandoff.LagReportDatabase must be specified")
+	}
+	if c.EncryptionKeyFile != "" && c.EncryptionKeyCommand != "" {
+		return errors.New("HintedHandoff.EncryptionKeyFile and EncryptionKeyCommand are exclusive")
+	}
+	if !validQueueBackend(c.QueueBackend) {
+		return fmt.Errorf("HintedHandoff.QueueBackend %q is unknown", c.QueueBackend)
+	}
+	if err := x.ValidateBandwidthWindows(c.RetryRateWindows); err != nil {
+		return fmt.Errorf("HintedHandoff.RetryRateWindows is invalid: %v", err)
+	}
+	seen := make(map[string]bool, len(c.DatabaseMaxAges))
+	for _, a := range c.DatabaseMaxAges {
+		if a.Database == "" {
+			return errors.New("HintedHandoff.DatabaseMaxAges needs a database")
+		}
+		if seen[a.Database] {
+			return fmt.Errorf("HintedHandoff.DatabaseMaxAges has database %q twice", a.Database)
+		}
+		seen[a.Database] = true
+		if a.MaxAge <= 0 {
+			return fmt.Errorf("HintedHandoff.DatabaseMaxAges of database %q must be positive", a.Database)
+		}
+	}
+	if c.PurgeNotifyURL != "" {
+		if u, err := url.Parse(c.PurgeNotifyURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("HintedHandoff.PurgeNotifyURL is invalid")
+		}
+	}
 	return nil
 }
+
+// databaseMaxAges returns DatabaseMaxAges by database, nil if none.
+func (c *Config) databaseMaxAges() map[string]time.Duration {
+	if len(c.DatabaseMaxAges) == 0 {
+		return nil
+	}
+	ages := make(map[string]time.Duration, len(c.DatabaseMaxAges))
+	for _, a := range c.DatabaseMaxAges {
+		ages[a.Database] = time.Duration(a.MaxAge)
+	}
+	return ages
+}
+
+// longestMaxAge returns the longest age hinted data of any database is kept.
+func (c *Config) longestMaxAge() time.Duration {
+	age := time.Duration(c.MaxAge)
+	for _, a := range c.DatabaseMaxAges {
+		if time.Duration(a.MaxAge) > age {
+			age = time.Duration(a.MaxAge)
+		}
+	}
+	return age
+}
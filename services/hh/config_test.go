@@ -18,6 +18,15 @@ max-size=2048
 max-age="20m"
 retry-rate-limit=1000
 purge-interval = "1h"
+orphan-grace-period = "48h"
+queue-backend = "badger"
+[[retry-rate-windows]]
+start = "00:00"
+end = "06:00"
+rate = 0
+[[database-max-ages]]
+database = "critical"
+max-age = "720h"
 `, &c); err != nil {
 		t.Fatal(err)
 	}
@@ -51,6 +60,38 @@ purge-interval = "1h"
 		t.Fatalf("unexpected purge interval: got %v, exp %v", c.PurgeInterval, exp)
 	}
 
+	if exp := 48 * time.Hour; c.OrphanGracePeriod.String() != exp.String() {
+		t.Fatalf("unexpected orphan grace period: got %v, exp %v", c.OrphanGracePeriod, exp)
+	}
+
+	if exp := QueueBackendBadger; c.QueueBackend != exp {
+		t.Fatalf("unexpected queue backend: got %v, exp %v", c.QueueBackend, exp)
+	}
+
+	if len(c.RetryRateWindows) != 1 || c.RetryRateWindows[0].Start != "00:00" || c.RetryRateWindows[0].End != "06:00" {
+		t.Fatalf("unexpected retry rate windows: %+v", c.RetryRateWindows)
+	}
+	if exp := 720 * time.Hour; len(c.DatabaseMaxAges) != 1 || c.DatabaseMaxAges[0].Database != "critical" ||
+		time.Duration(c.DatabaseMaxAges[0].MaxAge) != exp {
+		t.Fatalf("unexpected database max ages: %+v", c.DatabaseMaxAges)
+	}
+	if exp := 720 * time.Hour; c.longestMaxAge() != exp {
+		t.Fatalf("unexpected longest max age: got %v, exp %v", c.longestMaxAge(), exp)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+
+	c.DatabaseMaxAges = append(c.DatabaseMaxAges, c.DatabaseMaxAges[0])
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error of a database given twice")
+	}
+
+	c.DatabaseMaxAges = c.DatabaseMaxAges[:1]
+	c.QueueBackend = "pebble"
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error of an unknown queue backend")
+	}
 }
 
 func TestDefaultDisabled(t *testing.T) {
@@ -0,0 +1,124 @@
+package hh
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/angopher/chronus/errs"
+)
+
+// ErrQueueEncrypted is returned reading a block encrypted by a key not
+// configured.
+var ErrQueueEncrypted = errs.ErrQueueEncrypted
+
+// encryptedMagic starts encrypted blocks. Plain blocks start with a shard id
+// in big endian, whose top byte is never 0xff in practice.
+var encryptedMagic = []byte{0xff, 'h', 'e', 1}
+
+const keyIDSize = 4
+
+// blockCipher encrypts blocks of queues by AES-GCM. An encrypted block is
+//
+//	magic (4 bytes) | key id (4 bytes) | nonce (12 bytes) | sealed block
+//
+// Plain blocks appended before encryption was enabled are read as they are,
+// so queues drain across enabling it.
+type blockCipher struct {
+	aead  cipher.AEAD
+	keyID []byte
+}
+
+func newBlockCipher(key []byte) (*blockCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &blockCipher{aead: aead, keyID: sum[:keyIDSize]}, nil
+}
+
+// seal returns b encrypted, or b itself if c is nil.
+func (c *blockCipher) seal(b []byte) ([]byte, error) {
+	if c == nil {
+		return b, nil
+	}
+	header := len(encryptedMagic) + keyIDSize + c.aead.NonceSize()
+	out := make([]byte, header, header+len(b)+c.aead.Overhead())
+	copy(out, encryptedMagic)
+	copy(out[len(encryptedMagic):], c.keyID)
+	nonce := out[len(encryptedMagic)+keyIDSize : header]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(out, nonce, b, nil), nil
+}
+
+// open returns b decrypted if it's encrypted, or b itself.
+func (c *blockCipher) open(b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, encryptedMagic) {
+		return b, nil
+	}
+	b = b[len(encryptedMagic):]
+	if c == nil || len(b) < keyIDSize || !bytes.Equal(b[:keyIDSize], c.keyID) {
+		return nil, ErrQueueEncrypted
+	}
+	b = b[keyIDSize:]
+	if len(b) < c.aead.NonceSize() {
+		return nil, errors.New("encrypted block too short")
+	}
+	nonce, sealed := b[:c.aead.NonceSize()], b[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, sealed, nil)
+}
+
+// loadEncryptionKey reads the key from file, or from the output of command
+// run by the shell, e.g. a KMS client decrypting a data key. The key is
+// 16, 24 or 32 bytes in hex or base64.
+func loadEncryptionKey(file, command string) ([]byte, error) {
+	var raw []byte
+	var err error
+	switch {
+	case file != "":
+		raw, err = ioutil.ReadFile(file)
+	case command != "":
+		raw, err = exec.Command("sh", "-c", command).Output()
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load encryption key: %v", err)
+	}
+	key, err := decodeEncryptionKey(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("load encryption key: %v", err)
+	}
+	return key, nil
+}
+
+func decodeEncryptionKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		if key, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, errors.New("key is neither hex nor base64")
+		}
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("key of %d bytes, expected 16, 24 or 32", len(key))
+}
@@ -0,0 +1,320 @@
+package hh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// faultWriter is a target node failing and slowing down writes on demand. It
+// records how many times every block, identified by the seq field of its
+// points, was delivered.
+type faultWriter struct {
+	mu        sync.Mutex
+	down      bool
+	failEvery int           // every n-th write fails if positive
+	delay     time.Duration // latency of every write
+	calls     int
+	delivered map[int64]int
+}
+
+func newFaultWriter() *faultWriter {
+	return &faultWriter{delivered: make(map[int64]int)}
+}
+
+func (f *faultWriter) WriteShard(shardID imeta.ShardID, nodeID imeta.NodeID, points []models.Point) error {
+	if f.delay > 0 {
+		time.Sleep(f.delay)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.down {
+		return fmt.Errorf("connection refused")
+	}
+	if f.failEvery > 0 && f.calls%f.failEvery == 0 {
+		return fmt.Errorf("i/o timeout")
+	}
+	// all the points of a block have its seq
+	fields, err := points[0].Fields()
+	if err != nil {
+		return err
+	}
+	f.delivered[fields["seq"].(int64)]++
+	return nil
+}
+
+func (f *faultWriter) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+// check fails t unless every acked block is delivered exactly once and no
+// other is delivered.
+func (f *faultWriter) check(t *testing.T, acked map[int64]bool) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for seq, ok := range acked {
+		if c := f.delivered[seq]; ok && c != 1 {
+			t.Errorf("block %d delivered %d times", seq, c)
+		}
+	}
+	for seq, c := range f.delivered {
+		if !acked[seq] {
+			t.Errorf("block %d not acked delivered %d times", seq, c)
+		}
+	}
+}
+
+// harness drives a NodeProcessor to a faultWriter by hand, the background
+// sending is disabled.
+type harness struct {
+	dir    string
+	n      *NodeProcessor
+	w      *faultWriter
+	active int32
+}
+
+func newHarness(tb testing.TB, w *faultWriter, maxSize int64) *harness {
+	dir, err := ioutil.TempDir("", "hh_harness")
+	if err != nil {
+		tb.Fatalf("failed to create temp dir: %v", err)
+	}
+	h := &harness{dir: dir, w: w, active: 1}
+	h.open(tb, maxSize)
+	return h
+}
+
+func (h *harness) DataNode(nodeID uint64) (*meta.NodeInfo, error) {
+	if atomic.LoadInt32(&h.active) == 0 {
+		return nil, nil
+	}
+	return &meta.NodeInfo{ID: nodeID}, nil
+}
+
+func (h *harness) open(tb testing.TB, maxSize int64) {
+	h.n = NewNodeProcessor(1, h.dir, h.w, h)
+	h.n.MaxSize = maxSize
+	h.n.RetryInterval = time.Hour
+	h.n.RetryMaxInterval = time.Hour
+	h.n.PurgeInterval = time.Hour
+	if err := h.n.Open(); err != nil {
+		tb.Fatalf("Failed to open node processor: %v", err)
+	}
+}
+
+func (h *harness) reopen(tb testing.TB) {
+	if err := h.n.Close(); err != nil {
+		tb.Fatalf("Failed to close node processor: %v", err)
+	}
+	h.open(tb, h.n.MaxSize)
+}
+
+func (h *harness) close() {
+	h.n.Close()
+	os.RemoveAll(h.dir)
+}
+
+// write queues block seq of points, returning whether it's acked.
+func (h *harness) write(tb testing.TB, seq int64, points int) bool {
+	pts := make([]models.Point, points)
+	for i := range pts {
+		pts[i] = models.MustNewPoint("cpu", models.Tags{{Key: []byte("host"), Value: []byte(fmt.Sprint("server", i))}},
+			models.Fields{"seq": seq}, time.Unix(seq, 0))
+	}
+	if err := h.n.WriteShard(imeta.ShardID(seq%4), pts); err == ErrQueueFull {
+		return false
+	} else if err != nil {
+		tb.Fatalf("WriteShard() failed: %v", err)
+	}
+	return true
+}
+
+// drain sends blocks until the queue is empty, giving up after max attempts.
+// It returns the blocks sent.
+func (h *harness) drain(tb testing.TB, max int) int {
+	var sent int
+	for i := 0; i < max; i++ {
+		_, err := h.n.SendWrite()
+		if err == nil {
+			sent++
+		} else if err == io.EOF && atomic.LoadInt32(&h.active) == 1 {
+			return sent
+		}
+	}
+	tb.Fatalf("queue not drained after %d attempts, %d bytes pending", max, h.n.queue.Pending())
+	return sent
+}
+
+func TestHarnessFlakyTarget(t *testing.T) {
+	w := newFaultWriter()
+	w.failEvery = 3
+	h := newHarness(t, w, DefaultMaxSize)
+	defer h.close()
+
+	acked := make(map[int64]bool)
+	var seq int64
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 40; i++ {
+			acked[seq] = h.write(t, seq, 5)
+			seq++
+		}
+
+		// the target goes down, then leaves the cluster for a while
+		w.setDown(true)
+		for i := 0; i < 10; i++ {
+			if _, err := h.n.SendWrite(); err == nil {
+				t.Fatalf("SendWrite() succeeded to a node down")
+			}
+		}
+		atomic.StoreInt32(&h.active, 0)
+		if _, err := h.n.SendWrite(); err != io.EOF {
+			t.Fatalf("SendWrite() to a node inactive: got %v, exp %v", err, io.EOF)
+		}
+		w.setDown(false)
+		atomic.StoreInt32(&h.active, 1)
+
+		// blocks half sent are kept across restarts
+		for i := 0; i < 10; i++ {
+			h.n.SendWrite()
+		}
+		h.reopen(t)
+	}
+
+	start := time.Now()
+	h.drain(t, 10*int(seq))
+	t.Logf("drained %d blocks in %v", seq, time.Since(start))
+	w.check(t, acked)
+}
+
+func TestHarnessSlowWriter(t *testing.T) {
+	w := newFaultWriter()
+	w.delay = time.Millisecond
+	h := newHarness(t, w, DefaultMaxSize)
+	defer h.close()
+
+	// writes keep coming while the slow target is drained
+	acked := make(map[int64]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for seq := int64(0); seq < 200; seq++ {
+			ok := h.write(t, seq, 10)
+			mu.Lock()
+			acked[seq] = ok
+			mu.Unlock()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		h.n.SendWrite()
+	}
+	wg.Wait()
+
+	h.drain(t, 1000)
+	w.check(t, acked)
+}
+
+func TestHarnessCorruptBlock(t *testing.T) {
+	w := newFaultWriter()
+	h := newHarness(t, w, DefaultMaxSize)
+	defer h.close()
+
+	acked := make(map[int64]bool)
+	for seq := int64(0); seq < 10; seq++ {
+		acked[seq] = h.write(t, seq, 3)
+	}
+	h.n.Close()
+
+	// overwrite the points of block 4 in place, its length stays valid
+	path := filepath.Join(h.dir, "1")
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	var off int64
+	for seq := 0; seq <= 4; seq++ {
+		var size [8]byte
+		if _, err := f.ReadAt(size[:], off); err != nil {
+			t.Fatalf("failed to read block size: %v", err)
+		}
+		sz := int64(binary.BigEndian.Uint64(size[:]))
+		if seq == 4 {
+			garbage := make([]byte, sz-8)
+			for i := range garbage {
+				garbage[i] = 'x'
+			}
+			// keep the shard id, corrupt the line protocol
+			if _, err := f.WriteAt(garbage, off+16); err != nil {
+				t.Fatalf("failed to corrupt block: %v", err)
+			}
+		}
+		off += 8 + sz
+	}
+	f.Close()
+	delete(acked, 4)
+
+	h.open(t, DefaultMaxSize)
+	h.drain(t, 100)
+	w.check(t, acked)
+}
+
+func TestHarnessDiskFull(t *testing.T) {
+	w := newFaultWriter()
+	w.setDown(true)
+	h := newHarness(t, w, 4*1024)
+	defer h.close()
+
+	// the queue fills up while the target is down, writes beyond are refused
+	acked := make(map[int64]bool)
+	var refused int
+	for seq := int64(0); seq < 100; seq++ {
+		if h.write(t, seq, 2) {
+			acked[seq] = true
+		} else {
+			refused++
+		}
+	}
+	if refused == 0 || len(acked) == 0 {
+		t.Fatalf("unexpected writes: %d acked, %d refused", len(acked), refused)
+	}
+
+	w.setDown(false)
+	h.drain(t, 1000)
+	w.check(t, acked)
+}
+
+func BenchmarkNodeProcessorDrain(b *testing.B) {
+	for _, delay := range []time.Duration{0, 100 * time.Microsecond} {
+		b.Run(fmt.Sprint("delay=", delay), func(b *testing.B) {
+			w := newFaultWriter()
+			w.delay = delay
+			h := newHarness(b, w, 1024*1024*1024)
+			defer h.close()
+
+			for i := 0; i < b.N; i++ {
+				h.write(b, int64(i), 10)
+			}
+			b.SetBytes(h.n.queue.Pending() / int64(b.N))
+			b.ResetTimer()
+
+			if sent := h.drain(b, 2*b.N); sent != b.N {
+				b.Fatalf("sent %d blocks, exp %d", sent, b.N)
+			}
+		})
+	}
+}
@@ -0,0 +1,638 @@
+package hh
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/dgraph-io/badger/v2"
+	"github.com/dgraph-io/badger/v2/options"
+)
+
+// kvQueueDir is the directory of a kvQueue in the directory of a node.
+const kvQueueDir = "kv"
+
+// kvQueueGCInterval is how often a kvQueue reclaims space of blocks removed.
+const kvQueueGCInterval = 5 * time.Minute
+
+// Keys of a kvQueue, sequences and shard ids are big endian so keys sort in
+// the order blocks were appended.
+//
+//	b | seq (8 bytes)                     -> mod (8 bytes) | shard (8 bytes) | block
+//	s | shard (8 bytes) | seq (8 bytes)  -> empty
+//	m                                     -> last modified (8 bytes)
+const (
+	kvBlockPrefix = 'b'
+	kvShardPrefix = 's'
+	kvMetaKey     = 'm'
+
+	kvBlockHeaderSize = 16
+)
+
+// kvQueue is a queue of blocks stored in an embedded badger KV store. Blocks
+// are keyed by an increasing sequence and indexed by the shard they are of,
+// so blocks of a shard are found without reading the others. Each block keeps
+// the time it was appended, which purges by age go by. Writes are synced and
+// atomic, a crash never leaves a block half appended or advanced.
+type kvQueue struct {
+	mu sync.RWMutex
+
+	// Directory of the KV store
+	dir string
+
+	// The maximum size allowed in bytes of blocks pending before writes will
+	// return an error
+	maxSize int64
+
+	db *badger.DB
+
+	// head is the sequence of the block at the head, tail the sequence of the
+	// next block appended, head == tail if nothing is pending.
+	head, tail uint64
+	pending    int64
+	lastMod    time.Time
+
+	// Blocks are encrypted on disk if cipher is set
+	cipher *blockCipher
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newKVQueue(dir string, maxSize int64) *kvQueue {
+	return &kvQueue{dir: dir, maxSize: maxSize}
+}
+
+func kvBlockKey(seq uint64) []byte {
+	k := make([]byte, 9)
+	k[0] = kvBlockPrefix
+	binary.BigEndian.PutUint64(k[1:], seq)
+	return k
+}
+
+func kvShardKey(shardID, seq uint64) []byte {
+	k := make([]byte, 17)
+	k[0] = kvShardPrefix
+	binary.BigEndian.PutUint64(k[1:], shardID)
+	binary.BigEndian.PutUint64(k[9:], seq)
+	return k
+}
+
+func kvShardPrefixKey(shardID uint64) []byte {
+	return kvShardKey(shardID, 0)[:9]
+}
+
+// kvBlock is a block as stored, sealed if the queue is encrypted.
+type kvBlock struct {
+	mod     time.Time
+	shardID uint64
+	sealed  []byte
+}
+
+func (b kvBlock) marshal() []byte {
+	v := make([]byte, kvBlockHeaderSize+len(b.sealed))
+	binary.BigEndian.PutUint64(v, uint64(b.mod.UnixNano()))
+	binary.BigEndian.PutUint64(v[8:], b.shardID)
+	copy(v[kvBlockHeaderSize:], b.sealed)
+	return v
+}
+
+func unmarshalKVBlock(v []byte) (kvBlock, error) {
+	if len(v) < kvBlockHeaderSize {
+		return kvBlock{}, fmt.Errorf("kv queue block too short: %d bytes", len(v))
+	}
+	return kvBlock{
+		mod:     time.Unix(0, int64(binary.BigEndian.Uint64(v))),
+		shardID: binary.BigEndian.Uint64(v[8:]),
+		sealed:  v[kvBlockHeaderSize:],
+	}, nil
+}
+
+// blockShardID returns the shard id a block of marshalWrite starts with.
+func blockShardID(b []byte) uint64 {
+	if len(b) < 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b[:8]) &^ blockQueuedFlag
+}
+
+// Open opens the queue for reading and writing, recovering the blocks
+// pending.
+func (l *kvQueue) Open() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return err
+	}
+	opt := badger.DefaultOptions(l.dir)
+	opt.SyncWrites = true
+	opt.Logger = nil
+	opt.TableLoadingMode = options.FileIO
+	opt.ValueLogFileSize = 64 << 20
+	opt.MaxTableSize = 4 << 20
+	opt.NumLevelZeroTables = 2
+	opt.NumMemtables = 2
+	opt.NumCompactors = 2
+	db, err := badger.Open(opt)
+	if err != nil {
+		return err
+	}
+
+	if err := l.load(db); err != nil {
+		db.Close()
+		return err
+	}
+	l.db = db
+	l.closing = make(chan struct{})
+	l.wg.Add(1)
+	go l.reclaim()
+	return nil
+}
+
+// load recovers the head, tail and size of blocks pending from db.
+func (l *kvQueue) load(db *badger.DB) error {
+	l.head, l.tail, l.pending = 0, 0, 0
+	err := db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Prefix = []byte{kvBlockPrefix}
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		first := true
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			seq := binary.BigEndian.Uint64(item.Key()[1:])
+			if first {
+				l.head = seq
+				first = false
+			}
+			l.tail = seq + 1
+			l.pending += item.ValueSize()
+		}
+
+		item, err := txn.Get([]byte{kvMetaKey})
+		if err == badger.ErrKeyNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			if len(v) == 8 {
+				l.lastMod = time.Unix(0, int64(binary.BigEndian.Uint64(v)))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if l.lastMod.IsZero() {
+		// a queue created just now
+		l.lastMod = time.Now()
+		return db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte{kvMetaKey}, marshalTime(l.lastMod))
+		})
+	}
+	return nil
+}
+
+func marshalTime(t time.Time) []byte {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(t.UnixNano()))
+	return v
+}
+
+// reclaim runs the value log GC of the store regularly, the space of blocks
+// removed is reclaimed only by it.
+func (l *kvQueue) reclaim() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(kvQueueGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.closing:
+			return
+		case <-ticker.C:
+			l.db.RunValueLogGC(0.5)
+		}
+	}
+}
+
+// Close stops the queue for reading and writing
+func (l *kvQueue) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db == nil {
+		return nil
+	}
+	close(l.closing)
+	l.wg.Wait()
+	err := l.db.Close()
+	l.db = nil
+	return err
+}
+
+// Remove removes the KV store of the queue. It is an error to call this on an
+// open queue.
+func (l *kvQueue) Remove() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db != nil {
+		return errs.ErrQueueOpen
+	}
+	return os.RemoveAll(l.dir)
+}
+
+// Append appends a byte slice to the end of the queue
+func (l *kvQueue) Append(b []byte) error {
+	return l.AppendBatch([][]byte{b})
+}
+
+// AppendBatch appends byte slices to the end of the queue in a single
+// transaction. Either all or none of them are appended if the queue is full.
+func (l *kvQueue) AppendBatch(blocks [][]byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db == nil {
+		return ErrNotOpen
+	}
+
+	now := time.Now()
+	values := make([][]byte, len(blocks))
+	var size int64
+	for i, b := range blocks {
+		sealed, err := l.cipher.seal(b)
+		if err != nil {
+			return err
+		}
+		values[i] = kvBlock{mod: now, shardID: blockShardID(b), sealed: sealed}.marshal()
+		size += int64(len(values[i]))
+	}
+	if l.pending+size > l.maxSize {
+		return ErrQueueFull
+	}
+
+	err := l.db.Update(func(txn *badger.Txn) error {
+		for i, v := range values {
+			seq := l.tail + uint64(i)
+			if err := txn.Set(kvBlockKey(seq), v); err != nil {
+				return err
+			}
+			if err := txn.Set(kvShardKey(blockShardID(blocks[i]), seq), nil); err != nil {
+				return err
+			}
+		}
+		return txn.Set([]byte{kvMetaKey}, marshalTime(now))
+	})
+	if err != nil {
+		return err
+	}
+	l.tail += uint64(len(blocks))
+	l.pending += size
+	l.lastMod = now
+	return nil
+}
+
+// get returns the block of seq, false if it's removed.
+func (l *kvQueue) get(txn *badger.Txn, seq uint64) (kvBlock, bool, error) {
+	item, err := txn.Get(kvBlockKey(seq))
+	if err == badger.ErrKeyNotFound {
+		return kvBlock{}, false, nil
+	} else if err != nil {
+		return kvBlock{}, false, err
+	}
+	v, err := item.ValueCopy(nil)
+	if err != nil {
+		return kvBlock{}, false, err
+	}
+	b, err := unmarshalKVBlock(v)
+	return b, err == nil, err
+}
+
+// Current returns the current byte slice at the head of the queue
+func (l *kvQueue) Current() ([]byte, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.db == nil {
+		return nil, ErrNotOpen
+	}
+	if l.head == l.tail {
+		return nil, io.EOF
+	}
+
+	var b kvBlock
+	err := l.db.View(func(txn *badger.Txn) error {
+		var err error
+		b, _, err = l.get(txn, l.head)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l.cipher.open(b.sealed)
+}
+
+// Advance moves the head point to the next byte slice in the queue
+func (l *kvQueue) Advance() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db == nil {
+		return ErrNotOpen
+	}
+	if l.head == l.tail {
+		return nil
+	}
+	return l.remove([]uint64{l.head})
+}
+
+// remove deletes blocks of seqs, moving the head to the first block left.
+func (l *kvQueue) remove(seqs []uint64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+	wb := l.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	var size int64
+	err := l.db.View(func(txn *badger.Txn) error {
+		for _, seq := range seqs {
+			b, ok, err := l.get(txn, seq)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			size += int64(kvBlockHeaderSize + len(b.sealed))
+			if err := wb.Delete(kvShardKey(b.shardID, seq)); err != nil {
+				return err
+			}
+			if err := wb.Delete(kvBlockKey(seq)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	l.pending -= size
+	return l.seekHead()
+}
+
+// seekHead moves the head to the first block left.
+func (l *kvQueue) seekHead() error {
+	head := l.tail
+	err := l.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Prefix = []byte{kvBlockPrefix}
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		it.Seek(kvBlockKey(l.head))
+		if it.Valid() {
+			head = binary.BigEndian.Uint64(it.Item().Key()[1:])
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	l.head = head
+	return nil
+}
+
+// scan invokes fn with blocks from the head in order until it returns false.
+func (l *kvQueue) scan(fn func(seq uint64, b kvBlock) bool) error {
+	return l.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.Prefix = []byte{kvBlockPrefix}
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		for it.Seek(kvBlockKey(l.head)); it.Valid(); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			b, err := unmarshalKVBlock(v)
+			if err != nil {
+				return err
+			}
+			if !fn(binary.BigEndian.Uint64(item.Key()[1:]), b) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+// PurgeOlderThan removes blocks from the head which were appended before
+// when. If fn is not nil, it is invoked with every block right before it is
+// removed.
+func (l *kvQueue) PurgeOlderThan(when time.Time, fn func(b []byte)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db == nil {
+		return ErrNotOpen
+	}
+
+	cutoff := when.Truncate(time.Second)
+	var seqs []uint64
+	err := l.scan(func(seq uint64, b kvBlock) bool {
+		if !b.mod.Before(cutoff) {
+			return false
+		}
+		if fn != nil {
+			// blocks of another key are purged unseen
+			if b, err := l.cipher.open(b.sealed); err == nil {
+				fn(b)
+			}
+		}
+		seqs = append(seqs, seq)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return l.remove(seqs)
+}
+
+// PurgeBlocks removes blocks not advanced past yet for which drop returns
+// true, invoking fn with each of them. Blocks encrypted by another key are
+// kept.
+func (l *kvQueue) PurgeBlocks(drop func(b []byte) bool, fn func(b []byte)) error {
+	return l.PurgeBlocksBefore(time.Time{}, func(b []byte, mod time.Time) bool {
+		return drop(b)
+	}, fn)
+}
+
+// PurgeBlocksBefore is PurgeBlocks of blocks appended before when, or of all
+// blocks if when is zero. drop is given the time a block was appended as well.
+func (l *kvQueue) PurgeBlocksBefore(when time.Time, drop func(b []byte, mod time.Time) bool, fn func(b []byte)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db == nil {
+		return ErrNotOpen
+	}
+
+	var seqs []uint64
+	err := l.scan(func(seq uint64, kb kvBlock) bool {
+		if !when.IsZero() && !kb.mod.Before(when) {
+			return true
+		}
+		b, err := l.cipher.open(kb.sealed)
+		if err != nil || !drop(b, kb.mod) {
+			return true
+		}
+		if fn != nil {
+			fn(b)
+		}
+		seqs = append(seqs, seq)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return l.remove(seqs)
+}
+
+// PurgeShard removes blocks of shard shardID not advanced past yet, invoking
+// fn with each of them. Only blocks of the shard are read, found by the shard
+// index. Blocks encrypted by another key are kept.
+func (l *kvQueue) PurgeShard(shardID uint64, fn func(b []byte)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.db == nil {
+		return ErrNotOpen
+	}
+
+	var seqs []uint64
+	err := l.db.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		opt.Prefix = kvShardPrefixKey(shardID)
+		it := txn.NewIterator(opt)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			seqs = append(seqs, binary.BigEndian.Uint64(it.Item().Key()[9:]))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var dropped, orphans []uint64
+	err = l.db.View(func(txn *badger.Txn) error {
+		for _, seq := range seqs {
+			kb, ok, err := l.get(txn, seq)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// an index entry left by a crash while removing
+				orphans = append(orphans, seq)
+				continue
+			}
+			b, err := l.cipher.open(kb.sealed)
+			if err != nil {
+				continue
+			}
+			if fn != nil {
+				fn(b)
+			}
+			dropped = append(dropped, seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(orphans) > 0 {
+		if err := l.db.Update(func(txn *badger.Txn) error {
+			for _, seq := range orphans {
+				if err := txn.Delete(kvShardKey(shardID, seq)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return l.remove(dropped)
+}
+
+// LastModified returns the last time a block was appended to the queue, or
+// the time the queue was created.
+func (l *kvQueue) LastModified() (time.Time, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.db == nil {
+		return time.Time{}.UTC(), nil
+	}
+	return l.lastMod, nil
+}
+
+// HeadLastModified returns the time the block at the head was appended, or
+// LastModified if nothing is pending.
+func (l *kvQueue) HeadLastModified() (time.Time, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.db == nil {
+		return time.Time{}, ErrNotOpen
+	}
+	if l.head == l.tail {
+		return l.lastMod, nil
+	}
+	var b kvBlock
+	err := l.db.View(func(txn *badger.Txn) error {
+		var err error
+		b, _, err = l.get(txn, l.head)
+		return err
+	})
+	return b.mod, err
+}
+
+func (l *kvQueue) Position() (*queuePos, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	qp := &queuePos{}
+	if l.db != nil {
+		qp.head = fmt.Sprintf("%s:%d", l.dir, l.head)
+		qp.tail = fmt.Sprintf("%s:%d", l.dir, l.tail)
+	}
+	return qp, nil
+}
+
+// Pending returns the size in bytes of blocks not advanced past yet,
+// including the headers stored with them.
+func (l *kvQueue) Pending() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.pending
+}
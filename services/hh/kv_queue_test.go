@@ -0,0 +1,178 @@
+package hh
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+func openKVQueue(t *testing.T, dir string, maxSize int64) *kvQueue {
+	q := newKVQueue(dir, maxSize)
+	if err := q.Open(); err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	return q
+}
+
+func TestKVQueueReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hh_kv_queue")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := openKVQueue(t, dir, 1024)
+	if _, err := q.Current(); err != io.EOF {
+		t.Fatalf("Queue.Current expected io.EOF, got: %v", err)
+	}
+	if err := q.Append([]byte("one")); err != nil {
+		t.Fatalf("Queue.Append failed: %v", err)
+	}
+	if err := q.AppendBatch([][]byte{[]byte("two"), []byte("three")}); err != nil {
+		t.Fatalf("Queue.AppendBatch failed: %v", err)
+	}
+	if err := q.Advance(); err != nil {
+		t.Fatalf("Queue.Advance failed: %v", err)
+	}
+	pending := q.Pending()
+	if exp := int64(2*kvBlockHeaderSize + 8); pending != exp {
+		t.Fatalf("Queue.Pending mismatch: got %v, exp %v", pending, exp)
+	}
+
+	// close and re-open the queue
+	if err := q.Close(); err != nil {
+		t.Fatalf("Queue.Close failed: %v", err)
+	}
+	q = openKVQueue(t, dir, 1024)
+	defer q.Close()
+
+	if q.Pending() != pending {
+		t.Fatalf("Queue.Pending mismatch after reopen: got %v, exp %v", q.Pending(), pending)
+	}
+	for _, exp := range []string{"two", "three"} {
+		cur, err := q.Current()
+		if err != nil {
+			t.Fatalf("Queue.Current failed: %v", err)
+		}
+		if string(cur) != exp {
+			t.Errorf("Queue.Current mismatch: got %v, exp %v", string(cur), exp)
+		}
+		if err := q.Advance(); err != nil {
+			t.Fatalf("Queue.Advance failed: %v", err)
+		}
+	}
+	if _, err := q.Current(); err != io.EOF {
+		t.Fatalf("Queue.Current expected io.EOF, got: %v", err)
+	}
+	if err := q.Advance(); err != nil {
+		t.Fatalf("Queue.Advance past end failed: %v", err)
+	}
+
+	if err := q.Append(make([]byte, 1024)); err != ErrQueueFull {
+		t.Fatalf("Queue.Append expected ErrQueueFull, got: %v", err)
+	}
+}
+
+func TestKVQueuePurge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hh_kv_queue")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	q := openKVQueue(t, dir, 1<<20)
+	defer q.Close()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(1, 0))
+	for _, shardID := range []uint64{1, 2, 1, 3} {
+		if err := q.Append(marshalWrite(shardID, []models.Point{pt}, time.Now())); err != nil {
+			t.Fatalf("Queue.Append failed: %v", err)
+		}
+	}
+
+	var purged []uint64
+	if err := q.PurgeShard(1, func(b []byte) {
+		purged = append(purged, blockShardID(b))
+	}); err != nil {
+		t.Fatalf("Queue.PurgeShard failed: %v", err)
+	}
+	if exp := []uint64{1, 1}; !reflect.DeepEqual(purged, exp) {
+		t.Fatalf("purged blocks mismatch: got %v, exp %v", purged, exp)
+	}
+	cur, err := q.Current()
+	if err != nil {
+		t.Fatalf("Queue.Current failed: %v", err)
+	}
+	if blockShardID(cur) != 2 {
+		t.Fatalf("Queue.Current mismatch: got shard %v, exp 2", blockShardID(cur))
+	}
+
+	// blocks appended later are kept
+	mod, err := q.HeadLastModified()
+	if err != nil {
+		t.Fatalf("Queue.HeadLastModified failed: %v", err)
+	}
+	if err := q.PurgeOlderThan(mod.Add(-time.Second), nil); err != nil {
+		t.Fatalf("Queue.PurgeOlderThan failed: %v", err)
+	}
+	if _, err := q.Current(); err != nil {
+		t.Fatalf("Queue.Current failed: %v", err)
+	}
+	if err := q.PurgeOlderThan(mod.Add(2*time.Second), nil); err != nil {
+		t.Fatalf("Queue.PurgeOlderThan failed: %v", err)
+	}
+	if _, err := q.Current(); err != io.EOF {
+		t.Fatalf("Queue.Current expected io.EOF, got: %v", err)
+	}
+	if q.Pending() != 0 {
+		t.Fatalf("Queue.Pending mismatch: got %v, exp 0", q.Pending())
+	}
+}
+
+func TestNodeProcessorMigrateQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hh_kv_queue")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newQueue(dir, 1024)
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+	if err := q.Open(); err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	for _, b := range []string{"one", "two"} {
+		if err := q.Append([]byte(b)); err != nil {
+			t.Fatalf("Queue.Append failed: %v", err)
+		}
+	}
+	if err := q.Close(); err != nil {
+		t.Fatalf("Queue.Close failed: %v", err)
+	}
+
+	n := NewNodeProcessor(1, dir, &fakeShardWriter{}, &fakeMetaStore{})
+	n.QueueBackend = QueueBackendBadger
+	n.RetryInterval = time.Hour
+	if err := n.Open(); err != nil {
+		t.Fatalf("failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	if ok, _ := hasQueueData(QueueBackendSegment, dir); ok {
+		t.Fatal("segments expected removed once migrated")
+	}
+	cur, err := n.queue.Current()
+	if err != nil {
+		t.Fatalf("Queue.Current failed: %v", err)
+	}
+	if exp := "one"; string(cur) != exp {
+		t.Errorf("Queue.Current mismatch: got %v, exp %v", string(cur), exp)
+	}
+}
@@ -0,0 +1,121 @@
+package hh
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+const (
+	// measurement of node queue lag
+	lagMeasurement = "hh_node_lag"
+)
+
+// reportLag periodically writes the lag of each node queue as points.
+func (s *Service) reportLag() {
+	defer s.wg.Done()
+
+	interval := time.Duration(s.cfg.LagReportInterval)
+	s.Logger.Infof("Reporting hinted handoff lag into %s.%s every %v",
+		s.cfg.LagReportDatabase, s.cfg.LagReportRetentionPolicy, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	hostname, _ := os.Hostname()
+	for {
+		select {
+		case <-s.closing:
+			return
+		case now := <-ticker.C:
+			points := s.lagPoints(now.Truncate(interval), hostname)
+			if len(points) == 0 {
+				continue
+			}
+			if err := s.PointsWriter.WritePoints(s.cfg.LagReportDatabase, s.cfg.LagReportRetentionPolicy, points); err != nil {
+				s.Logger.Warnf("failed to write hinted handoff lag: %s", err.Error())
+			}
+		}
+	}
+}
+
+// lagPoints returns a point for each node processor.
+func (s *Service) lagPoints(now time.Time, hostname string) models.Points {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	points := make(models.Points, 0, len(s.processors))
+	for nodeID, p := range s.processors {
+		pending, buffered, age, err := p.Lag(now)
+		if err != nil {
+			s.Logger.Warnf("failed to determine lag for node %d: %s", nodeID, err.Error())
+			continue
+		}
+		tags := map[string]string{"node": strconv.FormatUint(nodeID, 10)}
+		if hostname != "" {
+			tags["hostname"] = hostname
+		}
+		pt, err := models.NewPoint(lagMeasurement, models.NewTags(tags), models.Fields{
+			"pendingBytes":  pending,
+			"bufferedBytes": buffered,
+			"oldestAgeMs":   int64(age / time.Millisecond),
+		}, now)
+		if err != nil {
+			s.Logger.Warnf("failed to create lag point for node %d: %s", nodeID, err.Error())
+			continue
+		}
+		points = append(points, pt)
+	}
+	return points
+}
+
+// NodeLag is the hinted data queued on this node for a node.
+type NodeLag struct {
+	NodeID uint64
+	// Pending is the bytes pending in queue and buffered in memory
+	Pending   int64
+	OldestAge time.Duration
+	Healthy   bool
+}
+
+// Lags returns the hinted data queued for each node, by node id.
+func (s *Service) Lags(now time.Time) []NodeLag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lags := make([]NodeLag, 0, len(s.processors))
+	for nodeID, p := range s.processors {
+		pending, buffered, age, err := p.Lag(now)
+		if err != nil {
+			continue
+		}
+		lags = append(lags, NodeLag{
+			NodeID:    nodeID,
+			Pending:   pending + buffered,
+			OldestAge: age,
+			Healthy:   p.Healthy(),
+		})
+	}
+	sort.Slice(lags, func(i, j int) bool { return lags[i].NodeID < lags[j].NodeID })
+	return lags
+}
+
+// Backlog returns the bytes of hinted data pending or buffered for all nodes.
+func (s *Service) Backlog() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var backlog int64
+	now := time.Now()
+	for _, p := range s.processors {
+		pending, buffered, _, err := p.Lag(now)
+		if err != nil {
+			return 0, err
+		}
+		backlog += pending + buffered
+	}
+	return backlog, nil
+}
@@ -3,27 +3,46 @@ package hh
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"strings"
 	"sync/atomic"
 
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/logging"
 	"github.com/angopher/chronus/services/meta"
+	"github.com/angopher/chronus/x"
 	"github.com/influxdata/influxdb/models"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 )
 
 const (
 	writeNodeReq       = "writeNodeReq"
 	writeNodeReqFail   = "writeNodeReqFail"
+	writeNodeReqDrop   = "writeNodeReqDrop"
 	writeNodeReqPoints = "writeNodeReqPoints"
+	purgedBlocks       = "purgedBlocks"
+	purgedBytes        = "purgedBytes"
+	purgedPoints       = "purgedPoints"
+	writeThroughReq    = "writeThroughReq"
+	writeThroughOK     = "writeThroughOk"
+	writeThroughFail   = "writeThroughFail"
+	writeThroughSpill  = "writeThroughSpill"
+	advanceFail        = "advanceFail"
+	droppedMeasurement = "droppedMeasurementPoints"
+	healthy            = "healthy"
 )
 
+// ErrNodeUnhealthy is returned writing to a node whose queue is stuck failing
+// to advance, if writes are blocked for it.
+var ErrNodeUnhealthy = errs.ErrNodeUnhealthy
+
 var (
 	// for concurrency control
 	maxActiveProcessorCount = int32(0)
@@ -33,21 +52,71 @@ var (
 // NodeProcessor encapsulates a queue of hinted-handoff data for a node, and the
 // transmission of the data to the node.
 type NodeProcessor struct {
-	PurgeInterval    time.Duration // Interval between periodic purge checks
-	RetryInterval    time.Duration // Interval between periodic write-to-node attempts.
-	RetryMaxInterval time.Duration // Max interval between periodic write-to-node attempts.
-	MaxSize          int64         // Maximum size an underlying queue can get.
-	MaxAge           time.Duration // Maximum age queue data can get before purging.
-	RetryRateLimit   int           // Limits the rate data is sent to node.
-	nodeID           uint64
-	dir              string
+	PurgeInterval          time.Duration // Interval between periodic purge checks
+	RetryInterval          time.Duration // Interval between periodic write-to-node attempts.
+	RetryMaxInterval       time.Duration // Max interval between periodic write-to-node attempts.
+	MaxSize                int64         // Maximum size an underlying queue can get.
+	MaxAge                 time.Duration // Maximum age queue data can get before purging.
+	RetryRateLimit         int           // Limits the rate data is sent to node.
+	PurgeNotifyURL         string        // Webhook to post undelivered data being purged.
+	WriteThroughWindow     time.Duration // Time range retrying failed writes from memory in an outage.
+	WriteThroughBufferSize int64         // Maximum size of failed writes held in memory.
+	nodeID                 uint64
+	dir                    string
+
+	// RetryRateWindows are rate limits in time windows of day, RetryRateLimit
+	// applies out of them.
+	RetryRateWindows []x.BandwidthWindow
+	limiter          *x.ScheduledLimiter
+
+	// The processor is unhealthy after the queue fails to advance
+	// AdvanceFailureThreshold times in a row, and refuses writes if
+	// BlockWritesWhenUnhealthy. A threshold of 0 disables it.
+	AdvanceFailureThreshold  int
+	BlockWritesWhenUnhealthy bool
+	advanceFailures          int32 // in a row
+
+	// Features may override BlockWritesWhenUnhealthy at runtime
+	Features *meta.FeatureFlags
+
+	// ShardCutovers holds writes of shards in the cutover of their moves
+	// until it ends, optional
+	ShardCutovers ShardCutovers
+
+	// StaleShards marks shards of the node stale when hinted data of them
+	// is purged unsent, so that they are caught up from other owners,
+	// optional
+	StaleShards StaleShards
+
+	// DatabaseMaxAges override MaxAge for hinted data of the databases,
+	// resolved from shards of blocks by ShardOwners at purge time
+	DatabaseMaxAges map[string]time.Duration
+	ShardOwners     ShardOwners
+
+	// DroppedMeasurements skips points of measurements dropped after they
+	// were queued, resolving databases of shards by ShardOwners, optional
+	DroppedMeasurements DroppedMeasurements
+
+	// Writes are appended to the queue in batches of AppendBatchSize bytes
+	// or AppendBatchDelay after the first one, if the delay is positive.
+	AppendBatchSize  int
+	AppendBatchDelay time.Duration
+	batcher          *appendBatcher
+
+	// EncryptionKey encrypts blocks of the queue on disk, optional
+	EncryptionKey []byte
+
+	// QueueBackend stores the queue, QueueBackendSegment if empty. Blocks left
+	// by the other backend are moved into it on open.
+	QueueBackend string
 
 	mu   sync.RWMutex
 	wg   sync.WaitGroup
 	done chan struct{}
 
-	queue  *queue
-	meta   metaClient
+	queue  blockQueue
+	buffer *writeThroughBuffer
+	meta   MetaClient
 	writer shardWriter
 
 	stats  *NodeProcessorStatistics
@@ -59,7 +128,17 @@ type NodeProcessorStatistics struct {
 	WriteShardReqPoints int64
 	WriteNodeReq        int64
 	WriteNodeReqFail    int64
+	WriteNodeReqDrop    int64
 	WriteNodeReqPoints  int64
+	PurgedBlocks        int64
+	PurgedBytes         int64
+	PurgedPoints        int64
+	WriteThroughReq     int64
+	WriteThroughOK      int64
+	WriteThroughFail    int64
+	WriteThroughSpill   int64
+	AdvanceFail         int64
+	DroppedMeasurement  int64
 }
 
 func SetMaxActiveProcessorCount(n int32) {
@@ -68,24 +147,25 @@ func SetMaxActiveProcessorCount(n int32) {
 
 // NewNodeProcessor returns a new NodeProcessor for the given node, using dir for
 // the hinted-handoff data.
-func NewNodeProcessor(nodeID uint64, dir string, w shardWriter, m metaClient) *NodeProcessor {
+func NewNodeProcessor(nodeID uint64, dir string, w shardWriter, m MetaClient) *NodeProcessor {
 	return &NodeProcessor{
-		PurgeInterval:    DefaultPurgeInterval,
-		RetryInterval:    DefaultRetryInterval,
-		RetryMaxInterval: DefaultRetryMaxInterval,
-		MaxSize:          DefaultMaxSize,
-		MaxAge:           DefaultMaxAge,
-		nodeID:           nodeID,
-		dir:              dir,
-		writer:           w,
-		meta:             m,
-		stats:            &NodeProcessorStatistics{},
-		Logger:           zap.NewNop().Sugar(),
+		PurgeInterval:          DefaultPurgeInterval,
+		RetryInterval:          DefaultRetryInterval,
+		RetryMaxInterval:       DefaultRetryMaxInterval,
+		MaxSize:                DefaultMaxSize,
+		MaxAge:                 DefaultMaxAge,
+		WriteThroughBufferSize: DefaultWriteThroughBufferSize,
+		nodeID:                 nodeID,
+		dir:                    dir,
+		writer:                 w,
+		meta:                   m,
+		stats:                  &NodeProcessorStatistics{},
+		Logger:                 zap.NewNop().Sugar(),
 	}
 }
 
 func (n *NodeProcessor) WithLogger(logger *zap.Logger) {
-	n.Logger = logger.With(zap.String("service", "hh_processor")).Sugar()
+	n.Logger = logger.With(zap.String("service", "hh_processor"), logging.NodeID(n.nodeID)).Sugar()
 }
 
 // Open opens the NodeProcessor. It will read and write data present in dir, and
@@ -99,6 +179,13 @@ func (n *NodeProcessor) Open() error {
 		// Already open.
 		return nil
 	}
+	if n.RetryRateLimit > 0 || len(n.RetryRateWindows) > 0 {
+		schedule, err := x.NewBandwidthSchedule(int64(n.RetryRateLimit), n.RetryRateWindows)
+		if err != nil {
+			return err
+		}
+		n.limiter = x.NewScheduledLimiter(schedule)
+	}
 	n.done = make(chan struct{})
 
 	// Create the queue directory if it doesn't already exist.
@@ -107,7 +194,14 @@ func (n *NodeProcessor) Open() error {
 	}
 
 	// Create the queue of hinted-handoff data.
-	queue, err := newQueue(n.dir, n.MaxSize)
+	var cipher *blockCipher
+	if len(n.EncryptionKey) > 0 {
+		var err error
+		if cipher, err = newBlockCipher(n.EncryptionKey); err != nil {
+			return err
+		}
+	}
+	queue, err := newBlockQueue(n.QueueBackend, n.dir, n.MaxSize, cipher)
 	if err != nil {
 		return err
 	}
@@ -115,6 +209,19 @@ func (n *NodeProcessor) Open() error {
 		return err
 	}
 	n.queue = queue
+	n.migrateQueue(cipher)
+
+	if n.AppendBatchDelay > 0 {
+		size := n.AppendBatchSize
+		if size <= 0 {
+			size = DefaultAppendBatchSize
+		}
+		n.batcher = newAppendBatcher(queue, size, n.AppendBatchDelay)
+	}
+
+	if n.WriteThroughWindow > 0 && n.WriteThroughBufferSize > 0 {
+		n.buffer = newWriteThroughBuffer(n.WriteThroughWindow, n.WriteThroughBufferSize)
+	}
 
 	n.wg.Add(1)
 	go n.run()
@@ -122,6 +229,41 @@ func (n *NodeProcessor) Open() error {
 	return nil
 }
 
+// migrateQueue moves blocks left by the queue backend not configured, e.g.
+// before switching it, into the queue. Blocks failing to move are kept there
+// and tried again on next open.
+func (n *NodeProcessor) migrateQueue(cipher *blockCipher) {
+	other := QueueBackendBadger
+	if n.QueueBackend == QueueBackendBadger {
+		other = QueueBackendSegment
+	}
+	if ok, err := hasQueueData(other, n.dir); err != nil || !ok {
+		return
+	}
+	from, err := newBlockQueue(other, n.dir, n.MaxSize, cipher)
+	if err == nil {
+		err = from.Open()
+	}
+	if err != nil {
+		n.Logger.Warnf("failed to open %s queue of node %d to migrate: %s", other, n.nodeID, err.Error())
+		return
+	}
+	moved, err := migrateQueue(from, n.queue)
+	if cerr := from.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = removeQueueData(other, n.dir)
+	}
+	if err != nil {
+		n.Logger.Warnf("failed to migrate %s queue of node %d, %d blocks moved: %s", other, n.nodeID, moved, err.Error())
+		return
+	}
+	if moved > 0 {
+		n.Logger.Infof("migrated %d blocks of %s queue of node %d", moved, other, n.nodeID)
+	}
+}
+
 // Close closes the NodeProcessor, terminating all data tranmission to the node.
 // When closed it will not accept hinted-handoff data.
 func (n *NodeProcessor) Close() error {
@@ -137,6 +279,11 @@ func (n *NodeProcessor) Close() error {
 	n.wg.Wait()
 	n.done = nil
 
+	// Keep the writes still in memory
+	if err := n.spill(); err != nil {
+		n.Logger.Warnf("failed to spill write-through buffer for node %d: %s", n.nodeID, err.Error())
+	}
+
 	return n.queue.Close()
 }
 
@@ -155,11 +302,48 @@ func (n *NodeProcessor) Statistics(tags map[string]string) []models.Statistic {
 			writeShardReqPoints: atomic.LoadInt64(&n.stats.WriteShardReqPoints),
 			writeNodeReq:        atomic.LoadInt64(&n.stats.WriteNodeReq),
 			writeNodeReqFail:    atomic.LoadInt64(&n.stats.WriteNodeReqFail),
+			writeNodeReqDrop:    atomic.LoadInt64(&n.stats.WriteNodeReqDrop),
 			writeNodeReqPoints:  atomic.LoadInt64(&n.stats.WriteShardReqPoints),
+			purgedBlocks:        atomic.LoadInt64(&n.stats.PurgedBlocks),
+			purgedBytes:         atomic.LoadInt64(&n.stats.PurgedBytes),
+			purgedPoints:        atomic.LoadInt64(&n.stats.PurgedPoints),
+			writeThroughReq:     atomic.LoadInt64(&n.stats.WriteThroughReq),
+			writeThroughOK:      atomic.LoadInt64(&n.stats.WriteThroughOK),
+			writeThroughFail:    atomic.LoadInt64(&n.stats.WriteThroughFail),
+			writeThroughSpill:   atomic.LoadInt64(&n.stats.WriteThroughSpill),
+			advanceFail:         atomic.LoadInt64(&n.stats.AdvanceFail),
+			droppedMeasurement:  atomic.LoadInt64(&n.stats.DroppedMeasurement),
+			healthy:             n.Healthy(),
 		},
 	}}
 }
 
+// Healthy returns false if the queue is stuck failing to advance, the same
+// block is sent again and again.
+func (n *NodeProcessor) Healthy() bool {
+	return n.AdvanceFailureThreshold <= 0 || atomic.LoadInt32(&n.advanceFailures) < int32(n.AdvanceFailureThreshold)
+}
+
+// advance moves to the next block in queue, tracking failures in a row.
+func (n *NodeProcessor) advance() error {
+	err := n.queue.Advance()
+	if err == nil {
+		if atomic.SwapInt32(&n.advanceFailures, 0) >= int32(n.AdvanceFailureThreshold) && n.AdvanceFailureThreshold > 0 {
+			n.Logger.Infof("queue of node %d advances again", n.nodeID)
+		}
+		return nil
+	}
+
+	atomic.AddInt64(&n.stats.AdvanceFail, 1)
+	failures := atomic.AddInt32(&n.advanceFailures, 1)
+	if n.AdvanceFailureThreshold > 0 && failures == int32(n.AdvanceFailureThreshold) {
+		n.Logger.Errorf("queue of node %d failed to advance %d times in a row, marked unhealthy: %s", n.nodeID, failures, err.Error())
+	} else {
+		n.Logger.Warnf("failed to advance queue for node %d: %s", n.nodeID, err.Error())
+	}
+	return err
+}
+
 // Purge deletes all hinted-handoff data under management by a NodeProcessor.
 // The NodeProcessor should be in the closed state before calling this function.
 func (n *NodeProcessor) Purge() error {
@@ -167,29 +351,125 @@ func (n *NodeProcessor) Purge() error {
 	defer n.mu.Unlock()
 
 	if n.done != nil {
-		return fmt.Errorf("node processor is open")
+		return errs.ErrNodeProcessorOpen
 	}
 
 	return os.RemoveAll(n.dir)
 }
 
+// Archive moves the queue to dst, which should be on the same filesystem. The
+// processor must be closed.
+func (n *NodeProcessor) Archive(dst string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.done != nil {
+		return errs.ErrNodeProcessorOpen
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	return os.Rename(n.dir, dst)
+}
+
 // WriteShard writes hinted-handoff data for the given shard and node. Since it may manipulate
 // hinted-handoff queues, and be called concurrently, it takes a lock during queue access.
-func (n *NodeProcessor) WriteShard(shardID uint64, points []models.Point) error {
+func (n *NodeProcessor) WriteShard(shardID meta.ShardID, points []models.Point) error {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
 	if n.done == nil {
-		return fmt.Errorf("node processor is closed")
+		return errs.ErrNodeProcessorClosed
+	}
+	if n.Features.Enabled(meta.FeatureBlockWritesWhenUnhealthy, n.BlockWritesWhenUnhealthy) && !n.Healthy() {
+		return ErrNodeUnhealthy
 	}
 
 	atomic.AddInt64(&n.stats.WriteShardReq, 1)
 	atomic.AddInt64(&n.stats.WriteShardReqPoints, int64(len(points)))
 
-	b := marshalWrite(shardID, points)
+	// Short outage, retry from memory directly
+	if n.buffer != nil && n.buffer.add(uint64(shardID), points, time.Now()) {
+		atomic.AddInt64(&n.stats.WriteThroughReq, 1)
+		return nil
+	}
+
+	// Writes held in memory are older and should be queued first
+	if err := n.spill(); err != nil {
+		return err
+	}
+
+	b := marshalWrite(uint64(shardID), points, time.Now())
+	if n.batcher != nil {
+		return n.batcher.append(uint64(shardID), b)
+	}
 	return n.queue.Append(b)
 }
 
+// spill moves all the writes in write-through buffer into queue.
+func (n *NodeProcessor) spill() error {
+	if n.buffer == nil {
+		return nil
+	}
+	writes := n.buffer.drain()
+	for i, w := range writes {
+		if err := n.queue.Append(marshalWrite(w.shardID, w.points, w.bufferedAt)); err != nil {
+			atomic.AddInt64(&n.stats.WriteThroughSpill, int64(i))
+			return err
+		}
+	}
+	atomic.AddInt64(&n.stats.WriteThroughSpill, int64(len(writes)))
+	return nil
+}
+
+// retryBuffered writes the failed writes held in memory to the node directly, and
+// falls back to queue once the write-through window passes.
+func (n *NodeProcessor) retryBuffered() {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	for {
+		if n.buffer.head() == nil {
+			return
+		}
+
+		if n.buffer.expired(time.Now()) {
+			if err := n.spill(); err != nil {
+				n.Logger.Warnf("failed to spill write-through buffer for node %d: %s", n.nodeID, err.Error())
+			}
+			return
+		}
+
+		if active, err := n.Active(); err != nil || !active {
+			return
+		}
+		w := n.buffer.next()
+		if w == nil {
+			return
+		}
+		if n.held(w.shardID) {
+			n.buffer.done(w, false)
+			return
+		}
+
+		if err := n.writer.WriteShard(meta.ShardID(w.shardID), meta.NodeID(n.nodeID), w.points); err != nil {
+			atomic.AddInt64(&n.stats.WriteThroughFail, 1)
+			if isPermanent(err) {
+				n.Logger.Warnf("drop write of shard %d to node %d: %s", w.shardID, n.nodeID, err.Error())
+				atomic.AddInt64(&n.stats.WriteNodeReqDrop, 1)
+				n.buffer.done(w, true)
+				continue
+			}
+			n.buffer.done(w, false)
+			return
+		}
+		atomic.AddInt64(&n.stats.WriteThroughOK, 1)
+		atomic.AddInt64(&n.stats.WriteNodeReqPoints, int64(len(w.points)))
+		n.buffer.done(w, true)
+	}
+}
+
 // LastModified returns the time the NodeProcessor last receieved hinted-handoff data.
 func (n *NodeProcessor) LastModified() (time.Time, error) {
 	t, err := n.queue.LastModified()
@@ -213,23 +493,183 @@ func (n *NodeProcessor) run() {
 	sendingTimer := time.NewTimer(waitTime)
 	defer sendingTimer.Stop()
 
+	var writeThroughC <-chan time.Time
+	if n.buffer != nil {
+		writeThroughTicker := time.NewTicker(writeThroughRetryInterval)
+		defer writeThroughTicker.Stop()
+		writeThroughC = writeThroughTicker.C
+	}
+
 	for {
 		select {
 		case <-n.done:
 			return
 
 		case <-purgeTimer.C:
-			if err := n.queue.PurgeOlderThan(time.Now().Add(-n.MaxAge)); err != nil {
-				n.Logger.Warnf("failed to purge for node %d: %s", n.nodeID, err.Error())
-			}
+			n.purgeExpired(time.Now())
 			purgeTimer.Reset(n.PurgeInterval)
 
 		case <-sendingTimer.C:
 			waitTime = n.sendingLoop(waitTime)
 			sendingTimer.Reset(waitTime)
 
+		case <-writeThroughC:
+			n.retryBuffered()
+		}
+	}
+}
+
+// purge drops hinted data older than cutoff. Undelivered data being dropped
+// is reported through log, statistics and webhook if configured.
+func (n *NodeProcessor) purge(cutoff time.Time) *PurgeEvent {
+	ev := newPurgeEvent(n.nodeID, PurgeReasonMaxAge)
+	err := n.queue.PurgeOlderThan(cutoff, ev.add)
+	if err != nil {
+		n.Logger.Warnf("failed to purge for node %d: %s", n.nodeID, err.Error())
+	}
+	n.reportPurge(ev)
+	n.markStale(ev)
+	return ev
+}
+
+// purgeExpired drops hinted data older than the max age of its database at
+// now, MaxAge unless overridden by DatabaseMaxAges.
+func (n *NodeProcessor) purgeExpired(now time.Time) *PurgeEvent {
+	if len(n.DatabaseMaxAges) == 0 || n.ShardOwners == nil {
+		return n.purge(now.Add(-n.MaxAge))
+	}
+
+	minAge := n.MaxAge
+	for _, age := range n.DatabaseMaxAges {
+		if age < minAge {
+			minAge = age
 		}
 	}
+	// shards are resolved once per purge
+	ages := make(map[uint64]time.Duration)
+	ev := newPurgeEvent(n.nodeID, PurgeReasonMaxAge)
+	err := n.queue.PurgeBlocksBefore(now.Add(-minAge), func(b []byte, mod time.Time) bool {
+		age := n.MaxAge
+		if len(b) >= 8 {
+			shardID := blockShardID(b)
+			a, ok := ages[shardID]
+			if !ok {
+				a = n.shardMaxAge(shardID)
+				ages[shardID] = a
+			}
+			age = a
+		}
+		return mod.Before(now.Add(-age))
+	}, ev.add)
+	if err != nil {
+		n.Logger.Warnf("failed to purge for node %d: %s", n.nodeID, err.Error())
+	}
+	n.reportPurge(ev)
+	n.markStale(ev)
+	return ev
+}
+
+// shardMaxAge returns the max age of hinted data of shard by its database,
+// MaxAge if not overridden or the shard is dropped.
+func (n *NodeProcessor) shardMaxAge(shardID uint64) time.Duration {
+	db, _, sgi := n.ShardOwners.ShardOwner(shardID)
+	if sgi == nil {
+		return n.MaxAge
+	}
+	if age, ok := n.DatabaseMaxAges[db]; ok {
+		return age
+	}
+	return n.MaxAge
+}
+
+// PurgeBefore drops hinted data in queue segments last modified before t,
+// like data older than MaxAge is dropped.
+func (n *NodeProcessor) PurgeBefore(t time.Time) (*PurgeEvent, error) {
+	// not to drop the block being sent
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.done == nil {
+		return nil, errs.ErrNodeProcessorClosed
+	}
+	ev := newPurgeEvent(n.nodeID, PurgeReasonBefore)
+	err := n.queue.PurgeOlderThan(t, ev.add)
+	n.reportPurge(ev)
+	n.markStale(ev)
+	return ev, err
+}
+
+// PurgeShard drops hinted data of shard, e.g. of a shard decommissioned.
+// Writes held in memory are queued first so they are dropped as well.
+func (n *NodeProcessor) PurgeShard(shardID uint64) (*PurgeEvent, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.done == nil {
+		return nil, errs.ErrNodeProcessorClosed
+	}
+	if err := n.spill(); err != nil {
+		return nil, err
+	}
+	ev := newPurgeEvent(n.nodeID, PurgeReasonShard)
+	var err error
+	if q, ok := n.queue.(shardQueue); ok {
+		err = q.PurgeShard(shardID, ev.add)
+	} else {
+		err = n.queue.PurgeBlocks(func(b []byte) bool {
+			return len(b) >= 8 && blockShardID(b) == shardID
+		}, ev.add)
+	}
+	n.reportPurge(ev)
+	return ev, err
+}
+
+// reportPurge reports undelivered data dropped through log, statistics and
+// webhook if configured.
+func (n *NodeProcessor) reportPurge(ev *PurgeEvent) {
+	if ev.Empty() {
+		return
+	}
+	ev.finish()
+
+	atomic.AddInt64(&n.stats.PurgedBlocks, ev.Blocks)
+	atomic.AddInt64(&n.stats.PurgedBytes, ev.Bytes)
+	atomic.AddInt64(&n.stats.PurgedPoints, ev.Points)
+
+	n.Logger.Desugar().Warn("purged undelivered hinted data",
+		zap.Uint64s("shards", ev.ShardIDs),
+		zap.Int64("blocks", ev.Blocks),
+		zap.Int64("bytes", ev.Bytes),
+		zap.Int64("points", ev.Points),
+		zap.Time("min_time", ev.MinTime),
+		zap.Time("max_time", ev.MaxTime),
+		zap.String("reason", ev.Reason),
+	)
+
+	if n.PurgeNotifyURL != "" {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			if err := postPurgeEvent(n.PurgeNotifyURL, ev); err != nil {
+				n.Logger.Warnf("failed to notify purge for node %d: %s", n.nodeID, err.Error())
+			}
+		}()
+	}
+}
+
+// markStale marks shards of the data purged stale on the node. Shards purged
+// on purpose by PurgeShard are not, their data is not wanted anymore.
+func (n *NodeProcessor) markStale(ev *PurgeEvent) {
+	if n.StaleShards == nil || ev.Empty() || len(ev.ShardIDs) == 0 {
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.StaleShards.MarkShardsStale(n.nodeID, ev.ShardIDs); err != nil {
+			n.Logger.Warnf("failed to mark shards %v stale for node %d: %s", ev.ShardIDs, n.nodeID, err.Error())
+		}
+	}()
 }
 
 func concurrencyAllow() bool {
@@ -269,12 +709,11 @@ func (n *NodeProcessor) sendingLoop(curDelay time.Duration) (nextDelay time.Dura
 	}
 
 	// Bytes rate limit
-	if n.RetryRateLimit > 0 {
-		bytesLimiter := rate.NewLimiter(rate.Limit(n.RetryRateLimit), 10*n.RetryRateLimit)
+	if n.limiter != nil {
 		defer func() {
 			if sent > 0 {
 				n.Logger.Infof("write to %d with %d bytes", n.nodeID, sent)
-				bytesLimiter.WaitN(context.Background(), sent)
+				n.limiter.WaitN(context.Background(), sent)
 			}
 		}()
 	}
@@ -286,8 +725,9 @@ func (n *NodeProcessor) sendingLoop(curDelay time.Duration) (nextDelay time.Dura
 		return
 	}
 
-	if err == io.EOF {
-		// No more data, return to configured interval
+	if err == io.EOF || errors.Is(err, errs.ErrShardCutover) {
+		// No more data or held for a short while, return to configured
+		// interval
 		nextDelay = n.RetryInterval
 	} else {
 		// backoff
@@ -317,6 +757,10 @@ func (n *NodeProcessor) SendWrite() (int, error) {
 	// Get the current block from the queue
 	buf, err := n.queue.Current()
 	if err != nil {
+		if err == io.EOF && n.buffer != nil {
+			// Queue is drained, a new failure starts a new write-through window.
+			n.buffer.reset()
+		}
 		return 0, err
 	}
 
@@ -325,26 +769,122 @@ func (n *NodeProcessor) SendWrite() (int, error) {
 	if err != nil {
 		n.Logger.Warnf("unmarshal write failed: %v", err)
 		// Try to skip it.
-		if err := n.queue.Advance(); err != nil {
-			n.Logger.Warnf("failed to advance queue for node %d: %s", n.nodeID, err.Error())
-		}
+		n.advance()
 		return 0, err
 	}
+	if n.held(shardID) {
+		// sent once the cutover ends, the new owner has the shard by then
+		return 0, errs.ErrShardCutover
+	}
+	if points = n.skipDropped(shardID, points, buf); len(points) == 0 {
+		if err := n.advance(); err != nil {
+			return 0, err
+		}
+		return len(buf), nil
+	}
 
-	if err := n.writer.WriteShard(shardID, n.nodeID, points); err != nil {
+	if err := n.writer.WriteShard(meta.ShardID(shardID), meta.NodeID(n.nodeID), points); err != nil {
 		atomic.AddInt64(&n.stats.WriteNodeReqFail, 1)
-		return 0, err
+		if !isPermanent(err) {
+			return 0, err
+		}
+		// Retrying never succeeds, skip it not to block the queue.
+		n.Logger.Warnf("drop write of shard %d to node %d: %s", shardID, n.nodeID, err.Error())
+		atomic.AddInt64(&n.stats.WriteNodeReqDrop, 1)
+		if err := n.advance(); err != nil {
+			return 0, err
+		}
+		return len(buf), nil
 	}
 	atomic.AddInt64(&n.stats.WriteNodeReq, 1)
 	atomic.AddInt64(&n.stats.WriteNodeReqPoints, int64(len(points)))
 
-	if err := n.queue.Advance(); err != nil {
-		n.Logger.Warnf("failed to advance queue for node %d: %s", n.nodeID, err.Error())
+	// The block is sent again if the queue fails to advance, backing off.
+	if err := n.advance(); err != nil {
+		return 0, err
 	}
 
 	return len(buf), nil
 }
 
+// skipDropped returns points of the head block b whose measurements were not
+// dropped after the block was queued. Points queued before a drop would bring
+// the measurement back.
+func (n *NodeProcessor) skipDropped(shardID uint64, points []models.Point, b []byte) []models.Point {
+	if n.DroppedMeasurements == nil || n.ShardOwners == nil {
+		return points
+	}
+	db, _, sgi := n.ShardOwners.ShardOwner(shardID)
+	if sgi == nil {
+		return points
+	}
+	queued, err := n.headQueuedAt(b)
+	if err != nil {
+		return points
+	}
+
+	dropped := make(map[string]bool)
+	kept := points[:0]
+	for _, p := range points {
+		name := string(p.Name())
+		d, ok := dropped[name]
+		if !ok {
+			d = n.DroppedMeasurements.MeasurementDroppedAfter(db, name, queued)
+			dropped[name] = d
+		}
+		if !d {
+			kept = append(kept, p)
+		}
+	}
+	if skipped := len(points) - len(kept); skipped > 0 {
+		atomic.AddInt64(&n.stats.DroppedMeasurement, int64(skipped))
+		n.Logger.Infof("skip %d points of measurements dropped in shard %d to node %d", skipped, shardID, n.nodeID)
+	}
+	return kept
+}
+
+// held returns whether writes of shard shardID are held by its cutover.
+func (n *NodeProcessor) held(shardID uint64) bool {
+	return n.ShardCutovers != nil && n.ShardCutovers.ShardCutover(shardID) != nil
+}
+
+// Lag returns the bytes of hinted data pending for the node and how long the
+// oldest write pending has been queued or buffered, whatever the time of its
+// points. Blocks queued by older versions, not telling when they were queued,
+// are taken as queued when their segment was last modified. Age is 0 if
+// nothing is pending.
+func (n *NodeProcessor) Lag(now time.Time) (pending, buffered int64, age time.Duration, err error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.done == nil {
+		return 0, 0, 0, errs.ErrNodeProcessorClosed
+	}
+
+	if n.buffer != nil {
+		buffered = n.buffer.bytes()
+		if w := n.buffer.head(); w != nil && now.After(w.bufferedAt) {
+			age = now.Sub(w.bufferedAt)
+		}
+	}
+
+	pending = n.queue.Pending()
+	b, err := n.queue.Current()
+	if err == io.EOF {
+		return pending, buffered, age, nil
+	} else if err != nil {
+		return 0, 0, 0, err
+	}
+	queued, err := n.headQueuedAt(b)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if a := now.Sub(queued); a > age {
+		age = a
+	}
+	return pending, buffered, age, nil
+}
+
 // Head returns the head of the processor's queue.
 func (n *NodeProcessor) Head() string {
 	qp, err := n.queue.Position()
@@ -373,9 +913,16 @@ func (n *NodeProcessor) Active() (bool, error) {
 	return nio != nil, nil
 }
 
-func marshalWrite(shardID uint64, points []models.Point) []byte {
-	b := make([]byte, 8)
-	binary.BigEndian.PutUint64(b, shardID)
+// blockQueuedFlag marks the shard id of blocks of marshalWrite followed by the
+// time they were queued. Shard ids never reach the high bit, so blocks queued
+// by older versions, without the time, are still read.
+const blockQueuedFlag = 1 << 63
+
+// marshalWrite returns the block of points of shard shardID queued at queued.
+func marshalWrite(shardID uint64, points []models.Point, queued time.Time) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, shardID|blockQueuedFlag)
+	binary.BigEndian.PutUint64(b[8:], uint64(queued.UnixNano()))
 	for _, p := range points {
 		b = append(b, []byte(p.String())...)
 		b = append(b, '\n')
@@ -387,7 +934,36 @@ func unmarshalWrite(b []byte) (uint64, []models.Point, error) {
 	if len(b) < 8 {
 		return 0, nil, fmt.Errorf("too short: len = %d", len(b))
 	}
-	ownerID := binary.BigEndian.Uint64(b[:8])
-	points, err := models.ParsePoints(b[8:])
-	return ownerID, points, err
+	off := blockPointsOffset(b)
+	if len(b) < off {
+		return 0, nil, fmt.Errorf("too short: len = %d", len(b))
+	}
+	points, err := models.ParsePoints(b[off:])
+	return blockShardID(b), points, err
+}
+
+// blockPointsOffset returns where points of block b of marshalWrite start.
+func blockPointsOffset(b []byte) int {
+	if len(b) >= 8 && binary.BigEndian.Uint64(b[:8])&blockQueuedFlag != 0 {
+		return 16
+	}
+	return 8
+}
+
+// blockQueuedAt returns the time block b of marshalWrite was queued, false if
+// the block doesn't tell it.
+func blockQueuedAt(b []byte) (time.Time, bool) {
+	if blockPointsOffset(b) != 16 || len(b) < 16 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b[8:16]))), true
+}
+
+// headQueuedAt returns the time block b at the head of the queue was queued,
+// the time its segment was last modified for blocks not telling it.
+func (n *NodeProcessor) headQueuedAt(b []byte) (time.Time, error) {
+	if queued, ok := blockQueuedAt(b); ok {
+		return queued, nil
+	}
+	return n.queue.HeadLastModified()
 }
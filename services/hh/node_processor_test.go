@@ -1,12 +1,22 @@
 package hh
 
 import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/angopher/chronus/errs"
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
 )
@@ -15,8 +25,8 @@ type fakeShardWriter struct {
 	ShardWriteFn func(shardID, nodeID uint64, points []models.Point) error
 }
 
-func (f *fakeShardWriter) WriteShard(shardID, nodeID uint64, points []models.Point) error {
-	return f.ShardWriteFn(shardID, nodeID, points)
+func (f *fakeShardWriter) WriteShard(shardID imeta.ShardID, nodeID imeta.NodeID, points []models.Point) error {
+	return f.ShardWriteFn(uint64(shardID), uint64(nodeID), points)
 }
 
 type fakeMetaStore struct {
@@ -87,7 +97,7 @@ func TestNodeProcessorSendBlock(t *testing.T) {
 	}
 
 	// This should queue a write for the active node.
-	if err := n.WriteShard(expShardID, []models.Point{pt}); err != nil {
+	if err := n.WriteShard(imeta.ShardID(expShardID), []models.Point{pt}); err != nil {
 		t.Fatalf("SendWrite() failed to write points: %v", err)
 	}
 
@@ -129,7 +139,7 @@ func TestNodeProcessorSendBlock(t *testing.T) {
 	}
 
 	// This should queue a write for the node.
-	if err := n.WriteShard(expShardID, []models.Point{pt}); err != nil {
+	if err := n.WriteShard(imeta.ShardID(expShardID), []models.Point{pt}); err != nil {
 		t.Fatalf("SendWrite() failed to write points: %v", err)
 	}
 
@@ -154,3 +164,891 @@ func TestNodeProcessorSendBlock(t *testing.T) {
 		t.Fatalf("Node processor directory still present after purge")
 	}
 }
+
+func TestNodeProcessorPurgeUndelivered(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping purge node processor")
+	}
+
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	events := make(chan PurgeEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev PurgeEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("failed to decode purge event: %v", err)
+		}
+		events <- ev
+	}))
+	defer srv.Close()
+
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return nil, nil
+		},
+	}
+
+	n := NewNodeProcessor(1, dir, sh, metastore)
+	n.PurgeNotifyURL = srv.URL
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	pt1 := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	pt2 := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 2.0}, time.Unix(20, 0))
+	if err := n.WriteShard(3, []models.Point{pt2}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+	if err := n.WriteShard(2, []models.Point{pt1, pt2}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+
+	time.Sleep(time.Second)
+	ev := n.purge(time.Now())
+	if exp := int64(2); ev.Blocks != exp {
+		t.Fatalf("purged blocks mismatch: got %v, exp %v", ev.Blocks, exp)
+	}
+	if exp := int64(3); ev.Points != exp {
+		t.Fatalf("purged points mismatch: got %v, exp %v", ev.Points, exp)
+	}
+	if exp := []uint64{2, 3}; !reflect.DeepEqual(ev.ShardIDs, exp) {
+		t.Fatalf("purged shards mismatch: got %v, exp %v", ev.ShardIDs, exp)
+	}
+	if !ev.MinTime.Equal(pt1.Time()) || !ev.MaxTime.Equal(pt2.Time()) {
+		t.Fatalf("purged time range mismatch: got %v - %v", ev.MinTime, ev.MaxTime)
+	}
+
+	select {
+	case got := <-events:
+		if got.NodeID != 1 || got.Bytes != ev.Bytes {
+			t.Fatalf("notified event mismatch: got %+v, exp %+v", got, ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("purge event not notified")
+	}
+
+	// Nothing left to be purged
+	if ev := n.purge(time.Now()); !ev.Empty() {
+		t.Fatalf("unexpected purge event: %+v", ev)
+	}
+}
+
+func TestNodeProcessorPurgeShard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return nil, nil
+		},
+	}
+
+	n := NewNodeProcessor(1, dir, sh, metastore)
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+	// a segment for every write
+	if err := n.queue.(*queue).SetMaxSegmentSize(64); err != nil {
+		t.Fatal(err)
+	}
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	for _, id := range []imeta.ShardID{2, 3, 2, 4, 2} {
+		if err := n.WriteShard(id, []models.Point{pt}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+
+	ev, err := n.PurgeShard(2)
+	if err != nil {
+		t.Fatalf("PurgeShard() failed: %v", err)
+	}
+	if exp := int64(3); ev.Blocks != exp {
+		t.Fatalf("purged blocks mismatch: got %v, exp %v", ev.Blocks, exp)
+	}
+	if exp := []uint64{2}; !reflect.DeepEqual(ev.ShardIDs, exp) || ev.Reason != PurgeReasonShard {
+		t.Fatalf("purge event mismatch: %+v", ev)
+	}
+
+	var shards []uint64
+	for {
+		buf, err := n.queue.Current()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Current() failed: %v", err)
+		}
+		shardID, _, err := unmarshalWrite(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, shardID)
+		if err := n.queue.Advance(); err != nil {
+			t.Fatalf("Advance() failed: %v", err)
+		}
+	}
+	if exp := []uint64{3, 4}; !reflect.DeepEqual(shards, exp) {
+		t.Fatalf("shards left mismatch: got %v, exp %v", shards, exp)
+	}
+
+	if ev, err := n.PurgeShard(2); err != nil || !ev.Empty() {
+		t.Fatalf("unexpected purge: %+v, %v", ev, err)
+	}
+}
+
+type fakeShardOwners map[uint64]string
+
+func (f fakeShardOwners) ShardOwner(id uint64) (string, string, *meta.ShardGroupInfo) {
+	db, ok := f[id]
+	if !ok {
+		return "", "", nil
+	}
+	return db, "rp0", &meta.ShardGroupInfo{ID: 1}
+}
+
+func TestNodeProcessorPurgeDatabaseMaxAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return nil, nil
+		},
+	}
+
+	n := NewNodeProcessor(1, dir, sh, metastore)
+	// nothing is sent while purging
+	n.RetryInterval, n.RetryMaxInterval = time.Hour, time.Hour
+	n.MaxAge = time.Hour
+	n.DatabaseMaxAges = map[string]time.Duration{"critical": 48 * time.Hour, "scratch": time.Minute}
+	n.ShardOwners = fakeShardOwners{2: "critical", 3: "scratch", 4: "db0"}
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+	// a segment for every write
+	if err := n.queue.(*queue).SetMaxSegmentSize(64); err != nil {
+		t.Fatal(err)
+	}
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	for _, id := range []imeta.ShardID{2, 3, 4, 2, 5} {
+		if err := n.WriteShard(id, []models.Point{pt}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+
+	// scratch expired only
+	if ev := n.purgeExpired(time.Now().Add(30 * time.Minute)); !reflect.DeepEqual(ev.ShardIDs, []uint64{3}) {
+		t.Fatalf("purge event mismatch: %+v", ev)
+	}
+	// the default age applies to db0 and shard 5 dropped
+	if ev := n.purgeExpired(time.Now().Add(2 * time.Hour)); !reflect.DeepEqual(ev.ShardIDs, []uint64{4, 5}) {
+		t.Fatalf("purge event mismatch: %+v", ev)
+	}
+
+	var shards []uint64
+	for {
+		buf, err := n.queue.Current()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Current() failed: %v", err)
+		}
+		shardID, _, err := unmarshalWrite(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, shardID)
+		if err := n.queue.Advance(); err != nil {
+			t.Fatalf("Advance() failed: %v", err)
+		}
+	}
+	if exp := []uint64{2, 2}; !reflect.DeepEqual(shards, exp) {
+		t.Fatalf("shards left mismatch: got %v, exp %v", shards, exp)
+	}
+}
+
+type fakeStaleShards func(nodeID uint64, shardIDs []uint64) error
+
+func (f fakeStaleShards) MarkShardsStale(nodeID uint64, shardIDs []uint64) error {
+	return f(nodeID, shardIDs)
+}
+
+func TestNodeProcessorMarkStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return nil, nil
+		},
+	}
+
+	marked := make(chan []uint64, 2)
+	n := NewNodeProcessor(1, dir, sh, metastore)
+	n.StaleShards = fakeStaleShards(func(nodeID uint64, shardIDs []uint64) error {
+		if nodeID != 1 {
+			t.Errorf("marked shards of node %d", nodeID)
+		}
+		marked <- shardIDs
+		return nil
+	})
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+	// a segment for every write
+	if err := n.queue.(*queue).SetMaxSegmentSize(64); err != nil {
+		t.Fatal(err)
+	}
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	for _, id := range []imeta.ShardID{2, 3} {
+		if err := n.WriteShard(id, []models.Point{pt}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+
+	// purged on purpose, not stale
+	if _, err := n.PurgeShard(2); err != nil {
+		t.Fatalf("PurgeShard() failed: %v", err)
+	}
+	time.Sleep(time.Second)
+	n.purge(time.Now())
+
+	select {
+	case got := <-marked:
+		if exp := []uint64{3}; !reflect.DeepEqual(got, exp) {
+			t.Fatalf("stale shards mismatch: got %v, exp %v", got, exp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("shards not marked stale")
+	}
+	select {
+	case got := <-marked:
+		t.Fatalf("unexpected stale shards: %v", got)
+	default:
+	}
+}
+
+func TestNodeProcessorWriteThrough(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var writeErr error
+	var count int
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			if writeErr != nil {
+				return writeErr
+			}
+			count++
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return &meta.NodeInfo{}, nil
+		},
+	}
+
+	// Don't let the background loop interfere
+	defer func(d time.Duration) { writeThroughRetryInterval = d }(writeThroughRetryInterval)
+	writeThroughRetryInterval = time.Hour
+
+	n := NewNodeProcessor(1, dir, sh, metastore)
+	n.WriteThroughWindow = time.Hour
+	n.RetryInterval = time.Hour
+	n.RetryMaxInterval = time.Hour
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(0, 0))
+	if err := n.WriteShard(1, []models.Point{pt}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+
+	// Held in memory instead of queue
+	if _, err := n.queue.Current(); err != io.EOF {
+		t.Fatalf("unexpected queue state: %v", err)
+	}
+
+	writeErr = fmt.Errorf("node down")
+	n.retryBuffered()
+	if n.buffer.head() == nil {
+		t.Fatalf("failed write should be kept in buffer")
+	}
+
+	writeErr = nil
+	n.retryBuffered()
+	if exp := 1; count != exp {
+		t.Fatalf("write count mismatch: got %v, exp %v", count, exp)
+	}
+	if n.buffer.head() != nil {
+		t.Fatalf("buffer should be empty")
+	}
+
+	// Window passed, writes go to queue
+	n.buffer.window = 0
+	if err := n.WriteShard(2, []models.Point{pt}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+	buf, err := n.queue.Current()
+	if err != nil {
+		t.Fatalf("failed to read queue: %v", err)
+	}
+	if shardID, _, _ := unmarshalWrite(buf); shardID != 2 {
+		t.Fatalf("queued shard mismatch: got %v, exp %v", shardID, 2)
+	}
+}
+
+func TestNodeProcessorWriteThroughSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(d time.Duration) { writeThroughRetryInterval = d }(writeThroughRetryInterval)
+	writeThroughRetryInterval = time.Hour
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(0, 0))
+	var n *NodeProcessor
+	var sent []uint64
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			if len(sent) == 0 {
+				// while the first write is sent, one too big spills the
+				// others and a later one is buffered again
+				if err := n.WriteShard(3, []models.Point{pt, pt, pt, pt}); err != nil {
+					t.Fatalf("WriteShard() failed: %v", err)
+				}
+				if err := n.WriteShard(4, []models.Point{pt}); err != nil {
+					t.Fatalf("WriteShard() failed: %v", err)
+				}
+			}
+			sent = append(sent, shardID)
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return &meta.NodeInfo{}, nil
+		},
+	}
+	n = NewNodeProcessor(1, dir, sh, metastore)
+	n.WriteThroughWindow = time.Hour
+	n.WriteThroughBufferSize = 3 * writeSize([]models.Point{pt})
+	n.RetryInterval = time.Hour
+	n.RetryMaxInterval = time.Hour
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	for _, id := range []imeta.ShardID{1, 2} {
+		if err := n.WriteShard(id, []models.Point{pt}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+	n.retryBuffered()
+
+	// the write sent is not queued, the one buffered again is not lost
+	if exp := []uint64{1, 4}; !reflect.DeepEqual(sent, exp) {
+		t.Fatalf("sent writes mismatch: got %v, exp %v", sent, exp)
+	}
+	if n.buffer.head() != nil {
+		t.Fatalf("buffer should be empty")
+	}
+	var queued []uint64
+	for {
+		buf, err := n.queue.Current()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("failed to read queue: %v", err)
+		}
+		shardID, _, _ := unmarshalWrite(buf)
+		queued = append(queued, shardID)
+		if err := n.queue.Advance(); err != nil {
+			t.Fatalf("failed to advance queue: %v", err)
+		}
+	}
+	if exp := []uint64{2, 3}; !reflect.DeepEqual(queued, exp) {
+		t.Fatalf("queued writes mismatch: got %v, exp %v", queued, exp)
+	}
+}
+
+func TestNodeProcessorLag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := NewNodeProcessor(1, dir, &fakeShardWriter{}, &fakeMetaStore{})
+	n.RetryInterval = time.Hour
+	n.RetryMaxInterval = time.Hour
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	if pending, _, age, err := n.Lag(time.Now()); err != nil || pending != 0 || age != 0 {
+		t.Fatalf("unexpected lag of empty queue: %v, %v, %v", pending, age, err)
+	}
+
+	// points of long ago queued now, e.g. backfilled
+	pt1 := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	pt2 := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 2.0}, time.Unix(90, 0))
+	queued := time.Now()
+	if err := n.WriteShard(1, []models.Point{pt2, pt1}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+
+	pending, _, age, err := n.Lag(queued.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Lag() failed: %v", err)
+	}
+	if exp := int64(len(marshalWrite(1, []models.Point{pt2, pt1}, queued)) + 8); pending != exp {
+		t.Fatalf("pending bytes mismatch: got %v, exp %v", pending, exp)
+	}
+	if age < time.Minute-time.Second || age > time.Minute+time.Second {
+		t.Fatalf("oldest age mismatch: got %v, exp about %v", age, time.Minute)
+	}
+}
+
+// Ensures the age of a block queued long ago stays once writes are appended
+// after it to the same segment, modifying the segment.
+func TestNodeProcessorLag_OldBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := NewNodeProcessor(1, dir, &fakeShardWriter{}, &fakeMetaStore{})
+	n.RetryInterval = time.Hour
+	n.RetryMaxInterval = time.Hour
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	now := time.Now()
+	if err := n.queue.Append(marshalWrite(1, []models.Point{pt}, now.Add(-2*time.Hour))); err != nil {
+		t.Fatalf("Append() failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := n.WriteShard(1, []models.Point{pt}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+
+	_, _, age, err := n.Lag(now)
+	if err != nil {
+		t.Fatalf("Lag() failed: %v", err)
+	}
+	if age != 2*time.Hour {
+		t.Fatalf("oldest age mismatch: got %v, exp %v", age, 2*time.Hour)
+	}
+}
+
+// Ensures blocks queued without the time they were queued are still read.
+func TestUnmarshalWrite_NoQueuedTime(t *testing.T) {
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, 3)
+	b = append(b, []byte(pt.String()+"\n")...)
+
+	shardID, points, err := unmarshalWrite(b)
+	if err != nil || shardID != 3 || len(points) != 1 {
+		t.Fatalf("unexpected block: %v, %v, %v", shardID, points, err)
+	}
+	if _, ok := blockQueuedAt(b); ok {
+		t.Fatal("queued time read from block without it")
+	}
+
+	queued := time.Unix(100, 0)
+	b = marshalWrite(3, []models.Point{pt}, queued)
+	shardID, points, err = unmarshalWrite(b)
+	if err != nil || shardID != 3 || len(points) != 1 || blockShardID(b) != 3 {
+		t.Fatalf("unexpected block: %v, %v, %v", shardID, points, err)
+	}
+	if at, ok := blockQueuedAt(b); !ok || !at.Equal(queued) {
+		t.Fatalf("queued time mismatch: got %v, exp %v", at, queued)
+	}
+}
+
+type permanentError struct{}
+
+func (permanentError) Error() string   { return "field type conflict" }
+func (permanentError) Retryable() bool { return false }
+
+func TestNodeProcessorDropPermanent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var sent []uint64
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			sent = append(sent, shardID)
+			switch shardID {
+			case 1:
+				return fmt.Errorf("write shard 1: %w", permanentError{})
+			case 2:
+				return fmt.Errorf("connection refused")
+			}
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return &meta.NodeInfo{}, nil
+		},
+	}
+
+	n := NewNodeProcessor(1, dir, sh, metastore)
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	for _, id := range []imeta.ShardID{1, 2} {
+		if err := n.WriteShard(id, []models.Point{pt}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+
+	// permanent failure is dropped, the queue goes on
+	if _, err := n.SendWrite(); err != nil {
+		t.Fatalf("SendWrite() of permanent failure: %v", err)
+	}
+	// other failures are kept to be retried
+	for i := 0; i < 2; i++ {
+		if _, err := n.SendWrite(); err == nil {
+			t.Fatalf("SendWrite() of retryable failure succeeded")
+		}
+	}
+	if exp := []uint64{1, 2, 2}; !reflect.DeepEqual(sent, exp) {
+		t.Fatalf("writes mismatch: got %v, exp %v", sent, exp)
+	}
+
+	stats := n.Statistics(nil)[0].Values
+	if v := stats["writeNodeReqDrop"]; v != int64(1) {
+		t.Fatalf("unexpected writeNodeReqDrop: %v", v)
+	}
+}
+
+type fakeShardCutovers map[uint64]*imeta.ShardCutover
+
+func (f fakeShardCutovers) ShardCutover(id uint64) *imeta.ShardCutover {
+	return f[id]
+}
+
+func TestNodeProcessorShardCutover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var sent int
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			sent++
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return &meta.NodeInfo{}, nil
+		},
+	}
+
+	cutovers := fakeShardCutovers{1: {ShardID: 1, NodeID: 2}}
+	n := NewNodeProcessor(2, dir, sh, metastore)
+	n.ShardCutovers = cutovers
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	if err := n.WriteShard(1, []models.Point{pt}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+
+	// held without being sent nor dropped
+	if _, err := n.SendWrite(); !errors.Is(err, errs.ErrShardCutover) {
+		t.Fatalf("SendWrite() during cutover: got %v, exp %v", err, errs.ErrShardCutover)
+	}
+	if sent != 0 {
+		t.Fatalf("%d writes sent during cutover", sent)
+	}
+
+	delete(cutovers, 1)
+	if _, err := n.SendWrite(); err != nil {
+		t.Fatalf("SendWrite() once cutover ended: %v", err)
+	}
+	if sent != 1 {
+		t.Fatalf("%d writes sent once cutover ended, exp 1", sent)
+	}
+}
+
+// fakeDroppedMeasurements are the times measurements were dropped at.
+type fakeDroppedMeasurements map[string]time.Time
+
+func (f fakeDroppedMeasurements) MeasurementDroppedAfter(database, name string, t time.Time) bool {
+	at, ok := f[database+"."+name]
+	return ok && at.After(t)
+}
+
+func TestNodeProcessorSkipDropped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var sent []string
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			for _, p := range points {
+				sent = append(sent, string(p.Name()))
+			}
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return &meta.NodeInfo{}, nil
+		},
+	}
+
+	dropped := fakeDroppedMeasurements{}
+	n := NewNodeProcessor(2, dir, sh, metastore)
+	n.ShardOwners = fakeShardOwners{1: "db0"}
+	n.DroppedMeasurements = dropped
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	cpu := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	mem := models.MustNewPoint("mem", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	for i := 0; i < 2; i++ {
+		if err := n.WriteShard(1, []models.Point{cpu, mem}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+	if err := n.WriteShard(1, []models.Point{mem}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+
+	// cpu dropped after being queued, a block left empty is skipped
+	dropped["db0.cpu"] = time.Now().Add(time.Minute)
+	dropped["db0.mem"] = time.Now().Add(time.Minute)
+	if _, err := n.SendWrite(); err != nil {
+		t.Fatalf("SendWrite() failed: %v", err)
+	}
+	delete(dropped, "db0.mem")
+	for i := 0; i < 2; i++ {
+		if _, err := n.SendWrite(); err != nil {
+			t.Fatalf("SendWrite() failed: %v", err)
+		}
+	}
+	if _, err := n.SendWrite(); err != io.EOF {
+		t.Fatalf("SendWrite() of empty queue: got %v, exp EOF", err)
+	}
+
+	if exp := []string{"mem", "mem"}; !reflect.DeepEqual(sent, exp) {
+		t.Fatalf("points sent mismatch: got %v, exp %v", sent, exp)
+	}
+	stats := n.Statistics(nil)[0].Values
+	if v := stats["droppedMeasurementPoints"]; v != int64(3) {
+		t.Fatalf("unexpected droppedMeasurementPoints: %v", v)
+	}
+}
+
+func TestNodeProcessorAdvanceFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var sent int
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			sent++
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return &meta.NodeInfo{}, nil
+		},
+	}
+
+	n := NewNodeProcessor(1, dir, sh, metastore)
+	n.AdvanceFailureThreshold = 2
+	n.BlockWritesWhenUnhealthy = true
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	for i := 0; i < 2; i++ {
+		if err := n.WriteShard(1, []models.Point{pt}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+
+	// the segment can't be written like on disk errors
+	seg := n.queue.(*queue).head
+	rw := seg.file
+	ro, err := os.Open(seg.path)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	seg.file = ro
+	for i := 0; i < 2; i++ {
+		if _, err := n.SendWrite(); err == nil {
+			t.Fatalf("SendWrite() succeeded failing to advance")
+		}
+	}
+	if n.Healthy() {
+		t.Fatalf("processor healthy after advance failures")
+	}
+	if err := n.WriteShard(1, []models.Point{pt}); err != ErrNodeUnhealthy {
+		t.Fatalf("WriteShard() to unhealthy node: got %v, exp %v", err, ErrNodeUnhealthy)
+	}
+	stats := n.Statistics(nil)[0].Values
+	if stats["advanceFail"] != int64(2) || stats["healthy"] != false {
+		t.Fatalf("unexpected statistics: %v", stats)
+	}
+
+	// the disk recovers
+	seg.file = rw
+	ro.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := n.SendWrite(); err != nil {
+			t.Fatalf("SendWrite() failed: %v", err)
+		}
+	}
+	if !n.Healthy() {
+		t.Fatalf("processor unhealthy after advancing")
+	}
+	if _, err := n.SendWrite(); err != io.EOF {
+		t.Fatalf("SendWrite() of drained queue: got %v, exp %v", err, io.EOF)
+	}
+	// the first block is sent again until advanced
+	if exp := 4; sent != exp {
+		t.Fatalf("blocks sent: got %d, exp %d", sent, exp)
+	}
+}
+
+func TestNodeProcessorAppendBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_processor_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sent := make(map[uint64]int)
+	sh := &fakeShardWriter{
+		ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+			sent[shardID] += len(points)
+			return nil
+		},
+	}
+	metastore := &fakeMetaStore{
+		NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			return &meta.NodeInfo{}, nil
+		},
+	}
+
+	n := NewNodeProcessor(1, dir, sh, metastore)
+	n.AppendBatchDelay = 100 * time.Millisecond
+	if err := n.Open(); err != nil {
+		t.Fatalf("Failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	pt := models.MustNewPoint("cpu", models.Tags{}, models.Fields{"value": 1.0}, time.Unix(10, 0))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := n.WriteShard(imeta.ShardID(i%2), []models.Point{pt}); err != nil {
+				t.Errorf("WriteShard() failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var blocks int
+	for {
+		if _, err := n.SendWrite(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("SendWrite() failed: %v", err)
+		}
+		blocks++
+	}
+	if blocks < 2 || blocks >= 20 {
+		t.Fatalf("writes not coalesced: %d blocks", blocks)
+	}
+	if exp := map[uint64]int{0: 10, 1: 10}; !reflect.DeepEqual(sent, exp) {
+		t.Fatalf("points sent mismatch: got %v, exp %v", sent, exp)
+	}
+}
@@ -0,0 +1,108 @@
+package hh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+const (
+	// purgeNotifyTimeout is the timeout of posting a purge event to webhook
+	purgeNotifyTimeout = 10 * time.Second
+)
+
+// Reasons of hinted data being purged.
+const (
+	PurgeReasonMaxAge = "max-age"
+	PurgeReasonBefore = "before"
+	PurgeReasonShard  = "shard"
+)
+
+// PurgeEvent describes hinted data which is dropped before being delivered
+// to the target node.
+type PurgeEvent struct {
+	NodeID   uint64    `json:"node_id"`
+	ShardIDs []uint64  `json:"shard_ids"`
+	Blocks   int64     `json:"blocks"`
+	Bytes    int64     `json:"bytes"`
+	Points   int64     `json:"points"`
+	MinTime  time.Time `json:"min_time"`
+	MaxTime  time.Time `json:"max_time"`
+	PurgedAt time.Time `json:"purged_at"`
+	Reason   string    `json:"reason"`
+
+	shards map[uint64]struct{}
+}
+
+func newPurgeEvent(nodeID uint64, reason string) *PurgeEvent {
+	return &PurgeEvent{
+		NodeID: nodeID,
+		Reason: reason,
+		shards: make(map[uint64]struct{}),
+	}
+}
+
+// add accumulates a block dropped from queue
+func (e *PurgeEvent) add(b []byte) {
+	e.Blocks++
+	e.Bytes += int64(len(b))
+
+	// the block is counted even if it's corrupted
+	if len(b) < 8 {
+		return
+	}
+	shardID, points, _ := unmarshalWrite(b)
+	if _, ok := e.shards[shardID]; !ok {
+		e.shards[shardID] = struct{}{}
+		e.ShardIDs = append(e.ShardIDs, shardID)
+	}
+	e.addPoints(points)
+}
+
+func (e *PurgeEvent) addPoints(points []models.Point) {
+	for _, p := range points {
+		ts := p.Time().UTC()
+		if e.Points == 0 || ts.Before(e.MinTime) {
+			e.MinTime = ts
+		}
+		if e.Points == 0 || ts.After(e.MaxTime) {
+			e.MaxTime = ts
+		}
+		e.Points++
+	}
+}
+
+// Empty returns whether nothing undelivered was dropped
+func (e *PurgeEvent) Empty() bool {
+	return e.Blocks == 0
+}
+
+func (e *PurgeEvent) finish() {
+	sort.Slice(e.ShardIDs, func(i, j int) bool { return e.ShardIDs[i] < e.ShardIDs[j] })
+	e.PurgedAt = time.Now().UTC()
+}
+
+// postPurgeEvent posts the event as json to the url specified
+func postPurgeEvent(url string, e *PurgeEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: purgeNotifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -10,13 +10,15 @@ import (
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/angopher/chronus/errs"
 )
 
 // Possible errors returned by a hinted handoff queue.
 var (
-	ErrNotOpen     = fmt.Errorf("queue not open")
-	ErrQueueFull   = fmt.Errorf("queue is full")
-	ErrSegmentFull = fmt.Errorf("segment is full")
+	ErrNotOpen     = errs.ErrQueueNotOpen
+	ErrQueueFull   = errs.ErrQueueFull
+	ErrSegmentFull = errs.ErrSegmentFull
 )
 
 const (
@@ -72,6 +74,9 @@ type queue struct {
 
 	// The segments that exist on disk
 	segments segments
+
+	// Blocks are encrypted on disk if cipher is set
+	cipher *blockCipher
 }
 type queuePos struct {
 	head string
@@ -146,7 +151,7 @@ func (l *queue) Remove() error {
 	defer l.mu.Unlock()
 
 	if l.head != nil || l.tail != nil || l.segments != nil {
-		return fmt.Errorf("queue is open")
+		return errs.ErrQueueOpen
 	}
 
 	return os.RemoveAll(l.dir)
@@ -174,7 +179,10 @@ func (l *queue) SetMaxSegmentSize(size int64) error {
 	return nil
 }
 
-func (l *queue) PurgeOlderThan(when time.Time) error {
+// PurgeOlderThan removes head segments which were last modified before when.
+// If fn is not nil, it is invoked with every block of a segment which has not
+// been advanced past yet, right before the segment is removed.
+func (l *queue) PurgeOlderThan(when time.Time, fn func(b []byte)) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -202,12 +210,84 @@ func (l *queue) PurgeOlderThan(when time.Time) error {
 			}
 		}
 
+		if fn != nil {
+			if err := l.head.unread(func(b []byte) {
+				// blocks of another key are purged unseen
+				if b, err := l.cipher.open(b); err == nil {
+					fn(b)
+				}
+			}); err != nil {
+				return err
+			}
+		}
+
 		if err := l.trimHead(); err != nil {
 			return err
 		}
 	}
 }
 
+// PurgeBlocks removes blocks not advanced past yet for which drop returns
+// true, invoking fn with each of them. Segments holding blocks dropped are
+// rewritten without them, and removed if nothing is left unless it's the
+// tail. Blocks encrypted by another key are kept.
+func (l *queue) PurgeBlocks(drop func(b []byte) bool, fn func(b []byte)) error {
+	return l.PurgeBlocksBefore(time.Time{}, func(b []byte, mod time.Time) bool {
+		return drop(b)
+	}, fn)
+}
+
+// PurgeBlocksBefore is PurgeBlocks of segments last modified before when, or
+// of all segments if when is zero. drop is given the time the segment of a
+// block was last modified as well.
+func (l *queue) PurgeBlocksBefore(when time.Time, drop func(b []byte, mod time.Time) bool, fn func(b []byte)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.head == nil {
+		return ErrNotOpen
+	}
+
+	for _, s := range l.segments {
+		mod, err := s.lastModified()
+		if err != nil {
+			return err
+		}
+		if !when.IsZero() && !mod.Before(when) {
+			continue
+		}
+		if err := s.rewrite(func(b []byte) bool {
+			b, err := l.cipher.open(b)
+			if err != nil || !drop(b, mod) {
+				return true
+			}
+			if fn != nil {
+				fn(b)
+			}
+			return false
+		}); err != nil {
+			return err
+		}
+	}
+
+	kept := l.segments[:0]
+	for i, s := range l.segments {
+		if i == len(l.segments)-1 || s.pending() > 0 {
+			kept = append(kept, s)
+			continue
+		}
+		if err := s.close(); err != nil {
+			return err
+		}
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+	}
+	l.segments = kept
+	l.head = l.segments[0]
+	return nil
+}
+
 // LastModified returns the last time the queue was modified.
 func (l *queue) LastModified() (time.Time, error) {
 	l.mu.RLock()
@@ -219,6 +299,18 @@ func (l *queue) LastModified() (time.Time, error) {
 	return time.Time{}.UTC(), nil
 }
 
+// HeadLastModified returns the last time the head segment was modified, no
+// block of it was appended later.
+func (l *queue) HeadLastModified() (time.Time, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.head == nil {
+		return time.Time{}, ErrNotOpen
+	}
+	return l.head.lastModified()
+}
+
 func (l *queue) Position() (*queuePos, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
@@ -233,6 +325,19 @@ func (l *queue) Position() (*queuePos, error) {
 	return qp, nil
 }
 
+// Pending returns the size in bytes of blocks not advanced past yet,
+// including the length headers.
+func (l *queue) Pending() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var size int64
+	for _, s := range l.segments {
+		size += s.pending()
+	}
+	return size
+}
+
 // diskUsage returns the total size on disk used by the queue
 func (l *queue) diskUsage() int64 {
 	var size int64
@@ -326,6 +431,10 @@ func (l *queue) Append(b []byte) error {
 		return ErrNotOpen
 	}
 
+	b, err := l.cipher.seal(b)
+	if err != nil {
+		return err
+	}
 	if l.diskUsage()+int64(len(b)) > l.maxSize {
 		return ErrQueueFull
 	}
@@ -343,13 +452,64 @@ func (l *queue) Append(b []byte) error {
 	return nil
 }
 
+// AppendBatch appends byte slices to the end of the queue with as few syncs
+// as possible. Either all or none of them are appended if the queue is full.
+func (l *queue) AppendBatch(blocks [][]byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tail == nil {
+		return ErrNotOpen
+	}
+
+	if l.cipher != nil {
+		sealed := make([][]byte, len(blocks))
+		for i, b := range blocks {
+			var err error
+			if sealed[i], err = l.cipher.seal(b); err != nil {
+				return err
+			}
+		}
+		blocks = sealed
+	}
+
+	var size int64
+	for _, b := range blocks {
+		size += int64(len(b))
+	}
+	if l.diskUsage()+size > l.maxSize {
+		return ErrQueueFull
+	}
+
+	var added bool
+	for len(blocks) > 0 {
+		n, err := l.tail.appendBatch(blocks)
+		blocks = blocks[n:]
+		if err != ErrSegmentFull || (added && n == 0) {
+			// a block larger than a new segment
+			return err
+		}
+		segment, err := l.addSegment()
+		if err != nil {
+			return err
+		}
+		l.tail = segment
+		added = true
+	}
+	return nil
+}
+
 // Current returns the current byte slice at the head of the queue
 func (l *queue) Current() ([]byte, error) {
 	if l.head == nil {
 		return nil, ErrNotOpen
 	}
 
-	return l.head.current()
+	b, err := l.head.current()
+	if err != nil {
+		return nil, err
+	}
+	return l.cipher.open(b)
 }
 
 // Advance moves the head point to the next byte slice in the queue
@@ -365,6 +525,8 @@ func (l *queue) Advance() error {
 		if err := l.trimHead(); err != nil {
 			return err
 		}
+	} else if err != nil {
+		return err
 	}
 
 	return nil
@@ -488,47 +650,64 @@ func (l *segment) open() error {
 
 // append adds byte slice to the end of segment
 func (l *segment) append(b []byte) error {
+	_, err := l.appendBatch([][]byte{b})
+	return err
+}
+
+// appendBatch appends blocks as many as the segment holds with a single sync,
+// returning the number appended. ErrSegmentFull is returned if not all.
+func (l *segment) appendBatch(blocks [][]byte) (int, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	if l.file == nil {
-		return ErrNotOpen
+		return 0, ErrNotOpen
 	}
 
-	if l.size+int64(len(b)) > l.maxSize {
-		return ErrSegmentFull
+	if len(blocks) == 0 || l.size+int64(len(blocks[0])) > l.maxSize {
+		return 0, ErrSegmentFull
 	}
 
 	if err := l.seekEnd(-footerSize); err != nil {
-		return err
+		return 0, err
 	}
 
-	if err := l.writeUint64(uint64(len(b))); err != nil {
-		return err
-	}
+	var n int
+	for _, b := range blocks {
+		if l.size+int64(len(b)) > l.maxSize {
+			break
+		}
 
-	if err := l.writeBytes(b); err != nil {
-		return err
+		if err := l.writeUint64(uint64(len(b))); err != nil {
+			return n, err
+		}
+
+		if err := l.writeBytes(b); err != nil {
+			return n, err
+		}
+
+		if l.currentSize == 0 {
+			l.currentSize = int64(len(b))
+		}
+
+		l.size += int64(len(b)) + 8 // uint64 for slice length
+		n++
 	}
 
 	if err := l.writeUint64(uint64(l.pos)); err != nil {
-		return err
+		return n, err
 	}
 
 	if err := l.file.Sync(); err != nil {
-		return err
+		return n, err
 	}
 
-	if l.currentSize == 0 {
-		l.currentSize = int64(len(b))
+	if n < len(blocks) {
+		return n, ErrSegmentFull
 	}
-
-	l.size += int64(len(b)) + 8 // uint64 for slice length
-
-	return nil
+	return n, nil
 }
 
-// current returns byte slice that the current segment points
 func (l *segment) current() ([]byte, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -560,6 +739,130 @@ func (l *segment) current() ([]byte, error) {
 	return b, nil
 }
 
+// unread calls fn with each block from the current position to the end of
+// segment without moving the current value pointer
+func (l *segment) unread(fn func(b []byte)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return ErrNotOpen
+	}
+
+	pos := l.pos
+	for pos < l.size-footerSize {
+		if err := l.seek(pos); err != nil {
+			return err
+		}
+
+		sz, err := l.readUint64()
+		if err != nil {
+			return err
+		}
+
+		if int64(sz) > l.maxSize {
+			return fmt.Errorf("record size out of range: max %d: got %d", l.maxSize, sz)
+		}
+
+		b := make([]byte, sz)
+		if err := l.readBytes(b); err != nil {
+			return err
+		}
+		fn(b)
+		pos += int64(sz) + 8
+	}
+
+	return nil
+}
+
+// rewrite replaces the segment by one holding blocks from the current
+// position for which keep returns true, if it doesn't keep all of them.
+func (l *segment) rewrite(keep func(b []byte) bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return ErrNotOpen
+	}
+
+	var kept [][]byte
+	dropped := false
+	pos := l.pos
+	for pos < l.size-footerSize {
+		if err := l.seek(pos); err != nil {
+			return err
+		}
+
+		sz, err := l.readUint64()
+		if err != nil {
+			return err
+		}
+
+		if int64(sz) > l.maxSize {
+			return fmt.Errorf("record size out of range: max %d: got %d", l.maxSize, sz)
+		}
+
+		b := make([]byte, sz)
+		if err := l.readBytes(b); err != nil {
+			return err
+		}
+		if keep(b) {
+			kept = append(kept, b)
+		} else {
+			dropped = true
+		}
+		pos += int64(sz) + 8
+	}
+	if !dropped {
+		return nil
+	}
+	// blocks kept are as old as before, so that they expire the same
+	st, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	mod := st.ModTime()
+
+	// blocks followed by the footer pointing to the first one
+	var size int64
+	for _, b := range kept {
+		size += int64(len(b)) + 8
+	}
+	buf := make([]byte, 0, size+footerSize)
+	var n [8]byte
+	for _, b := range kept {
+		binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+		buf = append(buf, n[:]...)
+		buf = append(buf, b...)
+	}
+	binary.BigEndian.PutUint64(n[:], 0)
+	buf = append(buf, n[:]...)
+
+	tmp := l.path + ".tmp"
+	if err := writeFileSync(tmp, buf); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+	if err := os.Chtimes(l.path, mod, mod); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file = f
+	l.size = int64(len(buf))
+	l.pos = 0
+	l.currentSize = 0
+	if len(kept) > 0 {
+		l.currentSize = int64(len(kept[0]))
+	}
+	return nil
+}
+
 // advance advances the current value pointer
 func (l *segment) advance() error {
 	l.mu.Lock()
@@ -607,6 +910,22 @@ func (l *segment) advance() error {
 	return nil
 }
 
+func writeFileSync(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func (l *segment) close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -638,6 +957,12 @@ func (l *segment) diskUsage() int64 {
 	return l.size
 }
 
+func (l *segment) pending() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.size - footerSize - l.pos
+}
+
 func (l *segment) SetMaxSegmentSize(size int64) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
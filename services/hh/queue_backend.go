@@ -0,0 +1,149 @@
+package hh
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Storage backends of hinted handoff queues.
+const (
+	// QueueBackendSegment stores queues in append-only segment files.
+	QueueBackendSegment = "segment"
+	// QueueBackendBadger stores queues in an embedded badger KV store, keyed
+	// by shard as well so that blocks of a shard are purged without a scan.
+	QueueBackendBadger = "badger"
+)
+
+// blockQueue is a disk-backed queue of blocks of hinted data, read back in
+// the order appended from its head until advanced past.
+type blockQueue interface {
+	Open() error
+	Close() error
+	Remove() error
+
+	Append(b []byte) error
+	AppendBatch(blocks [][]byte) error
+	Current() ([]byte, error)
+	Advance() error
+
+	PurgeOlderThan(when time.Time, fn func(b []byte)) error
+	PurgeBlocks(drop func(b []byte) bool, fn func(b []byte)) error
+	PurgeBlocksBefore(when time.Time, drop func(b []byte, mod time.Time) bool, fn func(b []byte)) error
+
+	LastModified() (time.Time, error)
+	HeadLastModified() (time.Time, error)
+	Position() (*queuePos, error)
+	Pending() int64
+}
+
+// shardQueue is a blockQueue indexing blocks by shard.
+type shardQueue interface {
+	blockQueue
+
+	// PurgeShard removes blocks of shard shardID not advanced past yet,
+	// invoking fn with each of them.
+	PurgeShard(shardID uint64, fn func(b []byte)) error
+}
+
+var (
+	_ blockQueue = (*queue)(nil)
+	_ shardQueue = (*kvQueue)(nil)
+)
+
+// validQueueBackend tells whether backend names a queue storage backend, empty
+// for the default.
+func validQueueBackend(backend string) bool {
+	switch backend {
+	case "", QueueBackendSegment, QueueBackendBadger:
+		return true
+	}
+	return false
+}
+
+// newBlockQueue returns the queue stored by backend in dir, not opened yet.
+func newBlockQueue(backend, dir string, maxSize int64, cipher *blockCipher) (blockQueue, error) {
+	if backend == QueueBackendBadger {
+		q := newKVQueue(filepath.Join(dir, kvQueueDir), maxSize)
+		q.cipher = cipher
+		return q, nil
+	}
+	q, err := newQueue(dir, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	q.cipher = cipher
+	return q, nil
+}
+
+// hasQueueData tells whether backend has stored a queue in dir, e.g. before
+// the backend configured was switched.
+func hasQueueData(backend, dir string) (bool, error) {
+	if backend == QueueBackendBadger {
+		_, err := os.Stat(filepath.Join(dir, kvQueueDir))
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if _, err := strconv.ParseUint(f.Name(), 10, 64); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// removeQueueData removes the queue backend stored in dir, once migrated.
+func removeQueueData(backend, dir string) error {
+	if backend == QueueBackendBadger {
+		return os.RemoveAll(filepath.Join(dir, kvQueueDir))
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if _, err := strconv.ParseUint(f.Name(), 10, 64); err != nil {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateQueue moves the blocks pending in from to the tail of to, advancing
+// from past each block moved. Times blocks were appended are not kept.
+func migrateQueue(from, to blockQueue) (int, error) {
+	var n int
+	for {
+		b, err := from.Current()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		if err := to.Append(b); err != nil {
+			return n, err
+		}
+		if err := from.Advance(); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
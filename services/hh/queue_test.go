@@ -1,11 +1,13 @@
 package hh
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -115,6 +117,63 @@ func TestQueueAppendMultiple(t *testing.T) {
 	}
 }
 
+func TestQueueAppendBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hh_queue")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newQueue(dir, 1024)
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+
+	if err := q.Open(); err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	// the batch spans segments
+	if err := q.SetMaxSegmentSize(40); err != nil {
+		t.Fatalf("failed to set segment size: %v", err)
+	}
+
+	var exp []string
+	var blocks [][]byte
+	for i := 0; i < 10; i++ {
+		exp = append(exp, fmt.Sprint("block", i))
+		blocks = append(blocks, []byte(exp[i]))
+	}
+	if err := q.AppendBatch(blocks); err != nil {
+		t.Fatalf("Queue.AppendBatch failed: %v", err)
+	}
+	if err := q.AppendBatch([][]byte{make([]byte, 1024)}); err != ErrQueueFull {
+		t.Fatalf("Queue.AppendBatch beyond max size: got %v, exp %v", err, ErrQueueFull)
+	}
+
+	if err := q.Close(); err != nil {
+		t.Fatalf("failed to close queue: %v", err)
+	}
+	if err := q.Open(); err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	var got []string
+	for {
+		cur, err := q.Current()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Queue.Current failed: %v", err)
+		}
+		got = append(got, string(cur))
+		if err := q.Advance(); err != nil {
+			t.Fatalf("Queue.Advance failed: %v", err)
+		}
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("blocks mismatch: got %v, exp %v", got, exp)
+	}
+}
+
 func TestQueueAdvancePastEnd(t *testing.T) {
 	dir, err := ioutil.TempDir("", "hh_queue")
 	if err != nil {
@@ -315,7 +374,7 @@ func TestPurgeQueue(t *testing.T) {
 
 	time.Sleep(time.Second)
 
-	if err := q.PurgeOlderThan(time.Now()); err != nil {
+	if err := q.PurgeOlderThan(time.Now(), nil); err != nil {
 		t.Errorf("Queue.PurgeOlderThan failed: %v", err)
 	}
 
@@ -325,3 +384,141 @@ func TestPurgeQueue(t *testing.T) {
 	}
 
 }
+
+func TestPurgeQueueNotifiesUnread(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping purge queue")
+	}
+
+	dir, err := ioutil.TempDir("", "hh_queue")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newQueue(dir, 1024)
+	if err != nil {
+		t.Fatalf("failed to create queue: %v", err)
+	}
+
+	if err := q.Open(); err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+
+	for _, b := range []string{"one", "two", "three"} {
+		if err := q.Append([]byte(b)); err != nil {
+			t.Fatalf("Queue.Append failed: %v", err)
+		}
+	}
+
+	// "one" has been delivered and must not be reported
+	if err := q.Advance(); err != nil {
+		t.Fatalf("Queue.Advance failed: %v", err)
+	}
+
+	time.Sleep(time.Second)
+
+	var purged []string
+	if err := q.PurgeOlderThan(time.Now(), func(b []byte) {
+		purged = append(purged, string(b))
+	}); err != nil {
+		t.Fatalf("Queue.PurgeOlderThan failed: %v", err)
+	}
+
+	if exp := []string{"two", "three"}; !reflect.DeepEqual(purged, exp) {
+		t.Fatalf("purged blocks mismatch: got %v, exp %v", purged, exp)
+	}
+
+	_, err = q.Current()
+	if err != io.EOF {
+		t.Fatalf("Queue.Current expected io.EOF, got: %v", err)
+	}
+}
+
+func TestQueueEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hh_queue")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	open := func(key string) *queue {
+		q, err := newQueue(dir, 1024)
+		if err != nil {
+			t.Fatalf("failed to create queue: %v", err)
+		}
+		if key != "" {
+			if q.cipher, err = newBlockCipher([]byte(key)); err != nil {
+				t.Fatalf("failed to create cipher: %v", err)
+			}
+		}
+		if err := q.Open(); err != nil {
+			t.Fatalf("failed to open queue: %v", err)
+		}
+		return q
+	}
+
+	// plain blocks appended before encryption is enabled are still read
+	q := open("")
+	if err := q.Append([]byte("plain")); err != nil {
+		t.Fatalf("Queue.Append failed: %v", err)
+	}
+	q.Close()
+
+	q = open("0123456789abcdef")
+	if err := q.AppendBatch([][]byte{[]byte("secret"), []byte("data")}); err != nil {
+		t.Fatalf("Queue.AppendBatch failed: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "1"))
+	if err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(b, []byte("secret")) || !bytes.Contains(b, []byte("plain")) {
+		t.Fatalf("unexpected segment: %q", b)
+	}
+
+	var got []string
+	for {
+		cur, err := q.Current()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Queue.Current failed: %v", err)
+		}
+		got = append(got, string(cur))
+		if len(got) == 2 {
+			break
+		}
+		if err := q.Advance(); err != nil {
+			t.Fatalf("Queue.Advance failed: %v", err)
+		}
+	}
+	if exp := []string{"plain", "secret"}; !reflect.DeepEqual(got, exp) {
+		t.Fatalf("blocks mismatch: got %v, exp %v", got, exp)
+	}
+	q.Close()
+
+	// blocks are kept unread without the key
+	q = open("fedcba9876543210")
+	if _, err := q.Current(); err != ErrQueueEncrypted {
+		t.Fatalf("Queue.Current expected ErrQueueEncrypted, got: %v", err)
+	}
+	q.Close()
+}
+
+func TestDecodeEncryptionKey(t *testing.T) {
+	for _, tc := range []struct {
+		s   string
+		n   int
+		err bool
+	}{
+		{"000102030405060708090a0b0c0d0e0f", 16, false},
+		{"AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=", 32, false},
+		{"0001", 0, true},
+		{"not a key", 0, true},
+	} {
+		key, err := decodeEncryptionKey(tc.s)
+		if (err != nil) != tc.err || len(key) != tc.n {
+			t.Fatalf("decodeEncryptionKey(%q) = %d bytes, %v", tc.s, len(key), err)
+		}
+	}
+}
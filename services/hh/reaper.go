@@ -0,0 +1,108 @@
+package hh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// reapOrphans periodically reclaims queues of nodes removed from meta.
+func (s *Service) reapOrphans() {
+	defer s.wg.Done()
+
+	grace := time.Duration(s.cfg.OrphanGracePeriod)
+	s.Logger.Infof("Reaping hinted handoff queues of nodes absent from meta for %v", grace)
+
+	ticker := time.NewTicker(time.Duration(s.cfg.PurgeInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closing:
+			return
+		case now := <-ticker.C:
+			s.reapOrphansAt(now)
+		}
+	}
+}
+
+// reapOrphansAt archives or purges queues of nodes found absent from meta
+// longer than the orphan grace period before now. Nodes are absent since
+// the first check not finding them.
+func (s *Service) reapOrphansAt(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// forget nodes whose processors are gone, e.g. purged by max-age
+	for id := range s.orphans {
+		if _, ok := s.processors[id]; !ok {
+			delete(s.orphans, id)
+		}
+	}
+
+	grace := time.Duration(s.cfg.OrphanGracePeriod)
+	for id, p := range s.processors {
+		active, err := p.Active()
+		if err != nil {
+			// meta unavailable, that's not a removal
+			continue
+		}
+		if active {
+			delete(s.orphans, id)
+			continue
+		}
+
+		since, ok := s.orphans[id]
+		if !ok {
+			s.Logger.Infof("node %d not found in meta, its queue will be reaped after %v", id, grace)
+			s.orphans[id] = now
+			continue
+		}
+		if now.Sub(since) < grace {
+			continue
+		}
+
+		size, err := dirSize(p.dir)
+		if err != nil {
+			s.Logger.Warnf("failed to determine queue size of node %d: %s", id, err.Error())
+		}
+		if err := p.Close(); err != nil {
+			s.Logger.Warnf("failed to close node processor %d: %s", id, err.Error())
+			continue
+		}
+		if s.cfg.OrphanArchiveDir != "" {
+			dst := filepath.Join(s.cfg.OrphanArchiveDir, fmt.Sprintf("%d-%s", id, now.UTC().Format("20060102T150405Z")))
+			if err := p.Archive(dst); err != nil {
+				s.Logger.Warnf("failed to archive queue of node %d: %s", id, err.Error())
+				continue
+			}
+			s.Logger.Infof("archived queue of node %d absent from meta since %v to %s, reclaimed %d bytes",
+				id, since.UTC(), dst, size)
+		} else {
+			if err := p.Purge(); err != nil {
+				s.Logger.Warnf("failed to purge node processor %d: %s", id, err.Error())
+				continue
+			}
+			s.Logger.Infof("purged queue of node %d absent from meta since %v, reclaimed %d bytes",
+				id, since.UTC(), size)
+		}
+		delete(s.processors, id)
+		delete(s.orphans, id)
+	}
+}
+
+// dirSize returns the size in bytes of files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,88 @@
+package hh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/toml"
+)
+
+func TestService_ReapOrphans(t *testing.T) {
+	for _, archive := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "hh_reaper")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		c := NewConfig()
+		c.Enabled = true
+		c.Dir = filepath.Join(dir, "hh")
+		c.OrphanGracePeriod = toml.Duration(time.Hour)
+		if archive {
+			c.OrphanArchiveDir = filepath.Join(dir, "archive")
+		}
+
+		removed := false
+		m := &fakeMetaStore{NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+			if nodeID == 2 && removed {
+				return nil, imeta.ErrNodeNotFound
+			}
+			return &meta.NodeInfo{ID: nodeID}, nil
+		}}
+		w := &fakeShardWriter{ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error { return nil }}
+		s := NewService(c, w, m)
+		if err := s.Open(); err != nil {
+			t.Fatalf("failed to open service: %v", err)
+		}
+		defer s.Close()
+
+		pt := models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Unix(0, 0))
+		for _, id := range []imeta.NodeID{1, 2} {
+			if err := s.WriteShard(1, id, []models.Point{pt}); err != nil {
+				t.Fatalf("WriteShard() failed: %v", err)
+			}
+		}
+
+		now := time.Now()
+		s.reapOrphansAt(now)
+		if len(s.orphans) != 0 {
+			t.Fatalf("unexpected orphans %v", s.orphans)
+		}
+
+		// node 2 is back in grace period
+		removed = true
+		s.reapOrphansAt(now)
+		removed = false
+		s.reapOrphansAt(now.Add(time.Minute))
+		removed = true
+		s.reapOrphansAt(now.Add(2 * time.Minute))
+		s.reapOrphansAt(now.Add(time.Hour))
+		if _, ok := s.processors[2]; !ok {
+			t.Fatalf("queue of node 2 reaped in grace period")
+		}
+
+		s.reapOrphansAt(now.Add(time.Hour + 2*time.Minute))
+		if _, ok := s.processors[2]; ok {
+			t.Fatalf("queue of node 2 not reaped")
+		}
+		if _, ok := s.processors[1]; !ok {
+			t.Fatalf("queue of node 1 reaped")
+		}
+		if _, err := os.Stat(s.pathforNode(2)); !os.IsNotExist(err) {
+			t.Fatalf("queue dir of node 2 still exists: %v", err)
+		}
+		if archive {
+			files, err := ioutil.ReadDir(c.OrphanArchiveDir)
+			if err != nil || len(files) != 1 {
+				t.Fatalf("queue of node 2 not archived: %v %v", files, err)
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package hh // import "github.com/influxdata/influxdb/services/hh"
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -11,6 +12,8 @@ import (
 
 	"sync/atomic"
 
+	"github.com/angopher/chronus/errs"
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/monitor/diagnostics"
 	"github.com/influxdata/influxdb/services/meta"
@@ -19,7 +22,7 @@ import (
 
 // ErrHintedHandoffDisabled is returned when attempting to use a
 // disabled hinted handoff service.
-var ErrHintedHandoffDisabled = fmt.Errorf("hinted handoff disabled")
+var ErrHintedHandoffDisabled = errs.ErrHintedHandoffDisabled
 
 const (
 	writeShardReq       = "writeShardReq"
@@ -33,31 +36,97 @@ type Service struct {
 	closing chan struct{}
 
 	processors map[uint64]*NodeProcessor
+	// first time nodes of processors were found absent from meta
+	orphans map[uint64]time.Time
 
 	Logger *zap.SugaredLogger
 	cfg    Config
 
 	shardWriter shardWriter
-	MetaClient  metaClient
+	MetaClient  MetaClient
+	// Features enabled on this node by the cluster config
+	Features *imeta.FeatureFlags
+	// ShardCutovers holds writes of shards in the cutover of their moves,
+	// optional
+	ShardCutovers ShardCutovers
+	// StaleShards marks shards whose hinted data is purged unsent stale,
+	// optional
+	StaleShards StaleShards
+	// ShardOwners resolves databases of shards for DatabaseMaxAges of the
+	// config, which don't apply without it
+	ShardOwners ShardOwners
+	// DroppedMeasurements skips hinted points of measurements dropped since,
+	// optional
+	DroppedMeasurements DroppedMeasurements
 
 	Monitor interface {
 		RegisterDiagnosticsClient(name string, client diagnostics.Client)
 		DeregisterDiagnosticsClient(name string)
 	}
 
+	// PointsWriter is used to write the lag of node queues
+	PointsWriter interface {
+		WritePoints(database, retentionPolicy string, points models.Points) error
+	}
+
 	stats *HHStatistics
+
+	encryptionKey []byte
 }
 
 type shardWriter interface {
-	WriteShard(shardID, ownerID uint64, points []models.Point) error
+	WriteShard(shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error
+}
+
+// retryable is implemented by errors of shardWriter telling whether the write
+// may succeed later, see coordinator.RPCError.
+type retryable interface {
+	Retryable() bool
+}
+
+// isPermanent tells if err is never fixed by retrying, errors not classified
+// are retried.
+func isPermanent(err error) bool {
+	var r retryable
+	return errors.As(err, &r) && !r.Retryable()
+}
+
+// ShardCutovers is the part of imeta.MetaClient telling shards in cutover.
+type ShardCutovers interface {
+	ShardCutover(id uint64) *imeta.ShardCutover
+}
+
+// StaleShards is the part of imeta.MetaClient marking shards of nodes stale.
+type StaleShards interface {
+	MarkShardsStale(nodeID uint64, shardIDs []uint64) error
+}
+
+// ShardOwners is the part of imeta.MetaClient resolving databases of shards.
+type ShardOwners interface {
+	ShardOwner(id uint64) (database, policy string, sgi *meta.ShardGroupInfo)
+}
+
+// DroppedMeasurements is the part of imeta.MetaClient telling measurements
+// dropped.
+type DroppedMeasurements interface {
+	MeasurementDroppedAfter(database, name string, t time.Time) bool
 }
 
-type metaClient interface {
+// MetaClient is the part of imeta.MetaClient used by hinted handoff.
+type MetaClient interface {
 	DataNode(id uint64) (ni *meta.NodeInfo, err error)
 }
 
+var (
+	_ MetaClient          = imeta.MetaClient(nil)
+	_ ShardCutovers       = imeta.MetaClient(nil)
+	_ StaleShards         = imeta.MetaClient(nil)
+	_ ShardOwners         = imeta.MetaClient(nil)
+	_ DroppedMeasurements = imeta.MetaClient(nil)
+)
+
 // NewService returns a new instance of Service.
-func NewService(c Config, w shardWriter, m metaClient) *Service {
+func NewService(c Config, w shardWriter, m MetaClient) *Service {
 	//key := strings.Join([]string{"hh", c.Dir}, ":")
 	//tags := map[string]string{"path": c.Dir}
 	SetMaxActiveProcessorCount(c.RetryConcurrency)
@@ -66,6 +135,7 @@ func NewService(c Config, w shardWriter, m metaClient) *Service {
 		cfg:         c,
 		closing:     make(chan struct{}),
 		processors:  make(map[uint64]*NodeProcessor),
+		orphans:     make(map[uint64]time.Time),
 		Logger:      zap.NewNop().Sugar(),
 		shardWriter: w,
 		MetaClient:  m,
@@ -82,6 +152,25 @@ func (s *Service) createProcessor(nodeID uint64) *NodeProcessor {
 	n.RetryInterval = time.Duration(s.cfg.RetryInterval)
 	n.RetryMaxInterval = time.Duration(s.cfg.RetryMaxInterval)
 	n.RetryRateLimit = int(s.cfg.RetryRateLimit)
+	n.RetryRateWindows = s.cfg.RetryRateWindows
+	n.PurgeNotifyURL = s.cfg.PurgeNotifyURL
+	n.WriteThroughWindow = time.Duration(s.cfg.WriteThroughWindow)
+	n.WriteThroughBufferSize = s.cfg.WriteThroughBufferSize
+	n.AdvanceFailureThreshold = s.cfg.AdvanceFailureThreshold
+	n.BlockWritesWhenUnhealthy = s.cfg.BlockWritesWhenUnhealthy
+	n.Features = s.Features
+	n.ShardCutovers = s.ShardCutovers
+	n.StaleShards = s.StaleShards
+	if s.cfg.MaxAge > 0 {
+		n.MaxAge = time.Duration(s.cfg.MaxAge)
+	}
+	n.DatabaseMaxAges = s.cfg.databaseMaxAges()
+	n.ShardOwners = s.ShardOwners
+	n.DroppedMeasurements = s.DroppedMeasurements
+	n.AppendBatchDelay = time.Duration(s.cfg.AppendBatchDelay)
+	n.AppendBatchSize = s.cfg.AppendBatchSize
+	n.EncryptionKey = s.encryptionKey
+	n.QueueBackend = s.cfg.QueueBackend
 	n.WithLogger(s.Logger.Desugar())
 	return n
 }
@@ -102,6 +191,15 @@ func (s *Service) Open() error {
 		s.Monitor.RegisterDiagnosticsClient("hh", s)
 	}
 
+	key, err := loadEncryptionKey(s.cfg.EncryptionKeyFile, s.cfg.EncryptionKeyCommand)
+	if err != nil {
+		return err
+	}
+	s.encryptionKey = key
+	if key != nil {
+		s.Logger.Info("Encrypting queues on disk")
+	}
+
 	// Create the root directory if it doesn't already exist.
 	s.Logger.Infof("Using data dir: %v", s.cfg.Dir)
 	if err := os.MkdirAll(s.cfg.Dir, 0700); err != nil {
@@ -131,6 +229,16 @@ func (s *Service) Open() error {
 	s.wg.Add(1)
 	go s.purgeInactiveProcessors()
 
+	if s.cfg.OrphanGracePeriod > 0 {
+		s.wg.Add(1)
+		go s.reapOrphans()
+	}
+
+	if s.cfg.LagReportInterval > 0 && s.PointsWriter != nil {
+		s.wg.Add(1)
+		go s.reportLag()
+	}
+
 	return nil
 }
 
@@ -182,34 +290,16 @@ func (s *Service) Statistics(tags map[string]string) []models.Statistic {
 }
 
 // WriteShard queues the points write for shardID to node ownerID to handoff queue
-func (s *Service) WriteShard(shardID, ownerID uint64, points []models.Point) error {
+func (s *Service) WriteShard(shardID imeta.ShardID, ownerID imeta.NodeID, points []models.Point) error {
 	if !s.cfg.Enabled {
 		return ErrHintedHandoffDisabled
 	}
 	atomic.AddInt64(&s.stats.WriteShardReq, 1)
 	atomic.AddInt64(&s.stats.WriteShardReqPoints, int64(len(points)))
 
-	s.mu.RLock()
-	processor, ok := s.processors[ownerID]
-	s.mu.RUnlock()
-	if !ok {
-		if err := func() error {
-			// Check again under write-lock.
-			s.mu.Lock()
-			defer s.mu.Unlock()
-
-			processor, ok = s.processors[ownerID]
-			if !ok {
-				processor = s.createProcessor(ownerID)
-				if err := processor.Open(); err != nil {
-					return err
-				}
-				s.processors[ownerID] = processor
-			}
-			return nil
-		}(); err != nil {
-			return err
-		}
+	processor, err := s.processor(uint64(ownerID))
+	if err != nil {
+		return err
 	}
 
 	if err := processor.WriteShard(shardID, points); err != nil {
@@ -219,13 +309,68 @@ func (s *Service) WriteShard(shardID, ownerID uint64, points []models.Point) err
 	return nil
 }
 
+// processor returns the processor of nodeID, created if the node has
+// nothing queued yet.
+func (s *Service) processor(nodeID uint64) (*NodeProcessor, error) {
+	s.mu.RLock()
+	processor, ok := s.processors[nodeID]
+	s.mu.RUnlock()
+	if ok {
+		return processor, nil
+	}
+
+	// Check again under write-lock.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	processor, ok = s.processors[nodeID]
+	if !ok {
+		processor = s.createProcessor(nodeID)
+		if err := processor.Open(); err != nil {
+			return nil, err
+		}
+		s.processors[nodeID] = processor
+	}
+	return processor, nil
+}
+
+// PurgeNodeBefore drops hinted data queued for node in segments last
+// modified before t, without waiting for MaxAge.
+func (s *Service) PurgeNodeBefore(nodeID uint64, t time.Time) (*PurgeEvent, error) {
+	return s.purgeNode(nodeID, PurgeReasonBefore, func(n *NodeProcessor) (*PurgeEvent, error) {
+		return n.PurgeBefore(t)
+	})
+}
+
+// PurgeShard drops hinted data of shard queued for node, e.g. of a shard or a
+// database decommissioned.
+func (s *Service) PurgeShard(nodeID, shardID uint64) (*PurgeEvent, error) {
+	return s.purgeNode(nodeID, PurgeReasonShard, func(n *NodeProcessor) (*PurgeEvent, error) {
+		return n.PurgeShard(shardID)
+	})
+}
+
+func (s *Service) purgeNode(nodeID uint64, reason string, fn func(n *NodeProcessor) (*PurgeEvent, error)) (*PurgeEvent, error) {
+	if !s.cfg.Enabled {
+		return nil, ErrHintedHandoffDisabled
+	}
+	s.mu.RLock()
+	processor, ok := s.processors[nodeID]
+	s.mu.RUnlock()
+	if !ok {
+		// nothing queued for the node
+		return newPurgeEvent(nodeID, reason), nil
+	}
+	return fn(processor)
+}
+
 // Diagnostics returns diagnostic information.
 func (s *Service) Diagnostics() (*diagnostics.Diagnostics, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	d := &diagnostics.Diagnostics{
-		Columns: []string{"node", "active", "last modified", "head", "tail"},
+		Columns: []string{"node", "active", "healthy", "last modified", "head", "tail"},
 		Rows:    make([][]interface{}, 0, len(s.processors)),
 	}
 
@@ -240,7 +385,7 @@ func (s *Service) Diagnostics() (*diagnostics.Diagnostics, error) {
 			return nil, err
 		}
 
-		d.Rows = append(d.Rows, []interface{}{k, active, lm, v.Head(), v.Tail()})
+		d.Rows = append(d.Rows, []interface{}{k, active, v.Healthy(), lm, v.Head(), v.Tail()})
 	}
 	return d, nil
 }
@@ -277,7 +422,7 @@ func (s *Service) purgeInactiveProcessors() {
 						continue
 					}
 
-					if !lm.Before(time.Now().Add(-time.Duration(s.cfg.MaxAge))) {
+					if !lm.Before(time.Now().Add(-s.cfg.longestMaxAge())) {
 						// Node processor contains too-young data.
 						continue
 					}
@@ -0,0 +1,230 @@
+package hh
+
+import (
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/angopher/chronus/errs"
+)
+
+// ErrQueueInUse is returned when replaying the directory of a queue in use.
+var ErrQueueInUse = errs.ErrQueueInUse
+
+// ErrNoQueueData is returned when replaying a directory without a queue.
+var ErrNoQueueData = errs.ErrNoQueueData
+
+// Transfer hands the blocks queued for the node to fn one by one from the head,
+// advancing past each block once fn returns, until the queue is drained or fn
+// fails. fn should return once the block is stored durably elsewhere, so that
+// blocks not handed over stay queued and a transfer interrupted resumes where
+// it stopped. Writes held in memory are queued first.
+func (n *NodeProcessor) Transfer(fn func(b []byte) error) (blocks int, bytes int64, err error) {
+	if err := n.spillQueued(); err != nil {
+		return 0, 0, err
+	}
+	for {
+		size, err := n.transferBlock(fn)
+		if err == io.EOF {
+			return blocks, bytes, nil
+		} else if err != nil {
+			return blocks, bytes, err
+		}
+		blocks++
+		bytes += int64(size)
+	}
+}
+
+func (n *NodeProcessor) spillQueued() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.done == nil {
+		return errs.ErrNodeProcessorClosed
+	}
+	return n.spill()
+}
+
+// transferBlock hands the block at the head of queue to fn, returning its size.
+// fn is called without the lock, so that sending and writes to the queue go on
+// meanwhile. The head is advanced past only if it's still the block handed
+// over, i.e. it was not sent or purged meanwhile, in which case the block is
+// delivered twice rather than the next one lost.
+func (n *NodeProcessor) transferBlock(fn func(b []byte) error) (int, error) {
+	b, head, err := n.current()
+	if err != nil {
+		return 0, err
+	}
+	if err := fn(b); err != nil {
+		return 0, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.done == nil {
+		return 0, errs.ErrNodeProcessorClosed
+	}
+	qp, err := n.queue.Position()
+	if err != nil {
+		return 0, err
+	}
+	if qp.head != head {
+		return len(b), nil
+	}
+	return len(b), n.advance()
+}
+
+// current returns the block at the head of queue along with its position.
+func (n *NodeProcessor) current() ([]byte, string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.done == nil {
+		return nil, "", errs.ErrNodeProcessorClosed
+	}
+	qp, err := n.queue.Position()
+	if err != nil {
+		return nil, "", err
+	}
+	b, err := n.queue.Current()
+	if err != nil {
+		return nil, "", err
+	}
+	return b, qp.head, nil
+}
+
+// Import appends block b, of a queue of another node for the node, to the
+// queue.
+func (n *NodeProcessor) Import(b []byte) error {
+	if _, _, err := unmarshalWrite(b); err != nil {
+		return err
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	if n.done == nil {
+		return errs.ErrNodeProcessorClosed
+	}
+	return n.queue.Append(b)
+}
+
+// Nodes returns the IDs of nodes having a queue, in order.
+func (s *Service) Nodes() []uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	nodes := make([]uint64, 0, len(s.processors))
+	for id := range s.processors {
+		nodes = append(nodes, id)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	return nodes
+}
+
+// TransferNode hands the blocks queued for node to fn, see
+// NodeProcessor.Transfer, e.g. to move them to the queue of another coordinator
+// before this one is removed.
+func (s *Service) TransferNode(nodeID uint64, fn func(b []byte) error) (int, int64, error) {
+	if !s.cfg.Enabled {
+		return 0, 0, ErrHintedHandoffDisabled
+	}
+	s.mu.RLock()
+	processor, ok := s.processors[nodeID]
+	s.mu.RUnlock()
+	if !ok {
+		// nothing queued for the node
+		return 0, 0, nil
+	}
+	return processor.Transfer(fn)
+}
+
+// Import appends block b, transferred from the queue of another coordinator,
+// to the queue of node.
+func (s *Service) Import(nodeID uint64, b []byte) error {
+	if !s.cfg.Enabled {
+		return ErrHintedHandoffDisabled
+	}
+	processor, err := s.processor(nodeID)
+	if err != nil {
+		return err
+	}
+	return processor.Import(b)
+}
+
+// Replay moves the blocks of the queue stored in dir, e.g. the queue directory
+// of node copied from a coordinator removed, to the queue of node. Blocks are
+// advanced past in dir once queued, so a replay interrupted resumes where it
+// stopped. Queues are read with the encryption key of the service.
+func (s *Service) Replay(nodeID uint64, dir string) (int, error) {
+	if !s.cfg.Enabled {
+		return 0, ErrHintedHandoffDisabled
+	}
+	if inDir(dir, s.cfg.Dir) {
+		return 0, ErrQueueInUse
+	}
+
+	var cipher *blockCipher
+	if len(s.encryptionKey) > 0 {
+		var err error
+		if cipher, err = newBlockCipher(s.encryptionKey); err != nil {
+			return 0, err
+		}
+	}
+	var from blockQueue
+	for _, backend := range []string{QueueBackendSegment, QueueBackendBadger} {
+		ok, err := hasQueueData(backend, dir)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			if from, err = newBlockQueue(backend, dir, s.cfg.MaxSize, cipher); err != nil {
+				return 0, err
+			}
+			break
+		}
+	}
+	if from == nil {
+		return 0, ErrNoQueueData
+	}
+	if err := from.Open(); err != nil {
+		return 0, err
+	}
+	defer from.Close()
+
+	processor, err := s.processor(nodeID)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for {
+		b, err := from.Current()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		if err := processor.Import(b); err != nil {
+			return n, err
+		}
+		if err := from.Advance(); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// inDir tells whether path is dir or in it.
+func inDir(path, dir string) bool {
+	p, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	d, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(d, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
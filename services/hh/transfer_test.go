@@ -0,0 +1,187 @@
+package hh
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+func TestService_TransferAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hh_transfer")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// nodes are down, writes stay queued
+	m := &fakeMetaStore{NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+		return nil, nil
+	}}
+	var mu sync.Mutex
+	written := make(map[uint64]int)
+	w := &fakeShardWriter{ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+		mu.Lock()
+		defer mu.Unlock()
+		written[shardID] += len(points)
+		return nil
+	}}
+	newService := func(name string) *Service {
+		c := NewConfig()
+		c.Enabled = true
+		c.Dir = filepath.Join(dir, name)
+		s := NewService(c, w, m)
+		if err := s.Open(); err != nil {
+			t.Fatalf("failed to open service: %v", err)
+		}
+		return s
+	}
+	src, dst := newService("src"), newService("dst")
+	defer dst.Close()
+
+	pt := models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Unix(0, 0))
+	for shardID := imeta.ShardID(1); shardID <= 3; shardID++ {
+		if err := src.WriteShard(shardID, 2, []models.Point{pt}); err != nil {
+			t.Fatalf("WriteShard() failed: %v", err)
+		}
+	}
+	if nodes := src.Nodes(); len(nodes) != 1 || nodes[0] != 2 {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+
+	// blocks failed to transfer stay queued, and a rerun resumes
+	var handed int
+	blocks, _, err := src.TransferNode(2, func(b []byte) error {
+		if handed == 1 {
+			return errors.New("connection reset")
+		}
+		handed++
+		return dst.Import(2, b)
+	})
+	if err == nil || blocks != 1 {
+		t.Fatalf("unexpected transfer of %d blocks: %v", blocks, err)
+	}
+	blocks, bytes, err := src.TransferNode(2, func(b []byte) error {
+		return dst.Import(2, b)
+	})
+	if err != nil || blocks != 2 || bytes == 0 {
+		t.Fatalf("unexpected transfer of %d blocks, %d bytes: %v", blocks, bytes, err)
+	}
+	if blocks, _, err := src.TransferNode(2, func(b []byte) error { return nil }); err != nil || blocks != 0 {
+		t.Fatalf("unexpected transfer of drained queue, %d blocks: %v", blocks, err)
+	}
+	if blocks, _, err := src.TransferNode(3, func(b []byte) error { return nil }); err != nil || blocks != 0 {
+		t.Fatalf("unexpected transfer of node without queue, %d blocks: %v", blocks, err)
+	}
+	if err := dst.Import(2, []byte{1}); err == nil {
+		t.Fatalf("block not of a write imported")
+	}
+
+	// a queue directory copied from a coordinator is replayed
+	if err := src.WriteShard(4, 5, []models.Point{pt}); err != nil {
+		t.Fatalf("WriteShard() failed: %v", err)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("failed to close service: %v", err)
+	}
+	if _, err := dst.Replay(5, dst.pathforNode(2)); err != ErrQueueInUse {
+		t.Fatalf("unexpected error replaying queue in use: %v", err)
+	}
+	if _, err := dst.Replay(5, dir); err != ErrNoQueueData {
+		t.Fatalf("unexpected error replaying directory without queue: %v", err)
+	}
+	if n, err := dst.Replay(5, src.pathforNode(5)); err != nil || n != 1 {
+		t.Fatalf("unexpected replay of %d blocks: %v", n, err)
+	}
+	if n, err := dst.Replay(5, src.pathforNode(5)); err != nil || n != 0 {
+		t.Fatalf("unexpected replay of %d blocks again: %v", n, err)
+	}
+
+	// the nodes are up, queues of dst are sent
+	m.NodeFn = func(nodeID uint64) (*meta.NodeInfo, error) {
+		return &meta.NodeInfo{ID: nodeID}, nil
+	}
+	for _, id := range []uint64{2, 5} {
+		p := dst.processors[id]
+		for {
+			if _, err := p.SendWrite(); err != nil {
+				break
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for shardID := uint64(1); shardID <= 4; shardID++ {
+		if written[shardID] != 1 {
+			t.Fatalf("unexpected writes of shard %d: %v", shardID, written)
+		}
+	}
+}
+
+func TestNodeProcessorTransferConcurrentSend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hh_transfer")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var sent []uint64
+	w := &fakeShardWriter{ShardWriteFn: func(shardID, nodeID uint64, points []models.Point) error {
+		sent = append(sent, shardID)
+		return nil
+	}}
+	m := &fakeMetaStore{NodeFn: func(nodeID uint64) (*meta.NodeInfo, error) {
+		return &meta.NodeInfo{ID: nodeID}, nil
+	}}
+	n := NewNodeProcessor(2, dir, w, m)
+	n.RetryInterval = time.Hour
+	n.RetryMaxInterval = time.Hour
+	if err := n.Open(); err != nil {
+		t.Fatalf("failed to open node processor: %v", err)
+	}
+	defer n.Close()
+
+	pt := models.MustNewPoint("cpu", nil, models.Fields{"value": 1.0}, time.Unix(0, 0))
+	for shardID := uint64(1); shardID <= 3; shardID++ {
+		if err := n.queue.Append(marshalWrite(shardID, []models.Point{pt}, time.Now())); err != nil {
+			t.Fatalf("Append() failed: %v", err)
+		}
+	}
+
+	// the first block is sent while handed over, the next one is not skipped
+	var handed []uint64
+	blocks, _, err := n.Transfer(func(b []byte) error {
+		shardID, _, err := unmarshalWrite(b)
+		if err != nil {
+			return err
+		}
+		if len(handed) == 0 {
+			if _, err := n.SendWrite(); err != nil {
+				return err
+			}
+		}
+		handed = append(handed, shardID)
+		return nil
+	})
+	if err != nil || blocks != 3 {
+		t.Fatalf("unexpected transfer of %d blocks: %v", blocks, err)
+	}
+	if exp := []uint64{1, 2, 3}; !reflect.DeepEqual(handed, exp) {
+		t.Fatalf("blocks handed over mismatch: got %v, exp %v", handed, exp)
+	}
+	if exp := []uint64{1}; !reflect.DeepEqual(sent, exp) {
+		t.Fatalf("blocks sent mismatch: got %v, exp %v", sent, exp)
+	}
+	if _, err := n.queue.Current(); err != io.EOF {
+		t.Fatalf("queue not drained: %v", err)
+	}
+}
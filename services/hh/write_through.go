@@ -0,0 +1,155 @@
+package hh
+
+import (
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+var (
+	// writeThroughRetryInterval is the interval between direct retries of the
+	// writes buffered in memory.
+	writeThroughRetryInterval = 500 * time.Millisecond
+)
+
+type bufferedWrite struct {
+	shardID    uint64
+	points     []models.Point
+	size       int64
+	bufferedAt time.Time
+}
+
+// writeThroughBuffer holds the failed writes of a node in memory during the
+// write-through window which starts from the first failure of an outage.
+type writeThroughBuffer struct {
+	mu       sync.Mutex
+	window   time.Duration
+	maxSize  int64
+	failedAt time.Time
+	size     int64
+	writes   []*bufferedWrite
+	// sending is the oldest write while it's retried, kept by drain
+	sending *bufferedWrite
+	// spilled tells the writes of the outage were drained into the queue
+	spilled bool
+}
+
+func newWriteThroughBuffer(window time.Duration, maxSize int64) *writeThroughBuffer {
+	return &writeThroughBuffer{
+		window:  window,
+		maxSize: maxSize,
+	}
+}
+
+func writeSize(points []models.Point) int64 {
+	var sz int64
+	for _, p := range points {
+		sz += int64(p.StringSize()) + 1
+	}
+	return sz
+}
+
+// add buffers the write if it's still in the window and the buffer has room.
+func (b *writeThroughBuffer) add(shardID uint64, points []models.Point, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failedAt.IsZero() {
+		b.failedAt = now
+	}
+	if now.Sub(b.failedAt) >= b.window {
+		return false
+	}
+
+	sz := writeSize(points)
+	if b.size+sz > b.maxSize {
+		return false
+	}
+	b.writes = append(b.writes, &bufferedWrite{shardID: shardID, points: points, size: sz, bufferedAt: now})
+	b.size += sz
+	return true
+}
+
+// head returns the oldest write buffered
+func (b *writeThroughBuffer) head() *bufferedWrite {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.writes) == 0 {
+		return nil
+	}
+	return b.writes[0]
+}
+
+// next returns the oldest write buffered to be retried. It's kept in the
+// buffer until done, even if the buffer is drained meanwhile, so that it's
+// neither lost nor queued again while it's sent.
+func (b *writeThroughBuffer) next() *bufferedWrite {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.writes) == 0 {
+		return nil
+	}
+	b.sending = b.writes[0]
+	return b.sending
+}
+
+// done ends retrying w, removing it if delivered or dropped. The outage is
+// considered over once all the buffered writes are delivered, unless some
+// were queued.
+func (b *writeThroughBuffer) done(w *bufferedWrite, remove bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sending = nil
+	if !remove || len(b.writes) == 0 || b.writes[0] != w {
+		return
+	}
+	b.size -= w.size
+	b.writes[0] = nil
+	b.writes = b.writes[1:]
+	if len(b.writes) == 0 && !b.spilled {
+		b.failedAt = time.Time{}
+	}
+}
+
+// expired returns whether the window of current outage has passed
+func (b *writeThroughBuffer) expired(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.failedAt.IsZero() && now.Sub(b.failedAt) >= b.window
+}
+
+// drain removes and returns all the writes buffered but keeps the outage
+// state so that following writes go to the queue directly.
+func (b *writeThroughBuffer) drain() []*bufferedWrite {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	writes := b.writes
+	b.writes = nil
+	b.size = 0
+	b.spilled = true
+	if len(writes) > 0 && writes[0] == b.sending {
+		// queued once done if not delivered
+		b.writes = writes[:1:1]
+		b.size = b.sending.size
+		writes = writes[1:]
+	}
+	return writes
+}
+
+// bytes returns the size of writes buffered
+func (b *writeThroughBuffer) bytes() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// reset marks the end of an outage
+func (b *writeThroughBuffer) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.writes) == 0 {
+		b.failedAt = time.Time{}
+		b.spilled = false
+	}
+}
@@ -0,0 +1,98 @@
+package httpd
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/influxdata/influxdb/services/meta"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// auth authenticates requests served in front of the influxdb handler like it
+// does, along with api and session tokens.
+type auth struct {
+	metaClient  MetaClient
+	authEnabled bool
+}
+
+// adminOnly serves next for admin users only if authentication is enabled.
+func (a *auth) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.authorizeAdmin(w, r) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// authorizeAdmin tells whether r is by an admin user if authentication is
+// enabled, writing the error otherwise.
+func (a *auth) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !a.authEnabled {
+		return true
+	}
+	u, err := a.authenticate(r)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusUnauthorized)
+		return false
+	} else if !u.AuthorizeUnrestricted() {
+		httpError(w, "admin user required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizeOperator tells whether the user of r is an admin or one of an
+// operator role allowing role, writing the error if not.
+func (a *auth) authorizeOperator(w http.ResponseWriter, r *http.Request, role imeta.OperatorRole) bool {
+	if !a.authEnabled {
+		return true
+	}
+	u, err := a.authenticate(r)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusUnauthorized)
+		return false
+	} else if !u.AuthorizeUnrestricted() && !a.metaClient.UserOperatorRole(u.ID()).Allows(role) {
+		httpError(w, "operator role "+string(role)+" required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authenticate returns the user of the credentials of r like the influxdb
+// handler takes them, i.e. basic auth, u and p query parameters or
+// `Authorization: Token <user>:<password>`, or the user of its api or session
+// token.
+func (a *auth) authenticate(r *http.Request) (meta.User, error) {
+	if username, password, ok := r.BasicAuth(); ok {
+		return a.authenticateUser(username, password)
+	}
+	if q := r.URL.Query(); q.Get("u") != "" {
+		return a.authenticateUser(q.Get("u"), q.Get("p"))
+	}
+	auth := r.Header.Get("Authorization")
+	if creds := strings.TrimPrefix(auth, "Token "); creds != auth && strings.Contains(creds, ":") {
+		parts := strings.SplitN(creds, ":", 2)
+		return a.authenticateUser(parts[0], parts[1])
+	}
+	token := requestToken(r)
+	if token == "" {
+		return nil, meta.ErrAuthenticate
+	}
+	if u, err := a.metaClient.AuthenticateToken(token); err == nil {
+		return u, nil
+	}
+	return a.metaClient.AuthenticateSession(token)
+}
+
+// authenticateUser authenticates username by password, or by an api or
+// session token of the user given as password like tokenMetaClient does.
+func (a *auth) authenticateUser(username, password string) (meta.User, error) {
+	if u, err := a.metaClient.AuthenticateToken(password); err == nil && u.ID() == username {
+		return u, nil
+	}
+	if u, err := a.metaClient.AuthenticateSession(password); err == nil && u.ID() == username {
+		return u, nil
+	}
+	return a.metaClient.Authenticate(username, password)
+}
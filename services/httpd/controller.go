@@ -0,0 +1,105 @@
+package httpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/services/controller"
+)
+
+// Controller serves requests of the controller of the node in process.
+type Controller interface {
+	Do(reqTyp controller.RequestType, respTyp controller.ResponseType, req, resp interface{}) error
+}
+
+// OpenAPIPath is the path of the OpenAPI definition of the controller API.
+const OpenAPIPath = controller.APIPrefix + "/openapi.json"
+
+// maxControllerBody limits request bodies of the controller API.
+const maxControllerBody = 1 << 20
+
+// failedResponse is the response of a controller request failed.
+type failedResponse interface {
+	Err() error
+}
+
+// controllerHandler serves operations of the controller API, for admin users
+// or users of the operator role of operations if authentication is enabled.
+// Responses are the ones of the controller, of the status of the kind of
+// error if failed.
+type controllerHandler struct {
+	auth
+	controller Controller
+	version    string
+}
+
+func (h *controllerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == OpenAPIPath {
+		b, err := controller.OpenAPI(h.version)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, controller.APIPrefix)
+	var op *controller.Operation
+	var allow []string
+	for i := range controller.Operations {
+		if o := &controller.Operations[i]; o.Path == path {
+			allow = append(allow, o.Method)
+			if o.Method == r.Method {
+				op = o
+			}
+		}
+	}
+	if len(allow) == 0 {
+		httpError(w, "unknown operation", http.StatusNotFound)
+		return
+	} else if op == nil {
+		sort.Strings(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeOperator(w, r, op.Role) {
+		return
+	}
+
+	var req interface{} = struct{}{}
+	if op.RequestBody != nil {
+		req = reflect.New(op.RequestBody).Interface()
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxControllerBody))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(req); err != nil {
+			httpError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	resp := reflect.New(op.ResponseBody).Interface()
+	if err := h.controller.Do(op.Request, op.Response, req, resp); err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if f, ok := resp.(failedResponse); ok {
+		if err := f.Err(); err != nil {
+			w.Header().Set("X-Influxdb-Error", err.Error())
+			w.WriteHeader(errs.HTTPStatus(err))
+		}
+	}
+	w.Write(b)
+}
@@ -0,0 +1,117 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/angopher/chronus/errs"
+	"github.com/angopher/chronus/services/controller"
+	"github.com/angopher/chronus/services/controller/client"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+type fakeController struct {
+	reqTyp controller.RequestType
+	req    interface{}
+}
+
+func (c *fakeController) Do(reqTyp controller.RequestType, respTyp controller.ResponseType, req, resp interface{}) error {
+	c.reqTyp, c.req = reqTyp, req
+	switch r := resp.(type) {
+	case *controller.ShowDataNodesResponse:
+		r.DataNodes = []controller.DataNode{{ID: 1, TcpAddr: "127.0.0.1:8088"}}
+	case *controller.RemoveShardResponse:
+		r.Code, r.Msg, r.Kind = 1, "shard not found", errs.KindNotFound.String()
+	}
+	return nil
+}
+
+func TestV2Handler_Controller(t *testing.T) {
+	ctl := &fakeController{}
+	mc := &fakeMetaClient{roles: make(map[string]imeta.OperatorRole)}
+	s := newTestService(mc, false)
+	s.Controller = ctl
+	s.Handler.Version = "1.0"
+	h := s.handler(http.NotFoundHandler())
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	c := client.New(srv.URL)
+	ctx := context.Background()
+
+	nodes, err := c.ShowDataNodes(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, controller.RequestShowDataNodes, ctl.reqTyp)
+	assert.Equal(t, uint64(1), nodes.DataNodes[0].ID)
+
+	_, err = c.CopyShard(ctx, &controller.CopyShardRequest{ShardID: 3, SourceNodeAddr: "127.0.0.1:8088", DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, controller.RequestCopyShard, ctl.reqTyp)
+	assert.Equal(t, &controller.CopyShardRequest{ShardID: 3, SourceNodeAddr: "127.0.0.1:8088", DryRun: true}, ctl.req)
+
+	// failures are of the kind of the controller error
+	_, err = c.RemoveShard(ctx, &controller.RemoveShardRequest{ShardID: 3})
+	assert.True(t, errs.Is(err, errs.KindNotFound))
+	assert.Equal(t, "shard not found", err.Error())
+
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+	w := serve("POST", "/api/v1/shards/remove", `{"shard_id": 3}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("POST", "/api/v1/shards/copy", `{"shard": 3}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve("DELETE", "/api/v1/shards/copy", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, POST", w.Header().Get("Allow"))
+	w = serve("GET", "/api/v1/unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// the definition lists every operation
+	w = serve("GET", OpenAPIPath, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var doc struct {
+		Info  map[string]string                     `json:"info"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "1.0", doc.Info["version"])
+	for _, op := range controller.Operations {
+		assert.Contains(t, doc.Paths[controller.APIPrefix+op.Path], strings.ToLower(op.Method), op.Name)
+	}
+
+	// admin users or users of operator roles only if authentication is enabled
+	s.config.AuthEnabled = true
+	authed := httptest.NewServer(s.handler(http.NotFoundHandler()))
+	defer authed.Close()
+	c = client.New(authed.URL)
+	_, err = c.ShowDataNodes(ctx)
+	assert.True(t, errs.Is(err, errs.KindUnauthorized))
+	c.Username, c.Password = "u0", "p0"
+	_, err = c.ShowDataNodes(ctx)
+	assert.True(t, errs.Is(err, errs.KindForbidden))
+
+	copyShard := &controller.CopyShardRequest{ShardID: 3, SourceNodeAddr: "127.0.0.1:8088", DryRun: true}
+	mc.roles["u0"] = imeta.OperatorRoleViewer
+	_, err = c.ShowDataNodes(ctx)
+	assert.Nil(t, err)
+	_, err = c.CopyShard(ctx, copyShard)
+	assert.True(t, errs.Is(err, errs.KindForbidden))
+
+	mc.roles["u0"] = imeta.OperatorRoleOperator
+	_, err = c.CopyShard(ctx, copyShard)
+	assert.Nil(t, err)
+	_, err = c.RemoveShard(ctx, &controller.RemoveShardRequest{ShardID: 3})
+	assert.True(t, errs.Is(err, errs.KindForbidden))
+
+	mc.roles["u0"] = imeta.OperatorRoleAdmin
+	_, err = c.RemoveShard(ctx, &controller.RemoveShardRequest{ShardID: 3})
+	assert.True(t, errs.Is(err, errs.KindNotFound))
+}
@@ -0,0 +1,116 @@
+// Package httpd serves the influxdb HTTP API along with the InfluxDB 2.x
+// compatible write API of the cluster.
+package httpd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// MetaClient resolves api tokens, sessions and bucket mappings of InfluxDB
+// 2.x clients, and databases of writes with idempotency keys.
+type MetaClient interface {
+	Database(name string) *meta.DatabaseInfo
+	Authenticate(username, password string) (meta.User, error)
+	AuthenticateToken(token string) (meta.User, error)
+	AuthenticateSession(token string) (meta.User, error)
+	CreateSession(username string, ttl time.Duration) (string, time.Time, error)
+	DropSession(token string) error
+	BucketMapping(org, bucket string) *imeta.BucketMapping
+	ClusterConfig() imeta.ClusterConfig
+	UserOperatorRole(username string) imeta.OperatorRole
+}
+
+// v2Handler adapts InfluxDB 2.x requests before passing them to next:
+//
+//   - org and bucket of /api/v2/write are mapped to database and retention
+//     policy by bucket mappings in meta. Buckets not mapped are taken as
+//     "database/retention-policy" like influxdb does.
+//   - `Authorization: Token <api token>` is passed as `Token <user>:<api token>`,
+//     which is accepted by tokenMetaClient. So are session tokens, given by
+//     the header or the session cookie.
+type v2Handler struct {
+	next       http.Handler
+	metaClient MetaClient
+}
+
+func (h *v2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// unknown tokens are left to be rejected if authentication is enabled
+	if token := requestToken(r); token != "" {
+		if u, err := h.metaClient.AuthenticateToken(token); err == nil {
+			r.Header.Set("Authorization", "Token "+u.ID()+":"+token)
+		} else if u, err := h.metaClient.AuthenticateSession(token); err == nil {
+			r.Header.Set("Authorization", "Token "+u.ID()+":"+token)
+		}
+	}
+
+	if r.URL.Path == "/api/v2/write" {
+		q := r.URL.Query()
+		if m := h.metaClient.BucketMapping(q.Get("org"), q.Get("bucket")); m != nil {
+			bucket := m.Database
+			if m.RetentionPolicy != "" {
+				bucket += "/" + m.RetentionPolicy
+			}
+			q.Set("bucket", bucket)
+			r.URL.RawQuery = q.Encode()
+		}
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// requestToken returns the api or session token of r given by
+// `Authorization: Token <token>`, or by the session cookie if no credentials
+// are given. Tokens with colon are credentials of user handled by influxdb.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token := strings.TrimPrefix(auth, "Token "); token != auth && !strings.Contains(token, ":") {
+			return token
+		}
+		return ""
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// httpError writes error like the influxdb handler does.
+func httpError(w http.ResponseWriter, msg string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Influxdb-Error", msg)
+	w.WriteHeader(code)
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	w.Write(b)
+}
+
+// handlerMetaClient is the meta client used by the influxdb handler.
+type handlerMetaClient interface {
+	Database(name string) *meta.DatabaseInfo
+	Databases() []meta.DatabaseInfo
+	Authenticate(username, password string) (ui meta.User, err error)
+	User(username string) (meta.User, error)
+	AdminUserExists() bool
+}
+
+// tokenMetaClient also accepts api and session tokens as password of their
+// users.
+type tokenMetaClient struct {
+	handlerMetaClient
+	tokens MetaClient
+}
+
+func (c *tokenMetaClient) Authenticate(username, password string) (meta.User, error) {
+	if u, err := c.tokens.AuthenticateToken(password); err == nil && u.ID() == username {
+		return u, nil
+	}
+	if u, err := c.tokens.AuthenticateSession(password); err == nil && u.ID() == username {
+		return u, nil
+	}
+	return c.handlerMetaClient.Authenticate(username, password)
+}
@@ -0,0 +1,397 @@
+package httpd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/prometheus/remote"
+	"github.com/influxdata/influxdb/query"
+	"github.com/influxdata/influxdb/services/httpd"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/storage/reads"
+	"github.com/influxdata/influxdb/storage/reads/datatypes"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/logging"
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+type fakeMetaClient struct {
+	handlerMetaClient
+	tokens   map[string]string
+	sessions map[string]string
+	mappings []imeta.BucketMapping
+	config   imeta.ClusterConfig
+	roles    map[string]imeta.OperatorRole
+	// databases existing
+	databases []string
+}
+
+func (c *fakeMetaClient) Database(name string) *meta.DatabaseInfo {
+	for _, db := range c.databases {
+		if db == name {
+			return &meta.DatabaseInfo{Name: db}
+		}
+	}
+	return nil
+}
+
+func (c *fakeMetaClient) UserOperatorRole(username string) imeta.OperatorRole {
+	return c.roles[username]
+}
+
+func (c *fakeMetaClient) AuthenticateToken(token string) (meta.User, error) {
+	if u, ok := c.tokens[token]; ok {
+		return &meta.UserInfo{Name: u}, nil
+	}
+	return nil, imeta.ErrInvalidAPIToken
+}
+
+func (c *fakeMetaClient) BucketMapping(org, bucket string) *imeta.BucketMapping {
+	for i := range c.mappings {
+		if c.mappings[i].Org == org && c.mappings[i].Bucket == bucket {
+			return &c.mappings[i]
+		}
+	}
+	return nil
+}
+
+func (c *fakeMetaClient) Authenticate(username, password string) (meta.User, error) {
+	if username == "u0" && password == "p0" {
+		return &meta.UserInfo{Name: username}, nil
+	}
+	return nil, errors.New("authorization failed")
+}
+
+func (c *fakeMetaClient) AuthenticateSession(token string) (meta.User, error) {
+	if u, ok := c.sessions[token]; ok {
+		return &meta.UserInfo{Name: u}, nil
+	}
+	return nil, imeta.ErrInvalidSession
+}
+
+func (c *fakeMetaClient) CreateSession(username string, ttl time.Duration) (string, time.Time, error) {
+	token := "s" + username
+	c.sessions[token] = username
+	return token, time.Now().Add(ttl), nil
+}
+
+func (c *fakeMetaClient) DropSession(token string) error {
+	delete(c.sessions, token)
+	return nil
+}
+
+func (c *fakeMetaClient) ClusterConfig() imeta.ClusterConfig {
+	return c.config
+}
+
+func newTestService(mc MetaClient, authEnabled bool) *Service {
+	s := NewService(httpd.Config{AuthEnabled: authEnabled})
+	s.MetaClient = mc
+	return s
+}
+
+func TestV2Handler(t *testing.T) {
+	mc := &fakeMetaClient{
+		tokens: map[string]string{"t0": "u0"},
+		mappings: []imeta.BucketMapping{
+			{Org: "o", Bucket: "b", Database: "db0", RetentionPolicy: "rp0"},
+			{Org: "o", Bucket: "c", Database: "db1"},
+		},
+	}
+	var got *http.Request
+	h := newTestService(mc, false).handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r }))
+
+	for _, tc := range []struct {
+		url, auth     string
+		bucket, wAuth string
+	}{
+		{"/api/v2/write?org=o&bucket=b", "Token t0", "db0/rp0", "Token u0:t0"},
+		{"/api/v2/write?org=o&bucket=c", "Token u1:p1", "db1", "Token u1:p1"},
+		// not mapped
+		{"/api/v2/write?org=x&bucket=db2/rp2", "Token unknown", "db2/rp2", "Token unknown"},
+		{"/query?bucket=b&org=o", "Basic dTE6cDE=", "b", "Basic dTE6cDE="},
+	} {
+		r := httptest.NewRequest("POST", tc.url, nil)
+		r.Header.Set("Authorization", tc.auth)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		assert.Equal(t, tc.bucket, got.URL.Query().Get("bucket"), tc.url)
+		assert.Equal(t, tc.wAuth, got.Header.Get("Authorization"), tc.url)
+	}
+
+	c := &tokenMetaClient{handlerMetaClient: mc, tokens: mc}
+	u, err := c.Authenticate("u0", "t0")
+	assert.Nil(t, err)
+	assert.Equal(t, "u0", u.ID())
+	// token of another user
+	_, err = c.Authenticate("u1", "t0")
+	assert.NotNil(t, err)
+}
+
+func TestV2Handler_Session(t *testing.T) {
+	mc := &fakeMetaClient{sessions: map[string]string{}}
+	var got *http.Request
+	h := newTestService(mc, false).handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r }))
+	serve := func(method, url string, fn func(r *http.Request)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, url, nil)
+		fn(r)
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("POST", "/api/v2/signin", func(r *http.Request) { r.SetBasicAuth("u0", "wrong") })
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serve("GET", "/api/v2/signin", func(r *http.Request) { r.SetBasicAuth("u0", "p0") })
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	w = serve("POST", "/api/v2/signin", func(r *http.Request) { r.SetBasicAuth("u0", "p0") })
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+	assert.Equal(t, sessionCookie, cookies[0].Name)
+	assert.Equal(t, "su0", cookies[0].Value)
+
+	// session by cookie or header
+	serve("GET", "/query", func(r *http.Request) { r.AddCookie(cookies[0]) })
+	assert.Equal(t, "Token u0:su0", got.Header.Get("Authorization"))
+	serve("GET", "/query", func(r *http.Request) { r.Header.Set("Authorization", "Token su0") })
+	assert.Equal(t, "Token u0:su0", got.Header.Get("Authorization"))
+	// credentials given take precedence over the cookie
+	serve("GET", "/query", func(r *http.Request) {
+		r.AddCookie(cookies[0])
+		r.SetBasicAuth("u1", "p1")
+	})
+	assert.Equal(t, "Basic dTE6cDE=", got.Header.Get("Authorization"))
+
+	c := &tokenMetaClient{handlerMetaClient: mc, tokens: mc}
+	u, err := c.Authenticate("u0", "su0")
+	assert.Nil(t, err)
+	assert.Equal(t, "u0", u.ID())
+
+	w = serve("POST", "/api/v2/signout", func(r *http.Request) { r.AddCookie(cookies[0]) })
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 0, len(mc.sessions))
+	w = serve("POST", "/api/v2/signout", func(r *http.Request) { r.AddCookie(cookies[0]) })
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	mc.config = imeta.ClusterConfig{imeta.ConfigSessionTTL: "0s"}
+	w = serve("POST", "/api/v2/signin", func(r *http.Request) { r.SetBasicAuth("u0", "p0") })
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+type fakeShardRouter struct {
+	db, rp string
+	points int
+}
+
+func (r *fakeShardRouter) RoutePoints(database, retentionPolicy string, points []models.Point) (string, []coordinator.PointRoute, error) {
+	r.db, r.rp, r.points = database, retentionPolicy, len(points)
+	return "autogen", []coordinator.PointRoute{{ShardID: 1, Owners: []uint64{1, 2}}}, nil
+}
+
+func TestV2Handler_Route(t *testing.T) {
+	mc := &fakeMetaClient{}
+	router := &fakeShardRouter{}
+	s := newTestService(mc, false)
+	s.ShardRouter = router
+	h := s.handler(http.NotFoundHandler())
+	serve := func(url, body string, fn func(r *http.Request)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", url, strings.NewReader(body))
+		fn(r)
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("/debug/route?db=db0&precision=s", "cpu v=1 1\ncpu,host=a v=2 2\n", func(r *http.Request) {})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "db0", router.db)
+	assert.Equal(t, 2, router.points)
+	var resp routeResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "autogen", resp.RetentionPolicy)
+	assert.Equal(t, []uint64{1, 2}, resp.Points[0].Owners)
+
+	w = serve("/debug/route", "cpu v=1", func(r *http.Request) {})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve("/debug/route?db=db0", "cpu", func(r *http.Request) {})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// admin users only if authentication is enabled
+	s.config.AuthEnabled = true
+	h = s.handler(http.NotFoundHandler())
+	w = serve("/debug/route?db=db0", "cpu v=1", func(r *http.Request) {})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serve("/debug/route?db=db0", "cpu v=1", func(r *http.Request) { r.SetBasicAuth("u0", "p0") })
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestV2Handler_LogLevel(t *testing.T) {
+	levels := logging.NewLevels(zap.InfoLevel)
+	s := newTestService(&fakeMetaClient{}, false)
+	s.LogLevels = levels
+	h := s.handler(http.NotFoundHandler())
+	serve := func(method, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, url, nil))
+		return w
+	}
+
+	w := serve("POST", "/debug/log-level?service=hh_processor&level=debug")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]zapcore.Level{"hh_processor": zap.DebugLevel}, levels.ServiceLevels())
+	assert.Equal(t, zap.InfoLevel, levels.Level())
+
+	w = serve("POST", "/debug/log-level?level=warning")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, zap.WarnLevel, levels.Level())
+	w = serve("POST", "/debug/log-level?level=loud")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve("GET", "/debug/log-level")
+	var resp struct {
+		Level    string            `json:"level"`
+		Services map[string]string `json:"services"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "warn", resp.Level)
+	assert.Equal(t, map[string]string{"hh_processor": "debug"}, resp.Services)
+
+	serve("POST", "/debug/log-level?service=hh_processor")
+	assert.Empty(t, levels.ServiceLevels())
+
+	// loggers of the service follow its level
+	core, logs := observer.New(zap.DebugLevel)
+	levels.SetServiceLevel("hh_processor", zap.DebugLevel)
+	logger := zap.New(levels.NewCore(core))
+	logger.With(zap.String("service", "hh_processor")).Debug("shown")
+	logger.With(zap.String("service", "shard-precreation")).Info("hidden")
+	assert.Equal(t, 1, logs.Len())
+}
+
+type fakeStore struct {
+	authorizer query.Authorizer
+}
+
+func (s *fakeStore) ReadFilter(ctx context.Context, req *datatypes.ReadFilterRequest) (reads.ResultSet, error) {
+	s.authorizer = coordinator.ReadAuthorizer(ctx)
+	return nil, nil
+}
+
+func TestV2Handler_PromRead(t *testing.T) {
+	store := &fakeStore{}
+	s := newTestService(&fakeMetaClient{}, true)
+	s.Controller = &fakeController{}
+	s.Handler.Store = store
+	h := s.handler(http.NotFoundHandler())
+	data, err := proto.Marshal(&remote.ReadRequest{Queries: []*remote.Query{{
+		StartTimestampMs: 0,
+		EndTimestampMs:   1000,
+		Matchers:         []*remote.LabelMatcher{{Type: remote.MatchType_EQUAL, Name: "__name__", Value: "cpu"}},
+	}}})
+	assert.Nil(t, err)
+	body := string(snappy.Encode(nil, data))
+
+	r := httptest.NewRequest("POST", "/api/v1/prom/read?db=db0", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Nil(t, store.authorizer)
+
+	// read as the user, not taken as the controller api
+	r = httptest.NewRequest("POST", "/api/v1/prom/read?db=db0", strings.NewReader(body))
+	r.SetBasicAuth("u0", "p0")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "snappy", w.Header().Get("Content-Encoding"))
+	if u, ok := store.authorizer.(meta.User); assert.True(t, ok) {
+		assert.Equal(t, "u0", u.ID())
+	}
+}
+
+type fakePointsWriter struct {
+	key    string
+	db, rp string
+	user   meta.User
+	points []models.Point
+}
+
+func (w *fakePointsWriter) WritePointsContext(ctx context.Context, database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, user meta.User, points []models.Point) error {
+	w.key = coordinator.IdempotencyKey(ctx)
+	w.db, w.rp, w.user, w.points = database, retentionPolicy, user, points
+	return nil
+}
+
+func (w *fakePointsWriter) WritePoints(database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, user meta.User, points []models.Point) error {
+	return errors.New("written without key")
+}
+
+type fakeWriteAuthorizer struct{}
+
+func (fakeWriteAuthorizer) AuthorizeWrite(username, database string) error {
+	if database != "db0" {
+		return meta.ErrAuthorize{User: username, Database: database}
+	}
+	return nil
+}
+
+func TestV2Handler_IdempotencyKey(t *testing.T) {
+	pw := &fakePointsWriter{}
+	mc := &fakeMetaClient{tokens: map[string]string{"t0": "u0"}, databases: []string{"db0", "db1"}}
+	s := newTestService(mc, true)
+	s.Handler.PointsWriter = pw
+	s.Handler.WriteAuthorizer = fakeWriteAuthorizer{}
+	h := s.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }))
+	write := func(url, auth, key string) int {
+		r := httptest.NewRequest("POST", url, strings.NewReader("cpu value=1 1000000000\n"))
+		r.Header.Set("Authorization", auth)
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// writes without key are left to influxdb
+	assert.Equal(t, http.StatusTeapot, write("/write?db=db0", "Basic dTA6cDA=", ""))
+
+	assert.Equal(t, http.StatusNoContent, write("/write?db=db0&rp=rp0&precision=s", "Basic dTA6cDA=", "k0"))
+	assert.Equal(t, "http/k0", pw.key)
+	assert.Equal(t, "rp0", pw.rp)
+	assert.Equal(t, "u0", pw.user.ID())
+	if assert.Equal(t, 1, len(pw.points)) {
+		assert.Equal(t, int64(1000000000)*int64(time.Second), pw.points[0].UnixNano())
+	}
+
+	// by query parameter and api token
+	assert.Equal(t, http.StatusNoContent, write("/api/v2/write?bucket=db0/rp1&idempotency_key=k1", "Token t0", ""))
+	assert.Equal(t, "http/k1", pw.key)
+	assert.Equal(t, "db0", pw.db)
+	assert.Equal(t, "rp1", pw.rp)
+
+	assert.Equal(t, http.StatusUnauthorized, write("/write?db=db0", "Basic dTA6cDE=", "k2"))
+	assert.Equal(t, http.StatusForbidden, write("/write?db=db1", "Basic dTA6cDA=", "k2"))
+	assert.Equal(t, http.StatusNotFound, write("/write?db=db2", "Basic dTA6cDA=", "k2"))
+	assert.Equal(t, http.StatusBadRequest, write("/write?db=db0", "Basic dTA6cDA=", strings.Repeat("k", maxIdempotencyKey+1)))
+	assert.Equal(t, "http/k1", pw.key)
+
+	// keyed writes are rejected while the cluster is read-only too
+	mc.config = imeta.ClusterConfig{imeta.ConfigReadOnly: "true"}
+	assert.Equal(t, http.StatusServiceUnavailable, write("/write?db=db0", "Basic dTA6cDA=", "k3"))
+	assert.Equal(t, "http/k1", pw.key)
+}
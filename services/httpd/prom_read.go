@@ -0,0 +1,137 @@
+package httpd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/influxdata/influxdb/prometheus"
+	"github.com/influxdata/influxdb/prometheus/remote"
+	"github.com/influxdata/influxdb/query"
+	"github.com/influxdata/influxdb/services/httpd"
+	"github.com/influxdata/influxdb/tsdb"
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/coordinator"
+)
+
+// promReadPath is the prometheus remote read endpoint of influxdb.
+const promReadPath = "/api/v1/prom/read"
+
+// promReadHandler serves prometheus remote read like influxdb does, except
+// that the store reads as the user of the request if authentication is
+// enabled, so that its privileges are checked like the ones of /query.
+type promReadHandler struct {
+	auth
+	store  httpd.Store
+	logger *zap.Logger
+}
+
+func (h *promReadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var authorizer query.Authorizer = query.OpenAuthorizer
+	if h.authEnabled {
+		u, err := h.authenticate(r)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		authorizer = u
+	}
+
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reqBuf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req remote.ReadRequest
+	if err := proto.Unmarshal(reqBuf, &req); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	readRequest, err := prometheus.ReadRequestToInfluxStorageRequest(&req, r.FormValue("db"), r.FormValue("rp"))
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rs, err := h.store.ReadFilter(coordinator.WithReadAuthorizer(r.Context(), authorizer), readRequest)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := &remote.ReadResponse{
+		Results: []*remote.QueryResult{{}},
+	}
+	if rs != nil {
+		defer rs.Close()
+		for rs.Next() {
+			cur := rs.Cursor()
+			if cur == nil {
+				continue
+			}
+			tags := prometheus.RemoveInfluxSystemTags(rs.Tags())
+			fc, ok := cur.(tsdb.FloatArrayCursor)
+			if !ok {
+				cur.Close()
+				h.logger.Info("Prometheus can't read cursor", zap.String("cursor_type", cursorType(cur)),
+					zap.Stringer("series", tags))
+				continue
+			}
+			var series *remote.TimeSeries
+			for {
+				a := fc.Next()
+				if a.Len() == 0 {
+					break
+				}
+				if series == nil {
+					series = &remote.TimeSeries{Labels: prometheus.ModelTagsToLabelPairs(tags)}
+				}
+				for i, ts := range a.Timestamps {
+					series.Samples = append(series.Samples, &remote.Sample{
+						TimestampMs: ts / int64(time.Millisecond),
+						Value:       a.Values[i],
+					})
+				}
+			}
+			fc.Close()
+			if series != nil {
+				resp.Results[0].Timeseries = append(resp.Results[0].Timeseries, series)
+			}
+		}
+	}
+
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	w.Write(snappy.Encode(nil, data))
+}
+
+func cursorType(cur tsdb.Cursor) string {
+	switch cur.(type) {
+	case tsdb.IntegerArrayCursor:
+		return "int64"
+	case tsdb.UnsignedArrayCursor:
+		return "uint"
+	case tsdb.BooleanArrayCursor:
+		return "bool"
+	case tsdb.StringArrayCursor:
+		return "string"
+	}
+	return "unknown"
+}
@@ -0,0 +1,22 @@
+package httpd
+
+import (
+	"net/http"
+
+	"github.com/angopher/chronus/errs"
+)
+
+// readOnlyHandler rejects writes with 503 while the cluster is read-only,
+// passing other requests to next.
+type readOnlyHandler struct {
+	next       http.Handler
+	metaClient MetaClient
+}
+
+func (h *readOnlyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isWrite(r) && h.metaClient.ClusterConfig().ReadOnly() {
+		httpError(w, errs.ErrClusterReadOnly.Error(), errs.HTTPStatus(errs.ErrClusterReadOnly))
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
@@ -0,0 +1,70 @@
+package httpd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+
+	"github.com/angopher/chronus/coordinator"
+)
+
+// ShardRouter maps points to shards without writing them.
+type ShardRouter interface {
+	RoutePoints(database, retentionPolicy string, points []models.Point) (string, []coordinator.PointRoute, error)
+}
+
+// maxRouteBody limits the line protocol sample routed.
+const maxRouteBody = 1 << 20
+
+type routeResponse struct {
+	Database        string                   `json:"database"`
+	RetentionPolicy string                   `json:"retention_policy"`
+	Points          []coordinator.PointRoute `json:"points"`
+}
+
+// routeHandler serves /debug/route, telling the shard group, shard and owners
+// each point of the line protocol body would be written to and why, without
+// writing them. It's for admin users only if authentication is enabled.
+type routeHandler struct {
+	auth
+	router ShardRouter
+}
+
+func (h *routeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	db := q.Get("db")
+	if db == "" {
+		httpError(w, "database is required", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRouteBody))
+	if err != nil {
+		httpError(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	points, err := models.ParsePointsWithPrecision(body, time.Now().UTC(), q.Get("precision"))
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rp, routes, err := h.router.RoutePoints(db, q.Get("rp"), points)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&routeResponse{Database: db, RetentionPolicy: rp, Points: routes})
+}
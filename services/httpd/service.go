@@ -0,0 +1,245 @@
+package httpd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/httpd"
+	"go.uber.org/zap"
+
+	"github.com/angopher/chronus/logging"
+	"github.com/angopher/chronus/services/controller"
+	"github.com/angopher/chronus/services/probe"
+)
+
+// Service manages the listeners of the influxdb HTTP handler like its own
+// service does, with InfluxDB 2.x requests adapted in front of Handler.
+type Service struct {
+	ln                 net.Listener
+	unixSocketListener net.Listener
+	config             httpd.Config
+	err                chan error
+
+	Handler    *httpd.Handler
+	MetaClient MetaClient
+	// Probe serves readiness and drain endpoints in front of Handler, if set
+	Probe *probe.Handler
+	// ShardRouter serves /debug/route, if set
+	ShardRouter ShardRouter
+	// LogLevels serves /debug/log-level, if set
+	LogLevels *logging.Levels
+	// Controller serves the REST API of the controller, if set
+	Controller Controller
+
+	Logger *zap.Logger
+}
+
+// NewService returns a new instance of Service.
+func NewService(c httpd.Config) *Service {
+	s := &Service{
+		config:  c,
+		err:     make(chan error),
+		Handler: httpd.NewHandler(c),
+		Logger:  zap.NewNop(),
+	}
+	if s.config.TLS == nil {
+		s.config.TLS = new(tls.Config)
+	}
+	if s.config.HTTPSPrivateKey == "" {
+		s.config.HTTPSPrivateKey = s.config.HTTPSCertificate
+	}
+	s.Handler.Logger = s.Logger
+	return s
+}
+
+// Open starts the service.
+func (s *Service) Open() error {
+	s.Logger.Info("Starting HTTP service", zap.Bool("authentication", s.config.AuthEnabled))
+
+	if s.MetaClient == nil {
+		return errors.New("meta client is required")
+	}
+	s.Handler.MetaClient = &tokenMetaClient{handlerMetaClient: s.Handler.MetaClient, tokens: s.MetaClient}
+	s.Handler.Open()
+
+	// Open listener.
+	if s.config.HTTPSEnabled {
+		cert, err := tls.LoadX509KeyPair(s.config.HTTPSCertificate, s.config.HTTPSPrivateKey)
+		if err != nil {
+			return err
+		}
+
+		tlsConfig := s.config.TLS.Clone()
+		tlsConfig.Certificates = []tls.Certificate{cert}
+
+		listener, err := tls.Listen("tcp", s.config.BindAddress, tlsConfig)
+		if err != nil {
+			return err
+		}
+		s.ln = listener
+	} else {
+		listener, err := net.Listen("tcp", s.config.BindAddress)
+		if err != nil {
+			return err
+		}
+		s.ln = listener
+	}
+	s.Logger.Info("Listening on HTTP",
+		zap.Stringer("addr", s.ln.Addr()),
+		zap.Bool("https", s.config.HTTPSEnabled))
+
+	handler := s.handler(s.Handler)
+	if s.Probe != nil {
+		handler = s.Probe.Wrap(handler)
+	}
+
+	// Open unix socket listener.
+	if s.config.UnixSocketEnabled {
+		if runtime.GOOS == "windows" {
+			return fmt.Errorf("unable to use unix socket on windows")
+		}
+		if err := os.MkdirAll(path.Dir(s.config.BindSocket), 0777); err != nil {
+			return err
+		}
+		if err := syscall.Unlink(s.config.BindSocket); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		listener, err := net.Listen("unix", s.config.BindSocket)
+		if err != nil {
+			return err
+		}
+		if s.config.UnixSocketPermissions != 0 {
+			if err := os.Chmod(s.config.BindSocket, os.FileMode(s.config.UnixSocketPermissions)); err != nil {
+				return err
+			}
+		}
+		if s.config.UnixSocketGroup != nil {
+			if err := os.Chown(s.config.BindSocket, -1, int(*s.config.UnixSocketGroup)); err != nil {
+				return err
+			}
+		}
+
+		s.Logger.Info("Listening on unix socket",
+			zap.Stringer("addr", listener.Addr()))
+		s.unixSocketListener = listener
+
+		go s.serve(s.unixSocketListener, handler)
+	}
+
+	// Enforce a connection limit if one has been given.
+	if s.config.MaxConnectionLimit > 0 {
+		s.ln = httpd.LimitListener(s.ln, s.config.MaxConnectionLimit)
+	}
+
+	go s.serve(s.ln, handler)
+	return nil
+}
+
+// handler mounts the handlers served in front of next, the influxdb handler:
+//
+//   - /api/v2/signin and /api/v2/signout start and end sessions.
+//   - /debug/route tells where points would be written, if ShardRouter is set.
+//   - /debug/log-level shows and changes log levels, if LogLevels is set.
+//   - /api/v1/prom/read reads as the user of the request, if the influxdb
+//     handler has a store.
+//   - /api/v1 serves the REST API of the controller, if Controller is set.
+//
+// Other requests are adapted by v2Handler, then writes are rejected while the
+// cluster is read-only and limited to the write rates of cluster config.
+// Writes with an idempotency key are written with the key if the points
+// writer of the influxdb handler supports it.
+func (s *Service) handler(next http.Handler) http.Handler {
+	a := auth{metaClient: s.MetaClient, authEnabled: s.config.AuthEnabled}
+	if pw, ok := s.Handler.PointsWriter.(PointsWriter); ok {
+		next = &keyedWriteHandler{
+			auth:            a,
+			next:            next,
+			writer:          pw,
+			writeAuthorizer: s.Handler.WriteAuthorizer,
+			maxBodySize:     s.config.MaxBodySize,
+		}
+	}
+	next = &writeLimitHandler{next: next, metaClient: s.MetaClient, writes: newWriteLimiter()}
+	next = &readOnlyHandler{next: next, metaClient: s.MetaClient}
+	next = &v2Handler{next: next, metaClient: s.MetaClient}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", next)
+	sessions := &sessionHandler{metaClient: s.MetaClient}
+	mux.HandleFunc("/api/v2/signin", sessions.signin)
+	mux.HandleFunc("/api/v2/signout", sessions.signout)
+	if s.ShardRouter != nil {
+		mux.Handle("/debug/route", &routeHandler{auth: a, router: s.ShardRouter})
+	}
+	if s.LogLevels != nil {
+		mux.Handle("/debug/log-level", a.adminOnly(s.LogLevels))
+	}
+	if s.Handler.Store != nil {
+		mux.Handle(promReadPath, &promReadHandler{auth: a, store: s.Handler.Store, logger: s.Logger})
+	}
+	if s.Controller != nil {
+		mux.Handle(controller.APIPrefix+"/", &controllerHandler{auth: a, controller: s.Controller, version: s.Handler.Version})
+		// prometheus endpoints of influxdb are not the controller API
+		mux.Handle("/api/v1/prom/", next)
+	}
+	return mux
+}
+
+// Close closes the underlying listeners.
+func (s *Service) Close() error {
+	s.Handler.Close()
+
+	if s.ln != nil {
+		if err := s.ln.Close(); err != nil {
+			return err
+		}
+	}
+	if s.unixSocketListener != nil {
+		if err := s.unixSocketListener.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithLogger sets the logger for the service.
+func (s *Service) WithLogger(log *zap.Logger) {
+	s.Logger = log.With(zap.String("service", "httpd"))
+	s.Handler.Logger = s.Logger
+}
+
+// Err returns a channel for fatal errors that occur on the listener.
+func (s *Service) Err() <-chan error { return s.err }
+
+// Addr returns the listener's address. Returns nil if listener is closed.
+func (s *Service) Addr() net.Addr {
+	if s.ln != nil {
+		return s.ln.Addr()
+	}
+	return nil
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (s *Service) Statistics(tags map[string]string) []models.Statistic {
+	return s.Handler.Statistics(models.NewTags(map[string]string{"bind": s.config.BindAddress}).Merge(tags).Map())
+}
+
+// serve serves the handler from the listener.
+func (s *Service) serve(listener net.Listener, handler http.Handler) {
+	// The listener was closed so exit
+	// See https://github.com/golang/go/issues/4373
+	err := http.Serve(listener, handler)
+	if err != nil && !strings.Contains(err.Error(), "closed") {
+		s.err <- fmt.Errorf("listener failed: addr=%s, err=%s", listener.Addr(), err)
+	}
+}
@@ -0,0 +1,83 @@
+package httpd
+
+import (
+	"net/http"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+// sessionCookie holds the session token of clients signed in, named like the
+// one of InfluxDB 2.x.
+const sessionCookie = "influxdb-oss-session"
+
+// sessionHandler serves /api/v2/signin and /api/v2/signout, starting and
+// ending sessions so that passwords are not compared to their bcrypt hashes
+// on every request.
+type sessionHandler struct {
+	metaClient MetaClient
+}
+
+// signin authenticates the user of basic auth, then signs it in for the
+// session ttl of cluster config, setting the session cookie.
+func (h *sessionHandler) signin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ttl := imeta.DefaultSessionTTL
+	if d, ok := h.metaClient.ClusterConfig().Duration(imeta.ConfigSessionTTL); ok {
+		ttl = d
+	}
+	if ttl <= 0 {
+		httpError(w, "signing in is disabled", http.StatusForbidden)
+		return
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		httpError(w, "basic auth required", http.StatusUnauthorized)
+		return
+	}
+	u, err := h.metaClient.Authenticate(username, password)
+	if err != nil {
+		httpError(w, "authorization failed", http.StatusUnauthorized)
+		return
+	}
+	token, expiration, err := h.metaClient.CreateSession(u.ID(), ttl)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiration,
+		HttpOnly: true,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// signout ends the session of the request, clearing the session cookie.
+func (h *sessionHandler) signout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := requestToken(r)
+	if token == "" {
+		httpError(w, "session required", http.StatusUnauthorized)
+		return
+	} else if _, err := h.metaClient.AuthenticateSession(token); err != nil {
+		httpError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := h.metaClient.DropSession(token); err != nil {
+		httpError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
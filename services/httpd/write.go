@@ -0,0 +1,186 @@
+package httpd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
+
+	"github.com/angopher/chronus/coordinator"
+)
+
+// idempotencyKeyHeader names the idempotency key of a write, which may also be
+// given by the idempotency_key query parameter.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKey limits the keys remembered by owners of shards.
+const maxIdempotencyKey = 128
+
+// PointsWriter writes points of requests with idempotency keys.
+type PointsWriter interface {
+	WritePointsContext(ctx context.Context, database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, user meta.User, points []models.Point) error
+}
+
+// WriteAuthorizer authorizes users writing to databases.
+type WriteAuthorizer interface {
+	AuthorizeWrite(username, database string) error
+}
+
+// isWrite tells whether r is a write of the influxdb handler.
+func isWrite(r *http.Request) bool {
+	return r.URL.Path == "/write" || r.URL.Path == "/api/v2/write"
+}
+
+// idempotencyKey returns the idempotency key of write r, empty if none.
+func idempotencyKey(r *http.Request) string {
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("idempotency_key")
+}
+
+// keyedWriteHandler serves /write and /api/v2/write with an idempotency key
+// like the influxdb handler does, except that points are written with the key
+// so that owners of shards skip them if the write is retried. The key is
+// scoped to http writes, apart from keys of other writers. Other requests are
+// served by next.
+type keyedWriteHandler struct {
+	auth
+	next            http.Handler
+	writer          PointsWriter
+	writeAuthorizer WriteAuthorizer
+	maxBodySize     int
+}
+
+func (h *keyedWriteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if key := idempotencyKey(r); key != "" && isWrite(r) {
+		h.keyedWrite(w, r, key)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+func (h *keyedWriteHandler) keyedWrite(w http.ResponseWriter, r *http.Request, key string) {
+	if len(key) > maxIdempotencyKey {
+		httpError(w, fmt.Sprintf("idempotency key longer than %d bytes", maxIdempotencyKey), http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	db, rp, precision := q.Get("db"), q.Get("rp"), q.Get("precision")
+	if r.URL.Path == "/api/v2/write" {
+		bucket := strings.SplitN(q.Get("bucket"), "/", 2)
+		db = bucket[0]
+		if len(bucket) > 1 {
+			rp = bucket[1]
+		}
+		switch precision {
+		case "ns":
+			precision = "n"
+		case "us":
+			precision = "u"
+		case "ms", "s", "":
+		default:
+			httpError(w, fmt.Sprintf("invalid precision %q (use ns, us, ms or s)", precision), http.StatusBadRequest)
+			return
+		}
+	} else {
+		switch precision {
+		case "", "n", "ns", "u", "ms", "s", "m", "h":
+		default:
+			httpError(w, fmt.Sprintf("invalid precision %q (use n, u, ms, s, m or h)", precision), http.StatusBadRequest)
+			return
+		}
+	}
+	if db == "" {
+		httpError(w, "database is required", http.StatusBadRequest)
+		return
+	}
+	if h.metaClient.Database(db) == nil {
+		httpError(w, fmt.Sprintf("database not found: %q", db), http.StatusNotFound)
+		return
+	}
+
+	var user meta.User
+	if h.authEnabled {
+		u, err := h.authenticate(r)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err := h.writeAuthorizer.AuthorizeWrite(u.ID(), db); err != nil {
+			httpError(w, fmt.Sprintf("%q user is not authorized to write to database %q", u.ID(), db), http.StatusForbidden)
+			return
+		}
+		user = u
+	}
+
+	body := r.Body
+	if h.maxBodySize > 0 {
+		if r.ContentLength > int64(h.maxBodySize) {
+			httpError(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = http.MaxBytesReader(w, body, int64(h.maxBodySize))
+	}
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		b, err := gzip.NewReader(body)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer b.Close()
+		body = b
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, body); err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points, parseError := models.ParsePointsWithPrecision(buf.Bytes(), time.Now().UTC(), precision)
+	if parseError != nil && len(points) == 0 {
+		if parseError.Error() == "EOF" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		httpError(w, parseError.Error(), http.StatusBadRequest)
+		return
+	}
+	consistency := models.ConsistencyLevelOne
+	if level := q.Get("consistency"); level != "" {
+		var err error
+		if consistency, err = models.ParseConsistencyLevel(level); err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := coordinator.WithIdempotencyKey(r.Context(), "http/"+key)
+	err := h.writer.WritePointsContext(ctx, db, rp, consistency, user, points)
+	var partialErr tsdb.PartialWriteError
+	switch {
+	case influxdb.IsClientError(err):
+		httpError(w, err.Error(), http.StatusBadRequest)
+	case influxdb.IsAuthorizationError(err):
+		httpError(w, err.Error(), http.StatusForbidden)
+	case errors.As(err, &partialErr):
+		httpError(w, partialErr.Error(), http.StatusBadRequest)
+	case err != nil:
+		httpError(w, err.Error(), http.StatusInternalServerError)
+	case parseError != nil:
+		// the points parsed are written
+		httpError(w, tsdb.PartialWriteError{Reason: parseError.Error()}.Error(), http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,152 @@
+package httpd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	imeta "github.com/angopher/chronus/services/meta"
+	"golang.org/x/time/rate"
+)
+
+// writeLimiter smooths writes served by the node with token buckets of bytes
+// of requests, of all databases and of each database, as set by cluster
+// config. One client backfilling a database is slowed down by 429 before it
+// destabilizes writes of others.
+type writeLimiter struct {
+	mu sync.Mutex
+	// config applied, limiters are updated once it changes
+	config    [3]string
+	global    *rate.Limiter
+	databases map[string]*rate.Limiter
+}
+
+func newWriteLimiter() *writeLimiter {
+	return &writeLimiter{databases: make(map[string]*rate.Limiter)}
+}
+
+// update applies rates of config, keeping tokens of limiters of unchanged
+// rates. It returns whether any rate is set.
+func (l *writeLimiter) update(config imeta.ClusterConfig) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	applied := [3]string{
+		config[imeta.ConfigWriteRateLimit],
+		config[imeta.ConfigWriteRateBurst],
+		config[imeta.ConfigDatabaseWriteRates],
+	}
+	if applied == l.config {
+		return l.global != nil || len(l.databases) > 0
+	}
+	l.config = applied
+
+	if r, ok := config.WriteRate(); ok {
+		l.global = setLimiter(l.global, r)
+	} else {
+		l.global = nil
+	}
+	rates := config.DatabaseWriteRates()
+	for db := range l.databases {
+		if _, ok := rates[db]; !ok {
+			delete(l.databases, db)
+		}
+	}
+	for db, r := range rates {
+		l.databases[db] = setLimiter(l.databases[db], r)
+	}
+	return l.global != nil || len(l.databases) > 0
+}
+
+// setLimiter sets rate r to limiter, a new one if nil.
+func setLimiter(limiter *rate.Limiter, r imeta.WriteRate) *rate.Limiter {
+	if limiter == nil {
+		return rate.NewLimiter(rate.Limit(r.Limit), int(r.Burst))
+	}
+	limiter.SetLimit(rate.Limit(r.Limit))
+	limiter.SetBurst(int(r.Burst))
+	return limiter
+}
+
+// reserve takes n bytes of a write to database at now, returning how long to
+// wait before retrying if the write exceeds a rate, 0 if it's allowed. Writes
+// larger than the burst of a rate are allowed once the bucket is full.
+func (l *writeLimiter) reserve(database string, n int64, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var delay time.Duration
+	var reserved []*rate.Reservation
+	for _, limiter := range []*rate.Limiter{l.databases[database], l.global} {
+		if limiter == nil {
+			continue
+		}
+		tokens := n
+		if burst := int64(limiter.Burst()); tokens > burst {
+			tokens = burst
+		}
+		r := limiter.ReserveN(now, int(tokens))
+		reserved = append(reserved, r)
+		if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		for _, r := range reserved {
+			r.CancelAt(now)
+		}
+	}
+	return delay
+}
+
+// writeLimitHandler limits writes to the rates of cluster config before
+// passing them to next, answering 429 with Retry-After if exceeded.
+type writeLimitHandler struct {
+	next       http.Handler
+	metaClient MetaClient
+	writes     *writeLimiter
+}
+
+func (h *writeLimitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isWrite(r) && !h.limitWrite(w, r) {
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// limitWrite tells whether write r is allowed by rates of cluster config,
+// answering 429 with Retry-After if not.
+func (h *writeLimitHandler) limitWrite(w http.ResponseWriter, r *http.Request) bool {
+	if !h.writes.update(h.metaClient.ClusterConfig()) {
+		return true
+	}
+
+	q := r.URL.Query()
+	database := q.Get("db")
+	if r.URL.Path == "/api/v2/write" {
+		database = strings.SplitN(q.Get("bucket"), "/", 2)[0]
+	}
+	n := r.ContentLength
+	if n < 0 {
+		// chunked, the influxdb handler reads the whole body anyway
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		n = int64(len(b))
+	}
+
+	if delay := h.writes.reserve(database, n, time.Now()); delay > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		httpError(w, "write rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
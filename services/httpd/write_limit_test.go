@@ -0,0 +1,70 @@
+package httpd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+func TestWriteLimiter(t *testing.T) {
+	l := newWriteLimiter()
+	assert.False(t, l.update(imeta.ClusterConfig{}))
+	assert.True(t, l.update(imeta.ClusterConfig{
+		imeta.ConfigWriteRateLimit:     "100",
+		imeta.ConfigWriteRateBurst:     "200",
+		imeta.ConfigDatabaseWriteRates: "db0=10:20",
+	}))
+	now := time.Now()
+
+	assert.Equal(t, time.Duration(0), l.reserve("db0", 20, now))
+	// 1 token of db0 per 100ms
+	assert.Equal(t, 100*time.Millisecond, l.reserve("db0", 1, now))
+	// nothing taken by writes rejected
+	assert.Equal(t, time.Duration(0), l.reserve("db1", 180, now))
+	assert.Equal(t, 10*time.Millisecond, l.reserve("db1", 1, now))
+	// larger than the burst once full
+	assert.Equal(t, time.Duration(0), l.reserve("db1", 1000, now.Add(2*time.Second)))
+
+	// unlimited once unset
+	assert.False(t, l.update(imeta.ClusterConfig{}))
+	assert.Equal(t, 0, len(l.databases))
+}
+
+func TestV2Handler_WriteRateLimit(t *testing.T) {
+	mc := &fakeMetaClient{}
+	written := 0
+	h := newTestService(mc, false).handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { written++ }))
+	write := func(url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", url, strings.NewReader(body)))
+		return w
+	}
+	body := strings.Repeat("cpu value=1\n", 10)
+
+	w := write("/write?db=db0", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mc.config = imeta.ClusterConfig{imeta.ConfigDatabaseWriteRates: "db0=1"}
+	w = write("/write?db=db0", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = write("/api/v2/write?bucket=db0/rp0", body)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	// other databases are not limited
+	w = write("/write?db=db1", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, written)
+
+	// no write while the cluster is read-only
+	mc.config = imeta.ClusterConfig{imeta.ConfigReadOnly: "true"}
+	w = write("/write?db=db1", body)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "cluster is read-only")
+	assert.Equal(t, 3, written)
+}
@@ -0,0 +1,133 @@
+package kafka
+
+import (
+	"errors"
+	"time"
+
+	"github.com/influxdata/influxdb/monitor/diagnostics"
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	FormatLine = "line"
+	FormatJSON = "json"
+
+	// DefaultDatabase is the default database points are written to.
+	DefaultDatabase = "kafka"
+
+	// DefaultGroupID is the default consumer group which offsets are tracked by.
+	DefaultGroupID = "chronus"
+
+	// DefaultBatchSize is the default number of points written in one batch.
+	DefaultBatchSize = 5000
+
+	// DefaultBatchTimeout is the default time a batch waits for more points.
+	DefaultBatchTimeout = time.Second
+
+	// DefaultRetryInterval is the default interval retrying a batch failed to write.
+	DefaultRetryInterval = time.Second
+)
+
+// Config is the configuration of consuming points from kafka topics.
+type Config struct {
+	Enabled bool     `toml:"enabled"`
+	Brokers []string `toml:"brokers"`
+	Topics  []string `toml:"topics"`
+	GroupID string   `toml:"group-id"`
+
+	// Format of messages: line for line protocol, json for json points
+	Format          string `toml:"format"`
+	Database        string `toml:"database"`
+	RetentionPolicy string `toml:"retention-policy"`
+	// Precision of timestamps in line protocol
+	Precision string `toml:"precision"`
+
+	BatchSize     int           `toml:"batch-size"`
+	BatchTimeout  toml.Duration `toml:"batch-timeout"`
+	RetryInterval toml.Duration `toml:"retry-interval"`
+}
+
+// NewConfig returns a new Config.
+func NewConfig() Config {
+	return Config{
+		GroupID:       DefaultGroupID,
+		Format:        FormatLine,
+		Database:      DefaultDatabase,
+		BatchSize:     DefaultBatchSize,
+		BatchTimeout:  toml.Duration(DefaultBatchTimeout),
+		RetryInterval: toml.Duration(DefaultRetryInterval),
+	}
+}
+
+// WithDefaults takes the given config and returns a new config with any
+// required default values set.
+func (c *Config) WithDefaults() *Config {
+	d := *c
+	if d.GroupID == "" {
+		d.GroupID = DefaultGroupID
+	}
+	if d.Format == "" {
+		d.Format = FormatLine
+	}
+	if d.Database == "" {
+		d.Database = DefaultDatabase
+	}
+	if d.BatchSize <= 0 {
+		d.BatchSize = DefaultBatchSize
+	}
+	if d.BatchTimeout <= 0 {
+		d.BatchTimeout = toml.Duration(DefaultBatchTimeout)
+	}
+	if d.RetryInterval <= 0 {
+		d.RetryInterval = toml.Duration(DefaultRetryInterval)
+	}
+	return &d
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Brokers) == 0 {
+		return errors.New("Kafka.Brokers must be specified")
+	}
+	if len(c.Topics) == 0 {
+		return errors.New("Kafka.Topics must be specified")
+	}
+	if c.Format != "" && c.Format != FormatLine && c.Format != FormatJSON {
+		return errors.New("Kafka.Format should be line or json")
+	}
+	return nil
+}
+
+// Configs wraps a slice of Config to aggregate diagnostics.
+type Configs []Config
+
+// Diagnostics returns one set of diagnostics for all of the Configs.
+func (c Configs) Diagnostics() (*diagnostics.Diagnostics, error) {
+	d := &diagnostics.Diagnostics{
+		Columns: []string{"enabled", "brokers", "topics", "group-id", "database", "retention-policy", "format"},
+	}
+
+	for _, cc := range c {
+		if !cc.Enabled {
+			d.AddRow([]interface{}{false})
+			continue
+		}
+
+		r := []interface{}{true, cc.Brokers, cc.Topics, cc.GroupID, cc.Database, cc.RetentionPolicy, cc.Format}
+		d.AddRow(r)
+	}
+
+	return d, nil
+}
+
+// Enabled returns true if any underlying Config is Enabled.
+func (c Configs) Enabled() bool {
+	for _, cc := range c {
+		if cc.Enabled {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+// jsonPoint is a point in json messages like:
+//
+//	{"measurement": "cpu", "tags": {"host": "a"}, "fields": {"value": 0.5}, "time": 1600000000}
+//
+// time is either an integer in precision configured or a RFC3339 string, numbers
+// of fields are written as float.
+type jsonPoint struct {
+	Measurement string                 `json:"measurement"`
+	Tags        map[string]string      `json:"tags"`
+	Fields      map[string]interface{} `json:"fields"`
+	Time        json.RawMessage        `json:"time"`
+}
+
+func (p *jsonPoint) time(now time.Time, precision string) (time.Time, error) {
+	if len(p.Time) == 0 || string(p.Time) == "null" {
+		return now, nil
+	}
+	if p.Time[0] == '"' {
+		var s string
+		if err := json.Unmarshal(p.Time, &s); err != nil {
+			return time.Time{}, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	}
+
+	var ts int64
+	if err := json.Unmarshal(p.Time, &ts); err != nil {
+		return time.Time{}, err
+	}
+	return models.SafeCalcTime(ts, precision)
+}
+
+// parseJSON parses a message holding a json point or an array of them.
+func parseJSON(data []byte, now time.Time, precision string) ([]models.Point, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var jps []jsonPoint
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &jps); err != nil {
+			return nil, err
+		}
+	} else {
+		jps = make([]jsonPoint, 1)
+		if err := json.Unmarshal(data, &jps[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	points := make([]models.Point, 0, len(jps))
+	for i := range jps {
+		jp := &jps[i]
+		if jp.Measurement == "" {
+			return nil, errors.New("measurement is required")
+		}
+		ts, err := jp.time(now, precision)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time of %s: %s", jp.Measurement, err)
+		}
+		pt, err := models.NewPoint(jp.Measurement, models.NewTags(jp.Tags), models.Fields(jp.Fields), ts)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, pt)
+	}
+	return points, nil
+}
+
+func parsePoints(format string, data []byte, now time.Time, precision string) ([]models.Point, error) {
+	if format == FormatJSON {
+		return parseJSON(data, now, precision)
+	}
+	return models.ParsePointsWithPrecision(data, now, precision)
+}
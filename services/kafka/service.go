@@ -0,0 +1,289 @@
+// Package kafka provides a service consuming points from kafka topics.
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/logging"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tsdb"
+	kafkago "github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// statistics gathered by the kafka package.
+const (
+	statMessagesReceived    = "messagesRx"
+	statMessagesParseFail   = "messagesParseFail"
+	statPointsReceived      = "pointsRx"
+	statBatchesTransmitted  = "batchesTx"
+	statPointsTransmitted   = "pointsTx"
+	statBatchesTransmitFail = "batchesTxFail"
+	statCommitFail          = "commitFail"
+)
+
+// messageReader fetches messages of a topic and commits offsets of them
+// in the consumer group.
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafkago.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Close() error
+}
+
+// Service consumes line protocol or json messages from kafka topics and
+// writes them through PointsWriter. Offsets are committed only after points
+// of messages are written, so that delivery is at least once.
+type Service struct {
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	config  Config
+	readers []messageReader
+
+	newReader func(c *Config, topic string) messageReader
+
+	PointsWriter interface {
+		WritePointsPrivilegedContext(ctx context.Context, database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error
+	}
+
+	MetaClient interface {
+		CreateDatabase(name string) (*meta.DatabaseInfo, error)
+	}
+
+	Logger      *zap.Logger
+	stats       *Statistics
+	defaultTags models.StatisticTags
+}
+
+// NewService returns a new instance of Service.
+func NewService(c Config) *Service {
+	d := *c.WithDefaults()
+	return &Service{
+		config:      d,
+		newReader:   newKafkaReader,
+		Logger:      zap.NewNop(),
+		stats:       &Statistics{},
+		defaultTags: models.StatisticTags{"database": d.Database, "group": d.GroupID},
+	}
+}
+
+func newKafkaReader(c *Config, topic string) messageReader {
+	return kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers: c.Brokers,
+		GroupID: c.GroupID,
+		Topic:   topic,
+	})
+}
+
+// Open starts consuming.
+func (s *Service) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return nil // Already open.
+	}
+	if len(s.config.Brokers) == 0 || len(s.config.Topics) == 0 {
+		return errors.New("brokers and topics have to be specified in config")
+	}
+	if _, err := s.MetaClient.CreateDatabase(s.config.Database); err != nil {
+		s.Logger.Info("Failed to ensure target database exists",
+			logging.Database(s.config.Database), zap.Error(err))
+		return err
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, topic := range s.config.Topics {
+		r := s.newReader(&s.config, topic)
+		s.readers = append(s.readers, r)
+		s.wg.Add(1)
+		go s.consume(topic, r)
+	}
+	s.Logger.Info("Started consuming kafka",
+		zap.Strings("brokers", s.config.Brokers),
+		zap.Strings("topics", s.config.Topics),
+		zap.String("group", s.config.GroupID))
+	return nil
+}
+
+// Close stops consuming, points not written yet will be consumed again
+// as offsets of them are not committed.
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	s.wg.Wait()
+	for _, r := range s.readers {
+		r.Close()
+	}
+	s.readers = nil
+	s.cancel = nil
+	return nil
+}
+
+// WithLogger sets the logger on the service.
+func (s *Service) WithLogger(log *zap.Logger) {
+	s.Logger = log.With(zap.String("service", "kafka"))
+}
+
+// Statistics maintains statistics for the kafka service.
+type Statistics struct {
+	MessagesReceived    int64
+	MessagesParseFail   int64
+	PointsReceived      int64
+	BatchesTransmitted  int64
+	PointsTransmitted   int64
+	BatchesTransmitFail int64
+	CommitFail          int64
+}
+
+// Statistics returns statistics for periodic monitoring.
+func (s *Service) Statistics(tags map[string]string) []models.Statistic {
+	return []models.Statistic{{
+		Name: "kafka",
+		Tags: s.defaultTags.Merge(tags),
+		Values: map[string]interface{}{
+			statMessagesReceived:    atomic.LoadInt64(&s.stats.MessagesReceived),
+			statMessagesParseFail:   atomic.LoadInt64(&s.stats.MessagesParseFail),
+			statPointsReceived:      atomic.LoadInt64(&s.stats.PointsReceived),
+			statBatchesTransmitted:  atomic.LoadInt64(&s.stats.BatchesTransmitted),
+			statPointsTransmitted:   atomic.LoadInt64(&s.stats.PointsTransmitted),
+			statBatchesTransmitFail: atomic.LoadInt64(&s.stats.BatchesTransmitFail),
+			statCommitFail:          atomic.LoadInt64(&s.stats.CommitFail),
+		},
+	}}
+}
+
+// consume batches points of messages fetched from topic until closed.
+func (s *Service) consume(topic string, r messageReader) {
+	defer s.wg.Done()
+
+	var (
+		points   []models.Point
+		msgs     []kafkago.Message
+		deadline time.Time
+	)
+	for {
+		ctx := s.ctx
+		var cancel context.CancelFunc
+		if len(msgs) > 0 {
+			ctx, cancel = context.WithDeadline(s.ctx, deadline)
+		}
+		m, err := r.FetchMessage(ctx)
+		if cancel != nil {
+			cancel()
+		}
+
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			if err != context.DeadlineExceeded {
+				s.Logger.Warn("Failed to fetch message", zap.String("topic", topic), zap.Error(err))
+				select {
+				case <-s.ctx.Done():
+					return
+				case <-time.After(time.Duration(s.config.RetryInterval)):
+				}
+				continue
+			}
+		} else {
+			atomic.AddInt64(&s.stats.MessagesReceived, 1)
+			pts, err := parsePoints(s.config.Format, m.Value, time.Now().UTC(), s.config.Precision)
+			if err != nil {
+				// broken message is skipped, its offset is committed along with the batch
+				atomic.AddInt64(&s.stats.MessagesParseFail, 1)
+				s.Logger.Info("Failed to parse message",
+					zap.String("topic", topic),
+					zap.Int("partition", m.Partition),
+					zap.Int64("offset", m.Offset),
+					zap.Error(err))
+			}
+			atomic.AddInt64(&s.stats.PointsReceived, int64(len(pts)))
+			if len(msgs) == 0 {
+				deadline = time.Now().Add(time.Duration(s.config.BatchTimeout))
+			}
+			points = append(points, pts...)
+			msgs = append(msgs, m)
+			if len(points) < s.config.BatchSize && time.Now().Before(deadline) {
+				continue
+			}
+		}
+
+		if len(msgs) == 0 {
+			continue
+		}
+		if !s.flush(topic, r, points, msgs) {
+			return
+		}
+		points, msgs = nil, nil
+	}
+}
+
+// flush writes points and commits offsets of msgs, retrying until written
+// or closed. It returns false if closed.
+func (s *Service) flush(topic string, r messageReader, points []models.Point, msgs []kafkago.Message) bool {
+	// Owners skip retries of a batch they have written, also after consuming
+	// the same messages again.
+	ctx := coordinator.WithIdempotencyKey(s.ctx, batchKey(s.config.GroupID, topic, msgs))
+	for len(points) > 0 {
+		err := s.PointsWriter.WritePointsPrivilegedContext(ctx, s.config.Database, s.config.RetentionPolicy, models.ConsistencyLevelAny, points)
+		if err == nil {
+			atomic.AddInt64(&s.stats.BatchesTransmitted, 1)
+			atomic.AddInt64(&s.stats.PointsTransmitted, int64(len(points)))
+			break
+		}
+		atomic.AddInt64(&s.stats.BatchesTransmitFail, 1)
+		if perr, ok := err.(tsdb.PartialWriteError); ok {
+			// rejected points are not going to succeed by retrying
+			s.Logger.Info("Dropped points of batch",
+				logging.Database(s.config.Database), zap.Int("dropped", perr.Dropped), zap.Error(err))
+			break
+		}
+		s.Logger.Info("Failed to write point batch to database",
+			logging.Database(s.config.Database), zap.Int("points", len(points)), zap.Error(err))
+
+		select {
+		case <-s.ctx.Done():
+			return false
+		case <-time.After(time.Duration(s.config.RetryInterval)):
+		}
+	}
+
+	if err := r.CommitMessages(s.ctx, msgs...); err != nil {
+		if s.ctx.Err() != nil {
+			return false
+		}
+		// points will be consumed again after rebalancing or restarting
+		atomic.AddInt64(&s.stats.CommitFail, 1)
+		s.Logger.Warn("Failed to commit offsets", zap.String("topic", topic), zap.Error(err))
+	}
+	return true
+}
+
+// batchKey returns the idempotency key of writing points of msgs.
+func batchKey(group, topic string, msgs []kafkago.Message) string {
+	h := fnv.New64a()
+	var b [12]byte
+	for _, m := range msgs {
+		binary.BigEndian.PutUint32(b[:4], uint32(m.Partition))
+		binary.BigEndian.PutUint64(b[4:], uint64(m.Offset))
+		h.Write(b[:])
+	}
+	return fmt.Sprintf("kafka/%s/%s/%x", group, topic, h.Sum64())
+}
@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angopher/chronus/coordinator"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/toml"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeReader struct {
+	msgs      chan kafkago.Message
+	mu        sync.Mutex
+	committed []int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	select {
+	case <-ctx.Done():
+		return kafkago.Message{}, ctx.Err()
+	case m := <-r.msgs:
+		return m, nil
+	}
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Committed() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+type fakePointsWriter struct {
+	mu       sync.Mutex
+	failures int
+	points   []models.Point
+	keys     []string
+}
+
+func (w *fakePointsWriter) WritePointsPrivilegedContext(ctx context.Context, database, retentionPolicy string, consistencyLevel models.ConsistencyLevel, points []models.Point) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.keys = append(w.keys, coordinator.IdempotencyKey(ctx))
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("unavailable")
+	}
+	w.points = append(w.points, points...)
+	return nil
+}
+
+type fakeMetaClient struct{}
+
+func (fakeMetaClient) CreateDatabase(name string) (*meta.DatabaseInfo, error) {
+	return &meta.DatabaseInfo{Name: name}, nil
+}
+
+func newTestService(format string, pw *fakePointsWriter, r *fakeReader) *Service {
+	c := NewConfig()
+	c.Enabled = true
+	c.Brokers = []string{"127.0.0.1:9092"}
+	c.Topics = []string{"metrics"}
+	c.Format = format
+	c.BatchSize = 2
+	c.BatchTimeout = toml.Duration(50 * time.Millisecond)
+	c.RetryInterval = toml.Duration(10 * time.Millisecond)
+
+	s := NewService(c)
+	s.newReader = func(*Config, string) messageReader { return r }
+	s.PointsWriter = pw
+	s.MetaClient = fakeMetaClient{}
+	return s
+}
+
+func waitCommitted(t *testing.T, r *fakeReader, n int) []int64 {
+	for i := 0; i < 100; i++ {
+		if c := r.Committed(); len(c) >= n {
+			return c
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("offsets not committed")
+	return nil
+}
+
+func TestService_LineProtocol(t *testing.T) {
+	r := &fakeReader{msgs: make(chan kafkago.Message, 10)}
+	pw := &fakePointsWriter{failures: 1}
+	s := newTestService(FormatLine, pw, r)
+	assert.Nil(t, s.Open())
+	defer s.Close()
+
+	r.msgs <- kafkago.Message{Offset: 1, Value: []byte("cpu,host=a value=1 1600000000000000000\ncpu,host=b value=2 1600000000000000000")}
+	r.msgs <- kafkago.Message{Offset: 2, Value: []byte("broken line")}
+	// timeout flushes the batch less than batch size
+	r.msgs <- kafkago.Message{Offset: 3, Value: []byte("mem free=3i 1600000000000000000")}
+
+	assert.Equal(t, []int64{1, 2, 3}, waitCommitted(t, r, 3))
+	pw.mu.Lock()
+	assert.Equal(t, 3, len(pw.points))
+	// the retry is written with the key of the failed write
+	assert.NotEqual(t, "", pw.keys[0])
+	assert.Equal(t, pw.keys[0], pw.keys[1])
+	pw.mu.Unlock()
+	assert.Equal(t, int64(1), s.stats.MessagesParseFail)
+	assert.Equal(t, int64(1), s.stats.BatchesTransmitFail)
+}
+
+func TestService_JSON(t *testing.T) {
+	r := &fakeReader{msgs: make(chan kafkago.Message, 10)}
+	pw := &fakePointsWriter{}
+	s := newTestService(FormatJSON, pw, r)
+	assert.Nil(t, s.Open())
+	defer s.Close()
+
+	r.msgs <- kafkago.Message{Offset: 7, Value: []byte(`[
+		{"measurement": "cpu", "tags": {"host": "a"}, "fields": {"value": 0.5}, "time": 1600000000000000000},
+		{"measurement": "cpu", "tags": {"host": "b"}, "fields": {"value": 1}, "time": "2020-09-13T12:26:40Z"}
+	]`)}
+
+	assert.Equal(t, []int64{7}, waitCommitted(t, r, 1))
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	assert.Equal(t, 2, len(pw.points))
+	assert.Equal(t, "cpu,host=b value=1 1600000000000000000", pw.points[1].String())
+}
+
+func TestParseJSON(t *testing.T) {
+	now := time.Unix(100, 0)
+	pts, err := parseJSON([]byte(`{"measurement": "cpu", "fields": {"value": 1}, "time": 3}`), now, "s")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(3, 0).UTC(), pts[0].Time())
+
+	pts, err = parseJSON([]byte(`{"measurement": "cpu", "fields": {"value": 1}}`), now, "")
+	assert.Nil(t, err)
+	assert.Equal(t, now, pts[0].Time())
+
+	_, err = parseJSON([]byte(`{"fields": {"value": 1}}`), now, "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,121 @@
+package meta
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"go.uber.org/zap"
+)
+
+// ARCHIVE_FILE holds shard groups pruned from meta data.
+const ARCHIVE_FILE = "shard_groups.archive"
+
+// ArchivedShardGroup is a shard group pruned from meta data after its
+// deletion, kept to find the shards and owners it had for restores.
+type ArchivedShardGroup struct {
+	Database        string
+	RetentionPolicy string
+	ArchivedAt      time.Time
+	meta.ShardGroupInfo
+}
+
+// SetArchiveDir keeps shard groups pruned in ARCHIVE_FILE under dir instead
+// of dropping them. Every meta node archives the shard groups it prunes, nodes
+// restored from a snapshot of others only have those pruned afterwards.
+func (c *Client) SetArchiveDir(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.archiveDir = dir
+}
+
+// ArchivedShardGroups returns the archived shard groups of database and
+// policy, empty ones matching any.
+func (c *Client) ArchivedShardGroups(database, policy string) ([]ArchivedShardGroup, error) {
+	c.mu.RLock()
+	dir := c.archiveDir
+	c.mu.RUnlock()
+	if dir == "" {
+		return nil, ErrArchiveDisabled
+	}
+
+	groups, err := readArchive(filepath.Join(dir, ARCHIVE_FILE))
+	if err != nil {
+		return nil, err
+	}
+	matched := groups[:0]
+	for _, g := range groups {
+		if (database == "" || g.Database == database) && (policy == "" || g.RetentionPolicy == policy) {
+			matched = append(matched, g)
+		}
+	}
+	return matched, nil
+}
+
+// archive appends groups to the archive file as a gzip member of json lines,
+// so that archiving doesn't rewrite groups archived before.
+func (c *Client) archive(groups []ArchivedShardGroup) {
+	if c.archiveDir == "" || len(groups) == 0 {
+		return
+	}
+	if err := appendArchive(filepath.Join(c.archiveDir, ARCHIVE_FILE), groups); err != nil {
+		// meta data must be the same on all nodes, prune anyway
+		c.logger.Error("Failed to archive pruned shard groups", zap.Int("groups", len(groups)), zap.Error(err))
+	}
+}
+
+func appendArchive(path string, groups []ArchivedShardGroup) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+	for i := range groups {
+		if err := enc.Encode(&groups[i]); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func readArchive(path string) ([]ArchivedShardGroup, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var groups []ArchivedShardGroup
+	dec := json.NewDecoder(zr)
+	for {
+		var g ArchivedShardGroup
+		if err := dec.Decode(&g); err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a member cut by crash while archiving is ignored
+			return groups, nil
+		} else if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+}
@@ -0,0 +1,134 @@
+package meta
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAuthCacheSize is the number of users authenticated recently whose
+	// passwords are checked by the fast-path cache.
+	DefaultAuthCacheSize = 1024
+
+	// DefaultAuthCacheTTL is how long a salt of the fast-path cache is used,
+	// the next authentication compares the password to its hash again and
+	// caches it with a new salt.
+	DefaultAuthCacheTTL = time.Hour
+)
+
+// authCache holds salted SHA-256 hashes of passwords users authenticated with
+// recently, sparing bcrypt comparisons of the passwords. Entries expire after
+// ttl so that their salts rotate, and the least recently used are evicted
+// beyond size.
+type authCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	lru   *list.List // of *authUser, most recently used first
+	users map[string]*list.Element
+	// expired entries are swept at most once per ttl
+	nextSweep time.Time
+}
+
+type authUser struct {
+	name    string
+	bhash   string // hash of the password stored, the entry is stale if changed
+	salt    []byte
+	hash    []byte
+	expires time.Time
+}
+
+func newAuthCache(size int, ttl time.Duration) *authCache {
+	return &authCache{
+		size:  size,
+		ttl:   ttl,
+		lru:   list.New(),
+		users: make(map[string]*list.Element),
+	}
+}
+
+// get returns the entry of name if it's not expired and cached for bhash,
+// the stored hash of the password.
+func (a *authCache) get(name, bhash string, now time.Time) (*authUser, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.users[name]
+	if !ok {
+		return nil, false
+	}
+	au := e.Value.(*authUser)
+	if au.bhash != bhash || !now.Before(au.expires) {
+		a.remove(e)
+		return nil, false
+	}
+	a.lru.MoveToFront(e)
+	return au, true
+}
+
+func (a *authCache) add(name, bhash string, salt, hash []byte, now time.Time) {
+	if a.size <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e, ok := a.users[name]; ok {
+		a.remove(e)
+	}
+	au := &authUser{name: name, bhash: bhash, salt: salt, hash: hash, expires: now.Add(a.ttl)}
+	a.users[name] = a.lru.PushFront(au)
+
+	if !now.Before(a.nextSweep) {
+		a.sweep(now)
+		a.nextSweep = now.Add(a.ttl)
+	}
+	for a.lru.Len() > a.size {
+		a.remove(a.lru.Back())
+	}
+}
+
+func (a *authCache) delete(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e, ok := a.users[name]; ok {
+		a.remove(e)
+	}
+}
+
+func (a *authCache) len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lru.Len()
+}
+
+// resize changes the limits of the cache, evicting the least recently used
+// entries beyond size.
+func (a *authCache) resize(size int, ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.size, a.ttl = size, ttl
+	for a.lru.Len() > size && a.lru.Len() > 0 {
+		a.remove(a.lru.Back())
+	}
+}
+
+func (a *authCache) sweep(now time.Time) {
+	for e := a.lru.Front(); e != nil; {
+		next := e.Next()
+		if !now.Before(e.Value.(*authUser).expires) {
+			a.remove(e)
+		}
+		e = next
+	}
+}
+
+func (a *authCache) remove(e *list.Element) {
+	delete(a.users, e.Value.(*authUser).name)
+	a.lru.Remove(e)
+}
+
+// SetAuthCache limits the fast-path cache of authentication to size users,
+// each cached for ttl before its salt rotates. A size of zero disables it.
+func (c *Client) SetAuthCache(size int, ttl time.Duration) {
+	c.authCache.resize(size, ttl)
+}
@@ -0,0 +1,46 @@
+package meta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	a := newAuthCache(2, time.Minute)
+	a.add("u0", "h0", []byte("s0"), []byte("p0"), now)
+	a.add("u1", "h1", []byte("s1"), []byte("p1"), now)
+
+	// a stored hash changed makes the entry stale
+	_, ok := a.get("u1", "h1-new", now)
+	assert.False(t, ok)
+	_, ok = a.get("u1", "h1", now)
+	assert.False(t, ok)
+
+	// least recently used are evicted beyond size
+	a.add("u1", "h1", []byte("s1"), []byte("p1"), now)
+	_, ok = a.get("u0", "h0", now)
+	assert.True(t, ok)
+	a.add("u2", "h2", []byte("s2"), []byte("p2"), now)
+	assert.Equal(t, 2, a.len())
+	_, ok = a.get("u1", "h1", now)
+	assert.False(t, ok)
+
+	// entries expire so that salts rotate
+	au, ok := a.get("u2", "h2", now.Add(time.Minute-1))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("s2"), au.salt)
+	_, ok = a.get("u2", "h2", now.Add(time.Minute))
+	assert.False(t, ok)
+
+	// expired entries not read again are swept
+	a.add("u3", "h3", nil, nil, now.Add(2*time.Minute))
+	assert.Equal(t, 1, a.len())
+
+	a.resize(0, time.Minute)
+	assert.Equal(t, 0, a.len())
+	a.add("u0", "h0", nil, nil, now)
+	assert.Equal(t, 0, a.len())
+}
@@ -1,14 +1,134 @@
 package meta
 
 import (
+	"fmt"
+
+	"github.com/influxdata/influxdb/models"
 	"github.com/influxdata/influxdb/services/meta"
 	"github.com/influxdata/influxql"
 )
 
+// Authorizer enforces measurement scoped privileges. Users without them on
+// a database are not restricted here.
 type Authorizer struct {
+	MetaClient interface {
+		UserMeasurementPrivileges(username, database string) []MeasurementPrivilege
+	}
+}
+
+// measurementScope returns nil if u is not restricted on database
+func (a *Authorizer) measurementScope(u meta.User, database string) []MeasurementPrivilege {
+	if a.MetaClient == nil || u == nil || u.AuthorizeUnrestricted() {
+		return nil
+	}
+	return a.MetaClient.UserMeasurementPrivileges(u.ID(), database)
+}
+
+func (a *Authorizer) authorizeMeasurement(u meta.User, database string, m *influxql.Measurement, p influxql.Privilege) *QueryDenial {
+	if m.Database != "" {
+		database = m.Database
+	}
+	privs := a.measurementScope(u, database)
+	if privs == nil {
+		return nil
+	}
+
+	name := m.Name
+	if m.Regex != nil {
+		// only a pattern matching everything covers a regex
+		name = "*"
+	}
+	for i := range privs {
+		if privs[i].Allows(name, p) {
+			return nil
+		}
+	}
+	return &QueryDenial{
+		User:        u.ID(),
+		Database:    database,
+		Measurement: m.String(),
+		Privilege:   p,
+		Message:     fmt.Sprintf("%s on measurement %s", p, m.String()),
+	}
+}
+
+func (a *Authorizer) authorizeSources(u meta.User, database string, sources influxql.Sources, p influxql.Privilege) *QueryDenial {
+	if len(sources) == 0 && a.measurementScope(u, database) != nil {
+		return &QueryDenial{
+			User:      u.ID(),
+			Database:  database,
+			Privilege: p,
+			Message:   fmt.Sprintf("%s without FROM clause", p),
+		}
+	}
+	for _, src := range sources {
+		switch src := src.(type) {
+		case *influxql.Measurement:
+			if d := a.authorizeMeasurement(u, database, src, p); d != nil {
+				return d
+			}
+		case *influxql.SubQuery:
+			if d := a.authorizeSelect(u, database, src.Statement); d != nil {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Authorizer) authorizeSelect(u meta.User, database string, stmt *influxql.SelectStatement) *QueryDenial {
+	if d := a.authorizeSources(u, database, stmt.Sources, influxql.ReadPrivilege); d != nil {
+		return d
+	}
+	if stmt.Target != nil && stmt.Target.Measurement != nil {
+		return a.authorizeMeasurement(u, database, stmt.Target.Measurement, influxql.WritePrivilege)
+	}
+	return nil
+}
+
+// authorizeStatement checks measurements referenced by stmt, database being
+// the default one.
+func (a *Authorizer) authorizeStatement(u meta.User, stmt influxql.Statement, database string) *QueryDenial {
+	if s, ok := stmt.(influxql.HasDefaultDatabase); ok && s.DefaultDatabase() != "" {
+		database = s.DefaultDatabase()
+	}
+
+	switch stmt := stmt.(type) {
+	case *influxql.SelectStatement:
+		return a.authorizeSelect(u, database, stmt)
+	case *influxql.ShowSeriesStatement:
+		return a.authorizeSources(u, database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.ShowSeriesCardinalityStatement:
+		return a.authorizeSources(u, database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.ShowTagKeysStatement:
+		return a.authorizeSources(u, database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.ShowTagValuesStatement:
+		return a.authorizeSources(u, database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.ShowFieldKeysStatement:
+		return a.authorizeSources(u, database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.DeleteSeriesStatement:
+		return a.authorizeSources(u, database, stmt.Sources, influxql.WritePrivilege)
+	case *influxql.DropSeriesStatement:
+		return a.authorizeSources(u, database, stmt.Sources, influxql.WritePrivilege)
+	case *influxql.DropMeasurementStatement:
+		return a.authorizeMeasurement(u, database, &influxql.Measurement{Name: stmt.Name}, influxql.WritePrivilege)
+	}
+	return nil
 }
 
+// AuthorizeQuery checks measurements referenced by the query against
+// measurement scoped privileges.
 func (a *Authorizer) AuthorizeQuery(u meta.User, query *influxql.Query, database string) error {
+	for _, stmt := range query.Statements {
+		if d := a.authorizeStatement(u, stmt, database); d != nil {
+			return meta.ErrAuthorize{
+				Query:    query,
+				User:     d.User,
+				Database: d.Database,
+				Message:  d.Message,
+			}
+		}
+	}
 	return nil
 }
 
@@ -16,6 +136,39 @@ func (a *Authorizer) AuthorizeWrite(username, database string) error {
 	return nil
 }
 
+// AuthorizeWritePoints checks measurements of points against measurement
+// scoped privileges.
+func (a *Authorizer) AuthorizeWritePoints(u meta.User, database string, points []models.Point) error {
+	privs := a.measurementScope(u, database)
+	if privs == nil {
+		return nil
+	}
+
+	allowed := make(map[string]bool)
+	for _, pt := range points {
+		name := string(pt.Name())
+		if allowed[name] {
+			continue
+		}
+		ok := false
+		for i := range privs {
+			if privs[i].Allows(name, influxql.WritePrivilege) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return meta.ErrAuthorize{
+				User:     u.ID(),
+				Database: database,
+				Message:  fmt.Sprintf("WRITE on measurement %s", name),
+			}
+		}
+		allowed[name] = true
+	}
+	return nil
+}
+
 func (a *Authorizer) AuthorizeDatabase(u meta.User, priv influxql.Privilege, database string) error {
 	return nil
 }
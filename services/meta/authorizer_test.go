@@ -0,0 +1,183 @@
+package meta_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+	"github.com/stretchr/testify/assert"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+func TestAuthorizer_MeasurementPrivileges(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateUser("team", "hash", false))
+	assert.Nil(t, data.CreateUser("other", "hash", false))
+	assert.Equal(t, meta.ErrUserNotFound, data.SetMeasurementPrivilege("nobody", "db0", "cpu*", influxql.ReadPrivilege))
+	assert.Equal(t, imeta.ErrMeasurementPatternInvalid, data.SetMeasurementPrivilege("team", "db0", "[", influxql.ReadPrivilege))
+	assert.Nil(t, data.SetMeasurementPrivilege("team", "db0", "cpu*", influxql.AllPrivileges))
+	assert.Nil(t, data.SetMeasurementPrivilege("team", "db0", "mem", influxql.ReadPrivilege))
+
+	parse := func(q string) *influxql.Query {
+		query, err := influxql.ParseQuery(q)
+		assert.Nil(t, err)
+		return query
+	}
+	auth := &imeta.Authorizer{MetaClient: data}
+	team := &meta.UserInfo{Name: "team"}
+	query := func(q string) error {
+		return auth.AuthorizeQuery(team, parse(q), "db0")
+	}
+
+	assert.Nil(t, query(`SELECT * FROM cpu_total`))
+	assert.Nil(t, query(`SELECT * FROM mem, cpu`))
+	assert.Nil(t, query(`SELECT * FROM (SELECT * FROM mem)`))
+	assert.NotNil(t, query(`SELECT * FROM disk`))
+	assert.NotNil(t, query(`SELECT * FROM (SELECT * FROM disk)`))
+	assert.NotNil(t, query(`SELECT * FROM /.*/`))
+	assert.NotNil(t, query(`SELECT * INTO mem_1h FROM cpu`))
+	assert.NotNil(t, query(`SHOW TAG KEYS`))
+	assert.Nil(t, query(`SHOW TAG KEYS FROM cpu`))
+	assert.NotNil(t, query(`DROP MEASUREMENT mem`))
+	assert.Nil(t, query(`DROP MEASUREMENT cpu`))
+	// not restricted on other databases or for other users
+	assert.Nil(t, auth.AuthorizeQuery(team, parse(`SELECT * FROM db1..disk`), "db0"))
+	assert.Nil(t, auth.AuthorizeQuery(&meta.UserInfo{Name: "other"}, parse(`SELECT * FROM disk`), "db0"))
+
+	points := func(lines string) []models.Point {
+		pts, err := models.ParsePointsString(lines)
+		assert.Nil(t, err)
+		return pts
+	}
+	assert.Nil(t, auth.AuthorizeWritePoints(team, "db0", points("cpu value=1\ncpu_load value=2")))
+	assert.NotNil(t, auth.AuthorizeWritePoints(team, "db0", points("cpu value=1\nmem value=2")))
+	assert.Nil(t, auth.AuthorizeWritePoints(&meta.UserInfo{Name: "other"}, "db0", points("mem value=2")))
+
+	// revoking all grants makes the user unrestricted again
+	assert.Nil(t, data.SetMeasurementPrivilege("team", "db0", "cpu*", influxql.NoPrivileges))
+	assert.Nil(t, data.SetMeasurementPrivilege("team", "db0", "mem", influxql.NoPrivileges))
+	assert.Nil(t, query(`SELECT * FROM disk`))
+	assert.Equal(t, 0, len(data.MeasurementPrivileges))
+
+	// cleaned up along with user
+	assert.Nil(t, data.SetMeasurementPrivilege("team", "db0", "cpu*", influxql.ReadPrivilege))
+	assert.Nil(t, data.DropUser("team"))
+	assert.Equal(t, 0, len(data.MeasurementPrivileges))
+}
+
+func TestMetaClient_AuthorizeQuery(t *testing.T) {
+	dir, c := newClient()
+	defer os.RemoveAll(dir)
+	defer c.Close()
+
+	_, err := c.CreateDatabase("db0")
+	assert.Nil(t, err)
+	_, err = c.CreateDatabase("db1")
+	assert.Nil(t, err)
+	_, err = c.CreateUser("admin", hashPassword("pw"), true)
+	assert.Nil(t, err)
+	_, err = c.CreateUser("team", hashPassword("pw"), false)
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetPrivilege("team", "db0", influxql.ReadPrivilege))
+	assert.Nil(t, c.SetPrivilege("team", "db1", influxql.ReadPrivilege))
+	assert.Nil(t, c.SetMeasurementPrivilege("team", "db0", "cpu*", influxql.ReadPrivilege))
+
+	denial := func(u, q string) *imeta.QueryDenial {
+		stmt, err := influxql.ParseStatement(q)
+		assert.Nil(t, err)
+		err = c.AuthorizeQuery(&meta.UserInfo{Name: u}, stmt, "db0")
+		if err == nil {
+			return nil
+		}
+		d, ok := err.(*imeta.QueryDenial)
+		assert.True(t, ok, err.Error())
+		return d
+	}
+
+	assert.Nil(t, denial("admin", `DROP DATABASE db0`))
+	assert.Nil(t, denial("team", `SELECT * FROM cpu`))
+	assert.Nil(t, denial("team", `SELECT * FROM db1..mem`))
+
+	d := denial("team", `DROP DATABASE db0`)
+	assert.True(t, d.Admin)
+	d = denial("team", `SELECT * INTO db0..cpu_1h FROM cpu`)
+	assert.Equal(t, "db0", d.Database)
+	assert.Equal(t, influxql.WritePrivilege, d.Privilege)
+	assert.Equal(t, "", d.Measurement)
+	d = denial("team", `SELECT * FROM mem`)
+	assert.Equal(t, "db0", d.Database)
+	assert.Equal(t, "mem", d.Measurement)
+	assert.Equal(t, influxql.ReadPrivilege, d.Privilege)
+	d = denial("team", `SELECT * FROM db2..cpu`)
+	assert.Equal(t, "db2", d.Database)
+	d = denial("nobody", `SELECT * FROM cpu`)
+	assert.Equal(t, "nobody", d.User)
+	assert.Contains(t, d.Error(), "user not found")
+}
+
+func TestMetaClient_AuthorizeSources(t *testing.T) {
+	dir, c := newClient()
+	defer os.RemoveAll(dir)
+	defer c.Close()
+
+	for _, db := range []string{"db0", "db1", "db2"} {
+		_, err := c.CreateDatabase(db)
+		assert.Nil(t, err)
+	}
+	_, err := c.CreateUser("admin", hashPassword("pw"), true)
+	assert.Nil(t, err)
+	_, err = c.CreateUser("team", hashPassword("pw"), false)
+	assert.Nil(t, err)
+	assert.Nil(t, c.SetPrivilege("team", "db0", influxql.ReadPrivilege))
+	assert.Nil(t, c.SetPrivilege("team", "db1", influxql.ReadPrivilege))
+	assert.Nil(t, c.SetMeasurementPrivilege("team", "db1", "cpu*", influxql.ReadPrivilege))
+
+	denials := func(u, q string) imeta.QueryDenials {
+		stmt, err := influxql.ParseStatement(q)
+		assert.Nil(t, err)
+		err = c.AuthorizeSources(&meta.UserInfo{Name: u}, stmt, "db0")
+		if err == nil {
+			return nil
+		}
+		d, ok := err.(imeta.QueryDenials)
+		assert.True(t, ok, err.Error())
+		return d
+	}
+
+	assert.Nil(t, denials("admin", `SELECT * FROM db2..cpu`))
+	assert.Nil(t, denials("team", `SELECT * FROM cpu, db1..cpu`))
+	assert.Nil(t, denials("team", `SHOW TAG KEYS ON db1 FROM cpu`))
+
+	// every source denied is reported, not only the first one
+	ds := denials("team", `SELECT * FROM mem, db1..mem, db2..cpu, (SELECT * FROM db2..disk)`)
+	assert.Len(t, ds, 3)
+	assert.Equal(t, "db1", ds[0].Database)
+	assert.Equal(t, "db1..mem", ds[0].Measurement)
+	assert.Equal(t, "db2", ds[1].Database)
+	assert.Equal(t, "db2..cpu", ds[1].Measurement)
+	assert.Equal(t, influxql.ReadPrivilege, ds[1].Privilege)
+	assert.Equal(t, "db2..disk", ds[2].Measurement)
+	assert.Contains(t, ds.Error(), "READ on db2 for db2..cpu")
+
+	ds = denials("team", `SELECT * INTO db2..cpu_1h FROM cpu`)
+	assert.Len(t, ds, 1)
+	assert.Equal(t, influxql.WritePrivilege, ds[0].Privilege)
+	ds = denials("team", `DROP SERIES FROM cpu`)
+	assert.Len(t, ds, 1)
+	assert.Equal(t, "db0", ds[0].Database)
+	assert.Equal(t, influxql.WritePrivilege, ds[0].Privilege)
+	ds = denials("team", `SHOW SERIES ON db2 FROM cpu`)
+	assert.Len(t, ds, 1)
+	assert.Equal(t, "db2", ds[0].Database)
+	ds = denials("team", `SHOW TAG KEYS ON db1`)
+	assert.Len(t, ds, 1)
+	assert.Contains(t, ds.Error(), "without FROM clause")
+
+	ds = denials("nobody", `SELECT * FROM cpu`)
+	assert.Len(t, ds, 1)
+	assert.Contains(t, ds.Error(), "user not found")
+}
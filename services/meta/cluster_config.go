@@ -0,0 +1,258 @@
+package meta
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Kinds of cluster config values.
+const (
+	ConfigKindBool     = "bool"
+	ConfigKindInt      = "int"
+	ConfigKindDuration = "duration"
+	ConfigKindString   = "string"
+	ConfigKindFeature  = "feature"
+	ConfigKindRates    = "rates"
+)
+
+// Keys of cluster config known by nodes.
+const (
+	// ConfigPrecreationHorizon is how far ahead of now shard groups are
+	// precreated, overriding advance-period of precreator.
+	ConfigPrecreationHorizon = "precreation-horizon"
+	// ConfigCopyShardRate is the rate in bytes per second of copying shards
+	// outside copy_shard_windows, overriding copy_shard_rate of controller.
+	ConfigCopyShardRate = "copy-shard-rate"
+	// ConfigSessionTTL is how long sessions of users signed in last, 0 to
+	// disable signing in.
+	ConfigSessionTTL = "session-ttl"
+	// ConfigMaxUserSessions is how many sessions each user keeps, the ones
+	// expiring first end on signing in beyond it, 0 for unlimited.
+	ConfigMaxUserSessions = "max-user-sessions"
+	// ConfigMaxDatabases, ConfigMaxRetentionPolicies and ConfigMaxUsers limit
+	// databases, retention policies of each database and users created, 0
+	// for unlimited.
+	ConfigMaxDatabases         = "max-databases"
+	ConfigMaxRetentionPolicies = "max-retention-policies"
+	ConfigMaxUsers             = "max-users"
+	// ConfigWriteRateLimit and ConfigWriteRateBurst are the token bucket of
+	// bytes of write requests per second served by each node, of all
+	// databases. ConfigDatabaseWriteRates are the ones of each database.
+	// Writes exceeding them are answered 429 with Retry-After.
+	ConfigWriteRateLimit     = "write-rate-limit"
+	ConfigWriteRateBurst     = "write-rate-burst"
+	ConfigDatabaseWriteRates = "database-write-rates"
+	// ConfigReadOnly makes all nodes reject writes while queries go on, e.g.
+	// during storage incidents, restores and migrations.
+	ConfigReadOnly = "read-only"
+)
+
+// ClusterConfigKey describes a key of cluster config.
+type ClusterConfigKey struct {
+	Name  string
+	Kind  string
+	Usage string
+}
+
+var clusterConfigKeys = map[string]ClusterConfigKey{}
+
+func init() {
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigPrecreationHorizon,
+		Kind:  ConfigKindDuration,
+		Usage: "how far ahead shard groups are precreated, like 30m",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigCopyShardRate,
+		Kind:  ConfigKindInt,
+		Usage: "bytes per second of copying shards outside copy_shard_windows, 0 for unlimited",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigSessionTTL,
+		Kind:  ConfigKindDuration,
+		Usage: "how long sessions of users signed in last, like 1h, 0 to disable signing in",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigMaxUserSessions,
+		Kind:  ConfigKindInt,
+		Usage: "max number of sessions of each user, 16 if not set, 0 for unlimited",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigMaxDatabases,
+		Kind:  ConfigKindInt,
+		Usage: "max number of databases, 0 for unlimited",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigMaxRetentionPolicies,
+		Kind:  ConfigKindInt,
+		Usage: "max number of retention policies of each database, 0 for unlimited",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigMaxUsers,
+		Kind:  ConfigKindInt,
+		Usage: "max number of users, 0 for unlimited",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigReadOnly,
+		Kind:  ConfigKindBool,
+		Usage: "true to reject writes of all nodes while queries go on",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigWriteRateLimit,
+		Kind:  ConfigKindInt,
+		Usage: "bytes per second of write requests served by each node, 0 for unlimited",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigWriteRateBurst,
+		Kind:  ConfigKindInt,
+		Usage: "bytes write requests may burst to above write-rate-limit, write-rate-limit if not set",
+	})
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  ConfigDatabaseWriteRates,
+		Kind:  ConfigKindRates,
+		Usage: "bytes per second of write requests of databases served by each node, like db0=1048576,db1=524288:4194304 with burst",
+	})
+}
+
+// RegisterClusterConfigKey makes key settable in cluster config. It must be
+// called at init, nodes of a cluster should know the same keys.
+func RegisterClusterConfigKey(key ClusterConfigKey) {
+	if _, ok := clusterConfigKeys[key.Name]; ok {
+		panic(fmt.Sprintf("cluster config key %s registered twice", key.Name))
+	}
+	clusterConfigKeys[key.Name] = key
+}
+
+// ClusterConfigKeys returns all known keys of cluster config sorted by name.
+func ClusterConfigKeys() []ClusterConfigKey {
+	keys := make([]ClusterConfigKey, 0, len(clusterConfigKeys))
+	for _, k := range clusterConfigKeys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+// ValidateClusterConfig returns an error if value could not be set to key.
+func ValidateClusterConfig(key, value string) error {
+	k, ok := clusterConfigKeys[key]
+	if !ok {
+		return ErrClusterConfigUnknown
+	}
+	var err error
+	switch k.Kind {
+	case ConfigKindBool:
+		_, err = strconv.ParseBool(value)
+	case ConfigKindInt:
+		var n int64
+		if n, err = strconv.ParseInt(value, 10, 64); err == nil && n < 0 {
+			err = fmt.Errorf("negative value")
+		}
+	case ConfigKindDuration:
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil && d < 0 {
+			err = fmt.Errorf("negative duration")
+		}
+	case ConfigKindFeature:
+		_, _, err = parseFeature(value)
+	case ConfigKindRates:
+		_, err = parseDatabaseWriteRates(value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q of %s: %s", k.Kind, value, key, err)
+	}
+	return nil
+}
+
+// ClusterConfig is runtime settings shared by all nodes of the cluster, keyed
+// by the name of ClusterConfigKey. Values are validated when set, nodes fall
+// back to their own config for keys not set.
+type ClusterConfig map[string]string
+
+func (c ClusterConfig) clone() ClusterConfig {
+	if c == nil {
+		return nil
+	}
+	other := make(ClusterConfig, len(c))
+	for k, v := range c {
+		other[k] = v
+	}
+	return other
+}
+
+func (c ClusterConfig) equal(other ClusterConfig) bool {
+	if len(c) != len(other) {
+		return false
+	}
+	for k, v := range c {
+		if ov, ok := other[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the value of key and whether it's set.
+func (c ClusterConfig) String(key string) (string, bool) {
+	v, ok := c[key]
+	return v, ok
+}
+
+// Bool returns the value of key and whether it's set.
+func (c ClusterConfig) Bool(key string) (bool, bool) {
+	v, ok := c[key]
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(v)
+	return b, err == nil
+}
+
+// Int returns the value of key and whether it's set.
+func (c ClusterConfig) Int(key string) (int64, bool) {
+	v, ok := c[key]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	return n, err == nil
+}
+
+// Duration returns the value of key and whether it's set.
+func (c ClusterConfig) Duration(key string) (time.Duration, bool) {
+	v, ok := c[key]
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(v)
+	return d, err == nil
+}
+
+// ReadOnly returns whether writes of all nodes are rejected.
+func (c ClusterConfig) ReadOnly() bool {
+	readOnly, _ := c.Bool(ConfigReadOnly)
+	return readOnly
+}
+
+// SetClusterConfig sets key of cluster config to value.
+func (data *Data) SetClusterConfig(key, value string) error {
+	if err := ValidateClusterConfig(key, value); err != nil {
+		return err
+	}
+	if data.ClusterConfig == nil {
+		data.ClusterConfig = make(ClusterConfig)
+	}
+	data.ClusterConfig[key] = value
+	return nil
+}
+
+// DeleteClusterConfig unsets key of cluster config.
+func (data *Data) DeleteClusterConfig(key string) error {
+	if _, ok := data.ClusterConfig[key]; !ok {
+		return ErrClusterConfigNotFound
+	}
+	delete(data.ClusterConfig, key)
+	return nil
+}
@@ -19,7 +19,126 @@ type Data struct {
 	DataNodes        []meta.NodeInfo
 	FreezedDataNodes []uint64 // data nodes that can't create new shard on
 
-	MaxNodeID uint64
+	// DefaultRetentionPolicy is used for auto created retention policy of new
+	// databases instead of the builtin one if set
+	DefaultRetentionPolicy *RetentionPolicyTemplate
+	DatabaseTemplates      []DatabaseTemplate
+	// MeasurementPrivileges keyed by user and database
+	MeasurementPrivileges map[string]map[string][]MeasurementPrivilege
+	// UserLocks are when users locked by failed authentications are unlocked
+	UserLocks map[string]time.Time
+	// OperatorRoles of users on the controller API, keyed by user
+	OperatorRoles map[string]OperatorRole
+	// APITokens and BucketMappings serve the InfluxDB 2.x compatible API
+	APITokens      []APIToken
+	BucketMappings []BucketMapping
+	// Sessions of users signed in keyed by the hash of their tokens,
+	// expired ones are pruned periodically by the leader and on sign in
+	Sessions map[string]Session
+	// ClusterConfig is runtime settings shared by all nodes
+	ClusterConfig ClusterConfig
+	// HintedHandoffPolicies of databases and retention policies
+	HintedHandoffPolicies []HintedHandoffPolicy
+	// ReadOnlyShards rejecting writes, sorted
+	ReadOnlyShards []uint64
+	// ShardCutovers of shards moving to new owners, writes to them are held
+	ShardCutovers []ShardCutover
+	// StaleShards are copies of shards missing writes, repaired by catch-up
+	StaleShards []StaleShard
+	// MeasurementTombstones of measurements dropped, until applied by all
+	// data nodes
+	MeasurementTombstones []MeasurementTombstone
+	// ShardGroupAlignments of retention policies with calendar aligned groups
+	ShardGroupAlignments []ShardGroupAlignment
+	// ShardGroupFreeze holds creation of shard groups during a snapshot
+	ShardGroupFreeze *ShardGroupFreeze
+	// MaintenanceWindows of data nodes, until ended
+	MaintenanceWindows []MaintenanceWindow
+	// SealedShards of shard groups whose write window passed, sorted
+	SealedShards []SealedShard
+	// NodeIncarnations of data nodes registered a start, sorted
+	NodeIncarnations []NodeIncarnation
+
+	MaxNodeID                 uint64
+	MaxAPITokenID             uint64
+	MaxMeasurementTombstoneID uint64
+	MaxMaintenanceWindowID    uint64
+	MaxIncarnation            uint64
+}
+
+// RetentionPolicyTemplate describes the retention policy created along with
+// a database cluster-wide.
+type RetentionPolicyTemplate struct {
+	Name               string
+	Duration           time.Duration
+	ShardGroupDuration time.Duration
+	ReplicaN           int
+	// ShardGroupAlignment is the calendar unit shard groups are aligned to,
+	// epoch-relative if empty
+	ShardGroupAlignment string `json:",omitempty"`
+}
+
+// Validate returns an error if the template can't produce a valid retention policy.
+func (t *RetentionPolicyTemplate) Validate() error {
+	if t.Name == "" {
+		return meta.ErrRetentionPolicyNameRequired
+	} else if t.ReplicaN < 1 {
+		return meta.ErrReplicationFactorTooLow
+	} else if t.Duration != 0 && t.Duration < meta.MinRetentionPolicyDuration {
+		return meta.ErrRetentionPolicyDurationTooLow
+	} else if t.Duration != 0 && t.Duration < t.ShardGroupDuration {
+		return meta.ErrIncompatibleDurations
+	} else if !validShardGroupAlignment(t.ShardGroupAlignment) {
+		return ErrInvalidShardGroupAlignment
+	}
+	return nil
+}
+
+// RetentionPolicyInfo returns a new retention policy with shard group duration normalized.
+func (t *RetentionPolicyTemplate) RetentionPolicyInfo() *meta.RetentionPolicyInfo {
+	spec := &meta.RetentionPolicySpec{
+		Name:               t.Name,
+		Duration:           &t.Duration,
+		ShardGroupDuration: t.ShardGroupDuration,
+		ReplicaN:           &t.ReplicaN,
+	}
+	return spec.NewRetentionPolicyInfo()
+}
+
+// SetDefaultRetentionPolicy sets the template of retention policy auto created,
+// a nil template restores the builtin default.
+func (data *Data) SetDefaultRetentionPolicy(t *RetentionPolicyTemplate) error {
+	if t == nil {
+		data.DefaultRetentionPolicy = nil
+		return nil
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	other := *t
+	data.DefaultRetentionPolicy = &other
+	return nil
+}
+
+// DefaultRetentionPolicyInfo returns the retention policy to be auto created for new database.
+func (data *Data) DefaultRetentionPolicyInfo() *meta.RetentionPolicyInfo {
+	if data.DefaultRetentionPolicy == nil {
+		return meta.DefaultRetentionPolicyInfo()
+	}
+	return data.DefaultRetentionPolicy.RetentionPolicyInfo()
+}
+
+// CreateDefaultRetentionPolicy creates the retention policy auto created for
+// new database as its default one, with the alignment of its template.
+func (data *Data) CreateDefaultRetentionPolicy(database string) error {
+	rpi := data.DefaultRetentionPolicyInfo()
+	if err := data.CreateRetentionPolicy(database, rpi, true); err != nil {
+		return err
+	}
+	if t := data.DefaultRetentionPolicy; t != nil && t.ShardGroupAlignment != AlignEpoch {
+		return data.SetShardGroupAlignment(database, rpi.Name, t.ShardGroupAlignment)
+	}
+	return nil
 }
 
 // DataNode returns a node by id.
@@ -152,6 +271,7 @@ func (data *Data) DeleteDataNode(id uint64) error {
 		return ErrNodeNotFound
 	}
 	data.DataNodes = nodes
+	data.dropNodeIncarnation(id)
 
 	// Remove node id from all shard infos
 	for di, d := range data.Databases {
@@ -226,6 +346,9 @@ func (data *Data) DeleteDataNode(id uint64) error {
 	if i := getFreezed(data.FreezedDataNodes, id); i > -1 {
 		data.FreezedDataNodes = append(data.FreezedDataNodes[:i], data.FreezedDataNodes[i+1:]...)
 	}
+	data.pruneStaleShards(func(s StaleShard) bool { return s.NodeID != id })
+	data.ackNodeMeasurementTombstones(id)
+	data.removeMaintenanceNode(id)
 
 	return nil
 }
@@ -353,6 +476,69 @@ func (data *Data) Clone() *Data {
 	other.MetaNodes = cloneNodes(data.MetaNodes)
 	other.FreezedDataNodes = make([]uint64, len(data.FreezedDataNodes))
 	copy(other.FreezedDataNodes, data.FreezedDataNodes)
+	if data.DefaultRetentionPolicy != nil {
+		t := *data.DefaultRetentionPolicy
+		other.DefaultRetentionPolicy = &t
+	}
+	other.MeasurementPrivileges = cloneMeasurementPrivileges(data.MeasurementPrivileges)
+	other.UserLocks = cloneUserLocks(data.UserLocks)
+	other.OperatorRoles = cloneOperatorRoles(data.OperatorRoles)
+	if data.APITokens != nil {
+		other.APITokens = append([]APIToken(nil), data.APITokens...)
+	}
+	if data.BucketMappings != nil {
+		other.BucketMappings = append([]BucketMapping(nil), data.BucketMappings...)
+	}
+	if data.Sessions != nil {
+		other.Sessions = make(map[string]Session, len(data.Sessions))
+		for hash, s := range data.Sessions {
+			other.Sessions[hash] = s
+		}
+	}
+	if data.DatabaseTemplates != nil {
+		other.DatabaseTemplates = make([]DatabaseTemplate, len(data.DatabaseTemplates))
+		for i := range data.DatabaseTemplates {
+			other.DatabaseTemplates[i] = data.DatabaseTemplates[i].clone()
+		}
+	}
+	other.ClusterConfig = data.ClusterConfig.clone()
+	if data.HintedHandoffPolicies != nil {
+		other.HintedHandoffPolicies = append([]HintedHandoffPolicy(nil), data.HintedHandoffPolicies...)
+	}
+	if data.ReadOnlyShards != nil {
+		other.ReadOnlyShards = append([]uint64(nil), data.ReadOnlyShards...)
+	}
+	if data.ShardCutovers != nil {
+		other.ShardCutovers = append([]ShardCutover(nil), data.ShardCutovers...)
+	}
+	if data.StaleShards != nil {
+		other.StaleShards = append([]StaleShard(nil), data.StaleShards...)
+	}
+	if data.MeasurementTombstones != nil {
+		other.MeasurementTombstones = make([]MeasurementTombstone, len(data.MeasurementTombstones))
+		for i := range data.MeasurementTombstones {
+			other.MeasurementTombstones[i] = data.MeasurementTombstones[i].clone()
+		}
+	}
+	if data.ShardGroupAlignments != nil {
+		other.ShardGroupAlignments = append([]ShardGroupAlignment(nil), data.ShardGroupAlignments...)
+	}
+	if data.ShardGroupFreeze != nil {
+		f := *data.ShardGroupFreeze
+		other.ShardGroupFreeze = &f
+	}
+	if data.MaintenanceWindows != nil {
+		other.MaintenanceWindows = make([]MaintenanceWindow, len(data.MaintenanceWindows))
+		for i := range data.MaintenanceWindows {
+			other.MaintenanceWindows[i] = data.MaintenanceWindows[i].clone()
+		}
+	}
+	if data.SealedShards != nil {
+		other.SealedShards = append([]SealedShard(nil), data.SealedShards...)
+	}
+	if data.NodeIncarnations != nil {
+		other.NodeIncarnations = append([]NodeIncarnation(nil), data.NodeIncarnations...)
+	}
 
 	return &other
 }
@@ -363,6 +549,37 @@ type DataJson struct {
 	DataNodes        []meta.NodeInfo
 	MaxNodeID        uint64
 	FreezedDataNodes []uint64
+
+	DefaultRetentionPolicy *RetentionPolicyTemplate `json:",omitempty"`
+	DatabaseTemplates      []DatabaseTemplate       `json:",omitempty"`
+
+	MeasurementPrivileges map[string]map[string][]MeasurementPrivilege `json:",omitempty"`
+	OperatorRoles         map[string]OperatorRole                      `json:",omitempty"`
+	UserLocks             map[string]time.Time                         `json:",omitempty"`
+
+	APITokens      []APIToken      `json:",omitempty"`
+	MaxAPITokenID  uint64          `json:",omitempty"`
+	BucketMappings []BucketMapping `json:",omitempty"`
+	Sessions       []Session       `json:",omitempty"`
+
+	ClusterConfig         ClusterConfig         `json:",omitempty"`
+	HintedHandoffPolicies []HintedHandoffPolicy `json:",omitempty"`
+	ReadOnlyShards        []uint64              `json:",omitempty"`
+	ShardCutovers         []ShardCutover        `json:",omitempty"`
+	StaleShards           []StaleShard          `json:",omitempty"`
+	ShardGroupAlignments  []ShardGroupAlignment `json:",omitempty"`
+	ShardGroupFreeze      *ShardGroupFreeze     `json:",omitempty"`
+
+	MeasurementTombstones     []MeasurementTombstone `json:",omitempty"`
+	MaxMeasurementTombstoneID uint64                 `json:",omitempty"`
+
+	MaintenanceWindows     []MaintenanceWindow `json:",omitempty"`
+	MaxMaintenanceWindowID uint64              `json:",omitempty"`
+
+	SealedShards []SealedShard `json:",omitempty"`
+
+	NodeIncarnations []NodeIncarnation `json:",omitempty"`
+	MaxIncarnation   uint64            `json:",omitempty"`
 }
 
 func (data *Data) marshal() ([]byte, error) {
@@ -371,6 +588,29 @@ func (data *Data) marshal() ([]byte, error) {
 	js.DataNodes = data.DataNodes
 	js.MaxNodeID = data.MaxNodeID
 	js.FreezedDataNodes = data.FreezedDataNodes
+	js.DefaultRetentionPolicy = data.DefaultRetentionPolicy
+	js.DatabaseTemplates = data.DatabaseTemplates
+	js.MeasurementPrivileges = data.MeasurementPrivileges
+	js.OperatorRoles = data.OperatorRoles
+	js.UserLocks = data.UserLocks
+	js.APITokens = data.APITokens
+	js.MaxAPITokenID = data.MaxAPITokenID
+	js.BucketMappings = data.BucketMappings
+	js.Sessions = sessionList(data.Sessions)
+	js.ClusterConfig = data.ClusterConfig
+	js.HintedHandoffPolicies = data.HintedHandoffPolicies
+	js.ReadOnlyShards = data.ReadOnlyShards
+	js.ShardCutovers = data.ShardCutovers
+	js.StaleShards = data.StaleShards
+	js.MeasurementTombstones = data.MeasurementTombstones
+	js.MaxMeasurementTombstoneID = data.MaxMeasurementTombstoneID
+	js.ShardGroupAlignments = data.ShardGroupAlignments
+	js.ShardGroupFreeze = data.ShardGroupFreeze
+	js.MaintenanceWindows = data.MaintenanceWindows
+	js.MaxMaintenanceWindowID = data.MaxMaintenanceWindowID
+	js.SealedShards = data.SealedShards
+	js.NodeIncarnations = data.NodeIncarnations
+	js.MaxIncarnation = data.MaxIncarnation
 	var err error
 	js.Data, err = data.Data.MarshalBinary()
 	if err != nil {
@@ -392,6 +632,29 @@ func (data *Data) unmarshal(buf []byte) error {
 	data.DataNodes = js.DataNodes
 	data.MaxNodeID = js.MaxNodeID
 	data.FreezedDataNodes = js.FreezedDataNodes
+	data.DefaultRetentionPolicy = js.DefaultRetentionPolicy
+	data.DatabaseTemplates = js.DatabaseTemplates
+	data.MeasurementPrivileges = js.MeasurementPrivileges
+	data.OperatorRoles = js.OperatorRoles
+	data.UserLocks = js.UserLocks
+	data.APITokens = js.APITokens
+	data.MaxAPITokenID = js.MaxAPITokenID
+	data.BucketMappings = js.BucketMappings
+	data.Sessions = sessionMap(js.Sessions)
+	data.ClusterConfig = js.ClusterConfig
+	data.HintedHandoffPolicies = js.HintedHandoffPolicies
+	data.ReadOnlyShards = js.ReadOnlyShards
+	data.ShardCutovers = js.ShardCutovers
+	data.StaleShards = js.StaleShards
+	data.MeasurementTombstones = js.MeasurementTombstones
+	data.MaxMeasurementTombstoneID = js.MaxMeasurementTombstoneID
+	data.ShardGroupAlignments = js.ShardGroupAlignments
+	data.ShardGroupFreeze = js.ShardGroupFreeze
+	data.MaintenanceWindows = js.MaintenanceWindows
+	data.MaxMaintenanceWindowID = js.MaxMaintenanceWindowID
+	data.SealedShards = js.SealedShards
+	data.NodeIncarnations = js.NodeIncarnations
+	data.MaxIncarnation = js.MaxIncarnation
 	return data.Data.UnmarshalBinary(js.Data)
 }
 
@@ -426,6 +689,28 @@ func (data *Data) CreateShardGroup(database, policy string, timestamp time.Time)
 		return nil
 	}
 
+	start := timestamp.Truncate(rpi.ShardGroupDuration)
+	end := start.Add(rpi.ShardGroupDuration)
+	if unit := data.ShardGroupAlignment(database, policy); unit != AlignEpoch {
+		start, end = alignedShardGroup(rpi, unit, timestamp)
+	}
+	sgi, err := data.newShardGroup(rpi, start.UTC(), end.Sub(start))
+	if err != nil {
+		return err
+	}
+
+	// Retention policy has a new shard group, so update the policy. Shard
+	// Groups must be stored in sorted order, as other parts of the system
+	// assume this to be the case.
+	rpi.ShardGroups = append(rpi.ShardGroups, sgi)
+	sort.Sort(meta.ShardGroupInfos(rpi.ShardGroups))
+
+	return nil
+}
+
+// newShardGroup returns a shard group of rpi from start lasting duration, with
+// shards on nodes not freezed.
+func (data *Data) newShardGroup(rpi *meta.RetentionPolicyInfo, start time.Time, duration time.Duration) (meta.ShardGroupInfo, error) {
 	// Don't create shard on freezed nodes
 	availableNodes := make([]meta.NodeInfo, 0, len(data.DataNodes))
 	freezedNodes := make(map[uint64]bool)
@@ -447,7 +732,7 @@ func (data *Data) CreateShardGroup(database, policy string, timestamp time.Time)
 		replicaN = len(availableNodes)
 	}
 	if replicaN < 1 {
-		return errors.New("No replica can be assigned")
+		return meta.ShardGroupInfo{}, errors.New("No replica can be assigned")
 	}
 
 	// Determine shard count by node count divided by replication factor.
@@ -459,8 +744,8 @@ func (data *Data) CreateShardGroup(database, policy string, timestamp time.Time)
 	data.MaxShardGroupID++
 	sgi := meta.ShardGroupInfo{}
 	sgi.ID = data.MaxShardGroupID
-	sgi.StartTime = timestamp.Truncate(rpi.ShardGroupDuration).UTC()
-	sgi.EndTime = sgi.StartTime.Add(rpi.ShardGroupDuration).UTC()
+	sgi.StartTime = start
+	sgi.EndTime = sgi.StartTime.Add(duration).UTC()
 	if sgi.EndTime.After(time.Unix(0, models.MaxNanoTime)) {
 		// Shard group range is [start, end) so add one to the max time.
 		sgi.EndTime = time.Unix(0, models.MaxNanoTime+1)
@@ -484,28 +769,73 @@ func (data *Data) CreateShardGroup(database, policy string, timestamp time.Time)
 			nodeIndex++
 		}
 	}
+	return sgi, nil
+}
 
-	// Retention policy has a new shard group, so update the policy. Shard
-	// Groups must be stored in sorted order, as other parts of the system
-	// assume this to be the case.
-	rpi.ShardGroups = append(rpi.ShardGroups, sgi)
-	sort.Sort(meta.ShardGroupInfos(rpi.ShardGroups))
+// ReassignShardGroups moves writes from t on of shard groups with shards on
+// the freezed node to successor groups on other nodes. Groups are truncated at
+// t, or at their start if they begin later, and the successors cover the rest
+// of their time range. Data before t stays on the node to be migrated.
+func (data *Data) ReassignShardGroups(id uint64, t time.Time) error {
+	if !data.IsFreezeDataNode(id) {
+		return ErrNodeNotFreezed
+	}
+
+	for i := range data.Databases {
+		dbi := &data.Databases[i]
+		for j := range dbi.RetentionPolicies {
+			rpi := &dbi.RetentionPolicies[j]
+			var successors []meta.ShardGroupInfo
+			for k := range rpi.ShardGroups {
+				sgi := &rpi.ShardGroups[k]
+				if sgi.Deleted() || !t.Before(sgi.EndTime) || !ownedBy(sgi, id) {
+					continue
+				}
+				from := t.UTC()
+				if from.Before(sgi.StartTime) {
+					from = sgi.StartTime
+				}
+				if sgi.Truncated() && !sgi.TruncatedAt.After(from) {
+					continue
+				}
 
+				succ, err := data.newShardGroup(rpi, from, sgi.EndTime.Sub(from))
+				if err != nil {
+					return err
+				}
+				sgi.TruncatedAt = from
+				successors = append(successors, succ)
+			}
+			if len(successors) > 0 {
+				rpi.ShardGroups = append(rpi.ShardGroups, successors...)
+				sort.Sort(meta.ShardGroupInfos(rpi.ShardGroups))
+			}
+		}
+	}
 	return nil
 }
 
-func (data *Data) AddShardOwner(id, nodeID uint64) {
+func ownedBy(sgi *meta.ShardGroupInfo, id uint64) bool {
+	for _, si := range sgi.Shards {
+		if si.OwnedBy(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (data *Data) AddShardOwner(id ShardID, nodeID NodeID) {
 	for dbidx, dbi := range data.Databases {
 		for rpidx, rpi := range dbi.RetentionPolicies {
 			for sgidx, sg := range rpi.ShardGroups {
 				for sidx, s := range sg.Shards {
-					if s.ID == id {
+					if s.ID == uint64(id) {
 						for _, owner := range s.Owners {
-							if owner.NodeID == nodeID {
+							if owner.NodeID == uint64(nodeID) {
 								return
 							}
 						}
-						s.Owners = append(s.Owners, meta.ShardOwner{NodeID: nodeID})
+						s.Owners = append(s.Owners, meta.ShardOwner{NodeID: uint64(nodeID)})
 						data.Databases[dbidx].RetentionPolicies[rpidx].ShardGroups[sgidx].Shards[sidx] = s
 						return
 					}
@@ -515,15 +845,15 @@ func (data *Data) AddShardOwner(id, nodeID uint64) {
 	}
 }
 
-func (data *Data) RemoveShardOwner(id, nodeID uint64) {
+func (data *Data) RemoveShardOwner(id ShardID, nodeID NodeID) {
 	for dbidx, dbi := range data.Databases {
 		for rpidx, rpi := range dbi.RetentionPolicies {
 			for sgidx, sg := range rpi.ShardGroups {
 				for sidx, s := range sg.Shards {
 					var newOwners []meta.ShardOwner
-					if s.ID == id {
+					if s.ID == uint64(id) {
 						for _, owner := range s.Owners {
-							if owner.NodeID != nodeID {
+							if owner.NodeID != uint64(nodeID) {
 								newOwners = append(newOwners, owner)
 							}
 						}
@@ -557,3 +887,32 @@ func (data *Data) DeleteShardGroup(database, policy string, id uint64, t time.Ti
 
 	return meta.ErrShardGroupNotFound
 }
+
+// DropUser removes a user along with its measurement privileges, operator
+// role, lock, api tokens and sessions.
+func (data *Data) DropUser(name string) error {
+	if err := data.Data.DropUser(name); err != nil {
+		return err
+	}
+	data.dropUserMeasurementPrivileges(name)
+	data.dropUserOperatorRole(name)
+	data.dropUserLock(name)
+	data.dropUserAPITokens(name)
+	data.dropUserSessions(name)
+	return nil
+}
+
+// DropDatabase removes a database along with measurement privileges, bucket
+// mappings, hinted handoff policies, shard group alignments and marks of
+// shards on it.
+func (data *Data) DropDatabase(name string) error {
+	if err := data.Data.DropDatabase(name); err != nil {
+		return err
+	}
+	data.dropDatabaseMeasurementPrivileges(name)
+	data.dropDatabaseBucketMappings(name)
+	data.dropHintedHandoffPolicies(func(p *HintedHandoffPolicy) bool { return p.Database == name })
+	data.dropShardGroupAlignments(func(a *ShardGroupAlignment) bool { return a.Database == name })
+	data.pruneDroppedShards()
+	return nil
+}
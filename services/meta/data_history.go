@@ -0,0 +1,89 @@
+package meta
+
+// DefaultDataHistorySize is the versions of meta data a client keeps by
+// default for reads at past indexes.
+const DefaultDataHistorySize = 128
+
+// dataVersion is the data committed at index. The index is kept apart as
+// SetData resets the index of the data it replaces.
+type dataVersion struct {
+	index uint64
+	data  *Data
+}
+
+// dataHistory keeps the latest versions of meta data, oldest first. Data
+// committed is never changed afterwards, so versions share it with the cache.
+type dataHistory struct {
+	size     int
+	versions []dataVersion
+}
+
+func newDataHistory(size int) *dataHistory {
+	return &dataHistory{size: size}
+}
+
+// add keeps data as the version of its index. Versions not older, e.g. of
+// meta data restored from a snapshot, are replaced.
+func (h *dataHistory) add(data *Data) {
+	if h.size < 1 {
+		h.versions = nil
+		return
+	}
+	n := len(h.versions)
+	for n > 0 && h.versions[n-1].index >= data.Index {
+		n--
+	}
+	h.versions = append(h.versions[:n], dataVersion{index: data.Index, data: data})
+	h.trim()
+}
+
+func (h *dataHistory) trim() {
+	if over := len(h.versions) - h.size; over > 0 {
+		h.versions = append(h.versions[:0:0], h.versions[over:]...)
+	}
+}
+
+// at returns the version in effect at index, i.e. the latest committed not
+// after it, false if it's not kept.
+func (h *dataHistory) at(index uint64) (dataVersion, bool) {
+	n := len(h.versions)
+	if n == 0 || index < h.versions[0].index || index > h.versions[n-1].index {
+		return dataVersion{}, false
+	}
+	for i := n - 1; i >= 0; i-- {
+		if h.versions[i].index <= index {
+			return h.versions[i], true
+		}
+	}
+	return dataVersion{}, false
+}
+
+// SetDataHistorySize keeps the latest size versions of meta data for DataAt,
+// 0 keeps none.
+func (c *Client) SetDataHistorySize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history.size = size
+	if size < 1 {
+		c.history.versions = nil
+		return
+	}
+	c.history.trim()
+}
+
+// DataAt returns a clone of meta data as it was at index, the version
+// committed last at or before it, to tell e.g. the owners of shards when a
+// write at index happened. Index of the data returned is of that version.
+// ErrDataIndexNotRetained is returned for indexes older than the versions
+// kept or newer than the latest.
+func (c *Client) DataAt(index uint64) (*Data, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.history.at(index)
+	if !ok {
+		return nil, ErrDataIndexNotRetained
+	}
+	data := v.data.Clone()
+	data.Index = v.index
+	return data, nil
+}
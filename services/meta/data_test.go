@@ -1,11 +1,18 @@
 package meta_test
 
 import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/influxdata/influxdb"
 	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 
 	imeta "github.com/angopher/chronus/services/meta"
 )
@@ -255,6 +262,54 @@ func TestFreezeDataNode(t *testing.T) {
 	assert.Equal(t, []uint64{}, data.FreezedDataNodes)
 }
 
+func TestReassignShardGroups(t *testing.T) {
+	data := newData()
+	id1, id2 := initialTwoDataNodes(data)
+	name := "testdb"
+	policy := "rp"
+	data.CreateDatabase(name)
+	spec := meta.RetentionPolicySpec{Name: policy, ShardGroupDuration: time.Hour}
+	data.CreateRetentionPolicy(name, spec.NewRetentionPolicyInfo(), true)
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(90 * time.Minute)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, data.CreateShardGroup(name, policy, start.Add(time.Duration(i)*time.Hour)))
+	}
+	rp, _ := data.RetentionPolicy(name, policy)
+	for _, sg := range rp.ShardGroups {
+		assert.Equal(t, 2, len(sg.Shards))
+	}
+
+	assert.Equal(t, imeta.ErrNodeNotFreezed, data.ReassignShardGroups(id1, now))
+	assert.Nil(t, data.FreezeDataNode(id1))
+	assert.Nil(t, data.ReassignShardGroups(id1, now))
+
+	rp, _ = data.RetentionPolicy(name, policy)
+	assert.Equal(t, 5, len(rp.ShardGroups))
+	// history stays
+	assert.False(t, rp.ShardGroups[0].Truncated())
+	assert.Equal(t, rp.ShardGroups[0].ID, rp.ShardGroupByTimestamp(start).ID)
+	assert.Equal(t, uint64(2), rp.ShardGroupByTimestamp(now.Add(-time.Minute)).ID)
+
+	// writes from now on go to successors on other nodes
+	for _, ts := range []time.Time{now, start.Add(150 * time.Minute)} {
+		sg := rp.ShardGroupByTimestamp(ts)
+		assert.NotNil(t, sg)
+		assert.True(t, sg.ID > 3)
+		assert.Equal(t, 1, len(sg.Shards))
+		assert.Equal(t, id2, sg.Shards[0].Owners[0].NodeID)
+	}
+	succ := rp.ShardGroupByTimestamp(now)
+	assert.Equal(t, now, succ.StartTime)
+	assert.Equal(t, start.Add(2*time.Hour), succ.EndTime)
+
+	// done already
+	assert.Nil(t, data.ReassignShardGroups(id1, now))
+	rp, _ = data.RetentionPolicy(name, policy)
+	assert.Equal(t, 5, len(rp.ShardGroups))
+}
+
 func TestClone(t *testing.T) {
 	data1 := newData()
 	id1, id2 := initialTwoDataNodes(data1)
@@ -267,3 +322,898 @@ func TestClone(t *testing.T) {
 	assert.NotEqual(t, data1.FreezedDataNodes, data2.FreezedDataNodes)
 	assert.Equal(t, data3.FreezedDataNodes, data1.FreezedDataNodes)
 }
+
+func TestCreateDatabaseFromTemplate(t *testing.T) {
+	data := newData()
+	initialTwoDataNodes(data)
+	assert.Nil(t, data.CreateUser("reader", "hash", false))
+
+	tmpl := &imeta.DatabaseTemplate{
+		Name:                   "standard",
+		DefaultRetentionPolicy: "raw",
+		RetentionPolicies: []imeta.RetentionPolicyTemplate{
+			{Name: "raw", Duration: 7 * 24 * time.Hour, ReplicaN: 2},
+			{Name: "rollup", Duration: 0, ReplicaN: 1},
+		},
+		ContinuousQueries: []imeta.ContinuousQueryTemplate{{
+			Name:  "cq_1h",
+			Query: `CREATE CONTINUOUS QUERY cq_1h ON $database BEGIN SELECT mean(*) INTO $database.rollup.:MEASUREMENT FROM /.*/ GROUP BY time(1h), * END`,
+		}},
+		Subscriptions: []imeta.SubscriptionTemplate{
+			{Name: "sub0", RetentionPolicy: "raw", Mode: "ALL", Destinations: []string{"udp://127.0.0.1:9090"}},
+		},
+		Grants: []imeta.GrantTemplate{{User: "reader", Privilege: "read"}},
+	}
+	assert.Nil(t, data.CreateDatabaseTemplate(tmpl))
+	assert.Equal(t, imeta.ErrDatabaseTemplateExists, data.CreateDatabaseTemplate(tmpl))
+
+	bad := *tmpl
+	bad.Name = "bad"
+	bad.DefaultRetentionPolicy = "none"
+	assert.NotNil(t, data.CreateDatabaseTemplate(&bad))
+
+	assert.Equal(t, imeta.ErrDatabaseTemplateNotFound, data.CreateDatabaseFromTemplate("db0", "none"))
+	assert.Nil(t, data.CreateDatabaseFromTemplate("db0", "standard"))
+	assert.Equal(t, meta.ErrDatabaseExists, data.CreateDatabaseFromTemplate("db0", "standard"))
+
+	db := data.Database("db0")
+	assert.Equal(t, "raw", db.DefaultRetentionPolicy)
+	assert.Equal(t, 2, len(db.RetentionPolicies))
+	assert.Equal(t, 2, db.RetentionPolicy("raw").ReplicaN)
+	assert.Equal(t, 1, len(db.ContinuousQueries))
+	assert.Contains(t, db.ContinuousQueries[0].Query, "ON db0")
+	assert.Equal(t, 1, len(db.RetentionPolicy("raw").Subscriptions))
+	assert.Equal(t, influxql.ReadPrivilege, data.User("reader").(*meta.UserInfo).Privileges["db0"])
+
+	// survives marshaling
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	other := newData()
+	assert.Nil(t, other.UnmarshalBinary(buf))
+	assert.Equal(t, data.DatabaseTemplates, other.DatabaseTemplates)
+
+	assert.Nil(t, data.DropDatabaseTemplate("standard"))
+	assert.Equal(t, imeta.ErrDatabaseTemplateNotFound, data.DropDatabaseTemplate("standard"))
+	assert.NotNil(t, data.Database("db0"))
+}
+
+func TestAuthLockout(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.CreateUser("u0", "hash", false))
+	now := time.Unix(1600000000, 0)
+	until := now.Add(10 * time.Minute)
+
+	assert.Equal(t, meta.ErrUserNotFound, data.LockUser("nobody", until, now))
+	assert.Nil(t, data.LockUser("u0", until, now))
+	assert.True(t, data.UserLocked("u0", now))
+	assert.Equal(t, []imeta.LockedUser{{Name: "u0", LockedUntil: until}}, data.LockedUsers(now))
+	assert.False(t, data.UserLocked("u0", until))
+	assert.Equal(t, 0, len(data.LockedUsers(until)))
+
+	// expired locks are forgotten by the next lock
+	assert.Nil(t, data.CreateUser("u1", "hash", false))
+	assert.Nil(t, data.LockUser("u1", until.Add(time.Minute), until))
+	assert.Equal(t, 1, len(data.UserLocks))
+
+	other := data.Clone()
+	assert.Nil(t, other.UnlockUser("u1"))
+	assert.False(t, other.UserLocked("u1", until))
+	assert.True(t, data.UserLocked("u1", until))
+}
+
+func TestAuthFailures(t *testing.T) {
+	policy := imeta.LockoutPolicy{Attempts: 3, Window: time.Minute, Duration: 10 * time.Minute}
+	now := time.Unix(1600000000, 0)
+	var f imeta.AuthFailures
+
+	// failures out of window are not accumulated
+	assert.False(t, f.Fail("u0", false, now, policy))
+	assert.False(t, f.Fail("u0", false, now.Add(10*time.Second), policy))
+	assert.False(t, f.Fail("u0", false, now.Add(2*time.Minute), policy))
+	assert.False(t, f.Fail("u0", false, now.Add(2*time.Minute+time.Second), policy))
+	assert.True(t, f.Fail("u0", false, now.Add(2*time.Minute+2*time.Second), policy))
+	// counted again once locked
+	assert.False(t, f.Fail("u0", false, now.Add(2*time.Minute+3*time.Second), policy))
+
+	// forgotten after authenticated
+	f.Reset("u0")
+	assert.False(t, f.Fail("u0", false, now.Add(3*time.Minute), policy))
+	assert.False(t, f.Fail("u0", false, now.Add(3*time.Minute), policy))
+	f.Reset("u0")
+	assert.False(t, f.Fail("u0", false, now.Add(3*time.Minute), policy))
+
+	// admin users are exempted unless given their own threshold
+	for i := 0; i < 5; i++ {
+		assert.False(t, f.Fail("admin", true, now, policy))
+	}
+	policy.AdminAttempts = 5
+	for i := 0; i < 4; i++ {
+		assert.False(t, f.Fail("admin", true, now, policy))
+	}
+	assert.True(t, f.Fail("admin", true, now, policy))
+}
+
+func TestAPIToken(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.CreateUser("u0", "hash", false))
+	now := time.Unix(1600000000, 0).UTC()
+
+	token, err := imeta.GenerateAPIToken()
+	assert.Nil(t, err)
+	_, err = data.CreateAPIToken("nobody", imeta.HashAPIToken(token), "", now)
+	assert.Equal(t, meta.ErrUserNotFound, err)
+	info, err := data.CreateAPIToken("u0", imeta.HashAPIToken(token), "telegraf", now)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), info.ID)
+	_, err = data.CreateAPIToken("u0", imeta.HashAPIToken(token), "", now)
+	assert.Equal(t, imeta.ErrAPITokenExists, err)
+
+	assert.Equal(t, "u0", data.APITokenUser(token).Name)
+	assert.Nil(t, data.APITokenUser("unknown"))
+	assert.Equal(t, 1, len(data.UserAPITokens("u0")))
+	assert.Equal(t, 0, len(data.UserAPITokens("u1")))
+
+	// survives marshaling
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	other := newData()
+	assert.Nil(t, other.UnmarshalBinary(buf))
+	assert.Equal(t, data.APITokens, other.APITokens)
+	assert.Equal(t, uint64(1), other.MaxAPITokenID)
+
+	other = data.Clone()
+	assert.Nil(t, other.DropAPIToken(info.ID))
+	assert.Equal(t, imeta.ErrAPITokenNotFound, other.DropAPIToken(info.ID))
+	assert.NotNil(t, data.APITokenUser(token))
+
+	assert.Nil(t, data.DropUser("u0"))
+	assert.Nil(t, data.APITokenUser(token))
+}
+
+func TestSession(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.CreateUser("u0", "hash", false))
+	now := time.Unix(1600000000, 0).UTC()
+	expiration := now.Add(time.Hour)
+
+	token, err := imeta.GenerateAPIToken()
+	assert.Nil(t, err)
+	assert.Equal(t, meta.ErrUserNotFound, data.CreateSession("nobody", imeta.HashAPIToken(token), now, expiration))
+	assert.Equal(t, imeta.ErrSessionRequired, data.CreateSession("u0", "", now, expiration))
+	assert.Nil(t, data.CreateSession("u0", imeta.HashAPIToken(token), now, expiration))
+
+	assert.Equal(t, "u0", data.SessionUser(token, now).Name)
+	assert.Nil(t, data.SessionUser(token, expiration))
+	assert.Nil(t, data.SessionUser("unknown", now))
+
+	// survives marshaling
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	other := newData()
+	assert.Nil(t, other.UnmarshalBinary(buf))
+	assert.Equal(t, data.Sessions, other.Sessions)
+
+	// expired sessions pruned on sign in
+	other = data.Clone()
+	assert.Nil(t, other.CreateSession("u0", "h1", expiration, expiration.Add(time.Hour)))
+	assert.Equal(t, 1, len(other.Sessions))
+	assert.Nil(t, other.DropSession("h1"))
+	assert.Equal(t, imeta.ErrSessionNotFound, other.DropSession("h1"))
+	assert.NotNil(t, data.SessionUser(token, now))
+
+	// ended by password change
+	other = data.Clone()
+	assert.Nil(t, other.UpdateUser("u0", "other"))
+	assert.Nil(t, other.SessionUser(token, now))
+
+	assert.Nil(t, data.DropUser("u0"))
+	assert.Nil(t, data.SessionUser(token, now))
+	assert.Equal(t, 0, len(data.Sessions))
+}
+
+func TestSession_MaxUserSessions(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.CreateUser("u0", "hash", false))
+	assert.Nil(t, data.CreateUser("u1", "hash", false))
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigMaxUserSessions, "2"))
+	now := time.Unix(1600000000, 0).UTC()
+
+	assert.Nil(t, data.CreateSession("u0", "h0", now, now.Add(2*time.Hour)))
+	assert.Nil(t, data.CreateSession("u0", "h1", now, now.Add(time.Hour)))
+	assert.Nil(t, data.CreateSession("u1", "h2", now, now.Add(time.Hour)))
+	// the session of u0 expiring first ends
+	assert.Nil(t, data.CreateSession("u0", "h3", now, now.Add(3*time.Hour)))
+	assert.Equal(t, []string{"h0", "h2", "h3"}, sessionHashes(data))
+
+	// unlimited
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigMaxUserSessions, "0"))
+	assert.Nil(t, data.CreateSession("u0", "h4", now, now.Add(time.Hour)))
+	assert.Equal(t, []string{"h0", "h2", "h3", "h4"}, sessionHashes(data))
+}
+
+func TestSession_Prune(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.CreateUser("u0", "hash", false))
+	now := time.Unix(1600000000, 0).UTC()
+	assert.Nil(t, data.CreateSession("u0", "h0", now, now.Add(time.Minute)))
+	assert.Nil(t, data.CreateSession("u0", "h1", now, now.Add(time.Hour)))
+
+	assert.False(t, data.SessionsExpired(now))
+	assert.True(t, data.SessionsExpired(now.Add(time.Minute)))
+	data.PruneSessions(now.Add(time.Minute))
+	assert.Equal(t, []string{"h1"}, sessionHashes(data))
+	assert.False(t, data.SessionsExpired(now.Add(time.Minute)))
+}
+
+func sessionHashes(data *imeta.Data) []string {
+	var hashes []string
+	for hash := range data.Sessions {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// testHash returns a bcrypt hash of password of the lowest cost.
+func testHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	assert.Nil(t, err)
+	return string(hash)
+}
+
+func TestExportImportUsers(t *testing.T) {
+	h0, h1 := testHash(t, "p0"), testHash(t, "p1")
+	data := newData()
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateUser("u1", h1, false))
+	assert.Nil(t, data.CreateUser("u0", h0, true))
+	assert.Nil(t, data.SetPrivilege("u1", "db0", influxql.ReadPrivilege))
+	assert.Nil(t, data.SetMeasurementPrivilege("u1", "db0", "cpu_*", influxql.WritePrivilege))
+	assert.Nil(t, data.SetOperatorRole("u1", imeta.OperatorRoleViewer))
+
+	doc := data.ExportUsers()
+	assert.Equal(t, []imeta.ExportedUser{
+		{Name: "u0", Hash: h0, Admin: true},
+		{Name: "u1", Hash: h1, Privileges: map[string]string{"db0": "READ"},
+			MeasurementPrivileges: map[string][]imeta.ExportedMeasurementGrant{"db0": {{Pattern: "cpu_*", Privilege: "WRITE"}}},
+			OperatorRole:          "viewer"},
+	}, doc.Users)
+
+	// into a cluster with u1 of another password and other grants
+	other := newData()
+	assert.Nil(t, other.CreateDatabase("db1"))
+	assert.Nil(t, other.CreateUser("u1", "other", false))
+	assert.Nil(t, other.CreateUser("u2", "h2", false))
+	assert.Nil(t, other.SetPrivilege("u1", "db1", influxql.AllPrivileges))
+	assert.Nil(t, other.CreateSession("u1", "s1", time.Unix(0, 0), time.Unix(100, 0)))
+	assert.Nil(t, other.ImportUsers(doc))
+	assert.Equal(t, doc.Users, other.ExportUsers().Users[:2])
+	assert.Equal(t, "u2", other.ExportUsers().Users[2].Name)
+	assert.Equal(t, 0, len(other.Sessions))
+
+	// nothing imported from a malformed document
+	bad := &imeta.UserExport{Users: []imeta.ExportedUser{
+		{Name: "u3", Hash: h0},
+		{Name: "u4", Hash: h1, Privileges: map[string]string{"db0": "OWNER"}},
+	}}
+	assert.True(t, errors.Is(other.ImportUsers(bad), imeta.ErrInvalidUserImport))
+	assert.Nil(t, other.User("u3"))
+	bad.Users[1] = imeta.ExportedUser{Name: "u3", Hash: h0}
+	assert.True(t, errors.Is(other.ImportUsers(bad), imeta.ErrInvalidUserImport))
+
+	// nor from one of a password hash invalid
+	salt := base64.RawStdEncoding.EncodeToString(make([]byte, 16))
+	for _, hash := range []string{
+		"h3",
+		"$2a$99$" + strings.Repeat("a", 53),
+		"$md5$" + salt,
+		"$scrypt$ln=15,r=8,p=1$" + salt + "$",
+		"$argon2id$v=19,m=65536,t=0,p=4$" + salt + "$" + salt + salt,
+	} {
+		bad.Users[1] = imeta.ExportedUser{Name: "u4", Hash: hash}
+		assert.True(t, errors.Is(other.ImportUsers(bad), imeta.ErrInvalidUserImport), hash)
+		assert.Nil(t, other.User("u3"))
+	}
+}
+
+func TestOperatorRoles(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.CreateUser("u0", "h0", false))
+
+	assert.Equal(t, meta.ErrUserNotFound, data.SetOperatorRole("u1", imeta.OperatorRoleViewer))
+	assert.Equal(t, imeta.ErrOperatorRoleInvalid, data.SetOperatorRole("u0", "owner"))
+	assert.Equal(t, imeta.OperatorRoleNone, data.UserOperatorRole("u0"))
+	assert.False(t, data.UserOperatorRole("u0").Allows(imeta.OperatorRoleViewer))
+
+	assert.Nil(t, data.SetOperatorRole("u0", imeta.OperatorRoleOperator))
+	role := data.UserOperatorRole("u0")
+	assert.True(t, role.Allows(imeta.OperatorRoleViewer))
+	assert.True(t, role.Allows(imeta.OperatorRoleOperator))
+	assert.False(t, role.Allows(imeta.OperatorRoleAdmin))
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, imeta.OperatorRoleOperator, decoded.UserOperatorRole("u0"))
+	clone := data.Clone()
+	assert.Nil(t, clone.SetOperatorRole("u0", imeta.OperatorRoleNone))
+	assert.Equal(t, imeta.OperatorRoleNone, clone.UserOperatorRole("u0"))
+	assert.Equal(t, imeta.OperatorRoleOperator, data.UserOperatorRole("u0"))
+
+	r, err := imeta.ParseOperatorRole("Admin")
+	assert.Nil(t, err)
+	assert.Equal(t, imeta.OperatorRoleAdmin, r)
+	r, err = imeta.ParseOperatorRole("none")
+	assert.Nil(t, err)
+	assert.Equal(t, imeta.OperatorRoleNone, r)
+	_, err = imeta.ParseOperatorRole("owner")
+	assert.NotNil(t, err)
+
+	// revoked along with the user
+	assert.Nil(t, data.DropUser("u0"))
+	assert.Nil(t, data.CreateUser("u0", "h0", false))
+	assert.Equal(t, imeta.OperatorRoleNone, data.UserOperatorRole("u0"))
+}
+
+func TestMetaLimits(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigMaxDatabases, "1"))
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigMaxRetentionPolicies, "1"))
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigMaxUsers, "2"))
+
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.True(t, errors.Is(data.CreateDatabase("db1"), imeta.ErrMaxDatabasesReached))
+
+	rpi := &meta.RetentionPolicyInfo{Name: "rp0", ReplicaN: 1, ShardGroupDuration: time.Hour}
+	assert.Nil(t, data.CreateRetentionPolicy("db0", rpi, true))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", rpi, true))
+	err := data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp1", ReplicaN: 1}, false)
+	assert.True(t, errors.Is(err, imeta.ErrMaxRetentionPoliciesReached))
+
+	assert.Nil(t, data.CreateUser("u0", "h0", false))
+	h := testHash(t, "p")
+	err = data.ImportUsers(&imeta.UserExport{Users: []imeta.ExportedUser{{Name: "u0", Hash: h}, {Name: "u1", Hash: h}, {Name: "u2", Hash: h}}})
+	assert.True(t, errors.Is(err, imeta.ErrMaxUsersReached))
+	assert.Nil(t, data.CreateUser("u1", "h1", false))
+	assert.True(t, errors.Is(data.CreateUser("u2", "h2", false), imeta.ErrMaxUsersReached))
+
+	// lifted when unset
+	assert.Nil(t, data.DeleteClusterConfig(imeta.ConfigMaxUsers))
+	assert.Nil(t, data.CreateUser("u2", "h2", false))
+}
+
+func TestBucketMapping(t *testing.T) {
+	data := newData()
+	initialTwoDataNodes(data)
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp0", ReplicaN: 1}, false))
+
+	assert.NotNil(t, data.SetBucketMapping(&imeta.BucketMapping{Org: "o", Bucket: "b", Database: "none"}))
+	assert.NotNil(t, data.SetBucketMapping(&imeta.BucketMapping{Org: "o", Bucket: "b", Database: "db0", RetentionPolicy: "none"}))
+	assert.Equal(t, imeta.ErrBucketRequired, data.SetBucketMapping(&imeta.BucketMapping{Org: "o", Database: "db0"}))
+
+	assert.Nil(t, data.SetBucketMapping(&imeta.BucketMapping{Org: "o", Bucket: "b", Database: "db0"}))
+	assert.Nil(t, data.SetBucketMapping(&imeta.BucketMapping{Org: "o", Bucket: "b", Database: "db0", RetentionPolicy: "rp0"}))
+	assert.Nil(t, data.SetBucketMapping(&imeta.BucketMapping{Bucket: "b", Database: "db0"}))
+	assert.Equal(t, 2, len(data.BucketMappings))
+
+	assert.Equal(t, "rp0", data.BucketMapping("o", "b").RetentionPolicy)
+	// mapping of any org
+	assert.Equal(t, "", data.BucketMapping("other", "b").RetentionPolicy)
+	assert.Nil(t, data.BucketMapping("o", "none"))
+
+	assert.Nil(t, data.DropBucketMapping("", "b"))
+	assert.Equal(t, imeta.ErrBucketMappingNotFound, data.DropBucketMapping("", "b"))
+	assert.Nil(t, data.BucketMapping("other", "b"))
+
+	assert.Nil(t, data.DropDatabase("db0"))
+	assert.Nil(t, data.BucketMapping("o", "b"))
+}
+
+func TestClusterConfig(t *testing.T) {
+	data := newData()
+
+	assert.Equal(t, imeta.ErrClusterConfigUnknown, data.SetClusterConfig("none", "1"))
+	assert.NotNil(t, data.SetClusterConfig(imeta.ConfigPrecreationHorizon, "1"))
+	assert.NotNil(t, data.SetClusterConfig(imeta.ConfigPrecreationHorizon, "-1m"))
+	assert.NotNil(t, data.SetClusterConfig(imeta.ConfigCopyShardRate, "1MB"))
+
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigPrecreationHorizon, "45m"))
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigCopyShardRate, "1048576"))
+	d, ok := data.ClusterConfig.Duration(imeta.ConfigPrecreationHorizon)
+	assert.True(t, ok)
+	assert.Equal(t, 45*time.Minute, d)
+	n, ok := data.ClusterConfig.Int(imeta.ConfigCopyShardRate)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1048576), n)
+
+	other := data.Clone()
+	assert.Nil(t, other.DeleteClusterConfig(imeta.ConfigCopyShardRate))
+	assert.Equal(t, imeta.ErrClusterConfigNotFound, other.DeleteClusterConfig(imeta.ConfigCopyShardRate))
+	_, ok = other.ClusterConfig.Int(imeta.ConfigCopyShardRate)
+	assert.False(t, ok)
+	_, ok = data.ClusterConfig.Int(imeta.ConfigCopyShardRate)
+	assert.True(t, ok)
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.ClusterConfig, decoded.ClusterConfig)
+
+	assert.False(t, data.ClusterConfig.ReadOnly())
+	assert.NotNil(t, data.SetClusterConfig(imeta.ConfigReadOnly, "yes"))
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigReadOnly, "true"))
+	assert.True(t, data.ClusterConfig.ReadOnly())
+
+	// write rates
+	_, ok = data.ClusterConfig.WriteRate()
+	assert.False(t, ok)
+	assert.NotNil(t, data.SetClusterConfig(imeta.ConfigDatabaseWriteRates, "db0"))
+	assert.NotNil(t, data.SetClusterConfig(imeta.ConfigDatabaseWriteRates, "db0=0"))
+	assert.NotNil(t, data.SetClusterConfig(imeta.ConfigDatabaseWriteRates, "db0=10:x"))
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigDatabaseWriteRates, "db0=10, db1=20:40"))
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigWriteRateLimit, "100"))
+	r, ok := data.ClusterConfig.WriteRate()
+	assert.True(t, ok)
+	assert.Equal(t, imeta.WriteRate{Limit: 100, Burst: 100}, r)
+	assert.Nil(t, data.SetClusterConfig(imeta.ConfigWriteRateBurst, "400"))
+	r, _ = data.ClusterConfig.WriteRate()
+	assert.Equal(t, imeta.WriteRate{Limit: 100, Burst: 400}, r)
+	assert.Equal(t, map[string]imeta.WriteRate{
+		"db0": {Limit: 10, Burst: 10},
+		"db1": {Limit: 20, Burst: 40},
+	}, data.ClusterConfig.DatabaseWriteRates())
+}
+
+func TestHintedHandoffPolicy(t *testing.T) {
+	data := newData()
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp0", ReplicaN: 1, Duration: time.Hour}, false))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp1", ReplicaN: 1, Duration: time.Hour}, false))
+
+	assert.NotNil(t, data.SetHintedHandoffPolicy(&imeta.HintedHandoffPolicy{Database: "none"}))
+	assert.NotNil(t, data.SetHintedHandoffPolicy(&imeta.HintedHandoffPolicy{Database: "db0", RetentionPolicy: "none"}))
+	assert.True(t, data.HintedHandoffEnabled("db0", "rp0"))
+
+	// retention policy wins over database
+	assert.Nil(t, data.SetHintedHandoffPolicy(&imeta.HintedHandoffPolicy{Database: "db0", Enabled: false}))
+	assert.Nil(t, data.SetHintedHandoffPolicy(&imeta.HintedHandoffPolicy{Database: "db0", RetentionPolicy: "rp1", Enabled: true}))
+	assert.False(t, data.HintedHandoffEnabled("db0", "rp0"))
+	assert.True(t, data.HintedHandoffEnabled("db0", "rp1"))
+	assert.True(t, data.HintedHandoffEnabled("db1", "rp0"))
+
+	// replaced
+	assert.Nil(t, data.SetHintedHandoffPolicy(&imeta.HintedHandoffPolicy{Database: "db0", RetentionPolicy: "rp1", Enabled: false}))
+	assert.Len(t, data.HintedHandoffPolicies, 2)
+	assert.False(t, data.HintedHandoffEnabled("db0", "rp1"))
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.HintedHandoffPolicies, decoded.HintedHandoffPolicies)
+
+	assert.Nil(t, data.DeleteHintedHandoffPolicy("db0", ""))
+	assert.Equal(t, imeta.ErrHintedHandoffPolicyNotFound, data.DeleteHintedHandoffPolicy("db0", ""))
+	assert.True(t, data.HintedHandoffEnabled("db0", "rp0"))
+
+	assert.Nil(t, data.DropRetentionPolicy("db0", "rp1"))
+	assert.Len(t, data.HintedHandoffPolicies, 0)
+	assert.Nil(t, data.SetHintedHandoffPolicy(&imeta.HintedHandoffPolicy{Database: "db0", Enabled: false}))
+	assert.Nil(t, data.DropDatabase("db0"))
+	assert.Len(t, data.HintedHandoffPolicies, 0)
+}
+
+func TestShardReadOnly(t *testing.T) {
+	data := newData()
+	initialTwoDataNodes(data)
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp0", ReplicaN: 1, Duration: time.Hour}, false))
+	now := time.Now()
+	assert.Nil(t, data.CreateShardGroup("db0", "rp0", now))
+	assert.Nil(t, data.CreateShardGroup("db0", "rp0", now.Add(-time.Hour)))
+	rp, _ := data.RetentionPolicy("db0", "rp0")
+	id0, id1 := rp.ShardGroups[0].Shards[0].ID, rp.ShardGroups[1].Shards[0].ID
+
+	assert.Equal(t, imeta.ErrShardNotFound, data.SetShardReadOnly(100, true))
+	assert.False(t, data.ShardReadOnly(id0))
+
+	assert.Nil(t, data.SetShardReadOnly(id1, true))
+	assert.Nil(t, data.SetShardReadOnly(id0, true))
+	assert.Nil(t, data.SetShardReadOnly(id0, true))
+	assert.True(t, data.ShardReadOnly(id0))
+	assert.True(t, data.ShardReadOnly(id1))
+	assert.Len(t, data.ReadOnlyShards, 2)
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.ReadOnlyShards, decoded.ReadOnlyShards)
+	assert.Equal(t, data.ReadOnlyShards, data.Clone().ReadOnlyShards)
+
+	assert.Nil(t, data.SetShardReadOnly(id1, false))
+	assert.False(t, data.ShardReadOnly(id1))
+	assert.Nil(t, data.SetShardReadOnly(id1, false))
+
+	// marks go along with their shards
+	data.DropShard(id0)
+	assert.Len(t, data.ReadOnlyShards, 0)
+	assert.Nil(t, data.SetShardReadOnly(id1, true))
+	assert.Nil(t, data.DropDatabase("db0"))
+	assert.Len(t, data.ReadOnlyShards, 0)
+}
+
+func TestSealedShards(t *testing.T) {
+	data := newData()
+	initialTwoDataNodes(data)
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp0", ReplicaN: 1, Duration: 24 * time.Hour}, false))
+	now := time.Now().UTC()
+	assert.Nil(t, data.CreateShardGroup("db0", "rp0", now))
+	assert.Nil(t, data.CreateShardGroup("db0", "rp0", now.Add(-2*time.Hour)))
+	rp, _ := data.RetentionPolicy("db0", "rp0")
+	var ended, current meta.ShardGroupInfo
+	for _, sg := range rp.ShardGroups {
+		if sg.EndTime.After(now) {
+			current = sg
+		} else {
+			ended = sg
+		}
+	}
+	id0, id1 := ended.Shards[0].ID, current.Shards[0].ID
+
+	// within the grace period nothing is sealed
+	assert.Len(t, data.UnsealedShardGroups(2*time.Hour, now), 0)
+	assert.Equal(t, 0, data.SealShardGroups(2*time.Hour, now))
+	assert.Equal(t, []imeta.ShardGroupID{imeta.ShardGroupID(ended.ID)}, data.UnsealedShardGroups(0, now))
+	assert.Equal(t, len(ended.Shards), data.SealShardGroups(0, now))
+	assert.Equal(t, 0, data.SealShardGroups(0, now.Add(time.Second)))
+	assert.Len(t, data.UnsealedShardGroups(0, now), 0)
+	assert.True(t, data.ShardSealed(id0))
+	assert.False(t, data.ShardSealed(id1))
+	assert.Equal(t, now, data.SealedShard(id0).SealedAt)
+	assert.False(t, data.SealedShard(id0).Verified())
+	assert.Nil(t, data.SealedShard(id1))
+
+	assert.Equal(t, imeta.ErrShardNotSealed, data.SetSealedShardChecksum(id1, 1, false, now))
+	assert.Nil(t, data.SetSealedShardChecksum(id0, 42, true, now))
+	s := data.SealedShard(id0)
+	assert.True(t, s.Verified())
+	assert.Equal(t, uint32(42), s.Checksum)
+	assert.True(t, s.Diverged)
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.SealedShards, decoded.SealedShards)
+	assert.Equal(t, data.SealedShards, data.Clone().SealedShards)
+
+	// seals go along with their shards
+	data.DropShard(id0)
+	assert.Len(t, data.SealedShards, len(ended.Shards)-1)
+	assert.Nil(t, data.DropDatabase("db0"))
+	assert.Len(t, data.SealedShards, 0)
+}
+
+func TestNodeIncarnations(t *testing.T) {
+	data := newData()
+	id1, id2 := initialTwoDataNodes(data)
+	now := time.Now().UTC()
+
+	// nodes not registered yet are never stale
+	incarnation, ok := data.DataNodeIncarnation(id1)
+	assert.True(t, ok)
+	assert.Zero(t, incarnation)
+	assert.False(t, data.StaleIncarnation(id1, 1))
+
+	first, err := data.RegisterDataNode(id1, now)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), first)
+	other, err := data.RegisterDataNode(id2, now)
+	assert.Nil(t, err)
+	second, err := data.RegisterDataNode(id1, now)
+	assert.Nil(t, err)
+	assert.True(t, second > other)
+	_, err = data.RegisterDataNode(100, now)
+	assert.Equal(t, imeta.ErrNodeNotFound, err)
+
+	clone := data.Clone()
+	assert.True(t, clone.StaleIncarnation(id1, first))
+	assert.False(t, clone.StaleIncarnation(id1, second))
+	assert.False(t, clone.StaleIncarnation(id1, 0))
+	// registered after data was synced
+	assert.False(t, clone.StaleIncarnation(id1, second+1))
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	restored := newData()
+	assert.Nil(t, restored.UnmarshalBinary(buf))
+	incarnation, _ = restored.DataNodeIncarnation(id1)
+	assert.Equal(t, second, incarnation)
+
+	// deleted nodes are stale, incarnations are not reused
+	assert.Nil(t, data.DeleteDataNode(id1))
+	assert.True(t, data.StaleIncarnation(id1, second))
+	assert.False(t, data.StaleIncarnation(id2, other))
+	next, err := data.RegisterDataNode(id2, now)
+	assert.Nil(t, err)
+	assert.True(t, next > second)
+}
+
+func TestShardCutover(t *testing.T) {
+	data := newData()
+	_, id2 := initialTwoDataNodes(data)
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp0", ReplicaN: 1, Duration: time.Hour}, false))
+	now := time.Now().UTC()
+	assert.Nil(t, data.CreateShardGroup("db0", "rp0", now))
+	rp, _ := data.RetentionPolicy("db0", "rp0")
+	id := rp.ShardGroups[0].Shards[0].ID
+
+	assert.Equal(t, imeta.ErrShardNotFound, data.BeginShardCutover(100, id2, now.Add(time.Second)))
+	assert.Equal(t, imeta.ErrNodeNotFound, data.BeginShardCutover(id, 100, now.Add(time.Second)))
+	assert.Nil(t, data.ShardCutover(id, now))
+
+	assert.Nil(t, data.BeginShardCutover(id, id2, now.Add(time.Second)))
+	c := data.ShardCutover(id, now)
+	assert.NotNil(t, c)
+	assert.Equal(t, id2, c.NodeID)
+	// time-bounded
+	assert.Nil(t, data.ShardCutover(id, now.Add(time.Second)))
+
+	// replaced
+	assert.Nil(t, data.BeginShardCutover(id, id2, now.Add(time.Minute)))
+	assert.Len(t, data.ShardCutovers, 1)
+	assert.NotNil(t, data.ShardCutover(id, now.Add(time.Second)))
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.ShardCutovers, decoded.ShardCutovers)
+
+	assert.Nil(t, data.EndShardCutover(id))
+	assert.Nil(t, data.ShardCutover(id, now))
+	assert.Nil(t, data.EndShardCutover(id))
+
+	assert.Nil(t, data.BeginShardCutover(id, id2, now.Add(time.Minute)))
+	data.DropShard(id)
+	assert.Len(t, data.ShardCutovers, 0)
+}
+
+func TestStaleShards(t *testing.T) {
+	data := newData()
+	id1, id2 := initialTwoDataNodes(data)
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "rp0", ReplicaN: 2, Duration: time.Hour}, false))
+	now := time.Now().UTC()
+	assert.Nil(t, data.CreateShardGroup("db0", "rp0", now))
+	assert.Nil(t, data.CreateShardGroup("db0", "rp0", now.Add(-time.Hour)))
+	rp, _ := data.RetentionPolicy("db0", "rp0")
+	sh0, sh1 := rp.ShardGroups[0].Shards[0].ID, rp.ShardGroups[1].Shards[0].ID
+
+	assert.Equal(t, imeta.ErrNodeNotFound, data.MarkShardsStale(100, []uint64{sh0}, now))
+	// shards not found are skipped
+	assert.Nil(t, data.MarkShardsStale(id2, []uint64{sh0, 100}, now))
+	assert.True(t, data.ShardStale(sh0, id2))
+	assert.False(t, data.ShardStale(sh0, id1))
+	assert.False(t, data.ShardStale(sh1, id2))
+
+	// marked first kept
+	assert.Nil(t, data.MarkShardsStale(id2, []uint64{sh0, sh1}, now.Add(time.Minute)))
+	assert.Equal(t, []imeta.StaleShard{
+		{ShardID: sh0, NodeID: id2, MarkedAt: now},
+		{ShardID: sh1, NodeID: id2, MarkedAt: now.Add(time.Minute)},
+	}, data.NodeStaleShards(id2))
+	assert.Nil(t, data.MarkShardsStale(id1, []uint64{sh0}, now))
+	assert.Len(t, data.NodeStaleShards(id1), 1)
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.StaleShards, decoded.StaleShards)
+	assert.Equal(t, data.StaleShards, data.Clone().StaleShards)
+
+	assert.Nil(t, data.ClearStaleShard(sh1, id2))
+	assert.False(t, data.ShardStale(sh1, id2))
+	assert.Nil(t, data.ClearStaleShard(sh1, id2))
+
+	// marks go along with their shards and nodes
+	data.DropShard(sh0)
+	assert.Len(t, data.StaleShards, 0)
+	assert.Nil(t, data.MarkShardsStale(id2, []uint64{sh1}, now))
+	assert.Nil(t, data.DeleteDataNode(id2))
+	assert.Len(t, data.StaleShards, 0)
+}
+
+func TestMeasurementTombstones(t *testing.T) {
+	data := newData()
+	id1, id2 := initialTwoDataNodes(data)
+	now := time.Now().UTC()
+	_, err := data.CreateMeasurementTombstone("db0", "cpu", now)
+	assert.Equal(t, influxdb.ErrDatabaseNotFound("db0"), err)
+	assert.Nil(t, data.CreateDatabase("db0"))
+
+	ts, err := data.CreateMeasurementTombstone("db0", "cpu", now)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), ts.ID)
+	assert.Equal(t, []uint64{id1, id2}, ts.Pending)
+	ts2, err := data.CreateMeasurementTombstone("db0", "mem", now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), ts2.ID)
+
+	assert.True(t, data.MeasurementDroppedAfter("db0", "cpu", now.Add(-time.Second)))
+	assert.False(t, data.MeasurementDroppedAfter("db0", "cpu", now))
+	assert.False(t, data.MeasurementDroppedAfter("db1", "cpu", now.Add(-time.Second)))
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.MeasurementTombstones, decoded.MeasurementTombstones)
+	assert.Equal(t, data.MaxMeasurementTombstoneID, decoded.MaxMeasurementTombstoneID)
+	clone := data.Clone()
+	assert.Nil(t, clone.AckMeasurementTombstone(ts.ID, id1, now))
+	assert.Len(t, data.NodeMeasurementTombstones(id1), 2)
+
+	assert.Nil(t, data.AckMeasurementTombstone(ts.ID, id1, now))
+	assert.Nil(t, data.AckMeasurementTombstone(ts.ID, id1, now))
+	assert.Nil(t, data.AckMeasurementTombstone(100, id1, now))
+	pending := data.NodeMeasurementTombstones(id1)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "mem", pending[0].Name)
+	assert.Len(t, data.NodeMeasurementTombstones(id2), 2)
+
+	// applied by all kept for hinted handoff until the ttl
+	assert.Nil(t, data.DeleteDataNode(id2))
+	assert.Len(t, data.NodeMeasurementTombstones(id2), 0)
+	assert.Nil(t, data.AckMeasurementTombstone(ts2.ID, id1, now.Add(time.Hour)))
+	assert.Len(t, data.MeasurementTombstones, 2)
+	assert.Nil(t, data.AckMeasurementTombstone(ts2.ID, id1, now.Add(imeta.MeasurementTombstoneTTL)))
+	assert.Len(t, data.MeasurementTombstones, 1)
+	assert.Equal(t, "mem", data.MeasurementTombstones[0].Name)
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	data := newData()
+	id1, id2 := initialTwoDataNodes(data)
+	now := time.Now().UTC()
+
+	_, err := data.CreateMaintenanceWindow(imeta.MaintenanceWindow{Nodes: []uint64{id1}, Start: now, Behavior: imeta.MaintenanceDrain}, now)
+	assert.Equal(t, imeta.ErrInvalidMaintenanceWindow, err)
+	_, err = data.CreateMaintenanceWindow(imeta.MaintenanceWindow{Nodes: []uint64{id1}, Start: now, Duration: time.Hour, Behavior: "reboot"}, now)
+	assert.Equal(t, imeta.ErrInvalidMaintenanceWindow, err)
+	_, err = data.CreateMaintenanceWindow(imeta.MaintenanceWindow{Nodes: []uint64{100}, Start: now, Duration: time.Hour, Behavior: imeta.MaintenanceFreeze}, now)
+	assert.Equal(t, imeta.ErrNodeNotFound, err)
+
+	w, err := data.CreateMaintenanceWindow(imeta.MaintenanceWindow{
+		Nodes: []uint64{id1, id2}, Start: now.Add(time.Minute), Duration: time.Hour, Behavior: imeta.MaintenanceDrain,
+	}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), w.ID)
+	assert.False(t, data.InMaintenance(id1, now, imeta.MaintenanceFreeze))
+	assert.True(t, data.InMaintenance(id1, now.Add(time.Minute), imeta.MaintenanceFreeze))
+	assert.True(t, data.InMaintenance(id2, now.Add(time.Minute), imeta.MaintenanceDrain))
+	assert.False(t, data.InMaintenance(id2, now.Add(time.Minute), imeta.MaintenanceExcludeReads))
+	assert.False(t, data.InMaintenance(id1, w.End(), imeta.MaintenanceFreeze))
+	assert.Len(t, data.NodeMaintenanceWindows(id1, now.Add(time.Minute)), 1)
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.MaintenanceWindows, decoded.MaintenanceWindows)
+	assert.Equal(t, data.MaxMaintenanceWindowID, decoded.MaxMaintenanceWindowID)
+	clone := data.Clone()
+	assert.Nil(t, clone.DeleteMaintenanceWindow(w.ID))
+	assert.Len(t, data.MaintenanceWindows, 1)
+
+	// windows ended are pruned by the next one scheduled
+	w2, err := data.CreateMaintenanceWindow(imeta.MaintenanceWindow{
+		Nodes: []uint64{id2}, Start: w.End(), Duration: time.Hour, Behavior: imeta.MaintenanceExcludeReads,
+	}, w.End())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), w2.ID)
+	assert.Len(t, data.MaintenanceWindows, 1)
+
+	assert.Nil(t, data.DeleteDataNode(id2))
+	assert.Len(t, data.MaintenanceWindows, 0)
+	assert.Equal(t, imeta.ErrMaintenanceWindowNotFound, data.DeleteMaintenanceWindow(w2.ID))
+}
+
+func TestShardGroupFreeze(t *testing.T) {
+	data := newData()
+	now := time.Now().UTC()
+	assert.False(t, data.ShardGroupsFrozen(now))
+
+	data.FreezeShardGroups("s0", now.Add(time.Minute))
+	assert.True(t, data.ShardGroupsFrozen(now))
+	// time-bounded
+	assert.False(t, data.ShardGroupsFrozen(now.Add(time.Minute)))
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.ShardGroupFreeze.ID, decoded.ShardGroupFreeze.ID)
+	assert.True(t, decoded.ShardGroupsFrozen(now))
+	assert.True(t, data.Clone().ShardGroupsFrozen(now))
+
+	// replaced, thawing the former one is a no-op
+	data.FreezeShardGroups("s1", now.Add(time.Minute))
+	data.ThawShardGroups("s0")
+	assert.True(t, data.ShardGroupsFrozen(now))
+	data.ThawShardGroups("s1")
+	assert.False(t, data.ShardGroupsFrozen(now))
+}
+
+func TestShardGroupAlignment(t *testing.T) {
+	data := newData()
+	initialTwoDataNodes(data)
+	assert.Nil(t, data.CreateDatabase("db0"))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "hours", ReplicaN: 1, ShardGroupDuration: 5 * time.Hour}, false))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "days", ReplicaN: 1, ShardGroupDuration: 3 * 24 * time.Hour}, false))
+	assert.Nil(t, data.CreateRetentionPolicy("db0", &meta.RetentionPolicyInfo{Name: "weeks", ReplicaN: 1, ShardGroupDuration: 10 * 24 * time.Hour}, false))
+
+	assert.Equal(t, imeta.ErrInvalidShardGroupAlignment, data.SetShardGroupAlignment("db0", "hours", "month"))
+	assert.NotNil(t, data.SetShardGroupAlignment("db0", "none", imeta.AlignDay))
+	assert.Nil(t, data.SetShardGroupAlignment("db0", "hours", imeta.AlignDay))
+	assert.Nil(t, data.SetShardGroupAlignment("db0", "days", imeta.AlignWeek))
+	assert.Nil(t, data.SetShardGroupAlignment("db0", "weeks", imeta.AlignWeek))
+	assert.Equal(t, imeta.AlignDay, data.ShardGroupAlignment("db0", "hours"))
+
+	group := func(rp string, ts time.Time) (time.Time, time.Time) {
+		assert.Nil(t, data.CreateShardGroup("db0", rp, ts))
+		sg, err := data.ShardGroupByTimestamp("db0", rp, ts)
+		assert.Nil(t, err)
+		return sg.StartTime, sg.EndTime
+	}
+	day := func(d, h int) time.Time { return time.Date(2020, 5, d, h, 0, 0, 0, time.UTC) }
+
+	// the last group of a day ends at midnight
+	start, end := group("hours", day(1, 22))
+	assert.Equal(t, day(1, 20), start)
+	assert.Equal(t, day(2, 0), end)
+	start, end = group("hours", day(2, 1))
+	assert.Equal(t, day(2, 0), start)
+	assert.Equal(t, day(2, 5), end)
+
+	// weeks start on Monday, April 27th
+	start, end = group("days", day(1, 12))
+	assert.Equal(t, time.Date(2020, 4, 30, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, day(3, 0), end)
+	start, end = group("days", day(3, 12))
+	assert.Equal(t, day(3, 0), start)
+	assert.Equal(t, day(4, 0), end)
+
+	// whole weeks
+	start, end = group("weeks", day(1, 12))
+	assert.Equal(t, time.Monday, start.Weekday())
+	assert.Equal(t, 14*24*time.Hour, end.Sub(start))
+	assert.True(t, !start.After(day(1, 12)) && end.After(day(1, 12)))
+
+	// groups created before the alignment are not overlapped
+	assert.Nil(t, data.SetShardGroupAlignment("db0", "hours", imeta.AlignEpoch))
+	start, end = group("hours", day(10, 2))
+	assert.Nil(t, data.SetShardGroupAlignment("db0", "hours", imeta.AlignDay))
+	aligned, _ := group("hours", end)
+	assert.NotEqual(t, day(10, 0), start)
+	assert.Equal(t, end, aligned)
+
+	buf, err := data.MarshalBinary()
+	assert.Nil(t, err)
+	var decoded imeta.Data
+	assert.Nil(t, decoded.UnmarshalBinary(buf))
+	assert.Equal(t, data.ShardGroupAlignments, decoded.ShardGroupAlignments)
+
+	assert.Nil(t, data.DropRetentionPolicy("db0", "hours"))
+	assert.Len(t, data.ShardGroupAlignments, 2)
+	assert.Nil(t, data.DropDatabase("db0"))
+	assert.Len(t, data.ShardGroupAlignments, 0)
+}
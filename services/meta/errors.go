@@ -1,30 +1,45 @@
 package meta
 
-import (
-	"errors"
-)
+import "github.com/angopher/chronus/errs"
 
+// Errors of meta data, defined by package errs along with their kinds.
 var (
-	// ErrNodeExists is returned when creating an already existing node.
-	ErrNodeExists = errors.New("node already exists")
-
-	// ErrNodeNotFound is returned when mutating a node that doesn't exist.
-	ErrNodeNotFound = errors.New("node not found")
-
-	// ErrNodeAlreadyFreezed represents node has been already freezed
-	ErrNodeAlreadyFreezed = errors.New("node has been freezed before")
-
-	// ErrNodeNotFreezed represents node is not freezed (is normal)
-	ErrNodeNotFreezed = errors.New("node hasn't been freezed")
-
-	// ErrNodesRequired is returned when at least one node is required for an operation.
-	// This occurs when creating a shard group.
-	ErrNodesRequired = errors.New("at least one node required")
-
-	// ErrNodeIDRequired is returned when using a zero node id.
-	ErrNodeIDRequired = errors.New("node id must be greater than 0")
-
-	// ErrNodeUnableToDropFinalNode is returned if the node being dropped is the last
-	// node in the cluster
-	ErrNodeUnableToDropFinalNode = errors.New("unable to drop the final node in a cluster")
+	ErrNodeExists                   = errs.ErrNodeExists
+	ErrNodeNotFound                 = errs.ErrNodeNotFound
+	ErrNodeAlreadyFreezed           = errs.ErrNodeAlreadyFreezed
+	ErrNodeNotFreezed               = errs.ErrNodeNotFreezed
+	ErrNodesRequired                = errs.ErrNodesRequired
+	ErrNodeIDRequired               = errs.ErrNodeIDRequired
+	ErrNodeUnableToDropFinalNode    = errs.ErrNodeUnableToDropFinalNode
+	ErrDatabaseTemplateNameRequired = errs.ErrDatabaseTemplateNameRequired
+	ErrDatabaseTemplateExists       = errs.ErrDatabaseTemplateExists
+	ErrDatabaseTemplateNotFound     = errs.ErrDatabaseTemplateNotFound
+	ErrMeasurementPatternInvalid    = errs.ErrMeasurementPatternInvalid
+	ErrUserLocked                   = errs.ErrUserLocked
+	ErrAPITokenRequired             = errs.ErrAPITokenRequired
+	ErrAPITokenExists               = errs.ErrAPITokenExists
+	ErrAPITokenNotFound             = errs.ErrAPITokenNotFound
+	ErrInvalidAPIToken              = errs.ErrInvalidAPIToken
+	ErrMaxDatabasesReached          = errs.ErrMaxDatabasesReached
+	ErrMaxRetentionPoliciesReached  = errs.ErrMaxRetentionPoliciesReached
+	ErrMaxUsersReached              = errs.ErrMaxUsersReached
+	ErrInvalidUserImport            = errs.ErrInvalidUserImport
+	ErrShardGroupsFrozen            = errs.ErrShardGroupsFrozen
+	ErrSessionRequired              = errs.ErrSessionRequired
+	ErrSessionNotFound              = errs.ErrSessionNotFound
+	ErrInvalidSession               = errs.ErrInvalidSession
+	ErrBucketRequired               = errs.ErrBucketRequired
+	ErrBucketMappingNotFound        = errs.ErrBucketMappingNotFound
+	ErrArchiveDisabled              = errs.ErrArchiveDisabled
+	ErrClusterConfigUnknown         = errs.ErrClusterConfigUnknown
+	ErrClusterConfigNotFound        = errs.ErrClusterConfigNotFound
+	ErrHintedHandoffPolicyNotFound  = errs.ErrHintedHandoffPolicyNotFound
+	ErrShardGroupRangeTooLarge      = errs.ErrShardGroupRangeTooLarge
+	ErrInvalidShardGroupAlignment   = errs.ErrInvalidShardGroupAlignment
+	ErrShardNotFound                = errs.ErrShardNotFound
+	ErrDataIndexNotRetained         = errs.ErrDataIndexNotRetained
+	ErrInvalidMaintenanceWindow     = errs.ErrInvalidMaintenanceWindow
+	ErrMaintenanceWindowNotFound    = errs.ErrMaintenanceWindowNotFound
+	ErrShardNotSealed               = errs.ErrShardNotSealed
+	ErrOperatorRoleInvalid          = errs.ErrOperatorRoleInvalid
 )
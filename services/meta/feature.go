@@ -0,0 +1,159 @@
+package meta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// FeatureFlagPrefix prefixes keys of feature flags in cluster config.
+const FeatureFlagPrefix = "feature."
+
+// Feature flags known by nodes.
+const (
+	// FeatureBlockWritesWhenUnhealthy refuses hinted handoff writes to nodes
+	// whose queue fails to advance, overriding block-writes-when-unhealthy.
+	FeatureBlockWritesWhenUnhealthy = "hh-block-writes-when-unhealthy"
+	// FeatureShardWriteBreaker stops writing to nodes failing in a row, as
+	// configured by breaker-threshold.
+	FeatureShardWriteBreaker = "shard-write-breaker"
+)
+
+func init() {
+	RegisterFeatureFlag(FeatureBlockWritesWhenUnhealthy, "refuse hinted handoff writes to nodes whose queue fails to advance")
+	RegisterFeatureFlag(FeatureShardWriteBreaker, "stop writing to nodes after breaker-threshold failures in a row")
+}
+
+// RegisterFeatureFlag makes feature settable in cluster config as key
+// FeatureFlagPrefix + name. It must be called at init.
+func RegisterFeatureFlag(name, usage string) {
+	RegisterClusterConfigKey(ClusterConfigKey{
+		Name:  FeatureFlagPrefix + name,
+		Kind:  ConfigKindFeature,
+		Usage: usage,
+	})
+}
+
+// parseFeature parses value of a feature flag, true or false for all nodes,
+// or comma separated ids of nodes it's enabled on.
+func parseFeature(value string) (all bool, nodes []uint64, err error) {
+	switch strings.ToLower(value) {
+	case "true":
+		return true, nil, nil
+	case "false":
+		return false, nil, nil
+	}
+	for _, s := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return false, nil, fmt.Errorf("should be true, false or ids of nodes like 1,3")
+		}
+		nodes = append(nodes, id)
+	}
+	return false, nodes, nil
+}
+
+// Feature returns whether feature is enabled on node and whether it's set.
+func (c ClusterConfig) Feature(name string, nodeID uint64) (bool, bool) {
+	v, ok := c[FeatureFlagPrefix+name]
+	if !ok {
+		return false, false
+	}
+	all, nodes, err := parseFeature(v)
+	if err != nil {
+		return false, false
+	}
+	for _, id := range nodes {
+		if id == nodeID {
+			return true, true
+		}
+	}
+	return all, true
+}
+
+// FeatureFlags tells features enabled on a node by the cluster config, so
+// risky features can be rolled out to a few nodes before the whole cluster.
+// Changes take effect on the next check without restarting. A nil
+// FeatureFlags leaves all features to the config of the node.
+type FeatureFlags struct {
+	nodeID uint64
+	client interface {
+		ClusterConfig() ClusterConfig
+		WaitForClusterConfigChanged() chan struct{}
+	}
+	logger *zap.Logger
+
+	mu      sync.RWMutex
+	changed chan struct{}
+	config  ClusterConfig
+}
+
+// NewFeatureFlags returns feature flags of node following cluster config of client.
+func NewFeatureFlags(nodeID uint64, client interface {
+	ClusterConfig() ClusterConfig
+	WaitForClusterConfigChanged() chan struct{}
+}) *FeatureFlags {
+	return &FeatureFlags{
+		nodeID:  nodeID,
+		client:  client,
+		logger:  zap.NewNop(),
+		changed: client.WaitForClusterConfigChanged(),
+		config:  client.ClusterConfig(),
+	}
+}
+
+// WithLogger sets the logger of feature flags.
+func (f *FeatureFlags) WithLogger(log *zap.Logger) {
+	f.logger = log.With(zap.String("service", "features"))
+}
+
+// Enabled returns whether feature is enabled on the node, def if it's not
+// set in cluster config.
+func (f *FeatureFlags) Enabled(name string, def bool) bool {
+	if f == nil {
+		return def
+	}
+	f.mu.RLock()
+	changed, config := f.changed, f.config
+	f.mu.RUnlock()
+
+	select {
+	case <-changed:
+		config = f.refresh()
+	default:
+	}
+	if enabled, ok := config.Feature(name, f.nodeID); ok {
+		return enabled
+	}
+	return def
+}
+
+// refresh reloads the cluster config and logs features changed.
+func (f *FeatureFlags) refresh() ClusterConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	select {
+	case <-f.changed:
+	default:
+		// refreshed by others
+		return f.config
+	}
+	changed := f.client.WaitForClusterConfigChanged()
+	config := f.client.ClusterConfig()
+	for _, k := range ClusterConfigKeys() {
+		if k.Kind != ConfigKindFeature || f.config[k.Name] == config[k.Name] {
+			continue
+		}
+		name := strings.TrimPrefix(k.Name, FeatureFlagPrefix)
+		enabled, ok := config.Feature(name, f.nodeID)
+		f.logger.Info("Feature flag changed",
+			zap.String("feature", name),
+			zap.Bool("set", ok),
+			zap.Bool("enabled", enabled))
+	}
+	f.changed, f.config = changed, config
+	return config
+}
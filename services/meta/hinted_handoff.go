@@ -0,0 +1,97 @@
+package meta
+
+import (
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// HintedHandoffPolicy tells whether writes failed to remote owners of shards
+// of Database are queued by hinted handoff or rejected at once. An empty
+// RetentionPolicy applies to the whole database, the policy of a retention
+// policy wins over it.
+type HintedHandoffPolicy struct {
+	Database        string
+	RetentionPolicy string `json:",omitempty"`
+	Enabled         bool
+}
+
+// HintedHandoffEnabled returns whether failed writes to retention policy rp of
+// database are queued by hinted handoff, true unless disabled by a policy.
+func (data *Data) HintedHandoffEnabled(database, rp string) bool {
+	enabled := true
+	for _, p := range data.HintedHandoffPolicies {
+		if p.Database != database {
+			continue
+		}
+		if p.RetentionPolicy == rp {
+			return p.Enabled
+		} else if p.RetentionPolicy == "" {
+			enabled = p.Enabled
+		}
+	}
+	return enabled
+}
+
+// SetHintedHandoffPolicy sets the hinted handoff policy of a database or a
+// retention policy, replacing the one set before.
+func (data *Data) SetHintedHandoffPolicy(p *HintedHandoffPolicy) error {
+	if p.Database == "" {
+		return meta.ErrDatabaseNameRequired
+	}
+	di := data.Database(p.Database)
+	if di == nil {
+		return influxdb.ErrDatabaseNotFound(p.Database)
+	} else if p.RetentionPolicy != "" && di.RetentionPolicy(p.RetentionPolicy) == nil {
+		return influxdb.ErrRetentionPolicyNotFound(p.RetentionPolicy)
+	}
+
+	for i := range data.HintedHandoffPolicies {
+		if data.HintedHandoffPolicies[i].Database == p.Database && data.HintedHandoffPolicies[i].RetentionPolicy == p.RetentionPolicy {
+			data.HintedHandoffPolicies[i] = *p
+			return nil
+		}
+	}
+	data.HintedHandoffPolicies = append(data.HintedHandoffPolicies, *p)
+	return nil
+}
+
+// DeleteHintedHandoffPolicy removes the hinted handoff policy of a database,
+// or of retention policy rp if not empty.
+func (data *Data) DeleteHintedHandoffPolicy(database, rp string) error {
+	for i, p := range data.HintedHandoffPolicies {
+		if p.Database == database && p.RetentionPolicy == rp {
+			data.HintedHandoffPolicies = append(data.HintedHandoffPolicies[:i], data.HintedHandoffPolicies[i+1:]...)
+			return nil
+		}
+	}
+	return ErrHintedHandoffPolicyNotFound
+}
+
+// DropRetentionPolicy removes a retention policy along with its hinted
+// handoff policy, shard group alignment, read-only marks and cutovers of its
+// shards.
+func (data *Data) DropRetentionPolicy(database, name string) error {
+	if err := data.Data.DropRetentionPolicy(database, name); err != nil {
+		return err
+	}
+	data.dropHintedHandoffPolicies(func(p *HintedHandoffPolicy) bool {
+		return p.Database == database && p.RetentionPolicy == name
+	})
+	data.dropShardGroupAlignments(func(a *ShardGroupAlignment) bool {
+		return a.Database == database && a.RetentionPolicy == name
+	})
+	data.pruneDroppedShards()
+	return nil
+}
+
+// dropHintedHandoffPolicies removes policies matching fn.
+func (data *Data) dropHintedHandoffPolicies(fn func(p *HintedHandoffPolicy) bool) {
+	n := 0
+	for _, p := range data.HintedHandoffPolicies {
+		if !fn(&p) {
+			data.HintedHandoffPolicies[n] = p
+			n++
+		}
+	}
+	data.HintedHandoffPolicies = data.HintedHandoffPolicies[:n]
+}
@@ -0,0 +1,37 @@
+package meta
+
+import (
+	"strconv"
+)
+
+// NodeID, ShardID and ShardGroupID are distinct types to keep ids of different
+// kinds from being swapped by mistake. They are plain uint64 on the wire.
+// Shard owner, shard write and shard seal APIs take them so far, others still
+// take uint64.
+type (
+	NodeID       uint64
+	ShardID      uint64
+	ShardGroupID uint64
+)
+
+func (id NodeID) String() string       { return strconv.FormatUint(uint64(id), 10) }
+func (id ShardID) String() string      { return strconv.FormatUint(uint64(id), 10) }
+func (id ShardGroupID) String() string { return strconv.FormatUint(uint64(id), 10) }
+
+// ParseNodeID parses the decimal form of NodeID
+func ParseNodeID(s string) (NodeID, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	return NodeID(id), err
+}
+
+// ParseShardID parses the decimal form of ShardID
+func ParseShardID(s string) (ShardID, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	return ShardID(id), err
+}
+
+// ParseShardGroupID parses the decimal form of ShardGroupID
+func ParseShardGroupID(s string) (ShardGroupID, error) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	return ShardGroupID(id), err
+}
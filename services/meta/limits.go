@@ -0,0 +1,54 @@
+package meta
+
+import (
+	"fmt"
+
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// reachedLimit returns whether n reached the limit of key in cluster config.
+func (data *Data) reachedLimit(key string, n int) (int64, bool) {
+	max, ok := data.ClusterConfig.Int(key)
+	return max, ok && max > 0 && int64(n) >= max
+}
+
+// CreateDatabase creates a database unless max-databases is reached. Creating
+// an existing database is not an error.
+func (data *Data) CreateDatabase(name string) error {
+	if data.Database(name) == nil {
+		if max, ok := data.reachedLimit(ConfigMaxDatabases, len(data.Databases)); ok {
+			return fmt.Errorf("%w: %d of %s", ErrMaxDatabasesReached, max, ConfigMaxDatabases)
+		}
+	}
+	return data.Data.CreateDatabase(name)
+}
+
+// CreateRetentionPolicy creates a retention policy on database unless
+// max-retention-policies is reached for it. Creating the same retention
+// policy again is not an error.
+func (data *Data) CreateRetentionPolicy(database string, rpi *meta.RetentionPolicyInfo, makeDefault bool) error {
+	if di := data.Database(database); di != nil && rpi != nil && di.RetentionPolicy(rpi.Name) == nil {
+		if max, ok := data.reachedLimit(ConfigMaxRetentionPolicies, len(di.RetentionPolicies)); ok {
+			return fmt.Errorf("%w: %d of %s", ErrMaxRetentionPoliciesReached, max, ConfigMaxRetentionPolicies)
+		}
+	}
+	return data.Data.CreateRetentionPolicy(database, rpi, makeDefault)
+}
+
+// CreateUser creates a user unless max-users is reached.
+func (data *Data) CreateUser(name, hash string, admin bool) error {
+	if data.user(name) == nil {
+		if err := data.checkUsers(1); err != nil {
+			return err
+		}
+	}
+	return data.Data.CreateUser(name, hash, admin)
+}
+
+// checkUsers returns an error if n more users would exceed max-users.
+func (data *Data) checkUsers(n int) error {
+	if max, ok := data.reachedLimit(ConfigMaxUsers, len(data.Users)+n-1); ok {
+		return fmt.Errorf("%w: %d of %s", ErrMaxUsersReached, max, ConfigMaxUsers)
+	}
+	return nil
+}
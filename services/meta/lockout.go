@@ -0,0 +1,150 @@
+package meta
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// LockoutPolicy locks a user for Duration after Attempts failed
+// authentications within Window. Zero Attempts disables lockout. Admin users
+// are locked after AdminAttempts instead, zero exempts them.
+type LockoutPolicy struct {
+	Attempts      int
+	AdminAttempts int
+	Window        time.Duration
+	Duration      time.Duration
+}
+
+// Enabled returns whether failures should be counted
+func (p LockoutPolicy) Enabled() bool {
+	return p.Attempts > 0
+}
+
+func (p LockoutPolicy) attempts(admin bool) int {
+	if admin {
+		return p.AdminAttempts
+	}
+	return p.Attempts
+}
+
+// AuthFailures counts failed authentications of users in memory of a meta
+// node, so that failures cost no raft proposal until they lock a user. The
+// zero value is ready to use.
+type AuthFailures struct {
+	mu       sync.Mutex
+	failures map[string]authFailure
+}
+
+type authFailure struct {
+	attempts      int
+	firstFailedAt time.Time
+}
+
+// Fail counts a failed authentication of user at now, returning whether the
+// attempts within window reach the policy and the user should be locked.
+// Failures are forgotten once the user is to be locked, so that concurrent
+// failures lock it once.
+func (f *AuthFailures) Fail(name string, admin bool, now time.Time, policy LockoutPolicy) bool {
+	attempts := policy.attempts(admin)
+	if !policy.Enabled() || attempts <= 0 {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures == nil {
+		f.failures = make(map[string]authFailure)
+	}
+	for n, failure := range f.failures {
+		if now.Sub(failure.firstFailedAt) > policy.Window {
+			delete(f.failures, n)
+		}
+	}
+
+	failure, ok := f.failures[name]
+	if !ok {
+		failure.firstFailedAt = now
+	}
+	failure.attempts++
+	if failure.attempts >= attempts {
+		delete(f.failures, name)
+		return true
+	}
+	f.failures[name] = failure
+	return false
+}
+
+// Reset forgets failures of user, once it authenticated.
+func (f *AuthFailures) Reset(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.failures, name)
+}
+
+// LockedUser is a user locked because of failed authentications.
+type LockedUser struct {
+	Name        string
+	LockedUntil time.Time
+}
+
+// UserLocked returns whether the user is locked at now.
+func (data *Data) UserLocked(name string, now time.Time) bool {
+	until, ok := data.UserLocks[name]
+	return ok && now.Before(until)
+}
+
+// LockUser locks user until the time given, forgetting locks expired at now.
+func (data *Data) LockUser(name string, until, now time.Time) error {
+	if data.user(name) == nil {
+		return meta.ErrUserNotFound
+	}
+	for n, t := range data.UserLocks {
+		if !now.Before(t) {
+			delete(data.UserLocks, n)
+		}
+	}
+	if data.UserLocks == nil {
+		data.UserLocks = make(map[string]time.Time)
+	}
+	data.UserLocks[name] = until
+	return nil
+}
+
+// UnlockUser clears the lock of user.
+func (data *Data) UnlockUser(name string) error {
+	if data.user(name) == nil {
+		return meta.ErrUserNotFound
+	}
+	delete(data.UserLocks, name)
+	return nil
+}
+
+func (data *Data) dropUserLock(name string) {
+	delete(data.UserLocks, name)
+}
+
+// LockedUsers returns users locked at now sorted by name.
+func (data *Data) LockedUsers(now time.Time) []LockedUser {
+	var users []LockedUser
+	for name, until := range data.UserLocks {
+		if now.Before(until) {
+			users = append(users, LockedUser{Name: name, LockedUntil: until})
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+func cloneUserLocks(src map[string]time.Time) map[string]time.Time {
+	if src == nil {
+		return nil
+	}
+	other := make(map[string]time.Time, len(src))
+	for k, v := range src {
+		other[k] = v
+	}
+	return other
+}
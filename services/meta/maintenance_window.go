@@ -0,0 +1,153 @@
+package meta
+
+import (
+	"time"
+)
+
+// Behaviors of data nodes in maintenance windows. All of them leave the
+// nodes alone by automatic actions: they're not reported unhealthy by the
+// doctor and their stale shards are not caught up until the window ends.
+const (
+	// MaintenanceFreeze only leaves the nodes alone.
+	MaintenanceFreeze = "freeze"
+	// MaintenanceDrain also drains reads of queries from other nodes on the
+	// nodes, resumed once the window ends.
+	MaintenanceDrain = "drain"
+	// MaintenanceExcludeReads also plans reads of queries on other owners of
+	// shards, like copies of the nodes were stale.
+	MaintenanceExcludeReads = "exclude-reads"
+)
+
+// MaintenanceWindow is planned maintenance of data nodes from Start lasting
+// Duration, e.g. for reboots.
+type MaintenanceWindow struct {
+	ID       uint64
+	Nodes    []uint64
+	Start    time.Time
+	Duration time.Duration
+	Behavior string
+	Reason   string `json:",omitempty"`
+}
+
+// End returns the time the window ends.
+func (w *MaintenanceWindow) End() time.Time {
+	return w.Start.Add(w.Duration)
+}
+
+// Active tells whether the window is open at now.
+func (w *MaintenanceWindow) Active(now time.Time) bool {
+	return !now.Before(w.Start) && now.Before(w.End())
+}
+
+func (w *MaintenanceWindow) covers(nodeID uint64) bool {
+	for _, id := range w.Nodes {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (w MaintenanceWindow) clone() MaintenanceWindow {
+	w.Nodes = append([]uint64(nil), w.Nodes...)
+	return w
+}
+
+func validMaintenanceBehavior(behavior string) bool {
+	switch behavior {
+	case MaintenanceFreeze, MaintenanceDrain, MaintenanceExcludeReads:
+		return true
+	}
+	return false
+}
+
+// CreateMaintenanceWindow schedules w for data nodes existing, with a new ID,
+// pruning windows ended before now.
+func (data *Data) CreateMaintenanceWindow(w MaintenanceWindow, now time.Time) (*MaintenanceWindow, error) {
+	if len(w.Nodes) == 0 || w.Duration <= 0 || !validMaintenanceBehavior(w.Behavior) {
+		return nil, ErrInvalidMaintenanceWindow
+	}
+	for _, id := range w.Nodes {
+		if data.DataNode(id) == nil {
+			return nil, ErrNodeNotFound
+		}
+	}
+
+	data.pruneMaintenanceWindows(now)
+	data.MaxMaintenanceWindowID++
+	w = w.clone()
+	w.ID = data.MaxMaintenanceWindowID
+	data.MaintenanceWindows = append(data.MaintenanceWindows, w)
+	w = w.clone()
+	return &w, nil
+}
+
+// DeleteMaintenanceWindow removes window id, ending it if open.
+func (data *Data) DeleteMaintenanceWindow(id uint64) error {
+	for i := range data.MaintenanceWindows {
+		if data.MaintenanceWindows[i].ID == id {
+			data.MaintenanceWindows = append(data.MaintenanceWindows[:i], data.MaintenanceWindows[i+1:]...)
+			return nil
+		}
+	}
+	return ErrMaintenanceWindowNotFound
+}
+
+// InMaintenance tells whether node nodeID is in a window of behavior open at
+// now. Windows of any behavior match MaintenanceFreeze, which all imply.
+func (data *Data) InMaintenance(nodeID uint64, now time.Time, behavior string) bool {
+	for i := range data.MaintenanceWindows {
+		w := &data.MaintenanceWindows[i]
+		if !w.Active(now) || !w.covers(nodeID) {
+			continue
+		}
+		if behavior == MaintenanceFreeze || w.Behavior == behavior {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeMaintenanceWindows returns the windows of node nodeID open at now, in
+// the order scheduled.
+func (data *Data) NodeMaintenanceWindows(nodeID uint64, now time.Time) []MaintenanceWindow {
+	var windows []MaintenanceWindow
+	for _, w := range data.MaintenanceWindows {
+		if w.Active(now) && w.covers(nodeID) {
+			windows = append(windows, w.clone())
+		}
+	}
+	return windows
+}
+
+// pruneMaintenanceWindows drops windows ended before now.
+func (data *Data) pruneMaintenanceWindows(now time.Time) {
+	n := 0
+	for _, w := range data.MaintenanceWindows {
+		if now.Before(w.End()) {
+			data.MaintenanceWindows[n] = w
+			n++
+		}
+	}
+	data.MaintenanceWindows = data.MaintenanceWindows[:n]
+}
+
+// removeMaintenanceNode takes node nodeID out of windows, dropping windows
+// left without nodes.
+func (data *Data) removeMaintenanceNode(nodeID uint64) {
+	n := 0
+	for _, w := range data.MaintenanceWindows {
+		nodes := w.Nodes[:0]
+		for _, id := range w.Nodes {
+			if id != nodeID {
+				nodes = append(nodes, id)
+			}
+		}
+		w.Nodes = nodes
+		if len(w.Nodes) > 0 {
+			data.MaintenanceWindows[n] = w
+			n++
+		}
+	}
+	data.MaintenanceWindows = data.MaintenanceWindows[:n]
+}
@@ -0,0 +1,129 @@
+package meta
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+)
+
+// ParsePrivilege parses one of READ, WRITE, ALL and NONE case-insensitively.
+func ParsePrivilege(s string) (influxql.Privilege, error) {
+	switch strings.ToUpper(s) {
+	case "READ":
+		return influxql.ReadPrivilege, nil
+	case "WRITE":
+		return influxql.WritePrivilege, nil
+	case "ALL":
+		return influxql.AllPrivileges, nil
+	case "NONE":
+		return influxql.NoPrivileges, nil
+	}
+	return influxql.NoPrivileges, fmt.Errorf("unknown privilege %s", s)
+}
+
+// MeasurementPrivilege scopes a privilege to measurements matching Pattern
+// within a database. Pattern is in the syntax of path.Match, like cpu_*.
+type MeasurementPrivilege struct {
+	Pattern   string
+	Privilege influxql.Privilege
+}
+
+// Allows returns whether the privilege permits p on measurement name.
+func (mp *MeasurementPrivilege) Allows(name string, p influxql.Privilege) bool {
+	if mp.Privilege != influxql.AllPrivileges && mp.Privilege != p {
+		return false
+	}
+	matched, _ := path.Match(mp.Pattern, name)
+	return matched
+}
+
+// UserMeasurementPrivileges returns the measurement scoped privileges of user
+// on database. Nil is returned if the user is not restricted to measurements.
+func (data *Data) UserMeasurementPrivileges(username, database string) []MeasurementPrivilege {
+	privs := data.MeasurementPrivileges[username][database]
+	if len(privs) == 0 {
+		return nil
+	}
+	return append([]MeasurementPrivilege(nil), privs...)
+}
+
+// SetMeasurementPrivilege grants p on measurements matching pattern of database
+// to user. NoPrivileges revokes the grant of pattern.
+func (data *Data) SetMeasurementPrivilege(username, database, pattern string, p influxql.Privilege) error {
+	if data.user(username) == nil {
+		return meta.ErrUserNotFound
+	} else if data.Database(database) == nil {
+		return influxdb.ErrDatabaseNotFound(database)
+	} else if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+		return ErrMeasurementPatternInvalid
+	}
+
+	privs := data.MeasurementPrivileges[username][database]
+	n := 0
+	for _, mp := range privs {
+		if mp.Pattern != pattern {
+			privs[n] = mp
+			n++
+		}
+	}
+	privs = privs[:n]
+	if p != influxql.NoPrivileges {
+		privs = append(privs, MeasurementPrivilege{Pattern: pattern, Privilege: p})
+	}
+
+	if data.MeasurementPrivileges == nil {
+		data.MeasurementPrivileges = make(map[string]map[string][]MeasurementPrivilege)
+	}
+	if data.MeasurementPrivileges[username] == nil {
+		data.MeasurementPrivileges[username] = make(map[string][]MeasurementPrivilege)
+	}
+	if len(privs) == 0 {
+		delete(data.MeasurementPrivileges[username], database)
+	} else {
+		data.MeasurementPrivileges[username][database] = privs
+	}
+	if len(data.MeasurementPrivileges[username]) == 0 {
+		delete(data.MeasurementPrivileges, username)
+	}
+	return nil
+}
+
+func (data *Data) dropUserMeasurementPrivileges(username string) {
+	delete(data.MeasurementPrivileges, username)
+}
+
+func (data *Data) dropDatabaseMeasurementPrivileges(database string) {
+	for user, dbs := range data.MeasurementPrivileges {
+		delete(dbs, database)
+		if len(dbs) == 0 {
+			delete(data.MeasurementPrivileges, user)
+		}
+	}
+}
+
+func (data *Data) user(name string) *meta.UserInfo {
+	for i := range data.Users {
+		if data.Users[i].Name == name {
+			return &data.Users[i]
+		}
+	}
+	return nil
+}
+
+func cloneMeasurementPrivileges(src map[string]map[string][]MeasurementPrivilege) map[string]map[string][]MeasurementPrivilege {
+	if src == nil {
+		return nil
+	}
+	other := make(map[string]map[string][]MeasurementPrivilege, len(src))
+	for user, dbs := range src {
+		other[user] = make(map[string][]MeasurementPrivilege, len(dbs))
+		for db, privs := range dbs {
+			other[user][db] = append([]MeasurementPrivilege(nil), privs...)
+		}
+	}
+	return other
+}
@@ -0,0 +1,127 @@
+package meta
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb"
+)
+
+// MeasurementTombstoneTTL is how long a tombstone applied by all data nodes
+// is kept, the default max-age of hinted handoff so that points of the
+// measurement queued before the drop are skipped once delivered.
+const MeasurementTombstoneTTL = 7 * 24 * time.Hour
+
+// MeasurementTombstone records a DROP MEASUREMENT, so that data nodes not
+// reached by the drop apply it once back and hinted handoff skips points of
+// the measurement queued before it.
+type MeasurementTombstone struct {
+	ID        uint64
+	Database  string
+	Name      string
+	DroppedAt time.Time
+	// Pending are the data nodes which haven't applied the drop yet
+	Pending []uint64
+}
+
+func (t MeasurementTombstone) clone() MeasurementTombstone {
+	t.Pending = append([]uint64(nil), t.Pending...)
+	return t
+}
+
+// pending tells whether node nodeID hasn't applied the drop yet.
+func (t *MeasurementTombstone) pending(nodeID uint64) bool {
+	for _, id := range t.Pending {
+		if id == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *MeasurementTombstone) ack(nodeID uint64) {
+	for i, id := range t.Pending {
+		if id == nodeID {
+			t.Pending = append(t.Pending[:i], t.Pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// CreateMeasurementTombstone records measurement name of database dropped at
+// now, to be applied by all data nodes.
+func (data *Data) CreateMeasurementTombstone(database, name string, now time.Time) (*MeasurementTombstone, error) {
+	if data.Database(database) == nil {
+		return nil, influxdb.ErrDatabaseNotFound(database)
+	}
+
+	data.MaxMeasurementTombstoneID++
+	t := MeasurementTombstone{
+		ID:        data.MaxMeasurementTombstoneID,
+		Database:  database,
+		Name:      name,
+		DroppedAt: now,
+	}
+	for _, n := range data.DataNodes {
+		t.Pending = append(t.Pending, n.ID)
+	}
+	data.MeasurementTombstones = append(data.MeasurementTombstones, t)
+	data.pruneMeasurementTombstones(now)
+	t = t.clone()
+	return &t, nil
+}
+
+// AckMeasurementTombstone marks tombstone id applied by node nodeID at now.
+// Acknowledging a tombstone pruned already is not an error.
+func (data *Data) AckMeasurementTombstone(id, nodeID uint64, now time.Time) error {
+	for i := range data.MeasurementTombstones {
+		if data.MeasurementTombstones[i].ID == id {
+			data.MeasurementTombstones[i].ack(nodeID)
+		}
+	}
+	data.pruneMeasurementTombstones(now)
+	return nil
+}
+
+// NodeMeasurementTombstones returns the tombstones node nodeID hasn't
+// applied yet, in the order of the drops.
+func (data *Data) NodeMeasurementTombstones(nodeID uint64) []MeasurementTombstone {
+	var tombstones []MeasurementTombstone
+	for _, t := range data.MeasurementTombstones {
+		if t.pending(nodeID) {
+			tombstones = append(tombstones, t.clone())
+		}
+	}
+	return tombstones
+}
+
+// MeasurementDroppedAfter tells whether measurement name of database was
+// dropped after t.
+func (data *Data) MeasurementDroppedAfter(database, name string, t time.Time) bool {
+	for _, ts := range data.MeasurementTombstones {
+		if ts.Database == database && ts.Name == name && ts.DroppedAt.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneMeasurementTombstones drops tombstones applied by all data nodes
+// longer than MeasurementTombstoneTTL ago.
+func (data *Data) pruneMeasurementTombstones(now time.Time) {
+	n := 0
+	for _, t := range data.MeasurementTombstones {
+		if len(t.Pending) > 0 || now.Sub(t.DroppedAt) < MeasurementTombstoneTTL {
+			data.MeasurementTombstones[n] = t
+			n++
+		}
+	}
+	data.MeasurementTombstones = data.MeasurementTombstones[:n]
+}
+
+// ackNodeMeasurementTombstones marks all tombstones applied by node nodeID,
+// e.g. of a node deleted.
+func (data *Data) ackNodeMeasurementTombstones(nodeID uint64) {
+	for i := range data.MeasurementTombstones {
+		data.MeasurementTombstones[i].ack(nodeID)
+	}
+}
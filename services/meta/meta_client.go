@@ -0,0 +1,119 @@
+package meta
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+)
+
+// MetaClient is the meta data of the cluster as data nodes see it: read from
+// a local cache of the store and changed through meta servers. It's
+// implemented by coordinator.ClusterMetaClient, programs embedding chronus
+// may supply another, e.g. a client reading meta servers only or a mock.
+// Services take the part of it they use.
+type MetaClient interface {
+	ClusterID() uint64
+	MarshalBinary() ([]byte, error)
+	MetaIndex() (local, remote uint64, err error)
+	ClockSkew() (last, max time.Duration)
+	WaitForDataChanged() chan struct{}
+	AcquireLease(name string) (*meta.Lease, error)
+
+	ClusterConfig() ClusterConfig
+	WaitForClusterConfigChanged() chan struct{}
+	HintedHandoffEnabled(database, rp string) bool
+
+	// data nodes
+	CreateDataNode(httpAddr, tcpAddr string) (*meta.NodeInfo, error)
+	DataNode(id uint64) (*meta.NodeInfo, error)
+	DataNodes() ([]meta.NodeInfo, error)
+	DataNodeByTCPHost(addr string) (*meta.NodeInfo, error)
+	DeleteDataNode(id uint64) error
+	RegisterDataNode(id uint64) (uint64, error)
+	StaleIncarnation(id, incarnation uint64) bool
+	IsDataNodeFreezed(id uint64) bool
+	FreezeDataNode(id uint64) error
+	UnfreezeDataNode(id uint64) error
+
+	// databases and retention policies
+	Database(name string) *meta.DatabaseInfo
+	Databases() []meta.DatabaseInfo
+	CreateDatabase(name string) (*meta.DatabaseInfo, error)
+	CreateDatabaseWithRetentionPolicy(name string, spec *meta.RetentionPolicySpec) (*meta.DatabaseInfo, error)
+	CreateDatabaseFromTemplate(name, template string) (*meta.DatabaseInfo, error)
+	DropDatabase(name string) error
+	RetentionPolicy(database, name string) (*meta.RetentionPolicyInfo, error)
+	CreateRetentionPolicy(database string, spec *meta.RetentionPolicySpec, makeDefault bool) (*meta.RetentionPolicyInfo, error)
+	UpdateRetentionPolicy(database, name string, rpu *meta.RetentionPolicyUpdate, makeDefault bool) error
+	DropRetentionPolicy(database, name string) error
+	CreateContinuousQuery(database, name, query string) error
+	DropContinuousQuery(database, name string) error
+	CreateSubscription(database, rp, name, mode string, destinations []string) error
+	DropSubscription(database, rp, name string) error
+	BucketMapping(org, bucket string) *BucketMapping
+
+	// shard groups and shards
+	ShardIDs() []uint64
+	ShardOwner(id uint64) (string, string, *meta.ShardGroupInfo)
+	ShardGroupsByTimeRange(database, policy string, min, max time.Time) ([]meta.ShardGroupInfo, error)
+	CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error)
+	CreateShardGroupsForRange(database, policy string, start, end time.Time) ([]meta.ShardGroupInfo, error)
+	PreviewShardOwners(database, policy string, timestamp time.Time) ([]meta.ShardInfo, error)
+	PrecreateShardGroups(from, to time.Time) error
+	TruncateShardGroups(t time.Time) error
+	DeleteShardGroup(database, policy string, id uint64) error
+	PruneShardGroups() error
+	FreezeShardGroups(id string, until time.Time) ([]byte, error)
+	ThawShardGroups(id string) error
+	DropShard(id uint64) error
+	AddShardOwner(shardID ShardID, nodeID NodeID) error
+	RemoveShardOwner(shardID ShardID, nodeID NodeID) error
+	ShardReadOnly(id uint64) bool
+	ShardCutover(id uint64) *ShardCutover
+	BeginShardCutover(shardID, nodeID uint64, expiration time.Time) error
+	EndShardCutover(shardID uint64) error
+	ShardStale(id, nodeID uint64) bool
+	StaleShards(nodeID uint64) []StaleShard
+	MarkShardsStale(nodeID uint64, shardIDs []uint64) error
+	ClearStaleShard(shardID, nodeID uint64) error
+	ShardSealed(id uint64) bool
+	SealedShards() []SealedShard
+	SealShardGroups(grace time.Duration) (int, error)
+	SetSealedShardChecksum(shardID uint64, checksum uint32, diverged bool) error
+
+	// measurements
+	MeasurementTombstones(nodeID uint64) []MeasurementTombstone
+	MeasurementDroppedAfter(database, name string, t time.Time) bool
+	CreateMeasurementTombstone(database, name string) (*MeasurementTombstone, error)
+	AckMeasurementTombstone(id, nodeID uint64) error
+
+	// maintenance windows
+	MaintenanceWindows() []MaintenanceWindow
+	InMaintenance(nodeID uint64, now time.Time, behavior string) bool
+	NodeMaintenanceWindows(nodeID uint64, now time.Time) []MaintenanceWindow
+
+	// users
+	Users() []meta.UserInfo
+	User(name string) (meta.User, error)
+	UserCount() int
+	AdminUserExists() bool
+	CreateUser(name, password string, admin bool) (meta.User, error)
+	UpdateUser(name, password string) error
+	DropUser(name string) error
+	SetAdminPrivilege(username string, admin bool) error
+	SetPrivilege(username, database string, p influxql.Privilege) error
+	UserPrivilege(username, database string) (*influxql.Privilege, error)
+	UserPrivileges(username string) (map[string]influxql.Privilege, error)
+	SetMeasurementPrivilege(username, database, pattern string, p influxql.Privilege) error
+	UserMeasurementPrivileges(username, database string) []MeasurementPrivilege
+	SetOperatorRole(username string, role OperatorRole) error
+	UserOperatorRole(username string) OperatorRole
+	AuthorizeQuery(u meta.User, stmt influxql.Statement, database string) error
+	AuthorizeSources(u meta.User, stmt influxql.Statement, database string) error
+	Authenticate(username, password string) (meta.User, error)
+	AuthenticateToken(token string) (meta.User, error)
+	CreateSession(username string, ttl time.Duration) (string, time.Time, error)
+	AuthenticateSession(token string) (meta.User, error)
+	DropSession(token string) error
+}
@@ -0,0 +1,73 @@
+package meta
+
+import (
+	"sort"
+	"time"
+)
+
+// NodeIncarnation is the last start of a data node registered in meta. Each
+// start gets a new incarnation, unique across the cluster, so that requests
+// of processes started before, e.g. half-dead ones left running or copies of
+// the node using the same identity file, are told apart and rejected.
+type NodeIncarnation struct {
+	NodeID      uint64
+	Incarnation uint64
+	StartedAt   time.Time
+}
+
+func (data *Data) nodeIncarnationIndex(id uint64) (int, bool) {
+	i := sort.Search(len(data.NodeIncarnations), func(i int) bool { return data.NodeIncarnations[i].NodeID >= id })
+	return i, i < len(data.NodeIncarnations) && data.NodeIncarnations[i].NodeID == id
+}
+
+// DataNodeIncarnation returns the incarnation of data node id, false if the
+// node doesn't exist. An incarnation of 0 is of a node never registered a
+// start, e.g. before incarnations.
+func (data *Data) DataNodeIncarnation(id uint64) (uint64, bool) {
+	if data.DataNode(id) == nil {
+		return 0, false
+	}
+	i, ok := data.nodeIncarnationIndex(id)
+	if !ok {
+		return 0, true
+	}
+	return data.NodeIncarnations[i].Incarnation, true
+}
+
+// StaleIncarnation tells whether incarnation of data node id is replaced by a
+// newer start of the node or the node is deleted. Incarnations not known yet,
+// e.g. of starts registered after the data was synced, and 0 of nodes before
+// incarnations are not stale.
+func (data *Data) StaleIncarnation(id, incarnation uint64) bool {
+	if incarnation == 0 || incarnation > data.MaxIncarnation {
+		return false
+	}
+	current, ok := data.DataNodeIncarnation(id)
+	return !ok || current > incarnation
+}
+
+// RegisterDataNode registers a start of data node id at now, returning its new
+// incarnation. Processes of older incarnations of the node are stale.
+func (data *Data) RegisterDataNode(id uint64, now time.Time) (uint64, error) {
+	if data.DataNode(id) == nil {
+		return 0, ErrNodeNotFound
+	}
+	data.MaxIncarnation++
+	n := NodeIncarnation{NodeID: id, Incarnation: data.MaxIncarnation, StartedAt: now}
+	i, ok := data.nodeIncarnationIndex(id)
+	if !ok {
+		data.NodeIncarnations = append(data.NodeIncarnations, NodeIncarnation{})
+		copy(data.NodeIncarnations[i+1:], data.NodeIncarnations[i:])
+	}
+	data.NodeIncarnations[i] = n
+	return n.Incarnation, nil
+}
+
+// dropNodeIncarnation removes the incarnation of data node id deleted. Its
+// processes left are stale as the node doesn't exist, and incarnations are
+// never reused even if id is.
+func (data *Data) dropNodeIncarnation(id uint64) {
+	if i, ok := data.nodeIncarnationIndex(id); ok {
+		data.NodeIncarnations = append(data.NodeIncarnations[:i], data.NodeIncarnations[i+1:]...)
+	}
+}
@@ -0,0 +1,94 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// OperatorRole is the role of a user on the controller API. Roles are ordered,
+// each allowing the operations of the roles below it: viewers read status,
+// operators move shards and freeze nodes, admins also delete nodes or drop
+// databases. Influx admin users have all roles.
+type OperatorRole string
+
+const (
+	// OperatorRoleNone allows no operation.
+	OperatorRoleNone OperatorRole = ""
+	// OperatorRoleViewer allows reading status of the cluster.
+	OperatorRoleViewer OperatorRole = "viewer"
+	// OperatorRoleOperator allows moving shards and freezing nodes.
+	OperatorRoleOperator OperatorRole = "operator"
+	// OperatorRoleAdmin allows all operations.
+	OperatorRoleAdmin OperatorRole = "admin"
+)
+
+// level orders roles, 0 of unknown ones.
+func (r OperatorRole) level() int {
+	switch r {
+	case OperatorRoleViewer:
+		return 1
+	case OperatorRoleOperator:
+		return 2
+	case OperatorRoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// Allows returns whether the role permits operations requiring role required.
+func (r OperatorRole) Allows(required OperatorRole) bool {
+	return r.level() > 0 && r.level() >= required.level()
+}
+
+// ParseOperatorRole parses one of viewer, operator, admin and none
+// case-insensitively.
+func ParseOperatorRole(s string) (OperatorRole, error) {
+	r := OperatorRole(strings.ToLower(s))
+	if r == "none" {
+		return OperatorRoleNone, nil
+	} else if r.level() == 0 {
+		return OperatorRoleNone, fmt.Errorf("unknown operator role %s", s)
+	}
+	return r, nil
+}
+
+// UserOperatorRole returns the operator role assigned to user, none if not.
+func (data *Data) UserOperatorRole(username string) OperatorRole {
+	return data.OperatorRoles[username]
+}
+
+// SetOperatorRole assigns role to user, OperatorRoleNone revokes it.
+func (data *Data) SetOperatorRole(username string, role OperatorRole) error {
+	if data.user(username) == nil {
+		return meta.ErrUserNotFound
+	} else if role != OperatorRoleNone && role.level() == 0 {
+		return ErrOperatorRoleInvalid
+	}
+
+	if role == OperatorRoleNone {
+		delete(data.OperatorRoles, username)
+		return nil
+	}
+	if data.OperatorRoles == nil {
+		data.OperatorRoles = make(map[string]OperatorRole)
+	}
+	data.OperatorRoles[username] = role
+	return nil
+}
+
+func cloneOperatorRoles(src map[string]OperatorRole) map[string]OperatorRole {
+	if src == nil {
+		return nil
+	}
+	other := make(map[string]OperatorRole, len(src))
+	for k, v := range src {
+		other[k] = v
+	}
+	return other
+}
+
+func (data *Data) dropUserOperatorRole(username string) {
+	delete(data.OperatorRoles, username)
+}
@@ -0,0 +1,254 @@
+package meta
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashScrypt   = "scrypt"
+	PasswordHashArgon2id = "argon2id"
+
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+
+	// scrypt parameters recommended for interactive logins
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+
+	// argon2id parameters recommended by RFC 9106
+	argon2Time    = 1
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+
+	// bounds of parameters of hashes compared, so that a crafted hash can't
+	// make authentication exhaust memory or cpu
+	passwordMaxMemory = 256 << 20
+	scryptMaxLogN     = 20
+	scryptMaxRP       = 64
+	argon2MaxTime     = 16
+)
+
+// PasswordHasher hashes passwords of users. Hashes are self-describing so
+// that any of them can be verified whatever the hasher configured is.
+type PasswordHasher interface {
+	// Name returns the algorithm name
+	Name() string
+	// Hash returns the encoded hash of password with a random salt
+	Hash(password string) (string, error)
+	// Compare returns meta.ErrAuthenticate if password mismatches hash
+	Compare(hash, password string) error
+}
+
+// NewPasswordHasher returns the hasher of algorithm name.
+func NewPasswordHasher(name string) (PasswordHasher, error) {
+	switch name {
+	case "", PasswordHashBcrypt:
+		return bcryptHasher{}, nil
+	case PasswordHashScrypt:
+		return scryptHasher{}, nil
+	case PasswordHashArgon2id:
+		return argon2idHasher{}, nil
+	}
+	return nil, fmt.Errorf("unknown password hash algorithm: %s", name)
+}
+
+// hasherOf returns the hasher which produced hash.
+func hasherOf(hash string) PasswordHasher {
+	switch {
+	case strings.HasPrefix(hash, "$"+PasswordHashScrypt+"$"):
+		return scryptHasher{}
+	case strings.HasPrefix(hash, "$"+PasswordHashArgon2id+"$"):
+		return argon2idHasher{}
+	}
+	return bcryptHasher{}
+}
+
+// ComparePassword verifies password against hash of any supported algorithm.
+func ComparePassword(hash, password string) error {
+	return hasherOf(hash).Compare(hash, password)
+}
+
+// checkPasswordHash returns meta.ErrAuthenticate unless hash is one of a
+// supported algorithm with parameters in bounds, so that no hash taken as is
+// authenticates any password or none.
+func checkPasswordHash(hash string) error {
+	var err error
+	switch hasherOf(hash).(type) {
+	case scryptHasher:
+		_, err = decodeScrypt(hash)
+	case argon2idHasher:
+		_, err = decodeArgon2id(hash)
+	default:
+		if _, err = bcrypt.Cost([]byte(hash)); err != nil {
+			err = meta.ErrAuthenticate
+		}
+	}
+	return err
+}
+
+// NeedsRehash returns whether hash is produced by another algorithm than h.
+func NeedsRehash(hash string, h PasswordHasher) bool {
+	return hasherOf(hash).Name() != h.Name()
+}
+
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func encodeB64(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+// decodeHash splits $<name>$<params>$<salt>$<key>
+func decodeHash(hash, name string) (params string, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[1] != name {
+		return "", nil, nil, meta.ErrAuthenticate
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil {
+		return "", nil, nil, meta.ErrAuthenticate
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil || len(key) != passwordKeyLength {
+		return "", nil, nil, meta.ErrAuthenticate
+	}
+	return parts[2], salt, key, nil
+}
+
+func compareKey(expected, actual []byte) error {
+	if subtle.ConstantTimeCompare(expected, actual) != 1 {
+		return meta.ErrAuthenticate
+	}
+	return nil
+}
+
+type bcryptHasher struct{}
+
+func (bcryptHasher) Name() string { return PasswordHashBcrypt }
+
+func (bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func (bcryptHasher) Compare(hash, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return meta.ErrAuthenticate
+	}
+	return nil
+}
+
+// scryptHasher encodes as $scrypt$ln=15,r=8,p=1$<salt>$<key>
+type scryptHasher struct{}
+
+func (scryptHasher) Name() string { return PasswordHashScrypt }
+
+func (scryptHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<scryptLogN, scryptR, scryptP, passwordKeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$%s$ln=%d,r=%d,p=%d$%s$%s", PasswordHashScrypt, scryptLogN, scryptR, scryptP, encodeB64(salt), encodeB64(key)), nil
+}
+
+// scryptHash is a decoded scrypt hash.
+type scryptHash struct {
+	logN      uint
+	r, p      int
+	salt, key []byte
+}
+
+// decodeScrypt decodes hash, rejecting parameters out of bounds.
+func decodeScrypt(hash string) (*scryptHash, error) {
+	params, salt, key, err := decodeHash(hash, PasswordHashScrypt)
+	if err != nil {
+		return nil, err
+	}
+	h := &scryptHash{salt: salt, key: key}
+	if _, err := fmt.Sscanf(params, "ln=%d,r=%d,p=%d", &h.logN, &h.r, &h.p); err != nil {
+		return nil, meta.ErrAuthenticate
+	}
+	if h.logN < 1 || h.logN > scryptMaxLogN || h.r < 1 || h.p < 1 || h.r*h.p > scryptMaxRP ||
+		int64(128*h.r)<<h.logN > passwordMaxMemory {
+		return nil, meta.ErrAuthenticate
+	}
+	return h, nil
+}
+
+func (scryptHasher) Compare(hash, password string) error {
+	h, err := decodeScrypt(hash)
+	if err != nil {
+		return err
+	}
+	actual, err := scrypt.Key([]byte(password), h.salt, 1<<h.logN, h.r, h.p, len(h.key))
+	if err != nil {
+		return meta.ErrAuthenticate
+	}
+	return compareKey(h.key, actual)
+}
+
+// argon2idHasher encodes in PHC format as $argon2id$v=19,m=65536,t=1,p=4$<salt>$<key>
+type argon2idHasher struct{}
+
+func (argon2idHasher) Name() string { return PasswordHashArgon2id }
+
+func (argon2idHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, passwordKeyLength)
+	return fmt.Sprintf("$%s$v=%d,m=%d,t=%d,p=%d$%s$%s", PasswordHashArgon2id, argon2.Version, argon2Memory, argon2Time, argon2Threads, encodeB64(salt), encodeB64(key)), nil
+}
+
+// argon2idHash is a decoded argon2id hash.
+type argon2idHash struct {
+	memory, time uint32
+	threads      uint8
+	salt, key    []byte
+}
+
+// decodeArgon2id decodes hash, rejecting parameters out of bounds.
+func decodeArgon2id(hash string) (*argon2idHash, error) {
+	params, salt, key, err := decodeHash(hash, PasswordHashArgon2id)
+	if err != nil {
+		return nil, err
+	}
+	h := &argon2idHash{salt: salt, key: key}
+	var version int
+	if _, err := fmt.Sscanf(params, "v=%d,m=%d,t=%d,p=%d", &version, &h.memory, &h.time, &h.threads); err != nil || version != argon2.Version {
+		return nil, meta.ErrAuthenticate
+	}
+	if h.time < 1 || h.time > argon2MaxTime || h.threads < 1 || int64(h.memory)<<10 > passwordMaxMemory {
+		return nil, meta.ErrAuthenticate
+	}
+	return h, nil
+}
+
+func (argon2idHasher) Compare(hash, password string) error {
+	h, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	actual := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return compareKey(h.key, actual)
+}
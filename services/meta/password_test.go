@@ -0,0 +1,76 @@
+package meta_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/stretchr/testify/assert"
+
+	imeta "github.com/angopher/chronus/services/meta"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	for _, name := range []string{imeta.PasswordHashBcrypt, imeta.PasswordHashScrypt, imeta.PasswordHashArgon2id} {
+		h, err := imeta.NewPasswordHasher(name)
+		assert.Nil(t, err)
+		assert.Equal(t, name, h.Name())
+
+		hash, err := h.Hash("secret")
+		assert.Nil(t, err)
+		assert.Nil(t, h.Compare(hash, "secret"))
+		assert.Equal(t, meta.ErrAuthenticate, h.Compare(hash, "wrong"))
+		assert.Nil(t, imeta.ComparePassword(hash, "secret"))
+		assert.Equal(t, meta.ErrAuthenticate, imeta.ComparePassword(hash, "wrong"))
+
+		another, err := h.Hash("secret")
+		assert.Nil(t, err)
+		assert.NotEqual(t, hash, another)
+	}
+
+	_, err := imeta.NewPasswordHasher("md5")
+	assert.NotNil(t, err)
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	bcrypt, _ := imeta.NewPasswordHasher(imeta.PasswordHashBcrypt)
+	argon2id, _ := imeta.NewPasswordHasher(imeta.PasswordHashArgon2id)
+
+	hash, err := bcrypt.Hash("secret")
+	assert.Nil(t, err)
+	assert.False(t, imeta.NeedsRehash(hash, bcrypt))
+	assert.True(t, imeta.NeedsRehash(hash, argon2id))
+
+	hash, err = argon2id.Hash("secret")
+	assert.Nil(t, err)
+	assert.False(t, imeta.NeedsRehash(hash, argon2id))
+	assert.True(t, imeta.NeedsRehash(hash, bcrypt))
+	assert.Equal(t, meta.ErrAuthenticate, bcrypt.Compare(hash, "secret"))
+}
+
+func TestPasswordHasher_Malformed(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString(make([]byte, 16))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, 32))
+	for _, hash := range []string{
+		// no key authenticates any password
+		"$scrypt$ln=15,r=8,p=1$" + salt + "$",
+		"$argon2id$v=19,m=65536,t=1,p=4$" + salt + "$",
+		"$scrypt$ln=15,r=8,p=1$" + salt + "$" + key[:10],
+		// parameters making the kdf panic or exhaust memory
+		"$scrypt$ln=0,r=8,p=1$" + salt + "$" + key,
+		"$scrypt$ln=15,r=0,p=1$" + salt + "$" + key,
+		"$scrypt$ln=15,r=8,p=0$" + salt + "$" + key,
+		"$scrypt$ln=15,r=64,p=64$" + salt + "$" + key,
+		"$scrypt$ln=30,r=8,p=1$" + salt + "$" + key,
+		"$argon2id$v=19,m=65536,t=0,p=4$" + salt + "$" + key,
+		"$argon2id$v=19,m=65536,t=1,p=0$" + salt + "$" + key,
+		"$argon2id$v=19,m=4294967295,t=1,p=4$" + salt + "$" + key,
+		"$argon2id$v=19,m=65536,t=1000000,p=4$" + salt + "$" + key,
+		"$argon2id$v=16,m=65536,t=1,p=4$" + salt + "$" + key,
+		"$argon2id$" + strings.Repeat("$", 4),
+	} {
+		assert.Equal(t, meta.ErrAuthenticate, imeta.ComparePassword(hash, ""), hash)
+		assert.Equal(t, meta.ErrAuthenticate, imeta.ComparePassword(hash, "secret"), hash)
+	}
+}
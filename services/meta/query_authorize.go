@@ -0,0 +1,229 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+)
+
+// QueryDenial tells why a statement is not authorized for a user: the
+// admin privilege, or Privilege on Database or on Measurement of it, is
+// required.
+type QueryDenial struct {
+	User        string
+	Statement   string
+	Database    string
+	Measurement string // empty if denied on the database
+	Privilege   influxql.Privilege
+	Admin       bool
+	Message     string
+}
+
+func (d *QueryDenial) Error() string {
+	if d.User == "" {
+		return d.Message
+	}
+	return fmt.Sprintf("%s not authorized to execute %s", d.User, d.Message)
+}
+
+// AuthorizeQuery resolves databases and measurements referenced by stmt,
+// database being the default one, against privileges of u in one read of
+// meta data, so that statements denied fail before being fanned out. A
+// *QueryDenial is returned if one of them is not allowed.
+func (c *Client) AuthorizeQuery(u meta.User, stmt influxql.Statement, database string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cacheData.authorizeStatement(u, stmt, database)
+}
+
+// queryUser returns the user of u in data, rather than u which may be
+// stale, or a *QueryDenial if there is none.
+func (data *Data) queryUser(u meta.User, stmt influxql.Statement, database string) (*meta.UserInfo, error) {
+	if u == nil {
+		return nil, &QueryDenial{Statement: stmt.String(), Database: database, Message: "no user provided"}
+	}
+	ui := data.user(u.ID())
+	if ui == nil {
+		return nil, &QueryDenial{
+			User:      u.ID(),
+			Statement: stmt.String(),
+			Database:  database,
+			Message:   fmt.Sprintf("statement '%s', user not found", stmt),
+		}
+	}
+	return ui, nil
+}
+
+func (data *Data) authorizeStatement(u meta.User, stmt influxql.Statement, database string) error {
+	ui, err := data.queryUser(u, stmt, database)
+	if err != nil {
+		return err
+	} else if ui.Admin {
+		return nil
+	}
+
+	privs, err := stmt.RequiredPrivileges()
+	if err != nil {
+		return err
+	}
+	for _, p := range privs {
+		if p.Admin {
+			return &QueryDenial{
+				User:      ui.Name,
+				Statement: stmt.String(),
+				Database:  database,
+				Admin:     true,
+				Message:   fmt.Sprintf("statement '%s', requires admin privilege", stmt),
+			}
+		}
+		db := p.Name
+		if db == "" {
+			db = database
+		}
+		if !ui.AuthorizeDatabase(p.Privilege, db) {
+			return &QueryDenial{
+				User:      ui.Name,
+				Statement: stmt.String(),
+				Database:  db,
+				Privilege: p.Privilege,
+				Message:   fmt.Sprintf("statement '%s', requires %s on %s", stmt, p.Privilege, db),
+			}
+		}
+	}
+
+	if d := (&Authorizer{MetaClient: data}).authorizeStatement(ui, stmt, database); d != nil {
+		d.Statement = stmt.String()
+		return d
+	}
+	return nil
+}
+
+// QueryDenials are the denials of all sources of a statement not authorized,
+// in the order of the sources.
+type QueryDenials []*QueryDenial
+
+func (d QueryDenials) Error() string {
+	msgs := make([]string, len(d))
+	for i := range d {
+		msgs[i] = d[i].Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// AuthorizeSources checks privileges of u on the database of each
+// measurement stmt reads or writes, database being the default one, and on
+// measurements scoped, so that statements across databases are denied by
+// every source rather than by the default database only. QueryDenials of
+// all sources denied are returned, or of u alone if not found.
+func (c *Client) AuthorizeSources(u meta.User, stmt influxql.Statement, database string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cacheData.authorizeSources(u, stmt, database)
+}
+
+func (data *Data) authorizeSources(u meta.User, stmt influxql.Statement, database string) error {
+	ui, err := data.queryUser(u, stmt, database)
+	if err != nil {
+		return QueryDenials{err.(*QueryDenial)}
+	} else if ui.Admin {
+		return nil
+	}
+	if s, ok := stmt.(influxql.HasDefaultDatabase); ok && s.DefaultDatabase() != "" {
+		database = s.DefaultDatabase()
+	}
+
+	a := &sourceAuthorizer{data: data, user: ui}
+	switch stmt := stmt.(type) {
+	case *influxql.SelectStatement:
+		a.selectStatement(database, stmt)
+	case *influxql.ShowSeriesStatement:
+		a.sources(database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.ShowSeriesCardinalityStatement:
+		a.sources(database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.ShowTagKeysStatement:
+		a.sources(database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.ShowTagValuesStatement:
+		a.sources(database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.ShowFieldKeysStatement:
+		a.sources(database, stmt.Sources, influxql.ReadPrivilege)
+	case *influxql.DeleteSeriesStatement:
+		a.sources(database, stmt.Sources, influxql.WritePrivilege)
+	case *influxql.DropSeriesStatement:
+		a.sources(database, stmt.Sources, influxql.WritePrivilege)
+	}
+	if len(a.denials) == 0 {
+		return nil
+	}
+	for _, d := range a.denials {
+		d.Statement = stmt.String()
+	}
+	return a.denials
+}
+
+// sourceAuthorizer collects denials of sources of a statement.
+type sourceAuthorizer struct {
+	data    *Data
+	user    *meta.UserInfo
+	denials QueryDenials
+}
+
+// database tells whether the user has p on db, denying source otherwise.
+// Statements without a database fail when executed instead.
+func (a *sourceAuthorizer) database(db, source string, p influxql.Privilege) bool {
+	if db == "" || a.user.AuthorizeDatabase(p, db) {
+		return true
+	}
+	msg := fmt.Sprintf("%s on %s", p, db)
+	if source != "" {
+		msg += " for " + source
+	}
+	a.denials = append(a.denials, &QueryDenial{
+		User:        a.user.Name,
+		Database:    db,
+		Measurement: source,
+		Privilege:   p,
+		Message:     msg,
+	})
+	return false
+}
+
+func (a *sourceAuthorizer) measurement(database string, m *influxql.Measurement, p influxql.Privilege) {
+	db := database
+	if m.Database != "" {
+		db = m.Database
+	}
+	if !a.database(db, m.String(), p) {
+		return
+	}
+	if d := (&Authorizer{MetaClient: a.data}).authorizeMeasurement(a.user, database, m, p); d != nil {
+		a.denials = append(a.denials, d)
+	}
+}
+
+func (a *sourceAuthorizer) sources(database string, sources influxql.Sources, p influxql.Privilege) {
+	if len(sources) == 0 {
+		if a.database(database, "", p) {
+			if d := (&Authorizer{MetaClient: a.data}).authorizeSources(a.user, database, nil, p); d != nil {
+				a.denials = append(a.denials, d)
+			}
+		}
+		return
+	}
+	for _, src := range sources {
+		switch src := src.(type) {
+		case *influxql.Measurement:
+			a.measurement(database, src, p)
+		case *influxql.SubQuery:
+			a.selectStatement(database, src.Statement)
+		}
+	}
+}
+
+func (a *sourceAuthorizer) selectStatement(database string, stmt *influxql.SelectStatement) {
+	a.sources(database, stmt.Sources, influxql.ReadPrivilege)
+	if stmt.Target != nil && stmt.Target.Measurement != nil {
+		a.measurement(database, stmt.Target.Measurement, influxql.WritePrivilege)
+	}
+}
@@ -0,0 +1,87 @@
+package meta
+
+import "sort"
+
+// ShardReadOnly returns whether writes to shard id are rejected, e.g. after
+// archival or during a forensic investigation. Reads go on as usual.
+func (data *Data) ShardReadOnly(id uint64) bool {
+	i := sort.Search(len(data.ReadOnlyShards), func(i int) bool { return data.ReadOnlyShards[i] >= id })
+	return i < len(data.ReadOnlyShards) && data.ReadOnlyShards[i] == id
+}
+
+// SetShardReadOnly marks shard id read-only or writable again. Marking it the
+// way it's already marked is not an error.
+func (data *Data) SetShardReadOnly(id uint64, readOnly bool) error {
+	if !data.shardExists(id) {
+		return ErrShardNotFound
+	}
+
+	i := sort.Search(len(data.ReadOnlyShards), func(i int) bool { return data.ReadOnlyShards[i] >= id })
+	found := i < len(data.ReadOnlyShards) && data.ReadOnlyShards[i] == id
+	if readOnly && !found {
+		data.ReadOnlyShards = append(data.ReadOnlyShards, 0)
+		copy(data.ReadOnlyShards[i+1:], data.ReadOnlyShards[i:])
+		data.ReadOnlyShards[i] = id
+	} else if !readOnly && found {
+		data.ReadOnlyShards = append(data.ReadOnlyShards[:i], data.ReadOnlyShards[i+1:]...)
+	}
+	return nil
+}
+
+// DropShard removes a shard along with its read-only mark, cutover, stale
+// marks and seal.
+func (data *Data) DropShard(id uint64) {
+	data.Data.DropShard(id)
+	data.pruneDroppedShards()
+}
+
+// pruneDroppedShards removes read-only marks, cutovers, stale marks and seals
+// of shards not in meta anymore.
+func (data *Data) pruneDroppedShards() {
+	if len(data.ReadOnlyShards) > 0 {
+		n := 0
+		for _, id := range data.ReadOnlyShards {
+			if data.shardExists(id) {
+				data.ReadOnlyShards[n] = id
+				n++
+			}
+		}
+		data.ReadOnlyShards = data.ReadOnlyShards[:n]
+	}
+	if len(data.ShardCutovers) > 0 {
+		n := 0
+		for _, c := range data.ShardCutovers {
+			if data.shardExists(c.ShardID) {
+				data.ShardCutovers[n] = c
+				n++
+			}
+		}
+		data.ShardCutovers = data.ShardCutovers[:n]
+	}
+	data.pruneStaleShards(func(s StaleShard) bool { return data.shardExists(s.ShardID) })
+	if len(data.SealedShards) > 0 {
+		n := 0
+		for _, s := range data.SealedShards {
+			if data.shardExists(s.ShardID) {
+				data.SealedShards[n] = s
+				n++
+			}
+		}
+		data.SealedShards = data.SealedShards[:n]
+	}
+}
+
+func (data *Data) shardExists(id uint64) bool {
+	for _, dbi := range data.Databases {
+		for _, rpi := range dbi.RetentionPolicies {
+			for _, sg := range rpi.ShardGroups {
+				for _, s := range sg.Shards {
+					if s.ID == id {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
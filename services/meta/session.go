@@ -0,0 +1,150 @@
+package meta
+
+import (
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// DefaultSessionTTL is how long sessions last if ConfigSessionTTL is not set.
+const DefaultSessionTTL = time.Hour
+
+// DefaultMaxUserSessions is how many sessions a user keeps if
+// ConfigMaxUserSessions is not set.
+const DefaultMaxUserSessions = 16
+
+// Session authenticates requests of User signed in until Expiration, so that
+// the password is compared to its bcrypt hash once per session instead of on
+// every request. Session tokens are generated and hashed like api tokens.
+type Session struct {
+	User       string
+	Hash       string
+	Expiration time.Time
+}
+
+// maxUserSessions returns the sessions a user keeps, 0 for unlimited.
+func (data *Data) maxUserSessions() int64 {
+	if max, ok := data.ClusterConfig.Int(ConfigMaxUserSessions); ok {
+		return max
+	}
+	return DefaultMaxUserSessions
+}
+
+// CreateSession saves a session of user by the hash of its token, pruning
+// sessions expired at now. Once the user has max-user-sessions, the ones
+// expiring first end.
+func (data *Data) CreateSession(username, hash string, now, expiration time.Time) error {
+	if data.user(username) == nil {
+		return meta.ErrUserNotFound
+	} else if hash == "" {
+		return ErrSessionRequired
+	}
+
+	data.PruneSessions(now)
+	if max := data.maxUserSessions(); max > 0 {
+		var sessions []Session
+		for _, s := range data.Sessions {
+			if s.User == username {
+				sessions = append(sessions, s)
+			}
+		}
+		sort.Slice(sessions, func(i, j int) bool {
+			if !sessions[i].Expiration.Equal(sessions[j].Expiration) {
+				return sessions[i].Expiration.Before(sessions[j].Expiration)
+			}
+			return sessions[i].Hash < sessions[j].Hash
+		})
+		for i := 0; int64(len(sessions)-i) >= max; i++ {
+			delete(data.Sessions, sessions[i].Hash)
+		}
+	}
+	if data.Sessions == nil {
+		data.Sessions = make(map[string]Session)
+	}
+	data.Sessions[hash] = Session{
+		User:       username,
+		Hash:       hash,
+		Expiration: expiration,
+	}
+	return nil
+}
+
+// DropSession removes a session by the hash of its token, e.g. on sign out.
+func (data *Data) DropSession(hash string) error {
+	if _, ok := data.Sessions[hash]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(data.Sessions, hash)
+	return nil
+}
+
+// SessionUser returns the user of session token at now, nil if the session is
+// unknown or expired.
+func (data *Data) SessionUser(token string, now time.Time) *meta.UserInfo {
+	s, ok := data.Sessions[HashAPIToken(token)]
+	if !ok || !now.Before(s.Expiration) {
+		return nil
+	}
+	return data.user(s.User)
+}
+
+// SessionsExpired returns whether any session is expired at now.
+func (data *Data) SessionsExpired(now time.Time) bool {
+	for _, s := range data.Sessions {
+		if !now.Before(s.Expiration) {
+			return true
+		}
+	}
+	return false
+}
+
+// PruneSessions removes sessions expired at now.
+func (data *Data) PruneSessions(now time.Time) {
+	data.dropSessions(func(s *Session) bool { return !now.Before(s.Expiration) })
+}
+
+// UpdateUser updates the password of a user, ending its sessions.
+func (data *Data) UpdateUser(name, hash string) error {
+	if err := data.Data.UpdateUser(name, hash); err != nil {
+		return err
+	}
+	data.dropUserSessions(name)
+	return nil
+}
+
+func (data *Data) dropUserSessions(username string) {
+	data.dropSessions(func(s *Session) bool { return s.User == username })
+}
+
+func (data *Data) dropSessions(fn func(s *Session) bool) {
+	for hash, s := range data.Sessions {
+		if fn(&s) {
+			delete(data.Sessions, hash)
+		}
+	}
+}
+
+// sessionList returns sessions sorted by hash, as they are persisted.
+func sessionList(sessions map[string]Session) []Session {
+	if len(sessions) == 0 {
+		return nil
+	}
+	list := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Hash < list[j].Hash })
+	return list
+}
+
+func sessionMap(list []Session) map[string]Session {
+	if len(list) == 0 {
+		return nil
+	}
+	sessions := make(map[string]Session, len(list))
+	for _, s := range list {
+		sessions[s.Hash] = s
+	}
+	return sessions
+}
@@ -0,0 +1,61 @@
+package meta
+
+import "time"
+
+// ShardCutover is the write barrier of a shard in the final step of its move
+// to NodeID. Until Expiration, owners reject writes to the shard and writers
+// buffer them by hinted handoff for the owners and NodeID, so the tail of
+// writes is copied or handed off to the new owner exactly once.
+type ShardCutover struct {
+	ShardID    uint64
+	NodeID     uint64
+	Expiration time.Time
+}
+
+// Active returns whether the barrier holds at now.
+func (c *ShardCutover) Active(now time.Time) bool {
+	return now.Before(c.Expiration)
+}
+
+// ShardCutover returns the cutover of shard id holding at now, nil if none.
+func (data *Data) ShardCutover(id uint64, now time.Time) *ShardCutover {
+	for i := range data.ShardCutovers {
+		if c := &data.ShardCutovers[i]; c.ShardID == id && c.Active(now) {
+			return c
+		}
+	}
+	return nil
+}
+
+// BeginShardCutover starts the cutover of shard id to node nodeID until
+// expiration, replacing the one of the shard begun before.
+func (data *Data) BeginShardCutover(id, nodeID uint64, expiration time.Time) error {
+	if !data.shardExists(id) {
+		return ErrShardNotFound
+	}
+	if data.DataNode(nodeID) == nil {
+		return ErrNodeNotFound
+	}
+
+	c := ShardCutover{ShardID: id, NodeID: nodeID, Expiration: expiration}
+	for i := range data.ShardCutovers {
+		if data.ShardCutovers[i].ShardID == id {
+			data.ShardCutovers[i] = c
+			return nil
+		}
+	}
+	data.ShardCutovers = append(data.ShardCutovers, c)
+	return nil
+}
+
+// EndShardCutover ends the cutover of shard id. Ending a shard not in cutover
+// is not an error, as the cutover may have been ended by its expiration.
+func (data *Data) EndShardCutover(id uint64) error {
+	for i := range data.ShardCutovers {
+		if data.ShardCutovers[i].ShardID == id {
+			data.ShardCutovers = append(data.ShardCutovers[:i], data.ShardCutovers[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
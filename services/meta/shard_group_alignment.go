@@ -0,0 +1,139 @@
+package meta
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// Units shard groups are aligned to.
+const (
+	// AlignEpoch truncates timestamps by the shard group duration.
+	AlignEpoch = ""
+	// AlignDay starts shard groups at midnight UTC.
+	AlignDay = "day"
+	// AlignWeek starts shard groups at midnight UTC of Monday.
+	AlignWeek = "week"
+)
+
+// firstMonday is the origin of shard groups aligned to weeks.
+var firstMonday = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+func validShardGroupAlignment(unit string) bool {
+	return unit == AlignEpoch || unit == AlignDay || unit == AlignWeek
+}
+
+// ShardGroupAlignment aligns boundaries of shard groups of a retention policy
+// created afterwards to Unit, so that a day or a week of data is held by whole
+// groups to be exported or deleted.
+type ShardGroupAlignment struct {
+	Database        string
+	RetentionPolicy string
+	Unit            string
+}
+
+// ShardGroupAlignment returns the unit shard groups of retention policy rp of
+// database are aligned to, AlignEpoch if not aligned.
+func (data *Data) ShardGroupAlignment(database, rp string) string {
+	for _, a := range data.ShardGroupAlignments {
+		if a.Database == database && a.RetentionPolicy == rp {
+			return a.Unit
+		}
+	}
+	return AlignEpoch
+}
+
+// SetShardGroupAlignment aligns shard groups of retention policy rp of
+// database created afterwards to unit, AlignEpoch removes the alignment.
+// Existing groups are untouched.
+func (data *Data) SetShardGroupAlignment(database, rp, unit string) error {
+	if !validShardGroupAlignment(unit) {
+		return ErrInvalidShardGroupAlignment
+	}
+	if database == "" {
+		return meta.ErrDatabaseNameRequired
+	}
+	di := data.Database(database)
+	if di == nil {
+		return influxdb.ErrDatabaseNotFound(database)
+	} else if di.RetentionPolicy(rp) == nil {
+		return influxdb.ErrRetentionPolicyNotFound(rp)
+	}
+
+	data.dropShardGroupAlignments(func(a *ShardGroupAlignment) bool {
+		return a.Database == database && a.RetentionPolicy == rp
+	})
+	if unit != AlignEpoch {
+		data.ShardGroupAlignments = append(data.ShardGroupAlignments, ShardGroupAlignment{
+			Database:        database,
+			RetentionPolicy: rp,
+			Unit:            unit,
+		})
+	}
+	return nil
+}
+
+// dropShardGroupAlignments removes alignments matching fn.
+func (data *Data) dropShardGroupAlignments(fn func(a *ShardGroupAlignment) bool) {
+	n := 0
+	for _, a := range data.ShardGroupAlignments {
+		if !fn(&a) {
+			data.ShardGroupAlignments[n] = a
+			n++
+		}
+	}
+	data.ShardGroupAlignments = data.ShardGroupAlignments[:n]
+}
+
+// alignedShardGroup returns the time range of the shard group of rpi aligned
+// to unit covering timestamp. Groups shorter than unit start over at each
+// unit, the last one of a unit ending with it, and longer groups last whole
+// units. The range is cut not to overlap groups created before, e.g. before
+// the alignment was set.
+func alignedShardGroup(rpi *meta.RetentionPolicyInfo, unit string, timestamp time.Time) (start, end time.Time) {
+	size, origin := 24*time.Hour, time.Unix(0, 0).UTC()
+	if unit == AlignWeek {
+		size, origin = 7*24*time.Hour, firstMonday
+	}
+
+	if d := rpi.ShardGroupDuration; d < size {
+		unitStart := floorTime(timestamp, origin, size)
+		start = floorTime(timestamp, unitStart, d)
+		end = start.Add(d)
+		if unitEnd := unitStart.Add(size); end.After(unitEnd) {
+			end = unitEnd
+		}
+	} else {
+		n := (d + size - 1) / size
+		start = floorTime(timestamp, origin, n*size)
+		end = start.Add(n * size)
+	}
+
+	for _, g := range rpi.ShardGroups {
+		if g.Deleted() {
+			continue
+		}
+		gEnd := g.EndTime
+		if g.Truncated() {
+			gEnd = g.TruncatedAt
+		}
+		// no group covers timestamp, groups starting before end before it
+		if !g.StartTime.After(timestamp) && gEnd.After(start) {
+			start = gEnd
+		} else if g.StartTime.After(timestamp) && g.StartTime.Before(end) {
+			end = g.StartTime
+		}
+	}
+	return start, end
+}
+
+// floorTime returns the latest time not after t being origin plus a multiple
+// of size.
+func floorTime(t, origin time.Time, size time.Duration) time.Time {
+	n := t.Sub(origin) / size
+	if floor := origin.Add(n * size); !floor.After(t) {
+		return floor
+	}
+	return origin.Add((n - 1) * size)
+}
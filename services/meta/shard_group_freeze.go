@@ -0,0 +1,31 @@
+package meta
+
+import "time"
+
+// ShardGroupFreeze holds creation of shard groups until Until while snapshot
+// ID captures meta data along with the shards of nodes, so no shard is
+// created in between. It's checked before proposing creations, replicas
+// apply the ones proposed before.
+type ShardGroupFreeze struct {
+	ID    string
+	Until time.Time
+}
+
+// ShardGroupsFrozen returns whether creation of shard groups is held at now.
+func (data *Data) ShardGroupsFrozen(now time.Time) bool {
+	return data.ShardGroupFreeze != nil && now.Before(data.ShardGroupFreeze.Until)
+}
+
+// FreezeShardGroups holds creation of shard groups for snapshot id until
+// until, replacing the freeze of another snapshot.
+func (data *Data) FreezeShardGroups(id string, until time.Time) {
+	data.ShardGroupFreeze = &ShardGroupFreeze{ID: id, Until: until}
+}
+
+// ThawShardGroups releases the freeze of snapshot id. Releasing a freeze
+// expired or replaced is not an error.
+func (data *Data) ThawShardGroups(id string) {
+	if data.ShardGroupFreeze != nil && data.ShardGroupFreeze.ID == id {
+		data.ShardGroupFreeze = nil
+	}
+}
@@ -0,0 +1,121 @@
+package meta
+
+import (
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// shardGroupIndex finds shard groups of retention policies by time with
+// binary searches instead of scanning all groups. It's built from the Data
+// committed, which is never modified afterwards, keyed by database and
+// retention policy.
+type shardGroupIndex map[string]map[string]*shardGroupTimes
+
+// shardGroupTimes are the shard groups not deleted of a retention policy
+// sorted by start time.
+type shardGroupTimes struct {
+	groups []*meta.ShardGroupInfo
+	// pos is the position of groups in RetentionPolicyInfo.ShardGroups
+	pos []int
+	// maxEnd[i] is the latest end time of groups[:i+1], so that groups ending
+	// before a time are skipped by binary search even if groups overlap
+	maxEnd []time.Time
+}
+
+func newShardGroupIndex(data *Data) shardGroupIndex {
+	idx := make(shardGroupIndex, len(data.Databases))
+	for i := range data.Databases {
+		di := &data.Databases[i]
+		rps := make(map[string]*shardGroupTimes, len(di.RetentionPolicies))
+		for j := range di.RetentionPolicies {
+			rpi := &di.RetentionPolicies[j]
+			t := &shardGroupTimes{}
+			for k := range rpi.ShardGroups {
+				if rpi.ShardGroups[k].Deleted() {
+					continue
+				}
+				t.groups = append(t.groups, &rpi.ShardGroups[k])
+				t.pos = append(t.pos, k)
+			}
+			sort.Sort(t)
+			t.maxEnd = make([]time.Time, len(t.groups))
+			for k, g := range t.groups {
+				t.maxEnd[k] = g.EndTime
+				if k > 0 && t.maxEnd[k-1].After(g.EndTime) {
+					t.maxEnd[k] = t.maxEnd[k-1]
+				}
+			}
+			rps[rpi.Name] = t
+		}
+		idx[di.Name] = rps
+	}
+	return idx
+}
+
+func (t *shardGroupTimes) Len() int { return len(t.groups) }
+
+func (t *shardGroupTimes) Less(i, j int) bool {
+	if !t.groups[i].StartTime.Equal(t.groups[j].StartTime) {
+		return t.groups[i].StartTime.Before(t.groups[j].StartTime)
+	}
+	return t.pos[i] < t.pos[j]
+}
+
+func (t *shardGroupTimes) Swap(i, j int) {
+	t.groups[i], t.groups[j] = t.groups[j], t.groups[i]
+	t.pos[i], t.pos[j] = t.pos[j], t.pos[i]
+}
+
+// candidates returns the range of groups which may end after min and start
+// before or at max.
+func (t *shardGroupTimes) candidates(min, max time.Time) (int, int) {
+	from := sort.Search(len(t.groups), func(i int) bool { return t.maxEnd[i].After(min) })
+	to := sort.Search(len(t.groups), func(i int) bool { return t.groups[i].StartTime.After(max) })
+	return from, to
+}
+
+func (idx shardGroupIndex) times(database, policy string) *shardGroupTimes {
+	return idx[database][policy]
+}
+
+// byTimeRange returns shard groups overlapping min and max sorted by start
+// time.
+func (idx shardGroupIndex) byTimeRange(database, policy string, min, max time.Time) []meta.ShardGroupInfo {
+	t := idx.times(database, policy)
+	if t == nil {
+		return []meta.ShardGroupInfo{}
+	}
+	from, to := t.candidates(min, max)
+	groups := make([]meta.ShardGroupInfo, 0, to-from)
+	for i := from; i < to; i++ {
+		if t.groups[i].Overlaps(min, max) {
+			groups = append(groups, *t.groups[i])
+		}
+	}
+	return groups
+}
+
+// byTimestamp returns the shard group accepting writes at timestamp, the same
+// as RetentionPolicyInfo.ShardGroupByTimestamp.
+func (idx shardGroupIndex) byTimestamp(database, policy string, timestamp time.Time) *meta.ShardGroupInfo {
+	t := idx.times(database, policy)
+	if t == nil {
+		return nil
+	}
+	var found *meta.ShardGroupInfo
+	pos := -1
+	from, to := t.candidates(timestamp, timestamp)
+	for i := from; i < to; i++ {
+		sgi := t.groups[i]
+		if !sgi.Contains(timestamp) || (sgi.Truncated() && !timestamp.Before(sgi.TruncatedAt)) {
+			continue
+		}
+		// the first one of the retention policy wins
+		if pos < 0 || t.pos[i] < pos {
+			found, pos = sgi, t.pos[i]
+		}
+	}
+	return found
+}
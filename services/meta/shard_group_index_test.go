@@ -0,0 +1,54 @@
+package meta
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+// The index must find the same shard groups as scanning them, also with
+// overlapping, deleted and truncated groups.
+func TestShardGroupIndex(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	base := time.Unix(0, 0).UTC()
+	hour := func(n int) time.Time { return base.Add(time.Duration(n) * time.Hour) }
+
+	rpi := meta.RetentionPolicyInfo{Name: "rp0"}
+	for i := 0; i < 200; i++ {
+		start := rnd.Intn(1000)
+		sgi := meta.ShardGroupInfo{ID: uint64(i + 1), StartTime: hour(start), EndTime: hour(start + 1 + rnd.Intn(48))}
+		switch rnd.Intn(10) {
+		case 0:
+			sgi.DeletedAt = hour(2000)
+		case 1:
+			sgi.TruncatedAt = hour(start + rnd.Intn(24))
+		}
+		rpi.ShardGroups = append(rpi.ShardGroups, sgi)
+	}
+	data := &Data{}
+	data.Databases = []meta.DatabaseInfo{{Name: "db0", RetentionPolicies: []meta.RetentionPolicyInfo{rpi}}}
+	idx := newShardGroupIndex(data)
+
+	for i := 0; i < 500; i++ {
+		ts := hour(rnd.Intn(1100) - 50).Add(time.Duration(rnd.Intn(60)) * time.Minute)
+		assert.Equal(t, rpi.ShardGroupByTimestamp(ts), idx.byTimestamp("db0", "rp0", ts), "timestamp %v", ts)
+
+		min := hour(rnd.Intn(1100) - 50)
+		max := min.Add(time.Duration(rnd.Intn(100)) * time.Hour)
+		exp := []meta.ShardGroupInfo{}
+		for _, g := range rpi.ShardGroups {
+			if !g.Deleted() && g.Overlaps(min, max) {
+				exp = append(exp, g)
+			}
+		}
+		sort.SliceStable(exp, func(i, j int) bool { return exp[i].StartTime.Before(exp[j].StartTime) })
+		assert.Equal(t, exp, idx.byTimeRange("db0", "rp0", min, max), "range %v - %v", min, max)
+	}
+
+	assert.Nil(t, idx.byTimestamp("db0", "rp1", base))
+	assert.Equal(t, []meta.ShardGroupInfo{}, idx.byTimeRange("db1", "rp0", base, base))
+}
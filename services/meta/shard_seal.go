@@ -0,0 +1,109 @@
+package meta
+
+import (
+	"sort"
+	"time"
+)
+
+// SealedShard is a shard of a shard group sealed once the end of the group
+// and a grace period passed. Writes of clients to it are rejected, while
+// hinted writes accepted before are still applied by its owners. Its copies
+// are compared by digests once.
+type SealedShard struct {
+	ShardID      uint64
+	ShardGroupID uint64
+	SealedAt     time.Time
+	// VerifiedAt is when digests of the owners were compared, zero until
+	// all owners answered
+	VerifiedAt time.Time `json:",omitempty"`
+	// Checksum of the digest of the shard, of the first owner if Diverged
+	Checksum uint32 `json:",omitempty"`
+	Diverged bool   `json:",omitempty"`
+}
+
+// Verified tells whether copies of the shard were compared.
+func (s *SealedShard) Verified() bool {
+	return !s.VerifiedAt.IsZero()
+}
+
+func (data *Data) sealedShardIndex(id uint64) (int, bool) {
+	i := sort.Search(len(data.SealedShards), func(i int) bool { return data.SealedShards[i].ShardID >= id })
+	return i, i < len(data.SealedShards) && data.SealedShards[i].ShardID == id
+}
+
+// ShardSealed returns whether shard id is sealed.
+func (data *Data) ShardSealed(id uint64) bool {
+	_, ok := data.sealedShardIndex(id)
+	return ok
+}
+
+// SealedShard returns the seal of shard id, nil if not sealed.
+func (data *Data) SealedShard(id uint64) *SealedShard {
+	i, ok := data.sealedShardIndex(id)
+	if !ok {
+		return nil
+	}
+	s := data.SealedShards[i]
+	return &s
+}
+
+// UnsealedShardGroups returns the ids of shard groups not deleted with shards
+// not sealed yet, whose end plus grace is not after now.
+func (data *Data) UnsealedShardGroups(grace time.Duration, now time.Time) []ShardGroupID {
+	var ids []ShardGroupID
+	for _, dbi := range data.Databases {
+		for _, rpi := range dbi.RetentionPolicies {
+			for _, sg := range rpi.ShardGroups {
+				if sg.Deleted() || sg.EndTime.Add(grace).After(now) {
+					continue
+				}
+				for _, sh := range sg.Shards {
+					if !data.ShardSealed(sh.ID) {
+						ids = append(ids, ShardGroupID(sg.ID))
+						break
+					}
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// SealShardGroups seals shards of groups whose end plus grace is not after
+// now. It returns the number of shards sealed, sealing a shard sealed
+// already keeps the time it was sealed first.
+func (data *Data) SealShardGroups(grace time.Duration, now time.Time) int {
+	sealed := 0
+	for _, dbi := range data.Databases {
+		for _, rpi := range dbi.RetentionPolicies {
+			for _, sg := range rpi.ShardGroups {
+				if sg.Deleted() || sg.EndTime.Add(grace).After(now) {
+					continue
+				}
+				for _, sh := range sg.Shards {
+					i, ok := data.sealedShardIndex(sh.ID)
+					if ok {
+						continue
+					}
+					data.SealedShards = append(data.SealedShards, SealedShard{})
+					copy(data.SealedShards[i+1:], data.SealedShards[i:])
+					data.SealedShards[i] = SealedShard{ShardID: sh.ID, ShardGroupID: sg.ID, SealedAt: now}
+					sealed++
+				}
+			}
+		}
+	}
+	return sealed
+}
+
+// SetSealedShardChecksum records the checksum of shard id whose copies were
+// compared at now, diverged if they differ.
+func (data *Data) SetSealedShardChecksum(id uint64, checksum uint32, diverged bool, now time.Time) error {
+	i, ok := data.sealedShardIndex(id)
+	if !ok {
+		return ErrShardNotSealed
+	}
+	s := &data.SealedShards[i]
+	s.Checksum, s.Diverged, s.VerifiedAt = checksum, diverged, now
+	return nil
+}
@@ -0,0 +1,92 @@
+package meta
+
+import "time"
+
+// StaleShard marks the copy of a shard on node NodeID as missing writes, e.g.
+// after its hinted handoff was purged beyond max-age while the node was down.
+// Reads prefer other owners until the copy is repaired from them.
+type StaleShard struct {
+	ShardID  uint64
+	NodeID   uint64
+	MarkedAt time.Time
+}
+
+// ShardStale returns whether the copy of shard id on node nodeID is stale.
+func (data *Data) ShardStale(id, nodeID uint64) bool {
+	for _, s := range data.StaleShards {
+		if s.ShardID == id && s.NodeID == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// NodeStaleShards returns the stale copies of shards on node nodeID.
+func (data *Data) NodeStaleShards(nodeID uint64) []StaleShard {
+	var shards []StaleShard
+	for _, s := range data.StaleShards {
+		if s.NodeID == nodeID {
+			shards = append(shards, s)
+		}
+	}
+	return shards
+}
+
+// MarkShardsStale marks copies of shards ids on node nodeID stale at now.
+// Shards dropped or not owned by the node are skipped, marking a copy already
+// stale keeps the time it was marked first.
+func (data *Data) MarkShardsStale(nodeID uint64, ids []uint64, now time.Time) error {
+	if data.DataNode(nodeID) == nil {
+		return ErrNodeNotFound
+	}
+
+	for _, id := range ids {
+		if data.ShardStale(id, nodeID) || !data.shardOwnedBy(id, nodeID) {
+			continue
+		}
+		data.StaleShards = append(data.StaleShards, StaleShard{ShardID: id, NodeID: nodeID, MarkedAt: now})
+	}
+	return nil
+}
+
+// ClearStaleShard marks the copy of shard id on node nodeID repaired.
+// Clearing a copy not stale is not an error.
+func (data *Data) ClearStaleShard(id, nodeID uint64) error {
+	for i, s := range data.StaleShards {
+		if s.ShardID == id && s.NodeID == nodeID {
+			data.StaleShards = append(data.StaleShards[:i], data.StaleShards[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (data *Data) shardOwnedBy(id, nodeID uint64) bool {
+	for _, dbi := range data.Databases {
+		for _, rpi := range dbi.RetentionPolicies {
+			for _, sg := range rpi.ShardGroups {
+				for _, s := range sg.Shards {
+					if s.ID == id {
+						return s.OwnedBy(nodeID)
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// pruneStaleShards keeps the stale marks keep returns true for.
+func (data *Data) pruneStaleShards(keep func(StaleShard) bool) {
+	if len(data.StaleShards) == 0 {
+		return
+	}
+	n := 0
+	for _, s := range data.StaleShards {
+		if keep(s) {
+			data.StaleShards[n] = s
+			n++
+		}
+	}
+	data.StaleShards = data.StaleShards[:n]
+}
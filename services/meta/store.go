@@ -18,7 +18,6 @@ import (
 	"github.com/influxdata/influxdb/services/meta"
 	"github.com/influxdata/influxql"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -30,6 +29,10 @@ const (
 	// SHARDGROUP_INFO_EVICTION is the amount of time before a shard group info will be removed from cached
 	// data after it has been marked deleted (2 weeks).
 	SHARDGROUP_INFO_EVICTION = -2 * 7 * 24 * time.Hour
+
+	// MAX_SHARD_GROUPS_FOR_RANGE is the maximum number of shard groups created
+	// for a range in one commit.
+	MAX_SHARD_GROUPS_FOR_RANGE = 1000
 )
 
 // Client is used to execute commands on and read data from
@@ -41,21 +44,23 @@ type Client struct {
 	closing   chan struct{}
 	changed   chan struct{}
 	cacheData *Data
+	// configChanged is closed when ClusterConfig of cacheData changes
+	configChanged chan struct{}
+	// shardGroups indexes shard groups of cacheData by time
+	shardGroups shardGroupIndex
+	// history keeps past versions of cacheData
+	history *dataHistory
 
 	// Authentication cache.
-	authCache map[string]authUser
+	authCache *authCache
 
 	path string
+	// archiveDir keeps shard groups pruned if set
+	archiveDir string
 
 	retentionAutoCreate bool
 }
 
-type authUser struct {
-	bhash string
-	salt  []byte
-	hash  []byte
-}
-
 // NewClient returns a new *Client.
 func NewClient(config *meta.Config) *Client {
 	return &Client{
@@ -65,10 +70,13 @@ func NewClient(config *meta.Config) *Client {
 				Index:     1,
 			},
 		},
+		shardGroups:         shardGroupIndex{},
+		history:             newDataHistory(DefaultDataHistorySize),
 		closing:             make(chan struct{}),
 		changed:             make(chan struct{}),
+		configChanged:       make(chan struct{}),
 		logger:              zap.NewNop(),
-		authCache:           make(map[string]authUser),
+		authCache:           newAuthCache(DefaultAuthCacheSize, DefaultAuthCacheTTL),
 		path:                config.Dir,
 		retentionAutoCreate: config.RetentionAutoCreate,
 	}
@@ -262,8 +270,7 @@ func (c *Client) CreateDatabase(name string) (*meta.DatabaseInfo, error) {
 
 	// create default retention policy
 	if c.retentionAutoCreate {
-		rpi := meta.DefaultRetentionPolicyInfo()
-		if err := data.CreateRetentionPolicy(name, rpi, true); err != nil {
+		if err := data.CreateDefaultRetentionPolicy(name); err != nil {
 			return nil, err
 		}
 	}
@@ -520,7 +527,7 @@ func (c *Client) UpdateUser(name, hashedPassword string) error {
 		return err
 	}
 
-	defer delete(c.authCache, name)
+	defer c.authCache.delete(name)
 
 	return c.commit(data)
 }
@@ -536,7 +543,7 @@ func (c *Client) DropUser(name string) error {
 		return err
 	}
 
-	defer delete(c.authCache, name)
+	defer c.authCache.delete(name)
 
 	if err := c.commit(data); err != nil {
 		return err
@@ -625,21 +632,21 @@ func (c *Client) Authenticate(username, password string) (meta.User, error) {
 		return nil, meta.ErrUserNotFound
 	}
 
-	// Check the local auth cache first.
-	c.mu.RLock()
-	au, ok := c.authCache[username]
-	c.mu.RUnlock()
-	if ok {
+	// Check the local auth cache first, entries of passwords changed since
+	// are stale.
+	bhash := userInfo.(*meta.UserInfo).Hash
+	now := time.Now()
+	if au, ok := c.authCache.get(username, bhash, now); ok {
 		// verify the password using the cached salt and hash
 		if bytes.Equal(c.hashWithSalt(au.salt, password), au.hash) {
 			return userInfo, nil
 		}
 
-		// fall through to requiring a full bcrypt hash for invalid passwords
+		// fall through to requiring a full hash comparison for invalid passwords
 	}
 
 	// Compare password with user hash.
-	if err := bcrypt.CompareHashAndPassword([]byte(userInfo.(*meta.UserInfo).Hash), []byte(password)); err != nil {
+	if err := ComparePassword(bhash, password); err != nil {
 		return nil, meta.ErrAuthenticate
 	}
 
@@ -648,9 +655,7 @@ func (c *Client) Authenticate(username, password string) (meta.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	c.mu.Lock()
-	c.authCache[username] = authUser{salt: salt, hash: hashed, bhash: userInfo.(*meta.UserInfo).Hash}
-	c.mu.Unlock()
+	c.authCache.add(username, bhash, salt, hashed, now)
 	return userInfo, nil
 }
 
@@ -694,14 +699,7 @@ func (c *Client) ShardGroupsByTimeRange(database, policy string, min, max time.T
 	} else if rpi == nil {
 		return nil, influxdb.ErrRetentionPolicyNotFound(policy)
 	}
-	groups := make([]meta.ShardGroupInfo, 0, len(rpi.ShardGroups))
-	for _, g := range rpi.ShardGroups {
-		if g.Deleted() || !g.Overlaps(min, max) {
-			continue
-		}
-		groups = append(groups, g)
-	}
-	return groups, nil
+	return c.shardGroups.byTimeRange(database, policy, min, max), nil
 }
 
 // ShardsByTimeRange returns a slice of shards that may contain data in the time range.
@@ -727,7 +725,7 @@ func (c *Client) ShardsByTimeRange(sources influxql.Sources, tmin, tmax time.Tim
 	return a, nil
 }
 
-func (c *Client) AddShardOwner(shardID uint64, nodeID uint64) error {
+func (c *Client) AddShardOwner(shardID ShardID, nodeID NodeID) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -736,7 +734,7 @@ func (c *Client) AddShardOwner(shardID uint64, nodeID uint64) error {
 	return c.commit(data)
 }
 
-func (c *Client) RemoveShardOwner(shardID uint64, nodeID uint64) error {
+func (c *Client) RemoveShardOwner(shardID ShardID, nodeID NodeID) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -765,12 +763,45 @@ func (c *Client) TruncateShardGroups(t time.Time) error {
 	return c.commit(data)
 }
 
+// ReassignShardGroups moves writes from t on of shard groups owned by the
+// freezed node to successor groups on other nodes.
+func (c *Client) ReassignShardGroups(id uint64, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+	if err := data.ReassignShardGroups(id, t); err != nil {
+		return err
+	}
+	return c.commit(data)
+}
+
+// AffectedShardGroup is a shard group created or pruned by maintenance of
+// shard groups, along with the retention policy it belongs to.
+type AffectedShardGroup struct {
+	Database        string
+	RetentionPolicy string
+	meta.ShardGroupInfo
+}
+
 // PruneShardGroups remove deleted shard groups from the data store.
 func (c *Client) PruneShardGroups(expiration time.Time) error {
+	_, err := c.PruneShardGroupsAffected(expiration)
+	return err
+}
+
+// PruneShardGroupsAffected removes shard groups deleted before expiration
+// from the data store, returning the groups pruned.
+func (c *Client) PruneShardGroupsAffected(expiration time.Time) ([]AffectedShardGroup, error) {
 	var changed bool
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	data := c.cacheData.Clone()
+	var (
+		pruned   []ArchivedShardGroup
+		affected []AffectedShardGroup
+	)
+	now := time.Now().UTC()
 	for i, d := range data.Databases {
 		for j, rp := range d.RetentionPolicies {
 			var remainingShardGroups []meta.ShardGroupInfo
@@ -780,31 +811,42 @@ func (c *Client) PruneShardGroups(expiration time.Time) error {
 					continue
 				}
 				changed = true
+				affected = append(affected, AffectedShardGroup{
+					Database:        d.Name,
+					RetentionPolicy: rp.Name,
+					ShardGroupInfo:  sgi,
+				})
+				pruned = append(pruned, ArchivedShardGroup{
+					Database:        d.Name,
+					RetentionPolicy: rp.Name,
+					ArchivedAt:      now,
+					ShardGroupInfo:  sgi,
+				})
 			}
 			data.Databases[i].RetentionPolicies[j].ShardGroups = remainingShardGroups
 		}
 	}
 	if changed {
-		return c.commit(data)
+		c.archive(pruned)
+		data.pruneDroppedShards()
+		if err := c.commit(data); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return affected, nil
 }
 
 func (c *Client) ShardGroupByTimestamp(database, policy string, timestamp time.Time) *meta.ShardGroupInfo {
 	c.mu.RLock()
-	if sg, _ := c.cacheData.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
-		c.mu.RUnlock()
-		return sg
-	}
-	c.mu.RUnlock()
-	return nil
+	defer c.mu.RUnlock()
+	return c.shardGroups.byTimestamp(database, policy, timestamp)
 }
 
 // CreateShardGroup creates a shard group on a database and policy for a given timestamp.
 func (c *Client) CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
 	// Check under a read-lock
 	c.mu.RLock()
-	if sg, _ := c.cacheData.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
+	if sg := c.shardGroups.byTimestamp(database, policy, timestamp); sg != nil {
 		c.mu.RUnlock()
 		return sg, nil
 	}
@@ -814,10 +856,10 @@ func (c *Client) CreateShardGroup(database, policy string, timestamp time.Time)
 	defer c.mu.Unlock()
 
 	// Check again under the write lock
-	data := c.cacheData.Clone()
-	if sg, _ := data.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
+	if sg := c.shardGroups.byTimestamp(database, policy, timestamp); sg != nil {
 		return sg, nil
 	}
+	data := c.cacheData.Clone()
 
 	sgi, err := createShardGroup(data, database, policy, timestamp)
 	if err != nil {
@@ -831,6 +873,66 @@ func (c *Client) CreateShardGroup(database, policy string, timestamp time.Time)
 	return sgi, nil
 }
 
+// CreateShardGroupsForRange creates all shard groups missing to cover the
+// range from start to end (exclusive) of a database and policy in one commit,
+// returning the groups created. Backfills of history create their groups
+// beforehand this way, instead of one commit per group while writing.
+func (c *Client) CreateShardGroupsForRange(database, policy string, start, end time.Time) ([]meta.ShardGroupInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+	var created []meta.ShardGroupInfo
+	for t := start; t.Before(end); {
+		sg, err := data.ShardGroupByTimestamp(database, policy, t)
+		if err != nil {
+			return nil, err
+		}
+		if sg == nil {
+			if len(created) == MAX_SHARD_GROUPS_FOR_RANGE {
+				return nil, ErrShardGroupRangeTooLarge
+			}
+			if sg, err = createShardGroup(data, database, policy, t); err != nil {
+				return nil, err
+			}
+			created = append(created, *sg)
+		}
+		if !sg.EndTime.After(t) {
+			// the last group possible
+			break
+		}
+		t = sg.EndTime
+	}
+
+	if len(created) > 0 {
+		if err := c.commit(data); err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
+}
+
+// PreviewShardOwners returns the shards with their owners of the shard group
+// of a database and policy for timestamp. If no group covers timestamp yet,
+// they are the shards a group created now would have, placed by the current
+// nodes without creating it, and their IDs are not reserved.
+func (c *Client) PreviewShardOwners(database, policy string, timestamp time.Time) ([]meta.ShardInfo, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	data := c.cacheData.Clone()
+	sg, err := data.ShardGroupByTimestamp(database, policy, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if sg == nil {
+		if sg, err = createShardGroup(data, database, policy, timestamp); err != nil {
+			return nil, err
+		}
+	}
+	return sg.Shards, nil
+}
+
 func createShardGroup(data *Data, database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
 	// It is the responsibility of the caller to check if it exists before calling this method.
 	if sg, _ := data.ShardGroupByTimestamp(database, policy, timestamp); sg != nil {
@@ -896,14 +998,27 @@ func (c *Client) UnfreezeDataNode(id uint64) error {
 	return nil
 }
 
-// DeleteShardGroup removes a shard group from a database and retention policy by id.
-func (c *Client) DeleteShardGroup(database, policy string, id uint64, t time.Time) error {
+// DefaultRetentionPolicy returns the template of auto created retention policy, nil if not set.
+func (c *Client) DefaultRetentionPolicy() *RetentionPolicyTemplate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.cacheData.DefaultRetentionPolicy == nil {
+		return nil
+	}
+	t := *c.cacheData.DefaultRetentionPolicy
+	return &t
+}
+
+// SetDefaultRetentionPolicy sets the template of retention policy auto created
+// for new databases cluster-wide, nil restores the builtin default.
+func (c *Client) SetDefaultRetentionPolicy(t *RetentionPolicyTemplate) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	data := c.cacheData.Clone()
 
-	if err := data.DeleteShardGroup(database, policy, id, t); err != nil {
+	if err := data.SetDefaultRetentionPolicy(t); err != nil {
 		return err
 	}
 
@@ -914,96 +1029,85 @@ func (c *Client) DeleteShardGroup(database, policy string, id uint64, t time.Tim
 	return nil
 }
 
-// PrecreateShardGroups creates shard groups whose endtime is before the 'to' time passed in, but
-// is yet to expire before 'from'. This is to avoid the need for these shards to be created when data
-// for the corresponding time range arrives. Shard creation involves Raft consensus, and precreation
-// avoids taking the hit at write-time.
-func (c *Client) PrecreateShardGroups(from, to time.Time) error {
+// UserLocked returns whether the user is locked because of failed authentications.
+func (c *Client) UserLocked(name string, now time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.UserLocked(name, now)
+}
+
+// LockedUsers returns users locked at now.
+func (c *Client) LockedUsers(now time.Time) []LockedUser {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.LockedUsers(now)
+}
+
+// LockUser locks user until the time given.
+func (c *Client) LockUser(name string, until, now time.Time) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+
 	data := c.cacheData.Clone()
-	var changed bool
 
-	for _, di := range data.Databases {
-		for _, rp := range di.RetentionPolicies {
-			if len(rp.ShardGroups) == 0 {
-				// No data was ever written to this group, or all groups have been deleted.
-				continue
-			}
-			g := rp.ShardGroups[len(rp.ShardGroups)-1] // Get the last group in time.
-			if !g.Deleted() && g.EndTime.Before(to) && g.EndTime.After(from) {
-				// Group is not deleted, will end before the future time, but is still yet to expire.
-				// This last check is important, so the system doesn't create shards groups wholly
-				// in the past.
+	if err := data.LockUser(name, until, now); err != nil {
+		return err
+	}
 
-				// Create successive shard group.
-				nextShardGroupTime := g.EndTime.Add(1 * time.Nanosecond)
-				// if it already exists, continue
-				if sg, _ := data.ShardGroupByTimestamp(di.Name, rp.Name, nextShardGroupTime); sg != nil {
-					c.logger.Info("Shard group already exists",
-						logger.ShardGroup(sg.ID),
-						logger.Database(di.Name),
-						logger.RetentionPolicy(rp.Name))
-					continue
-				}
-				newGroup, err := createShardGroup(data, di.Name, rp.Name, nextShardGroupTime)
-				if err != nil {
-					c.logger.Info("Failed to precreate successive shard group",
-						zap.Uint64("group_id", g.ID), zap.Error(err))
-					continue
-				}
-				changed = true
-				c.logger.Info("New shard group successfully precreated",
-					logger.ShardGroup(newGroup.ID),
-					logger.Database(di.Name),
-					logger.RetentionPolicy(rp.Name))
-			}
-		}
+	if err := c.commit(data); err != nil {
+		return err
 	}
 
-	if changed {
-		if err := c.commit(data); err != nil {
-			return err
-		}
+	return nil
+}
+
+// UnlockUser clears the lock of user.
+func (c *Client) UnlockUser(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.UnlockUser(name); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-// ShardOwner returns the owning shard group info for a specific shard.
-func (c *Client) ShardOwner(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// CreateAPIToken saves the hash of a token of user.
+func (c *Client) CreateAPIToken(username, hash, description string, createdAt time.Time) (*APIToken, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	for _, dbi := range c.cacheData.Databases {
-		for _, rpi := range dbi.RetentionPolicies {
-			for _, g := range rpi.ShardGroups {
-				if g.Deleted() {
-					continue
-				}
+	data := c.cacheData.Clone()
 
-				for _, sh := range g.Shards {
-					if sh.ID == shardID {
-						database = dbi.Name
-						policy = rpi.Name
-						sgi = &g
-						return
-					}
-				}
-			}
-		}
+	t, err := data.CreateAPIToken(username, hash, description, createdAt)
+	if err != nil {
+		return nil, err
 	}
-	return
+
+	if err := c.commit(data); err != nil {
+		return nil, err
+	}
+
+	return t, nil
 }
 
-// CreateContinuousQuery saves a continuous query with the given name for the given database.
-func (c *Client) CreateContinuousQuery(database, name, query string) error {
+// DropAPIToken removes an api token by id.
+func (c *Client) DropAPIToken(id uint64) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	data := c.cacheData.Clone()
 
-	if err := data.CreateContinuousQuery(database, name, query); err != nil {
+	if err := data.DropAPIToken(id); err != nil {
 		return err
 	}
 
@@ -1014,14 +1118,35 @@ func (c *Client) CreateContinuousQuery(database, name, query string) error {
 	return nil
 }
 
-// DropContinuousQuery removes the continuous query with the given name on the given database.
-func (c *Client) DropContinuousQuery(database, name string) error {
+// APITokens returns api tokens of user, or all if username is empty.
+func (c *Client) APITokens(username string) []APIToken {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.UserAPITokens(username)
+}
+
+// AuthenticateToken returns the user of api token.
+func (c *Client) AuthenticateToken(token string) (meta.User, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	u := c.cacheData.APITokenUser(token)
+	if u == nil {
+		return nil, ErrInvalidAPIToken
+	}
+	return u, nil
+}
+
+// CreateSession saves the hash of a session token of user lasting until
+// expiration, sessions expired at now are pruned.
+func (c *Client) CreateSession(username, hash string, now, expiration time.Time) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	data := c.cacheData.Clone()
 
-	if err := data.DropContinuousQuery(database, name); err != nil {
+	if err := data.CreateSession(username, hash, now, expiration); err != nil {
 		return err
 	}
 
@@ -1032,14 +1157,14 @@ func (c *Client) DropContinuousQuery(database, name string) error {
 	return nil
 }
 
-// CreateSubscription creates a subscription against the given database and retention policy.
-func (c *Client) CreateSubscription(database, rp, name, mode string, destinations []string) error {
+// DropSession removes a session by the hash of its token.
+func (c *Client) DropSession(hash string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	data := c.cacheData.Clone()
 
-	if err := data.CreateSubscription(database, rp, name, mode, destinations); err != nil {
+	if err := data.DropSession(hash); err != nil {
 		return err
 	}
 
@@ -1050,16 +1175,22 @@ func (c *Client) CreateSubscription(database, rp, name, mode string, destination
 	return nil
 }
 
-// DropSubscription removes the named subscription from the given database and retention policy.
-func (c *Client) DropSubscription(database, rp, name string) error {
+// SessionsExpired returns whether any session is expired at now.
+func (c *Client) SessionsExpired(now time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.SessionsExpired(now)
+}
+
+// PruneSessions removes sessions expired at now.
+func (c *Client) PruneSessions(now time.Time) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	data := c.cacheData.Clone()
 
-	if err := data.DropSubscription(database, rp, name); err != nil {
-		return err
-	}
+	data.PruneSessions(now)
 
 	if err := c.commit(data); err != nil {
 		return err
@@ -1068,64 +1199,991 @@ func (c *Client) DropSubscription(database, rp, name string) error {
 	return nil
 }
 
-// SetData overwrites the underlying data in the meta store.
-func (c *Client) SetData(data *Data) error {
+// AuthenticateSession returns the user of session token, without comparing
+// any password to its hash.
+func (c *Client) AuthenticateSession(token string) (meta.User, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	u := c.cacheData.SessionUser(token, time.Now())
+	if u == nil {
+		return nil, ErrInvalidSession
+	}
+	return u, nil
+}
+
+// SetBucketMapping maps a bucket of org to database and retention policy.
+func (c *Client) SetBucketMapping(m *BucketMapping) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// reset the index so the commit will fire a change event
-	c.cacheData.Index = 0
+	data := c.cacheData.Clone()
 
-	if err := c.commit(data.Clone()); err != nil {
+	if err := data.SetBucketMapping(m); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (c *Client) ReplaceData(data *Data) error {
+// DropBucketMapping removes the mapping of bucket of org.
+func (c *Client) DropBucketMapping(org, bucket string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	// try to write to disk before updating in memory
-	if err := snapshot(c.path, data); err != nil {
+
+	data := c.cacheData.Clone()
+
+	if err := data.DropBucketMapping(org, bucket); err != nil {
 		return err
 	}
 
-	// update in memory
-	c.cacheData = data
+	if err := c.commit(data); err != nil {
+		return err
+	}
 
-	// close channels to signal changes
-	close(c.changed)
-	c.changed = make(chan struct{})
 	return nil
 }
 
-func (c *Client) DataIndex() uint64 {
+// BucketMapping returns the mapping of bucket of org, nil if not mapped.
+func (c *Client) BucketMapping(org, bucket string) *BucketMapping {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.cacheData.Index
+
+	return c.cacheData.BucketMapping(org, bucket)
 }
 
-// Data returns a clone of the underlying data in the meta store.
-func (c *Client) Data() Data {
+// BucketMappings returns all bucket mappings.
+func (c *Client) BucketMappings() []BucketMapping {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	d := c.cacheData.Clone()
-	return *d
+
+	return append([]BucketMapping(nil), c.cacheData.BucketMappings...)
 }
 
-// WaitForDataChanged returns a channel that will get closed when
-// the metastore data has changed.
-func (c *Client) WaitForDataChanged() chan struct{} {
+// ClusterConfig returns a copy of the cluster config.
+func (c *Client) ClusterConfig() ClusterConfig {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.changed
-}
 
-// commit writes data to the underlying store.
-// This method assumes c's mutex is already locked.
-func (c *Client) commit(data *Data) error {
-	data.Index++
+	return c.cacheData.ClusterConfig.clone()
+}
+
+// SetClusterConfig sets key of cluster config to value.
+func (c *Client) SetClusterConfig(key, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetClusterConfig(key, value); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteClusterConfig unsets key of cluster config.
+func (c *Client) DeleteClusterConfig(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DeleteClusterConfig(key); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WaitForClusterConfigChanged returns a channel that will get closed when
+// the cluster config has changed.
+func (c *Client) WaitForClusterConfigChanged() chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.configChanged
+}
+
+// HintedHandoffPolicies returns hinted handoff policies of all databases.
+func (c *Client) HintedHandoffPolicies() []HintedHandoffPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]HintedHandoffPolicy(nil), c.cacheData.HintedHandoffPolicies...)
+}
+
+// HintedHandoffEnabled returns whether failed writes to retention policy rp of
+// database are queued by hinted handoff.
+func (c *Client) HintedHandoffEnabled(database, rp string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.HintedHandoffEnabled(database, rp)
+}
+
+// SetHintedHandoffPolicy sets the hinted handoff policy of a database or a
+// retention policy.
+func (c *Client) SetHintedHandoffPolicy(p *HintedHandoffPolicy) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetHintedHandoffPolicy(p); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteHintedHandoffPolicy removes the hinted handoff policy of a database
+// or a retention policy.
+func (c *Client) DeleteHintedHandoffPolicy(database, rp string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DeleteHintedHandoffPolicy(database, rp); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ShardGroupAlignments returns shard group alignments of all retention
+// policies.
+func (c *Client) ShardGroupAlignments() []ShardGroupAlignment {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]ShardGroupAlignment(nil), c.cacheData.ShardGroupAlignments...)
+}
+
+// SetShardGroupAlignment aligns shard groups of a retention policy created
+// afterwards to unit, AlignEpoch removes the alignment.
+func (c *Client) SetShardGroupAlignment(database, rp, unit string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetShardGroupAlignment(database, rp, unit); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReadOnlyShards returns ids of shards rejecting writes.
+func (c *Client) ReadOnlyShards() []uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]uint64(nil), c.cacheData.ReadOnlyShards...)
+}
+
+// ClusterReadOnly returns whether writes are rejected by read-only of cluster
+// config.
+func (c *Client) ClusterReadOnly() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.ClusterConfig.ReadOnly()
+}
+
+// ShardReadOnly returns whether writes to shard id are rejected.
+func (c *Client) ShardReadOnly(id uint64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.ShardReadOnly(id)
+}
+
+// SetShardReadOnly marks shard id read-only or writable again.
+func (c *Client) SetShardReadOnly(id uint64, readOnly bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetShardReadOnly(id, readOnly); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ShardCutover returns the cutover of shard id holding now, nil if none.
+func (c *Client) ShardCutover(id uint64) *ShardCutover {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if sc := c.cacheData.ShardCutover(id, time.Now()); sc != nil {
+		cutover := *sc
+		return &cutover
+	}
+	return nil
+}
+
+// BeginShardCutover starts the cutover of shard id to node nodeID until
+// expiration.
+func (c *Client) BeginShardCutover(id, nodeID uint64, expiration time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.BeginShardCutover(id, nodeID, expiration); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EndShardCutover ends the cutover of shard id.
+func (c *Client) EndShardCutover(id uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.EndShardCutover(id); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ShardStale returns whether the copy of shard id on node nodeID is stale.
+func (c *Client) ShardStale(id, nodeID uint64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.ShardStale(id, nodeID)
+}
+
+// StaleShards returns the stale copies of shards on node nodeID.
+func (c *Client) StaleShards(nodeID uint64) []StaleShard {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.NodeStaleShards(nodeID)
+}
+
+// MarkShardsStale marks copies of shards ids on node nodeID stale at now.
+func (c *Client) MarkShardsStale(nodeID uint64, ids []uint64, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.MarkShardsStale(nodeID, ids, now); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClearStaleShard marks the copy of shard id on node nodeID repaired.
+func (c *Client) ClearStaleShard(id, nodeID uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.ClearStaleShard(id, nodeID); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MeasurementTombstones returns the drops of measurements node nodeID
+// hasn't applied yet.
+func (c *Client) MeasurementTombstones(nodeID uint64) []MeasurementTombstone {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.NodeMeasurementTombstones(nodeID)
+}
+
+// MeasurementDroppedAfter tells whether measurement name of database was
+// dropped after t.
+func (c *Client) MeasurementDroppedAfter(database, name string, t time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.MeasurementDroppedAfter(database, name, t)
+}
+
+// CreateMeasurementTombstone records measurement name of database dropped at now.
+func (c *Client) CreateMeasurementTombstone(database, name string, now time.Time) (*MeasurementTombstone, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	t, err := data.CreateMeasurementTombstone(database, name, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.commit(data); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// AckMeasurementTombstone marks tombstone id applied by node nodeID at now.
+func (c *Client) AckMeasurementTombstone(id, nodeID uint64, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.AckMeasurementTombstone(id, nodeID, now); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MaintenanceWindows returns the maintenance windows scheduled, not pruned
+// yet once ended.
+func (c *Client) MaintenanceWindows() []MaintenanceWindow {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	windows := make([]MaintenanceWindow, len(c.cacheData.MaintenanceWindows))
+	for i := range c.cacheData.MaintenanceWindows {
+		windows[i] = c.cacheData.MaintenanceWindows[i].clone()
+	}
+	return windows
+}
+
+// InMaintenance tells whether node nodeID is in a maintenance window of
+// behavior open at now.
+func (c *Client) InMaintenance(nodeID uint64, now time.Time, behavior string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.InMaintenance(nodeID, now, behavior)
+}
+
+// NodeMaintenanceWindows returns the maintenance windows of node nodeID open
+// at now.
+func (c *Client) NodeMaintenanceWindows(nodeID uint64, now time.Time) []MaintenanceWindow {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.NodeMaintenanceWindows(nodeID, now)
+}
+
+// CreateMaintenanceWindow schedules maintenance window w at now.
+func (c *Client) CreateMaintenanceWindow(w MaintenanceWindow, now time.Time) (*MaintenanceWindow, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	created, err := data.CreateMaintenanceWindow(w, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.commit(data); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// DeleteMaintenanceWindow removes maintenance window id.
+func (c *Client) DeleteMaintenanceWindow(id uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DeleteMaintenanceWindow(id); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SealedShards returns the shards sealed.
+func (c *Client) SealedShards() []SealedShard {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]SealedShard(nil), c.cacheData.SealedShards...)
+}
+
+// ShardSealed returns whether shard id is sealed.
+func (c *Client) ShardSealed(id uint64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.ShardSealed(id)
+}
+
+// UnsealedShardGroups returns ids of shard groups to be sealed at now.
+func (c *Client) UnsealedShardGroups(grace time.Duration, now time.Time) []ShardGroupID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.UnsealedShardGroups(grace, now)
+}
+
+// SealShardGroups seals shards of groups whose end plus grace passed at now,
+// returning the number of shards sealed. Nothing is committed if none is.
+func (c *Client) SealShardGroups(grace time.Duration, now time.Time) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	sealed := data.SealShardGroups(grace, now)
+	if sealed == 0 {
+		return 0, nil
+	}
+
+	if err := c.commit(data); err != nil {
+		return 0, err
+	}
+
+	return sealed, nil
+}
+
+// SetSealedShardChecksum records the checksum of sealed shard id verified
+// across its owners at now.
+func (c *Client) SetSealedShardChecksum(id uint64, checksum uint32, diverged bool, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetSealedShardChecksum(id, checksum, diverged, now); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// StaleIncarnation tells whether incarnation of data node id is replaced or
+// the node deleted.
+func (c *Client) StaleIncarnation(id, incarnation uint64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.StaleIncarnation(id, incarnation)
+}
+
+// RegisterDataNode registers a start of data node id at now, returning its new
+// incarnation.
+func (c *Client) RegisterDataNode(id uint64, now time.Time) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	incarnation, err := data.RegisterDataNode(id, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.commit(data); err != nil {
+		return 0, err
+	}
+
+	return incarnation, nil
+}
+
+// UserMeasurementPrivileges returns the measurement scoped privileges of user
+// on database, nil if not restricted.
+func (c *Client) UserMeasurementPrivileges(username, database string) []MeasurementPrivilege {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.UserMeasurementPrivileges(username, database)
+}
+
+// SetMeasurementPrivilege scopes privilege of user on database to measurements
+// matching pattern.
+func (c *Client) SetMeasurementPrivilege(username, database, pattern string, p influxql.Privilege) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetMeasurementPrivilege(username, database, pattern, p); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UserOperatorRole returns the operator role of user, none if not assigned.
+func (c *Client) UserOperatorRole(username string) OperatorRole {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.UserOperatorRole(username)
+}
+
+// SetOperatorRole assigns operator role to user, OperatorRoleNone revokes it.
+func (c *Client) SetOperatorRole(username string, role OperatorRole) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.SetOperatorRole(username, role); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ExportUsers returns all users with their grants in one document.
+func (c *Client) ExportUsers() *UserExport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.ExportUsers()
+}
+
+// ImportUsers creates or replaces the users of doc along with their grants in
+// one commit.
+func (c *Client) ImportUsers(doc *UserExport) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.ImportUsers(doc); err != nil {
+		return err
+	}
+
+	for _, u := range doc.Users {
+		defer c.authCache.delete(u.Name)
+	}
+
+	return c.commit(data)
+}
+
+// ShardGroupsFrozen returns whether creation of shard groups is held by a
+// snapshot at now.
+func (c *Client) ShardGroupsFrozen(now time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cacheData.ShardGroupsFrozen(now)
+}
+
+// FreezeShardGroups holds creation of shard groups for snapshot id until
+// until.
+func (c *Client) FreezeShardGroups(id string, until time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+	data.FreezeShardGroups(id, until)
+	return c.commit(data)
+}
+
+// ThawShardGroups releases the freeze of snapshot id.
+func (c *Client) ThawShardGroups(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+	data.ThawShardGroups(id)
+	return c.commit(data)
+}
+
+// DatabaseTemplates returns all database templates.
+func (c *Client) DatabaseTemplates() []DatabaseTemplate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	templates := make([]DatabaseTemplate, len(c.cacheData.DatabaseTemplates))
+	for i := range c.cacheData.DatabaseTemplates {
+		templates[i] = c.cacheData.DatabaseTemplates[i].clone()
+	}
+	return templates
+}
+
+// CreateDatabaseTemplate saves a database template.
+func (c *Client) CreateDatabaseTemplate(t *DatabaseTemplate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.CreateDatabaseTemplate(t); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DropDatabaseTemplate removes a database template.
+func (c *Client) DropDatabaseTemplate(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DropDatabaseTemplate(name); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateDatabaseFromTemplate creates a database along with the retention
+// policies, continuous queries, subscriptions and grants of template at once.
+func (c *Client) CreateDatabaseFromTemplate(name, template string) (*meta.DatabaseInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.CreateDatabaseFromTemplate(name, template); err != nil {
+		return nil, err
+	}
+
+	if err := c.commit(data); err != nil {
+		return nil, err
+	}
+
+	return data.Database(name), nil
+}
+
+// DeleteShardGroup removes a shard group from a database and retention policy by id.
+func (c *Client) DeleteShardGroup(database, policy string, id uint64, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DeleteShardGroup(database, policy, id, t); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PrecreateShardGroups creates shard groups whose endtime is before the 'to' time passed in, but
+// is yet to expire before 'from'. This is to avoid the need for these shards to be created when data
+// for the corresponding time range arrives. Shard creation involves Raft consensus, and precreation
+// avoids taking the hit at write-time.
+func (c *Client) PrecreateShardGroups(from, to time.Time) error {
+	_, err := c.PrecreateShardGroupsAffected(from, to)
+	return err
+}
+
+// PrecreateShardGroupsAffected precreates shard groups as PrecreateShardGroups,
+// returning the groups created.
+func (c *Client) PrecreateShardGroupsAffected(from, to time.Time) ([]AffectedShardGroup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data := c.cacheData.Clone()
+	var affected []AffectedShardGroup
+
+	for _, di := range data.Databases {
+		for _, rp := range di.RetentionPolicies {
+			if len(rp.ShardGroups) == 0 {
+				// No data was ever written to this group, or all groups have been deleted.
+				continue
+			}
+			g := rp.ShardGroups[len(rp.ShardGroups)-1] // Get the last group in time.
+			if !g.Deleted() && g.EndTime.Before(to) && g.EndTime.After(from) {
+				// Group is not deleted, will end before the future time, but is still yet to expire.
+				// This last check is important, so the system doesn't create shards groups wholly
+				// in the past.
+
+				// Create successive shard group.
+				nextShardGroupTime := g.EndTime.Add(1 * time.Nanosecond)
+				// if it already exists, continue
+				if sg, _ := data.ShardGroupByTimestamp(di.Name, rp.Name, nextShardGroupTime); sg != nil {
+					c.logger.Info("Shard group already exists",
+						logger.ShardGroup(sg.ID),
+						logger.Database(di.Name),
+						logger.RetentionPolicy(rp.Name))
+					continue
+				}
+				newGroup, err := createShardGroup(data, di.Name, rp.Name, nextShardGroupTime)
+				if err != nil {
+					c.logger.Info("Failed to precreate successive shard group",
+						zap.Uint64("group_id", g.ID), zap.Error(err))
+					continue
+				}
+				affected = append(affected, AffectedShardGroup{
+					Database:        di.Name,
+					RetentionPolicy: rp.Name,
+					ShardGroupInfo:  *newGroup,
+				})
+				c.logger.Info("New shard group successfully precreated",
+					logger.ShardGroup(newGroup.ID),
+					logger.Database(di.Name),
+					logger.RetentionPolicy(rp.Name))
+			}
+		}
+	}
+
+	if len(affected) > 0 {
+		if err := c.commit(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return affected, nil
+}
+
+// ShardOwner returns the owning shard group info for a specific shard.
+func (c *Client) ShardOwner(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, dbi := range c.cacheData.Databases {
+		for _, rpi := range dbi.RetentionPolicies {
+			for _, g := range rpi.ShardGroups {
+				if g.Deleted() {
+					continue
+				}
+
+				for _, sh := range g.Shards {
+					if sh.ID == shardID {
+						database = dbi.Name
+						policy = rpi.Name
+						sgi = &g
+						return
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// CreateContinuousQuery saves a continuous query with the given name for the given database.
+func (c *Client) CreateContinuousQuery(database, name, query string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.CreateContinuousQuery(database, name, query); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DropContinuousQuery removes the continuous query with the given name on the given database.
+func (c *Client) DropContinuousQuery(database, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DropContinuousQuery(database, name); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateSubscription creates a subscription against the given database and retention policy.
+func (c *Client) CreateSubscription(database, rp, name, mode string, destinations []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.CreateSubscription(database, rp, name, mode, destinations); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DropSubscription removes the named subscription from the given database and retention policy.
+func (c *Client) DropSubscription(database, rp, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := c.cacheData.Clone()
+
+	if err := data.DropSubscription(database, rp, name); err != nil {
+		return err
+	}
+
+	if err := c.commit(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetData overwrites the underlying data in the meta store.
+func (c *Client) SetData(data *Data) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// reset the index so the commit will fire a change event
+	c.cacheData.Index = 0
+
+	if err := c.commit(data.Clone()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) ReplaceData(data *Data) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// try to write to disk before updating in memory
+	if err := snapshot(c.path, data); err != nil {
+		return err
+	}
+
+	// update in memory
+	configChanged := !c.cacheData.ClusterConfig.equal(data.ClusterConfig)
+	c.cacheData = data
+	c.shardGroups = newShardGroupIndex(data)
+	c.history.add(data)
+
+	// close channels to signal changes
+	close(c.changed)
+	c.changed = make(chan struct{})
+	if configChanged {
+		close(c.configChanged)
+		c.configChanged = make(chan struct{})
+	}
+	return nil
+}
+
+func (c *Client) DataIndex() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cacheData.Index
+}
+
+// Data returns a clone of the underlying data in the meta store.
+func (c *Client) Data() Data {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	d := c.cacheData.Clone()
+	return *d
+}
+
+// WaitForDataChanged returns a channel that will get closed when
+// the metastore data has changed.
+func (c *Client) WaitForDataChanged() chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.changed
+}
+
+// commit writes data to the underlying store.
+// This method assumes c's mutex is already locked.
+func (c *Client) commit(data *Data) error {
+	data.Index++
 
 	// try to write to disk before updating in memory
 	if err := snapshot(c.path, data); err != nil {
@@ -1133,11 +2191,18 @@ func (c *Client) commit(data *Data) error {
 	}
 
 	// update in memory
+	configChanged := !c.cacheData.ClusterConfig.equal(data.ClusterConfig)
 	c.cacheData = data
+	c.shardGroups = newShardGroupIndex(data)
+	c.history.add(data)
 
 	// close channels to signal changes
 	close(c.changed)
 	c.changed = make(chan struct{})
+	if configChanged {
+		close(c.configChanged)
+		c.configChanged = make(chan struct{})
+	}
 
 	return nil
 }
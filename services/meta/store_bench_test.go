@@ -0,0 +1,77 @@
+package meta_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+const benchShardGroupDuration = 7 * 24 * time.Hour
+
+// newBenchClient returns a client of databases, each with groups shard groups
+// from time 0 on.
+func newBenchClient(b *testing.B, databases, groups int) *imeta.Client {
+	data := &imeta.Data{}
+	data.Index = 1
+	if _, err := data.CreateDataNode("127.0.0.1:8086", "127.0.0.1:8088"); err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < databases; i++ {
+		name := fmt.Sprint("db", i)
+		if err := data.CreateDatabase(name); err != nil {
+			b.Fatal(err)
+		}
+		rpi := meta.DefaultRetentionPolicyInfo()
+		rpi.ShardGroupDuration = benchShardGroupDuration
+		if err := data.CreateRetentionPolicy(name, rpi, true); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < groups; j++ {
+			if err := data.CreateShardGroup(name, rpi.Name, time.Unix(0, 0).Add(time.Duration(j)*benchShardGroupDuration)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	c := imeta.NewClient(&meta.Config{})
+	if err := c.SetData(data); err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+func BenchmarkData_Clone(b *testing.B) {
+	data := newBenchClient(b, 1000, 50).Data()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data.Clone()
+	}
+}
+
+func BenchmarkClient_CreateShardGroup(b *testing.B) {
+	c := newBenchClient(b, 1000, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ts := time.Unix(0, 0).Add(time.Duration(50+i/1000) * benchShardGroupDuration)
+		if _, err := c.CreateShardGroup(fmt.Sprint("db", i%1000), "autogen", ts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkClient_ShardGroupByTimestamp(b *testing.B) {
+	c := newBenchClient(b, 1000, 50)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			ts := time.Unix(0, 0).Add(time.Duration(i%50) * benchShardGroupDuration)
+			if c.ShardGroupByTimestamp(fmt.Sprint("db", i%1000), "autogen", ts) == nil {
+				b.Fatal("shard group not found")
+			}
+			i++
+		}
+	})
+}
@@ -48,6 +48,50 @@ func TestMetaClient_CreateDatabaseOnly(t *testing.T) {
 	}
 }
 
+func TestMetaClient_CreateDatabaseWithDefaultRetentionPolicyTemplate(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if err := c.SetDefaultRetentionPolicy(&imeta.RetentionPolicyTemplate{Name: "rp0", ReplicaN: 0}); err != meta.ErrReplicationFactorTooLow {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.SetDefaultRetentionPolicy(&imeta.RetentionPolicyTemplate{
+		Name:     "weekly",
+		Duration: 7 * 24 * time.Hour,
+		ReplicaN: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	db := c.Database("db0")
+	if exp, got := "weekly", db.DefaultRetentionPolicy; exp != got {
+		t.Fatalf("rp name wrong:\n\texp: %s\n\tgot: %s", exp, got)
+	}
+	rp, err := c.RetentionPolicy("db0", "weekly")
+	if err != nil {
+		t.Fatal(err)
+	} else if rp.Duration != 7*24*time.Hour || rp.ReplicaN != 2 || rp.ShardGroupDuration != 24*time.Hour {
+		t.Fatalf("unexpected rp: %+v", rp)
+	}
+
+	// builtin default is restored
+	if err := c.SetDefaultRetentionPolicy(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateDatabase("db1"); err != nil {
+		t.Fatal(err)
+	}
+	if exp, got := "autogen", c.Database("db1").DefaultRetentionPolicy; exp != got {
+		t.Fatalf("rp name wrong:\n\texp: %s\n\tgot: %s", exp, got)
+	}
+}
+
 func TestMetaClient_CreateDatabaseIfNotExists(t *testing.T) {
 	t.Parallel()
 
@@ -968,7 +1012,7 @@ func TestMetaClient_Shards(t *testing.T) {
 	}
 
 	// Test deleting a shard group.
-	if err := c.DeleteShardGroup("db0", "autogen", groups[0].ID); err != nil {
+	if err := c.DeleteShardGroup("db0", "autogen", groups[0].ID, time.Now()); err != nil {
 		t.Fatal(err)
 	} else if groups, err = c.ShardGroupsByTimeRange("db0", "autogen", tmin, tmax); err != nil {
 		t.Fatal(err)
@@ -1111,6 +1155,188 @@ func TestMetaClient_PruneShardGroups(t *testing.T) {
 	}
 }
 
+func TestMetaClient_PruneShardGroups_Archive(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if _, err := c.ArchivedShardGroups("", ""); err != imeta.ErrArchiveDisabled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.SetArchiveDir(d)
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	deleted := time.Now().Add(-2 * 7 * 24 * time.Hour).Add(-1 * time.Hour)
+	for i := 0; i < 2; i++ {
+		sg, err := c.CreateShardGroup("db0", "autogen", time.Now().Add(time.Duration(i)*15*24*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.DeleteShardGroup("db0", "autogen", sg.ID, deleted); err != nil {
+			t.Fatal(err)
+		}
+		// every prune appends to the archive
+		if err := c.PruneShardGroups(time.Now().Add(imeta.SHARDGROUP_INFO_EVICTION)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := c.ArchivedShardGroups("db0", "")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 2 {
+		t.Fatalf("unexpected archived groups: %d", len(groups))
+	}
+	if g := groups[0]; g.Database != "db0" || g.RetentionPolicy != "autogen" || len(g.Shards) != 1 || len(g.Shards[0].Owners) != 1 {
+		t.Fatalf("unexpected archived group: %+v", g)
+	}
+	if groups, err := c.ArchivedShardGroups("db1", ""); err != nil || len(groups) != 0 {
+		t.Fatalf("unexpected archived groups of db1: %v, %v", groups, err)
+	}
+}
+
+func TestMetaClient_CreateShardGroupsForRange(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	rp, err := c.RetentionPolicy("db0", "autogen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dur := rp.ShardGroupDuration
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC).Truncate(dur)
+	if _, err := c.CreateShardGroup("db0", "autogen", start.Add(dur)); err != nil {
+		t.Fatal(err)
+	}
+
+	index := c.Data().Index
+	groups, err := c.CreateShardGroupsForRange("db0", "autogen", start, start.Add(4*dur))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 3 {
+		t.Fatalf("wrong number of shard groups created: %d", len(groups))
+	} else if got, exp := c.Data().Index, index+1; got != exp {
+		t.Fatalf("shard groups not created in one commit: index got %d, exp %d", got, exp)
+	}
+	for i, exp := range []time.Time{start, start.Add(2 * dur), start.Add(3 * dur)} {
+		if !groups[i].StartTime.Equal(exp) {
+			t.Fatalf("unexpected start of shard group %d: %v, exp %v", i, groups[i].StartTime, exp)
+		}
+	}
+	if all, err := c.ShardGroupsByTimeRange("db0", "autogen", start, start.Add(4*dur-1)); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 4 {
+		t.Fatalf("wrong number of shard groups covering range: %d", len(all))
+	}
+
+	// all covered already
+	if groups, err = c.CreateShardGroupsForRange("db0", "autogen", start, start.Add(4*dur)); err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 0 {
+		t.Fatalf("unexpected shard groups created again: %d", len(groups))
+	}
+
+	if _, err := c.CreateShardGroupsForRange("db0", "autogen", start.Add(4*dur), start.Add(2000*dur)); err != imeta.ErrShardGroupRangeTooLarge {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.CreateShardGroupsForRange("db0", "rp0", start, start.Add(dur)); err == nil {
+		t.Fatal("expected error of missing retention policy")
+	}
+}
+
+func TestMetaClient_PreviewShardOwners(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	index := c.Data().Index
+	shards, err := c.PreviewShardOwners("db0", "autogen", now)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(shards) == 0 || len(shards[0].Owners) == 0 {
+		t.Fatalf("expected shards with owners: %+v", shards)
+	} else if got := c.Data().Index; got != index {
+		t.Fatalf("preview committed: index got %d, exp %d", got, index)
+	} else if sg := c.ShardGroupByTimestamp("db0", "autogen", now); sg != nil {
+		t.Fatalf("preview created shard group: %+v", sg)
+	}
+
+	sg, err := c.CreateShardGroup("db0", "autogen", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shards, err = c.PreviewShardOwners("db0", "autogen", now); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(shards, sg.Shards) {
+		t.Fatalf("unexpected shards of existing group: %+v, exp %+v", shards, sg.Shards)
+	}
+
+	if _, err := c.PreviewShardOwners("db0", "rp0", now); err == nil {
+		t.Fatal("expected error of missing retention policy")
+	}
+}
+
+func TestMetaClient_ShardGroupsAffected(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sg, err := c.CreateShardGroup("db0", "autogen", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := c.PrecreateShardGroupsAffected(now, sg.EndTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 1 {
+		t.Fatalf("wrong number of shard groups precreated: %d", len(groups))
+	} else if g := groups[0]; g.Database != "db0" || g.RetentionPolicy != "autogen" || !g.StartTime.Equal(sg.EndTime) {
+		t.Fatalf("unexpected shard group precreated: %+v", g)
+	}
+	if groups, err = c.PrecreateShardGroupsAffected(now, sg.EndTime.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 0 {
+		t.Fatalf("unexpected shard groups precreated again: %+v", groups)
+	}
+
+	if err := c.DeleteShardGroup("db0", "autogen", sg.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if groups, err = c.PruneShardGroupsAffected(now); err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 0 {
+		t.Fatalf("unexpected shard groups pruned: %+v", groups)
+	}
+	if groups, err = c.PruneShardGroupsAffected(now.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 1 || groups[0].ID != sg.ID {
+		t.Fatalf("unexpected shard groups pruned: %+v", groups)
+	}
+}
+
 func newClient() (string, *imeta.Client) {
 	cfg := newConfig()
 	c := imeta.NewClient(cfg)
@@ -1146,3 +1372,137 @@ func isAdmin(u meta.User) bool {
 	ui := u.(*meta.UserInfo)
 	return ui.Admin
 }
+
+func TestMetaClient_ClusterConfig(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	changed := c.WaitForClusterConfigChanged()
+	if err := c.SetClusterConfig(imeta.ConfigPrecreationHorizon, "1h"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Fatal("cluster config change not notified")
+	}
+	if v, ok := c.ClusterConfig().Duration(imeta.ConfigPrecreationHorizon); !ok || v != time.Hour {
+		t.Fatalf("unexpected precreation horizon: %v, %v", v, ok)
+	}
+
+	// other changes are not notified
+	changed = c.WaitForClusterConfigChanged()
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("unexpected cluster config change")
+	default:
+	}
+
+	if err := c.DeleteClusterConfig(imeta.ConfigPrecreationHorizon); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Fatal("cluster config change not notified")
+	}
+	if len(c.ClusterConfig()) != 0 {
+		t.Fatalf("unexpected cluster config: %v", c.ClusterConfig())
+	}
+}
+
+func TestMetaClient_FeatureFlags(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	key := imeta.FeatureFlagPrefix + imeta.FeatureShardWriteBreaker
+	if err := c.SetClusterConfig(key, "yes"); err == nil {
+		t.Fatal("expected error setting invalid feature flag")
+	}
+
+	f1 := imeta.NewFeatureFlags(1, c)
+	f2 := imeta.NewFeatureFlags(2, c)
+	var none *imeta.FeatureFlags
+	if !f1.Enabled(imeta.FeatureShardWriteBreaker, true) || f1.Enabled(imeta.FeatureShardWriteBreaker, false) {
+		t.Fatal("default of feature not set should be used")
+	}
+
+	// rolled out to node 2 only
+	if err := c.SetClusterConfig(key, "2,3"); err != nil {
+		t.Fatal(err)
+	}
+	if f1.Enabled(imeta.FeatureShardWriteBreaker, false) || !f2.Enabled(imeta.FeatureShardWriteBreaker, false) {
+		t.Fatal("feature should be enabled on node 2 only")
+	}
+
+	if err := c.SetClusterConfig(key, "false"); err != nil {
+		t.Fatal(err)
+	}
+	if f1.Enabled(imeta.FeatureShardWriteBreaker, true) || f2.Enabled(imeta.FeatureShardWriteBreaker, true) {
+		t.Fatal("feature should be disabled on all nodes")
+	}
+	if !none.Enabled(imeta.FeatureShardWriteBreaker, true) {
+		t.Fatal("nil feature flags should use the default")
+	}
+}
+
+func TestMetaClient_DataAt(t *testing.T) {
+	t.Parallel()
+
+	d, c := newClient()
+	defer os.RemoveAll(d)
+	defer c.Close()
+
+	if _, err := c.CreateDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	created := c.DataIndex()
+	if _, err := c.CreateRetentionPolicy("db0", &meta.RetentionPolicySpec{Name: "rp1"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DropDatabase("db0"); err != nil {
+		t.Fatal(err)
+	}
+	dropped := c.DataIndex()
+
+	data, err := c.DataAt(created)
+	if err != nil {
+		t.Fatal(err)
+	} else if data.Index != created || data.Database("db0") == nil || data.Database("db0").RetentionPolicy("rp1") != nil {
+		t.Fatalf("unexpected data at %d: %+v", created, data.Databases)
+	}
+	if data, err := c.DataAt(dropped); err != nil {
+		t.Fatal(err)
+	} else if data.Database("db0") != nil {
+		t.Fatalf("unexpected data at %d: %+v", dropped, data.Databases)
+	}
+	// the copy returned is not shared
+	data.Databases = nil
+	if data, err := c.DataAt(created); err != nil || data.Database("db0") == nil {
+		t.Fatalf("unexpected data at %d: %v", created, err)
+	}
+
+	if _, err := c.DataAt(dropped + 1); err != imeta.ErrDataIndexNotRetained {
+		t.Fatalf("unexpected error of future index: %v", err)
+	}
+	if _, err := c.DataAt(1); err != imeta.ErrDataIndexNotRetained {
+		t.Fatalf("unexpected error of index not committed: %v", err)
+	}
+
+	c.SetDataHistorySize(1)
+	if _, err := c.DataAt(created); err != imeta.ErrDataIndexNotRetained {
+		t.Fatalf("unexpected error of index trimmed: %v", err)
+	}
+	if _, err := c.DataAt(dropped); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,225 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+)
+
+// TemplateDatabasePlaceholder is replaced by the name of database created in
+// queries of continuous query templates.
+const TemplateDatabasePlaceholder = "$database"
+
+// ContinuousQueryTemplate is a continuous query created along with the database.
+// Query is the complete CREATE CONTINUOUS QUERY statement.
+type ContinuousQueryTemplate struct {
+	Name  string
+	Query string
+}
+
+// SubscriptionTemplate is a subscription created along with the database.
+type SubscriptionTemplate struct {
+	Name            string
+	RetentionPolicy string
+	Mode            string
+	Destinations    []string
+}
+
+// GrantTemplate is a privilege granted to an existing user on the database.
+// Privilege is one of READ, WRITE and ALL.
+type GrantTemplate struct {
+	User      string
+	Privilege string
+}
+
+func (g *GrantTemplate) privilege() (influxql.Privilege, error) {
+	p, err := ParsePrivilege(g.Privilege)
+	if err != nil {
+		return p, fmt.Errorf("grant %s: %s", g.User, err)
+	}
+	return p, nil
+}
+
+// DatabaseTemplate describes everything created along with a database.
+type DatabaseTemplate struct {
+	Name string
+	// DefaultRetentionPolicy is the name of the default one in RetentionPolicies,
+	// the first one is used if empty
+	DefaultRetentionPolicy string
+	RetentionPolicies      []RetentionPolicyTemplate
+	ContinuousQueries      []ContinuousQueryTemplate
+	Subscriptions          []SubscriptionTemplate
+	Grants                 []GrantTemplate
+}
+
+func (t *DatabaseTemplate) clone() DatabaseTemplate {
+	other := *t
+	other.RetentionPolicies = append([]RetentionPolicyTemplate(nil), t.RetentionPolicies...)
+	other.ContinuousQueries = append([]ContinuousQueryTemplate(nil), t.ContinuousQueries...)
+	other.Subscriptions = make([]SubscriptionTemplate, len(t.Subscriptions))
+	for i, sub := range t.Subscriptions {
+		sub.Destinations = append([]string(nil), sub.Destinations...)
+		other.Subscriptions[i] = sub
+	}
+	other.Grants = append([]GrantTemplate(nil), t.Grants...)
+	return other
+}
+
+func (t *DatabaseTemplate) defaultRetentionPolicy() string {
+	if t.DefaultRetentionPolicy == "" && len(t.RetentionPolicies) > 0 {
+		return t.RetentionPolicies[0].Name
+	}
+	return t.DefaultRetentionPolicy
+}
+
+func (t *DatabaseTemplate) hasRetentionPolicy(name string) bool {
+	for _, rp := range t.RetentionPolicies {
+		if rp.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// continuousQuery returns the query with placeholder replaced by database
+func (t *ContinuousQueryTemplate) continuousQuery(database string) string {
+	return strings.Replace(t.Query, TemplateDatabasePlaceholder, influxql.QuoteIdent(database), -1)
+}
+
+// Validate returns an error if the template can't be applied to a new database.
+func (t *DatabaseTemplate) Validate() error {
+	if t.Name == "" {
+		return ErrDatabaseTemplateNameRequired
+	}
+	for i := range t.RetentionPolicies {
+		if err := t.RetentionPolicies[i].Validate(); err != nil {
+			return err
+		}
+	}
+	if rp := t.defaultRetentionPolicy(); rp != "" && !t.hasRetentionPolicy(rp) {
+		return fmt.Errorf("default retention policy %s not in template", rp)
+	}
+	for _, cq := range t.ContinuousQueries {
+		stmt, err := influxql.ParseStatement(cq.continuousQuery("db"))
+		if err != nil {
+			return fmt.Errorf("continuous query %s: %s", cq.Name, err)
+		}
+		cqs, ok := stmt.(*influxql.CreateContinuousQueryStatement)
+		if !ok {
+			return fmt.Errorf("continuous query %s: not a CREATE CONTINUOUS QUERY statement", cq.Name)
+		} else if cqs.Name != cq.Name {
+			return fmt.Errorf("continuous query %s: name mismatches statement", cq.Name)
+		} else if cqs.Database != "db" {
+			return fmt.Errorf("continuous query %s: should be ON %s", cq.Name, TemplateDatabasePlaceholder)
+		}
+	}
+	for _, sub := range t.Subscriptions {
+		if sub.Name == "" {
+			return errors.New("subscription name required")
+		} else if sub.Mode != "ALL" && sub.Mode != "ANY" {
+			return fmt.Errorf("subscription %s: mode should be ALL or ANY", sub.Name)
+		} else if !t.hasRetentionPolicy(sub.RetentionPolicy) {
+			return fmt.Errorf("subscription %s: retention policy %s not in template", sub.Name, sub.RetentionPolicy)
+		} else if len(sub.Destinations) == 0 {
+			return fmt.Errorf("subscription %s: destinations required", sub.Name)
+		}
+	}
+	for _, g := range t.Grants {
+		if g.User == "" {
+			return meta.ErrUsernameRequired
+		} else if _, err := g.privilege(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DatabaseTemplate returns a database template by name.
+func (data *Data) DatabaseTemplate(name string) *DatabaseTemplate {
+	for i := range data.DatabaseTemplates {
+		if data.DatabaseTemplates[i].Name == name {
+			t := data.DatabaseTemplates[i].clone()
+			return &t
+		}
+	}
+	return nil
+}
+
+// CreateDatabaseTemplate saves a database template.
+func (data *Data) CreateDatabaseTemplate(t *DatabaseTemplate) error {
+	if t == nil {
+		return errors.New("nil database template")
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	if data.DatabaseTemplate(t.Name) != nil {
+		return ErrDatabaseTemplateExists
+	}
+	data.DatabaseTemplates = append(data.DatabaseTemplates, t.clone())
+	return nil
+}
+
+// DropDatabaseTemplate removes a database template by name. Databases created
+// from it are untouched.
+func (data *Data) DropDatabaseTemplate(name string) error {
+	for i := range data.DatabaseTemplates {
+		if data.DatabaseTemplates[i].Name == name {
+			data.DatabaseTemplates = append(data.DatabaseTemplates[:i], data.DatabaseTemplates[i+1:]...)
+			return nil
+		}
+	}
+	return ErrDatabaseTemplateNotFound
+}
+
+// CreateDatabaseFromTemplate creates a database with everything described in
+// the template. The database must not exist.
+func (data *Data) CreateDatabaseFromTemplate(name, template string) error {
+	t := data.DatabaseTemplate(template)
+	if t == nil {
+		return ErrDatabaseTemplateNotFound
+	}
+	if data.Database(name) != nil {
+		return meta.ErrDatabaseExists
+	}
+
+	if err := data.CreateDatabase(name); err != nil {
+		return err
+	}
+	defaultRp := t.defaultRetentionPolicy()
+	for i := range t.RetentionPolicies {
+		rp := &t.RetentionPolicies[i]
+		if err := data.CreateRetentionPolicy(name, rp.RetentionPolicyInfo(), rp.Name == defaultRp); err != nil {
+			return err
+		}
+		if rp.ShardGroupAlignment != AlignEpoch {
+			if err := data.SetShardGroupAlignment(name, rp.Name, rp.ShardGroupAlignment); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range t.ContinuousQueries {
+		cq := &t.ContinuousQueries[i]
+		if err := data.CreateContinuousQuery(name, cq.Name, cq.continuousQuery(name)); err != nil {
+			return err
+		}
+	}
+	for _, sub := range t.Subscriptions {
+		if err := data.CreateSubscription(name, sub.RetentionPolicy, sub.Name, sub.Mode, sub.Destinations); err != nil {
+			return err
+		}
+	}
+	for _, g := range t.Grants {
+		p, err := g.privilege()
+		if err != nil {
+			return err
+		}
+		if err := data.SetPrivilege(g.User, name, p); err != nil {
+			return fmt.Errorf("grant %s: %s", g.User, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package meta
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+// APIToken authenticates requests as User without password, like the
+// `Authorization: Token <token>` header of InfluxDB 2.x clients. Only the
+// hash of token is kept.
+type APIToken struct {
+	ID          uint64
+	User        string
+	Hash        string
+	Description string
+	CreatedAt   time.Time
+}
+
+// GenerateAPIToken returns a new random token.
+func GenerateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashAPIToken returns the hash of token kept in meta. Tokens are random
+// enough to be hashed without salt, so that they can be looked up by hash.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken saves a token of user by its hash.
+func (data *Data) CreateAPIToken(username, hash, description string, createdAt time.Time) (*APIToken, error) {
+	if data.user(username) == nil {
+		return nil, meta.ErrUserNotFound
+	} else if hash == "" {
+		return nil, ErrAPITokenRequired
+	}
+	for i := range data.APITokens {
+		if data.APITokens[i].Hash == hash {
+			return nil, ErrAPITokenExists
+		}
+	}
+
+	data.MaxAPITokenID++
+	data.APITokens = append(data.APITokens, APIToken{
+		ID:          data.MaxAPITokenID,
+		User:        username,
+		Hash:        hash,
+		Description: description,
+		CreatedAt:   createdAt,
+	})
+	t := data.APITokens[len(data.APITokens)-1]
+	return &t, nil
+}
+
+// DropAPIToken removes a token by id.
+func (data *Data) DropAPIToken(id uint64) error {
+	for i := range data.APITokens {
+		if data.APITokens[i].ID == id {
+			data.APITokens = append(data.APITokens[:i], data.APITokens[i+1:]...)
+			return nil
+		}
+	}
+	return ErrAPITokenNotFound
+}
+
+// UserAPITokens returns tokens of user, or all tokens if username is empty.
+func (data *Data) UserAPITokens(username string) []APIToken {
+	var tokens []APIToken
+	for _, t := range data.APITokens {
+		if username == "" || t.User == username {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// APITokenUser returns the user of token, nil if the token is unknown.
+func (data *Data) APITokenUser(token string) *meta.UserInfo {
+	hash := HashAPIToken(token)
+	for i := range data.APITokens {
+		if data.APITokens[i].Hash == hash {
+			return data.user(data.APITokens[i].User)
+		}
+	}
+	return nil
+}
+
+// BucketMapping maps a bucket of an organization in InfluxDB 2.x API to a
+// database and retention policy. Empty Org matches buckets of any organization.
+type BucketMapping struct {
+	Org             string
+	Bucket          string
+	Database        string
+	RetentionPolicy string
+}
+
+// SetBucketMapping creates or replaces the mapping of org and bucket.
+func (data *Data) SetBucketMapping(m *BucketMapping) error {
+	if m.Bucket == "" {
+		return ErrBucketRequired
+	}
+	db := data.Database(m.Database)
+	if db == nil {
+		return influxdb.ErrDatabaseNotFound(m.Database)
+	} else if m.RetentionPolicy != "" && db.RetentionPolicy(m.RetentionPolicy) == nil {
+		return influxdb.ErrRetentionPolicyNotFound(m.RetentionPolicy)
+	}
+
+	for i := range data.BucketMappings {
+		if data.BucketMappings[i].Org == m.Org && data.BucketMappings[i].Bucket == m.Bucket {
+			data.BucketMappings[i] = *m
+			return nil
+		}
+	}
+	data.BucketMappings = append(data.BucketMappings, *m)
+	sort.Slice(data.BucketMappings, func(i, j int) bool {
+		if data.BucketMappings[i].Org != data.BucketMappings[j].Org {
+			return data.BucketMappings[i].Org < data.BucketMappings[j].Org
+		}
+		return data.BucketMappings[i].Bucket < data.BucketMappings[j].Bucket
+	})
+	return nil
+}
+
+// DropBucketMapping removes the mapping of org and bucket.
+func (data *Data) DropBucketMapping(org, bucket string) error {
+	for i := range data.BucketMappings {
+		if data.BucketMappings[i].Org == org && data.BucketMappings[i].Bucket == bucket {
+			data.BucketMappings = append(data.BucketMappings[:i], data.BucketMappings[i+1:]...)
+			return nil
+		}
+	}
+	return ErrBucketMappingNotFound
+}
+
+// BucketMapping returns the mapping of bucket in org, falling back to the
+// one of any organization. Nil is returned if bucket is not mapped.
+func (data *Data) BucketMapping(org, bucket string) *BucketMapping {
+	var fallback *BucketMapping
+	for i := range data.BucketMappings {
+		m := &data.BucketMappings[i]
+		if m.Bucket != bucket {
+			continue
+		}
+		if m.Org == org {
+			other := *m
+			return &other
+		} else if m.Org == "" {
+			fallback = m
+		}
+	}
+	if fallback != nil {
+		other := *fallback
+		return &other
+	}
+	return nil
+}
+
+func (data *Data) dropUserAPITokens(username string) {
+	n := 0
+	for _, t := range data.APITokens {
+		if t.User != username {
+			data.APITokens[n] = t
+			n++
+		}
+	}
+	data.APITokens = data.APITokens[:n]
+}
+
+func (data *Data) dropDatabaseBucketMappings(database string) {
+	n := 0
+	for _, m := range data.BucketMappings {
+		if m.Database != database {
+			data.BucketMappings[n] = m
+			n++
+		}
+	}
+	data.BucketMappings = data.BucketMappings[:n]
+}
@@ -0,0 +1,185 @@
+package meta
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxql"
+)
+
+// UserExport is the document of users along with their grants, exported from
+// a cluster and imported into another at once, e.g. to provision a staging
+// cluster like production. Password hashes are exported as is.
+type UserExport struct {
+	Users []ExportedUser
+}
+
+// ExportedUser is a user with its privileges keyed by database, its
+// privileges scoped to measurements keyed by database and its operator role.
+// Privileges are named READ, WRITE or ALL.
+type ExportedUser struct {
+	Name                  string
+	Hash                  string
+	Admin                 bool
+	Privileges            map[string]string                    `json:",omitempty"`
+	MeasurementPrivileges map[string][]ExportedMeasurementGrant `json:",omitempty"`
+	OperatorRole          string                                `json:",omitempty"`
+}
+
+// ExportedMeasurementGrant is a privilege on measurements matching Pattern.
+type ExportedMeasurementGrant struct {
+	Pattern   string
+	Privilege string
+}
+
+// privilegeName returns the name of p parsed by ParsePrivilege.
+func privilegeName(p influxql.Privilege) string {
+	switch p {
+	case influxql.ReadPrivilege:
+		return "READ"
+	case influxql.WritePrivilege:
+		return "WRITE"
+	case influxql.AllPrivileges:
+		return "ALL"
+	}
+	return "NONE"
+}
+
+// ExportUsers returns all users with their grants sorted by name.
+func (data *Data) ExportUsers() *UserExport {
+	doc := &UserExport{Users: make([]ExportedUser, 0, len(data.Users))}
+	for _, u := range data.Users {
+		eu := ExportedUser{Name: u.Name, Hash: u.Hash, Admin: u.Admin, OperatorRole: string(data.OperatorRoles[u.Name])}
+		if len(u.Privileges) > 0 {
+			eu.Privileges = make(map[string]string, len(u.Privileges))
+			for db, p := range u.Privileges {
+				eu.Privileges[db] = privilegeName(p)
+			}
+		}
+		if dbs := data.MeasurementPrivileges[u.Name]; len(dbs) > 0 {
+			eu.MeasurementPrivileges = make(map[string][]ExportedMeasurementGrant, len(dbs))
+			for db, privs := range dbs {
+				for _, mp := range privs {
+					eu.MeasurementPrivileges[db] = append(eu.MeasurementPrivileges[db],
+						ExportedMeasurementGrant{Pattern: mp.Pattern, Privilege: privilegeName(mp.Privilege)})
+				}
+			}
+		}
+		doc.Users = append(doc.Users, eu)
+	}
+	sort.Slice(doc.Users, func(i, j int) bool { return doc.Users[i].Name < doc.Users[j].Name })
+	return doc
+}
+
+// ImportUsers creates the users of doc, or replaces the same named ones along
+// with all their grants, leaving other users as they are. Grants may be on
+// databases not created yet. Sessions of users whose password changed end.
+// Nothing is imported if any password hash is invalid, or if the users
+// created would exceed max-users.
+func (data *Data) ImportUsers(doc *UserExport) error {
+	type imported struct {
+		privs   map[string]influxql.Privilege
+		mprivs  map[string][]MeasurementPrivilege
+		role    OperatorRole
+		hash    string
+		admin   bool
+		changed bool
+	}
+
+	// validate the whole document before changing anything
+	users := make(map[string]*imported, len(doc.Users))
+	for _, eu := range doc.Users {
+		if eu.Name == "" {
+			return fmt.Errorf("%w: %v", ErrInvalidUserImport, meta.ErrUsernameRequired)
+		} else if eu.Hash == "" {
+			return fmt.Errorf("%w: user %s: password hash required", ErrInvalidUserImport, eu.Name)
+		} else if checkPasswordHash(eu.Hash) != nil {
+			return fmt.Errorf("%w: user %s: invalid password hash", ErrInvalidUserImport, eu.Name)
+		} else if users[eu.Name] != nil {
+			return fmt.Errorf("%w: user %s: duplicated", ErrInvalidUserImport, eu.Name)
+		}
+
+		u := &imported{
+			privs: make(map[string]influxql.Privilege, len(eu.Privileges)),
+			hash:  eu.Hash,
+			admin: eu.Admin,
+		}
+		if eu.OperatorRole != "" {
+			role, err := ParseOperatorRole(eu.OperatorRole)
+			if err != nil {
+				return fmt.Errorf("%w: user %s: %v", ErrInvalidUserImport, eu.Name, err)
+			}
+			u.role = role
+		}
+		for db, name := range eu.Privileges {
+			p, err := ParsePrivilege(name)
+			if err != nil {
+				return fmt.Errorf("%w: user %s: %v", ErrInvalidUserImport, eu.Name, err)
+			}
+			if p != influxql.NoPrivileges {
+				u.privs[db] = p
+			}
+		}
+		for db, grants := range eu.MeasurementPrivileges {
+			for _, g := range grants {
+				p, err := ParsePrivilege(g.Privilege)
+				if err != nil {
+					return fmt.Errorf("%w: user %s: %v", ErrInvalidUserImport, eu.Name, err)
+				} else if _, err := path.Match(g.Pattern, ""); err != nil || g.Pattern == "" {
+					return fmt.Errorf("%w: user %s: %v", ErrInvalidUserImport, eu.Name, ErrMeasurementPatternInvalid)
+				}
+				if p == influxql.NoPrivileges {
+					continue
+				}
+				if u.mprivs == nil {
+					u.mprivs = make(map[string][]MeasurementPrivilege)
+				}
+				u.mprivs[db] = append(u.mprivs[db], MeasurementPrivilege{Pattern: g.Pattern, Privilege: p})
+			}
+		}
+		users[eu.Name] = u
+	}
+	created := 0
+	for name := range users {
+		if data.user(name) == nil {
+			created++
+		}
+	}
+	if created > 0 {
+		if err := data.checkUsers(created); err != nil {
+			return err
+		}
+	}
+
+	for _, eu := range doc.Users {
+		u := users[eu.Name]
+		if ui := data.user(eu.Name); ui != nil {
+			u.changed = ui.Hash != u.hash
+			ui.Hash = u.hash
+			ui.Admin = u.admin
+			ui.Privileges = u.privs
+		} else {
+			data.Users = append(data.Users, meta.UserInfo{
+				Name:       eu.Name,
+				Hash:       u.hash,
+				Admin:      u.admin,
+				Privileges: u.privs,
+			})
+		}
+
+		delete(data.MeasurementPrivileges, eu.Name)
+		if len(u.mprivs) > 0 {
+			if data.MeasurementPrivileges == nil {
+				data.MeasurementPrivileges = make(map[string]map[string][]MeasurementPrivilege)
+			}
+			data.MeasurementPrivileges[eu.Name] = u.mprivs
+		}
+		data.SetOperatorRole(eu.Name, u.role)
+		if u.changed {
+			data.dropUserSessions(eu.Name)
+		}
+	}
+	return nil
+}
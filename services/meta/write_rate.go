@@ -0,0 +1,83 @@
+package meta
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WriteRate is a token bucket limiting bytes of write requests per second,
+// letting them burst to Burst bytes. Burst is Limit if not set.
+type WriteRate struct {
+	Limit int64
+	Burst int64
+}
+
+// parseWriteRate parses limit[:burst].
+func parseWriteRate(s string) (WriteRate, error) {
+	limit, burst := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		limit, burst = s[:i], s[i+1:]
+	}
+	var r WriteRate
+	var err error
+	if r.Limit, err = strconv.ParseInt(strings.TrimSpace(limit), 10, 64); err != nil || r.Limit <= 0 {
+		return WriteRate{}, fmt.Errorf("rate should be positive bytes per second like 1048576 or 1048576:4194304 with burst")
+	}
+	r.Burst = r.Limit
+	if burst != "" {
+		if r.Burst, err = strconv.ParseInt(strings.TrimSpace(burst), 10, 64); err != nil || r.Burst <= 0 {
+			return WriteRate{}, fmt.Errorf("burst should be positive bytes")
+		}
+	}
+	return r, nil
+}
+
+// parseDatabaseWriteRates parses comma separated rates of databases, like
+// db0=1048576,db1=524288:4194304.
+func parseDatabaseWriteRates(value string) (map[string]WriteRate, error) {
+	rates := make(map[string]WriteRate)
+	for _, s := range strings.Split(value, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("should be rates of databases like db0=1048576,db1=524288:4194304")
+		}
+		r, err := parseWriteRate(s[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		rates[strings.TrimSpace(s[:i])] = r
+	}
+	return rates, nil
+}
+
+// WriteRate returns the rate limiting writes to the node of all databases,
+// false if unlimited.
+func (c ClusterConfig) WriteRate() (WriteRate, bool) {
+	limit, ok := c.Int(ConfigWriteRateLimit)
+	if !ok || limit <= 0 {
+		return WriteRate{}, false
+	}
+	r := WriteRate{Limit: limit, Burst: limit}
+	if burst, ok := c.Int(ConfigWriteRateBurst); ok && burst > 0 {
+		r.Burst = burst
+	}
+	return r, true
+}
+
+// DatabaseWriteRates returns rates limiting writes to the node keyed by
+// database, nil if none.
+func (c ClusterConfig) DatabaseWriteRates() map[string]WriteRate {
+	v, ok := c[ConfigDatabaseWriteRates]
+	if !ok {
+		return nil
+	}
+	rates, err := parseDatabaseWriteRates(v)
+	if err != nil {
+		return nil
+	}
+	return rates
+}
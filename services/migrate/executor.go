@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"time"
 
+	imeta "github.com/angopher/chronus/services/meta"
 	"github.com/angopher/chronus/x"
 	"github.com/influxdata/influxdb/pkg/tar"
 	"github.com/influxdata/influxdb/services/meta"
@@ -34,7 +35,7 @@ type ManagerInterface interface {
 
 type MetaClientInterface interface {
 	ShardOwner(shardID uint64) (database, policy string, sgi *meta.ShardGroupInfo)
-	AddShardOwner(shardID, nodeID uint64) error
+	AddShardOwner(shardID imeta.ShardID, nodeID imeta.NodeID) error
 }
 
 type TSDBInterface interface {
@@ -88,6 +89,7 @@ func backupFromRemote(t *Task, logger *zap.SugaredLogger) (*os.File, error) {
 		BackupDatabase:        t.Database,
 		BackupRetentionPolicy: t.Retention,
 		ShardID:               t.ShardId,
+		Since:                 t.Since,
 	}
 
 	// Write the request type
@@ -105,7 +107,6 @@ func backupFromRemote(t *Task, logger *zap.SugaredLogger) (*os.File, error) {
 	n := 0
 	ctx := context.Background()
 	for {
-		t.Limiter.Allow()
 		n, err = conn.Read(buf)
 		if err != nil {
 			break
@@ -128,9 +129,12 @@ func backupFromRemote(t *Task, logger *zap.SugaredLogger) (*os.File, error) {
 }
 
 func (m *Manager) replicate(t *Task) error {
-	if x.Exists(t.DstStorePath) != x.NotExisted {
+	if t.Since.IsZero() && x.Exists(t.DstStorePath) != x.NotExisted {
 		t.error(errors.New("Destination shard directory has already existed"))
 		return nil
+	} else if !t.Since.IsZero() && x.Exists(t.DstStorePath) == x.NotExisted {
+		t.error(errors.New("Destination shard directory is not existed"))
+		return nil
 	}
 	if x.Exists(t.TmpStorePath) == x.NotExisted {
 		t.error(errors.New("Temporary directory is not existed"))
@@ -4,13 +4,18 @@ import (
 	"errors"
 	"io"
 	"sync"
+	"time"
 
+	"github.com/angopher/chronus/x"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
 
 const (
 	TASK_PARALLEL_MAX = 24
+
+	// CopyRate is the default bytes copied per second by a task.
+	CopyRate = 5 * 1024 * 1024
 )
 
 var (
@@ -35,10 +40,13 @@ type Task struct {
 	// Store
 	DstStorePath string
 	TmpStorePath string
+	// Since copies only files changed since, into the shard already copied
+	// to DstStorePath, if not zero
+	Since time.Time
 
 	// Progress
 	Copied          uint64
-	Limiter         *rate.Limiter
+	Limiter         *x.ScheduledLimiter
 	ProgressLimiter *rate.Limiter // for progress logging
 
 	// Callback
@@ -71,9 +79,11 @@ type Manager struct {
 	cond       *sync.Cond
 	taskMap    map[uint64]*Task
 	taskQueue  []*Task
+	failures   map[uint64]*Task // last failed task of shards
 	parallel   int
 	logger     *zap.SugaredLogger
 	shouldStop bool
+	bandwidth  *x.BandwidthSchedule
 }
 
 // NewManager creates and returns a new manager
@@ -88,12 +98,29 @@ func NewManager(parallel int) *Manager {
 		parallel:  parallel,
 		taskMap:   make(map[uint64]*Task),
 		taskQueue: make([]*Task, 0, TASK_PARALLEL_MAX),
+		failures:  make(map[uint64]*Task),
 		cond:      sync.NewCond(&sync.Mutex{}),
 		logger:    zap.NewNop().Sugar(),
+		bandwidth: &x.BandwidthSchedule{Rate: CopyRate},
 	}
 	return m
 }
 
+// Bandwidth returns the rate limit of tasks.
+func (m *Manager) Bandwidth() *x.BandwidthSchedule {
+	m.Lock()
+	defer m.Unlock()
+	return m.bandwidth
+}
+
+// SetBandwidth sets the rate limit of tasks added afterwards, each task is
+// limited separately.
+func (m *Manager) SetBandwidth(schedule *x.BandwidthSchedule) {
+	m.Lock()
+	defer m.Unlock()
+	m.bandwidth = schedule
+}
+
 func (m *Manager) Start() {
 	for i := 0; i < m.parallel; i++ {
 		go m.loop()
@@ -115,6 +142,11 @@ func (m *Manager) loop() {
 
 		m.execute(t)
 		m.Remove(t.ShardId)
+		if t.Error != nil {
+			m.Lock()
+			m.failures[t.ShardId] = t
+			m.Unlock()
+		}
 	}
 }
 
@@ -150,8 +182,8 @@ func (m *Manager) Add(task *Task) error {
 	if task.C == nil {
 		task.C = make(chan error, 1)
 	}
-	// Currently limit to 5MB/s, 10MB/s in burst
-	task.Limiter = rate.NewLimiter(5*1024*1024, 10*1024*1024)
+	delete(m.failures, task.ShardId)
+	task.Limiter = x.NewScheduledLimiter(m.bandwidth)
 	task.ProgressLimiter = rate.NewLimiter(0.05, 1) // 1 log every 20 seconds
 	m.taskMap[task.ShardId] = task
 	m.taskQueue = append(m.taskQueue, task)
@@ -159,6 +191,23 @@ func (m *Manager) Add(task *Task) error {
 	return nil
 }
 
+// Execute copies task at once in the calling goroutine, out of the queue, the
+// parallel limit and the bandwidth of tasks, without retries. It's meant for
+// the short copy of the tail of writes in the cutover of a shard move.
+func (m *Manager) Execute(task *Task) error {
+	if task.C == nil {
+		task.C = make(chan error, 1)
+	}
+	task.Limiter = x.NewScheduledLimiter(&x.BandwidthSchedule{})
+	task.ProgressLimiter = rate.NewLimiter(0.05, 1)
+	task.Started = true
+	task.StartTime = time.Now().Unix()
+	if err := m.replicate(task); err != nil {
+		return err
+	}
+	return <-task.C
+}
+
 // Remove removes the task under specific shard id WITHOUT stopping it
 func (m *Manager) Remove(id uint64) {
 	m.Lock()
@@ -180,6 +229,17 @@ func (m *Manager) Tasks() []*Task {
 	return tasks
 }
 
+// Failures returns the last failed task of shards not added again since.
+func (m *Manager) Failures() []*Task {
+	m.Lock()
+	defer m.Unlock()
+	tasks := make([]*Task, 0, len(m.failures))
+	for _, t := range m.failures {
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
 func (m *Manager) removeFromQueue(t *Task) {
 	if t == nil {
 		return
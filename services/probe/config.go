@@ -0,0 +1,48 @@
+package probe
+
+import (
+	"errors"
+	"time"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+const (
+	// DefaultMaxMetaIndexLag is the default number of meta changes the local
+	// meta data may be behind meta servers while ready.
+	DefaultMaxMetaIndexLag = 0
+
+	// DefaultMaxHintedHandoffBacklog is the default maximum bytes of hinted
+	// data queued for other nodes while ready.
+	DefaultMaxHintedHandoffBacklog = 64 * 1024 * 1024
+
+	// DefaultDrainTimeout is the default maximum time a drain waits for hinted
+	// handoff queues to be flushed, within the default grace period of pods.
+	DefaultDrainTimeout = 25 * time.Second
+)
+
+// Config is the configuration of readiness and drain endpoints.
+type Config struct {
+	Enabled                 bool          `toml:"enabled"`
+	MaxMetaIndexLag         uint64        `toml:"max-meta-index-lag"`
+	MaxHintedHandoffBacklog toml.Size     `toml:"max-hh-backlog"`
+	DrainTimeout            toml.Duration `toml:"drain-timeout"`
+}
+
+// NewConfig returns a new Config with defaults.
+func NewConfig() Config {
+	return Config{
+		Enabled:                 true,
+		MaxMetaIndexLag:         DefaultMaxMetaIndexLag,
+		MaxHintedHandoffBacklog: DefaultMaxHintedHandoffBacklog,
+		DrainTimeout:            toml.Duration(DefaultDrainTimeout),
+	}
+}
+
+// Validate returns an error if the config is invalid.
+func (c Config) Validate() error {
+	if c.DrainTimeout < 0 {
+		return errors.New("drain-timeout must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Package probe serves the readiness and drain endpoints of a data node for
+// probes and lifecycle hooks of Kubernetes.
+//
+// GET /ready answers 200 once the node caught up with the meta index of meta
+// servers and its hinted handoff backlog is small enough, 503 otherwise. Once
+// drained the node is never ready again, so it's removed from services.
+//
+// GET /drain, for preStop hooks, drains the node: it turns not ready, then
+// waits for hinted handoff queues to other nodes to be flushed, answering 200
+// when flushed or 503 on drain timeout.
+package probe
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ReadyPath is the path of the readiness endpoint.
+	ReadyPath = "/ready"
+	// DrainPath is the path of the drain endpoint.
+	DrainPath = "/drain"
+)
+
+// drainPollInterval is how often a drain checks the hinted handoff backlog.
+const drainPollInterval = 200 * time.Millisecond
+
+// MetaClient returns the index of local meta data and of meta servers, and
+// the skew of the clock of meta servers.
+type MetaClient interface {
+	MetaIndex() (local, remote uint64, err error)
+	ClockSkew() (last, max time.Duration)
+}
+
+// HintedHandoff returns the bytes queued for other nodes.
+type HintedHandoff interface {
+	Backlog() (int64, error)
+}
+
+// Status is the body of responses of both endpoints.
+type Status struct {
+	Ready           bool   `json:"ready"`
+	Draining        bool   `json:"draining"`
+	MetaIndex       uint64 `json:"meta_index"`
+	MetaServerIndex uint64 `json:"meta_server_index"`
+	HHBacklog       int64  `json:"hh_backlog"`
+	// ClockSkew is the last skew of the clock of meta servers, positive if
+	// ahead, and MaxClockSkew the max absolute one observed, in nanoseconds
+	ClockSkew    int64 `json:"clock_skew"`
+	MaxClockSkew int64 `json:"max_clock_skew"`
+	// Reasons of not being ready
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Handler serves the endpoints, passing other requests to the next handler.
+type Handler struct {
+	MetaClient    MetaClient
+	HintedHandoff HintedHandoff
+
+	config   Config
+	draining int32
+}
+
+// NewHandler returns a new instance of Handler.
+func NewHandler(c Config) *Handler {
+	return &Handler{config: c}
+}
+
+// Wrap returns a handler serving the endpoints and the others by next.
+func (h *Handler) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ReadyPath:
+			h.serveReady(w, r)
+		case DrainPath:
+			h.serveDrain(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// Draining returns whether the node has been drained.
+func (h *Handler) Draining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+// Status returns the readiness of the node.
+func (h *Handler) Status() *Status {
+	s := &Status{Draining: h.Draining()}
+	if s.Draining {
+		s.Reasons = append(s.Reasons, "draining")
+	}
+
+	local, remote, err := h.MetaClient.MetaIndex()
+	s.MetaIndex, s.MetaServerIndex = local, remote
+	if err != nil {
+		s.Reasons = append(s.Reasons, "meta servers unreachable: "+err.Error())
+	} else if remote > local && remote-local > h.config.MaxMetaIndexLag {
+		s.Reasons = append(s.Reasons, "meta data behind meta servers")
+	}
+	last, max := h.MetaClient.ClockSkew()
+	s.ClockSkew, s.MaxClockSkew = int64(last), int64(max)
+
+	backlog, err := h.HintedHandoff.Backlog()
+	s.HHBacklog = backlog
+	if err != nil {
+		s.Reasons = append(s.Reasons, "hinted handoff backlog unknown: "+err.Error())
+	} else if backlog > int64(h.config.MaxHintedHandoffBacklog) {
+		s.Reasons = append(s.Reasons, "hinted handoff backlog too large")
+	}
+
+	s.Ready = len(s.Reasons) == 0
+	return s
+}
+
+func (h *Handler) serveReady(w http.ResponseWriter, r *http.Request) {
+	s := h.Status()
+	writeStatus(w, s, s.Ready)
+}
+
+func (h *Handler) serveDrain(w http.ResponseWriter, r *http.Request) {
+	atomic.StoreInt32(&h.draining, 1)
+
+	ctx := r.Context()
+	timeout := time.NewTimer(time.Duration(h.config.DrainTimeout))
+	defer timeout.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		if backlog, err := h.HintedHandoff.Backlog(); err == nil && backlog == 0 {
+			writeStatus(w, h.Status(), true)
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			writeStatus(w, h.Status(), false)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeStatus(w http.ResponseWriter, s *Status, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(s)
+}
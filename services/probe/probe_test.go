@@ -0,0 +1,109 @@
+package probe
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb/toml"
+)
+
+type fakeMetaClient struct {
+	local, remote uint64
+	err           error
+	skew          time.Duration
+}
+
+func (c *fakeMetaClient) MetaIndex() (uint64, uint64, error) {
+	return c.local, c.remote, c.err
+}
+
+func (c *fakeMetaClient) ClockSkew() (time.Duration, time.Duration) {
+	return c.skew, c.skew
+}
+
+type fakeHintedHandoff struct {
+	backlog int64
+}
+
+func (h *fakeHintedHandoff) Backlog() (int64, error) {
+	return atomic.LoadInt64(&h.backlog), nil
+}
+
+func serve(h http.Handler, path string) (int, *Status) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var s Status
+	json.Unmarshal(w.Body.Bytes(), &s)
+	return w.Code, &s
+}
+
+func TestHandler_Ready(t *testing.T) {
+	c := NewConfig()
+	c.MaxMetaIndexLag = 1
+	c.MaxHintedHandoffBacklog = 100
+	mc := &fakeMetaClient{local: 10, remote: 11, skew: -time.Second}
+	hh := &fakeHintedHandoff{backlog: 100}
+	h := NewHandler(c)
+	h.MetaClient = mc
+	h.HintedHandoff = hh
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	handler := h.Wrap(next)
+
+	if code, s := serve(handler, ReadyPath); code != http.StatusOK || !s.Ready || s.MetaServerIndex != 11 || s.ClockSkew != int64(-time.Second) {
+		t.Fatalf("unexpected status %d: %+v", code, s)
+	}
+
+	for _, tc := range []struct {
+		mc      fakeMetaClient
+		backlog int64
+	}{
+		{mc: fakeMetaClient{local: 10, remote: 12}},
+		{mc: fakeMetaClient{err: errors.New("unreachable")}},
+		{mc: fakeMetaClient{local: 10, remote: 10}, backlog: 101},
+	} {
+		*mc = tc.mc
+		hh.backlog = tc.backlog
+		if code, s := serve(handler, ReadyPath); code != http.StatusServiceUnavailable || s.Ready || len(s.Reasons) != 1 {
+			t.Fatalf("expected not ready for %+v, got %d: %+v", tc, code, s)
+		}
+	}
+
+	if code, _ := serve(handler, "/ping"); code != http.StatusTeapot {
+		t.Fatalf("request not passed to next handler: %d", code)
+	}
+}
+
+func TestHandler_Drain(t *testing.T) {
+	c := NewConfig()
+	c.DrainTimeout = toml.Duration(time.Second)
+	hh := &fakeHintedHandoff{backlog: 10}
+	h := NewHandler(c)
+	h.MetaClient = &fakeMetaClient{}
+	h.HintedHandoff = hh
+	handler := h.Wrap(http.NotFoundHandler())
+
+	go func() {
+		time.Sleep(2 * drainPollInterval)
+		atomic.StoreInt64(&hh.backlog, 0)
+	}()
+	if code, s := serve(handler, DrainPath); code != http.StatusOK || !s.Draining || s.HHBacklog != 0 {
+		t.Fatalf("unexpected drain %d: %+v", code, s)
+	}
+	// never ready again
+	if code, s := serve(handler, ReadyPath); code != http.StatusServiceUnavailable || s.Reasons[0] != "draining" {
+		t.Fatalf("unexpected status once drained %d: %+v", code, s)
+	}
+
+	// queues not flushed in time
+	c.DrainTimeout = toml.Duration(drainPollInterval)
+	h.config = c
+	atomic.StoreInt64(&hh.backlog, 10)
+	if code, s := serve(handler, DrainPath); code != http.StatusServiceUnavailable || s.HHBacklog != 10 {
+		t.Fatalf("unexpected drain timed out %d: %+v", code, s)
+	}
+}
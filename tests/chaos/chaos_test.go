@@ -0,0 +1,175 @@
+package chaos_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/angopher/chronus/tests/chaos"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+)
+
+func openCluster(t *testing.T, metaNodes, dataNodes int) *chaos.Cluster {
+	dir, err := ioutil.TempDir("", "chronus-chaos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := chaos.Open(chaos.Config{MetaNodes: metaNodes, DataNodes: dataNodes, Dir: dir})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		os.RemoveAll(dir)
+	})
+	return c
+}
+
+func points(from, n int) []models.Point {
+	points := make([]models.Point, 0, n)
+	for i := from; i < from+n; i++ {
+		points = append(points, models.MustNewPoint("cpu",
+			models.NewTags(map[string]string{"host": fmt.Sprintf("server%02d", i%10)}),
+			models.Fields{"value": float64(i)}, time.Unix(int64(i), 0)))
+	}
+	return points
+}
+
+func TestChaos_MetaLeaderPartitioned(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping chaos test in short mode")
+	}
+	c := openCluster(t, 3, 0)
+
+	leader, err := c.Meta.WaitLeader(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var others []uint64
+	for _, m := range c.Meta.Nodes() {
+		if m.ID != leader.ID {
+			others = append(others, m.ID)
+		}
+	}
+
+	// the majority elects another leader and goes on without the old one
+	c.Meta.Net.Partition([]uint64{leader.ID}, others)
+	if err := c.Meta.CreateDatabase("db0", "rp0", 1); err != nil {
+		t.Fatal(err)
+	}
+	if l := c.Meta.Leader(); l == nil || l.ID == leader.ID {
+		t.Fatalf("expected another leader than %d", leader.ID)
+	}
+	if leader.Client.Database("db0") != nil {
+		t.Fatal("database created on the partitioned node")
+	}
+
+	c.Meta.Net.Heal()
+	if err := c.Meta.WaitConsistent(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if leader.Client.Database("db0") == nil {
+		t.Fatal("database missing on the old leader once healed")
+	}
+}
+
+func TestChaos_MetaNodeCrashed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping chaos test in short mode")
+	}
+	c := openCluster(t, 3, 0)
+
+	c.Meta.Net.Crash(2)
+	for i := 0; i < 5; i++ {
+		if err := c.Meta.CreateDatabase(fmt.Sprintf("db%d", i), "rp0", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Meta.Net.Recover(2)
+	if err := c.Meta.WaitConsistent(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChaos_NoAcknowledgedWriteLost(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping chaos test in short mode")
+	}
+	c := openCluster(t, 3, 3)
+	if err := c.Meta.CreateDatabase("db0", "rp0", 2); err != nil {
+		t.Fatal(err)
+	}
+	nodes := c.Data.Nodes()
+	write := func(from, n int, node *chaos.DataNode, consistency models.ConsistencyLevel) {
+		for i := from; i < from+n; i += 10 {
+			if err := node.WritePoints("db0", "rp0", consistency, points(i, 10)); err != nil {
+				t.Logf("write %d through node %d: %v", i, node.ID, err)
+			}
+		}
+	}
+
+	write(0, 100, nodes[0], models.ConsistencyLevelAll)
+
+	// a crashed owner gets its points by hinted handoff once recovered
+	c.Data.Net.Crash(nodes[1].ID)
+	write(100, 100, nodes[0], models.ConsistencyLevelOne)
+	write(200, 100, nodes[2], models.ConsistencyLevelAny)
+
+	// so does an owner partitioned, also from the meta leader
+	c.Data.Net.Recover(nodes[1].ID)
+	c.Data.Net.Partition([]uint64{nodes[0].ID}, []uint64{nodes[1].ID, nodes[2].ID})
+	if l := c.Meta.Leader(); l != nil {
+		c.Meta.Net.Partition([]uint64{l.ID})
+	}
+	write(300, 100, nodes[0], models.ConsistencyLevelAny)
+	write(400, 100, nodes[1], models.ConsistencyLevelOne)
+
+	c.Data.Net.Heal()
+	c.Meta.Net.Heal()
+	if err := c.WaitConverged(30 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, d := range nodes {
+		for _, id := range d.Store.ShardIDs() {
+			n += len(d.Store.Points(id))
+		}
+	}
+	// all points are written twice, whatever failed to be acknowledged
+	if exp := 2 * 500; n != exp {
+		t.Fatalf("%d points stored, exp %d", n, exp)
+	}
+}
+
+func TestChaos_LeaseClockSkew(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping chaos test in short mode")
+	}
+	c := openCluster(t, 3, 3)
+	nodes := c.Data.Nodes()
+
+	// leases are timed by meta, a node far behind still takes it
+	c.Data.Net.Skew(nodes[1].ID, -2*meta.DefaultLeaseDuration)
+	c.Data.Net.Skew(nodes[2].ID, 5*time.Minute)
+	l, err := c.AcquireLease(nodes[1].ID, "cq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Owner != nodes[1].ID || !l.Expiration.After(time.Now()) {
+		t.Fatalf("unexpected lease: %+v", l)
+	}
+
+	// and nodes ahead or not can't take it while held
+	for _, d := range []*chaos.DataNode{nodes[2], nodes[0]} {
+		if _, err := c.AcquireLease(d.ID, "cq"); err == nil {
+			t.Fatalf("expected lease held by %d rejected for %d", nodes[1].ID, d.ID)
+		}
+	}
+	if l, err = c.AcquireLease(nodes[1].ID, "cq"); err != nil || l.Owner != nodes[1].ID {
+		t.Fatalf("renewing lease: %v, %+v", err, l)
+	}
+}
@@ -0,0 +1,61 @@
+package chaos
+
+import (
+	"time"
+
+	"github.com/influxdata/influxdb/services/meta"
+	"go.uber.org/zap"
+)
+
+// Config is the layout of a Cluster.
+type Config struct {
+	MetaNodes int
+	DataNodes int
+	// Dir keeps raft logs and hinted handoff queues
+	Dir    string
+	Logger *zap.Logger
+}
+
+// Cluster is a cluster of meta and data nodes running in process.
+type Cluster struct {
+	Meta *MetaCluster
+	Data *DataCluster
+}
+
+// Open starts a cluster once meta elected a leader.
+func Open(c Config) (*Cluster, error) {
+	if c.Logger == nil {
+		c.Logger = zap.NewNop()
+	}
+	m := OpenMetaCluster(c.MetaNodes, c.Dir, c.Logger)
+	if _, err := m.WaitLeader(metaRetryTimeout); err != nil {
+		m.Close()
+		return nil, err
+	}
+	d, err := OpenDataCluster(m, c.DataNodes, c.Dir, c.Logger)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	return &Cluster{Meta: m, Data: d}, nil
+}
+
+// Close stops all nodes.
+func (c *Cluster) Close() {
+	c.Data.Close()
+	c.Meta.Close()
+}
+
+// AcquireLease acquires lease name for data node by its clock, skewed or not.
+func (c *Cluster) AcquireLease(nodeID uint64, name string) (*meta.Lease, error) {
+	return c.Meta.AcquireLease(name, nodeID, c.Data.Net.Now(nodeID))
+}
+
+// WaitConverged waits for meta nodes to agree and data nodes to converge.
+func (c *Cluster) WaitConverged(timeout time.Duration) error {
+	start := time.Now()
+	if err := c.Meta.WaitConsistent(timeout); err != nil {
+		return err
+	}
+	return c.Data.WaitConverged(timeout - time.Since(start))
+}
@@ -0,0 +1,389 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/angopher/chronus/coordinator"
+	"github.com/angopher/chronus/services/hh"
+	"github.com/influxdata/influxdb"
+	"github.com/influxdata/influxdb/models"
+	"github.com/influxdata/influxdb/services/meta"
+	"github.com/influxdata/influxdb/tcp"
+	"github.com/influxdata/influxdb/toml"
+	"go.uber.org/zap"
+)
+
+// writeTimeout bounds writes between data nodes.
+const writeTimeout = 2 * time.Second
+
+// MemStore keeps points of shards in memory, a point written twice is kept
+// once.
+type MemStore struct {
+	coordinator.TSDBStore
+
+	mu     sync.Mutex
+	shards map[uint64]map[string]struct{}
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{shards: make(map[uint64]map[string]struct{})}
+}
+
+func (s *MemStore) CreateShard(database, retentionPolicy string, shardID uint64, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shards[shardID] == nil {
+		s.shards[shardID] = make(map[string]struct{})
+	}
+	return nil
+}
+
+func (s *MemStore) WriteToShard(shardID uint64, points []models.Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh := s.shards[shardID]
+	if sh == nil {
+		sh = make(map[string]struct{})
+		s.shards[shardID] = sh
+	}
+	for _, p := range points {
+		sh[p.String()] = struct{}{}
+	}
+	return nil
+}
+
+// Has returns whether point is in shard.
+func (s *MemStore) Has(shardID uint64, point string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.shards[shardID][point]
+	return ok
+}
+
+// Points returns points of shard in line protocol, sorted.
+func (s *MemStore) Points(shardID uint64) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	points := make([]string, 0, len(s.shards[shardID]))
+	for p := range s.shards[shardID] {
+		points = append(points, p)
+	}
+	sort.Strings(points)
+	return points
+}
+
+// ShardIDs returns shards holding points.
+func (s *MemStore) ShardIDs() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]uint64, 0, len(s.shards))
+	for id := range s.shards {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// DataNode is a data node of a DataCluster.
+type DataNode struct {
+	ID            uint64
+	Store         *MemStore
+	PointsWriter  *coordinator.PointsWriter
+	HintedHandoff *hh.Service
+
+	cluster *DataCluster
+	service *coordinator.Service
+	writer  *coordinator.ShardWriter
+	ln      net.Listener
+}
+
+// DataCluster is a cluster of data nodes writing to each other through Net,
+// whose ids are the ids of nodes in meta. Data nodes always reach meta.
+type DataCluster struct {
+	Net  *Network
+	Meta *MetaCluster
+
+	nodes []*DataNode
+	meta  *dataMetaClient
+
+	mu    sync.Mutex
+	acked []ackedWrite
+}
+
+// ackedWrite is a write acknowledged to a client, whose points must never be
+// lost.
+type ackedWrite struct {
+	database, rp string
+	points       []models.Point
+}
+
+// OpenDataCluster starts n data nodes registered in meta, keeping queues of
+// hinted handoff in dir.
+func OpenDataCluster(m *MetaCluster, n int, dir string, logger *zap.Logger) (*DataCluster, error) {
+	c := &DataCluster{Net: NewNetwork(), Meta: m, meta: &dataMetaClient{cluster: m}}
+	for i := 0; i < n; i++ {
+		d, err := c.openNode(i, dir, logger)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.nodes = append(c.nodes, d)
+	}
+	return c, nil
+}
+
+func (c *DataCluster) openNode(i int, dir string, logger *zap.Logger) (*DataNode, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	ni, err := c.Meta.CreateDataNode(fmt.Sprintf("data-%d", i), ln.Addr().String())
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	d := &DataNode{ID: ni.ID, Store: NewMemStore(), cluster: c, ln: ln}
+	mc := c.meta
+
+	mux := tcp.NewMux()
+	go mux.Serve(ln)
+	d.service = coordinator.NewService(coordinator.NewConfig())
+	d.service.TSDBStore = d.Store
+	d.service.Listener = mux.Listen(coordinator.MuxHeader)
+	d.service.GRPCListener = mux.Listen(coordinator.GRPCMuxHeader)
+	d.service.WithLogger(logger)
+	if err := d.service.Open(); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	d.writer = coordinator.NewShardWriterWithTransport(&dataTransport{
+		ShardTransport: coordinator.NewGRPCTransport(writeTimeout, time.Second, mc),
+		net:            c.Net,
+		from:           d.ID,
+	})
+	d.writer.MetaClient = mc
+	d.writer.WithLogger(logger)
+
+	hc := hh.NewConfig()
+	hc.Enabled = true
+	hc.Dir = filepath.Join(dir, fmt.Sprintf("hh-%d", d.ID))
+	hc.RetryInterval = toml.Duration(10 * time.Millisecond)
+	hc.RetryMaxInterval = toml.Duration(100 * time.Millisecond)
+	d.HintedHandoff = hh.NewService(hc, d.writer, mc)
+	d.HintedHandoff.WithLogger(logger)
+	if err := d.HintedHandoff.Open(); err != nil {
+		d.close()
+		return nil, err
+	}
+
+	d.PointsWriter = coordinator.NewPointsWriter()
+	d.PointsWriter.Node = &influxdb.Node{ID: d.ID}
+	d.PointsWriter.WriteTimeout = writeTimeout
+	d.PointsWriter.MetaClient = mc
+	d.PointsWriter.TSDBStore = d.Store
+	d.PointsWriter.ShardWriter = d.writer
+	d.PointsWriter.HintedHandoff = d.HintedHandoff
+	d.PointsWriter.WithLogger(logger)
+	if err := d.PointsWriter.Open(); err != nil {
+		d.close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close stops all nodes.
+func (c *DataCluster) Close() {
+	for _, d := range c.nodes {
+		d.close()
+	}
+}
+
+// Nodes returns all nodes.
+func (c *DataCluster) Nodes() []*DataNode {
+	return c.nodes
+}
+
+// Node returns the node of id, nil if none.
+func (c *DataCluster) Node(id uint64) *DataNode {
+	for _, d := range c.nodes {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// WritePoints writes points through node, recording them to be checked by
+// CheckAcked if acknowledged.
+func (d *DataNode) WritePoints(database, rp string, consistency models.ConsistencyLevel, points []models.Point) error {
+	if d.cluster.Net.Crashed(d.ID) {
+		return ErrCrashed
+	}
+	if err := d.PointsWriter.WritePointsPrivileged(database, rp, consistency, points); err != nil {
+		return err
+	}
+	d.cluster.mu.Lock()
+	defer d.cluster.mu.Unlock()
+	d.cluster.acked = append(d.cluster.acked, ackedWrite{database: database, rp: rp, points: points})
+	return nil
+}
+
+func (d *DataNode) close() {
+	if d.PointsWriter != nil {
+		d.PointsWriter.Close()
+	}
+	if d.HintedHandoff != nil {
+		d.HintedHandoff.Close()
+	}
+	d.writer.Close()
+	d.service.Close()
+	d.ln.Close()
+}
+
+// CheckAcked returns an error if a point of an acknowledged write is missing
+// on an owner of its shard.
+func (c *DataCluster) CheckAcked() error {
+	c.mu.Lock()
+	acked := append([]ackedWrite(nil), c.acked...)
+	c.mu.Unlock()
+
+	mapper := c.nodes[0].PointsWriter
+	for _, w := range acked {
+		mapping, err := mapper.MapShards(&coordinator.WritePointsRequest{Database: w.database, RetentionPolicy: w.rp, Points: w.points})
+		if err != nil {
+			return err
+		}
+		for shardID, points := range mapping.Points {
+			for _, owner := range mapping.Shards[shardID].Owners {
+				d := c.Node(owner.NodeID)
+				for _, p := range points {
+					if !d.Store.Has(shardID, p.String()) {
+						return fmt.Errorf("acknowledged point %q of shard %d missing on node %d", p.String(), shardID, owner.NodeID)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckReplicas returns an error if owners of a shard hold different points.
+func (c *DataCluster) CheckReplicas() error {
+	checked := make(map[uint64]bool)
+	for _, d := range c.nodes {
+		for _, shardID := range d.Store.ShardIDs() {
+			if checked[shardID] {
+				continue
+			}
+			checked[shardID] = true
+			_, _, sgi := c.meta.ShardOwner(shardID)
+			if sgi == nil {
+				return fmt.Errorf("shard %d not found in meta", shardID)
+			}
+			var (
+				first []string
+				from  uint64
+			)
+			for _, sh := range sgi.Shards {
+				if sh.ID != shardID {
+					continue
+				}
+				for _, owner := range sh.Owners {
+					points := c.Node(owner.NodeID).Store.Points(shardID)
+					if first == nil {
+						first, from = points, owner.NodeID
+					} else if !equalStrings(first, points) {
+						return fmt.Errorf("shard %d has %d points on node %d, %d on node %d",
+							shardID, len(points), owner.NodeID, len(first), from)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// WaitConverged waits for acknowledged writes delivered to all owners and
+// replicas converged, e.g. by hinted handoff after faults healed.
+func (c *DataCluster) WaitConverged(timeout time.Duration) error {
+	return waitFor(timeout, func() error {
+		if err := c.CheckAcked(); err != nil {
+			return err
+		}
+		return c.CheckReplicas()
+	})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// dataTransport fails writes to nodes not reached.
+type dataTransport struct {
+	coordinator.ShardTransport
+	net  *Network
+	from uint64
+}
+
+func (t *dataTransport) WriteShard(ctx context.Context, nodeID uint64, req []byte) ([]byte, error) {
+	if !t.net.Reachable(t.from, nodeID) {
+		return nil, ErrUnreachable
+	}
+	return t.ShardTransport.WriteShard(ctx, nodeID, req)
+}
+
+// dataMetaClient is the meta client of data nodes, reading from the leader
+// and proposing shard groups missing.
+type dataMetaClient struct {
+	cluster *MetaCluster
+}
+
+func (c *dataMetaClient) leader() *MetaNode {
+	if l := c.cluster.Leader(); l != nil {
+		return l
+	}
+	return c.cluster.Node(1)
+}
+
+func (c *dataMetaClient) Database(name string) *meta.DatabaseInfo {
+	return c.leader().Client.Database(name)
+}
+
+func (c *dataMetaClient) RetentionPolicy(database, policy string) (*meta.RetentionPolicyInfo, error) {
+	return c.leader().Client.RetentionPolicy(database, policy)
+}
+
+func (c *dataMetaClient) CreateShardGroup(database, policy string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+	groups, err := c.leader().Client.ShardGroupsByTimeRange(database, policy, timestamp, timestamp)
+	if err == nil {
+		for i := range groups {
+			if groups[i].Contains(timestamp) {
+				return &groups[i], nil
+			}
+		}
+	}
+	return c.cluster.CreateShardGroup(database, policy, timestamp)
+}
+
+func (c *dataMetaClient) DataNode(id uint64) (*meta.NodeInfo, error) {
+	return c.leader().Client.DataNode(id)
+}
+
+func (c *dataMetaClient) ShardOwner(shardID uint64) (string, string, *meta.ShardGroupInfo) {
+	return c.leader().Client.ShardOwner(shardID)
+}
@@ -0,0 +1,323 @@
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	"github.com/angopher/chronus/raftmeta"
+	imeta "github.com/angopher/chronus/services/meta"
+	"github.com/influxdata/influxdb/services/meta"
+	"go.etcd.io/etcd/raft/raftpb"
+	"go.uber.org/zap"
+)
+
+// metaRetryTimeout is how long calls to meta are retried across elections.
+const metaRetryTimeout = 15 * time.Second
+
+// MetaNode is a raft meta node of a MetaCluster.
+type MetaNode struct {
+	ID      uint64
+	Client  *imeta.Client
+	Service *raftmeta.MetaService
+
+	node  *raftmeta.RaftNode
+	net   *Network
+	inbox chan raftpb.Message
+	done  chan struct{}
+}
+
+// MetaCluster is a cluster of raft meta nodes exchanging messages through
+// Net, whose ids are the raft ids of nodes from 1.
+type MetaCluster struct {
+	Net   *Network
+	nodes []*MetaNode
+}
+
+// OpenMetaCluster starts a cluster of n meta nodes keeping their raft logs in
+// dir.
+func OpenMetaCluster(n int, dir string, logger *zap.Logger) *MetaCluster {
+	c := &MetaCluster{Net: NewNetwork()}
+	peers := make([]raftmeta.Peer, 0, n)
+	for id := uint64(1); id <= uint64(n); id++ {
+		peers = append(peers, raftmeta.Peer{Addr: fmt.Sprintf("meta-%d", id), RaftId: id})
+	}
+
+	for _, p := range peers {
+		config := raftmeta.NewConfig()
+		config.RaftId = p.RaftId
+		config.MyAddr = p.Addr
+		config.Peers = peers
+		config.WalDir = filepath.Join(dir, fmt.Sprintf("meta-%d", p.RaftId))
+		// elections in a few hundred milliseconds
+		config.TickTimeMs = 10
+		config.ElectionTick = 20
+		config.SnapshotIntervalSec = 3600
+		config.ChecksumIntervalSec = 3600
+
+		cli := imeta.NewClient(&meta.Config{RetentionAutoCreate: false})
+		cli.WithLogger(logger)
+		if err := cli.Open(); err != nil {
+			panic(err)
+		}
+		node := raftmeta.NewRaftNode(config, logger)
+		node.MetaStore = cli
+
+		m := &MetaNode{
+			ID:     p.RaftId,
+			Client: cli,
+			node:   node,
+			net:    c.Net,
+			inbox:  make(chan raftpb.Message, 4096),
+			done:   make(chan struct{}),
+		}
+		t := &metaTransport{Transport: raftmeta.NewTransport(), cluster: c, from: m.ID}
+		t.WithLogger(logger)
+		node.Transport = t
+		c.nodes = append(c.nodes, m)
+	}
+
+	for _, m := range c.nodes {
+		m.node.InitAndStartNode()
+		go m.node.Run()
+		go m.deliver()
+
+		linearRead := raftmeta.NewLinearizabler(m.node)
+		go linearRead.ReadLoop()
+		m.Service = raftmeta.NewMetaService(fmt.Sprintf("meta-%d", m.ID), m.Client, m.node, linearRead)
+		m.Service.WithLogger(logger)
+	}
+	return c
+}
+
+// Close stops all nodes.
+func (c *MetaCluster) Close() {
+	for _, m := range c.nodes {
+		close(m.done)
+		m.node.Stop()
+		m.Client.Close()
+	}
+}
+
+// Nodes returns all nodes.
+func (c *MetaCluster) Nodes() []*MetaNode {
+	return c.nodes
+}
+
+// Node returns the node of id, nil if none.
+func (c *MetaCluster) Node(id uint64) *MetaNode {
+	if id == 0 || id > uint64(len(c.nodes)) {
+		return nil
+	}
+	return c.nodes[id-1]
+}
+
+// Leader returns the node considered leader by a majority of nodes reaching
+// it, nil if none.
+func (c *MetaCluster) Leader() *MetaNode {
+	votes := make(map[uint64]int)
+	for _, m := range c.nodes {
+		if lead := m.Leader(); lead != 0 && c.Net.Reachable(m.ID, lead) {
+			votes[lead]++
+		}
+	}
+	for id, n := range votes {
+		if n > len(c.nodes)/2 {
+			return c.Node(id)
+		}
+	}
+	return nil
+}
+
+// WaitLeader waits for a leader elected by a majority.
+func (c *MetaCluster) WaitLeader(timeout time.Duration) (*MetaNode, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if l := c.Leader(); l != nil {
+			return l, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("no leader elected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Do runs fn with the leader, retrying on failures until elections settle.
+func (c *MetaCluster) Do(fn func(m *MetaNode) error) error {
+	deadline := time.Now().Add(metaRetryTimeout)
+	for {
+		l, err := c.WaitLeader(time.Until(deadline))
+		if err != nil {
+			return err
+		}
+		if err = fn(l); err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// CheckConsistent returns an error if nodes not crashed differ in meta data.
+func (c *MetaCluster) CheckConsistent() error {
+	var (
+		first []byte
+		from  uint64
+	)
+	for _, m := range c.nodes {
+		if c.Net.Crashed(m.ID) {
+			continue
+		}
+		data := m.Client.Data()
+		b, err := data.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first, from = b, m.ID
+		} else if !bytes.Equal(first, b) {
+			return fmt.Errorf("meta data of node %d differs from node %d at index %d", m.ID, from, data.Index)
+		}
+	}
+	return nil
+}
+
+// WaitConsistent waits for nodes not crashed to agree on meta data.
+func (c *MetaCluster) WaitConsistent(timeout time.Duration) error {
+	return waitFor(timeout, c.CheckConsistent)
+}
+
+// CreateDatabase creates database with a default retention policy rp of
+// replicaN.
+func (c *MetaCluster) CreateDatabase(database, rp string, replicaN int) error {
+	return c.Do(func(m *MetaNode) error {
+		return m.Call(m.Service.CreateDatabaseWithRetentionPolicy, &raftmeta.CreateDatabaseWithRetentionPolicyReq{
+			Name: database,
+			Rps:  raftmeta.RetentionPolicySpec{Name: rp, ReplicaN: replicaN},
+		}, &raftmeta.CreateDatabaseWithRetentionPolicyResp{})
+	})
+}
+
+// CreateDataNode returns the data node registered by addresses.
+func (c *MetaCluster) CreateDataNode(httpAddr, tcpAddr string) (*meta.NodeInfo, error) {
+	resp := &raftmeta.CreateDataNodeResp{}
+	err := c.Do(func(m *MetaNode) error {
+		return m.Call(m.Service.CreateDataNode, &raftmeta.CreateDataNodeReq{HttpAddr: httpAddr, TcpAddr: tcpAddr}, resp)
+	})
+	return &resp.NodeInfo, err
+}
+
+// CreateShardGroup returns the shard group of rp covering timestamp, created
+// if not existing.
+func (c *MetaCluster) CreateShardGroup(database, rp string, timestamp time.Time) (*meta.ShardGroupInfo, error) {
+	resp := &raftmeta.CreateShardGroupResp{}
+	err := c.Do(func(m *MetaNode) error {
+		return m.Call(m.Service.CreateShardGroup, &raftmeta.CreateShardGroupReq{
+			Database:  database,
+			Policy:    rp,
+			Timestamp: timestamp.Unix(),
+		}, resp)
+	})
+	return &resp.ShardGroupInfo, err
+}
+
+// AcquireLease acquires lease name for node requesting at now by its clock.
+func (c *MetaCluster) AcquireLease(name string, nodeID uint64, now time.Time) (*meta.Lease, error) {
+	l, err := c.WaitLeader(metaRetryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	resp := &raftmeta.AcquireLeaseResp{}
+	err = l.Call(l.Service.AcquireLease, &raftmeta.AcquireLeaseReq{
+		Name:        name,
+		NodeId:      nodeID,
+		RequestTime: now.UnixNano() / int64(time.Millisecond),
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Lease, nil
+}
+
+// Leader returns the leader known by node, 0 if none.
+func (m *MetaNode) Leader() uint64 {
+	if m.net.Crashed(m.ID) {
+		return 0
+	}
+	return m.node.Node.Status().Lead
+}
+
+// Call runs handler of the API of node with req as json body, decoding the
+// response into resp, a response of raftmeta embedding CommonResp. Failed
+// responses are returned as errors.
+func (m *MetaNode) Call(handler http.HandlerFunc, req, resp interface{}) error {
+	if m.net.Crashed(m.ID) {
+		return ErrCrashed
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+
+	var common raftmeta.CommonResp
+	if err := json.Unmarshal(w.Body.Bytes(), &common); err != nil {
+		return err
+	}
+	if common.RetCode != 0 {
+		return errors.New(common.RetMsg)
+	}
+	return json.Unmarshal(w.Body.Bytes(), resp)
+}
+
+// deliver steps messages received by node, so senders never wait for it.
+func (m *MetaNode) deliver() {
+	for {
+		select {
+		case msg := <-m.inbox:
+			m.node.RecvRaftRPC(context.Background(), msg)
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// metaTransport delivers raft messages to nodes of the cluster reached.
+type metaTransport struct {
+	*raftmeta.Transport
+	cluster *MetaCluster
+	from    uint64
+}
+
+func (t *metaTransport) SendMessage(messages []raftpb.Message) {
+	for _, msg := range messages {
+		to := t.cluster.Node(msg.To)
+		if to == nil || !t.cluster.Net.Reachable(t.from, msg.To) {
+			continue
+		}
+		select {
+		case to.inbox <- msg:
+		default:
+			// dropped like by a congested network, raft resends
+		}
+	}
+}
+
+// waitFor waits for check to succeed, returning its last error on timeout.
+func waitFor(timeout time.Duration, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,105 @@
+// Package chaos runs clusters of meta and data nodes in a single process and
+// injects faults into them: network partitions, node crashes and clock skew.
+// Tests drive writes and meta changes through the faults and assert that the
+// invariants of the cluster hold once they heal, e.g. that no acknowledged
+// write is lost, replicas converge and meta nodes agree.
+//
+// Meta nodes are full raft nodes exchanging messages in memory, data nodes
+// are coordinators writing to each other over gRPC with hinted handoff, but
+// storing points in memory instead of tsdb.
+package chaos
+
+import (
+	"sync"
+	"time"
+
+	"github.com/angopher/chronus/errs"
+)
+
+var (
+	// ErrUnreachable is returned by calls between nodes partitioned or crashed.
+	ErrUnreachable = errs.New(errs.KindUnavailable, "node unreachable")
+	// ErrCrashed is returned by calls to a node crashed.
+	ErrCrashed = errs.New(errs.KindUnavailable, "node crashed")
+)
+
+// Network decides which nodes reach each other, and the clocks of nodes.
+// Crashed nodes reach no one and keep their state until recovered, like a
+// process killed and restarted with its disk.
+type Network struct {
+	mu      sync.RWMutex
+	groups  map[uint64]int
+	crashed map[uint64]bool
+	skews   map[uint64]time.Duration
+}
+
+// NewNetwork returns a Network where all nodes reach each other.
+func NewNetwork() *Network {
+	return &Network{
+		groups:  make(map[uint64]int),
+		crashed: make(map[uint64]bool),
+		skews:   make(map[uint64]time.Duration),
+	}
+}
+
+// Partition splits nodes into groups reaching only nodes of the same group,
+// nodes not in any group form one more group together.
+func (n *Network) Partition(groups ...[]uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.groups = make(map[uint64]int)
+	for i, g := range groups {
+		for _, id := range g {
+			n.groups[id] = i + 1
+		}
+	}
+}
+
+// Heal removes partitions, crashed nodes stay crashed.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.groups = make(map[uint64]int)
+}
+
+// Crash stops node talking to anyone until recovered.
+func (n *Network) Crash(id uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.crashed[id] = true
+}
+
+// Recover brings a node crashed back.
+func (n *Network) Recover(id uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.crashed, id)
+}
+
+// Crashed returns whether node is crashed.
+func (n *Network) Crashed(id uint64) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.crashed[id]
+}
+
+// Reachable returns whether messages of from are delivered to to.
+func (n *Network) Reachable(from, to uint64) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return !n.crashed[from] && !n.crashed[to] && n.groups[from] == n.groups[to]
+}
+
+// Skew sets the offset of the clock of node to the real one.
+func (n *Network) Skew(id uint64, d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.skews[id] = d
+}
+
+// Now returns the time by the clock of node.
+func (n *Network) Now(id uint64) time.Time {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return time.Now().Add(n.skews[id])
+}
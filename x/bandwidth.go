@@ -0,0 +1,134 @@
+package x
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// BandwidthWindow is a daily time window, from Start to End in "15:04" local
+// time, in which Rate in bytes per second applies. A window ending before it
+// starts spans midnight.
+type BandwidthWindow struct {
+	Start string `toml:"start"`
+	End   string `toml:"end"`
+	Rate  int64  `toml:"rate"`
+}
+
+// BandwidthSchedule is a rate limit by time of day. The first window covering
+// a time wins, Rate applies outside all of them. A rate of 0 is unlimited.
+type BandwidthSchedule struct {
+	Rate    int64
+	Windows []BandwidthWindow
+
+	// minutes of day windows start and end at
+	starts, ends []int
+}
+
+// NewBandwidthSchedule returns the schedule of rate and windows.
+func NewBandwidthSchedule(rate int64, windows []BandwidthWindow) (*BandwidthSchedule, error) {
+	s := &BandwidthSchedule{
+		Rate:    rate,
+		Windows: windows,
+		starts:  make([]int, len(windows)),
+		ends:    make([]int, len(windows)),
+	}
+	if rate < 0 {
+		return nil, fmt.Errorf("negative rate %d", rate)
+	}
+	for i, w := range windows {
+		start, err := minuteOfDay(w.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := minuteOfDay(w.End)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("window %s-%s is empty", w.Start, w.End)
+		}
+		if w.Rate < 0 {
+			return nil, fmt.Errorf("negative rate %d of window %s-%s", w.Rate, w.Start, w.End)
+		}
+		s.starts[i], s.ends[i] = start, end
+	}
+	return s, nil
+}
+
+// ValidateBandwidthWindows returns an error if windows could not be scheduled.
+func ValidateBandwidthWindows(windows []BandwidthWindow) error {
+	_, err := NewBandwidthSchedule(0, windows)
+	return err
+}
+
+func minuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, should be like 15:04", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// RateAt returns the rate in bytes per second at t.
+func (s *BandwidthSchedule) RateAt(t time.Time) int64 {
+	m := t.Hour()*60 + t.Minute()
+	for i, w := range s.Windows {
+		start, end := s.starts[i], s.ends[i]
+		if (start < end && m >= start && m < end) || (start > end && (m >= start || m < end)) {
+			return w.Rate
+		}
+	}
+	return s.Rate
+}
+
+// ScheduledLimiter limits bytes transferred to the rate of a schedule taking
+// effect at the moment.
+type ScheduledLimiter struct {
+	schedule *BandwidthSchedule
+
+	mu      sync.Mutex
+	rate    int64
+	limiter *rate.Limiter
+}
+
+// NewScheduledLimiter returns a limiter following schedule.
+func NewScheduledLimiter(schedule *BandwidthSchedule) *ScheduledLimiter {
+	return &ScheduledLimiter{
+		schedule: schedule,
+		rate:     -1,
+		limiter:  rate.NewLimiter(rate.Inf, 0),
+	}
+}
+
+// WaitN blocks until n bytes are allowed.
+func (l *ScheduledLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if r := l.schedule.RateAt(time.Now()); r != l.rate {
+		l.rate = r
+		if r == 0 {
+			l.limiter.SetLimit(rate.Inf)
+		} else {
+			l.limiter.SetLimit(rate.Limit(r))
+			// a second of data at most at once
+			l.limiter.SetBurst(int(r))
+		}
+	}
+	burst := int(l.rate)
+	l.mu.Unlock()
+
+	if burst == 0 {
+		return nil
+	}
+	for n > 0 {
+		c := Min(n, burst)
+		if err := l.limiter.WaitN(ctx, c); err != nil {
+			return err
+		}
+		n -= c
+	}
+	return nil
+}
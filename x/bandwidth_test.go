@@ -0,0 +1,59 @@
+package x
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBandwidthSchedule(t *testing.T) {
+	s, err := NewBandwidthSchedule(20, []BandwidthWindow{
+		{Start: "00:00", End: "06:00", Rate: 0},
+		{Start: "22:00", End: "01:00", Rate: 10},
+	})
+	assert.NoError(t, err)
+
+	at := func(clock string) time.Time {
+		t, _ := time.ParseInLocation("15:04", clock, time.Local)
+		return t
+	}
+	assert.Equal(t, int64(0), s.RateAt(at("00:00")))
+	assert.Equal(t, int64(0), s.RateAt(at("05:59")))
+	assert.Equal(t, int64(20), s.RateAt(at("06:00")))
+	assert.Equal(t, int64(20), s.RateAt(at("21:59")))
+	// windows spanning midnight
+	assert.Equal(t, int64(10), s.RateAt(at("22:00")))
+	assert.Equal(t, int64(10), s.RateAt(at("23:59")))
+}
+
+func TestBandwidthSchedule_Invalid(t *testing.T) {
+	for _, w := range []BandwidthWindow{
+		{Start: "0:00", End: "24:00"},
+		{Start: "noon", End: "13:00"},
+		{Start: "12:00", End: "12:00"},
+		{Start: "12:00", End: "13:00", Rate: -1},
+	} {
+		assert.Error(t, ValidateBandwidthWindows([]BandwidthWindow{w}), "%+v", w)
+	}
+	assert.NoError(t, ValidateBandwidthWindows(nil))
+}
+
+func TestScheduledLimiter(t *testing.T) {
+	// unlimited
+	l := NewScheduledLimiter(&BandwidthSchedule{})
+	start := time.Now()
+	assert.NoError(t, l.WaitN(context.Background(), 1<<30))
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	// transfers beyond a second of data wait
+	l = NewScheduledLimiter(&BandwidthSchedule{Rate: 1000})
+	start = time.Now()
+	assert.NoError(t, l.WaitN(context.Background(), 1500))
+	assert.True(t, time.Since(start) >= 400*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, l.WaitN(ctx, 1500))
+}
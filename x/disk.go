@@ -0,0 +1,15 @@
+// +build !windows
+
+package x
+
+import "syscall"
+
+// DiskSpace returns the bytes free for unprivileged users and the total bytes
+// of the filesystem of path.
+func DiskSpace(path string) (free, total int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), int64(st.Blocks) * int64(st.Bsize), nil
+}
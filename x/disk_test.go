@@ -0,0 +1,20 @@
+// +build !windows
+
+package x
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskSpace(t *testing.T) {
+	free, total, err := DiskSpace(os.TempDir())
+	assert.Nil(t, err)
+	assert.True(t, total > 0)
+	assert.True(t, free >= 0 && free <= total)
+
+	_, _, err = DiskSpace("/not/existing")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,8 @@
+package x
+
+import "errors"
+
+// DiskSpace is not supported on windows.
+func DiskSpace(path string) (free, total int64, err error) {
+	return 0, 0, errors.New("disk space is not supported on windows")
+}